@@ -29,6 +29,7 @@ const (
 	TypeTooManyRequests Type = "too_many_requests"
 	TypeTooLargeEntry   Type = "too_large_entry"
 	TypeNotAcceptable   Type = "not_acceptable"
+	TypeForbidden       Type = "forbidden"
 )
 
 type apiError struct {
@@ -61,6 +62,8 @@ func (e *apiError) statusCode() int {
 		return http.StatusRequestEntityTooLarge
 	case TypeNotAcceptable:
 		return http.StatusNotAcceptable
+	case TypeForbidden:
+		return http.StatusForbidden
 	}
 	return http.StatusInternalServerError
 }
@@ -121,7 +124,7 @@ func IsNonRetryableAPIError(err error) bool {
 	apiErr := &apiError{}
 	// Reasoning:
 	// TypeNone, TypeUnavailable and TypeNotFound are not used anywhere in Mimir or Prometheus;
-	// TypeTimeout, TypeTooManyRequests, TypeNotAcceptable we presume a retry of the same request will fail in the same way.
+	// TypeTimeout, TypeTooManyRequests, TypeNotAcceptable, TypeForbidden we presume a retry of the same request will fail in the same way.
 	// TypeCanceled means something wants us to stop.
 	// TypeExec, TypeBadData and TypeTooLargeEntry are caused by the input data.
 	// TypeInternal can be a 500 error e.g. from querier failing to contact storegateway.
@@ -29,6 +29,7 @@ import (
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/storage"
+	promstats "github.com/prometheus/prometheus/util/stats"
 	v1 "github.com/prometheus/prometheus/web/api/v1"
 
 	"github.com/grafana/mimir/pkg/querier"
@@ -263,7 +264,7 @@ func NewQuerierHandler(
 		// This is used for the stats API which we should not support. Or find other ways to.
 		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return nil, nil }),
 		reg,
-		nil,
+		querierStatsRenderer,
 		remoteWriteEnabled,
 		oltpEnabled,
 	)
@@ -312,6 +313,7 @@ func NewQuerierHandler(
 	router.Path(path.Join(prefix, "/api/v1/metadata")).Methods("GET").Handler(metadataQueryStats.Wrap(querier.NewMetadataHandler(metadataSupplier)))
 	router.Path(path.Join(prefix, "/api/v1/cardinality/label_names")).Methods("GET", "POST").Handler(cardinalityQueryStats.Wrap(querier.LabelNamesCardinalityHandler(distributor, limits)))
 	router.Path(path.Join(prefix, "/api/v1/cardinality/label_values")).Methods("GET", "POST").Handler(cardinalityQueryStats.Wrap(querier.LabelValuesCardinalityHandler(distributor, limits)))
+	router.Path(path.Join(prefix, "/api/v1/cardinality/cost_attribution")).Methods("GET").Handler(cardinalityQueryStats.Wrap(querier.CostAttributionHandler(distributor, limits)))
 	router.Path(path.Join(prefix, "/api/v1/format_query")).Methods("GET", "POST").Handler(formattingQueryStats.Wrap(promRouter))
 
 	// Track execution time.
@@ -321,6 +323,21 @@ func NewQuerierHandler(
 //go:embed memberlist_status.gohtml
 var memberlistStatusPageHTML string
 
+// querierStatsRenderer tracks the samples processed by the PromQL engine in the query stats carried by the context,
+// and then renders the engine stats in the response the same way Prometheus does.
+func querierStatsRenderer(ctx context.Context, s *promstats.Statistics, param string) promstats.QueryStats {
+	if s != nil && s.Samples != nil {
+		queryStats := stats.FromContext(ctx)
+		queryStats.AddSamplesProcessed(uint64(s.Samples.TotalSamples))
+		queryStats.UpdatePeakSamples(uint64(s.Samples.PeakSamples))
+	}
+
+	if param != "" {
+		return promstats.NewQueryStats(s)
+	}
+	return nil
+}
+
 func memberlistStatusHandler(httpPathPrefix string, kvs *memberlist.KVInitService) http.Handler {
 	templ := template.New("memberlist_status")
 	templ.Funcs(map[string]interface{}{
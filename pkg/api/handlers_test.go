@@ -6,14 +6,18 @@
 package api
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	promstats "github.com/prometheus/prometheus/util/stats"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/querier/stats"
 )
 
 func TestIndexHandlerPrefix(t *testing.T) {
@@ -197,3 +201,21 @@ func TestConfigOverrideHandler(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("config"), body)
 }
+
+func TestQuerierStatsRenderer(t *testing.T) {
+	samples := promstats.NewQuerySamples(false)
+	samples.TotalSamples = 100
+	samples.PeakSamples = 10
+	engineStats := &promstats.Statistics{Timers: promstats.NewQueryTimers(), Samples: samples}
+
+	queryStats, ctx := stats.ContextWithEmptyStats(context.Background())
+
+	assert.Nil(t, querierStatsRenderer(ctx, engineStats, ""))
+	assert.NotNil(t, querierStatsRenderer(ctx, engineStats, "all"))
+
+	assert.Equal(t, uint64(200), queryStats.LoadSamplesProcessed())
+	assert.Equal(t, uint64(10), queryStats.LoadPeakSamples())
+
+	// The query stats are optional in the context.
+	assert.Nil(t, querierStatsRenderer(context.Background(), engineStats, ""))
+}
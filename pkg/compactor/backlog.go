@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/storage/tsdb/downsample"
+	util_log "github.com/grafana/mimir/pkg/util/log"
+)
+
+// tenantBacklog is the estimated compaction backlog of a tenant.
+type tenantBacklog struct {
+	UserID   string `json:"user_id"`
+	Priority int    `json:"priority"`
+
+	// Lag is the time since the oldest first-level block which hasn't been compacted yet has been uploaded.
+	Lag time.Duration `json:"lag"`
+
+	// UncompactedBlocks is the number of first-level blocks which haven't been compacted yet.
+	UncompactedBlocks int `json:"uncompacted_blocks"`
+
+	// Err is the error which occurred while reading the bucket index, if any.
+	Err string `json:"error,omitempty"`
+}
+
+// estimateCompactionBacklog returns the compaction lag and the number of first-level blocks not compacted yet
+// in the bucket index. Blocks added to the index before their compaction level was tracked are not considered.
+func estimateCompactionBacklog(idx *bucketindex.Index, now time.Time) (lag time.Duration, uncompacted int) {
+	marked := make(map[ulid.ULID]struct{}, len(idx.BlockDeletionMarks))
+	for _, d := range idx.BlockDeletionMarks {
+		marked[d.ID] = struct{}{}
+	}
+
+	var oldest time.Time
+	for _, b := range idx.Blocks {
+		if b.CompactionLevel != 1 || b.Resolution != downsample.ResLevel0 {
+			continue
+		}
+
+		// Blocks marked for deletion have already been compacted.
+		if _, isMarked := marked[b.ID]; isMarked {
+			continue
+		}
+
+		uncompacted++
+		if uploadedAt := b.GetUploadedAt(); oldest.IsZero() || uploadedAt.Before(oldest) {
+			oldest = uploadedAt
+		}
+	}
+
+	if uncompacted == 0 || now.Before(oldest) {
+		return 0, uncompacted
+	}
+	return now.Sub(oldest), uncompacted
+}
+
+// sortUsersByBacklog estimates the compaction backlog of the tenants owned by this compactor, and sorts
+// the input users by highest priority and largest lag first. The users not owned by this compactor are
+// moved to the end. The input slice is sorted in place.
+func (c *MultitenantCompactor) sortUsersByBacklog(ctx context.Context, users []string) []string {
+	now := time.Now()
+	backlogs := make(map[string]tenantBacklog, len(users))
+
+	for _, userID := range users {
+		if ctx.Err() != nil {
+			return users
+		}
+
+		// Ownership is checked again before compacting each tenant.
+		if owned, err := c.shardingStrategy.compactorOwnUser(userID); err != nil || !owned {
+			continue
+		}
+
+		b := tenantBacklog{UserID: userID, Priority: c.cfgProvider.CompactorTenantPriority(userID)}
+
+		// The bucket index is updated by the blocks cleaner, so the estimated lag may be
+		// up to the cleanup interval old.
+		idx, err := bucketindex.ReadIndex(ctx, c.bucketClient, userID, c.cfgProvider, c.logger)
+		switch {
+		case err == nil:
+			b.Lag, b.UncompactedBlocks = estimateCompactionBacklog(idx, now)
+		case errors.Is(err, bucketindex.ErrIndexNotFound):
+			// The tenant is new, or its bucket index hasn't been created yet.
+		default:
+			level.Warn(util_log.WithUserID(userID, c.logger)).Log("msg", "failed to read bucket index to estimate the compaction backlog", "err", err)
+			b.Err = err.Error()
+		}
+
+		backlogs[userID] = b
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		bi, iOwned := backlogs[users[i]]
+		bj, jOwned := backlogs[users[j]]
+		if iOwned != jOwned {
+			return iOwned
+		}
+		if bi.Priority != bj.Priority {
+			return bi.Priority > bj.Priority
+		}
+		return bi.Lag > bj.Lag
+	})
+
+	c.updateBacklog(users, backlogs, now)
+	return users
+}
+
+// updateBacklog stores the backlog of the owned tenants, in the order they're compacted,
+// and updates the compaction lag metric.
+func (c *MultitenantCompactor) updateBacklog(users []string, backlogs map[string]tenantBacklog, now time.Time) {
+	c.backlogMtx.Lock()
+	defer c.backlogMtx.Unlock()
+
+	for _, b := range c.backlog {
+		if _, ok := backlogs[b.UserID]; !ok {
+			c.tenantCompactionLag.DeleteLabelValues(b.UserID)
+		}
+	}
+
+	c.backlog = make([]tenantBacklog, 0, len(backlogs))
+	for _, userID := range users {
+		if b, ok := backlogs[userID]; ok {
+			c.backlog = append(c.backlog, b)
+			c.tenantCompactionLag.WithLabelValues(userID).Set(b.Lag.Seconds())
+		}
+	}
+	c.backlogUpdatedAt = now
+}
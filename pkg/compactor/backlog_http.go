@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	_ "embed" // Used to embed html template
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+//go:embed backlog.gohtml
+var backlogPageHTML string
+var backlogTemplate = template.Must(template.New("webpage").Parse(backlogPageHTML))
+
+type backlogPageContents struct {
+	Now       time.Time       `json:"now"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Message   string          `json:"message,omitempty"`
+	Tenants   []tenantBacklog `json:"tenants,omitempty"`
+}
+
+// BacklogHandler shows the estimated compaction backlog of the tenants owned by this compactor.
+func (c *MultitenantCompactor) BacklogHandler(w http.ResponseWriter, req *http.Request) {
+	contents := backlogPageContents{Now: time.Now()}
+
+	if !c.compactorCfg.BacklogAwareSchedulingEnabled {
+		contents.Message = "Backlog-aware scheduling is disabled."
+	} else {
+		c.backlogMtx.Lock()
+		contents.UpdatedAt = c.backlogUpdatedAt
+		contents.Tenants = c.backlog
+		c.backlogMtx.Unlock()
+
+		if contents.UpdatedAt.IsZero() {
+			contents.Message = "The compaction backlog hasn't been estimated yet."
+		}
+	}
+
+	util.RenderHTTPResponse(w, contents, backlogTemplate, req)
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/storage/tsdb/downsample"
+	mimir_testutil "github.com/grafana/mimir/pkg/storage/tsdb/testutil"
+)
+
+func TestEstimateCompactionBacklog(t *testing.T) {
+	now := time.Now()
+
+	block1 := &bucketindex.Block{ID: ulid.MustNew(1, nil), CompactionLevel: 1, UploadedAt: now.Add(-3 * time.Hour).Unix()}
+	block2 := &bucketindex.Block{ID: ulid.MustNew(2, nil), CompactionLevel: 1, UploadedAt: now.Add(-2 * time.Hour).Unix()}
+	block3 := &bucketindex.Block{ID: ulid.MustNew(3, nil), CompactionLevel: 1, UploadedAt: now.Add(-time.Hour).Unix()}
+	compacted := &bucketindex.Block{ID: ulid.MustNew(4, nil), CompactionLevel: 2, UploadedAt: now.Add(-4 * time.Hour).Unix()}
+	unknownLevel := &bucketindex.Block{ID: ulid.MustNew(5, nil), UploadedAt: now.Add(-5 * time.Hour).Unix()}
+	downsampled := &bucketindex.Block{ID: ulid.MustNew(6, nil), CompactionLevel: 1, UploadedAt: now.Add(-6 * time.Hour).Unix(), Resolution: downsample.ResLevel1, Aggregate: downsample.AggrAvg}
+
+	tests := map[string]struct {
+		index               *bucketindex.Index
+		expectedLag         time.Duration
+		expectedUncompacted int
+	}{
+		"empty index": {
+			index: &bucketindex.Index{},
+		},
+		"only compacted blocks": {
+			index: &bucketindex.Index{Blocks: bucketindex.Blocks{compacted, unknownLevel, downsampled}},
+		},
+		"first-level blocks": {
+			index:               &bucketindex.Index{Blocks: bucketindex.Blocks{block2, compacted, block1, block3}},
+			expectedLag:         3 * time.Hour,
+			expectedUncompacted: 3,
+		},
+		"first-level blocks marked for deletion have already been compacted": {
+			index: &bucketindex.Index{
+				Blocks:             bucketindex.Blocks{block1, block2, block3},
+				BlockDeletionMarks: bucketindex.BlockDeletionMarks{{ID: block1.ID}},
+			},
+			expectedLag:         2 * time.Hour,
+			expectedUncompacted: 2,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			lag, uncompacted := estimateCompactionBacklog(testData.index, time.Unix(now.Unix(), 0))
+			assert.Equal(t, testData.expectedLag, lag)
+			assert.Equal(t, testData.expectedUncompacted, uncompacted)
+		})
+	}
+}
+
+func TestMultitenantCompactor_SortUsersByBacklog(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	bucketClient, _ := mimir_testutil.PrepareFilesystemBucket(t)
+
+	writeIndex := func(userID string, uploadedAt ...time.Time) {
+		idx := &bucketindex.Index{Version: bucketindex.IndexVersion2, UpdatedAt: now.Unix()}
+		for i, t := range uploadedAt {
+			idx.Blocks = append(idx.Blocks, &bucketindex.Block{ID: ulid.MustNew(uint64(i), nil), CompactionLevel: 1, UploadedAt: t.Unix()})
+		}
+		require.NoError(t, bucketindex.WriteIndex(ctx, bucketClient, userID, nil, idx))
+	}
+
+	writeIndex("user-1", now.Add(-time.Hour))
+	writeIndex("user-2", now.Add(-3*time.Hour), now.Add(-time.Hour))
+	writeIndex("user-3", now.Add(-2*time.Hour))
+	writeIndex("user-4", now.Add(-10*time.Hour))
+	// user-5 has no bucket index.
+
+	cfg := prepareConfig(t)
+	cfg.BacklogAwareSchedulingEnabled = true
+
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.tenantPriority["user-3"] = 1
+
+	c, _, _, _, _ := prepareWithConfigProvider(t, cfg, bucketClient, cfgProvider)
+	c.bucketClient = bucketClient
+	c.shardingStrategy = ownedUsersShardingStrategy{"user-1": true, "user-2": true, "user-3": true, "user-5": true}
+
+	// user-3 has the highest priority, then the owned users are sorted by lag, and the not owned users are last.
+	actual := c.sortUsersByBacklog(ctx, []string{"user-1", "user-2", "user-3", "user-4", "user-5"})
+	assert.Equal(t, []string{"user-3", "user-2", "user-1", "user-5", "user-4"}, actual)
+
+	// The blocks upload time has seconds precision.
+	assert.InDelta(t, time.Hour.Seconds(), prom_testutil.ToFloat64(c.tenantCompactionLag.WithLabelValues("user-1")), 1)
+	assert.InDelta(t, (3 * time.Hour).Seconds(), prom_testutil.ToFloat64(c.tenantCompactionLag.WithLabelValues("user-2")), 1)
+	assert.InDelta(t, (2 * time.Hour).Seconds(), prom_testutil.ToFloat64(c.tenantCompactionLag.WithLabelValues("user-3")), 1)
+	assert.Equal(t, float64(0), prom_testutil.ToFloat64(c.tenantCompactionLag.WithLabelValues("user-5")))
+	assert.Equal(t, 4, prom_testutil.CollectAndCount(c.tenantCompactionLag))
+
+	// The backlog is shown on the status page, in compaction order.
+	req := httptest.NewRequest(http.MethodGet, "/compactor/backlog", nil)
+	req.Header.Set("Accept", "application/json")
+	resp := httptest.NewRecorder()
+	c.BacklogHandler(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var contents backlogPageContents
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &contents))
+	require.Len(t, contents.Tenants, 4)
+	assertTenantBacklog(t, tenantBacklog{UserID: "user-3", Priority: 1, Lag: 2 * time.Hour, UncompactedBlocks: 1}, contents.Tenants[0])
+	assertTenantBacklog(t, tenantBacklog{UserID: "user-2", Lag: 3 * time.Hour, UncompactedBlocks: 2}, contents.Tenants[1])
+	assertTenantBacklog(t, tenantBacklog{UserID: "user-1", Lag: time.Hour, UncompactedBlocks: 1}, contents.Tenants[2])
+	assertTenantBacklog(t, tenantBacklog{UserID: "user-5"}, contents.Tenants[3])
+
+	// The metrics of the tenants no longer owned are removed.
+	c.shardingStrategy = ownedUsersShardingStrategy{"user-1": true}
+	c.sortUsersByBacklog(ctx, []string{"user-1", "user-2", "user-3", "user-4", "user-5"})
+
+	assert.Equal(t, 1, prom_testutil.CollectAndCount(c.tenantCompactionLag))
+	assert.InDelta(t, time.Hour.Seconds(), prom_testutil.ToFloat64(c.tenantCompactionLag.WithLabelValues("user-1")), 1)
+}
+
+// assertTenantBacklog asserts the backlog is the expected one. The lag is compared with a tolerance,
+// because the blocks upload time has seconds precision.
+func assertTenantBacklog(t *testing.T, expected, actual tenantBacklog) {
+	t.Helper()
+
+	assert.InDelta(t, expected.Lag.Seconds(), actual.Lag.Seconds(), 1)
+	expected.Lag, actual.Lag = 0, 0
+	assert.Equal(t, expected, actual)
+}
+
+// ownedUsersShardingStrategy is a shardingStrategy owning the users and their jobs in the map.
+type ownedUsersShardingStrategy map[string]bool
+
+func (s ownedUsersShardingStrategy) compactorOwnUser(userID string) (bool, error) {
+	return s[userID], nil
+}
+
+func (s ownedUsersShardingStrategy) blocksCleanerOwnUser(userID string) (bool, error) {
+	return s[userID], nil
+}
+
+func (s ownedUsersShardingStrategy) ownJob(job *Job) (bool, error) {
+	return s[job.UserID()], nil
+}
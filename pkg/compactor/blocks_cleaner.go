@@ -27,6 +27,8 @@ import (
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/storage/tsdb/downsample"
+	"github.com/grafana/mimir/pkg/storage/tsdb/metricmetadata"
 	"github.com/grafana/mimir/pkg/util"
 	util_log "github.com/grafana/mimir/pkg/util/log"
 	"github.com/grafana/mimir/pkg/util/validation"
@@ -43,6 +45,9 @@ type BlocksCleanerConfig struct {
 	TenantCleanupDelay         time.Duration // Delay before removing tenant deletion mark and "debug".
 	DeleteBlocksConcurrency    int
 	NoBlocksFileCleanupEnabled bool
+	DataDir                    string        // Directory used to rewrite blocks when purging deleted series.
+	SeriesDeletionDelay        time.Duration // Delay before purging the samples of a series deletion request.
+	MetricMetadataEnabled      bool          // Whether to compact the metric metadata uploaded by the ingesters.
 }
 
 type BlocksCleaner struct {
@@ -56,33 +61,49 @@ type BlocksCleaner struct {
 	ownUser      func(userID string) (bool, error)
 	singleFlight *concurrency.LimitedConcurrencySingleFlight
 
+	// Background jobs purging the samples of the series deletion requests and of the retention rules.
+	seriesDeletionJobs *seriesDeletionJobs
+
+	// Client of the cold storage bucket. It's nil if the cold storage is disabled.
+	coldBucketClient objstore.Bucket
+
 	// Keep track of the last owned users.
 	lastOwnedUsers []string
 
 	// Metrics.
-	runsStarted                    prometheus.Counter
-	runsCompleted                  prometheus.Counter
-	runsFailed                     prometheus.Counter
-	runsLastSuccess                prometheus.Gauge
-	blocksCleanedTotal             prometheus.Counter
-	blocksFailedTotal              prometheus.Counter
-	blocksMarkedForDeletion        prometheus.Counter
-	partialBlocksMarkedForDeletion prometheus.Counter
-	tenantBlocks                   *prometheus.GaugeVec
-	tenantMarkedBlocks             *prometheus.GaugeVec
-	tenantPartialBlocks            *prometheus.GaugeVec
-	tenantBucketIndexLastUpdate    *prometheus.GaugeVec
+	runsStarted                     prometheus.Counter
+	runsCompleted                   prometheus.Counter
+	runsFailed                      prometheus.Counter
+	runsLastSuccess                 prometheus.Gauge
+	blocksCleanedTotal              prometheus.Counter
+	blocksFailedTotal               prometheus.Counter
+	blocksMarkedForDeletion         prometheus.Counter
+	partialBlocksMarkedForDeletion  prometheus.Counter
+	seriesDeletionPurge             seriesPurgeReason
+	seriesDeletionRequestsProcessed prometheus.Counter
+	retentionRulesPurge             seriesPurgeReason
+	seriesRewrite                   seriesPurgeReason
+	seriesRewriteRequestsProcessed  prometheus.Counter
+	blocksMovedToColdStorage        prometheus.Counter
+	blocksMovedToColdStorageFailed  prometheus.Counter
+	tenantBlocks                    *prometheus.GaugeVec
+	tenantMarkedBlocks              *prometheus.GaugeVec
+	tenantPartialBlocks             *prometheus.GaugeVec
+	tenantBucketIndexLastUpdate     *prometheus.GaugeVec
 }
 
-func NewBlocksCleaner(cfg BlocksCleanerConfig, bucketClient objstore.Bucket, ownUser func(userID string) (bool, error), cfgProvider ConfigProvider, logger log.Logger, reg prometheus.Registerer) *BlocksCleaner {
+// NewBlocksCleaner makes a new BlocksCleaner. The coldBucketClient is nil if the cold storage is disabled.
+func NewBlocksCleaner(cfg BlocksCleanerConfig, bucketClient, coldBucketClient objstore.Bucket, ownUser func(userID string) (bool, error), cfgProvider ConfigProvider, logger log.Logger, reg prometheus.Registerer) *BlocksCleaner {
 	c := &BlocksCleaner{
-		cfg:          cfg,
-		bucketClient: bucketClient,
-		usersScanner: mimir_tsdb.NewUsersScanner(bucketClient, ownUser, logger),
-		ownUser:      ownUser,
-		cfgProvider:  cfgProvider,
-		singleFlight: concurrency.NewLimitedConcurrencySingleFlight(cfg.CleanupConcurrency),
-		logger:       log.With(logger, "component", "cleaner"),
+		cfg:                cfg,
+		bucketClient:       bucketClient,
+		coldBucketClient:   coldBucketClient,
+		usersScanner:       mimir_tsdb.NewUsersScanner(bucketClient, ownUser, logger),
+		ownUser:            ownUser,
+		cfgProvider:        cfgProvider,
+		singleFlight:       concurrency.NewLimitedConcurrencySingleFlight(cfg.CleanupConcurrency),
+		seriesDeletionJobs: newSeriesDeletionJobs(cfg.CleanupConcurrency),
+		logger:             log.With(logger, "component", "cleaner"),
 		runsStarted: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Name: "cortex_compactor_block_cleanup_started_total",
 			Help: "Total number of blocks cleanup runs started.",
@@ -117,6 +138,58 @@ func NewBlocksCleaner(cfg BlocksCleanerConfig, bucketClient objstore.Bucket, own
 			Help:        blocksMarkedForDeletionHelp,
 			ConstLabels: prometheus.Labels{"reason": "partial"},
 		}),
+		seriesDeletionPurge: seriesPurgeReason{
+			deletionDetails: "source of block rewritten to purge deleted series",
+			blocksMarkedForDeletion: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name:        blocksMarkedForDeletionName,
+				Help:        blocksMarkedForDeletionHelp,
+				ConstLabels: prometheus.Labels{"reason": "series-deletion"},
+			}),
+			blocksRewritten: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name: "cortex_compactor_series_deletion_blocks_rewritten_total",
+				Help: "Total number of blocks rewritten to purge the samples of series deletion requests.",
+			}),
+		},
+		seriesDeletionRequestsProcessed: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_series_deletion_requests_processed_total",
+			Help: "Total number of series deletion requests whose samples have been purged from all blocks.",
+		}),
+		retentionRulesPurge: seriesPurgeReason{
+			deletionDetails: "source of block rewritten to delete series expired by retention rules",
+			blocksMarkedForDeletion: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name:        blocksMarkedForDeletionName,
+				Help:        blocksMarkedForDeletionHelp,
+				ConstLabels: prometheus.Labels{"reason": "retention-rules"},
+			}),
+			blocksRewritten: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name: "cortex_compactor_retention_rules_blocks_rewritten_total",
+				Help: "Total number of blocks rewritten to delete the series expired by retention rules.",
+			}),
+		},
+		seriesRewrite: seriesPurgeReason{
+			deletionDetails: "source of block rewritten by series rewrite request",
+			blocksMarkedForDeletion: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name:        blocksMarkedForDeletionName,
+				Help:        blocksMarkedForDeletionHelp,
+				ConstLabels: prometheus.Labels{"reason": "series-rewrite"},
+			}),
+			blocksRewritten: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name: "cortex_compactor_series_rewrite_blocks_rewritten_total",
+				Help: "Total number of blocks rewritten to apply the relabel configs of series rewrite requests.",
+			}),
+		},
+		seriesRewriteRequestsProcessed: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_series_rewrite_requests_processed_total",
+			Help: "Total number of series rewrite requests whose series have been rewritten in all blocks.",
+		}),
+		blocksMovedToColdStorage: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_blocks_moved_to_cold_storage_total",
+			Help: "Total number of blocks moved to the cold storage.",
+		}),
+		blocksMovedToColdStorageFailed: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_blocks_moved_to_cold_storage_failures_total",
+			Help: "Total number of blocks failed to be moved to the cold storage.",
+		}),
 
 		// The following metrics don't have the "cortex_compactor" prefix because not strictly related to
 		// the compactor. They're just tracked by the compactor because it's the most logical place where these
@@ -146,6 +219,7 @@ func NewBlocksCleaner(cfg BlocksCleanerConfig, bucketClient objstore.Bucket, own
 
 func (c *BlocksCleaner) stopping(error) error {
 	c.singleFlight.Wait()
+	c.seriesDeletionJobs.wait()
 	return nil
 }
 
@@ -304,7 +378,7 @@ func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID
 			return nil
 		}
 
-		err := block.Delete(ctx, userLogger, userBucket, id)
+		err := c.deleteBlock(ctx, userID, userBucket, id, userLogger)
 		if err != nil {
 			failed++
 			c.blocksFailedTotal.Inc()
@@ -322,6 +396,36 @@ func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID
 		return err
 	}
 
+	// The blocks moved to the cold storage don't exist in the blocks storage bucket anymore.
+	if c.coldBucketClient != nil {
+		err = c.coldUserBucket(userID).Iter(ctx, "", func(name string) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			id, ok := block.IsBlockDir(name)
+			if !ok {
+				return nil
+			}
+
+			if err := c.deleteBlock(ctx, userID, userBucket, id, userLogger); err != nil {
+				failed++
+				c.blocksFailedTotal.Inc()
+				level.Warn(userLogger).Log("msg", "failed to delete block from the cold storage", "block", id, "err", err)
+				return nil // Continue with other blocks.
+			}
+
+			deletedBlocks++
+			c.blocksCleanedTotal.Inc()
+			level.Info(userLogger).Log("msg", "deleted block from the cold storage", "block", id)
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
 	if failed > 0 {
 		// The number of blocks left in the storage is equal to the number of blocks we failed
 		// to delete. We also consider them all marked for deletion given the next run will try
@@ -412,18 +516,39 @@ func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string, userLogger
 	if idx != nil {
 		// We do not want to stop the remaining work in the cleaner if an
 		// error occurs here. Errors are logged in the function.
-		retention := c.cfgProvider.CompactorBlocksRetentionPeriod(userID)
-		c.applyUserRetentionPeriod(ctx, idx, retention, userBucket, userLogger)
+		// Each resolution has its own retention period.
+		c.applyUserRetentionPeriod(ctx, idx, downsample.ResLevel0, c.cfgProvider.CompactorBlocksRetentionPeriod(userID), userBucket, userLogger)
+		c.applyUserRetentionPeriod(ctx, idx, downsample.ResLevel1, c.cfgProvider.CompactorBlocksRetentionPeriod5m(userID), userBucket, userLogger)
+		c.applyUserRetentionPeriod(ctx, idx, downsample.ResLevel2, c.cfgProvider.CompactorBlocksRetentionPeriod1h(userID), userBucket, userLogger)
 	}
 
 	// Generate an updated in-memory version of the bucket index.
-	w := bucketindex.NewUpdater(c.bucketClient, userID, c.cfgProvider, userLogger)
+	w := bucketindex.NewTieredUpdater(c.bucketClient, c.coldBucketClient, userID, c.cfgProvider, userLogger)
 	idx, partials, err := w.UpdateIndex(ctx, idx)
 	if err != nil {
 		return err
 	}
 
-	c.deleteBlocksMarkedForDeletion(ctx, idx, userBucket, userLogger)
+	c.deleteBlocksMarkedForDeletion(ctx, idx, userID, userBucket, userLogger)
+
+	// Rewrite the series of the pending series rewrite requests. This is a best effort, and the rewritten
+	// blocks are published together with the deletion marks of the original ones. The blocks are not
+	// rewritten while the series deletion job of the tenant is running, so that the same block is not
+	// rewritten twice concurrently.
+	if !c.seriesDeletionJobs.isRunning(userID) {
+		c.applySeriesRewrites(ctx, idx, userID, userBucket, userLogger)
+	}
+
+	// Move the old blocks to the cold storage, and delete the copies left in the blocks storage
+	// bucket by the previous moves. Errors are logged, and the moves are retried in the next run.
+	c.moveBlocksToColdStorage(ctx, idx, userID, userBucket, userLogger)
+	c.deleteHotCopies(ctx, idx, w.HotCopies(), userBucket, userLogger)
+
+	// Compact the metric metadata uploaded by the ingesters. This is a best effort, because
+	// queriers also read the segments which haven't been compacted yet.
+	if c.cfg.MetricMetadataEnabled {
+		c.compactMetricMetadata(ctx, userID, userLogger)
+	}
 
 	// Partial blocks with a deletion mark can be cleaned up. This is a best effort, so we don't return
 	// error if the cleanup of partial blocks fail.
@@ -436,7 +561,7 @@ func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string, userLogger
 			level.Warn(userLogger).Log("msg", "partial blocks deletion has been disabled for tenant because the delay has been set lower than the minimum value allowed", "minimum", validation.MinCompactorPartialBlockDeletionDelay)
 		}
 
-		c.cleanUserPartialBlocks(ctx, partials, idx, partialDeletionCutoffTime, userBucket, userLogger)
+		c.cleanUserPartialBlocks(ctx, userID, partials, idx, partialDeletionCutoffTime, userBucket, userLogger)
 		level.Info(userLogger).Log("msg", "cleaned up partial blocks", "partials", len(partials))
 	}
 
@@ -457,11 +582,47 @@ func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string, userLogger
 	c.tenantPartialBlocks.WithLabelValues(userID).Set(float64(len(partials)))
 	c.tenantBucketIndexLastUpdate.WithLabelValues(userID).SetToCurrentTime()
 
+	// Purge the samples of the pending series deletion requests and the series expired by the retention
+	// rules in background. This is a best effort, so we don't return error if it fails: pending requests
+	// and retention rules are still honoured at query time. The remaining partial blocks are the blocks
+	// whose upload is in progress. The index is not modified anymore by this function, so it's safe to
+	// pass it to the job.
+	if len(idx.Tombstones) > 0 || len(c.cfgProvider.CompactorBlocksRetentionRules(userID)) > 0 {
+		uploadsInProgress := len(partials) > 0
+		c.seriesDeletionJobs.start(ctx, userID, func(ctx context.Context) {
+			marked := make(map[ulid.ULID]struct{}, len(idx.BlockDeletionMarks))
+			for _, d := range idx.BlockDeletionMarks {
+				marked[d.ID] = struct{}{}
+			}
+
+			c.applySeriesDeletions(ctx, idx, marked, userID, userBucket, uploadsInProgress, userLogger)
+			c.applyRetentionRules(ctx, idx, marked, userID, userBucket, userLogger)
+		})
+	}
+
 	return nil
 }
 
+// compactMetricMetadata merges the metric metadata segments uploaded by the ingesters into the compacted
+// metric metadata file, removing the metadata not received within the tenant's blocks retention period.
+func (c *BlocksCleaner) compactMetricMetadata(ctx context.Context, userID string, userLogger log.Logger) {
+	var notSeenSince time.Time // zero value, disabled.
+	if retention := c.cfgProvider.CompactorBlocksRetentionPeriod(userID); retention > 0 {
+		notSeenSince = time.Now().Add(-retention)
+	}
+
+	compacted, err := metricmetadata.Compact(ctx, c.bucketClient, userID, c.cfgProvider, notSeenSince, userLogger)
+	if err != nil {
+		level.Warn(userLogger).Log("msg", "failed to compact metric metadata", "err", err)
+		return
+	}
+	if compacted > 0 {
+		level.Info(userLogger).Log("msg", "compacted metric metadata", "segments", compacted)
+	}
+}
+
 // Concurrently deletes blocks marked for deletion, and removes blocks from index.
-func (c *BlocksCleaner) deleteBlocksMarkedForDeletion(ctx context.Context, idx *bucketindex.Index, userBucket objstore.Bucket, userLogger log.Logger) {
+func (c *BlocksCleaner) deleteBlocksMarkedForDeletion(ctx context.Context, idx *bucketindex.Index, userID string, userBucket objstore.Bucket, userLogger log.Logger) {
 	blocksToDelete := make([]ulid.ULID, 0, len(idx.BlockDeletionMarks))
 
 	// Collect blocks marked for deletion into buffered channel.
@@ -478,7 +639,7 @@ func (c *BlocksCleaner) deleteBlocksMarkedForDeletion(ctx context.Context, idx *
 	_ = concurrency.ForEachJob(ctx, len(blocksToDelete), c.cfg.DeleteBlocksConcurrency, func(ctx context.Context, jobIdx int) error {
 		blockID := blocksToDelete[jobIdx]
 
-		if err := block.Delete(ctx, userLogger, userBucket, blockID); err != nil {
+		if err := c.deleteBlock(ctx, userID, userBucket, blockID, userLogger); err != nil {
 			c.blocksFailedTotal.Inc()
 			level.Warn(userLogger).Log("msg", "failed to delete block marked for deletion", "block", blockID, "err", err)
 			return nil
@@ -497,7 +658,7 @@ func (c *BlocksCleaner) deleteBlocksMarkedForDeletion(ctx context.Context, idx *
 
 // cleanUserPartialBlocks deletes partial blocks which are safe to be deleted. The provided index is updated accordingly.
 // partialDeletionCutoffTime, if not zero, is used to find blocks without deletion marker that were last modified before this time. Such blocks will be marked for deletion.
-func (c *BlocksCleaner) cleanUserPartialBlocks(ctx context.Context, partials map[ulid.ULID]error, idx *bucketindex.Index, partialDeletionCutoffTime time.Time, userBucket objstore.InstrumentedBucket, userLogger log.Logger) {
+func (c *BlocksCleaner) cleanUserPartialBlocks(ctx context.Context, userID string, partials map[ulid.ULID]error, idx *bucketindex.Index, partialDeletionCutoffTime time.Time, userBucket objstore.InstrumentedBucket, userLogger log.Logger) {
 	// Collect all blocks with missing meta.json into buffered channel.
 	blocks := make([]ulid.ULID, 0, len(partials))
 
@@ -531,7 +692,7 @@ func (c *BlocksCleaner) cleanUserPartialBlocks(ctx context.Context, partials map
 
 		// Hard-delete partial blocks having a deletion mark, even if the deletion threshold has not
 		// been reached yet.
-		if err := block.Delete(ctx, userLogger, userBucket, blockID); err != nil {
+		if err := c.deleteBlock(ctx, userID, userBucket, blockID, userLogger); err != nil {
 			c.blocksFailedTotal.Inc()
 			level.Warn(userLogger).Log("msg", "error deleting partial block marked for deletion", "block", blockID, "err", err)
 			return nil
@@ -566,14 +727,14 @@ func (c *BlocksCleaner) cleanUserPartialBlocks(ctx context.Context, partials map
 	}
 }
 
-// applyUserRetentionPeriod marks blocks for deletion which have aged past the retention period.
-func (c *BlocksCleaner) applyUserRetentionPeriod(ctx context.Context, idx *bucketindex.Index, retention time.Duration, userBucket objstore.Bucket, userLogger log.Logger) {
+// applyUserRetentionPeriod marks blocks of the given resolution for deletion which have aged past the retention period.
+func (c *BlocksCleaner) applyUserRetentionPeriod(ctx context.Context, idx *bucketindex.Index, resolution int64, retention time.Duration, userBucket objstore.Bucket, userLogger log.Logger) {
 	// The retention period of zero is a special value indicating to never delete.
 	if retention <= 0 {
 		return
 	}
 
-	blocks := listBlocksOutsideRetentionPeriod(idx, time.Now().Add(-retention))
+	blocks := listBlocksOutsideRetentionPeriod(idx, resolution, time.Now().Add(-retention))
 
 	// Attempt to mark all blocks. It is not critical if a marking fails, as
 	// the cleaner will retry applying the retention in its next cycle.
@@ -583,12 +744,12 @@ func (c *BlocksCleaner) applyUserRetentionPeriod(ctx context.Context, idx *bucke
 			level.Warn(userLogger).Log("msg", "failed to mark block for deletion", "block", b.ID, "err", err)
 		}
 	}
-	level.Info(userLogger).Log("msg", "marked blocks for deletion", "num_blocks", len(blocks), "retention", retention.String())
+	level.Info(userLogger).Log("msg", "marked blocks for deletion", "num_blocks", len(blocks), "resolution", downsample.ResolutionString(resolution), "retention", retention.String())
 }
 
-// listBlocksOutsideRetentionPeriod determines the blocks which have aged past
-// the specified retention period, and are not already marked for deletion.
-func listBlocksOutsideRetentionPeriod(idx *bucketindex.Index, threshold time.Time) (result bucketindex.Blocks) {
+// listBlocksOutsideRetentionPeriod determines the blocks of the given resolution which have
+// aged past the specified retention period, and are not already marked for deletion.
+func listBlocksOutsideRetentionPeriod(idx *bucketindex.Index, resolution int64, threshold time.Time) (result bucketindex.Blocks) {
 	// Whilst re-marking a block is not harmful, it is wasteful and generates
 	// a warning log message. Use the block deletion marks already in-memory
 	// to prevent marking blocks already marked for deletion.
@@ -598,6 +759,10 @@ func listBlocksOutsideRetentionPeriod(idx *bucketindex.Index, threshold time.Tim
 	}
 
 	for _, b := range idx.Blocks {
+		if b.Resolution != resolution {
+			continue
+		}
+
 		maxTime := time.Unix(b.MaxTime/1000, 0)
 		if maxTime.Before(threshold) {
 			if _, isMarked := marked[b.ID]; !isMarked {
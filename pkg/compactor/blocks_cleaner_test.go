@@ -31,9 +31,12 @@ import (
 	"github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/storage/tsdb/downsample"
+	"github.com/grafana/mimir/pkg/storage/tsdb/metricmetadata"
 	mimir_testutil "github.com/grafana/mimir/pkg/storage/tsdb/testutil"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/test"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 type testBlocksCleanerOptions struct {
@@ -110,7 +113,7 @@ func testBlocksCleanerWithOptions(t *testing.T, options testBlocksCleanerOptions
 	logger := log.NewNopLogger()
 	cfgProvider := newMockConfigProvider()
 
-	cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, cfgProvider, logger, reg)
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, reg)
 	require.NoError(t, services.StartAndAwaitRunning(ctx, cleaner))
 	defer services.StopAndAwaitTerminated(ctx, cleaner) //nolint:errcheck
 
@@ -244,7 +247,7 @@ func TestBlocksCleaner_ShouldContinueOnBlockDeletionFailure(t *testing.T) {
 	logger := log.NewNopLogger()
 	cfgProvider := newMockConfigProvider()
 
-	cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, cfgProvider, logger, nil)
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, nil)
 	require.NoError(t, services.StartAndAwaitRunning(ctx, cleaner))
 	defer services.StopAndAwaitTerminated(ctx, cleaner) //nolint:errcheck
 
@@ -304,7 +307,7 @@ func TestBlocksCleaner_ShouldRebuildBucketIndexOnCorruptedOne(t *testing.T) {
 	logger := log.NewNopLogger()
 	cfgProvider := newMockConfigProvider()
 
-	cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, cfgProvider, logger, nil)
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, nil)
 	require.NoError(t, services.StartAndAwaitRunning(ctx, cleaner))
 	defer services.StopAndAwaitTerminated(ctx, cleaner) //nolint:errcheck
 
@@ -355,7 +358,7 @@ func TestBlocksCleaner_ShouldRemoveMetricsForTenantsNotBelongingAnymoreToTheShar
 	reg := prometheus.NewPedanticRegistry()
 	cfgProvider := newMockConfigProvider()
 
-	cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, cfgProvider, logger, reg)
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, reg)
 	require.NoError(t, cleaner.runCleanupWithErr(ctx))
 
 	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
@@ -435,7 +438,7 @@ func TestBlocksCleaner_ShouldNotCleanupUserThatDoesntBelongToShardAnymore(t *tes
 		return true, nil
 	}
 
-	cleaner := NewBlocksCleaner(cfg, bucketClient, ownUser, cfgProvider, logger, reg)
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, ownUser, cfgProvider, logger, reg)
 	require.NoError(t, cleaner.runCleanupWithErr(ctx))
 
 	// Verify that we have seen the users
@@ -471,20 +474,20 @@ func TestBlocksCleaner_ListBlocksOutsideRetentionPeriod(t *testing.T) {
 	assert.ElementsMatch(t, []ulid.ULID{id1, id2, id3}, idx.Blocks.GetULIDs())
 
 	// Excessive retention period (wrapping epoch)
-	result := listBlocksOutsideRetentionPeriod(idx, time.Unix(10, 0).Add(-time.Hour))
+	result := listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(10, 0).Add(-time.Hour))
 	assert.ElementsMatch(t, []ulid.ULID{}, result.GetULIDs())
 
 	// Normal operation - varying retention period.
-	result = listBlocksOutsideRetentionPeriod(idx, time.Unix(6, 0))
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(6, 0))
 	assert.ElementsMatch(t, []ulid.ULID{}, result.GetULIDs())
 
-	result = listBlocksOutsideRetentionPeriod(idx, time.Unix(7, 0))
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(7, 0))
 	assert.ElementsMatch(t, []ulid.ULID{id1}, result.GetULIDs())
 
-	result = listBlocksOutsideRetentionPeriod(idx, time.Unix(8, 0))
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(8, 0))
 	assert.ElementsMatch(t, []ulid.ULID{id1, id2}, result.GetULIDs())
 
-	result = listBlocksOutsideRetentionPeriod(idx, time.Unix(9, 0))
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(9, 0))
 	assert.ElementsMatch(t, []ulid.ULID{id1, id2, id3}, result.GetULIDs())
 
 	// Avoiding redundant marking - blocks already marked for deletion.
@@ -494,22 +497,32 @@ func TestBlocksCleaner_ListBlocksOutsideRetentionPeriod(t *testing.T) {
 
 	idx.BlockDeletionMarks = bucketindex.BlockDeletionMarks{mark1}
 
-	result = listBlocksOutsideRetentionPeriod(idx, time.Unix(7, 0))
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(7, 0))
 	assert.ElementsMatch(t, []ulid.ULID{}, result.GetULIDs())
 
-	result = listBlocksOutsideRetentionPeriod(idx, time.Unix(8, 0))
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(8, 0))
 	assert.ElementsMatch(t, []ulid.ULID{id2}, result.GetULIDs())
 
 	idx.BlockDeletionMarks = bucketindex.BlockDeletionMarks{mark1, mark2}
 
-	result = listBlocksOutsideRetentionPeriod(idx, time.Unix(7, 0))
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(7, 0))
 	assert.ElementsMatch(t, []ulid.ULID{}, result.GetULIDs())
 
-	result = listBlocksOutsideRetentionPeriod(idx, time.Unix(8, 0))
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(8, 0))
 	assert.ElementsMatch(t, []ulid.ULID{}, result.GetULIDs())
 
-	result = listBlocksOutsideRetentionPeriod(idx, time.Unix(9, 0))
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(9, 0))
 	assert.ElementsMatch(t, []ulid.ULID{id3}, result.GetULIDs())
+
+	// Blocks of other resolutions are not subject to the retention period.
+	id4 := ulid.MustNew(4, nil)
+	idx.Blocks = append(idx.Blocks, &bucketindex.Block{ID: id4, MinTime: 5000, MaxTime: 6000, Resolution: downsample.ResLevel1, Aggregate: downsample.AggrAvg})
+
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel0, time.Unix(9, 0))
+	assert.ElementsMatch(t, []ulid.ULID{id3}, result.GetULIDs())
+
+	result = listBlocksOutsideRetentionPeriod(idx, downsample.ResLevel1, time.Unix(9, 0))
+	assert.ElementsMatch(t, []ulid.ULID{id4}, result.GetULIDs())
 }
 
 func TestBlocksCleaner_ShouldRemoveBlocksOutsideRetentionPeriod(t *testing.T) {
@@ -537,7 +550,7 @@ func TestBlocksCleaner_ShouldRemoveBlocksOutsideRetentionPeriod(t *testing.T) {
 	reg := prometheus.NewPedanticRegistry()
 	cfgProvider := newMockConfigProvider()
 
-	cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, cfgProvider, logger, reg)
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, reg)
 
 	assertBlockExists := func(user string, blockID ulid.ULID, expectExists bool) {
 		exists, err := bucketClient.Exists(ctx, path.Join(user, blockID.String(), block.MetaFilename))
@@ -569,6 +582,9 @@ func TestBlocksCleaner_ShouldRemoveBlocksOutsideRetentionPeriod(t *testing.T) {
 			# TYPE cortex_compactor_blocks_marked_for_deletion_total counter
 			cortex_compactor_blocks_marked_for_deletion_total{reason="partial"} 0
 			cortex_compactor_blocks_marked_for_deletion_total{reason="retention"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="retention-rules"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-deletion"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-rewrite"} 0
 			`),
 			"cortex_bucket_blocks_count",
 			"cortex_bucket_blocks_marked_for_deletion_count",
@@ -611,6 +627,9 @@ func TestBlocksCleaner_ShouldRemoveBlocksOutsideRetentionPeriod(t *testing.T) {
 			# TYPE cortex_compactor_blocks_marked_for_deletion_total counter
 			cortex_compactor_blocks_marked_for_deletion_total{reason="partial"} 0
 			cortex_compactor_blocks_marked_for_deletion_total{reason="retention"} 1
+			cortex_compactor_blocks_marked_for_deletion_total{reason="retention-rules"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-deletion"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-rewrite"} 0
 			`),
 			"cortex_bucket_blocks_count",
 			"cortex_bucket_blocks_marked_for_deletion_count",
@@ -650,6 +669,9 @@ func TestBlocksCleaner_ShouldRemoveBlocksOutsideRetentionPeriod(t *testing.T) {
 			# TYPE cortex_compactor_blocks_marked_for_deletion_total counter
 			cortex_compactor_blocks_marked_for_deletion_total{reason="partial"} 0
 			cortex_compactor_blocks_marked_for_deletion_total{reason="retention"} 1
+			cortex_compactor_blocks_marked_for_deletion_total{reason="retention-rules"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-deletion"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-rewrite"} 0
 			`),
 			"cortex_bucket_blocks_count",
 			"cortex_bucket_blocks_marked_for_deletion_count",
@@ -680,6 +702,9 @@ func TestBlocksCleaner_ShouldRemoveBlocksOutsideRetentionPeriod(t *testing.T) {
 			# TYPE cortex_compactor_blocks_marked_for_deletion_total counter
 			cortex_compactor_blocks_marked_for_deletion_total{reason="partial"} 0
 			cortex_compactor_blocks_marked_for_deletion_total{reason="retention"} 3
+			cortex_compactor_blocks_marked_for_deletion_total{reason="retention-rules"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-deletion"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-rewrite"} 0
 			`),
 			"cortex_bucket_blocks_count",
 			"cortex_bucket_blocks_marked_for_deletion_count",
@@ -688,6 +713,126 @@ func TestBlocksCleaner_ShouldRemoveBlocksOutsideRetentionPeriod(t *testing.T) {
 	}
 }
 
+func TestBlocksCleaner_ShouldMoveBlocksToColdStorage(t *testing.T) {
+	const userID = "user-1"
+
+	bucketClient, _ := mimir_testutil.PrepareFilesystemBucket(t)
+	bucketClient = block.BucketWithGlobalMarkers(bucketClient)
+	coldBucketClient, _ := mimir_testutil.PrepareFilesystemBucket(t)
+
+	ts := func(hours int) int64 {
+		return time.Now().Add(time.Duration(hours)*time.Hour).Unix() * 1000
+	}
+
+	block1 := createTSDBBlock(t, bucketClient, userID, ts(-10), ts(-8), 2, nil)
+	block2 := createTSDBBlock(t, bucketClient, userID, ts(-4), ts(-2), 2, nil)
+
+	cfg := BlocksCleanerConfig{
+		DeletionDelay:           0,
+		CleanupInterval:         time.Minute,
+		CleanupConcurrency:      1,
+		DeleteBlocksConcurrency: 1,
+	}
+
+	ctx := context.Background()
+	logger := test.NewTestingLogger(t)
+	reg := prometheus.NewPedanticRegistry()
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.coldStoragePeriods[userID] = 6 * time.Hour
+
+	cleaner := NewBlocksCleaner(cfg, bucketClient, coldBucketClient, tsdb.AllUsers, cfgProvider, logger, reg)
+
+	assertBlockExists := func(bkt objstore.Bucket, blockID ulid.ULID, expectExists bool) {
+		exists, err := bkt.Exists(ctx, path.Join(userID, blockID.String(), block.MetaFilename))
+		require.NoError(t, err)
+		assert.Equal(t, expectExists, exists)
+	}
+	assertBlockStorageTiers := func(expected map[ulid.ULID]block.StorageTier) {
+		idx, err := bucketindex.ReadIndex(ctx, bucketClient, userID, nil, logger)
+		require.NoError(t, err)
+		require.Len(t, idx.Blocks, len(expected))
+		for _, b := range idx.Blocks {
+			assert.Equal(t, expected[b.ID], b.StorageTier, b.ID.String())
+		}
+	}
+
+	// The old block is copied to the cold storage, and the copy in the blocks storage bucket is kept for now.
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+	assertBlockExists(bucketClient, block1, true)
+	assertBlockExists(coldBucketClient, block1, true)
+	assertBlockExists(coldBucketClient, block2, false)
+	assertBlockStorageTiers(map[ulid.ULID]block.StorageTier{block1: block.ColdStorageTier, block2: block.HotStorageTier})
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_compactor_blocks_moved_to_cold_storage_total Total number of blocks moved to the cold storage.
+		# TYPE cortex_compactor_blocks_moved_to_cold_storage_total counter
+		cortex_compactor_blocks_moved_to_cold_storage_total 1
+		# HELP cortex_compactor_blocks_moved_to_cold_storage_failures_total Total number of blocks failed to be moved to the cold storage.
+		# TYPE cortex_compactor_blocks_moved_to_cold_storage_failures_total counter
+		cortex_compactor_blocks_moved_to_cold_storage_failures_total 0
+		`),
+		"cortex_compactor_blocks_moved_to_cold_storage_total",
+		"cortex_compactor_blocks_moved_to_cold_storage_failures_total",
+	))
+
+	// The copy in the blocks storage bucket is deleted once the deletion delay has elapsed.
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+	assertBlockExists(bucketClient, block1, false)
+	assertBlockExists(coldBucketClient, block1, true)
+	assertBlockStorageTiers(map[ulid.ULID]block.StorageTier{block1: block.ColdStorageTier, block2: block.HotStorageTier})
+
+	// The blocks in the cold storage are deleted by the retention too.
+	cfgProvider.userRetentionPeriods[userID] = 7 * time.Hour
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+	assertBlockExists(coldBucketClient, block1, false)
+	assertBlockExists(bucketClient, block2, true)
+	assertBlockStorageTiers(map[ulid.ULID]block.StorageTier{block2: block.HotStorageTier})
+	checkBlock(t, userID, bucketClient, block1, false, false)
+}
+
+func TestBlocksCleaner_ShouldCompactMetricMetadata(t *testing.T) {
+	const userID = "user-1"
+
+	bucketClient, _ := mimir_testutil.PrepareFilesystemBucket(t)
+	bucketClient = block.BucketWithGlobalMarkers(bucketClient)
+	createTSDBBlock(t, bucketClient, userID, 10, 20, 2, nil)
+
+	cfg := BlocksCleanerConfig{
+		DeletionDelay:           time.Hour,
+		CleanupInterval:         time.Minute,
+		CleanupConcurrency:      1,
+		DeleteBlocksConcurrency: 1,
+		MetricMetadataEnabled:   true,
+	}
+
+	ctx := context.Background()
+	logger := test.NewTestingLogger(t)
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.userRetentionPeriods[userID] = 24 * time.Hour
+
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, nil)
+
+	now := time.Now()
+	recent := metricmetadata.Entry{Metric: "recent", Type: "counter", LastSeen: now.Add(-time.Hour).Unix()}
+	old := metricmetadata.Entry{Metric: "old", Type: "counter", LastSeen: now.Add(-48 * time.Hour).Unix()}
+	require.NoError(t, metricmetadata.WriteSegment(ctx, bucketClient, userID, nil, "ingester-1", []metricmetadata.Entry{recent, old}, now))
+
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	// The segment has been compacted, and the metadata not received within the retention period has been removed.
+	var segments []string
+	require.NoError(t, bucketClient.Iter(ctx, path.Join(userID, metricmetadata.MetadataPrefix, metricmetadata.SegmentsPrefix)+"/", func(name string) error {
+		segments = append(segments, name)
+		return nil
+	}))
+	assert.Empty(t, segments)
+
+	actual, err := metricmetadata.Read(ctx, bucketClient, userID, nil, logger)
+	require.NoError(t, err)
+	assert.Equal(t, []metricmetadata.Entry{recent}, actual)
+}
+
 func checkBlock(t *testing.T, user string, bucketClient objstore.Bucket, blockID ulid.ULID, metaJSONExists bool, markedForDeletion bool) {
 	exists, err := bucketClient.Exists(context.Background(), path.Join(user, blockID.String(), block.MetaFilename))
 	require.NoError(t, err)
@@ -741,7 +886,7 @@ func TestBlocksCleaner_ShouldCleanUpFilesWhenNoMoreBlocksRemain(t *testing.T) {
 	reg := prometheus.NewPedanticRegistry()
 	cfgProvider := newMockConfigProvider()
 
-	cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, cfgProvider, logger, reg)
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, reg)
 	require.NoError(t, cleaner.runCleanupWithErr(ctx))
 
 	// Check bucket index, markers and debug files have been deleted.
@@ -780,7 +925,7 @@ func TestBlocksCleaner_ShouldRemovePartialBlocksOutsideDelayPeriod(t *testing.T)
 	reg := prometheus.NewPedanticRegistry()
 	cfgProvider := newMockConfigProvider()
 
-	cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, cfgProvider, logger, reg)
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, reg)
 
 	makeBlockPartial := func(user string, blockID ulid.ULID) {
 		err := bucketClient.Delete(ctx, path.Join(user, blockID.String(), block.MetaFilename))
@@ -820,6 +965,9 @@ func TestBlocksCleaner_ShouldRemovePartialBlocksOutsideDelayPeriod(t *testing.T)
 			# TYPE cortex_compactor_blocks_marked_for_deletion_total counter
 			cortex_compactor_blocks_marked_for_deletion_total{reason="partial"} 1
 			cortex_compactor_blocks_marked_for_deletion_total{reason="retention"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="retention-rules"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-deletion"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-rewrite"} 0
 			`),
 		"cortex_bucket_blocks_count",
 		"cortex_bucket_blocks_marked_for_deletion_count",
@@ -850,7 +998,7 @@ func TestBlocksCleaner_ShouldNotRemovePartialBlocksInsideDelayPeriod(t *testing.
 	reg := prometheus.NewPedanticRegistry()
 	cfgProvider := newMockConfigProvider()
 
-	cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, cfgProvider, logger, reg)
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, reg)
 
 	makeBlockPartial := func(user string, blockID ulid.ULID) {
 		err := bucketClient.Delete(ctx, path.Join(user, blockID.String(), block.MetaFilename))
@@ -901,6 +1049,9 @@ func TestBlocksCleaner_ShouldNotRemovePartialBlocksInsideDelayPeriod(t *testing.
 			# TYPE cortex_compactor_blocks_marked_for_deletion_total counter
 			cortex_compactor_blocks_marked_for_deletion_total{reason="partial"} 0
 			cortex_compactor_blocks_marked_for_deletion_total{reason="retention"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="retention-rules"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-deletion"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-rewrite"} 0
 			`),
 		"cortex_bucket_blocks_count",
 		"cortex_bucket_blocks_marked_for_deletion_count",
@@ -942,7 +1093,7 @@ func TestBlocksCleaner_ShouldNotRemovePartialBlocksIfConfiguredDelayIsInvalid(t
 	checkBlock(t, "user-1", bucketClient, block1, false, false)
 
 	// Run the cleanup.
-	cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, cfgProvider, logger, reg)
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, reg)
 	require.NoError(t, cleaner.cleanUser(ctx, "user-1", logger))
 
 	// Ensure the block has NOT been marked for deletion.
@@ -960,6 +1111,9 @@ func TestBlocksCleaner_ShouldNotRemovePartialBlocksIfConfiguredDelayIsInvalid(t
 			# TYPE cortex_compactor_blocks_marked_for_deletion_total counter
 			cortex_compactor_blocks_marked_for_deletion_total{reason="partial"} 0
 			cortex_compactor_blocks_marked_for_deletion_total{reason="retention"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="retention-rules"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-deletion"} 0
+			cortex_compactor_blocks_marked_for_deletion_total{reason="series-rewrite"} 0
 			`),
 		"cortex_bucket_blocks_count",
 		"cortex_bucket_blocks_marked_for_deletion_count",
@@ -1026,6 +1180,7 @@ func (m *mockBucketFailure) Delete(ctx context.Context, name string) error {
 
 type mockConfigProvider struct {
 	userRetentionPeriods         map[string]time.Duration
+	userRetentionRules           map[string]validation.RetentionRules
 	splitAndMergeShards          map[string]int
 	instancesShardSize           map[string]int
 	splitGroups                  map[string]int
@@ -1035,11 +1190,21 @@ type mockConfigProvider struct {
 	userPartialBlockDelay        map[string]time.Duration
 	userPartialBlockDelayInvalid map[string]bool
 	verifyChunks                 map[string]bool
+	downsampling5mDelay          map[string]time.Duration
+	downsampling1hDelay          map[string]time.Duration
+	userRetentionPeriods5m       map[string]time.Duration
+	userRetentionPeriods1h       map[string]time.Duration
+	tenantPriority               map[string]int
+	bloomFilterLabelNames        map[string][]string
+	coldStoragePeriods           map[string]time.Duration
+	queryIngestersWithin         map[string]time.Duration
+	outOfOrderTimeWindow         map[string]time.Duration
 }
 
 func newMockConfigProvider() *mockConfigProvider {
 	return &mockConfigProvider{
 		userRetentionPeriods:         make(map[string]time.Duration),
+		userRetentionRules:           make(map[string]validation.RetentionRules),
 		splitAndMergeShards:          make(map[string]int),
 		splitGroups:                  make(map[string]int),
 		blockUploadEnabled:           make(map[string]bool),
@@ -1048,6 +1213,15 @@ func newMockConfigProvider() *mockConfigProvider {
 		userPartialBlockDelay:        make(map[string]time.Duration),
 		userPartialBlockDelayInvalid: make(map[string]bool),
 		verifyChunks:                 make(map[string]bool),
+		downsampling5mDelay:          make(map[string]time.Duration),
+		downsampling1hDelay:          make(map[string]time.Duration),
+		userRetentionPeriods5m:       make(map[string]time.Duration),
+		userRetentionPeriods1h:       make(map[string]time.Duration),
+		tenantPriority:               make(map[string]int),
+		bloomFilterLabelNames:        make(map[string][]string),
+		coldStoragePeriods:           make(map[string]time.Duration),
+		queryIngestersWithin:         make(map[string]time.Duration),
+		outOfOrderTimeWindow:         make(map[string]time.Duration),
 	}
 }
 
@@ -1058,6 +1232,18 @@ func (m *mockConfigProvider) CompactorBlocksRetentionPeriod(user string) time.Du
 	return 0
 }
 
+func (m *mockConfigProvider) CompactorBlocksRetentionRules(user string) validation.RetentionRules {
+	return m.userRetentionRules[user]
+}
+
+func (m *mockConfigProvider) QueryIngestersWithin(user string) time.Duration {
+	return m.queryIngestersWithin[user]
+}
+
+func (m *mockConfigProvider) OutOfOrderTimeWindow(user string) time.Duration {
+	return m.outOfOrderTimeWindow[user]
+}
+
 func (m *mockConfigProvider) CompactorSplitAndMergeShards(user string) int {
 	if result, ok := m.splitAndMergeShards[user]; ok {
 		return result
@@ -1099,6 +1285,40 @@ func (m *mockConfigProvider) CompactorBlockUploadMaxBlockSizeBytes(user string)
 	return m.blockUploadMaxBlockSizeBytes[user]
 }
 
+func (m *mockConfigProvider) CompactorTenantPriority(user string) int {
+	return m.tenantPriority[user]
+}
+
+func (m *mockConfigProvider) CompactorBlocksColdStoragePeriod(user string) time.Duration {
+	return m.coldStoragePeriods[user]
+}
+
+func (m *mockConfigProvider) BlockBloomFilterLabelNames(user string) []string {
+	return m.bloomFilterLabelNames[user]
+}
+
+func (m *mockConfigProvider) CompactorDownsampling5mDelay(user string) time.Duration {
+	return m.downsampling5mDelay[user]
+}
+
+func (m *mockConfigProvider) CompactorDownsampling1hDelay(user string) time.Duration {
+	return m.downsampling1hDelay[user]
+}
+
+func (m *mockConfigProvider) CompactorBlocksRetentionPeriod5m(user string) time.Duration {
+	if result, ok := m.userRetentionPeriods5m[user]; ok {
+		return result
+	}
+	return m.CompactorBlocksRetentionPeriod(user)
+}
+
+func (m *mockConfigProvider) CompactorBlocksRetentionPeriod1h(user string) time.Duration {
+	if result, ok := m.userRetentionPeriods1h[user]; ok {
+		return result
+	}
+	return m.CompactorBlocksRetentionPeriod(user)
+}
+
 func (m *mockConfigProvider) S3SSEType(string) string {
 	return ""
 }
@@ -1117,5 +1337,7 @@ func (c *BlocksCleaner) runCleanupWithErr(ctx context.Context) error {
 		return err
 	}
 
-	return c.cleanUsers(ctx, allUsers, isDeleted, log.NewNopLogger())
+	err = c.cleanUsers(ctx, allUsers, isDeleted, log.NewNopLogger())
+	c.seriesDeletionJobs.wait()
+	return err
 }
@@ -401,6 +401,14 @@ func (c *BucketCompactor) runCompactionJob(ctx context.Context, job *Job) (shoul
 			return errors.Wrapf(err, "invalid result block %s", bdir)
 		}
 
+		if err := block.WriteBloomFilters(bdir, c.bloomFilterLabelNames); err != nil {
+			return errors.Wrapf(err, "failed to write bloom filters of the block %s", bdir)
+		}
+
+		if err := block.WriteExemplarsFromSources(bdir, blocksToCompactDirs); err != nil {
+			return errors.Wrapf(err, "failed to write exemplars of the block %s", bdir)
+		}
+
 		begin := time.Now()
 		if err := block.Upload(ctx, jobLogger, c.bkt, bdir, nil); err != nil {
 			return errors.Wrapf(err, "upload of %s failed", blockToUpload.ulid)
@@ -685,6 +693,7 @@ type BucketCompactor struct {
 	sortJobs                       JobsOrderFunc
 	waitPeriod                     time.Duration
 	blockSyncConcurrency           int
+	bloomFilterLabelNames          []string
 	metrics                        *BucketCompactorMetrics
 }
 
@@ -703,6 +712,7 @@ func NewBucketCompactor(
 	sortJobs JobsOrderFunc,
 	waitPeriod time.Duration,
 	blockSyncConcurrency int,
+	bloomFilterLabelNames []string,
 	metrics *BucketCompactorMetrics,
 ) (*BucketCompactor, error) {
 	if concurrency <= 0 {
@@ -722,6 +732,7 @@ func NewBucketCompactor(
 		sortJobs:                       sortJobs,
 		waitPeriod:                     waitPeriod,
 		blockSyncConcurrency:           blockSyncConcurrency,
+		bloomFilterLabelNames:          bloomFilterLabelNames,
 		metrics:                        metrics,
 	}, nil
 }
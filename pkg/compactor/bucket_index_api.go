@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+// BucketIndexRepairResponse is the response of the bucket index repair endpoint.
+type BucketIndexRepairResponse struct {
+	Report  *bucketindex.CheckReport   `json:"report"`
+	Actions []bucketindex.RepairAction `json:"actions"`
+}
+
+// VerifyBucketIndex checks the tenant's bucket index against the content of the bucket, and returns
+// the inconsistencies found.
+func (c *MultitenantCompactor) VerifyBucketIndex(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	report, err := c.bucketIndexChecker(userID).Check(ctx)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to check bucket index", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	util.WriteJSONResponse(w, report)
+}
+
+// RepairBucketIndex repairs the inconsistencies between the tenant's bucket index and the content of the bucket,
+// and returns the repair actions. If the dry_run parameter is true, the repair actions are returned without being run.
+func (c *MultitenantCompactor) RepairBucketIndex(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dryRun := false
+	if v := r.Form.Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "invalid dry_run parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	checker := c.bucketIndexChecker(userID)
+	report, err := checker.Check(ctx)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to check bucket index", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Stale partial blocks are marked for deletion like the compactor does, so they're not
+	// marked if the partial blocks deletion is disabled for the tenant.
+	delay, _ := c.cfgProvider.CompactorPartialBlockDeletionDelay(userID)
+
+	actions, err := checker.Repair(ctx, report, bucketindex.RepairOptions{DryRun: dryRun, PartialBlockDeletionDelay: delay})
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to repair bucket index", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	level.Info(c.logger).Log("msg", "bucket index repaired", "user", userID, "dry_run", dryRun, "actions", len(actions))
+
+	util.WriteJSONResponse(w, BucketIndexRepairResponse{Report: report, Actions: actions})
+}
+
+func (c *MultitenantCompactor) bucketIndexChecker(userID string) *bucketindex.Checker {
+	return bucketindex.NewChecker(c.bucketClient, c.coldBucketClient, userID, c.cfgProvider, log.With(c.logger, "user", userID))
+}
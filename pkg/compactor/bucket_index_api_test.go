@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/user"
+	"github.com/oklog/ulid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+func TestBucketIndexAPI(t *testing.T) {
+	const userID = "user-1"
+
+	bkt := objstore.NewInMemBucket()
+	block.MockStorageBlockWithExtLabels(t, bkt, userID, 10, 20, nil)
+
+	// Upload a global marker whose block doesn't exist.
+	orphanedMark := block.DeletionMarkFilepath(ulid.MustNew(100, rand.Reader))
+	require.NoError(t, bkt.Upload(context.Background(), userID+"/"+orphanedMark, strings.NewReader("{}")))
+
+	c, _, _, _, _ := prepare(t, prepareConfig(t), bkt)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	t.Cleanup(stopServiceFn(t, c))
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+
+	verify := func() *bucketindex.CheckReport {
+		resp := httptest.NewRecorder()
+		c.VerifyBucketIndex(resp, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		report := &bucketindex.CheckReport{}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), report))
+		return report
+	}
+
+	repair := func(target string) (*httptest.ResponseRecorder, *BucketIndexRepairResponse) {
+		resp := httptest.NewRecorder()
+		c.RepairBucketIndex(resp, httptest.NewRequest(http.MethodPost, target, nil).WithContext(ctx))
+		if resp.Code != http.StatusOK {
+			return resp, nil
+		}
+
+		res := &BucketIndexRepairResponse{}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), res))
+		return resp, res
+	}
+
+	t.Run("should fail without tenant ID", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		c.VerifyBucketIndex(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+		resp = httptest.NewRecorder()
+		c.RepairBucketIndex(resp, httptest.NewRequest(http.MethodPost, "/", nil))
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	})
+
+	t.Run("should fail on invalid dry_run parameter", func(t *testing.T) {
+		resp, _ := repair("/?dry_run=invalid")
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("should verify and repair the bucket index", func(t *testing.T) {
+		assert.Equal(t, []string{orphanedMark}, verify().OrphanedMarks)
+
+		resp, res := repair("/?dry_run=true")
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, []string{orphanedMark}, res.Report.OrphanedMarks)
+		assert.Contains(t, res.Actions, bucketindex.RepairAction{Action: bucketindex.RepairDeleteOrphanedMark, Path: orphanedMark})
+
+		// The dry-run mode should not change the bucket.
+		assert.Equal(t, []string{orphanedMark}, verify().OrphanedMarks)
+
+		resp, res = repair("/")
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, res.Actions, bucketindex.RepairAction{Action: bucketindex.RepairDeleteOrphanedMark, Path: orphanedMark})
+
+		report := verify()
+		assert.Empty(t, report.OrphanedMarks)
+		assert.Empty(t, report.BlocksMissingFromIndex)
+		assert.False(t, report.IndexNotFound)
+	})
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/runutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+// coldUserBucket returns the client of the tenant's cold storage bucket. The cold storage must be enabled.
+func (c *BlocksCleaner) coldUserBucket(userID string) objstore.InstrumentedBucket {
+	return bucket.NewUserBucketClient(userID, c.coldBucketClient, c.cfgProvider)
+}
+
+// blockBucket returns the client of the bucket the block is stored in.
+func (c *BlocksCleaner) blockBucket(userID string, userBucket objstore.Bucket, b *bucketindex.Block) objstore.Bucket {
+	if b.StorageTier == block.ColdStorageTier && c.coldBucketClient != nil {
+		return c.coldUserBucket(userID)
+	}
+	return userBucket
+}
+
+// deleteBlock deletes the block from both the blocks storage bucket and the cold storage, if enabled.
+func (c *BlocksCleaner) deleteBlock(ctx context.Context, userID string, userBucket objstore.Bucket, id ulid.ULID, userLogger log.Logger) error {
+	// The block is deleted from the cold storage first, because its deletion mark is
+	// stored in the blocks storage bucket, and it's deleted last.
+	if c.coldBucketClient != nil {
+		if err := block.Delete(ctx, userLogger, c.coldUserBucket(userID), id); err != nil {
+			return errors.Wrap(err, "delete block from the cold storage")
+		}
+	}
+	return block.Delete(ctx, userLogger, userBucket, id)
+}
+
+// moveBlocksToColdStorage copies the blocks containing only samples older than the tenant's cold storage period
+// to the cold storage, and updates the input bucket index accordingly. The copies left in the blocks storage bucket
+// are deleted by deleteHotCopies once the deletion delay has elapsed, so that the store-gateways have the time to
+// load the blocks from the cold storage.
+func (c *BlocksCleaner) moveBlocksToColdStorage(ctx context.Context, idx *bucketindex.Index, userID string, userBucket objstore.Bucket, userLogger log.Logger) {
+	period := c.cfgProvider.CompactorBlocksColdStoragePeriod(userID)
+	if c.coldBucketClient == nil || period <= 0 {
+		return
+	}
+
+	marked := make(map[ulid.ULID]struct{}, len(idx.BlockDeletionMarks))
+	for _, d := range idx.BlockDeletionMarks {
+		marked[d.ID] = struct{}{}
+	}
+
+	threshold := time.Now().Add(-period)
+	coldBucket := c.coldUserBucket(userID)
+	moved := 0
+
+	for _, b := range idx.Blocks {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if b.StorageTier == block.ColdStorageTier || !time.UnixMilli(b.MaxTime).Before(threshold) {
+			continue
+		}
+		if _, isMarked := marked[b.ID]; isMarked {
+			continue
+		}
+
+		if err := copyBlock(ctx, userBucket, coldBucket, b.ID, userLogger); err != nil {
+			c.blocksMovedToColdStorageFailed.Inc()
+			level.Warn(userLogger).Log("msg", "failed to move block to the cold storage", "block", b.ID, "err", err)
+			continue
+		}
+
+		// The meta.json uploaded last to the cold storage marks the time when the block has been moved.
+		b.StorageTier = block.ColdStorageTier
+		b.UploadedAt = time.Now().Unix()
+
+		moved++
+		c.blocksMovedToColdStorage.Inc()
+		level.Info(userLogger).Log("msg", "moved block to the cold storage", "block", b.ID, "maxTime", b.MaxTime)
+	}
+
+	if moved > 0 {
+		level.Info(userLogger).Log("msg", "moved blocks to the cold storage", "num_blocks", moved, "period", period.String())
+	}
+}
+
+// deleteHotCopies deletes the copies left in the blocks storage bucket of the blocks moved to the cold storage
+// since longer than the deletion delay. The copies of the blocks marked for deletion are deleted together with
+// the blocks.
+func (c *BlocksCleaner) deleteHotCopies(ctx context.Context, idx *bucketindex.Index, hotCopies []ulid.ULID, userBucket objstore.Bucket, userLogger log.Logger) {
+	if len(hotCopies) == 0 {
+		return
+	}
+
+	marked := make(map[ulid.ULID]struct{}, len(idx.BlockDeletionMarks))
+	for _, d := range idx.BlockDeletionMarks {
+		marked[d.ID] = struct{}{}
+	}
+
+	blocks := make(map[ulid.ULID]*bucketindex.Block, len(idx.Blocks))
+	for _, b := range idx.Blocks {
+		blocks[b.ID] = b
+	}
+
+	for _, id := range hotCopies {
+		if ctx.Err() != nil {
+			return
+		}
+
+		b, ok := blocks[id]
+		if !ok || b.StorageTier != block.ColdStorageTier {
+			continue
+		}
+		if _, isMarked := marked[id]; isMarked {
+			continue
+		}
+		if time.Since(b.GetUploadedAt()) <= c.cfg.DeletionDelay {
+			continue
+		}
+
+		if err := block.Delete(ctx, userLogger, userBucket, id); err != nil {
+			level.Warn(userLogger).Log("msg", "failed to delete copy of block moved to the cold storage", "block", id, "err", err)
+			continue
+		}
+		level.Info(userLogger).Log("msg", "deleted copy of block moved to the cold storage", "block", id)
+	}
+}
+
+// copyBlock copies the files of the block from the src to the dst bucket. The meta.json is copied last,
+// so that an interrupted copy is a partial block in the dst bucket. The block markers are not copied.
+func copyBlock(ctx context.Context, src, dst objstore.Bucket, id ulid.ULID, logger log.Logger) error {
+	metaFile := path.Join(id.String(), block.MetaFilename)
+
+	err := src.Iter(ctx, id.String(), func(name string) error {
+		switch path.Base(name) {
+		case block.MetaFilename, block.DeletionMarkFilename, block.NoCompactMarkFilename:
+			return nil
+		}
+		return copyObject(ctx, src, dst, name, logger)
+	}, objstore.WithRecursiveIter)
+	if err != nil {
+		return err
+	}
+
+	return copyObject(ctx, src, dst, metaFile, logger)
+}
+
+func copyObject(ctx context.Context, src, dst objstore.Bucket, name string, logger log.Logger) error {
+	r, err := src.Get(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "get %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(logger, r, "close %s", name)
+
+	return errors.Wrapf(dst.Upload(ctx, name, r), "upload %s", name)
+}
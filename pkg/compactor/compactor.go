@@ -15,6 +15,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
@@ -35,6 +36,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/util"
 	util_log "github.com/grafana/mimir/pkg/util/log"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 const (
@@ -95,6 +97,7 @@ type Config struct {
 	TenantCleanupDelay         time.Duration           `yaml:"tenant_cleanup_delay" category:"advanced"`
 	MaxCompactionTime          time.Duration           `yaml:"max_compaction_time" category:"advanced"`
 	NoBlocksFileCleanupEnabled bool                    `yaml:"no_blocks_file_cleanup_enabled" category:"experimental"`
+	SeriesDeletionDelay        time.Duration           `yaml:"series_deletion_delay" category:"experimental"`
 
 	// Compactor concurrency options
 	MaxOpeningBlocksConcurrency         int `yaml:"max_opening_blocks_concurrency" category:"advanced"`          // Number of goroutines opening blocks before compaction.
@@ -110,6 +113,8 @@ type Config struct {
 
 	CompactionJobsOrder string `yaml:"compaction_jobs_order" category:"advanced"`
 
+	BacklogAwareSchedulingEnabled bool `yaml:"backlog_aware_scheduling_enabled" category:"experimental"`
+
 	// No need to add options to customize the retry backoff,
 	// given the defaults should be fine, but allow to override
 	// it in tests.
@@ -141,11 +146,13 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	f.DurationVar(&cfg.CleanupInterval, "compactor.cleanup-interval", 15*time.Minute, "How frequently compactor should run blocks cleanup and maintenance, as well as update the bucket index.")
 	f.IntVar(&cfg.CleanupConcurrency, "compactor.cleanup-concurrency", 20, "Max number of tenants for which blocks cleanup and maintenance should run concurrently.")
 	f.StringVar(&cfg.CompactionJobsOrder, "compactor.compaction-jobs-order", CompactionOrderOldestFirst, fmt.Sprintf("The sorting to use when deciding which compaction jobs should run first for a given tenant. Supported values are: %s.", strings.Join(CompactionOrders, ", ")))
+	f.BoolVar(&cfg.BacklogAwareSchedulingEnabled, "compactor.backlog-aware-scheduling-enabled", false, "If enabled, the compactor estimates the compaction lag of each tenant from its bucket index, and compacts the tenants with the highest priority and the largest lag first, instead of in random order.")
 	f.DurationVar(&cfg.DeletionDelay, "compactor.deletion-delay", 12*time.Hour, "Time before a block marked for deletion is deleted from bucket. "+
 		"If not 0, blocks will be marked for deletion and compactor component will permanently delete blocks marked for deletion from the bucket. "+
 		"If 0, blocks will be deleted straight away. Note that deleting blocks immediately can cause query failures.")
 	f.DurationVar(&cfg.TenantCleanupDelay, "compactor.tenant-cleanup-delay", 6*time.Hour, "For tenants marked for deletion, this is time between deleting of last block, and doing final cleanup (marker files, debug files) of the tenant.")
 	f.BoolVar(&cfg.NoBlocksFileCleanupEnabled, "compactor.no-blocks-file-cleanup-enabled", false, "If enabled, will delete the bucket-index, markers and debug files in the tenant bucket when there are no blocks left in the index.")
+	f.DurationVar(&cfg.SeriesDeletionDelay, "compactor.series-deletion-delay", 24*time.Hour, "How long the compactor waits after a series deletion request has been created before purging the matching samples from the blocks. Series deletion requests can be cancelled within this period.")
 	// compactor concurrency options
 	f.IntVar(&cfg.MaxOpeningBlocksConcurrency, "compactor.max-opening-blocks-concurrency", 1, "Number of goroutines opening blocks before compaction.")
 	f.IntVar(&cfg.MaxClosingBlocksConcurrency, "compactor.max-closing-blocks-concurrency", 1, "Max number of blocks that can be closed concurrently during split compaction. Note that closing of newly compacted block uses a lot of memory for writing index.")
@@ -190,6 +197,16 @@ type ConfigProvider interface {
 	// CompactorBlocksRetentionPeriod returns the retention period for a given user.
 	CompactorBlocksRetentionPeriod(user string) time.Duration
 
+	// CompactorBlocksRetentionRules returns the per-selector retention rules for a given user.
+	CompactorBlocksRetentionRules(user string) validation.RetentionRules
+
+	// QueryIngestersWithin returns the period within which the ingesters are queried for a given user,
+	// which bounds how long the ingesters hold the samples before they're uploaded to the storage.
+	QueryIngestersWithin(user string) time.Duration
+
+	// OutOfOrderTimeWindow returns how old the out-of-order samples ingested for a given user can be.
+	OutOfOrderTimeWindow(user string) time.Duration
+
 	// CompactorSplitAndMergeShards returns the number of shards to use when splitting blocks.
 	CompactorSplitAndMergeShards(userID string) int
 
@@ -208,6 +225,32 @@ type ConfigProvider interface {
 	// CompactorBlockUploadEnabled returns whether block upload is enabled for a given tenant.
 	CompactorBlockUploadEnabled(tenantID string) bool
 
+	// CompactorTenantPriority returns the priority of the tenant when backlog-aware scheduling is enabled.
+	// Tenants with higher priority are compacted first.
+	CompactorTenantPriority(userID string) int
+
+	// CompactorBlocksColdStoragePeriod returns how old the samples of the blocks must be before they're moved
+	// to the cold storage for a given tenant. 0 disables moving the blocks to the cold storage.
+	CompactorBlocksColdStoragePeriod(userID string) time.Duration
+
+	// BlockBloomFilterLabelNames returns the label names for which a bloom filter of the label values
+	// is built for the compacted blocks of a given tenant.
+	BlockBloomFilterLabelNames(userID string) []string
+
+	// CompactorDownsampling5mDelay returns how old blocks must be before they're downsampled to 5m resolution
+	// for a given tenant. 0 disables the downsampling.
+	CompactorDownsampling5mDelay(userID string) time.Duration
+
+	// CompactorDownsampling1hDelay returns how old blocks must be before they're downsampled to 1h resolution
+	// for a given tenant. 0 disables the downsampling.
+	CompactorDownsampling1hDelay(userID string) time.Duration
+
+	// CompactorBlocksRetentionPeriod5m returns the retention period of the 5m resolution blocks for a given user.
+	CompactorBlocksRetentionPeriod5m(user string) time.Duration
+
+	// CompactorBlocksRetentionPeriod1h returns the retention period of the 1h resolution blocks for a given user.
+	CompactorBlocksRetentionPeriod1h(user string) time.Duration
+
 	// CompactorBlockUploadValidationEnabled returns whether block upload validation is enabled for a given tenant.
 	CompactorBlockUploadValidationEnabled(tenantID string) bool
 
@@ -245,6 +288,9 @@ type MultitenantCompactor struct {
 	// Client used to run operations on the bucket storing blocks.
 	bucketClient objstore.Bucket
 
+	// Client used to run operations on the cold storage bucket. It's nil if the cold storage is disabled.
+	coldBucketClient objstore.Bucket
+
 	// Ring used for sharding compactions.
 	ringLifecycler         *ring.BasicLifecycler
 	ring                   *ring.Ring
@@ -254,6 +300,12 @@ type MultitenantCompactor struct {
 	shardingStrategy shardingStrategy
 	jobsOrder        JobsOrderFunc
 
+	// Compaction backlog of the owned tenants, estimated at the beginning of the last compaction run
+	// when backlog-aware scheduling is enabled.
+	backlogMtx       sync.Mutex
+	backlog          []tenantBacklog
+	backlogUpdatedAt time.Time
+
 	// Metrics.
 	compactionRunsStarted          prometheus.Counter
 	compactionRunsCompleted        prometheus.Counter
@@ -266,6 +318,8 @@ type MultitenantCompactor struct {
 	compactionRunFailedTenants     prometheus.Gauge
 	compactionRunInterval          prometheus.Gauge
 	blocksMarkedForDeletion        prometheus.Counter
+	blocksDownsampled              *prometheus.CounterVec
+	tenantCompactionLag            *prometheus.GaugeVec
 
 	// Metrics shared across all BucketCompactor instances.
 	bucketCompactorMetrics *BucketCompactorMetrics
@@ -371,6 +425,14 @@ func newMultitenantCompactor(
 			Help:        blocksMarkedForDeletionHelp,
 			ConstLabels: prometheus.Labels{"reason": "compaction"},
 		}),
+		blocksDownsampled: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_compactor_blocks_downsampled_total",
+			Help: "Total number of raw blocks downsampled by the compactor.",
+		}, []string{"resolution"}),
+		tenantCompactionLag: promauto.With(registerer).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_compactor_tenant_compaction_lag_seconds",
+			Help: "Estimated compaction lag of the tenants owned by the compactor: the time since the oldest first-level block not compacted yet has been uploaded. Only tracked when backlog-aware scheduling is enabled.",
+		}, []string{"user"}),
 		blockUploadBlocks: promauto.With(registerer).NewGaugeVec(prometheus.GaugeOpts{
 			Name: "cortex_block_upload_api_blocks_total",
 			Help: "Total number of blocks successfully uploaded and validated using the block upload API.",
@@ -424,6 +486,13 @@ func (c *MultitenantCompactor) starting(ctx context.Context) error {
 		return errors.Wrap(err, "failed to create bucket client")
 	}
 
+	if c.storageCfg.ColdStorage.Enabled {
+		c.coldBucketClient, err = bucket.NewClient(ctx, c.storageCfg.ColdStorage.Bucket, "compactor-cold-storage", c.logger, c.registerer)
+		if err != nil {
+			return errors.Wrap(err, "failed to create cold storage bucket client")
+		}
+	}
+
 	// Create blocks compactor dependencies.
 	c.blocksCompactor, c.blocksPlanner, err = c.blocksCompactorFactory(ctx, c.compactorCfg, c.logger, c.registerer)
 	if err != nil {
@@ -493,7 +562,10 @@ func (c *MultitenantCompactor) starting(ctx context.Context) error {
 		TenantCleanupDelay:         c.compactorCfg.TenantCleanupDelay,
 		DeleteBlocksConcurrency:    defaultDeleteBlocksConcurrency,
 		NoBlocksFileCleanupEnabled: c.compactorCfg.NoBlocksFileCleanupEnabled,
-	}, c.bucketClient, c.shardingStrategy.blocksCleanerOwnUser, c.cfgProvider, c.parentLogger, c.registerer)
+		DataDir:                    c.compactorCfg.DataDir,
+		SeriesDeletionDelay:        c.compactorCfg.SeriesDeletionDelay,
+		MetricMetadataEnabled:      c.storageCfg.MetadataStore.Enabled,
+	}, c.bucketClient, c.coldBucketClient, c.shardingStrategy.blocksCleanerOwnUser, c.cfgProvider, c.parentLogger, c.registerer)
 
 	// Start blocks cleaner asynchronously, don't wait until initial cleanup is finished.
 	if err := c.blocksCleaner.StartAsync(ctx); err != nil {
@@ -606,6 +678,12 @@ func (c *MultitenantCompactor) compactUsers(ctx context.Context) {
 		users[i], users[j] = users[j], users[i]
 	})
 
+	if c.compactorCfg.BacklogAwareSchedulingEnabled {
+		// Compact the tenants with the highest priority and largest backlog first. The sorting is stable,
+		// so tenants with the same priority and lag are still compacted in random order.
+		users = c.sortUsersByBacklog(ctx, users)
+	}
+
 	// Keep track of users owned by this shard, so that we can delete the local files for all other users.
 	ownedUsers := map[string]struct{}{}
 	for _, userID := range users {
@@ -720,6 +798,9 @@ func (c *MultitenantCompactor) compactUser(ctx context.Context, userID string) e
 	// blocks that fully submatches the source blocks of the older blocks.
 	deduplicateBlocksFilter := NewShardAwareDeduplicateFilter()
 
+	// Keeps the downsampled blocks out of the compaction, and tracks them for the downsampling.
+	downsampledBlocksFilter := NewDownsampledBlocksFilter()
+
 	// List of filters to apply (order matters).
 	fetcherFilters := []block.MetadataFilter{
 		// Remove the ingester ID because we don't shard blocks anymore, while still
@@ -730,6 +811,7 @@ func (c *MultitenantCompactor) compactUser(ctx context.Context, userID string) e
 			mimir_tsdb.DeprecatedTenantIDExternalLabel,
 			mimir_tsdb.DeprecatedIngesterIDExternalLabel,
 		}),
+		downsampledBlocksFilter,
 		deduplicateBlocksFilter,
 		// removes blocks that should not be compacted due to being marked so.
 		NewNoCompactionMarkFilter(userBucket, true),
@@ -773,6 +855,7 @@ func (c *MultitenantCompactor) compactUser(ctx context.Context, userID string) e
 		c.jobsOrder,
 		c.compactorCfg.CompactionWaitPeriod,
 		c.compactorCfg.BlockSyncConcurrency,
+		c.cfgProvider.BlockBloomFilterLabelNames(userID),
 		c.bucketCompactorMetrics,
 	)
 	if err != nil {
@@ -783,6 +866,10 @@ func (c *MultitenantCompactor) compactUser(ctx context.Context, userID string) e
 		return errors.Wrap(err, "compaction")
 	}
 
+	if err := c.downsampleUser(ctx, userID, userBucket, fetcher, downsampledBlocksFilter, userLogger); err != nil {
+		return errors.Wrap(err, "downsampling")
+	}
+
 	return nil
 }
 
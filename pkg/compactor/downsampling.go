@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/downsample"
+)
+
+const downsamplingDirName = "downsample"
+
+// DownsampledBlocksFilter removes the downsampled blocks from the fetched metas, so that they're neither
+// compacted nor deduplicated (the blocks of the different aggregates of a raw block share the same sources),
+// and keeps track of them for the downsampling.
+type DownsampledBlocksFilter struct {
+	mtx         sync.Mutex
+	downsampled map[ulid.ULID]*block.Meta
+}
+
+// NewDownsampledBlocksFilter creates a DownsampledBlocksFilter.
+func NewDownsampledBlocksFilter() *DownsampledBlocksFilter {
+	return &DownsampledBlocksFilter{}
+}
+
+// Filter removes the downsampled blocks from metas.
+func (f *DownsampledBlocksFilter) Filter(_ context.Context, metas map[ulid.ULID]*block.Meta, _ block.GaugeVec) error {
+	downsampled := map[ulid.ULID]*block.Meta{}
+	for id, meta := range metas {
+		if meta.Thanos.Downsample.Resolution > downsample.ResLevel0 {
+			downsampled[id] = meta
+			delete(metas, id)
+		}
+	}
+
+	f.mtx.Lock()
+	f.downsampled = downsampled
+	f.mtx.Unlock()
+	return nil
+}
+
+// DownsampledBlocks returns the downsampled blocks removed by the last call to Filter.
+func (f *DownsampledBlocksFilter) DownsampledBlocks() map[ulid.ULID]*block.Meta {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.downsampled
+}
+
+// downsampleUser downsamples the fully compacted raw blocks of the user which are older than the
+// per-tenant downsampling delay of each resolution, and haven't been downsampled yet.
+func (c *MultitenantCompactor) downsampleUser(ctx context.Context, userID string, userBucket objstore.Bucket, fetcher *block.MetaFetcher, filter *DownsampledBlocksFilter, userLogger log.Logger) error {
+	delays := map[int64]time.Duration{
+		downsample.ResLevel1: c.cfgProvider.CompactorDownsampling5mDelay(userID),
+		downsample.ResLevel2: c.cfgProvider.CompactorDownsampling1hDelay(userID),
+	}
+	if delays[downsample.ResLevel1] <= 0 && delays[downsample.ResLevel2] <= 0 {
+		return nil
+	}
+
+	// Fetch the metas again, to downsample the blocks created by the compaction which has just run.
+	metas, _, err := fetcher.FetchWithoutMarkedForDeletion(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fetch metas")
+	}
+	downsampled := filter.DownsampledBlocks()
+
+	// Only the blocks which won't be compacted anymore are downsampled.
+	var minRange int64
+	if len(c.compactorCfg.BlockRanges) > 0 {
+		minRange = c.compactorCfg.BlockRanges[len(c.compactorCfg.BlockRanges)-1].Milliseconds()
+	}
+
+	raw := make([]*block.Meta, 0, len(metas))
+	for _, meta := range metas {
+		if meta.MaxTime-meta.MinTime >= minRange {
+			raw = append(raw, meta)
+		}
+	}
+	sort.Slice(raw, func(i, j int) bool {
+		return raw[i].MinTime < raw[j].MinTime
+	})
+
+	for _, resolution := range []int64{downsample.ResLevel1, downsample.ResLevel2} {
+		delay := delays[resolution]
+		if delay <= 0 {
+			continue
+		}
+
+		maxTime := time.Now().Add(-delay).UnixMilli()
+		for _, meta := range raw {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if meta.MaxTime > maxTime || isDownsampled(meta, resolution, downsampled) {
+				continue
+			}
+
+			// Multiple compactors can compact the same tenant, so each downsampling is a job owned by a single compactor.
+			key := fmt.Sprintf("downsample-%s-%s", meta.ULID, downsample.ResolutionString(resolution))
+			job := NewJob(userID, key, labels.FromMap(meta.Thanos.Labels), resolution, false, 0, userID+"-"+key)
+			if owned, err := c.shardingStrategy.ownJob(job); err != nil {
+				level.Warn(userLogger).Log("msg", "unable to check if downsampling job is owned by this compactor", "job", key, "err", err)
+				continue
+			} else if !owned {
+				continue
+			}
+
+			if err := c.downsampleBlock(ctx, userID, userBucket, meta, resolution, downsampled, userLogger); err != nil {
+				return errors.Wrapf(err, "downsample block %s to %s resolution", meta.ULID, downsample.ResolutionString(resolution))
+			}
+		}
+	}
+
+	return nil
+}
+
+// downsampleBlock downsamples the raw block to the resolution, uploads the downsampled blocks, and marks for deletion
+// the existing downsampled blocks which are superseded by the new ones.
+func (c *MultitenantCompactor) downsampleBlock(ctx context.Context, userID string, userBucket objstore.Bucket, meta *block.Meta, resolution int64, downsampled map[ulid.ULID]*block.Meta, userLogger log.Logger) error {
+	workDir := filepath.Join(c.compactorCfg.DataDir, downsamplingDirName, meta.ULID.String())
+	if err := os.RemoveAll(workDir); err != nil {
+		return errors.Wrap(err, "clean up working directory")
+	}
+	defer func() {
+		if err := os.RemoveAll(workDir); err != nil {
+			level.Warn(userLogger).Log("msg", "failed to remove downsampling working directory", "dir", workDir, "err", err)
+		}
+	}()
+
+	level.Info(userLogger).Log("msg", "downsampling block", "block", meta.ULID, "resolution", downsample.ResolutionString(resolution))
+	start := time.Now()
+
+	blockDir := filepath.Join(workDir, meta.ULID.String())
+	if err := block.Download(ctx, userLogger, userBucket, meta.ULID, blockDir); err != nil {
+		return errors.Wrap(err, "download block")
+	}
+
+	outDir := filepath.Join(workDir, "out")
+	ids, err := downsample.Downsample(ctx, userLogger, meta, blockDir, outDir, resolution)
+	if err != nil {
+		return err
+	}
+
+	// The blocks are uploaded in the order of downsample.Aggregates, so that the raw block
+	// is considered downsampled only once all the blocks have been uploaded.
+	for _, id := range ids {
+		if err := block.WriteBloomFilters(filepath.Join(outDir, id.String()), c.cfgProvider.BlockBloomFilterLabelNames(userID)); err != nil {
+			return errors.Wrapf(err, "write bloom filters of the downsampled block %s", id)
+		}
+		if err := block.Upload(ctx, userLogger, userBucket, filepath.Join(outDir, id.String()), nil); err != nil {
+			return errors.Wrapf(err, "upload downsampled block %s", id)
+		}
+	}
+	c.blocksDownsampled.WithLabelValues(downsample.ResolutionString(resolution)).Inc()
+
+	// The raw block may replace blocks which have already been downsampled, for example when it's the result
+	// of merging a block with out-of-order samples into an already downsampled one.
+	for _, d := range downsampled {
+		if d.Thanos.Downsample.Resolution != resolution || !sourcesIncludedIn(d.Compaction.Sources, meta.Compaction.Sources) {
+			continue
+		}
+		if err := block.MarkForDeletion(ctx, userLogger, userBucket, d.ULID, fmt.Sprintf("downsampled block superseded by the downsampling of block %s", meta.ULID), c.blocksMarkedForDeletion); err != nil {
+			return errors.Wrapf(err, "mark superseded downsampled block %s for deletion", d.ULID)
+		}
+	}
+
+	level.Info(userLogger).Log("msg", "downsampled block", "block", meta.ULID, "resolution", downsample.ResolutionString(resolution), "downsampled_blocks", len(ids), "duration", time.Since(start))
+	return nil
+}
+
+// isDownsampled returns whether the raw block has already been downsampled to the resolution.
+func isDownsampled(meta *block.Meta, resolution int64, downsampled map[ulid.ULID]*block.Meta) bool {
+	// The last aggregate's block is the last one uploaded.
+	last := downsample.Aggregates[len(downsample.Aggregates)-1]
+
+	for _, d := range downsampled {
+		if d.Thanos.Downsample.Resolution == resolution && d.Thanos.Downsample.Aggregate == last && equalSources(d.Compaction.Sources, meta.Compaction.Sources) {
+			return true
+		}
+	}
+	return false
+}
+
+func sourcesIncludedIn(sources, other []ulid.ULID) bool {
+	set := make(map[ulid.ULID]struct{}, len(other))
+	for _, id := range other {
+		set[id] = struct{}{}
+	}
+	for _, id := range sources {
+		if _, ok := set[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func equalSources(a, b []ulid.ULID) bool {
+	return len(a) == len(b) && sourcesIncludedIn(a, b)
+}
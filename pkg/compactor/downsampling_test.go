@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/downsample"
+)
+
+func TestMultitenantCompactor_ShouldDownsampleBlocks(t *testing.T) {
+	const (
+		userID     = "user-1"
+		blockRange = 2 * time.Hour
+	)
+
+	storageDir := t.TempDir()
+
+	storageCfg := mimir_tsdb.BlocksStorageConfig{}
+	flagext.DefaultValues(&storageCfg)
+	storageCfg.Bucket.Backend = bucket.Filesystem
+	storageCfg.Bucket.Filesystem.Directory = storageDir
+
+	compactorCfg := prepareConfig(t)
+	compactorCfg.DataDir = t.TempDir()
+	compactorCfg.BlockRanges = mimir_tsdb.DurationList{blockRange}
+
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.downsampling5mDelay[userID] = time.Hour
+	cfgProvider.downsampling1hDelay[userID] = time.Hour
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	reg := prometheus.NewPedanticRegistry()
+	ctx := context.Background()
+
+	bucketClient, err := bucket.NewClient(ctx, storageCfg.Bucket, "test", logger, nil)
+	require.NoError(t, err)
+
+	// Both blocks are older than the downsampling delay.
+	block1 := createTSDBBlock(t, bucketClient, userID, blockRange.Milliseconds(), 2*blockRange.Milliseconds(), 10, nil)
+	block2 := createTSDBBlock(t, bucketClient, userID, 2*blockRange.Milliseconds(), 3*blockRange.Milliseconds(), 10, nil)
+
+	c, err := NewMultitenantCompactor(compactorCfg, storageCfg, cfgProvider, logger, reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, c))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, c))
+	})
+
+	// Wait until the first compaction run completed.
+	test.Poll(t, 15*time.Second, nil, func() interface{} {
+		return testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_compactor_runs_completed_total Total number of compaction runs successfully completed.
+			# TYPE cortex_compactor_runs_completed_total counter
+			cortex_compactor_runs_completed_total 1
+		`), "cortex_compactor_runs_completed_total")
+	})
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_compactor_blocks_downsampled_total Total number of raw blocks downsampled by the compactor.
+		# TYPE cortex_compactor_blocks_downsampled_total counter
+		cortex_compactor_blocks_downsampled_total{resolution="5m"} 2
+		cortex_compactor_blocks_downsampled_total{resolution="1h"} 2
+	`), "cortex_compactor_blocks_downsampled_total"))
+
+	userBucket := bucket.NewUserBucketClient(userID, bucketClient, nil)
+	fetcher, err := block.NewMetaFetcher(logger, 1, userBucket, t.TempDir(), nil, nil)
+	require.NoError(t, err)
+	metas, partials, err := fetcher.FetchWithoutMarkedForDeletion(ctx)
+	require.NoError(t, err)
+	require.Empty(t, partials)
+
+	// Each raw block is downsampled to one block per aggregate and resolution.
+	actual := map[ulid.ULID]map[int64][]string{}
+	for _, meta := range metas {
+		if meta.Thanos.Downsample.Resolution == downsample.ResLevel0 {
+			continue
+		}
+
+		require.Len(t, meta.Compaction.Sources, 1)
+		source := meta.Compaction.Sources[0]
+		if actual[source] == nil {
+			actual[source] = map[int64][]string{}
+		}
+		actual[source][meta.Thanos.Downsample.Resolution] = append(actual[source][meta.Thanos.Downsample.Resolution], meta.Thanos.Downsample.Aggregate)
+	}
+
+	require.Len(t, actual, 2)
+	for _, id := range []ulid.ULID{block1, block2} {
+		for _, res := range []int64{downsample.ResLevel1, downsample.ResLevel2} {
+			assert.ElementsMatch(t, downsample.Aggregates, actual[id][res], "block: %s resolution: %s", id, downsample.ResolutionString(res))
+		}
+	}
+}
+
+func TestDownsampledBlocksFilter(t *testing.T) {
+	raw := &block.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil)}}
+	downsampled := &block.Meta{
+		BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(2, nil)},
+		Thanos:    block.ThanosMeta{Downsample: block.ThanosDownsample{Resolution: downsample.ResLevel1, Aggregate: downsample.AggrAvg}},
+	}
+
+	metas := map[ulid.ULID]*block.Meta{raw.ULID: raw, downsampled.ULID: downsampled}
+
+	f := NewDownsampledBlocksFilter()
+	require.NoError(t, f.Filter(context.Background(), metas, nil))
+	assert.Equal(t, map[ulid.ULID]*block.Meta{raw.ULID: raw}, metas)
+	assert.Equal(t, map[ulid.ULID]*block.Meta{downsampled.ULID: downsampled}, f.DownsampledBlocks())
+}
+
+func TestIsDownsampled(t *testing.T) {
+	source1 := ulid.MustNew(1, nil)
+	source2 := ulid.MustNew(2, nil)
+
+	raw := &block.Meta{BlockMeta: tsdb.BlockMeta{
+		ULID:       ulid.MustNew(3, nil),
+		Compaction: tsdb.BlockMetaCompaction{Sources: []ulid.ULID{source1, source2}},
+	}}
+
+	downsampledMeta := func(id uint64, resolution int64, aggregate string, sources ...ulid.ULID) *block.Meta {
+		return &block.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(id, nil), Compaction: tsdb.BlockMetaCompaction{Sources: sources}},
+			Thanos:    block.ThanosMeta{Downsample: block.ThanosDownsample{Resolution: resolution, Aggregate: aggregate}},
+		}
+	}
+
+	tests := map[string]struct {
+		downsampled []*block.Meta
+		expected    bool
+	}{
+		"no downsampled blocks": {
+			expected: false,
+		},
+		"all the aggregates have been uploaded": {
+			downsampled: []*block.Meta{
+				downsampledMeta(10, downsample.ResLevel1, downsample.AggrMin, source1, source2),
+				downsampledMeta(11, downsample.ResLevel1, downsample.AggrAvg, source2, source1),
+			},
+			expected: true,
+		},
+		"the last aggregate hasn't been uploaded yet": {
+			downsampled: []*block.Meta{
+				downsampledMeta(10, downsample.ResLevel1, downsample.AggrMin, source1, source2),
+			},
+			expected: false,
+		},
+		"downsampled to another resolution": {
+			downsampled: []*block.Meta{
+				downsampledMeta(10, downsample.ResLevel2, downsample.AggrAvg, source1, source2),
+			},
+			expected: false,
+		},
+		"downsampled from a block with a subset of the sources": {
+			downsampled: []*block.Meta{
+				downsampledMeta(10, downsample.ResLevel1, downsample.AggrAvg, source1),
+			},
+			expected: false,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			downsampled := map[ulid.ULID]*block.Meta{}
+			for _, m := range testData.downsampled {
+				downsampled[m.ULID] = m
+			}
+
+			assert.Equal(t, testData.expected, isDownsampled(raw, downsample.ResLevel1, downsampled))
+		})
+	}
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/runutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	util_math "github.com/grafana/mimir/pkg/util/math"
+)
+
+const (
+	// retentionRulesStatusFilename is the name of the file, relative to the tenant's location, where
+	// the compactor keeps track of the blocks checked against the retention rules.
+	retentionRulesStatusFilename = "retention-rules-status.json"
+
+	retentionRulesStatusVersion1 = 1
+
+	// retentionRulesRewriteSteps is the number of steps in which a block whose samples progressively
+	// expire is rewritten: a partially expired block is rewritten once a further 1/retentionRulesRewriteSteps
+	// of its time range has expired, so that each block is rewritten a bounded number of times per rule.
+	retentionRulesRewriteSteps = 4
+)
+
+// retentionRulesStatus is the status of the retention rules of a tenant, stored in the bucket so
+// that the blocks already checked are not checked again after a restart of the compactor.
+type retentionRulesStatus struct {
+	Version int `json:"version"`
+
+	// Blocks maps the ID of each block checked against the retention rules to the time, by rule selector,
+	// up to which (inclusive, milliseconds) the samples of the series matching the selector have been
+	// deleted from the block.
+	Blocks map[ulid.ULID]map[string]int64 `json:"blocks"`
+}
+
+// applyRetentionRules deletes from the tenant's blocks the series expired by the tenant's retention rules.
+// A block is rewritten once all its samples are older than a rule's retention period, and while its samples
+// progressively expire, each time a further 1/retentionRulesRewriteSteps of its time range has expired. The
+// time up to which each rule has been applied to each block is stored in the bucket, so that a block is not
+// checked again until more of its samples have expired. The blocks in marked are skipped, and the blocks
+// marked for deletion once rewritten are added to marked. Errors are logged and the deletion is retried in
+// the next cleanup run.
+func (c *BlocksCleaner) applyRetentionRules(ctx context.Context, idx *bucketindex.Index, marked map[ulid.ULID]struct{}, userID string, userBucket objstore.Bucket, userLogger log.Logger) {
+	rules := c.cfgProvider.CompactorBlocksRetentionRules(userID)
+	if len(rules) == 0 {
+		return
+	}
+
+	tombstones, err := bucketindex.NewRetentionTombstones(rules, time.Now())
+	if err != nil {
+		level.Warn(userLogger).Log("msg", "failed to apply retention rules", "err", err)
+		return
+	}
+
+	previous, err := readRetentionRulesStatus(ctx, userBucket, userLogger)
+	if err != nil {
+		level.Warn(userLogger).Log("msg", "failed to read retention rules status", "err", err)
+		return
+	}
+
+	// Only keep track of the blocks which are still in the bucket index, and of the rewritten ones.
+	status := &retentionRulesStatus{Version: retentionRulesStatusVersion1, Blocks: map[ulid.ULID]map[string]int64{}}
+	for _, b := range idx.Blocks {
+		if applied, ok := previous.Blocks[b.ID]; ok {
+			status.Blocks[b.ID] = applied
+		}
+	}
+
+	changed := len(status.Blocks) != len(previous.Blocks)
+	defer func() {
+		if !changed {
+			return
+		}
+		if err := writeRetentionRulesStatus(ctx, userBucket, status); err != nil {
+			level.Warn(userLogger).Log("msg", "failed to write retention rules status", "err", err)
+		}
+	}()
+
+	for _, b := range idx.Blocks {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if _, isMarked := marked[b.ID]; isMarked {
+			continue
+		}
+
+		// The block max time is exclusive, while the tombstone end time is inclusive.
+		blockMaxTime := b.MaxTime - 1
+		applied := status.Blocks[b.ID]
+
+		var expired bucketindex.Tombstones
+		for _, t := range tombstones {
+			from, ok := applied[t.Selectors[0]]
+			if !ok {
+				from = b.MinTime - 1
+			}
+
+			to := util_math.Min(t.EndTime, blockMaxTime)
+			if to <= from {
+				continue
+			}
+			if to < blockMaxTime && to-from < (b.MaxTime-b.MinTime)/retentionRulesRewriteSteps {
+				continue
+			}
+			expired = append(expired, t)
+		}
+		if len(expired) == 0 {
+			continue
+		}
+
+		matched, newID, err := c.purgeDeletedSeries(ctx, userID, userBucket, c.blockBucket(userID, userBucket, b), b.ID, expired, c.retentionRulesPurge, userLogger)
+		if err != nil {
+			level.Warn(userLogger).Log("msg", "failed to delete series expired by retention rules from block", "block", b.ID, "err", err)
+			continue
+		}
+
+		updated := make(map[string]int64, len(applied)+len(expired))
+		for selector, to := range applied {
+			updated[selector] = to
+		}
+		for _, t := range expired {
+			updated[t.Selectors[0]] = util_math.Min(t.EndTime, blockMaxTime)
+		}
+
+		changed = true
+		if len(matched) == 0 {
+			status.Blocks[b.ID] = updated
+			continue
+		}
+
+		// The rewritten block replaces the original one, which has been marked for deletion.
+		marked[b.ID] = struct{}{}
+		delete(status.Blocks, b.ID)
+		if newID != (ulid.ULID{}) {
+			status.Blocks[newID] = updated
+		}
+	}
+}
+
+// readRetentionRulesStatus reads the retention rules status of the tenant. An empty status is returned
+// if it doesn't exist or it's corrupted, in which case the blocks are checked again.
+func readRetentionRulesStatus(ctx context.Context, userBucket objstore.Bucket, logger log.Logger) (*retentionRulesStatus, error) {
+	status := &retentionRulesStatus{Version: retentionRulesStatusVersion1, Blocks: map[ulid.ULID]map[string]int64{}}
+
+	r, err := userBucket.Get(ctx, retentionRulesStatusFilename)
+	if userBucket.IsObjNotFoundErr(err) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read retention rules status")
+	}
+	defer runutil.CloseWithLogOnErr(logger, r, "close retention rules status reader")
+
+	if err := json.NewDecoder(r).Decode(status); err != nil || status.Version != retentionRulesStatusVersion1 {
+		level.Warn(logger).Log("msg", "found a corrupted retention rules status, recreating it", "err", err, "version", status.Version)
+		return &retentionRulesStatus{Version: retentionRulesStatusVersion1, Blocks: map[ulid.ULID]map[string]int64{}}, nil
+	}
+	if status.Blocks == nil {
+		status.Blocks = map[ulid.ULID]map[string]int64{}
+	}
+
+	return status, nil
+}
+
+// writeRetentionRulesStatus uploads the retention rules status to the tenant location in the bucket.
+func writeRetentionRulesStatus(ctx context.Context, userBucket objstore.Bucket, status *retentionRulesStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return errors.Wrap(err, "serialize retention rules status")
+	}
+
+	return errors.Wrap(userBucket.Upload(ctx, retentionRulesStatusFilename, bytes.NewReader(data)), "upload retention rules status")
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	mimir_testutil "github.com/grafana/mimir/pkg/storage/tsdb/testutil"
+	"github.com/grafana/mimir/pkg/util/test"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestBlocksCleaner_ShouldApplyRetentionRules(t *testing.T) {
+	const userID = "user-1"
+
+	bucketClient, _ := mimir_testutil.PrepareFilesystemBucket(t)
+	bucketClient = block.BucketWithGlobalMarkers(bucketClient)
+
+	now := time.Now()
+	ts := func(hours int) int64 {
+		return now.Add(time.Duration(hours)*time.Hour).Unix() * 1000
+	}
+
+	// Each block has 3 series, with series_id label values "0", "1" and "2". The series of block2
+	// have a sample every 15 minutes.
+	block1 := createTSDBBlock(t, bucketClient, userID, ts(-10), ts(-8), 3, nil)
+	block2 := createCustomTSDBBlock(t, bucketClient, userID, nil, func(db *tsdb.DB) {
+		app := db.Appender(context.Background())
+		for seriesID := 0; seriesID < 3; seriesID++ {
+			for sampleTs := ts(-6); sampleTs < ts(-4); sampleTs += (15 * time.Minute).Milliseconds() {
+				_, err := app.Append(0, labels.FromStrings("series_id", strconv.Itoa(seriesID)), sampleTs, float64(seriesID))
+				require.NoError(t, err)
+			}
+		}
+		require.NoError(t, app.Commit())
+	})
+
+	cfg := BlocksCleanerConfig{
+		DeletionDelay:           time.Hour,
+		CleanupInterval:         time.Minute,
+		CleanupConcurrency:      1,
+		DeleteBlocksConcurrency: 1,
+		DataDir:                 t.TempDir(),
+	}
+
+	ctx := context.Background()
+	logger := test.NewTestingLogger(t)
+	reg := prometheus.NewPedanticRegistry()
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.userRetentionRules[userID] = validation.RetentionRules{
+		// block1 is expired by this rule, while half of block2 is expired.
+		{Selector: `{series_id="0"}`, Period: model.Duration(5 * time.Hour)},
+		// None of the blocks is expired by this rule.
+		{Selector: `{series_id="1"}`, Period: model.Duration(100 * time.Hour)},
+	}
+
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, mimir_tsdb.AllUsers, cfgProvider, logger, reg)
+
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	checkBlock(t, userID, bucketClient, block1, true, true)
+	checkBlock(t, userID, bucketClient, block2, true, true)
+
+	// Find the rewritten blocks.
+	userBucket := bucket.NewUserBucketClient(userID, bucketClient, nil)
+	rewritten := map[ulid.ULID]*block.Meta{}
+	require.NoError(t, userBucket.Iter(ctx, "", func(name string) error {
+		if id, ok := block.IsBlockDir(name); ok && id != block1 && id != block2 {
+			meta, err := block.DownloadMeta(ctx, logger, userBucket, id)
+			if err != nil {
+				return err
+			}
+			rewritten[meta.Compaction.Parents[0].ULID] = &meta
+		}
+		return nil
+	}))
+	require.Len(t, rewritten, 2)
+
+	// The series expired by the rule have been deleted from block1, while only
+	// their expired samples have been deleted from block2.
+	assert.Equal(t, uint64(2), rewritten[block1].Stats.NumSeries)
+	assert.Equal(t, uint64(3), rewritten[block2].Stats.NumSeries)
+	assert.Equal(t, uint64(3*8-5), rewritten[block2].Stats.NumSamples)
+
+	// The status of the rewritten blocks is stored in the bucket.
+	status, err := readRetentionRulesStatus(ctx, userBucket, logger)
+	require.NoError(t, err)
+	require.Len(t, status.Blocks, 2)
+	assert.Equal(t, map[string]int64{`{series_id="0"}`: ts(-8) - 1}, status.Blocks[rewritten[block1].ULID])
+	assert.InDelta(t, ts(-5), status.Blocks[rewritten[block2].ULID][`{series_id="0"}`], float64(time.Minute.Milliseconds()))
+
+	// The next runs shouldn't rewrite the blocks again, not even after a restart of the compactor,
+	// until a further quarter of the partially expired block's time range has expired.
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	restartedReg := prometheus.NewPedanticRegistry()
+	restarted := NewBlocksCleaner(cfg, bucketClient, nil, mimir_tsdb.AllUsers, cfgProvider, logger, restartedReg)
+	require.NoError(t, restarted.runCleanupWithErr(ctx))
+
+	checkBlock(t, userID, bucketClient, rewritten[block1].ULID, true, false)
+	checkBlock(t, userID, bucketClient, rewritten[block2].ULID, true, false)
+
+	assert.NoError(t, testutil.GatherAndCompare(restartedReg, strings.NewReader(`
+		# HELP cortex_compactor_retention_rules_blocks_rewritten_total Total number of blocks rewritten to delete the series expired by retention rules.
+		# TYPE cortex_compactor_retention_rules_blocks_rewritten_total counter
+		cortex_compactor_retention_rules_blocks_rewritten_total 0
+		`),
+		"cortex_compactor_retention_rules_blocks_rewritten_total",
+	))
+
+	// Once half an hour more of the partially expired block has expired, it's rewritten again.
+	cfgProvider.userRetentionRules[userID] = validation.RetentionRules{
+		{Selector: `{series_id="0"}`, Period: model.Duration(4*time.Hour + 30*time.Minute)},
+		{Selector: `{series_id="1"}`, Period: model.Duration(100 * time.Hour)},
+	}
+	require.NoError(t, restarted.runCleanupWithErr(ctx))
+
+	checkBlock(t, userID, bucketClient, rewritten[block1].ULID, true, false)
+	checkBlock(t, userID, bucketClient, rewritten[block2].ULID, true, true)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_compactor_blocks_marked_for_deletion_total Total number of blocks marked for deletion in compactor.
+		# TYPE cortex_compactor_blocks_marked_for_deletion_total counter
+		cortex_compactor_blocks_marked_for_deletion_total{reason="partial"} 0
+		cortex_compactor_blocks_marked_for_deletion_total{reason="retention"} 0
+		cortex_compactor_blocks_marked_for_deletion_total{reason="retention-rules"} 2
+		cortex_compactor_blocks_marked_for_deletion_total{reason="series-deletion"} 0
+		cortex_compactor_blocks_marked_for_deletion_total{reason="series-rewrite"} 0
+		# HELP cortex_compactor_retention_rules_blocks_rewritten_total Total number of blocks rewritten to delete the series expired by retention rules.
+		# TYPE cortex_compactor_retention_rules_blocks_rewritten_total counter
+		cortex_compactor_retention_rules_blocks_rewritten_total 2
+		`),
+		"cortex_compactor_blocks_marked_for_deletion_total",
+		"cortex_compactor_retention_rules_blocks_rewritten_total",
+	))
+	assert.NoError(t, testutil.GatherAndCompare(restartedReg, strings.NewReader(`
+		# HELP cortex_compactor_retention_rules_blocks_rewritten_total Total number of blocks rewritten to delete the series expired by retention rules.
+		# TYPE cortex_compactor_retention_rules_blocks_rewritten_total counter
+		cortex_compactor_retention_rules_blocks_rewritten_total 1
+		`),
+		"cortex_compactor_retention_rules_blocks_rewritten_total",
+	))
+}
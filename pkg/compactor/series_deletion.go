@@ -0,0 +1,393 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/runutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+const seriesDeletionDirName = "series-deletion"
+
+// seriesPurgeReason holds the details and metrics tracked when rewriting blocks to purge series for a given reason.
+type seriesPurgeReason struct {
+	deletionDetails         string
+	blocksRewritten         prometheus.Counter
+	blocksMarkedForDeletion prometheus.Counter
+}
+
+// seriesDeletionJobs runs the series deletion job of each tenant in background, so that rewriting large
+// blocks doesn't delay the cleanup of the tenant. The job purges both the series deletion requests and
+// the series expired by the retention rules. At most one job per tenant runs at a time.
+type seriesDeletionJobs struct {
+	semaphore chan struct{}
+	wg        sync.WaitGroup
+
+	mtx     sync.Mutex
+	running map[string]struct{}
+}
+
+func newSeriesDeletionJobs(maxConcurrent int) *seriesDeletionJobs {
+	return &seriesDeletionJobs{
+		semaphore: make(chan struct{}, maxConcurrent),
+		running:   map[string]struct{}{},
+	}
+}
+
+// start runs the job of the tenant in background, unless a job of the tenant is already running.
+func (j *seriesDeletionJobs) start(ctx context.Context, userID string, job func(ctx context.Context)) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if _, ok := j.running[userID]; ok {
+		return
+	}
+	j.running[userID] = struct{}{}
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		defer func() {
+			j.mtx.Lock()
+			delete(j.running, userID)
+			j.mtx.Unlock()
+		}()
+
+		select {
+		case j.semaphore <- struct{}{}:
+			defer func() { <-j.semaphore }()
+		case <-ctx.Done():
+			return
+		}
+
+		job(ctx)
+	}()
+}
+
+func (j *seriesDeletionJobs) isRunning(userID string) bool {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	_, ok := j.running[userID]
+	return ok
+}
+
+// wait returns once all running jobs have completed.
+func (j *seriesDeletionJobs) wait() {
+	j.wg.Wait()
+}
+
+// applySeriesDeletions purges from the tenant's blocks the samples deleted by the pending series deletion
+// requests whose delay has elapsed. The blocks in marked are skipped, and the blocks marked for deletion
+// once purged are added to marked. Errors are logged and the purge is retried in the next cleanup run.
+//
+// A request is marked as processed, and stops being honoured at query time, only once no block can contain
+// its samples anymore:
+//   - A pass over all the blocks finds no more samples to purge.
+//   - No block upload is in progress (uploadsInProgress is false). Uploads include the output of the
+//     compactions and the blocks uploaded by the block upload API.
+//   - The compactor deletion delay has elapsed since the request's samples were last purged from a block,
+//     so that the compactions which started before the block was marked for deletion have completed.
+//   - The request's end time is older than the tenant's query-ingesters-within period and out-of-order
+//     time window, so that the ingesters can't upload blocks with samples of the request anymore.
+func (c *BlocksCleaner) applySeriesDeletions(ctx context.Context, idx *bucketindex.Index, marked map[ulid.ULID]struct{}, userID string, userBucket objstore.Bucket, uploadsInProgress bool, userLogger log.Logger) {
+	var effective bucketindex.Tombstones
+	for _, t := range idx.Tombstones {
+		if time.Since(t.GetCreatedAt()) >= c.cfg.SeriesDeletionDelay {
+			effective = append(effective, t)
+		}
+	}
+	if len(effective) == 0 {
+		return
+	}
+
+	// Keep track of the requests whose samples may still be stored in some blocks,
+	// and of the ones whose samples have been purged from some blocks.
+	dirty := map[string]struct{}{}
+	purged := map[string]struct{}{}
+
+	for _, b := range idx.Blocks {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Blocks marked for deletion are not queried anymore once the deletion delay
+		// has elapsed, so there's no need to purge them.
+		if _, isMarked := marked[b.ID]; isMarked {
+			continue
+		}
+
+		// The block max time is exclusive, while the tombstone end time is inclusive.
+		overlapping := effective.Overlapping(b.MinTime, b.MaxTime-1)
+		if len(overlapping) == 0 {
+			continue
+		}
+
+		matched, _, err := c.purgeDeletedSeries(ctx, userID, userBucket, c.blockBucket(userID, userBucket, b), b.ID, overlapping, c.seriesDeletionPurge, userLogger)
+		if err != nil {
+			level.Warn(userLogger).Log("msg", "failed to purge deleted series from block", "block", b.ID, "err", err)
+			matched = overlapping
+		} else {
+			for _, t := range matched {
+				purged[t.RequestID] = struct{}{}
+			}
+			if len(matched) > 0 {
+				marked[b.ID] = struct{}{}
+			}
+		}
+
+		for _, t := range matched {
+			dirty[t.RequestID] = struct{}{}
+		}
+	}
+
+	// The ingesters may upload blocks with samples up to the query-ingesters-within period and the
+	// out-of-order time window after the samples timestamp.
+	maxUploadDelay := c.cfgProvider.QueryIngestersWithin(userID) + c.cfgProvider.OutOfOrderTimeWindow(userID)
+
+	for _, t := range effective {
+		if _, isPurged := purged[t.RequestID]; isPurged {
+			updated := *t
+			updated.LastPurgedAt = time.Now().Unix()
+
+			if err := bucketindex.WriteTombstone(ctx, c.bucketClient, userID, c.cfgProvider, &updated); err != nil {
+				level.Warn(userLogger).Log("msg", "failed to update series deletion request", "request_id", t.RequestID, "err", err)
+			}
+			continue
+		}
+
+		if _, isDirty := dirty[t.RequestID]; isDirty || uploadsInProgress {
+			continue
+		}
+		if t.LastPurgedAt > 0 && time.Since(t.GetLastPurgedAt()) < c.cfg.DeletionDelay {
+			continue
+		}
+		if time.Since(time.UnixMilli(t.EndTime)) < maxUploadDelay {
+			continue
+		}
+
+		processed := *t
+		processed.State = bucketindex.TombstoneProcessed
+		processed.StateUpdatedAt = time.Now().Unix()
+
+		if err := bucketindex.WriteTombstone(ctx, c.bucketClient, userID, c.cfgProvider, &processed); err != nil {
+			level.Warn(userLogger).Log("msg", "failed to mark series deletion request as processed", "request_id", t.RequestID, "err", err)
+			continue
+		}
+
+		c.seriesDeletionRequestsProcessed.Inc()
+		level.Info(userLogger).Log("msg", "series deletion request processed", "request", processed.String())
+	}
+}
+
+// purgeDeletedSeries rewrites the block without the samples deleted by the input tombstones, uploads it,
+// and marks the original block for deletion. The block is read from the blockBucket, which is the cold storage
+// for the blocks moved there, while the rewritten block is uploaded to the userBucket. Returns the tombstones
+// which matched samples in the block, and the ID of the rewritten block, which is zero if the block has not
+// been rewritten or no samples are left in it.
+func (c *BlocksCleaner) purgeDeletedSeries(ctx context.Context, userID string, userBucket, blockBucket objstore.Bucket, blockID ulid.ULID, tombstones bucketindex.Tombstones, reason seriesPurgeReason, userLogger log.Logger) (bucketindex.Tombstones, ulid.ULID, error) {
+	workDir := filepath.Join(c.cfg.DataDir, seriesDeletionDirName, blockID.String())
+	if err := os.RemoveAll(workDir); err != nil {
+		return nil, ulid.ULID{}, errors.Wrap(err, "clean up working directory")
+	}
+	defer func() {
+		if err := os.RemoveAll(workDir); err != nil {
+			level.Warn(userLogger).Log("msg", "failed to remove series deletion working directory", "dir", workDir, "err", err)
+		}
+	}()
+
+	// Only a small fraction of the blocks is expected to contain samples to purge,
+	// so we look up the index before downloading the whole block.
+	blockDir := filepath.Join(workDir, blockID.String())
+	if err := os.MkdirAll(blockDir, 0750); err != nil {
+		return nil, ulid.ULID{}, errors.Wrap(err, "create block directory")
+	}
+
+	indexPath := filepath.Join(blockDir, block.IndexFilename)
+	if err := objstore.DownloadFile(ctx, userLogger, blockBucket, path.Join(blockID.String(), block.IndexFilename), indexPath); err != nil {
+		return nil, ulid.ULID{}, errors.Wrap(err, "download index")
+	}
+
+	matched, err := tombstonesMatchingChunks(indexPath, tombstones)
+	if err != nil {
+		return nil, ulid.ULID{}, err
+	}
+	if len(matched) == 0 {
+		return nil, ulid.ULID{}, nil
+	}
+
+	level.Info(userLogger).Log("msg", "purging deleted series from block", "block", blockID, "tombstones", len(matched))
+
+	if err := block.Download(ctx, userLogger, blockBucket, blockID, blockDir); err != nil {
+		return matched, ulid.ULID{}, errors.Wrap(err, "download block")
+	}
+
+	meta, err := block.ReadMetaFromDir(blockDir)
+	if err != nil {
+		return matched, ulid.ULID{}, errors.Wrap(err, "read block meta")
+	}
+
+	outDir := filepath.Join(workDir, "out")
+	newID, err := deleteSeriesFromBlock(ctx, userLogger, blockDir, outDir, meta, matched)
+	if err != nil {
+		return matched, ulid.ULID{}, err
+	}
+
+	// The rewritten block is empty if all its samples have been deleted.
+	if newID != (ulid.ULID{}) {
+		if err := block.WriteBloomFilters(filepath.Join(outDir, newID.String()), c.cfgProvider.BlockBloomFilterLabelNames(userID)); err != nil {
+			return matched, ulid.ULID{}, errors.Wrapf(err, "write bloom filters of the rewritten block %s", newID)
+		}
+		if err := block.WriteExemplarsFromSources(filepath.Join(outDir, newID.String()), []string{blockDir}); err != nil {
+			return matched, ulid.ULID{}, errors.Wrapf(err, "write exemplars of the rewritten block %s", newID)
+		}
+		if err := block.Upload(ctx, userLogger, userBucket, filepath.Join(outDir, newID.String()), nil); err != nil {
+			return matched, ulid.ULID{}, errors.Wrapf(err, "upload rewritten block %s", newID)
+		}
+		reason.blocksRewritten.Inc()
+	}
+
+	if err := block.MarkForDeletion(ctx, userLogger, userBucket, blockID, reason.deletionDetails, reason.blocksMarkedForDeletion); err != nil {
+		return matched, ulid.ULID{}, errors.Wrapf(err, "mark block %s for deletion", blockID)
+	}
+
+	level.Info(userLogger).Log("msg", "purged deleted series from block", "block", blockID, "rewritten_block", newID)
+	return matched, newID, nil
+}
+
+// tombstonesMatchingChunks returns the tombstones matching at least one chunk in the index at the input path.
+func tombstonesMatchingChunks(indexPath string, tombstones bucketindex.Tombstones) (_ bucketindex.Tombstones, returnErr error) {
+	r, err := index.NewFileReader(indexPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, r, "close index reader")
+
+	var (
+		out     bucketindex.Tombstones
+		builder labels.ScratchBuilder
+		chks    []chunks.Meta
+	)
+
+	for _, t := range tombstones {
+		selectors, err := t.Matchers()
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for _, matchers := range selectors {
+			p, err := tsdb.PostingsForMatchers(r, matchers...)
+			if err != nil {
+				return nil, errors.Wrap(err, "expand postings")
+			}
+
+			for !found && p.Next() {
+				if err := r.Series(p.At(), &builder, &chks); err != nil {
+					return nil, errors.Wrap(err, "read series")
+				}
+
+				for _, chk := range chks {
+					if chk.OverlapsClosedInterval(t.StartTime, t.EndTime) {
+						found = true
+						break
+					}
+				}
+			}
+			if err := p.Err(); err != nil {
+				return nil, errors.Wrap(err, "iterate postings")
+			}
+			if found {
+				break
+			}
+		}
+
+		if found {
+			out = append(out, t)
+		}
+	}
+
+	return out, nil
+}
+
+// deleteSeriesFromBlock writes to outDir a copy of the block stored in blockDir, without the samples deleted
+// by the input tombstones. The compaction level, sources and external labels of the original block are preserved.
+// Returns a zero ULID if no samples are left in the block.
+func deleteSeriesFromBlock(ctx context.Context, logger log.Logger, blockDir, outDir string, meta *block.Meta, tombstones bucketindex.Tombstones) (_ ulid.ULID, returnErr error) {
+	b, err := tsdb.OpenBlock(logger, blockDir, nil)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "open block")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, b, "close block")
+
+	for _, t := range tombstones {
+		selectors, err := t.Matchers()
+		if err != nil {
+			return ulid.ULID{}, err
+		}
+		for _, matchers := range selectors {
+			if err := b.Delete(t.StartTime, t.EndTime, matchers...); err != nil {
+				return ulid.ULID{}, errors.Wrapf(err, "delete series of request %s", t.RequestID)
+			}
+		}
+	}
+
+	compactor, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{meta.MaxTime - meta.MinTime}, nil, nil, false)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "create compactor")
+	}
+
+	newID, err := compactor.Write(outDir, b, meta.MinTime, meta.MaxTime, &meta.BlockMeta)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write block")
+	}
+	if newID == (ulid.ULID{}) {
+		return newID, nil
+	}
+
+	newDir := filepath.Join(outDir, newID.String())
+
+	// Writing the block resets the compaction level and sources, which we want to preserve
+	// so that the rewritten block is compacted like the original one would have been.
+	compaction := meta.Compaction
+	compaction.Parents = []tsdb.BlockDesc{{ULID: meta.ULID, MinTime: meta.MinTime, MaxTime: meta.MaxTime}}
+
+	newMeta, err := block.InjectThanosMeta(logger, newDir, block.ThanosMeta{
+		Labels:       meta.Thanos.Labels,
+		Downsample:   meta.Thanos.Downsample,
+		Source:       block.CompactorRewriteSource,
+		SegmentFiles: block.GetSegmentFiles(newDir),
+	}, &tsdb.BlockMeta{Compaction: compaction})
+	if err != nil {
+		return ulid.ULID{}, errors.Wrapf(err, "failed to finalize the block %s", newDir)
+	}
+
+	if err = os.Remove(filepath.Join(newDir, "tombstones")); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "remove tombstones")
+	}
+
+	if err := block.VerifyBlock(logger, newDir, newMeta.MinTime, newMeta.MaxTime, false); err != nil {
+		return ulid.ULID{}, errors.Wrapf(err, "invalid rewritten block %s", newDir)
+	}
+
+	return newID, nil
+}
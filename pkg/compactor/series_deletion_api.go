@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+var errSeriesDeletionRequestNotCancellable = errors.New("the series deletion request can't be cancelled because the compactor may have already started purging the matching samples")
+
+// CreateSeriesDeletionRequest creates a tenant-scoped request to delete the series matching the match[]
+// selectors within the start and end time range. The samples are masked by queriers as soon as the bucket
+// index is updated, and purged from the blocks by the compactor after the configured delay.
+func (c *MultitenantCompactor) CreateSeriesDeletionRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	startTime := int64(math.MinInt64)
+	if v := r.Form.Get("start"); v != "" {
+		if startTime, err = util.ParseTime(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid start time: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	endTime := util.TimeToMillis(time.Now())
+	if v := r.Form.Get("end"); v != "" {
+		if endTime, err = util.ParseTime(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid end time: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	t, err := bucketindex.NewTombstone(r.Form["match[]"], startTime, endTime, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Creating the same request twice is idempotent, and we don't want to reset the state
+	// or creation time of a request which already exists.
+	existing, err := bucketindex.ReadTombstone(ctx, c.bucketClient, userID, c.cfgProvider, t.RequestID, c.logger)
+	if err != nil && !errors.Is(err, bucketindex.ErrTombstoneNotFound) {
+		level.Error(c.logger).Log("msg", "failed to read series deletion request", "user", userID, "request_id", t.RequestID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		util.WriteJSONResponse(w, existing)
+		return
+	}
+
+	if err := bucketindex.WriteTombstone(ctx, c.bucketClient, userID, c.cfgProvider, t); err != nil {
+		level.Error(c.logger).Log("msg", "failed to write series deletion request", "user", userID, "request_id", t.RequestID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	level.Info(c.logger).Log("msg", "series deletion request created", "user", userID, "request", t.String())
+
+	util.WriteJSONResponse(w, t)
+}
+
+// ListSeriesDeletionRequests lists the tenant's series deletion requests, both pending and processed.
+func (c *MultitenantCompactor) ListSeriesDeletionRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tombstones, err := bucketindex.ListTombstones(ctx, c.bucketClient, userID, c.cfgProvider, c.logger)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to list series deletion requests", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(tombstones, func(i, j int) bool {
+		if tombstones[i].CreatedAt != tombstones[j].CreatedAt {
+			return tombstones[i].CreatedAt < tombstones[j].CreatedAt
+		}
+		return tombstones[i].RequestID < tombstones[j].RequestID
+	})
+
+	util.WriteJSONResponse(w, tombstones)
+}
+
+// CancelSeriesDeletionRequest cancels a pending series deletion request. A request can only be
+// cancelled until the compactor starts purging the matching samples from the blocks.
+func (c *MultitenantCompactor) CancelSeriesDeletionRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	requestID := r.FormValue("request_id")
+	if requestID == "" {
+		http.Error(w, "missing request_id", http.StatusBadRequest)
+		return
+	}
+
+	t, err := bucketindex.ReadTombstone(ctx, c.bucketClient, userID, c.cfgProvider, requestID, c.logger)
+	if errors.Is(err, bucketindex.ErrTombstoneNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to read series deletion request", "user", userID, "request_id", requestID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if t.State != bucketindex.TombstonePending || time.Since(t.GetCreatedAt()) >= c.compactorCfg.SeriesDeletionDelay {
+		http.Error(w, errSeriesDeletionRequestNotCancellable.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := bucketindex.DeleteTombstone(ctx, c.bucketClient, userID, c.cfgProvider, requestID); err != nil {
+		level.Error(c.logger).Log("msg", "failed to delete series deletion request", "user", userID, "request_id", requestID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	level.Info(c.logger).Log("msg", "series deletion request cancelled", "user", userID, "request_id", requestID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+func TestSeriesDeletionAPI(t *testing.T) {
+	const userID = "user-1"
+
+	bkt := objstore.NewInMemBucket()
+	cfg := prepareConfig(t)
+	cfg.SeriesDeletionDelay = time.Hour
+	c, _, _, _, _ := prepare(t, cfg, bkt)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	t.Cleanup(stopServiceFn(t, c))
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+
+	newRequest := func(method string, form url.Values) *http.Request {
+		req := httptest.NewRequest(method, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req.WithContext(ctx)
+	}
+
+	create := func(form url.Values) (*httptest.ResponseRecorder, *bucketindex.Tombstone) {
+		resp := httptest.NewRecorder()
+		c.CreateSeriesDeletionRequest(resp, newRequest(http.MethodPost, form))
+		if resp.Code != http.StatusOK {
+			return resp, nil
+		}
+
+		tombstone := &bucketindex.Tombstone{}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), tombstone))
+		return resp, tombstone
+	}
+
+	list := func() bucketindex.Tombstones {
+		resp := httptest.NewRecorder()
+		c.ListSeriesDeletionRequests(resp, newRequest(http.MethodGet, nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var tombstones bucketindex.Tombstones
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tombstones))
+		return tombstones
+	}
+
+	cancel := func(requestID string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		c.CancelSeriesDeletionRequest(resp, newRequest(http.MethodPost, url.Values{"request_id": []string{requestID}}))
+		return resp
+	}
+
+	t.Run("should fail without tenant ID", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		c.CreateSeriesDeletionRequest(resp, httptest.NewRequest(http.MethodPost, "/", nil))
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	})
+
+	t.Run("should fail on invalid input", func(t *testing.T) {
+		resp, _ := create(url.Values{})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp, _ = create(url.Values{"match[]": []string{`{job="test"`}})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp, _ = create(url.Values{"match[]": []string{`{job="test"}`}, "start": []string{"invalid"}})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp, _ = create(url.Values{"match[]": []string{`{job="test"}`}, "start": []string{"20"}, "end": []string{"10"}})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		assert.Empty(t, list())
+	})
+
+	t.Run("should create, list and cancel requests", func(t *testing.T) {
+		resp, first := create(url.Values{"match[]": []string{`{job="first"}`}, "start": []string{"10"}, "end": []string{"20"}})
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, int64(10000), first.StartTime)
+		assert.Equal(t, int64(20000), first.EndTime)
+		assert.Equal(t, []string{`{job="first"}`}, first.Selectors)
+		assert.Equal(t, bucketindex.TombstonePending, first.State)
+
+		// Creating the same request again should return the existing one.
+		resp, again := create(url.Values{"match[]": []string{`{job="first"}`}, "start": []string{"10"}, "end": []string{"20"}})
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, first, again)
+
+		resp, second := create(url.Values{"match[]": []string{`{job="second"}`, `up`}})
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.NotEqual(t, first.RequestID, second.RequestID)
+
+		assert.ElementsMatch(t, bucketindex.Tombstones{first, second}, list())
+
+		// Cancel the first request.
+		assert.Equal(t, http.StatusNoContent, cancel(first.RequestID).Code)
+		assert.Equal(t, http.StatusNotFound, cancel(first.RequestID).Code)
+		assert.Equal(t, bucketindex.Tombstones{second}, list())
+	})
+
+	t.Run("should not cancel a request whose delay has elapsed", func(t *testing.T) {
+		tombstone, err := bucketindex.NewTombstone([]string{`{job="elapsed"}`}, 10, 20, time.Now().Add(-2*time.Hour))
+		require.NoError(t, err)
+		require.NoError(t, bucketindex.WriteTombstone(ctx, bkt, userID, nil, tombstone))
+
+		assert.Equal(t, http.StatusBadRequest, cancel(tombstone.RequestID).Code)
+
+		_, err = bucketindex.ReadTombstone(ctx, bkt, userID, nil, tombstone.RequestID, log.NewNopLogger())
+		require.NoError(t, err)
+	})
+}
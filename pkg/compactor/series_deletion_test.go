@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	mimir_testutil "github.com/grafana/mimir/pkg/storage/tsdb/testutil"
+	"github.com/grafana/mimir/pkg/util/test"
+)
+
+func TestBlocksCleaner_ShouldPurgeDeletedSeries(t *testing.T) {
+	const userID = "user-1"
+
+	bucketClient, _ := mimir_testutil.PrepareFilesystemBucket(t)
+	bucketClient = block.BucketWithGlobalMarkers(bucketClient)
+
+	now := time.Now()
+	ts := func(hours int) int64 {
+		return now.Add(time.Duration(hours)*time.Hour).Unix() * 1000
+	}
+
+	// Each block has 3 series: series_id="0" has a sample at minT, and series_id="2" at maxT-1.
+	block1 := createTSDBBlock(t, bucketClient, userID, ts(-10), ts(-8), 3, map[string]string{"ext": "label"})
+	block2 := createTSDBBlock(t, bucketClient, userID, ts(-8), ts(-6), 3, nil)
+
+	// This request only matches samples of block1, and its delay has elapsed.
+	elapsed, err := bucketindex.NewTombstone([]string{`{series_id="0"}`}, ts(-10), ts(-9), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, bucketindex.WriteTombstone(context.Background(), bucketClient, userID, nil, elapsed))
+
+	// This request matches samples of block2, but its delay has not elapsed yet.
+	recent, err := bucketindex.NewTombstone([]string{`{series_id="2"}`}, ts(-8), ts(-6), time.Now())
+	require.NoError(t, err)
+	require.NoError(t, bucketindex.WriteTombstone(context.Background(), bucketClient, userID, nil, recent))
+
+	cfg := BlocksCleanerConfig{
+		DeletionDelay:           time.Hour,
+		CleanupInterval:         time.Minute,
+		CleanupConcurrency:      1,
+		DeleteBlocksConcurrency: 1,
+		DataDir:                 t.TempDir(),
+		SeriesDeletionDelay:     30 * time.Minute,
+	}
+
+	ctx := context.Background()
+	logger := test.NewTestingLogger(t)
+	reg := prometheus.NewPedanticRegistry()
+	cfgProvider := newMockConfigProvider()
+
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, cfgProvider, logger, reg)
+
+	// The first run should rewrite block1, while the request is still pending because
+	// the rewritten block is not in the bucket index yet.
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	checkBlock(t, userID, bucketClient, block1, true, true)
+	checkBlock(t, userID, bucketClient, block2, true, false)
+
+	idx, err := bucketindex.ReadIndex(ctx, bucketClient, userID, nil, logger)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, bucketindex.Tombstones{elapsed, recent}, idx.Tombstones)
+
+	// Find the rewritten block.
+	var rewritten ulid.ULID
+	userBucket := bucket.NewUserBucketClient(userID, bucketClient, nil)
+	require.NoError(t, userBucket.Iter(ctx, "", func(name string) error {
+		if id, ok := block.IsBlockDir(name); ok && id != block1 && id != block2 {
+			rewritten = id
+		}
+		return nil
+	}))
+	require.NotEqual(t, ulid.ULID{}, rewritten)
+
+	originalMeta, err := block.DownloadMeta(ctx, logger, userBucket, block1)
+	require.NoError(t, err)
+	rewrittenMeta, err := block.DownloadMeta(ctx, logger, userBucket, rewritten)
+	require.NoError(t, err)
+
+	assert.Equal(t, originalMeta.MinTime, rewrittenMeta.MinTime)
+	assert.Equal(t, originalMeta.MaxTime, rewrittenMeta.MaxTime)
+	assert.Equal(t, originalMeta.Compaction.Level, rewrittenMeta.Compaction.Level)
+	assert.Equal(t, originalMeta.Compaction.Sources, rewrittenMeta.Compaction.Sources)
+	assert.Equal(t, block1, rewrittenMeta.Compaction.Parents[0].ULID)
+	assert.Equal(t, originalMeta.Thanos.Labels, rewrittenMeta.Thanos.Labels)
+	assert.Equal(t, block.CompactorRewriteSource, rewrittenMeta.Thanos.Source)
+	assert.Equal(t, uint64(3), originalMeta.Stats.NumSeries)
+	assert.Equal(t, uint64(2), rewrittenMeta.Stats.NumSeries)
+
+	// The second run should find no more samples to purge, but the request is still pending because
+	// a compaction started before block1 was marked for deletion may still upload its samples.
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	checkBlock(t, userID, bucketClient, rewritten, true, false)
+
+	pending, err := bucketindex.ReadTombstone(ctx, bucketClient, userID, nil, elapsed.RequestID, logger)
+	require.NoError(t, err)
+	assert.Equal(t, bucketindex.TombstonePending, pending.State)
+	assert.NotZero(t, pending.LastPurgedAt)
+
+	// Once the deletion delay has elapsed since the last purge, the request is still pending
+	// while the ingesters may upload samples of the request.
+	pending.LastPurgedAt = time.Now().Add(-2 * cfg.DeletionDelay).Unix()
+	require.NoError(t, bucketindex.WriteTombstone(ctx, bucketClient, userID, nil, pending))
+	cfgProvider.queryIngestersWithin[userID] = 13 * time.Hour
+
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	pending, err = bucketindex.ReadTombstone(ctx, bucketClient, userID, nil, elapsed.RequestID, logger)
+	require.NoError(t, err)
+	assert.Equal(t, bucketindex.TombstonePending, pending.State)
+
+	cfgProvider.queryIngestersWithin[userID] = 6 * time.Hour
+	cfgProvider.outOfOrderTimeWindow[userID] = time.Hour
+
+	// The request is still pending while a block upload is in progress.
+	partial := ulid.MustNew(ulid.Now(), nil)
+	require.NoError(t, userBucket.Upload(ctx, path.Join(partial.String(), block.IndexFilename), strings.NewReader("index")))
+
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	pending, err = bucketindex.ReadTombstone(ctx, bucketClient, userID, nil, elapsed.RequestID, logger)
+	require.NoError(t, err)
+	assert.Equal(t, bucketindex.TombstonePending, pending.State)
+
+	// The request is marked as processed once no block upload is in progress and the ingesters
+	// can't upload samples of the request anymore.
+	require.NoError(t, userBucket.Delete(ctx, path.Join(partial.String(), block.IndexFilename)))
+
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	idx, err = bucketindex.ReadIndex(ctx, bucketClient, userID, nil, logger)
+	require.NoError(t, err)
+	assert.Equal(t, bucketindex.Tombstones{recent}, idx.Tombstones)
+
+	processed, err := bucketindex.ReadTombstone(ctx, bucketClient, userID, nil, elapsed.RequestID, logger)
+	require.NoError(t, err)
+	assert.Equal(t, bucketindex.TombstoneProcessed, processed.State)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_compactor_blocks_marked_for_deletion_total Total number of blocks marked for deletion in compactor.
+		# TYPE cortex_compactor_blocks_marked_for_deletion_total counter
+		cortex_compactor_blocks_marked_for_deletion_total{reason="partial"} 0
+		cortex_compactor_blocks_marked_for_deletion_total{reason="retention"} 0
+		cortex_compactor_blocks_marked_for_deletion_total{reason="retention-rules"} 0
+		cortex_compactor_blocks_marked_for_deletion_total{reason="series-deletion"} 1
+		cortex_compactor_blocks_marked_for_deletion_total{reason="series-rewrite"} 0
+		# HELP cortex_compactor_series_deletion_blocks_rewritten_total Total number of blocks rewritten to purge the samples of series deletion requests.
+		# TYPE cortex_compactor_series_deletion_blocks_rewritten_total counter
+		cortex_compactor_series_deletion_blocks_rewritten_total 1
+		# HELP cortex_compactor_series_deletion_requests_processed_total Total number of series deletion requests whose samples have been purged from all blocks.
+		# TYPE cortex_compactor_series_deletion_requests_processed_total counter
+		cortex_compactor_series_deletion_requests_processed_total 1
+		`),
+		"cortex_compactor_blocks_marked_for_deletion_total",
+		"cortex_compactor_series_deletion_blocks_rewritten_total",
+		"cortex_compactor_series_deletion_requests_processed_total",
+	))
+}
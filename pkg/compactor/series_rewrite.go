@@ -0,0 +1,724 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/runutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/objstore"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+const (
+	seriesRewriteDirName = "series-rewrite"
+
+	// seriesRewriteRequestsPrefix is the location, relative to the tenant's location, where series rewrite requests are stored.
+	seriesRewriteRequestsPrefix = "rewrite-requests"
+)
+
+// seriesRewriteState is the processing state of a series rewrite request.
+type seriesRewriteState string
+
+const (
+	// seriesRewritePending is the state of a series rewrite request whose series may still
+	// be stored with the original labels in some blocks.
+	seriesRewritePending seriesRewriteState = "pending"
+
+	// seriesRewriteProcessed is the state of a series rewrite request whose series have been
+	// rewritten in all blocks by the compactor.
+	seriesRewriteProcessed seriesRewriteState = "processed"
+)
+
+var (
+	errSeriesRewriteRequestNotFound  = errors.New("series rewrite request not found")
+	errSeriesRewriteRequestCorrupted = errors.New("series rewrite request corrupted")
+
+	errSeriesRewriteNoRelabelConfigs    = errors.New("at least one relabel config must be provided")
+	errSeriesRewriteInvalidTimeRange    = errors.New("the end time must be greater than or equal to the start time")
+	errSeriesRewriteEmptyRelabelConfigs = errors.New("relabel configs can't be empty")
+)
+
+// seriesRewriteRequest holds a request to apply the relabel configs to the series of the blocks
+// overlapping the time range. The series dropped by the relabel configs are deleted from the blocks.
+type seriesRewriteRequest struct {
+	// RequestID uniquely identifies the request within the tenant. It's computed from the
+	// relabel configs and time range, so that creating the same request twice is idempotent.
+	RequestID string `json:"request_id"`
+
+	// StartTime and EndTime specify the time range of the blocks to rewrite (millis precision, both inclusive).
+	// The whole content of the blocks overlapping the time range is rewritten.
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+
+	// RelabelConfigs is the YAML encoded list of Prometheus relabel configs applied to the series.
+	RelabelConfigs string `json:"relabel_configs"`
+
+	// CreatedAt is a unix timestamp (seconds precision) of when the request has been created.
+	CreatedAt int64 `json:"created_at"`
+
+	// State of the request, and unix timestamp (seconds precision) of its last update.
+	State          seriesRewriteState `json:"state"`
+	StateUpdatedAt int64              `json:"state_updated_at"`
+
+	// RewrittenBlocks is the list of the blocks written by the request. They're not rewritten again
+	// by the request, because the relabel configs are not necessarily idempotent.
+	RewrittenBlocks []ulid.ULID `json:"rewritten_blocks,omitempty"`
+}
+
+// newSeriesRewriteRequest validates the input relabel configs and time range, and returns a pending request.
+func newSeriesRewriteRequest(relabelConfigs string, startTime, endTime int64, createdAt time.Time) (*seriesRewriteRequest, error) {
+	if strings.TrimSpace(relabelConfigs) == "" {
+		return nil, errSeriesRewriteNoRelabelConfigs
+	}
+	if endTime < startTime {
+		return nil, errSeriesRewriteInvalidTimeRange
+	}
+
+	cfgs, err := parseRelabelConfigs(relabelConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Normalise the relabel configs, so that the request ID doesn't depend on how they have been formatted.
+	normalised, err := yaml.Marshal(cfgs)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode relabel configs")
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strconv.FormatInt(startTime, 10)))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(strconv.FormatInt(endTime, 10)))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(normalised)
+
+	return &seriesRewriteRequest{
+		RequestID:      fmt.Sprintf("%016x", h.Sum64()),
+		StartTime:      startTime,
+		EndTime:        endTime,
+		RelabelConfigs: string(normalised),
+		CreatedAt:      createdAt.Unix(),
+		State:          seriesRewritePending,
+		StateUpdatedAt: createdAt.Unix(),
+	}, nil
+}
+
+func parseRelabelConfigs(s string) ([]*relabel.Config, error) {
+	var cfgs []*relabel.Config
+
+	dec := yaml.NewDecoder(strings.NewReader(s))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfgs); err != nil {
+		return nil, errors.Wrap(err, "invalid relabel configs")
+	}
+	if len(cfgs) == 0 {
+		return nil, errSeriesRewriteNoRelabelConfigs
+	}
+	for _, cfg := range cfgs {
+		if cfg == nil {
+			return nil, errSeriesRewriteEmptyRelabelConfigs
+		}
+	}
+
+	return cfgs, nil
+}
+
+// Relabel returns the parsed relabel configs.
+func (r *seriesRewriteRequest) Relabel() ([]*relabel.Config, error) {
+	cfgs, err := parseRelabelConfigs(r.RelabelConfigs)
+	return cfgs, errors.Wrapf(err, "series rewrite request %s", r.RequestID)
+}
+
+func (r *seriesRewriteRequest) GetCreatedAt() time.Time {
+	return time.Unix(r.CreatedAt, 0)
+}
+
+func (r *seriesRewriteRequest) String() string {
+	return fmt.Sprintf("%s (start: %d, end: %d, state: %s, rewritten blocks: %d)", r.RequestID, r.StartTime, r.EndTime, r.State, len(r.RewrittenBlocks))
+}
+
+func seriesRewriteRequestPath(requestID string) string {
+	return path.Join(seriesRewriteRequestsPrefix, requestID+".json")
+}
+
+// writeSeriesRewriteRequest uploads the request to the tenant's bucket, overwriting any existing one with the same request ID.
+func writeSeriesRewriteRequest(ctx context.Context, userBkt objstore.Bucket, r *seriesRewriteRequest) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "serialize series rewrite request")
+	}
+
+	return errors.Wrap(userBkt.Upload(ctx, seriesRewriteRequestPath(r.RequestID), bytes.NewReader(data)), "upload series rewrite request")
+}
+
+// readSeriesRewriteRequest reads the request with the given ID. Returns errSeriesRewriteRequestNotFound if it doesn't exist.
+func readSeriesRewriteRequest(ctx context.Context, userBkt objstore.InstrumentedBucket, name string, logger log.Logger) (*seriesRewriteRequest, error) {
+	r, err := userBkt.ReaderWithExpectedErrs(userBkt.IsObjNotFoundErr).Get(ctx, name)
+	if err != nil {
+		if userBkt.IsObjNotFoundErr(err) {
+			return nil, errSeriesRewriteRequestNotFound
+		}
+		return nil, errors.Wrapf(err, "read series rewrite request %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(logger, r, "close series rewrite request reader")
+
+	req := &seriesRewriteRequest{}
+	if err := json.NewDecoder(r).Decode(req); err != nil {
+		return nil, errors.Wrapf(errSeriesRewriteRequestCorrupted, "decode series rewrite request %s: %v", name, err)
+	}
+
+	return req, nil
+}
+
+// listSeriesRewriteRequests reads and returns all the tenant's series rewrite requests, regardless of their state.
+// Corrupted requests are logged and skipped.
+func listSeriesRewriteRequests(ctx context.Context, userBkt objstore.InstrumentedBucket, logger log.Logger) ([]*seriesRewriteRequest, error) {
+	var names []string
+	err := userBkt.Iter(ctx, seriesRewriteRequestsPrefix+"/", func(name string) error {
+		if strings.HasSuffix(name, ".json") {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list series rewrite requests")
+	}
+
+	out := make([]*seriesRewriteRequest, 0, len(names))
+	for _, name := range names {
+		r, err := readSeriesRewriteRequest(ctx, userBkt, name, logger)
+		if errors.Is(err, errSeriesRewriteRequestNotFound) {
+			continue
+		}
+		if errors.Is(err, errSeriesRewriteRequestCorrupted) {
+			level.Error(logger).Log("msg", "skipped corrupted series rewrite request", "request", name, "err", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, r)
+	}
+
+	return out, nil
+}
+
+// applySeriesRewrites rewrites the tenant's blocks overlapping the time range of the pending series rewrite
+// requests, applying their relabel configs. Each rewritten block is added to the input bucket index together
+// with the deletion mark of the original block, so that both are published by the same bucket index update.
+// Like for the series deletion requests, a request is marked as processed only once a pass over all the blocks
+// finds no more series to rewrite, so that the blocks written by a compaction running concurrently with the
+// rewrite are rewritten in the next pass. Errors are logged and the rewrite is retried in the next cleanup run.
+func (c *BlocksCleaner) applySeriesRewrites(ctx context.Context, idx *bucketindex.Index, userID string, userBucket objstore.InstrumentedBucket, userLogger log.Logger) {
+	requests, err := listSeriesRewriteRequests(ctx, userBucket, userLogger)
+	if err != nil {
+		level.Warn(userLogger).Log("msg", "failed to list series rewrite requests", "err", err)
+		return
+	}
+
+	// Process the requests in the order they've been created.
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].CreatedAt != requests[j].CreatedAt {
+			return requests[i].CreatedAt < requests[j].CreatedAt
+		}
+		return requests[i].RequestID < requests[j].RequestID
+	})
+
+	for _, r := range requests {
+		if ctx.Err() != nil {
+			return
+		}
+		if r.State != seriesRewritePending {
+			continue
+		}
+
+		c.applySeriesRewrite(ctx, idx, r, userID, userBucket, log.With(userLogger, "request_id", r.RequestID))
+	}
+}
+
+func (c *BlocksCleaner) applySeriesRewrite(ctx context.Context, idx *bucketindex.Index, r *seriesRewriteRequest, userID string, userBucket objstore.Bucket, userLogger log.Logger) {
+	cfgs, err := r.Relabel()
+	if err != nil {
+		level.Warn(userLogger).Log("msg", "skipped invalid series rewrite request", "err", err)
+		return
+	}
+
+	marked := make(map[ulid.ULID]struct{}, len(idx.BlockDeletionMarks))
+	for _, d := range idx.BlockDeletionMarks {
+		marked[d.ID] = struct{}{}
+	}
+
+	rewritten := make(map[ulid.ULID]struct{}, len(r.RewrittenBlocks))
+	for _, id := range r.RewrittenBlocks {
+		rewritten[id] = struct{}{}
+	}
+
+	// The rewritten blocks are appended to the index while iterating, so we iterate over a copy.
+	blocks := append(bucketindex.Blocks(nil), idx.Blocks...)
+	dirty := false
+	newBlocks := 0
+
+	for _, b := range blocks {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if _, isMarked := marked[b.ID]; isMarked {
+			continue
+		}
+		if _, isRewritten := rewritten[b.ID]; isRewritten {
+			continue
+		}
+		if !b.Within(r.StartTime, r.EndTime) {
+			continue
+		}
+
+		newMeta, changed, err := c.rewriteSeries(ctx, userID, userBucket, c.blockBucket(userID, userBucket, b), b.ID, r, cfgs, userLogger)
+		if err != nil {
+			level.Warn(userLogger).Log("msg", "failed to rewrite series of block", "block", b.ID, "err", err)
+			dirty = true
+			continue
+		}
+		if !changed {
+			continue
+		}
+		dirty = true
+
+		// Publish the rewritten block and the deletion mark of the original block in the same bucket index update.
+		now := time.Now().Unix()
+		if newMeta != nil {
+			entry := bucketindex.BlockFromThanosMeta(*newMeta)
+			entry.UploadedAt = now
+			idx.Blocks = append(idx.Blocks, entry)
+
+			r.RewrittenBlocks = append(r.RewrittenBlocks, newMeta.ULID)
+			newBlocks++
+		}
+		idx.BlockDeletionMarks = append(idx.BlockDeletionMarks, &bucketindex.BlockDeletionMark{ID: b.ID, DeletionTime: now})
+		marked[b.ID] = struct{}{}
+	}
+
+	if dirty {
+		// Keep track of the rewritten blocks, so that they're not rewritten again in the next passes.
+		if newBlocks > 0 {
+			if err := writeSeriesRewriteRequest(ctx, userBucket, r); err != nil {
+				level.Warn(userLogger).Log("msg", "failed to update series rewrite request", "err", err)
+			}
+		}
+		return
+	}
+
+	r.State = seriesRewriteProcessed
+	r.StateUpdatedAt = time.Now().Unix()
+
+	if err := writeSeriesRewriteRequest(ctx, userBucket, r); err != nil {
+		level.Warn(userLogger).Log("msg", "failed to mark series rewrite request as processed", "err", err)
+		return
+	}
+
+	c.seriesRewriteRequestsProcessed.Inc()
+	level.Info(userLogger).Log("msg", "series rewrite request processed", "request", r.String())
+}
+
+// rewriteSeries rewrites the block applying the relabel configs to its series, uploads it, and marks the original
+// block for deletion. The block is read from the blockBucket, which is the cold storage for the blocks moved there,
+// while the rewritten block is uploaded to the userBucket. Returns whether the relabel configs changed any series,
+// and the meta of the rewritten block, which is nil if all the series have been dropped.
+func (c *BlocksCleaner) rewriteSeries(ctx context.Context, userID string, userBucket, blockBucket objstore.Bucket, blockID ulid.ULID, r *seriesRewriteRequest, cfgs []*relabel.Config, userLogger log.Logger) (*block.Meta, bool, error) {
+	workDir := filepath.Join(c.cfg.DataDir, seriesRewriteDirName, blockID.String())
+	if err := os.RemoveAll(workDir); err != nil {
+		return nil, false, errors.Wrap(err, "clean up working directory")
+	}
+	defer func() {
+		if err := os.RemoveAll(workDir); err != nil {
+			level.Warn(userLogger).Log("msg", "failed to remove series rewrite working directory", "dir", workDir, "err", err)
+		}
+	}()
+
+	// The relabel configs are expected to change the series of a small fraction of the blocks,
+	// so we look up the index before downloading the whole block.
+	blockDir := filepath.Join(workDir, blockID.String())
+	if err := os.MkdirAll(blockDir, 0750); err != nil {
+		return nil, false, errors.Wrap(err, "create block directory")
+	}
+
+	indexPath := filepath.Join(blockDir, block.IndexFilename)
+	if err := objstore.DownloadFile(ctx, userLogger, blockBucket, path.Join(blockID.String(), block.IndexFilename), indexPath); err != nil {
+		return nil, false, errors.Wrap(err, "download index")
+	}
+
+	changed, err := relabelChangesSeries(indexPath, cfgs)
+	if err != nil || !changed {
+		return nil, false, err
+	}
+
+	level.Info(userLogger).Log("msg", "rewriting series of block", "block", blockID)
+
+	if err := block.Download(ctx, userLogger, blockBucket, blockID, blockDir); err != nil {
+		return nil, true, errors.Wrap(err, "download block")
+	}
+
+	meta, err := block.ReadMetaFromDir(blockDir)
+	if err != nil {
+		return nil, true, errors.Wrap(err, "read block meta")
+	}
+
+	outDir := filepath.Join(workDir, "out")
+	newID, err := relabelBlock(ctx, userLogger, blockDir, outDir, meta, cfgs)
+	if err != nil {
+		return nil, true, err
+	}
+
+	// The rewritten block is empty if all its series have been dropped.
+	var newMeta *block.Meta
+	if newID != (ulid.ULID{}) {
+		newDir := filepath.Join(outDir, newID.String())
+		if err := block.WriteBloomFilters(newDir, c.cfgProvider.BlockBloomFilterLabelNames(userID)); err != nil {
+			return nil, true, errors.Wrapf(err, "write bloom filters of the rewritten block %s", newID)
+		}
+		// The exemplars of the relabeled series are dropped, because they don't belong to a series of the rewritten block anymore.
+		if err := block.WriteExemplarsFromSources(newDir, []string{blockDir}); err != nil {
+			return nil, true, errors.Wrapf(err, "write exemplars of the rewritten block %s", newID)
+		}
+		if err := block.Upload(ctx, userLogger, userBucket, newDir, nil); err != nil {
+			return nil, true, errors.Wrapf(err, "upload rewritten block %s", newID)
+		}
+		c.seriesRewrite.blocksRewritten.Inc()
+
+		// The meta.json is updated by the upload with the list of the block files.
+		if newMeta, err = block.ReadMetaFromDir(newDir); err != nil {
+			return nil, true, errors.Wrapf(err, "read meta of the rewritten block %s", newID)
+		}
+	}
+
+	details := fmt.Sprintf("%s %s", c.seriesRewrite.deletionDetails, r.RequestID)
+	if err := block.MarkForDeletion(ctx, userLogger, userBucket, blockID, details, c.seriesRewrite.blocksMarkedForDeletion); err != nil {
+		return nil, true, errors.Wrapf(err, "mark block %s for deletion", blockID)
+	}
+
+	level.Info(userLogger).Log("msg", "rewrote series of block", "block", blockID, "rewritten_block", newID)
+	return newMeta, true, nil
+}
+
+// relabelChangesSeries returns whether the relabel configs change or drop at least one series in the index at the input path.
+func relabelChangesSeries(indexPath string, cfgs []*relabel.Config) (_ bool, returnErr error) {
+	r, err := index.NewFileReader(indexPath)
+	if err != nil {
+		return false, errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, r, "close index reader")
+
+	p, err := r.Postings(index.AllPostingsKey())
+	if err != nil {
+		return false, errors.Wrap(err, "read postings")
+	}
+
+	var (
+		builder labels.ScratchBuilder
+		chks    []chunks.Meta
+	)
+
+	for p.Next() {
+		if err := r.Series(p.At(), &builder, &chks); err != nil {
+			return false, errors.Wrap(err, "read series")
+		}
+
+		lset := builder.Labels()
+		if relabelled, keep := relabel.Process(lset, cfgs...); !keep || !labels.Equal(lset, relabelled) {
+			return true, nil
+		}
+	}
+
+	return false, errors.Wrap(p.Err(), "iterate postings")
+}
+
+// relabelledSeries is a series of the original block with its relabelled labels.
+type relabelledSeries struct {
+	lset labels.Labels
+	chks []chunks.Meta
+}
+
+// relabelBlock writes to outDir a copy of the block stored in blockDir, applying the relabel configs to its series.
+// The series whose labels are the same after relabelling are merged. The compaction level, sources and external
+// labels of the original block are preserved. Returns a zero ULID if all the series have been dropped.
+func relabelBlock(ctx context.Context, logger log.Logger, blockDir, outDir string, meta *block.Meta, cfgs []*relabel.Config) (_ ulid.ULID, returnErr error) {
+	b, err := tsdb.OpenBlock(logger, blockDir, nil)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "open block")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, b, "close block")
+
+	indexr, err := b.Index()
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, indexr, "close index reader")
+
+	chunkr, err := b.Chunks()
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "open chunks")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, chunkr, "close chunk reader")
+
+	postings, err := indexr.Postings(index.AllPostingsKey())
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "read postings")
+	}
+
+	// Relabel all the series first, because the index requires the series to be written sorted by their labels.
+	var (
+		series  []relabelledSeries
+		symbols = map[string]struct{}{}
+		builder labels.ScratchBuilder
+		chks    []chunks.Meta
+	)
+
+	for postings.Next() {
+		if err := ctx.Err(); err != nil {
+			return ulid.ULID{}, err
+		}
+
+		if err := indexr.Series(postings.At(), &builder, &chks); err != nil {
+			return ulid.ULID{}, errors.Wrap(err, "read series")
+		}
+
+		lset, keep := relabel.Process(builder.Labels(), cfgs...)
+		if !keep || lset.IsEmpty() {
+			continue
+		}
+
+		lset.Range(func(l labels.Label) {
+			symbols[l.Name] = struct{}{}
+			symbols[l.Value] = struct{}{}
+		})
+		series = append(series, relabelledSeries{lset: lset, chks: append([]chunks.Meta(nil), chks...)})
+	}
+	if err := postings.Err(); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "iterate postings")
+	}
+
+	if len(series) == 0 {
+		return ulid.ULID{}, nil
+	}
+
+	sort.SliceStable(series, func(i, j int) bool {
+		return labels.Compare(series[i].lset, series[j].lset) < 0
+	})
+
+	w, err := newRelabelledBlockWriter(ctx, outDir, symbols)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+	defer w.closeOnError(logger)
+
+	merge := storage.NewCompactingChunkSeriesMerger(storage.ChainedSeriesMerge)
+
+	for start := 0; start < len(series); {
+		if err := ctx.Err(); err != nil {
+			return ulid.ULID{}, err
+		}
+
+		end := start + 1
+		for end < len(series) && labels.Equal(series[start].lset, series[end].lset) {
+			end++
+		}
+
+		group := make([]storage.ChunkSeries, 0, end-start)
+		for _, s := range series[start:end] {
+			for i := range s.chks {
+				if s.chks[i].Chunk, err = chunkr.Chunk(s.chks[i]); err != nil {
+					return ulid.ULID{}, errors.Wrapf(err, "read chunk %d", s.chks[i].Ref)
+				}
+			}
+			group = append(group, &storage.ChunkSeriesEntry{
+				Lset:            s.lset,
+				ChunkIteratorFn: listChunksIteratorFn(s.chks),
+			})
+		}
+
+		// The chunks of a series relabelled to the labels of other series are merged with theirs.
+		var out []chunks.Meta
+		if len(group) == 1 {
+			out = series[start].chks
+		} else {
+			it := merge(group...).Iterator(nil)
+			for it.Next() {
+				out = append(out, it.At())
+			}
+			if err := it.Err(); err != nil {
+				return ulid.ULID{}, errors.Wrapf(err, "merge chunks of series %s", series[start].lset)
+			}
+		}
+
+		if err := w.addSeries(series[start].lset, out); err != nil {
+			return ulid.ULID{}, err
+		}
+
+		// Release the chunks, which are not needed anymore.
+		for _, s := range series[start:end] {
+			for i := range s.chks {
+				s.chks[i].Chunk = nil
+			}
+		}
+		start = end
+	}
+
+	return w.finish(logger, meta)
+}
+
+func listChunksIteratorFn(chks []chunks.Meta) func(chunks.Iterator) chunks.Iterator {
+	return func(chunks.Iterator) chunks.Iterator {
+		return storage.NewListChunkSeriesIterator(chks...)
+	}
+}
+
+// relabelledBlockWriter writes the relabelled series to a new block, in the order they're added.
+type relabelledBlockWriter struct {
+	id  ulid.ULID
+	dir string
+
+	chunks *chunks.Writer
+	index  *index.Writer
+	closed bool
+
+	nextRef storage.SeriesRef
+	stats   tsdb.BlockStats
+}
+
+func newRelabelledBlockWriter(ctx context.Context, outDir string, symbols map[string]struct{}) (*relabelledBlockWriter, error) {
+	id := ulid.MustNew(ulid.Now(), rand.Reader)
+	dir := filepath.Join(outDir, id.String())
+
+	chunkw, err := chunks.NewWriter(filepath.Join(dir, block.ChunksDirname))
+	if err != nil {
+		return nil, errors.Wrap(err, "create chunks writer")
+	}
+
+	indexw, err := index.NewWriter(ctx, filepath.Join(dir, block.IndexFilename))
+	if err != nil {
+		_ = chunkw.Close()
+		return nil, errors.Wrap(err, "create index writer")
+	}
+
+	w := &relabelledBlockWriter{id: id, dir: dir, chunks: chunkw, index: indexw}
+
+	sorted := make([]string, 0, len(symbols))
+	for s := range symbols {
+		sorted = append(sorted, s)
+	}
+	sort.Strings(sorted)
+
+	for _, s := range sorted {
+		if err := indexw.AddSymbol(s); err != nil {
+			w.closeOnError(log.NewNopLogger())
+			return nil, errors.Wrap(err, "add symbol")
+		}
+	}
+
+	return w, nil
+}
+
+func (w *relabelledBlockWriter) addSeries(lset labels.Labels, chks []chunks.Meta) error {
+	if len(chks) == 0 {
+		return nil
+	}
+
+	if err := w.chunks.WriteChunks(chks...); err != nil {
+		return errors.Wrap(err, "write chunks")
+	}
+	if err := w.index.AddSeries(w.nextRef, lset, chks...); err != nil {
+		return errors.Wrap(err, "add series")
+	}
+	w.nextRef++
+
+	w.stats.NumSeries++
+	w.stats.NumChunks += uint64(len(chks))
+	for _, c := range chks {
+		w.stats.NumSamples += uint64(c.Chunk.NumSamples())
+	}
+	return nil
+}
+
+// finish closes the block and writes its meta.json. The block is removed if it has no series,
+// in which case a zero ULID is returned.
+func (w *relabelledBlockWriter) finish(logger log.Logger, original *block.Meta) (ulid.ULID, error) {
+	w.closed = true
+	if err := w.chunks.Close(); err != nil {
+		_ = w.index.Close()
+		return ulid.ULID{}, errors.Wrap(err, "close chunks writer")
+	}
+	if err := w.index.Close(); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "close index writer")
+	}
+
+	if w.stats.NumSeries == 0 {
+		return ulid.ULID{}, errors.Wrap(os.RemoveAll(w.dir), "remove empty block")
+	}
+
+	// We want to preserve the compaction level and sources, so that the rewritten block
+	// is compacted like the original one would have been.
+	compaction := original.Compaction
+	compaction.Parents = []tsdb.BlockDesc{{ULID: original.ULID, MinTime: original.MinTime, MaxTime: original.MaxTime}}
+
+	meta := block.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:       w.id,
+			MinTime:    original.MinTime,
+			MaxTime:    original.MaxTime,
+			Stats:      w.stats,
+			Compaction: compaction,
+			Version:    block.TSDBVersion1,
+		},
+		Thanos: block.ThanosMeta{
+			Version:      block.ThanosVersion1,
+			Labels:       original.Thanos.Labels,
+			Downsample:   original.Thanos.Downsample,
+			Source:       block.CompactorRewriteSource,
+			SegmentFiles: block.GetSegmentFiles(w.dir),
+		},
+	}
+	if err := meta.WriteToDir(logger, w.dir); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write meta")
+	}
+
+	if err := block.VerifyBlock(logger, w.dir, meta.MinTime, meta.MaxTime, false); err != nil {
+		return ulid.ULID{}, errors.Wrapf(err, "invalid rewritten block %s", w.dir)
+	}
+	return w.id, nil
+}
+
+func (w *relabelledBlockWriter) closeOnError(logger log.Logger) {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	runutil.CloseWithLogOnErr(logger, w.chunks, "close chunks writer")
+	runutil.CloseWithLogOnErr(logger, w.index, "close index writer")
+}
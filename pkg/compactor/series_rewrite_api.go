@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+// CreateSeriesRewriteRequest creates a tenant-scoped request to apply the Prometheus relabel configs, passed
+// as YAML in the relabel_configs parameter, to the series of the blocks overlapping the start and end time range.
+// The compactor rewrites the blocks in the next cleanup runs, and marks the original blocks for deletion.
+func (c *MultitenantCompactor) CreateSeriesRewriteRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	startTime := int64(math.MinInt64)
+	if v := r.Form.Get("start"); v != "" {
+		if startTime, err = util.ParseTime(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid start time: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	endTime := util.TimeToMillis(time.Now())
+	if v := r.Form.Get("end"); v != "" {
+		if endTime, err = util.ParseTime(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid end time: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	req, err := newSeriesRewriteRequest(r.Form.Get("relabel_configs"), startTime, endTime, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userBucket := bucket.NewUserBucketClient(userID, c.bucketClient, c.cfgProvider)
+
+	// Creating the same request twice is idempotent, and we don't want to reset the state
+	// of a request which already exists.
+	existing, err := readSeriesRewriteRequest(ctx, userBucket, seriesRewriteRequestPath(req.RequestID), c.logger)
+	if err != nil && !errors.Is(err, errSeriesRewriteRequestNotFound) {
+		level.Error(c.logger).Log("msg", "failed to read series rewrite request", "user", userID, "request_id", req.RequestID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		util.WriteJSONResponse(w, existing)
+		return
+	}
+
+	if err := writeSeriesRewriteRequest(ctx, userBucket, req); err != nil {
+		level.Error(c.logger).Log("msg", "failed to write series rewrite request", "user", userID, "request_id", req.RequestID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	level.Info(c.logger).Log("msg", "series rewrite request created", "user", userID, "request", req.String())
+
+	util.WriteJSONResponse(w, req)
+}
+
+// ListSeriesRewriteRequests lists the tenant's series rewrite requests, both pending and processed.
+func (c *MultitenantCompactor) ListSeriesRewriteRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	requests, err := listSeriesRewriteRequests(ctx, bucket.NewUserBucketClient(userID, c.bucketClient, c.cfgProvider), c.logger)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to list series rewrite requests", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].CreatedAt != requests[j].CreatedAt {
+			return requests[i].CreatedAt < requests[j].CreatedAt
+		}
+		return requests[i].RequestID < requests[j].RequestID
+	})
+
+	util.WriteJSONResponse(w, requests)
+}
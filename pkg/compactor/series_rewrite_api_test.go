@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestSeriesRewriteAPI(t *testing.T) {
+	const userID = "user-1"
+
+	bkt := objstore.NewInMemBucket()
+	c, _, _, _, _ := prepare(t, prepareConfig(t), bkt)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	t.Cleanup(stopServiceFn(t, c))
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+
+	newRequest := func(method string, form url.Values) *http.Request {
+		req := httptest.NewRequest(method, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req.WithContext(ctx)
+	}
+
+	create := func(form url.Values) (*httptest.ResponseRecorder, *seriesRewriteRequest) {
+		resp := httptest.NewRecorder()
+		c.CreateSeriesRewriteRequest(resp, newRequest(http.MethodPost, form))
+		if resp.Code != http.StatusOK {
+			return resp, nil
+		}
+
+		req := &seriesRewriteRequest{}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), req))
+		return resp, req
+	}
+
+	list := func() []*seriesRewriteRequest {
+		resp := httptest.NewRecorder()
+		c.ListSeriesRewriteRequests(resp, newRequest(http.MethodGet, nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var requests []*seriesRewriteRequest
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &requests))
+		return requests
+	}
+
+	const relabelConfigs = `
+- source_labels: [job]
+  regex: wrong
+  target_label: job
+  replacement: right
+`
+
+	t.Run("should fail without tenant ID", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		c.CreateSeriesRewriteRequest(resp, httptest.NewRequest(http.MethodPost, "/", nil))
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	})
+
+	t.Run("should fail on invalid input", func(t *testing.T) {
+		resp, _ := create(url.Values{})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp, _ = create(url.Values{"relabel_configs": []string{"- action: invalid"}})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp, _ = create(url.Values{"relabel_configs": []string{relabelConfigs}, "start": []string{"invalid"}})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp, _ = create(url.Values{"relabel_configs": []string{relabelConfigs}, "start": []string{"20"}, "end": []string{"10"}})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		assert.Empty(t, list())
+	})
+
+	t.Run("should create and list requests", func(t *testing.T) {
+		resp, first := create(url.Values{"relabel_configs": []string{relabelConfigs}, "start": []string{"10"}, "end": []string{"20"}})
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, int64(10000), first.StartTime)
+		assert.Equal(t, int64(20000), first.EndTime)
+		assert.Equal(t, seriesRewritePending, first.State)
+
+		// Creating the same request again should return the existing one.
+		resp, again := create(url.Values{"relabel_configs": []string{relabelConfigs}, "start": []string{"10"}, "end": []string{"20"}})
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, first, again)
+
+		resp, second := create(url.Values{"relabel_configs": []string{"- regex: pod\n  action: labeldrop"}})
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.NotEqual(t, first.RequestID, second.RequestID)
+
+		assert.ElementsMatch(t, []*seriesRewriteRequest{first, second}, list())
+	})
+}
@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	mimir_testutil "github.com/grafana/mimir/pkg/storage/tsdb/testutil"
+	"github.com/grafana/mimir/pkg/util/test"
+)
+
+func TestNewSeriesRewriteRequest(t *testing.T) {
+	now := time.Now()
+
+	first, err := newSeriesRewriteRequest("- source_labels: [job]\n  regex: wrong\n  target_label: job\n  replacement: right", 10, 20, now)
+	require.NoError(t, err)
+	assert.Equal(t, seriesRewritePending, first.State)
+
+	cfgs, err := first.Relabel()
+	require.NoError(t, err)
+	require.Len(t, cfgs, 1)
+	assert.Equal(t, "right", cfgs[0].Replacement)
+
+	// The request ID doesn't depend on how the relabel configs are formatted.
+	again, err := newSeriesRewriteRequest("- {target_label: job, source_labels: [\"job\"], replacement: right, regex: wrong, action: replace}", 10, 20, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, first.RequestID, again.RequestID)
+
+	other, err := newSeriesRewriteRequest("- source_labels: [job]\n  regex: wrong\n  target_label: job\n  replacement: right", 10, 30, now)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RequestID, other.RequestID)
+
+	for name, relabelConfigs := range map[string]string{
+		"empty":          "",
+		"empty list":     "[]",
+		"null config":    "- null",
+		"unknown field":  "- unknown: field",
+		"invalid action": "- action: invalid",
+		"invalid regex":  "- regex: '('",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := newSeriesRewriteRequest(relabelConfigs, 10, 20, now)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = newSeriesRewriteRequest("- regex: pod\n  action: labeldrop", 20, 10, now)
+	assert.ErrorIs(t, err, errSeriesRewriteInvalidTimeRange)
+}
+
+func TestBlocksCleaner_ShouldRewriteSeries(t *testing.T) {
+	const userID = "user-1"
+
+	bucketClient, _ := mimir_testutil.PrepareFilesystemBucket(t)
+	bucketClient = block.BucketWithGlobalMarkers(bucketClient)
+	userBucket := bucket.NewUserBucketClient(userID, bucketClient, nil)
+
+	now := time.Now()
+	ts := func(hours int) int64 {
+		return now.Add(time.Duration(hours)*time.Hour).Unix() * 1000
+	}
+
+	// Each block has 3 series with a sample each: series_id="0", series_id="1" and series_id="2".
+	block1 := createTSDBBlock(t, bucketClient, userID, ts(-10), ts(-8), 3, map[string]string{"ext": "label"})
+	block2 := createTSDBBlock(t, bucketClient, userID, ts(-8), ts(-6), 3, nil)
+	block3 := createTSDBBlock(t, bucketClient, userID, ts(-6), ts(-4), 3, nil)
+
+	ctx := context.Background()
+
+	// Rename series_id="0" to series_id="1" in block1, merging the two series.
+	merge, err := newSeriesRewriteRequest("- source_labels: [series_id]\n  regex: '0'\n  target_label: series_id\n  replacement: '1'", ts(-10), ts(-9), now)
+	require.NoError(t, err)
+	require.NoError(t, writeSeriesRewriteRequest(ctx, userBucket, merge))
+
+	// Drop all series of block3.
+	drop, err := newSeriesRewriteRequest("- action: drop\n  source_labels: [series_id]\n  regex: '.+'", ts(-5), ts(-5), now.Add(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, writeSeriesRewriteRequest(ctx, userBucket, drop))
+
+	// This request doesn't change any series.
+	noop, err := newSeriesRewriteRequest("- source_labels: [series_id]\n  regex: '10'\n  action: drop", ts(-8), ts(-7), now.Add(2*time.Second))
+	require.NoError(t, err)
+	require.NoError(t, writeSeriesRewriteRequest(ctx, userBucket, noop))
+
+	cfg := BlocksCleanerConfig{
+		DeletionDelay:           time.Hour,
+		CleanupInterval:         time.Minute,
+		CleanupConcurrency:      1,
+		DeleteBlocksConcurrency: 1,
+		DataDir:                 t.TempDir(),
+	}
+
+	logger := test.NewTestingLogger(t)
+	reg := prometheus.NewPedanticRegistry()
+	cleaner := NewBlocksCleaner(cfg, bucketClient, nil, tsdb.AllUsers, newMockConfigProvider(), logger, reg)
+
+	readRequest := func(id string) *seriesRewriteRequest {
+		r, err := readSeriesRewriteRequest(ctx, userBucket, seriesRewriteRequestPath(id), logger)
+		require.NoError(t, err)
+		return r
+	}
+
+	// The first run should rewrite block1 and block3, and publish the rewritten block
+	// together with the deletion marks of the original blocks in the bucket index.
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	checkBlock(t, userID, bucketClient, block1, true, true)
+	checkBlock(t, userID, bucketClient, block2, true, false)
+	checkBlock(t, userID, bucketClient, block3, true, true)
+
+	pending := readRequest(merge.RequestID)
+	assert.Equal(t, seriesRewritePending, pending.State)
+	require.Len(t, pending.RewrittenBlocks, 1)
+	rewritten := pending.RewrittenBlocks[0]
+
+	assert.Equal(t, seriesRewritePending, readRequest(drop.RequestID).State)
+	assert.Empty(t, readRequest(drop.RequestID).RewrittenBlocks)
+	assert.Equal(t, seriesRewriteProcessed, readRequest(noop.RequestID).State)
+
+	idx, err := bucketindex.ReadIndex(ctx, bucketClient, userID, nil, logger)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []ulid.ULID{block1, block2, block3, rewritten}, idx.Blocks.GetULIDs())
+	assert.ElementsMatch(t, []ulid.ULID{block1, block3}, idx.BlockDeletionMarks.GetULIDs())
+
+	originalMeta, err := block.DownloadMeta(ctx, logger, userBucket, block1)
+	require.NoError(t, err)
+	rewrittenMeta, err := block.DownloadMeta(ctx, logger, userBucket, rewritten)
+	require.NoError(t, err)
+
+	assert.Equal(t, originalMeta.MinTime, rewrittenMeta.MinTime)
+	assert.Equal(t, originalMeta.MaxTime, rewrittenMeta.MaxTime)
+	assert.Equal(t, originalMeta.Compaction.Level, rewrittenMeta.Compaction.Level)
+	assert.Equal(t, originalMeta.Compaction.Sources, rewrittenMeta.Compaction.Sources)
+	assert.Equal(t, block1, rewrittenMeta.Compaction.Parents[0].ULID)
+	assert.Equal(t, originalMeta.Thanos.Labels, rewrittenMeta.Thanos.Labels)
+	assert.Equal(t, block.CompactorRewriteSource, rewrittenMeta.Thanos.Source)
+	assert.Equal(t, uint64(2), rewrittenMeta.Stats.NumSeries)
+	assert.Equal(t, uint64(3), rewrittenMeta.Stats.NumSamples)
+	assert.Equal(t, []string{"1", "2"}, readBlockLabelValues(t, userBucket, rewritten, "series_id"))
+
+	// The second run should find no more series to rewrite, and mark the requests as processed.
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	checkBlock(t, userID, bucketClient, rewritten, true, false)
+	assert.Equal(t, seriesRewriteProcessed, readRequest(merge.RequestID).State)
+	assert.Equal(t, seriesRewriteProcessed, readRequest(drop.RequestID).State)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_compactor_blocks_marked_for_deletion_total Total number of blocks marked for deletion in compactor.
+		# TYPE cortex_compactor_blocks_marked_for_deletion_total counter
+		cortex_compactor_blocks_marked_for_deletion_total{reason="partial"} 0
+		cortex_compactor_blocks_marked_for_deletion_total{reason="retention"} 0
+		cortex_compactor_blocks_marked_for_deletion_total{reason="retention-rules"} 0
+		cortex_compactor_blocks_marked_for_deletion_total{reason="series-deletion"} 0
+		cortex_compactor_blocks_marked_for_deletion_total{reason="series-rewrite"} 2
+		# HELP cortex_compactor_series_rewrite_blocks_rewritten_total Total number of blocks rewritten to apply the relabel configs of series rewrite requests.
+		# TYPE cortex_compactor_series_rewrite_blocks_rewritten_total counter
+		cortex_compactor_series_rewrite_blocks_rewritten_total 1
+		# HELP cortex_compactor_series_rewrite_requests_processed_total Total number of series rewrite requests whose series have been rewritten in all blocks.
+		# TYPE cortex_compactor_series_rewrite_requests_processed_total counter
+		cortex_compactor_series_rewrite_requests_processed_total 3
+		`),
+		"cortex_compactor_blocks_marked_for_deletion_total",
+		"cortex_compactor_series_rewrite_blocks_rewritten_total",
+		"cortex_compactor_series_rewrite_requests_processed_total",
+	))
+}
+
+func readBlockLabelValues(t *testing.T, userBucket objstore.Bucket, id ulid.ULID, name string) []string {
+	indexPath := filepath.Join(t.TempDir(), block.IndexFilename)
+	require.NoError(t, objstore.DownloadFile(context.Background(), test.NewTestingLogger(t), userBucket, id.String()+"/"+block.IndexFilename, indexPath))
+
+	r, err := index.NewFileReader(indexPath)
+	require.NoError(t, err)
+	defer r.Close()
+
+	values, err := r.LabelValues(name)
+	require.NoError(t, err)
+
+	// The values reference the index memory, which is unmapped once the reader is closed.
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, strings.Clone(v))
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package costattribution
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grafana/dskit/services"
+)
+
+// Limits contains the per-tenant cost attribution limits.
+type Limits interface {
+	CostAttributionLabel(userID string) string
+	MaxCostAttributionCardinalityPerUser(userID string) int
+}
+
+// Manager holds the cost attribution trackers of all tenants, and periodically stops
+// tracking the attributions which have been inactive for longer than the inactive timeout.
+// The registered cleanup functions are called for each attribution which is not tracked anymore.
+type Manager struct {
+	services.Service
+
+	limits          Limits
+	inactiveTimeout time.Duration
+	cleanupFuncs    []func(userID, attribution string)
+
+	mu       sync.RWMutex
+	trackers map[string]*Tracker
+}
+
+func NewManager(cleanupInterval, inactiveTimeout time.Duration, limits Limits, cleanupFns ...func(userID, attribution string)) *Manager {
+	m := &Manager{
+		limits:          limits,
+		inactiveTimeout: inactiveTimeout,
+		cleanupFuncs:    cleanupFns,
+		trackers:        map[string]*Tracker{},
+	}
+
+	m.Service = services.NewTimerService(cleanupInterval, nil, m.iteration, nil).WithName("cost attribution cleanup")
+	return m
+}
+
+// TrackerForUser returns the tracker of the input user, or nil if cost attribution is disabled for the user.
+// If the cost attribution limits of the user have changed, the previous tracker is replaced
+// and its attributions are cleaned up.
+func (m *Manager) TrackerForUser(userID string) *Tracker {
+	label := m.limits.CostAttributionLabel(userID)
+	maxCardinality := m.limits.MaxCostAttributionCardinalityPerUser(userID)
+
+	m.mu.RLock()
+	t := m.trackers[userID]
+	m.mu.RUnlock()
+
+	if t != nil && t.Label() == label && t.MaxCardinality() == maxCardinality {
+		return t
+	}
+	if t == nil && label == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	t = m.trackers[userID]
+	if t != nil && t.Label() == label && t.MaxCardinality() == maxCardinality {
+		m.mu.Unlock()
+		return t
+	}
+
+	var replaced []string
+	if t != nil {
+		replaced = t.Attributions()
+	}
+
+	if label == "" {
+		delete(m.trackers, userID)
+		t = nil
+	} else {
+		t = NewTracker(label, maxCardinality)
+		m.trackers[userID] = t
+	}
+	m.mu.Unlock()
+
+	m.cleanup(userID, replaced)
+	return t
+}
+
+func (m *Manager) iteration(_ context.Context) error {
+	m.mu.RLock()
+	userIDs := make([]string, 0, len(m.trackers))
+	for userID := range m.trackers {
+		userIDs = append(userIDs, userID)
+	}
+	m.mu.RUnlock()
+
+	keepUntil := time.Now().Add(-m.inactiveTimeout)
+	for _, userID := range userIDs {
+		// Getting the tracker through TrackerForUser() ensures the trackers of the users whose
+		// cost attribution has been disabled are removed.
+		t := m.TrackerForUser(userID)
+		m.cleanup(userID, t.Purge(keepUntil))
+	}
+	return nil
+}
+
+func (m *Manager) cleanup(userID string, attributions []string) {
+	for _, attribution := range attributions {
+		for _, cleanupFn := range m.cleanupFuncs {
+			cleanupFn(userID, attribution)
+		}
+	}
+}
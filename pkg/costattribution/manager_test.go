@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package costattribution
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLimits struct {
+	label          map[string]string
+	maxCardinality int
+}
+
+func (m *mockLimits) CostAttributionLabel(userID string) string {
+	return m.label[userID]
+}
+
+func (m *mockLimits) MaxCostAttributionCardinalityPerUser(string) int {
+	return m.maxCardinality
+}
+
+func TestManager(t *testing.T) {
+	limits := &mockLimits{label: map[string]string{"user-1": "team"}, maxCardinality: 10}
+
+	var cleanedUp []string
+	m := NewManager(time.Minute, time.Hour, limits, func(userID, attribution string) {
+		cleanedUp = append(cleanedUp, userID+"/"+attribution)
+	})
+
+	assert.Nil(t, m.TrackerForUser("user-2"))
+
+	tracker := m.TrackerForUser("user-1")
+	require.NotNil(t, tracker)
+	assert.Equal(t, "team", tracker.Label())
+	assert.Same(t, tracker, m.TrackerForUser("user-1"))
+
+	tracker.Attribution("a", time.Now())
+	tracker.Attribution("b", time.Now().Add(-2*time.Hour))
+
+	// The inactive attribution is cleaned up.
+	require.NoError(t, m.iteration(context.Background()))
+	assert.Equal(t, []string{"user-1/b"}, cleanedUp)
+	assert.Equal(t, []string{"a"}, tracker.Attributions())
+
+	// Changing the limits replaces the tracker, and cleans up the attributions of the previous one.
+	cleanedUp = nil
+	limits.maxCardinality = 5
+	newTracker := m.TrackerForUser("user-1")
+	assert.NotSame(t, tracker, newTracker)
+	assert.Equal(t, 5, newTracker.MaxCardinality())
+	assert.Equal(t, []string{"user-1/a"}, cleanedUp)
+
+	// Disabling the cost attribution removes the tracker.
+	cleanedUp = nil
+	newTracker.Attribution("c", time.Now())
+	limits.label = nil
+	require.NoError(t, m.iteration(context.Background()))
+	assert.Equal(t, []string{"user-1/c"}, cleanedUp)
+	assert.Nil(t, m.TrackerForUser("user-1"))
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package costattribution
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// OverflowValue is the attribution of the usage of the label values exceeding the max cardinality.
+const OverflowValue = "__overflow__"
+
+type trackedValue struct {
+	value    string
+	lastSeen *atomic.Int64 // Unix timestamp in nanoseconds.
+	samples  *atomic.Uint64
+}
+
+// Tracker tracks the values of the cost attribution label of a single tenant,
+// and bounds their cardinality by attributing the usage of additional values to OverflowValue.
+// A nil Tracker doesn't attribute any usage.
+type Tracker struct {
+	label          string
+	maxCardinality int
+
+	mu              sync.RWMutex
+	values          map[string]*trackedValue
+	overflow        *atomic.Int64 // Unix timestamp in nanoseconds when the overflow value was last seen, 0 if never.
+	overflowSamples *atomic.Uint64
+}
+
+func NewTracker(label string, maxCardinality int) *Tracker {
+	return &Tracker{
+		label:           label,
+		maxCardinality:  maxCardinality,
+		values:          map[string]*trackedValue{},
+		overflow:        atomic.NewInt64(0),
+		overflowSamples: atomic.NewUint64(0),
+	}
+}
+
+// Label returns the name of the cost attribution label.
+func (t *Tracker) Label() string {
+	if t == nil {
+		return ""
+	}
+	return t.label
+}
+
+// MaxCardinality returns the maximum number of label values tracked.
+func (t *Tracker) MaxCardinality() int {
+	if t == nil {
+		return 0
+	}
+	return t.maxCardinality
+}
+
+// Attribution returns the attribution of the usage of the input label value, and marks it as seen at now.
+// The returned string is not a reference to the input value, so it's safe to retain it.
+// An empty value is not attributed, and an empty string is returned.
+func (t *Tracker) Attribution(value string, now time.Time) string {
+	if t == nil || value == "" {
+		return ""
+	}
+
+	nowNanos := now.UnixNano()
+
+	t.mu.RLock()
+	tv := t.values[value]
+	t.mu.RUnlock()
+
+	if tv != nil {
+		tv.lastSeen.Store(nowNanos)
+		return tv.value
+	}
+
+	if value == OverflowValue {
+		t.overflow.Store(nowNanos)
+		return OverflowValue
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Check again under the write lock, because the value may have been added in the meantime.
+	if tv := t.values[value]; tv != nil {
+		tv.lastSeen.Store(nowNanos)
+		return tv.value
+	}
+
+	if len(t.values) >= t.maxCardinality {
+		t.overflow.Store(nowNanos)
+		return OverflowValue
+	}
+
+	tv = &trackedValue{value: strings.Clone(value), lastSeen: atomic.NewInt64(nowNanos), samples: atomic.NewUint64(0)}
+	t.values[tv.value] = tv
+	return tv.value
+}
+
+// Touch marks the input attribution as seen at now, if it's tracked.
+func (t *Tracker) Touch(attribution string, now time.Time) {
+	if t == nil {
+		return
+	}
+
+	if attribution == OverflowValue {
+		t.overflow.Store(now.UnixNano())
+		return
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if tv := t.values[attribution]; tv != nil {
+		tv.lastSeen.Store(now.UnixNano())
+	}
+}
+
+// AddSamples adds the input number of samples to the samples counted for the input attribution, if it's tracked.
+func (t *Tracker) AddSamples(attribution string, samples int) {
+	if t == nil || attribution == "" || samples <= 0 {
+		return
+	}
+
+	if attribution == OverflowValue {
+		t.overflowSamples.Add(uint64(samples))
+		return
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if tv := t.values[attribution]; tv != nil {
+		tv.samples.Add(uint64(samples))
+	}
+}
+
+// Samples returns the number of samples counted for each tracked attribution since it's tracked,
+// including OverflowValue if it has been seen.
+func (t *Tracker) Samples() map[string]uint64 {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	samples := make(map[string]uint64, len(t.values)+1)
+	for value, tv := range t.values {
+		samples[value] = tv.samples.Load()
+	}
+	if t.overflow.Load() > 0 {
+		samples[OverflowValue] = t.overflowSamples.Load()
+	}
+	return samples
+}
+
+// Purge stops tracking the attributions which haven't been seen since keepUntil, and returns them.
+func (t *Tracker) Purge(keepUntil time.Time) []string {
+	if t == nil {
+		return nil
+	}
+
+	keepUntilNanos := keepUntil.UnixNano()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var purged []string
+	for value, tv := range t.values {
+		if tv.lastSeen.Load() < keepUntilNanos {
+			delete(t.values, value)
+			purged = append(purged, value)
+		}
+	}
+
+	if ts := t.overflow.Load(); ts > 0 && ts < keepUntilNanos {
+		t.overflow.Store(0)
+		t.overflowSamples.Store(0)
+		purged = append(purged, OverflowValue)
+	}
+
+	return purged
+}
+
+// Attributions returns all the tracked attributions, including OverflowValue if it has been seen.
+func (t *Tracker) Attributions() []string {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	attributions := make([]string, 0, len(t.values)+1)
+	for value := range t.values {
+		attributions = append(attributions, value)
+	}
+	if t.overflow.Load() > 0 {
+		attributions = append(attributions, OverflowValue)
+	}
+	return attributions
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package costattribution
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker_Attribution(t *testing.T) {
+	now := time.Now()
+	tracker := NewTracker("team", 2)
+
+	assert.Equal(t, "", tracker.Attribution("", now))
+	assert.Equal(t, "a", tracker.Attribution("a", now))
+	assert.Equal(t, "b", tracker.Attribution("b", now))
+	assert.Equal(t, "a", tracker.Attribution("a", now))
+
+	// The max cardinality has been reached.
+	assert.Equal(t, OverflowValue, tracker.Attribution("c", now))
+	assert.ElementsMatch(t, []string{"a", "b", OverflowValue}, tracker.Attributions())
+}
+
+func TestTracker_Purge(t *testing.T) {
+	now := time.Now()
+	tracker := NewTracker("team", 2)
+
+	tracker.Attribution("a", now.Add(-2*time.Minute))
+	tracker.Attribution("b", now.Add(-2*time.Minute))
+	tracker.Attribution("c", now.Add(-2*time.Minute))
+	tracker.Touch("b", now)
+
+	assert.ElementsMatch(t, []string{"a", OverflowValue}, tracker.Purge(now.Add(-time.Minute)))
+	assert.Equal(t, []string{"b"}, tracker.Attributions())
+
+	// After the purge there's room for a new value.
+	assert.Equal(t, "c", tracker.Attribution("c", now))
+	assert.Empty(t, tracker.Purge(now.Add(-time.Minute)))
+}
+
+func TestTracker_Samples(t *testing.T) {
+	now := time.Now()
+	tracker := NewTracker("team", 1)
+
+	tracker.AddSamples(tracker.Attribution("a", now.Add(-2*time.Minute)), 3)
+	tracker.AddSamples(tracker.Attribution("b", now.Add(-2*time.Minute)), 2)
+	tracker.AddSamples(tracker.Attribution("c", now), 1)
+	tracker.AddSamples("a", 5)
+
+	// The samples of untracked attributions are not counted.
+	tracker.AddSamples("d", 10)
+
+	assert.Equal(t, map[string]uint64{"a": 8, OverflowValue: 3}, tracker.Samples())
+
+	// The samples of purged attributions are reset.
+	tracker.Touch(OverflowValue, now)
+	assert.Equal(t, []string{"a"}, tracker.Purge(now.Add(-time.Minute)))
+	assert.Equal(t, "d", tracker.Attribution("d", now))
+	assert.Equal(t, map[string]uint64{"d": 0, OverflowValue: 3}, tracker.Samples())
+}
+
+func TestTracker_Nil(t *testing.T) {
+	var tracker *Tracker
+
+	assert.Equal(t, "", tracker.Label())
+	assert.Equal(t, 0, tracker.MaxCardinality())
+	assert.Equal(t, "", tracker.Attribution("a", time.Now()))
+	assert.Empty(t, tracker.Purge(time.Now()))
+	assert.Empty(t, tracker.Attributions())
+	assert.Empty(t, tracker.Samples())
+}
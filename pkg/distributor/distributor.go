@@ -40,6 +40,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/grafana/mimir/pkg/cardinality"
+	"github.com/grafana/mimir/pkg/costattribution"
 	ingester_client "github.com/grafana/mimir/pkg/ingester/client"
 	"github.com/grafana/mimir/pkg/mimirpb"
 	"github.com/grafana/mimir/pkg/util"
@@ -112,6 +113,8 @@ type Distributor struct {
 	activeUsers  *util.ActiveUsersCleanupService
 	activeGroups *util.ActiveGroupsCleanupService
 
+	costAttribution *costattribution.Manager
+
 	ingestionRate             *util_math.EwmaRate
 	inflightPushRequests      atomic.Int64
 	inflightPushRequestsBytes atomic.Int64
@@ -132,6 +135,8 @@ type Distributor struct {
 	sampleDelayHistogram             prometheus.Histogram
 	replicationFactor                prometheus.Gauge
 	latestSeenSampleTimestampPerUser *prometheus.GaugeVec
+	receivedAttributedSamples        *prometheus.CounterVec
+	discardedAttributedSamples       *prometheus.CounterVec
 
 	// Metrics for data rejected for hitting per-tenant limits
 	discardedSamplesTooManyHaClusters *prometheus.CounterVec
@@ -218,6 +223,10 @@ func (cfg *Config) Validate(limits validation.Limits) error {
 }
 
 const (
+	// costAttributionInactiveTimeout is the time after which the metrics of a cost attribution
+	// which hasn't received any sample are removed.
+	costAttributionInactiveTimeout = 20 * time.Minute
+
 	instanceLimitsMetric     = "cortex_distributor_instance_limits"
 	instanceLimitsMetricHelp = "Instance limits used by this distributor." // Must be same for all registrations.
 	limitLabel               = "limit"
@@ -328,6 +337,14 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 			Name: "cortex_distributor_latest_seen_sample_timestamp_seconds",
 			Help: "Unix timestamp of latest received sample per user.",
 		}, []string{"user"}),
+		receivedAttributedSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_received_attributed_samples_total",
+			Help: "The total number of received samples per value of the cost attribution label, excluding rejected and deduped samples.",
+		}, []string{"user", "attribution"}),
+		discardedAttributedSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_discarded_attributed_samples_total",
+			Help: "The total number of samples discarded by the distributor validation and rate limiting per value of the cost attribution label.",
+		}, []string{"user", "attribution"}),
 
 		discardedSamplesTooManyHaClusters: validation.DiscardedSamplesCounter(reg, validation.ReasonTooManyHAClusters),
 		discardedSamplesRateLimited:       validation.DiscardedSamplesCounter(reg, validation.ReasonRateLimited),
@@ -423,10 +440,11 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 	d.replicationFactor.Set(float64(ingestersRing.ReplicationFactor()))
 	d.activeUsers = util.NewActiveUsersCleanupWithDefaultValues(d.cleanupInactiveUser)
 	d.activeGroups = activeGroupsCleanupService
+	d.costAttribution = costattribution.NewManager(3*time.Minute, costAttributionInactiveTimeout, limits, d.removeAttributionMetricsForUser)
 
 	d.PushWithMiddlewares = d.wrapPushWithMiddlewares(d.push)
 
-	subservices = append(subservices, d.ingesterPool, d.activeUsers)
+	subservices = append(subservices, d.ingesterPool, d.activeUsers, d.costAttribution)
 	d.subservices, err = services.NewManager(subservices...)
 	if err != nil {
 		return nil, err
@@ -523,6 +541,8 @@ func (d *Distributor) cleanupInactiveUser(userID string) {
 	d.latestSeenSampleTimestampPerUser.DeleteLabelValues(userID)
 
 	filter := prometheus.Labels{"user": userID}
+	d.receivedAttributedSamples.DeletePartialMatch(filter)
+	d.discardedAttributedSamples.DeletePartialMatch(filter)
 	d.dedupedSamples.DeletePartialMatch(filter)
 	d.discardedSamplesTooManyHaClusters.DeletePartialMatch(filter)
 	d.discardedSamplesRateLimited.DeletePartialMatch(filter)
@@ -542,41 +562,22 @@ func (d *Distributor) RemoveGroupMetricsForUser(userID, group string) {
 	d.sampleValidationMetrics.DeleteUserMetricsForGroup(userID, group)
 }
 
+func (d *Distributor) removeAttributionMetricsForUser(userID, attribution string) {
+	d.receivedAttributedSamples.DeleteLabelValues(userID, attribution)
+	d.discardedAttributedSamples.DeleteLabelValues(userID, attribution)
+}
+
 // Called after distributor is asked to stop via StopAsync.
 func (d *Distributor) stopping(_ error) error {
 	return services.StopManagerAndAwaitStopped(context.Background(), d.subservices)
 }
 
 func (d *Distributor) tokenForLabels(userID string, labels []mimirpb.LabelAdapter) uint32 {
-	return shardByAllLabels(userID, labels)
+	return ingester_client.ShardByAllLabelAdapters(userID, labels)
 }
 
 func (d *Distributor) tokenForMetadata(userID string, metricName string) uint32 {
-	return shardByMetricName(userID, metricName)
-}
-
-// shardByMetricName returns the token for the given metric. The provided metricName
-// is guaranteed to not be retained.
-func shardByMetricName(userID string, metricName string) uint32 {
-	h := shardByUser(userID)
-	h = ingester_client.HashAdd32(h, metricName)
-	return h
-}
-
-func shardByUser(userID string) uint32 {
-	h := ingester_client.HashNew32()
-	h = ingester_client.HashAdd32(h, userID)
-	return h
-}
-
-// This function generates different values for different order of same labels.
-func shardByAllLabels(userID string, labels []mimirpb.LabelAdapter) uint32 {
-	h := shardByUser(userID)
-	for _, label := range labels {
-		h = ingester_client.HashAdd32(h, label.Name)
-		h = ingester_client.HashAdd32(h, label.Value)
-	}
-	return h
+	return ingester_client.ShardByMetricName(userID, metricName)
 }
 
 // Returns a boolean that indicates whether or not we want to remove the replica label going forward,
@@ -853,6 +854,14 @@ func (d *Distributor) prePushValidationMiddleware(next push.Func) push.Func {
 
 		group := d.activeGroups.UpdateActiveGroupTimestamp(userID, validation.GroupLabel(d.limits, userID, req.Timeseries), now)
 
+		// Samples are counted by the value of the cost attribution label, if enabled for the tenant.
+		costAttribution := d.costAttribution.TrackerForUser(userID)
+		var validatedAttributedSamples, discardedAttributedSamples map[string]int
+		if costAttribution != nil {
+			validatedAttributedSamples = map[string]int{}
+			discardedAttributedSamples = map[string]int{}
+		}
+
 		// A WriteRequest can only contain series or metadata but not both. This might change in the future.
 		validatedMetadata := 0
 		validatedSamples := 0
@@ -896,6 +905,13 @@ func (d *Distributor) prePushValidationMiddleware(next push.Func) push.Func {
 
 			d.labelsHistogram.Observe(float64(len(ts.Labels)))
 
+			// The label value is read before the validation, because validateSeries may drop some data in ts.
+			// It's not retained after the request, so it's not cloned.
+			var costAttributionValue string
+			if costAttribution != nil {
+				costAttributionValue = labelValue(ts.Labels, costAttribution.Label())
+			}
+
 			skipLabelNameValidation := d.cfg.SkipLabelNameValidation || req.GetSkipLabelNameValidation()
 			// Note that validateSeries may drop some data in ts.
 			validationErr := d.validateSeries(now, &req.Timeseries[tsIdx], userID, group, skipLabelNameValidation, minExemplarTS, maxExemplarTS)
@@ -909,12 +925,19 @@ func (d *Distributor) prePushValidationMiddleware(next push.Func) push.Func {
 					firstPartialErr = httpgrpc.Errorf(http.StatusBadRequest, validationErr.Error())
 				}
 				removeIndexes = append(removeIndexes, tsIdx)
+				if costAttribution != nil {
+					discardedAttributedSamples[costAttributionValue] += len(ts.Samples) + len(ts.Histograms)
+				}
 				continue
 			}
 
 			validatedSamples += len(ts.Samples) + len(ts.Histograms)
 			validatedExemplars += len(ts.Exemplars)
+			if costAttribution != nil {
+				validatedAttributedSamples[costAttributionValue] += len(ts.Samples) + len(ts.Histograms)
+			}
 		}
+		d.updateAttributedSamples(costAttribution, d.discardedAttributedSamples, userID, discardedAttributedSamples, now)
 		if len(removeIndexes) > 0 {
 			for _, removeIndex := range removeIndexes {
 				mimirpb.ReusePreallocTimeseries(&req.Timeseries[removeIndex])
@@ -948,6 +971,7 @@ func (d *Distributor) prePushValidationMiddleware(next push.Func) push.Func {
 		totalN := validatedSamples + validatedExemplars + validatedMetadata
 		if !d.ingestionRateLimiter.AllowN(now, userID, totalN) {
 			d.discardedSamplesRateLimited.WithLabelValues(userID, group).Add(float64(validatedSamples))
+			d.updateAttributedSamples(costAttribution, d.discardedAttributedSamples, userID, validatedAttributedSamples, now)
 			d.discardedExemplarsRateLimited.WithLabelValues(userID).Add(float64(validatedExemplars))
 			d.discardedMetadataRateLimited.WithLabelValues(userID).Add(float64(validatedMetadata))
 			// Return a 429 here to tell the client it is going too fast.
@@ -958,6 +982,7 @@ func (d *Distributor) prePushValidationMiddleware(next push.Func) push.Func {
 
 		// totalN included samples, exemplars and metadata. Ingester follows this pattern when computing its ingestion rate.
 		d.ingestionRate.Add(int64(totalN))
+		d.updateAttributedSamples(costAttribution, d.receivedAttributedSamples, userID, validatedAttributedSamples, now)
 
 		cleanupInDefer = false
 		res, err := next(ctx, pushReq)
@@ -970,6 +995,28 @@ func (d *Distributor) prePushValidationMiddleware(next push.Func) push.Func {
 	}
 }
 
+// updateAttributedSamples adds the input number of samples by cost attribution label value to the input counter.
+func (d *Distributor) updateAttributedSamples(costAttribution *costattribution.Tracker, counter *prometheus.CounterVec, userID string, samplesByValue map[string]int, now time.Time) {
+	for value, samples := range samplesByValue {
+		if samples == 0 {
+			continue
+		}
+		if attribution := costAttribution.Attribution(value, now); attribution != "" {
+			counter.WithLabelValues(userID, attribution).Add(float64(samples))
+		}
+	}
+}
+
+// labelValue returns the value of the input label name, or an empty string if the label doesn't exist.
+func labelValue(lbls []mimirpb.LabelAdapter, name string) string {
+	for _, l := range lbls {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
 // metricsMiddleware updates metrics which are expected to account for all received data,
 // including data that later gets modified or dropped.
 func (d *Distributor) metricsMiddleware(next push.Func) push.Func {
@@ -1145,6 +1192,9 @@ func (d *Distributor) push(ctx context.Context, pushReq *push.Request) (*mimirpb
 	copy(keys, seriesKeys)
 	copy(keys[initialMetadataIndex:], metadataKeys)
 
+	// The request is released once sent to the ingesters, so the written data is counted before.
+	written := push.NewWrittenStats(req)
+
 	// we must not re-use buffers now until all DoBatch goroutines have finished,
 	// so set this flag false and pass cleanup() to DoBatch.
 	cleanupInDefer = false
@@ -1185,6 +1235,7 @@ func (d *Distributor) push(ctx context.Context, pushReq *push.Request) (*mimirpb
 	if err != nil {
 		return nil, err
 	}
+	pushReq.SetWritten(written)
 	return &mimirpb.WriteResponse{}, nil
 }
 
@@ -1811,6 +1862,69 @@ func (d *Distributor) UserStats(ctx context.Context, countMethod cardinality.Cou
 	return totalStats, nil
 }
 
+// CostAttribution returns the active series and the ingested samples of the current user for each attribution
+// tracked by the cost attribution of the ingesters. Each ingester bounds the cardinality of the attributions
+// independently, so the usage of a label value can be accounted for partially in the overflow attribution.
+func (d *Distributor) CostAttribution(ctx context.Context) (*ingester_client.CostAttributionResponse, error) {
+	replicationSet, err := d.GetIngesters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// If we have a single zone, we can't tolerate any errors.
+	if replicationSet.ZoneCount() == 1 {
+		replicationSet.MaxErrors = 0
+	}
+
+	type zonedCostAttributionResponse struct {
+		zone string
+		resp *ingester_client.CostAttributionResponse
+	}
+
+	req := &ingester_client.CostAttributionRequest{}
+	resps, err := ring.DoUntilQuorum[zonedCostAttributionResponse](ctx, replicationSet, d.queryQuorumConfig(ctx), func(ctx context.Context, desc *ring.InstanceDesc) (zonedCostAttributionResponse, error) {
+		poolClient, err := d.ingesterPool.GetClientFor(desc.Addr)
+		if err != nil {
+			return zonedCostAttributionResponse{}, err
+		}
+
+		client := poolClient.(ingester_client.IngesterClient)
+		resp, err := client.CostAttribution(ctx, req)
+		if err != nil {
+			return zonedCostAttributionResponse{}, err
+		}
+		return zonedCostAttributionResponse{zone: desc.Zone, resp: resp}, nil
+	}, func(zonedCostAttributionResponse) {})
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the responses by attribution and zone.
+	zoneActiveSeries := map[string]map[string]uint64{}
+	zoneIngestedSamples := map[string]map[string]uint64{}
+	for _, r := range resps {
+		for _, item := range r.resp.Items {
+			if zoneActiveSeries[item.Attribution] == nil {
+				zoneActiveSeries[item.Attribution] = map[string]uint64{}
+				zoneIngestedSamples[item.Attribution] = map[string]uint64{}
+			}
+			zoneActiveSeries[item.Attribution][r.zone] += item.ActiveSeries
+			zoneIngestedSamples[item.Attribution][r.zone] += item.IngestedSamples
+		}
+	}
+
+	result := &ingester_client.CostAttributionResponse{Items: make([]*ingester_client.CostAttributionItem, 0, len(zoneActiveSeries))}
+	for attribution := range zoneActiveSeries {
+		result.Items = append(result.Items, &ingester_client.CostAttributionItem{
+			Attribution:     attribution,
+			ActiveSeries:    approximateFromZones(replicationSet.ZoneCount(), d.ingestersRing.ReplicationFactor(), zoneActiveSeries[attribution]),
+			IngestedSamples: approximateFromZones(replicationSet.ZoneCount(), d.ingestersRing.ReplicationFactor(), zoneIngestedSamples[attribution]),
+		})
+	}
+
+	return result, nil
+}
+
 // UserIDStats models ingestion statistics for one user, including the user ID
 type UserIDStats struct {
 	UserID string `json:"userID"`
@@ -466,6 +466,51 @@ func TestDistributor_MetricsCleanup(t *testing.T) {
 		`), metrics...))
 }
 
+func TestDistributor_CostAttribution(t *testing.T) {
+	limits := &validation.Limits{}
+	flagext.DefaultValues(limits)
+	limits.CostAttributionLabel = "team"
+	limits.MaxCostAttributionCardinalityPerUser = 1
+
+	dists, _, regs := prepare(t, prepConfig{
+		numIngesters:    3,
+		happyIngesters:  3,
+		numDistributors: 1,
+		limits:          limits,
+	})
+	d := dists[0]
+	reg := regs[0]
+
+	ctx := user.InjectOrgID(context.Background(), "user")
+	now := time.Now().UnixMilli()
+	req := mimirpb.ToWriteRequest(
+		[][]mimirpb.LabelAdapter{
+			{{Name: model.MetricNameLabel, Value: "series_1"}, {Name: "team", Value: "a"}},
+			{{Name: model.MetricNameLabel, Value: "series_2"}, {Name: "team", Value: "a"}},
+			{{Name: model.MetricNameLabel, Value: "series_3"}, {Name: "team", Value: "b"}},
+			{{Name: model.MetricNameLabel, Value: "series_4"}},
+			{{Name: model.MetricNameLabel, Value: "series_5"}, {Name: "team", Value: "a"}, {Name: "invalid-label", Value: "value"}},
+		},
+		[]mimirpb.Sample{{TimestampMs: now, Value: 1}, {TimestampMs: now, Value: 2}, {TimestampMs: now, Value: 3}, {TimestampMs: now, Value: 4}, {TimestampMs: now, Value: 5}},
+		nil, nil, mimirpb.API)
+
+	_, err := d.Push(ctx, req)
+	require.Error(t, err)
+
+	// The values exceeding the max cardinality are accounted for in the overflow value,
+	// and series without the cost attribution label aren't attributed.
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_distributor_received_attributed_samples_total The total number of received samples per value of the cost attribution label, excluding rejected and deduped samples.
+		# TYPE cortex_distributor_received_attributed_samples_total counter
+		cortex_distributor_received_attributed_samples_total{attribution="__overflow__",user="user"} 1
+		cortex_distributor_received_attributed_samples_total{attribution="a",user="user"} 2
+
+		# HELP cortex_distributor_discarded_attributed_samples_total The total number of samples discarded by the distributor validation and rate limiting per value of the cost attribution label.
+		# TYPE cortex_distributor_discarded_attributed_samples_total counter
+		cortex_distributor_discarded_attributed_samples_total{attribution="a",user="user"} 1
+	`), "cortex_distributor_received_attributed_samples_total", "cortex_distributor_discarded_attributed_samples_total"))
+}
+
 func TestDistributor_PushRequestRateLimiter(t *testing.T) {
 	type testPush struct {
 		expectedError error
@@ -1145,6 +1190,36 @@ func TestDistributor_Push_LabelRemoval(t *testing.T) {
 	}
 }
 
+func TestDistributor_Push_ShouldSkipReadOnlyIngesters(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	ds, ingesters, _ := prepare(t, prepConfig{
+		numIngesters:      5,
+		happyIngesters:    5,
+		numDistributors:   1,
+		readOnlyIngesters: 1,
+	})
+
+	const numSeries = 100
+	for i := 0; i < numSeries; i++ {
+		req := mockWriteRequest(labels.FromStrings(labels.MetricName, "series", "index", strconv.Itoa(i)), 1, 1)
+		_, err := ds[0].Push(ctx, req)
+		require.NoError(t, err)
+	}
+
+	// Each series is still written to 3 ingesters, once the pushes beyond the quorum have completed.
+	test.Poll(t, time.Second, 3*numSeries, func() interface{} {
+		totalSeries := 0
+		for i := range ingesters {
+			totalSeries += len(ingesters[i].series())
+		}
+		return totalSeries
+	})
+
+	// The read-only ingester doesn't receive any write.
+	assert.Empty(t, ingesters[0].series())
+}
+
 func TestDistributor_Push_ShouldGuaranteeShardingTokenConsistencyOverTheTime(t *testing.T) {
 	ctx := user.InjectOrgID(context.Background(), "user")
 	tests := map[string]struct {
@@ -2517,6 +2592,43 @@ func TestDistributor_LabelValuesCardinality(t *testing.T) {
 	}
 }
 
+func TestDistributor_CostAttributionFromIngesters(t *testing.T) {
+	fixtures := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "test_1", "team", "a"),
+		labels.FromStrings(labels.MetricName, "test_2", "team", "a"),
+		labels.FromStrings(labels.MetricName, "test_1", "team", "b"),
+		labels.FromStrings(labels.MetricName, "test_1"),
+	}
+
+	ds, ingesters, _ := prepare(t, prepConfig{
+		numIngesters:      3,
+		happyIngesters:    3,
+		numDistributors:   1,
+		replicationFactor: 3,
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "cost-attribution")
+	for _, series := range fixtures {
+		_, err := ds[0].Push(ctx, mockWriteRequest(series, 1, 100000))
+		require.NoError(t, err)
+	}
+
+	// The active series and the ingested samples reported by the ingesters are divided by the replication factor.
+	test.Poll(t, time.Second, []*client.CostAttributionItem{
+		{Attribution: "a", ActiveSeries: 2, IngestedSamples: 2},
+		{Attribution: "b", ActiveSeries: 1, IngestedSamples: 1},
+	}, func() interface{} {
+		resp, err := ds[0].CostAttribution(ctx)
+		require.NoError(t, err)
+		sort.Slice(resp.Items, func(i, j int) bool {
+			return resp.Items[i].Attribution < resp.Items[j].Attribution
+		})
+		return resp.Items
+	})
+
+	assert.Equal(t, 3, countMockIngestersCalls(ingesters, "CostAttribution"))
+}
+
 func TestDistributor_LabelValuesCardinalityLimit(t *testing.T) {
 	fixtures := []struct {
 		labels    labels.Labels
@@ -2991,6 +3103,7 @@ type prepConfig struct {
 	ingesterZones                      []string
 	labelNamesStreamZonesResponseDelay map[string]time.Duration
 	preferStreamingChunks              bool
+	readOnlyIngesters                  int // The first readOnlyIngesters ingesters are read-only in the ring.
 
 	timeOut bool
 }
@@ -3037,6 +3150,7 @@ func prepare(t *testing.T, cfg prepConfig) ([]*Distributor, []mockIngester, []*p
 			Timestamp:           time.Now().Unix(),
 			RegisteredTimestamp: time.Now().Add(-2 * time.Hour).Unix(),
 			Tokens:              tokens,
+			ReadOnly:            i < cfg.readOnlyIngesters,
 		}
 		ingestersByAddr[addr] = &ingesters[i]
 		ingesters[i].tokens = tokens
@@ -3511,7 +3625,7 @@ func (i *mockIngester) Push(ctx context.Context, req *mimirpb.WriteRequest, _ ..
 	}
 
 	for _, series := range req.Timeseries {
-		hash := shardByAllLabels(orgid, series.Labels)
+		hash := client.ShardByAllLabelAdapters(orgid, series.Labels)
 		existing, ok := i.timeseries[hash]
 		if !ok {
 			// Make a copy because the request Timeseries are reused
@@ -3533,7 +3647,7 @@ func (i *mockIngester) Push(ctx context.Context, req *mimirpb.WriteRequest, _ ..
 	}
 
 	for _, m := range req.Metadata {
-		hash := shardByMetricName(orgid, m.MetricFamilyName)
+		hash := client.ShardByMetricName(orgid, m.MetricFamilyName)
 		set, ok := i.metadata[hash]
 		if !ok {
 			set = map[mimirpb.MetricMetadata]struct{}{}
@@ -4009,6 +4123,37 @@ func (i *mockIngester) AllUserStats(context.Context, *client.UserStatsRequest, .
 	return &i.stats, nil
 }
 
+// CostAttribution attributes the series received by the ingester by the value of the "team" label.
+func (i *mockIngester) CostAttribution(context.Context, *client.CostAttributionRequest, ...grpc.CallOption) (*client.CostAttributionResponse, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	i.trackCall("CostAttribution")
+
+	if !i.happy {
+		return nil, errFail
+	}
+
+	items := map[string]*client.CostAttributionItem{}
+	for _, ts := range i.timeseries {
+		attribution := labelValue(ts.Labels, "team")
+		if attribution == "" {
+			continue
+		}
+		if items[attribution] == nil {
+			items[attribution] = &client.CostAttributionItem{Attribution: attribution}
+		}
+		items[attribution].ActiveSeries++
+		items[attribution].IngestedSamples += uint64(len(ts.Samples))
+	}
+
+	resp := &client.CostAttributionResponse{}
+	for _, item := range items {
+		resp.Items = append(resp.Items, item)
+	}
+	return resp, nil
+}
+
 func (i *mockIngester) UserStats(context.Context, *client.UserStatsRequest, ...grpc.CallOption) (*client.UserStatsResponse, error) {
 	if !i.happy {
 		return nil, errFail
@@ -4187,23 +4332,6 @@ func TestDistributorValidation(t *testing.T) {
 	}
 }
 
-// This is not great, but we deal with unsorted labels in prePushRelabelMiddleware.
-func TestShardByAllLabelsReturnsWrongResultsForUnsortedLabels(t *testing.T) {
-	val1 := shardByAllLabels("test", []mimirpb.LabelAdapter{
-		{Name: "__name__", Value: "foo"},
-		{Name: "bar", Value: "baz"},
-		{Name: "sample", Value: "1"},
-	})
-
-	val2 := shardByAllLabels("test", []mimirpb.LabelAdapter{
-		{Name: "__name__", Value: "foo"},
-		{Name: "sample", Value: "1"},
-		{Name: "bar", Value: "baz"},
-	})
-
-	assert.NotEqual(t, val1, val2)
-}
-
 func TestDistributor_Push_Relabel(t *testing.T) {
 	ctx := user.InjectOrgID(context.Background(), "user")
 
@@ -4264,6 +4392,39 @@ func TestDistributor_Push_Relabel(t *testing.T) {
 	}
 }
 
+func TestDistributor_PushWithMiddlewares_ShouldRecordWrittenData(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.MaxGlobalExemplarsPerUser = 100
+	limits.MetricRelabelConfigs = []*relabel.Config{{
+		SourceLabels: []model.LabelName{"__name__"},
+		Regex:        relabel.MustNewRegexp("^dropped$"),
+		Action:       relabel.Drop,
+	}}
+
+	ds, _, _ := prepare(t, prepConfig{
+		numIngesters:    2,
+		happyIngesters:  2,
+		numDistributors: 1,
+		limits:          &limits,
+	})
+
+	// The series of the "dropped" metric are dropped by the relabel rules,
+	// while the series with an invalid label name is rejected.
+	req := makeWriteRequest(time.Now().UnixMilli(), 2, 0, true, false, "foo", "dropped")
+	req.Timeseries = append(req.Timeseries, makeWriteRequestTimeseries([]mimirpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo"}, {Name: "invalid-name", Value: "a"}}, time.Now().UnixMilli(), 1))
+
+	pushReq := push.NewParsedRequest(req)
+	_, err := ds[0].PushWithMiddlewares(ctx, pushReq)
+
+	resp, ok := httpgrpc.HTTPResponseFromError(err)
+	require.True(t, ok)
+	assert.Equal(t, int32(http.StatusBadRequest), resp.Code)
+	assert.Equal(t, push.WrittenStats{Samples: 2, Exemplars: 2}, pushReq.Written())
+}
+
 func countMockIngestersCalls(ingesters []mockIngester, name string) int {
 	count := 0
 	for i := 0; i < len(ingesters); i++ {
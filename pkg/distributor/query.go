@@ -326,7 +326,9 @@ func (d *Distributor) queryIngesterStream(ctx context.Context, replicationSet ri
 		}
 	}
 
+	queryStart := time.Now()
 	results, err := ring.DoUntilQuorumWithoutSuccessfulContextCancellation(ctx, replicationSet, d.queryQuorumConfig(ctx), queryIngester, cleanup)
+	reqStats.AddIngesterTime(time.Since(queryStart))
 	if err != nil {
 		return ingester_client.CombinedQueryStreamResponse{}, err
 	}
@@ -14,6 +14,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/grafana/mimir/pkg/frontend/querymiddleware"
+	"github.com/grafana/mimir/pkg/frontend/querystatslog"
 	"github.com/grafana/mimir/pkg/frontend/transport"
 	v1 "github.com/grafana/mimir/pkg/frontend/v1"
 	v2 "github.com/grafana/mimir/pkg/frontend/v2"
@@ -29,6 +30,8 @@ type CombinedFrontendConfig struct {
 
 	QueryMiddleware querymiddleware.Config `yaml:",inline"`
 
+	QueryStatsLog querystatslog.Config `yaml:"query_stats_log"`
+
 	DownstreamURL string `yaml:"downstream_url" category:"advanced"`
 }
 
@@ -37,17 +40,24 @@ func (cfg *CombinedFrontendConfig) RegisterFlags(f *flag.FlagSet, logger log.Log
 	cfg.FrontendV1.RegisterFlags(f)
 	cfg.FrontendV2.RegisterFlags(f, logger)
 	cfg.QueryMiddleware.RegisterFlags(f)
+	cfg.QueryStatsLog.RegisterFlags(f)
 
 	f.StringVar(&cfg.DownstreamURL, "query-frontend.downstream-url", "", "URL of downstream Prometheus.")
 }
 
 func (cfg *CombinedFrontendConfig) Validate() error {
+	if err := cfg.FrontendV1.Validate(); err != nil {
+		return err
+	}
 	if err := cfg.FrontendV2.Validate(); err != nil {
 		return err
 	}
 	if err := cfg.QueryMiddleware.Validate(); err != nil {
 		return err
 	}
+	if err := cfg.QueryStatsLog.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
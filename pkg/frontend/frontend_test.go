@@ -254,7 +254,7 @@ func testFrontend(t *testing.T, config CombinedFrontendConfig, handler http.Hand
 	r.PathPrefix("/").Handler(middleware.Merge(
 		middleware.AuthenticateUser,
 		middleware.Tracer{},
-	).Wrap(transport.NewHandler(config.Handler, rt, logger, nil, nil)))
+	).Wrap(transport.NewHandler(config.Handler, rt, logger, nil, nil, nil)))
 
 	httpServer := http.Server{
 		Handler: r,
@@ -295,3 +295,7 @@ type limits struct {
 func (l limits) MaxQueriersPerUser(_ string) int {
 	return l.queriers
 }
+
+func (l limits) QuerySchedulingWeight(_ string) float64 {
+	return 1
+}
@@ -8,6 +8,7 @@ package querymiddleware
 import (
 	"context"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,8 +16,12 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/grafana/dskit/tenant"
 	"github.com/grafana/dskit/user"
+	"github.com/grafana/regexp"
 	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
 
 	apierror "github.com/grafana/mimir/pkg/api/error"
 	"github.com/grafana/mimir/pkg/util"
@@ -42,6 +47,9 @@ type Limits interface {
 	// query may be. 0 means "unlimited".
 	MaxQueryExpressionSizeBytes(userID string) int
 
+	// BlockedQueries returns the queries rejected by the query-frontend for a given tenant.
+	BlockedQueries(userID string) validation.BlockedQueries
+
 	// MaxCacheFreshness returns the period after which results are cacheable,
 	// to prevent caching of very recent results.
 	MaxCacheFreshness(userID string) time.Duration
@@ -65,8 +73,9 @@ type Limits interface {
 	// This method is copied from compactor.ConfigProvider.
 	CompactorSplitAndMergeShards(userID string) int
 
-	// CompactorBlocksRetentionPeriod returns the retention period for a given user.
-	CompactorBlocksRetentionPeriod(userID string) time.Duration
+	// CompactorBlocksMaxRetentionPeriod returns the longest retention period of the blocks of any resolution
+	// for a given user.
+	CompactorBlocksMaxRetentionPeriod(userID string) time.Duration
 
 	// OutOfOrderTimeWindow returns the out-of-order time window for the user.
 	OutOfOrderTimeWindow(userID string) time.Duration
@@ -97,17 +106,35 @@ type Limits interface {
 
 type limitsMiddleware struct {
 	Limits
-	next   Handler
-	logger log.Logger
+	next           Handler
+	logger         log.Logger
+	blockedQueries *prometheus.CounterVec
+	blockedCache   *blockedQueriesCache
+}
+
+// newBlockedQueriesCounter makes the metric counting the queries rejected because blocked, shared by the
+// limits middlewares of range and instant queries.
+func newBlockedQueriesCounter(registerer prometheus.Registerer) *prometheus.CounterVec {
+	return promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_blocked_queries_total",
+		Help: "Total number of queries rejected because they match one of the tenant's blocked queries.",
+	}, []string{"user"})
 }
 
 // newLimitsMiddleware creates a new Middleware that enforces query limits.
-func newLimitsMiddleware(l Limits, logger log.Logger) Middleware {
+func newLimitsMiddleware(l Limits, logger log.Logger, blockedQueries *prometheus.CounterVec) Middleware {
+	if blockedQueries == nil {
+		blockedQueries = newBlockedQueriesCounter(nil)
+	}
+	blockedCache := newBlockedQueriesCache()
+
 	return MiddlewareFunc(func(next Handler) Handler {
 		return limitsMiddleware{
-			next:   next,
-			Limits: l,
-			logger: logger,
+			next:           next,
+			Limits:         l,
+			logger:         logger,
+			blockedQueries: blockedQueries,
+			blockedCache:   blockedCache,
 		}
 	})
 }
@@ -122,7 +149,7 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 	}
 
 	// Clamp the time range based on the max query lookback and block retention period.
-	blocksRetentionPeriod := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, l.CompactorBlocksRetentionPeriod)
+	blocksRetentionPeriod := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, l.CompactorBlocksMaxRetentionPeriod)
 	maxQueryLookback := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, l.MaxQueryLookback)
 	maxLookback := util_math.Min(blocksRetentionPeriod, maxQueryLookback)
 	if maxLookback > 0 {
@@ -176,6 +203,15 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 		}
 	}
 
+	// Reject the query if it's blocked by any of the tenants.
+	if blockedBy := l.blockedQueryTenants(tenantIDs, r); len(blockedBy) > 0 {
+		for _, tenantID := range blockedBy {
+			l.blockedQueries.WithLabelValues(tenantID).Inc()
+		}
+		level.Info(log).Log("msg", "query blocked", "query", r.GetQuery(), "blocked_by", strings.Join(blockedBy, ","))
+		return nil, apierror.New(apierror.TypeForbidden, validation.NewQueryBlockedError().Error())
+	}
+
 	// Enforce the max query length.
 	if maxQueryLength := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, l.MaxTotalQueryLength); maxQueryLength > 0 {
 		queryLen := timestamp.Time(r.GetEnd()).Sub(timestamp.Time(r.GetStart()))
@@ -187,6 +223,155 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 	return l.next.Do(ctx, r)
 }
 
+// blockedQueryTenants returns the tenants whose blocked queries match the query of the input request.
+func (l limitsMiddleware) blockedQueryTenants(tenantIDs []string, r Request) []string {
+	var (
+		blockedBy  []string
+		normalised bool
+		query      string
+		queryType  string
+	)
+
+	for _, tenantID := range tenantIDs {
+		blocked := l.BlockedQueries(tenantID)
+		if len(blocked) == 0 {
+			continue
+		}
+
+		// The query is normalised lazily, since most tenants have no blocked queries.
+		if !normalised {
+			query, queryType, normalised = normaliseQuery(r.GetQuery()), blockedQueryType(r), true
+		}
+
+		if isBlockedQuery(query, queryType, l.blockedCache.get(tenantID, blocked)) {
+			blockedBy = append(blockedBy, tenantID)
+		}
+	}
+
+	return blockedBy
+}
+
+// compiledBlockedQuery is a blocked query whose pattern has been normalised or compiled.
+type compiledBlockedQuery struct {
+	queryType string
+
+	// query is the normalised pattern, set if the pattern is not a regular expression.
+	query string
+	// regex is the compiled pattern, set if the pattern is a regular expression.
+	regex *regexp.Regexp
+}
+
+// compileBlockedQueries normalises or compiles the patterns of the input blocked queries.
+func compileBlockedQueries(blocked validation.BlockedQueries) []compiledBlockedQuery {
+	out := make([]compiledBlockedQuery, 0, len(blocked))
+	for _, b := range blocked {
+		c := compiledBlockedQuery{queryType: b.QueryType}
+
+		if !b.Regex {
+			c.query = normaliseQuery(b.Pattern)
+		} else {
+			// The pattern has been validated when the limits were loaded.
+			re, err := regexp.Compile("^(?:" + b.Pattern + ")$")
+			if err != nil {
+				continue
+			}
+			c.regex = re
+		}
+
+		out = append(out, c)
+	}
+	return out
+}
+
+// blockedQueriesCache holds the compiled blocked queries of each tenant, so that the patterns are normalised
+// and compiled once instead of for each query. The compiled blocked queries of a tenant are replaced when the
+// tenant's blocked queries change.
+type blockedQueriesCache struct {
+	mtx     sync.RWMutex
+	tenants map[string]blockedQueriesCacheEntry
+}
+
+type blockedQueriesCacheEntry struct {
+	blocked  validation.BlockedQueries
+	compiled []compiledBlockedQuery
+}
+
+func newBlockedQueriesCache() *blockedQueriesCache {
+	return &blockedQueriesCache{tenants: map[string]blockedQueriesCacheEntry{}}
+}
+
+// get returns the compiled blocked queries of the tenant, compiling them if they're not cached
+// or if they have been cached for a different list of blocked queries.
+func (c *blockedQueriesCache) get(tenantID string, blocked validation.BlockedQueries) []compiledBlockedQuery {
+	c.mtx.RLock()
+	entry, ok := c.tenants[tenantID]
+	c.mtx.RUnlock()
+
+	if ok && equalBlockedQueries(entry.blocked, blocked) {
+		return entry.compiled
+	}
+
+	entry = blockedQueriesCacheEntry{blocked: blocked, compiled: compileBlockedQueries(blocked)}
+
+	c.mtx.Lock()
+	c.tenants[tenantID] = entry
+	c.mtx.Unlock()
+
+	return entry.compiled
+}
+
+func equalBlockedQueries(a, b validation.BlockedQueries) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isBlockedQuery returns whether the normalised query of the input type matches any of the compiled blocked queries.
+func isBlockedQuery(query, queryType string, blocked []compiledBlockedQuery) bool {
+	for _, b := range blocked {
+		if b.queryType != "" && b.queryType != queryType {
+			continue
+		}
+
+		if b.regex == nil {
+			if b.query == query {
+				return true
+			}
+			continue
+		}
+
+		if b.regex.MatchString(query) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normaliseQuery returns the query formatted by the PromQL parser, so that it doesn't depend on whitespaces
+// and other formatting details. Queries which can't be parsed are only trimmed.
+func normaliseQuery(query string) string {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return strings.TrimSpace(query)
+	}
+	return expr.String()
+}
+
+// blockedQueryType returns the type of the input request, as configured in blocked queries.
+func blockedQueryType(r Request) string {
+	if _, ok := r.(*PrometheusInstantQueryRequest); ok {
+		return validation.BlockedQueryTypeInstant
+	}
+	return validation.BlockedQueryTypeRange
+}
+
 type limitedParallelismRoundTripper struct {
 	downstream Handler
 	limits     Limits
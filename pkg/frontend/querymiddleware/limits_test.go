@@ -17,12 +17,16 @@ import (
 	"github.com/go-kit/log"
 	"github.com/grafana/dskit/tenant"
 	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 
+	apierror "github.com/grafana/mimir/pkg/api/error"
 	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 func TestLimitsMiddleware_MaxQueryLookback(t *testing.T) {
@@ -98,7 +102,7 @@ func TestLimitsMiddleware_MaxQueryLookback(t *testing.T) {
 			}
 
 			limits := mockLimits{maxQueryLookback: testData.maxQueryLookback, compactorBlocksRetentionPeriod: testData.blocksRetentionPeriod}
-			middleware := newLimitsMiddleware(limits, log.NewNopLogger())
+			middleware := newLimitsMiddleware(limits, log.NewNopLogger(), nil)
 
 			innerRes := newEmptyPrometheusResponse()
 			inner := &mockHandler{}
@@ -179,7 +183,7 @@ func TestLimitsMiddleware_MaxQueryExpressionSizeBytes(t *testing.T) {
 					"test2": {maxQueryExpressionSizeBytes: testData.queryLimits["test2"]},
 				},
 			}
-			middleware := newLimitsMiddleware(limits, log.NewNopLogger())
+			middleware := newLimitsMiddleware(limits, log.NewNopLogger(), nil)
 
 			innerRes := newEmptyPrometheusResponse()
 			inner := &mockHandler{}
@@ -200,6 +204,118 @@ func TestLimitsMiddleware_MaxQueryExpressionSizeBytes(t *testing.T) {
 	}
 }
 
+func TestLimitsMiddleware_BlockedQueries(t *testing.T) {
+	now := time.Now()
+	rangeReq := func(query string) Request {
+		return &PrometheusRangeQueryRequest{Query: query, Start: util.TimeToMillis(now.Add(-time.Hour)), End: util.TimeToMillis(now), Step: 60000}
+	}
+	instantReq := func(query string) Request {
+		return &PrometheusInstantQueryRequest{Query: query, Time: util.TimeToMillis(now)}
+	}
+
+	tests := map[string]struct {
+		blocked        map[string]validation.BlockedQueries
+		req            Request
+		expectedBlocks map[string]float64
+	}{
+		"no blocked queries": {
+			req: rangeReq("up"),
+		},
+		"exact match on the normalised query": {
+			blocked:        map[string]validation.BlockedQueries{"test1": {{Pattern: `sum(rate(foo[5m]))`}}},
+			req:            rangeReq(`sum (rate(foo [5m] ))`),
+			expectedBlocks: map[string]float64{"test1": 1},
+		},
+		"exact pattern not matching": {
+			blocked: map[string]validation.BlockedQueries{"test1": {{Pattern: `sum(rate(foo[5m]))`}}},
+			req:     rangeReq(`sum(rate(foo[1m]))`),
+		},
+		"regex match anchored at both ends": {
+			blocked:        map[string]validation.BlockedQueries{"test2": {{Pattern: `.*\{job="expensive"\}.*`, Regex: true}}},
+			req:            instantReq(`count(up{job="expensive"})`),
+			expectedBlocks: map[string]float64{"test2": 1},
+		},
+		"regex partial match": {
+			blocked: map[string]validation.BlockedQueries{"test2": {{Pattern: `up`, Regex: true}}},
+			req:     instantReq(`count(up)`),
+		},
+		"query type not matching": {
+			blocked: map[string]validation.BlockedQueries{"test1": {{Pattern: "up", QueryType: validation.BlockedQueryTypeInstant}}},
+			req:     rangeReq("up"),
+		},
+		"query type matching": {
+			blocked:        map[string]validation.BlockedQueries{"test1": {{Pattern: "up", QueryType: validation.BlockedQueryTypeRange}}},
+			req:            rangeReq("up"),
+			expectedBlocks: map[string]float64{"test1": 1},
+		},
+		"query blocked by multiple tenants": {
+			blocked: map[string]validation.BlockedQueries{
+				"test1": {{Pattern: "up"}},
+				"test2": {{Pattern: "u.*", Regex: true}},
+			},
+			req:            instantReq("up"),
+			expectedBlocks: map[string]float64{"test1": 1, "test2": 1},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			limits := multiTenantMockLimits{byTenant: map[string]mockLimits{}}
+			for tenantID, blocked := range testData.blocked {
+				limits.byTenant[tenantID] = mockLimits{blockedQueries: blocked}
+			}
+
+			blockedQueries := newBlockedQueriesCounter(prometheus.NewPedanticRegistry())
+			middleware := newLimitsMiddleware(limits, log.NewNopLogger(), blockedQueries)
+
+			innerRes := newEmptyPrometheusResponse()
+			inner := &mockHandler{}
+			inner.On("Do", mock.Anything, mock.Anything).Return(innerRes, nil)
+
+			ctx := user.InjectOrgID(context.Background(), "test1|test2")
+			res, err := middleware.Wrap(inner).Do(ctx, testData.req)
+
+			if len(testData.expectedBlocks) == 0 {
+				require.NoError(t, err)
+				require.Same(t, innerRes, res)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "err-mimir-query-blocked")
+			resp, ok := apierror.HTTPResponseFromError(err)
+			require.True(t, ok)
+			assert.Equal(t, int32(http.StatusForbidden), resp.Code)
+			assert.Empty(t, inner.Calls)
+
+			for tenantID, expected := range testData.expectedBlocks {
+				assert.Equal(t, expected, promtest.ToFloat64(blockedQueries.WithLabelValues(tenantID)), tenantID)
+			}
+		})
+	}
+}
+
+func TestBlockedQueriesCache(t *testing.T) {
+	cache := newBlockedQueriesCache()
+
+	blocked := validation.BlockedQueries{{Pattern: `sum (rate(foo[5m]))`}, {Pattern: `.*expensive.*`, Regex: true}}
+	compiled := cache.get("test", blocked)
+	require.Len(t, compiled, 2)
+	assert.Equal(t, `sum(rate(foo[5m]))`, compiled[0].query)
+	assert.True(t, isBlockedQuery(`sum(rate(foo[5m]))`, validation.BlockedQueryTypeRange, compiled))
+	assert.True(t, isBlockedQuery(`up{job="expensive"}`, validation.BlockedQueryTypeRange, compiled))
+
+	// The blocked queries are compiled once for the same list of patterns.
+	cached := cache.get("test", append(validation.BlockedQueries{}, blocked...))
+	assert.Same(t, &compiled[0], &cached[0])
+
+	// The blocked queries are compiled again when the tenant's patterns change.
+	updated := cache.get("test", validation.BlockedQueries{{Pattern: `up`}})
+	require.Len(t, updated, 1)
+	assert.True(t, isBlockedQuery(`up`, validation.BlockedQueryTypeInstant, updated))
+	assert.False(t, isBlockedQuery(`up{job="expensive"}`, validation.BlockedQueryTypeInstant, updated))
+}
+
 func TestLimitsMiddleware_MaxQueryLength(t *testing.T) {
 	const (
 		thirtyDays = 30 * 24 * time.Hour
@@ -262,7 +378,7 @@ func TestLimitsMiddleware_MaxQueryLength(t *testing.T) {
 			}
 
 			limits := mockLimits{maxQueryLength: testData.maxQueryLength, maxTotalQueryLength: testData.maxTotalQueryLength}
-			middleware := newLimitsMiddleware(limits, log.NewNopLogger())
+			middleware := newLimitsMiddleware(limits, log.NewNopLogger(), nil)
 
 			innerRes := newEmptyPrometheusResponse()
 			inner := &mockHandler{}
@@ -328,7 +444,7 @@ func TestLimitsMiddleware_CreationGracePeriod(t *testing.T) {
 			}
 
 			limits := mockLimits{creationGracePeriod: testData.creationGracePeriod}
-			middleware := newLimitsMiddleware(limits, log.NewNopLogger())
+			middleware := newLimitsMiddleware(limits, log.NewNopLogger(), nil)
 
 			innerRes := newEmptyPrometheusResponse()
 			inner := &mockHandler{}
@@ -371,6 +487,10 @@ func (m multiTenantMockLimits) MaxQueryExpressionSizeBytes(userID string) int {
 	return m.byTenant[userID].maxQueryExpressionSizeBytes
 }
 
+func (m multiTenantMockLimits) BlockedQueries(userID string) validation.BlockedQueries {
+	return m.byTenant[userID].blockedQueries
+}
+
 func (m multiTenantMockLimits) MaxQueryParallelism(userID string) int {
 	return m.byTenant[userID].maxQueryParallelism
 }
@@ -399,7 +519,7 @@ func (m multiTenantMockLimits) CompactorSplitAndMergeShards(userID string) int {
 	return m.byTenant[userID].compactorShards
 }
 
-func (m multiTenantMockLimits) CompactorBlocksRetentionPeriod(userID string) time.Duration {
+func (m multiTenantMockLimits) CompactorBlocksMaxRetentionPeriod(userID string) time.Duration {
 	return m.byTenant[userID].compactorBlocksRetentionPeriod
 }
 
@@ -440,6 +560,7 @@ type mockLimits struct {
 	maxQueryLength                       time.Duration
 	maxTotalQueryLength                  time.Duration
 	maxQueryExpressionSizeBytes          int
+	blockedQueries                       validation.BlockedQueries
 	maxCacheFreshness                    time.Duration
 	maxQueryParallelism                  int
 	maxShardedQueries                    int
@@ -473,6 +594,10 @@ func (m mockLimits) MaxQueryExpressionSizeBytes(string) int {
 	return m.maxQueryExpressionSizeBytes
 }
 
+func (m mockLimits) BlockedQueries(string) validation.BlockedQueries {
+	return m.blockedQueries
+}
+
 func (m mockLimits) MaxQueryParallelism(string) int {
 	if m.maxQueryParallelism == 0 {
 		return 14 // Flag default.
@@ -504,7 +629,7 @@ func (m mockLimits) CompactorSplitAndMergeShards(string) int {
 	return m.compactorShards
 }
 
-func (m mockLimits) CompactorBlocksRetentionPeriod(string) time.Duration {
+func (m mockLimits) CompactorBlocksMaxRetentionPeriod(string) time.Duration {
 	return m.compactorBlocksRetentionPeriod
 }
 
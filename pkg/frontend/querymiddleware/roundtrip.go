@@ -199,11 +199,12 @@ func newQueryTripperware(
 
 	// Metric used to keep track of each middleware execution duration.
 	metrics := newInstrumentMiddlewareMetrics(registerer)
+	blockedQueries := newBlockedQueriesCounter(registerer)
 
 	queryRangeMiddleware := []Middleware{
 		// Track query range statistics. Added first before any subsequent middleware modifies the request.
 		newQueryStatsMiddleware(registerer),
-		newLimitsMiddleware(limits, log),
+		newLimitsMiddleware(limits, log, blockedQueries),
 	}
 	if cfg.AlignQueriesWithStep {
 		queryRangeMiddleware = append(queryRangeMiddleware, newInstrumentMiddleware("step_align", metrics), newStepAlignMiddleware())
@@ -246,7 +247,7 @@ func newQueryTripperware(
 		))
 	}
 
-	queryInstantMiddleware := []Middleware{newLimitsMiddleware(limits, log)}
+	queryInstantMiddleware := []Middleware{newLimitsMiddleware(limits, log, blockedQueries)}
 
 	queryInstantMiddleware = append(
 		queryInstantMiddleware,
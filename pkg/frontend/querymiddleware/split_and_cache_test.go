@@ -182,7 +182,7 @@ func TestSplitAndCacheMiddleware_SplitByInterval(t *testing.T) {
 
 	// Chain middlewares together.
 	middlewares := []Middleware{
-		newLimitsMiddleware(mockLimits{}, log.NewNopLogger()),
+		newLimitsMiddleware(mockLimits{}, log.NewNopLogger(), nil),
 		splitCacheMiddleware,
 		newAssertHintsMiddleware(t, &Hints{TotalQueries: 4}),
 	}
@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querystatslog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// hourFormat is the format of the hour partition in the object names.
+	hourFormat = "2006-01-02T15"
+
+	// FileExtension is the extension of the files written to the object storage.
+	FileExtension = ".json.gz"
+)
+
+// Record is the statistics of a query run through the query-frontend.
+type Record struct {
+	Timestamp time.Time `json:"timestamp"`
+	Tenant    string    `json:"tenant"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	UserAgent string    `json:"user_agent,omitempty"`
+
+	// Query parameters, as received in the request.
+	Query string `json:"query,omitempty"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	Time  string `json:"time,omitempty"`
+	Step  string `json:"step,omitempty"`
+
+	Status            string  `json:"status"`
+	Error             string  `json:"error,omitempty"`
+	ResponseTime      float64 `json:"response_time_seconds"`
+	ResponseSizeBytes int64   `json:"response_size_bytes"`
+
+	WallTime             float64 `json:"wall_time_seconds"`
+	FetchedSeriesCount   uint64  `json:"fetched_series_count"`
+	FetchedChunkBytes    uint64  `json:"fetched_chunk_bytes"`
+	FetchedChunksCount   uint64  `json:"fetched_chunks_count"`
+	FetchedIndexBytes    uint64  `json:"fetched_index_bytes"`
+	ShardedQueries       uint32  `json:"sharded_queries"`
+	SplitQueries         uint32  `json:"split_queries"`
+	EstimatedSeriesCount uint64  `json:"estimated_series_count"`
+	SamplesProcessed     uint64  `json:"samples_processed"`
+	PeakSamples          uint64  `json:"peak_samples"`
+	StoreGatewayTime     float64 `json:"store_gateway_time_seconds"`
+	IngesterTime         float64 `json:"ingester_time_seconds"`
+}
+
+// PartitionPrefix returns the prefix of the objects storing the records of the tenant for the hour.
+func PartitionPrefix(tenant string, hour time.Time) string {
+	return path.Join(tenant, hour.UTC().Format(hourFormat)) + "/"
+}
+
+// ParsePartitionHour parses the hour partition from the last directory of the input object prefix.
+func ParsePartitionHour(prefix string) (time.Time, error) {
+	return time.Parse(hourFormat, path.Base(strings.TrimSuffix(prefix, "/")))
+}
+
+// EncodeRecords writes the records to w, gzipped and one JSON object per line.
+func EncodeRecords(w io.Writer, records []Record) error {
+	gw := gzip.NewWriter(w)
+	enc := json.NewEncoder(gw)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return gw.Close()
+}
+
+// DecodeRecords reads the records written by EncodeRecords.
+func DecodeRecords(r io.Reader) ([]Record, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "create gzip reader")
+	}
+	defer gr.Close()
+
+	var records []Record
+	dec := json.NewDecoder(bufio.NewReader(gr))
+	for {
+		var record Record
+		if err := dec.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "decode record")
+		}
+		records = append(records, record)
+	}
+}
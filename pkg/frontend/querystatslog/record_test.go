@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querystatslog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecodeRecords(t *testing.T) {
+	records := []Record{
+		{Timestamp: time.Unix(1000, 0).UTC(), Tenant: "user-1", Query: "up", Status: "success", WallTime: 1.5, FetchedChunksCount: 10},
+		{Timestamp: time.Unix(2000, 0).UTC(), Tenant: "user-1", Query: "sum(rate(foo[5m]))", Status: "failed", Error: "some error"},
+	}
+
+	buf := bytes.Buffer{}
+	require.NoError(t, EncodeRecords(&buf, records))
+
+	decoded, err := DecodeRecords(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, records, decoded)
+}
+
+func TestPartitionPrefix(t *testing.T) {
+	hour := time.Date(2023, 5, 10, 14, 0, 0, 0, time.UTC)
+
+	prefix := PartitionPrefix("user-1", hour)
+	assert.Equal(t, "user-1/2023-05-10T14/", prefix)
+
+	parsed, err := ParsePartitionHour(prefix)
+	require.NoError(t, err)
+	assert.Equal(t, hour, parsed)
+}
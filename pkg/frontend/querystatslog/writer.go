@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querystatslog
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"flag"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/services"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/fieldcategory"
+)
+
+// Config configures the query stats log.
+type Config struct {
+	Enabled            bool          `yaml:"enabled" category:"experimental"`
+	FlushInterval      time.Duration `yaml:"flush_interval" category:"experimental"`
+	MaxBufferedRecords int           `yaml:"max_buffered_records" category:"experimental"`
+	Storage            bucket.Config `yaml:"storage"`
+}
+
+// RegisterFlags registers the query stats log flags.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "query-frontend.query-stats-log.enabled", false, "True to write the statistics of every query to the object storage, in addition to the query stats log line. Requires query statistics tracking to be enabled.")
+	f.DurationVar(&cfg.FlushInterval, "query-frontend.query-stats-log.flush-interval", time.Minute, "How frequently the buffered query statistics are written to the object storage, in one file per tenant and hour.")
+	f.IntVar(&cfg.MaxBufferedRecords, "query-frontend.query-stats-log.max-buffered-records", 100000, "Maximum number of query statistics buffered in memory before being written to the object storage. The statistics of the queries received while the buffer is full are discarded.")
+
+	storageFlags := util.TrackRegisteredFlags("query-frontend.query-stats-log.", f, func(prefix string, f *flag.FlagSet) {
+		cfg.Storage.RegisterFlagsWithPrefixAndDefaultDirectory(prefix, "query-stats-log", f)
+	})
+
+	// The storage flags are experimental like the rest of the query stats log config.
+	overrides := map[string]fieldcategory.Category{}
+	for name := range storageFlags.Flags {
+		overrides[storageFlags.Prefix+name] = fieldcategory.Experimental
+	}
+	fieldcategory.AddOverrides(overrides)
+}
+
+// Validate the config.
+func (cfg *Config) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.FlushInterval <= 0 {
+		return errors.New("the query stats log flush interval must be greater than 0")
+	}
+	if cfg.MaxBufferedRecords <= 0 {
+		return errors.New("the query stats log max buffered records must be greater than 0")
+	}
+	return errors.Wrap(cfg.Storage.Validate(), "invalid query stats log storage config")
+}
+
+// Writer buffers the query stats records and periodically writes them to the object storage,
+// partitioned by tenant and hour.
+type Writer struct {
+	services.Service
+
+	cfg    Config
+	bucket objstore.Bucket
+	logger log.Logger
+
+	mtx     sync.Mutex
+	records []Record
+
+	recordsDiscarded prometheus.Counter
+	recordsWritten   prometheus.Counter
+	writeFailures    prometheus.Counter
+}
+
+// NewWriter creates a new Writer writing to the object storage configured in cfg.
+func NewWriter(cfg Config, logger log.Logger, reg prometheus.Registerer) (*Writer, error) {
+	bkt, err := bucket.NewClient(context.Background(), cfg.Storage, "query-stats-log", logger, reg)
+	if err != nil {
+		return nil, errors.Wrap(err, "create query stats log bucket client")
+	}
+	return newWriter(cfg, bkt, logger, reg), nil
+}
+
+func newWriter(cfg Config, bkt objstore.Bucket, logger log.Logger, reg prometheus.Registerer) *Writer {
+	w := &Writer{
+		cfg:    cfg,
+		bucket: bkt,
+		logger: logger,
+
+		recordsDiscarded: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_query_stats_log_records_discarded_total",
+			Help: "Total number of query stats records discarded because the buffer was full or the write to the object storage failed.",
+		}),
+		recordsWritten: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_query_stats_log_records_written_total",
+			Help: "Total number of query stats records written to the object storage.",
+		}),
+		writeFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_query_stats_log_write_failures_total",
+			Help: "Total number of failed writes of query stats files to the object storage.",
+		}),
+	}
+
+	w.Service = services.NewTimerService(cfg.FlushInterval, nil, w.iteration, w.stopping)
+	return w
+}
+
+// Add buffers the record, to be written to the object storage at the next flush.
+func (w *Writer) Add(record Record) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if len(w.records) >= w.cfg.MaxBufferedRecords {
+		w.recordsDiscarded.Inc()
+		return
+	}
+	w.records = append(w.records, record)
+}
+
+func (w *Writer) iteration(ctx context.Context) error {
+	w.flush(ctx)
+	return nil
+}
+
+func (w *Writer) stopping(_ error) error {
+	// Write the records buffered since the last flush.
+	w.flush(context.Background())
+	return nil
+}
+
+type partition struct {
+	tenant string
+	hour   time.Time
+}
+
+func (w *Writer) flush(ctx context.Context) {
+	w.mtx.Lock()
+	records := w.records
+	w.records = nil
+	w.mtx.Unlock()
+
+	partitions := map[partition][]Record{}
+	for _, r := range records {
+		p := partition{tenant: r.Tenant, hour: r.Timestamp.UTC().Truncate(time.Hour)}
+		partitions[p] = append(partitions[p], r)
+	}
+
+	for p, records := range partitions {
+		if err := w.write(ctx, p, records); err != nil {
+			level.Warn(w.logger).Log("msg", "failed to write query stats to the object storage", "user", p.tenant, "records", len(records), "err", err)
+			w.writeFailures.Inc()
+			w.recordsDiscarded.Add(float64(len(records)))
+			continue
+		}
+		w.recordsWritten.Add(float64(len(records)))
+	}
+}
+
+func (w *Writer) write(ctx context.Context, p partition, records []Record) error {
+	buf := bytes.Buffer{}
+	if err := EncodeRecords(&buf, records); err != nil {
+		return err
+	}
+
+	name := path.Join(PartitionPrefix(p.tenant, p.hour), ulid.MustNew(ulid.Now(), rand.Reader).String()+FileExtension)
+	return w.bucket.Upload(ctx, name, &buf)
+}
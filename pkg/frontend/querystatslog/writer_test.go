@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querystatslog
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestWriter(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	reg := prometheus.NewPedanticRegistry()
+	w := newWriter(Config{FlushInterval: time.Minute, MaxBufferedRecords: 3}, bkt, log.NewNopLogger(), reg)
+
+	hour := time.Date(2023, 5, 10, 14, 0, 0, 0, time.UTC)
+	w.Add(Record{Timestamp: hour.Add(time.Minute), Tenant: "user-1", Query: "a"})
+	w.Add(Record{Timestamp: hour.Add(2 * time.Minute), Tenant: "user-1", Query: "b"})
+	w.Add(Record{Timestamp: hour.Add(time.Hour), Tenant: "user-2", Query: "c"})
+
+	// The buffer is full.
+	w.Add(Record{Timestamp: hour, Tenant: "user-2", Query: "d"})
+
+	w.flush(context.Background())
+
+	// Records are written to one file per tenant and hour.
+	files := map[string][]string{}
+	for name, content := range bkt.Objects() {
+		assert.True(t, strings.HasSuffix(name, FileExtension))
+
+		records, err := DecodeRecords(strings.NewReader(string(content)))
+		require.NoError(t, err)
+
+		prefix := name[:strings.LastIndex(name, "/")+1]
+		for _, r := range records {
+			files[prefix] = append(files[prefix], r.Query)
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		"user-1/2023-05-10T14/": {"a", "b"},
+		"user-2/2023-05-10T15/": {"c"},
+	}, files)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_query_stats_log_records_discarded_total Total number of query stats records discarded because the buffer was full or the write to the object storage failed.
+		# TYPE cortex_query_frontend_query_stats_log_records_discarded_total counter
+		cortex_query_frontend_query_stats_log_records_discarded_total 1
+		# HELP cortex_query_frontend_query_stats_log_records_written_total Total number of query stats records written to the object storage.
+		# TYPE cortex_query_frontend_query_stats_log_records_written_total counter
+		cortex_query_frontend_query_stats_log_records_written_total 3
+	`), "cortex_query_frontend_query_stats_log_records_discarded_total", "cortex_query_frontend_query_stats_log_records_written_total"))
+
+	// The buffer has been emptied by the flush.
+	w.Add(Record{Timestamp: hour, Tenant: "user-2", Query: "d"})
+	assert.Len(t, w.records, 1)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := Config{}
+	assert.NoError(t, cfg.Validate())
+
+	cfg = Config{Enabled: true, MaxBufferedRecords: 1}
+	cfg.Storage.Backend = "filesystem"
+	assert.EqualError(t, cfg.Validate(), "the query stats log flush interval must be greater than 0")
+
+	cfg.FlushInterval = time.Minute
+	assert.NoError(t, cfg.Validate())
+}
@@ -28,7 +28,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/frontend/querystatslog"
 	querier_stats "github.com/grafana/mimir/pkg/querier/stats"
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/activitytracker"
 	util_log "github.com/grafana/mimir/pkg/util/log"
@@ -52,6 +54,8 @@ type HandlerConfig struct {
 	LogQueryRequestHeaders flagext.StringSliceCSV `yaml:"log_query_request_headers" category:"advanced"`
 	MaxBodySize            int64                  `yaml:"max_body_size" category:"advanced"`
 	QueryStatsEnabled      bool                   `yaml:"query_stats_enabled" category:"advanced"`
+
+	ServerTimingQueryStatsEnabled bool `yaml:"server_timing_query_stats_enabled" category:"experimental"`
 }
 
 func (cfg *HandlerConfig) RegisterFlags(f *flag.FlagSet) {
@@ -59,6 +63,12 @@ func (cfg *HandlerConfig) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&cfg.LogQueryRequestHeaders, "query-frontend.log-query-request-headers", "Comma-separated list of request header names to include in query logs. Applies to both query stats and slow queries logs.")
 	f.Int64Var(&cfg.MaxBodySize, "query-frontend.max-body-size", 10*1024*1024, "Max body size for downstream prometheus.")
 	f.BoolVar(&cfg.QueryStatsEnabled, "query-frontend.query-stats-enabled", true, "False to disable query statistics tracking. When enabled, a message with some statistics is logged for every query.")
+	f.BoolVar(&cfg.ServerTimingQueryStatsEnabled, "query-frontend.server-timing-query-stats-enabled", false, "True to include the samples processed by the query and the time spent waiting for store-gateways and ingesters in the Server-Timing response header. Requires query statistics tracking to be enabled.")
+}
+
+// QueryStatsLog receives the statistics of the queries, in addition to the query stats log line.
+type QueryStatsLog interface {
+	Add(record querystatslog.Record)
 }
 
 // Handler accepts queries and forwards them to RoundTripper. It can wait on in-flight requests and log slow queries,
@@ -68,6 +78,7 @@ type Handler struct {
 	log          log.Logger
 	roundTripper http.RoundTripper
 	at           *activitytracker.ActivityTracker
+	statsLog     QueryStatsLog
 
 	// Metrics.
 	querySeconds    *prometheus.CounterVec
@@ -83,13 +94,14 @@ type Handler struct {
 	cond             *sync.Cond
 }
 
-// NewHandler creates a new frontend handler.
-func NewHandler(cfg HandlerConfig, roundTripper http.RoundTripper, log log.Logger, reg prometheus.Registerer, at *activitytracker.ActivityTracker) *Handler {
+// NewHandler creates a new frontend handler. The statsLog is optional.
+func NewHandler(cfg HandlerConfig, roundTripper http.RoundTripper, log log.Logger, reg prometheus.Registerer, at *activitytracker.ActivityTracker, statsLog QueryStatsLog) *Handler {
 	h := &Handler{
 		cfg:          cfg,
 		log:          log,
 		roundTripper: roundTripper,
 		at:           at,
+		statsLog:     statsLog,
 	}
 	h.cond = sync.NewCond(&h.mtx)
 
@@ -174,6 +186,10 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r = r.WithContext(ctx)
 	}
 
+	// Propagate the priority of the query down the request chain, up to the queue
+	// in the query-frontend or query-scheduler.
+	r = r.WithContext(queue.ContextWithPriority(r.Context(), queue.PriorityFromHTTPRequest(r)))
+
 	// Ensure to close the request body reader.
 	defer func() { _ = r.Body.Close() }()
 
@@ -205,7 +221,7 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if f.cfg.QueryStatsEnabled {
-		writeServiceTimingHeader(queryResponseTime, hs, stats)
+		writeServiceTimingHeader(queryResponseTime, hs, stats, f.cfg.ServerTimingQueryStatsEnabled)
 	}
 
 	w.WriteHeader(resp.StatusCode)
@@ -277,14 +293,19 @@ func (f *Handler) reportQueryStats(r *http.Request, queryString url.Values, quer
 		"sharded_queries", stats.LoadShardedQueries(),
 		"split_queries", stats.LoadSplitQueries(),
 		"estimated_series_count", stats.GetEstimatedSeriesCount(),
+		"samples_processed", stats.LoadSamplesProcessed(),
+		"peak_samples", stats.LoadPeakSamples(),
+		"store_gateway_time_seconds", stats.LoadStoreGatewayTime().Seconds(),
+		"ingester_time_seconds", stats.LoadIngesterTime().Seconds(),
 	}, formatQueryString(queryString)...)
 
 	if len(f.cfg.LogQueryRequestHeaders) != 0 {
 		logMessage = append(logMessage, formatRequestHeaders(&r.Header, f.cfg.LogQueryRequestHeaders)...)
 	}
 
+	logStatus := "success"
 	if queryErr != nil {
-		logStatus := "failed"
+		logStatus = "failed"
 		if errors.Is(queryErr, context.Canceled) {
 			logStatus = "canceled"
 		} else if errors.Is(queryErr, context.DeadlineExceeded) {
@@ -296,10 +317,44 @@ func (f *Handler) reportQueryStats(r *http.Request, queryString url.Values, quer
 			"err", queryErr)
 	} else {
 		logMessage = append(logMessage,
-			"status", "success")
+			"status", logStatus)
 	}
 
 	level.Info(util_log.WithContext(r.Context(), f.log)).Log(logMessage...)
+
+	if f.statsLog != nil {
+		record := querystatslog.Record{
+			Timestamp:            time.Now(),
+			Tenant:               userID,
+			Method:               r.Method,
+			Path:                 r.URL.Path,
+			UserAgent:            r.UserAgent(),
+			Query:                queryString.Get("query"),
+			Start:                queryString.Get("start"),
+			End:                  queryString.Get("end"),
+			Time:                 queryString.Get("time"),
+			Step:                 queryString.Get("step"),
+			Status:               logStatus,
+			ResponseTime:         queryResponseTime.Seconds(),
+			ResponseSizeBytes:    queryResponseSizeBytes,
+			WallTime:             wallTime.Seconds(),
+			FetchedSeriesCount:   numSeries,
+			FetchedChunkBytes:    numBytes,
+			FetchedChunksCount:   numChunks,
+			FetchedIndexBytes:    numIndexBytes,
+			ShardedQueries:       stats.LoadShardedQueries(),
+			SplitQueries:         stats.LoadSplitQueries(),
+			EstimatedSeriesCount: stats.GetEstimatedSeriesCount(),
+			SamplesProcessed:     stats.LoadSamplesProcessed(),
+			PeakSamples:          stats.LoadPeakSamples(),
+			StoreGatewayTime:     stats.LoadStoreGatewayTime().Seconds(),
+			IngesterTime:         stats.LoadIngesterTime().Seconds(),
+		}
+		if queryErr != nil {
+			record.Error = queryErr.Error()
+		}
+		f.statsLog.Add(record)
+	}
 }
 
 func formatQueryString(queryString url.Values) (fields []interface{}) {
@@ -339,11 +394,17 @@ func writeError(w http.ResponseWriter, err error) {
 	server.WriteError(w, err)
 }
 
-func writeServiceTimingHeader(queryResponseTime time.Duration, headers http.Header, stats *querier_stats.Stats) {
+func writeServiceTimingHeader(queryResponseTime time.Duration, headers http.Header, stats *querier_stats.Stats, includeQueryStats bool) {
 	if stats != nil {
 		parts := make([]string, 0)
 		parts = append(parts, statsValue("querier_wall_time", stats.LoadWallTime()))
 		parts = append(parts, statsValue("response_time", queryResponseTime))
+		if includeQueryStats {
+			parts = append(parts, statsValue("store_gateway_time", stats.LoadStoreGatewayTime()))
+			parts = append(parts, statsValue("ingester_time", stats.LoadIngesterTime()))
+			parts = append(parts, countValue("samples_processed", stats.LoadSamplesProcessed()))
+			parts = append(parts, countValue("peak_samples", stats.LoadPeakSamples()))
+		}
 		headers.Set(ServiceTimingHeaderName, strings.Join(parts, ", "))
 	}
 }
@@ -353,6 +414,12 @@ func statsValue(name string, d time.Duration) string {
 	return name + ";dur=" + durationInMs
 }
 
+// countValue formats a count as a Server-Timing metric. Server-Timing metrics can only carry a duration,
+// so the count is set in the metric description.
+func countValue(name string, count uint64) string {
+	return name + ";desc=\"" + strconv.FormatUint(count, 10) + "\""
+}
+
 func httpRequestActivity(request *http.Request, requestParams url.Values) string {
 	tenantID := "(unknown)"
 	if tenantIDs, err := tenant.TenantIDs(request.Context()); err == nil {
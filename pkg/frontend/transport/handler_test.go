@@ -31,6 +31,8 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 
+	"github.com/grafana/mimir/pkg/frontend/querystatslog"
+	querier_stats "github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/util/activitytracker"
 )
 
@@ -149,7 +151,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			t.Cleanup(func() { require.NoError(t, at.Close()) })
 
 			logger := &testLogger{}
-			handler := NewHandler(tt.cfg, roundTripper, logger, reg, at)
+			handler := NewHandler(tt.cfg, roundTripper, logger, reg, at, nil)
 
 			req := tt.request().WithContext(user.InjectOrgID(context.Background(), "12345"))
 			resp := httptest.NewRecorder()
@@ -178,7 +180,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 				require.Len(t, logger.logMessages, 1)
 
 				msg := logger.logMessages[0]
-				require.Len(t, msg, 18+len(tt.expectedParams))
+				require.Len(t, msg, 22+len(tt.expectedParams))
 				require.Equal(t, level.InfoValue(), msg["level"])
 				require.Equal(t, "query stats", msg["msg"])
 				require.Equal(t, "query-frontend", msg["component"])
@@ -197,6 +199,10 @@ func TestHandler_ServeHTTP(t *testing.T) {
 				require.EqualValues(t, 0, msg["sharded_queries"])
 				require.EqualValues(t, 0, msg["split_queries"])
 				require.EqualValues(t, 0, msg["estimated_series_count"])
+				require.EqualValues(t, 0, msg["samples_processed"])
+				require.EqualValues(t, 0, msg["peak_samples"])
+				require.EqualValues(t, 0, msg["store_gateway_time_seconds"])
+				require.EqualValues(t, 0, msg["ingester_time_seconds"])
 
 				for name, values := range tt.expectedParams {
 					logMessageKey := fmt.Sprintf("param_%v", name)
@@ -244,7 +250,7 @@ func TestHandler_FailedRoundTrip(t *testing.T) {
 			reg := prometheus.NewPedanticRegistry()
 			logs := &concurrency.SyncBuffer{}
 			logger := log.NewLogfmtLogger(logs)
-			handler := NewHandler(test.cfg, roundTripper, logger, reg, nil)
+			handler := NewHandler(test.cfg, roundTripper, logger, reg, nil, nil)
 
 			ctx := user.InjectOrgID(context.Background(), "12345")
 			req := httptest.NewRequest("GET", test.path, nil)
@@ -275,6 +281,68 @@ func TestHandler_FailedRoundTrip(t *testing.T) {
 	}
 }
 
+func TestHandler_QueryStatsLog(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		queryErr       error
+		expectedStatus string
+		expectedError  string
+	}{
+		{
+			name:           "successful query",
+			expectedStatus: "success",
+		},
+		{
+			name:           "failed query",
+			queryErr:       context.DeadlineExceeded,
+			expectedStatus: "timeout",
+			expectedError:  context.DeadlineExceeded.Error(),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			roundTripper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if test.queryErr != nil {
+					return nil, test.queryErr
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader("{}")),
+				}, nil
+			})
+
+			statsLog := &mockQueryStatsLog{}
+			handler := NewHandler(HandlerConfig{QueryStatsEnabled: true}, roundTripper, log.NewNopLogger(), prometheus.NewPedanticRegistry(), nil, statsLog)
+
+			req := httptest.NewRequest("GET", "/api/v1/query_range?query=up&start=1&end=100&step=10", nil)
+			req.Header.Set("User-Agent", "test-user-agent")
+			req = req.WithContext(user.InjectOrgID(context.Background(), "12345"))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			require.Len(t, statsLog.records, 1)
+			record := statsLog.records[0]
+			assert.Equal(t, "12345", record.Tenant)
+			assert.Equal(t, "GET", record.Method)
+			assert.Equal(t, "/api/v1/query_range", record.Path)
+			assert.Equal(t, "test-user-agent", record.UserAgent)
+			assert.Equal(t, "up", record.Query)
+			assert.Equal(t, "1", record.Start)
+			assert.Equal(t, "100", record.End)
+			assert.Equal(t, "10", record.Step)
+			assert.Equal(t, test.expectedStatus, record.Status)
+			assert.Equal(t, test.expectedError, record.Error)
+			assert.False(t, record.Timestamp.IsZero())
+		})
+	}
+}
+
+type mockQueryStatsLog struct {
+	records []querystatslog.Record
+}
+
+func (m *mockQueryStatsLog) Add(record querystatslog.Record) {
+	m.records = append(m.records, record)
+}
+
 // Test Handler.Stop.
 func TestHandler_Stop(t *testing.T) {
 	const (
@@ -296,7 +364,7 @@ func TestHandler_Stop(t *testing.T) {
 	reg := prometheus.NewPedanticRegistry()
 	cfg := HandlerConfig{MaxBodySize: 1024}
 	logger := &testLogger{}
-	handler := NewHandler(cfg, roundTripper, logger, reg, nil)
+	handler := NewHandler(cfg, roundTripper, logger, reg, nil, nil)
 
 	var wg sync.WaitGroup
 	for i := 0; i < requests; i++ {
@@ -394,3 +462,20 @@ func TestFormatRequestHeaders(t *testing.T) {
 
 	assert.Equal(t, expected, fields)
 }
+
+func TestWriteServiceTimingHeader(t *testing.T) {
+	stats := &querier_stats.Stats{}
+	stats.AddWallTime(3 * time.Second)
+	stats.AddStoreGatewayTime(1500 * time.Millisecond)
+	stats.AddIngesterTime(500 * time.Millisecond)
+	stats.AddSamplesProcessed(1000)
+	stats.UpdatePeakSamples(100)
+
+	headers := http.Header{}
+	writeServiceTimingHeader(time.Second, headers, stats, false)
+	assert.Equal(t, "querier_wall_time;dur=3000, response_time;dur=1000", headers.Get(ServiceTimingHeaderName))
+
+	headers = http.Header{}
+	writeServiceTimingHeader(time.Second, headers, stats, true)
+	assert.Equal(t, `querier_wall_time;dur=3000, response_time;dur=1000, store_gateway_time;dur=1500, ingester_time;dur=500, samples_processed;desc="1000", peak_samples;desc="100"`, headers.Get(ServiceTimingHeaderName))
+}
@@ -10,6 +10,7 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-kit/log"
@@ -38,17 +39,29 @@ var (
 type Config struct {
 	MaxOutstandingPerTenant int           `yaml:"max_outstanding_per_tenant" category:"advanced"`
 	QuerierForgetDelay      time.Duration `yaml:"querier_forget_delay" category:"experimental"`
+	DequeuePolicy           string        `yaml:"dequeue_policy" category:"experimental"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.MaxOutstandingPerTenant, "querier.max-outstanding-requests-per-tenant", 100, "Maximum number of outstanding requests per tenant per frontend; requests beyond this error with HTTP 429.")
 	f.DurationVar(&cfg.QuerierForgetDelay, "query-frontend.querier-forget-delay", 0, "If a querier disconnects without sending notification about graceful shutdown, the query-frontend will keep the querier in the tenant's shard until the forget delay has passed. This feature is useful to reduce the blast radius when shuffle-sharding is enabled.")
+	f.StringVar(&cfg.DequeuePolicy, "query-frontend.dequeue-policy", queue.RoundRobinDequeuePolicy, fmt.Sprintf("Policy used to choose the tenant whose queued request is dispatched next to a querier. Supported values are: %s. The %s and %s policies use the per-tenant query scheduling weight.", strings.Join(queue.DequeuePolicies, ", "), queue.WeightedFairDequeuePolicy, queue.QuerierTimeFairDequeuePolicy))
+}
+
+func (cfg *Config) Validate() error {
+	if !util.StringsContain(queue.DequeuePolicies, cfg.DequeuePolicy) {
+		return fmt.Errorf("unsupported query-frontend dequeue policy (supported values are: %s)", strings.Join(queue.DequeuePolicies, ", "))
+	}
+	return nil
 }
 
 type Limits interface {
 	// Returns max queriers to use per tenant, or 0 if shuffle sharding is disabled.
 	MaxQueriersPerUser(user string) int
+
+	// QuerySchedulingWeight returns the weight of the tenant used by the weighted dequeue policies.
+	QuerySchedulingWeight(user string) float64
 }
 
 // Frontend queues HTTP requests, dispatches them to backends, and handles retries
@@ -75,6 +88,7 @@ type Frontend struct {
 }
 
 type request struct {
+	userID      string
 	enqueueTime time.Time
 	queueSpan   opentracing.Span
 	originalCtx context.Context
@@ -94,7 +108,7 @@ func New(cfg Config, limits Limits, log log.Logger, registerer prometheus.Regist
 		queueLength: promauto.With(registerer).NewGaugeVec(prometheus.GaugeOpts{
 			Name: "cortex_query_frontend_queue_length",
 			Help: "Number of queries in the queue.",
-		}, []string{"user"}),
+		}, []string{"user", "priority"}),
 		discardedRequests: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
 			Name: "cortex_query_frontend_discarded_requests_total",
 			Help: "Total number of query requests discarded.",
@@ -111,10 +125,13 @@ func New(cfg Config, limits Limits, log log.Logger, registerer prometheus.Regist
 		Help: "Time spent by requests waiting to join the queue or be rejected.",
 	})
 
-	f.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, f.queueLength, f.discardedRequests, enqueueDuration)
+	dequeuePolicy, err := queue.NewDequeuePolicy(cfg.DequeuePolicy, limits)
+	if err != nil {
+		return nil, err
+	}
+	f.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, dequeuePolicy, f.queueLength, f.discardedRequests, enqueueDuration)
 	f.activeUsers = util.NewActiveUsersCleanupWithDefaultValues(f.cleanupInactiveUserMetrics)
 
-	var err error
 	f.subservices, err = services.NewManager(f.requestQueue, f.activeUsers)
 	if err != nil {
 		return nil, err
@@ -156,7 +173,7 @@ func (f *Frontend) stopping(_ error) error {
 }
 
 func (f *Frontend) cleanupInactiveUserMetrics(user string) {
-	f.queueLength.DeleteLabelValues(user)
+	f.queueLength.DeletePartialMatch(prometheus.Labels{"user": user})
 	f.discardedRequests.DeleteLabelValues(user)
 }
 
@@ -235,10 +252,13 @@ func (f *Frontend) Process(server frontendv1pb.Frontend_ProcessServer) error {
 		  it's possible that it's own queue would perpetually contain only expired requests.
 		*/
 		if req.originalCtx.Err() != nil {
+			f.requestQueue.RequestCompleted(req.userID, 0)
 			lastUserIndex = lastUserIndex.ReuseLastUser()
 			continue
 		}
 
+		start := time.Now()
+
 		// Handle the stream sending & receiving on a goroutine so we can
 		// monitoring the contexts in a select and cancel things appropriately.
 		resps := make(chan *frontendv1pb.ClientToFrontend, 1)
@@ -268,16 +288,26 @@ func (f *Frontend) Process(server frontendv1pb.Frontend_ProcessServer) error {
 		// downstream req.  Only way we can do that is to close the stream.
 		// The worker client is expecting this semantics.
 		case <-req.originalCtx.Done():
+			f.requestQueue.RequestCompleted(req.userID, time.Since(start))
 			return req.originalCtx.Err()
 
 		// Is there was an error handling this request due to network IO,
 		// then error out this upstream request _and_ stream.
 		case err := <-errs:
+			f.requestQueue.RequestCompleted(req.userID, time.Since(start))
 			req.err <- err
 			return err
 
 		// Happy path: merge the stats and propagate the response.
 		case resp := <-resps:
+			// Prefer the wall time reported by the querier, and fall back to the time until the response
+			// is received if the querier doesn't report it.
+			querierTime := time.Since(start)
+			if wallTime := resp.Stats.LoadWallTime(); wallTime > 0 {
+				querierTime = wallTime
+			}
+			f.requestQueue.RequestCompleted(req.userID, querierTime)
+
 			if stats.ShouldTrackHTTPGRPCResponse(resp.HttpResponse) {
 				stats := stats.FromContext(req.originalCtx)
 				stats.Merge(resp.Stats) // Safe if stats is nil.
@@ -333,8 +363,9 @@ func (f *Frontend) queueRequest(ctx context.Context, req *request) error {
 
 	joinedTenantID := tenant.JoinTenantIDs(tenantIDs)
 	f.activeUsers.UpdateUserTimestamp(joinedTenantID, now)
+	req.userID = joinedTenantID
 
-	err = f.requestQueue.EnqueueRequest(joinedTenantID, req, maxQueriers, nil)
+	err = f.requestQueue.EnqueueRequest(joinedTenantID, req, queue.PriorityFromContext(ctx), maxQueriers, nil)
 	if errors.Is(err, queue.ErrTooManyRequests) {
 		return errTooManyRequest
 	}
@@ -132,8 +132,8 @@ func TestFrontendCheckReady(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			f := &Frontend{
 				log: log.NewNopLogger(),
-				requestQueue: queue.NewRequestQueue(5, 0,
-					promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+				requestQueue: queue.NewRequestQueue(5, 0, queue.NewRoundRobinDequeuePolicy(),
+					promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"}),
 					promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
 					promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
 				),
@@ -211,7 +211,7 @@ func TestFrontendMetricsCleanup(t *testing.T) {
 		require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
 				# HELP cortex_query_frontend_queue_length Number of queries in the queue.
 				# TYPE cortex_query_frontend_queue_length gauge
-				cortex_query_frontend_queue_length{user="1"} 0
+				cortex_query_frontend_queue_length{priority="adhoc",user="1"} 0
 			`), "cortex_query_frontend_queue_length"))
 
 		fr.cleanupInactiveUserMetrics("1")
@@ -267,7 +267,7 @@ func testFrontend(t *testing.T, config Config, handler http.Handler, test func(a
 	r.PathPrefix("/").Handler(middleware.Merge(
 		middleware.AuthenticateUser,
 		middleware.Tracer{},
-	).Wrap(transport.NewHandler(handlerCfg, rt, logger, nil, nil)))
+	).Wrap(transport.NewHandler(handlerCfg, rt, logger, nil, nil, nil)))
 
 	httpServer := http.Server{
 		Handler: r,
@@ -300,3 +300,7 @@ type limits struct {
 func (l limits) MaxQueriersPerUser(_ string) int {
 	return l.queriers
 }
+
+func (l limits) QuerySchedulingWeight(_ string) float64 {
+	return 1
+}
@@ -30,6 +30,7 @@ import (
 
 	"github.com/grafana/mimir/pkg/frontend/v2/frontendv2pb"
 	"github.com/grafana/mimir/pkg/querier/stats"
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/scheduler/schedulerdiscovery"
 	"github.com/grafana/mimir/pkg/util/httpgrpcutil"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
@@ -97,6 +98,7 @@ type frontendRequest struct {
 	request      *httpgrpc.HTTPRequest
 	userID       string
 	statsEnabled bool
+	priority     string
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -210,6 +212,7 @@ func (f *Frontend) RoundTripGRPC(ctx context.Context, req *httpgrpc.HTTPRequest)
 		request:      req,
 		userID:       userID,
 		statsEnabled: stats.IsEnabled(ctx),
+		priority:     queue.PriorityFromContext(ctx),
 
 		ctx:    ctx,
 		cancel: cancel,
@@ -373,6 +373,7 @@ func (w *frontendSchedulerWorker) enqueueRequest(loop schedulerpb.SchedulerForFr
 		HttpRequest:     req.request,
 		FrontendAddress: w.frontendAddr,
 		StatsEnabled:    req.statsEnabled,
+		Priority:        req.priority,
 	})
 	w.enqueuedRequests.Inc()
 
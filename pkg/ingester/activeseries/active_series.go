@@ -16,6 +16,8 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/util/zeropool"
 	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/costattribution"
 )
 
 const (
@@ -42,9 +44,10 @@ type ActiveSeries struct {
 	stripes [numStripes]seriesStripe
 	deleted deletedSeries
 
-	// matchersMutex protects matchers and lastMatchersUpdate.
+	// matchersMutex protects matchers, costAttribution and lastMatchersUpdate.
 	matchersMutex      sync.RWMutex
 	matchers           *Matchers
+	costAttribution    *costattribution.Tracker
 	lastMatchersUpdate time.Time
 
 	// The duration after which series become inactive.
@@ -54,7 +57,8 @@ type ActiveSeries struct {
 
 // seriesStripe holds a subset of the series timestamps for a single tenant.
 type seriesStripe struct {
-	matchers *Matchers
+	matchers        *Matchers
+	costAttribution *costattribution.Tracker
 
 	deleted *deletedSeries
 
@@ -71,6 +75,8 @@ type seriesStripe struct {
 	activeMatchingNativeHistograms       []uint32 // Number of active entries (only native histograms) in this stripe matching each matcher of the configured Matchers.
 	activeNativeHistogramBuckets         uint32   // Number of buckets in active native histogram entries in this stripe. Only decreased during purge or clear.
 	activeMatchingNativeHistogramBuckets []uint32 // Number of buckets in active native histogram entries in this stripe matching each matcher of the configured Matchers.
+
+	activeAttributed map[string]uint32 // Number of active entries in this stripe for each cost attribution.
 }
 
 // seriesEntry holds a timestamp for single series.
@@ -78,6 +84,7 @@ type seriesEntry struct {
 	nanos                     *atomic.Int64        // Unix timestamp in nanoseconds. Needs to be a pointer because we don't store pointers to entries in the stripe.
 	matches                   preAllocDynamicSlice //  Index of the matcher matching
 	numNativeHistogramBuckets int                  // Number of buckets in native histogram series, -1 if not a native histogram.
+	attribution               string               // Cost attribution of the series, empty if not attributed.
 
 	deleted bool // This series was marked as deleted, so before purging we need to remove the refence to it from the deletedSeries.
 }
@@ -87,7 +94,7 @@ func NewActiveSeries(asm *Matchers, timeout time.Duration) *ActiveSeries {
 
 	// Stripes are pre-allocated so that we only read on them and no lock is required.
 	for i := 0; i < numStripes; i++ {
-		c.stripes[i].reinitialize(asm, &c.deleted)
+		c.stripes[i].reinitialize(asm, nil, &c.deleted)
 	}
 
 	return c
@@ -104,12 +111,41 @@ func (c *ActiveSeries) ReloadMatchers(asm *Matchers, now time.Time) {
 	defer c.matchersMutex.Unlock()
 
 	for i := 0; i < numStripes; i++ {
-		c.stripes[i].reinitialize(asm, &c.deleted)
+		c.stripes[i].reinitialize(asm, c.costAttribution, &c.deleted)
 	}
 	c.matchers = asm
 	c.lastMatchersUpdate = now
 }
 
+// ReloadCostAttribution configures the tracker used to attribute the active series. A nil tracker disables
+// the cost attribution. Like ReloadMatchers, it resets the active series, so the results are valid
+// only after the idle timeout has passed.
+func (c *ActiveSeries) ReloadCostAttribution(tracker *costattribution.Tracker, now time.Time) {
+	c.matchersMutex.Lock()
+	defer c.matchersMutex.Unlock()
+
+	for i := 0; i < numStripes; i++ {
+		c.stripes[i].reinitialize(c.matchers, tracker, &c.deleted)
+	}
+	c.costAttribution = tracker
+	c.lastMatchersUpdate = now
+}
+
+// CostAttribution returns the tracker used to attribute the active series, or nil if the cost attribution is disabled.
+func (c *ActiveSeries) CostAttribution() *costattribution.Tracker {
+	c.matchersMutex.RLock()
+	defer c.matchersMutex.RUnlock()
+	return c.costAttribution
+}
+
+// CurrentCostAttribution returns the label and the max cardinality of the configured cost attribution,
+// or an empty label if the cost attribution is disabled.
+func (c *ActiveSeries) CurrentCostAttribution() (label string, maxCardinality int) {
+	c.matchersMutex.RLock()
+	defer c.matchersMutex.RUnlock()
+	return c.costAttribution.Label(), c.costAttribution.MaxCardinality()
+}
+
 func (c *ActiveSeries) CurrentConfig() CustomTrackersConfig {
 	c.matchersMutex.RLock()
 	defer c.matchersMutex.RUnlock()
@@ -118,16 +154,18 @@ func (c *ActiveSeries) CurrentConfig() CustomTrackersConfig {
 
 // UpdateSeries updates series timestamp to 'now'. Function is called to make a copy of labels if entry doesn't exist yet.
 // Pass -1 in numNativeHistogramBuckets if the series is not a native histogram series.
-func (c *ActiveSeries) UpdateSeries(series labels.Labels, ref storage.SeriesRef, now time.Time, numNativeHistogramBuckets int) {
+// It returns the cost attribution of the series, or an empty string if the series is not attributed.
+func (c *ActiveSeries) UpdateSeries(series labels.Labels, ref storage.SeriesRef, now time.Time, numNativeHistogramBuckets int) string {
 	stripeID := ref % numStripes
 
-	created := c.stripes[stripeID].updateSeriesTimestamp(now, series, ref, numNativeHistogramBuckets)
+	created, attribution := c.stripes[stripeID].updateSeriesTimestamp(now, series, ref, numNativeHistogramBuckets)
 	if created {
 		if deleted, ok := c.deleted.find(series); ok {
 			deletedStripeID := deleted.ref % numStripes
 			c.stripes[deletedStripeID].remove(deleted.ref)
 		}
 	}
+	return attribution
 }
 
 // PostDeletion should be called when series are deleted from the head.
@@ -152,6 +190,7 @@ func (c *ActiveSeries) Purge(now time.Time) bool {
 	defer c.matchersMutex.Unlock()
 	purgeTime := now.Add(-c.timeout)
 	c.purge(purgeTime)
+	c.purgeCostAttribution(now, purgeTime)
 
 	return !c.lastMatchersUpdate.After(purgeTime)
 }
@@ -163,6 +202,19 @@ func (c *ActiveSeries) purge(keepUntil time.Time) {
 	}
 }
 
+// purgeCostAttribution stops tracking the attributions without active series, unless they've been
+// assigned to a series after keepUntil.
+func (c *ActiveSeries) purgeCostAttribution(now, keepUntil time.Time) {
+	if c.costAttribution == nil {
+		return
+	}
+
+	for attribution := range c.activeByAttribution() {
+		c.costAttribution.Touch(attribution, now)
+	}
+	c.costAttribution.Purge(keepUntil)
+}
+
 func (c *ActiveSeries) ContainsRef(ref storage.SeriesRef) bool {
 	stripeID := ref % numStripes
 	return c.stripes[stripeID].containsRef(ref)
@@ -205,6 +257,23 @@ func (c *ActiveSeries) ActiveWithMatchers() (total int, totalMatching []int, tot
 	return
 }
 
+// ActiveByAttribution returns the number of active series for each cost attribution.
+// Series without an attribution are not included. This method does not purge
+// expired entries, so Purge should be called periodically.
+func (c *ActiveSeries) ActiveByAttribution() map[string]int {
+	c.matchersMutex.RLock()
+	defer c.matchersMutex.RUnlock()
+	return c.activeByAttribution()
+}
+
+func (c *ActiveSeries) activeByAttribution() map[string]int {
+	byAttribution := map[string]int{}
+	for s := 0; s < numStripes; s++ {
+		c.stripes[s].updateAttributed(byAttribution)
+	}
+	return byAttribution
+}
+
 func (s *seriesStripe) containsRef(ref storage.SeriesRef) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -259,13 +328,23 @@ func (s *seriesStripe) getTotalAndUpdateMatching(matching []int, matchingNativeH
 	return s.active, s.activeNativeHistograms, s.activeNativeHistogramBuckets
 }
 
-func (s *seriesStripe) updateSeriesTimestamp(now time.Time, series labels.Labels, ref storage.SeriesRef, numNativeHistogramBuckets int) bool {
+// updateAttributed adds the number of active series in the stripe for each cost attribution to the input map.
+func (s *seriesStripe) updateAttributed(byAttribution map[string]int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for attribution, active := range s.activeAttributed {
+		byAttribution[attribution] += int(active)
+	}
+}
+
+func (s *seriesStripe) updateSeriesTimestamp(now time.Time, series labels.Labels, ref storage.SeriesRef, numNativeHistogramBuckets int) (bool, string) {
 	nowNanos := now.UnixNano()
 
-	e, needsUpdating := s.findEntryForSeries(ref, numNativeHistogramBuckets)
+	e, attribution, needsUpdating := s.findEntryForSeries(ref, numNativeHistogramBuckets)
 	created := false
 	if e == nil || needsUpdating {
-		e, created = s.findAndUpdateOrCreateEntryForSeries(ref, series, nowNanos, numNativeHistogramBuckets)
+		e, attribution, created = s.findAndUpdateOrCreateEntryForSeries(ref, series, nowNanos, numNativeHistogramBuckets)
 	}
 
 	entryTimeSet := created
@@ -285,17 +364,17 @@ func (s *seriesStripe) updateSeriesTimestamp(now time.Time, series labels.Labels
 		}
 	}
 
-	return created
+	return created, attribution
 }
 
-func (s *seriesStripe) findEntryForSeries(ref storage.SeriesRef, numNativeHistogramBuckets int) (*atomic.Int64, bool) {
+func (s *seriesStripe) findEntryForSeries(ref storage.SeriesRef, numNativeHistogramBuckets int) (*atomic.Int64, string, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	entry := s.refs[ref]
-	return entry.nanos, entry.numNativeHistogramBuckets != numNativeHistogramBuckets
+	return entry.nanos, entry.attribution, entry.numNativeHistogramBuckets != numNativeHistogramBuckets
 }
 
-func (s *seriesStripe) findAndUpdateOrCreateEntryForSeries(ref storage.SeriesRef, series labels.Labels, nowNanos int64, numNativeHistogramBuckets int) (entryTime *atomic.Int64, created bool) {
+func (s *seriesStripe) findAndUpdateOrCreateEntryForSeries(ref storage.SeriesRef, series labels.Labels, nowNanos int64, numNativeHistogramBuckets int) (entryTime *atomic.Int64, attribution string, created bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -335,7 +414,7 @@ func (s *seriesStripe) findAndUpdateOrCreateEntryForSeries(ref storage.SeriesRef
 			entry.numNativeHistogramBuckets = numNativeHistogramBuckets
 			s.refs[ref] = entry
 		}
-		return entry.nanos, false
+		return entry.nanos, entry.attribution, false
 	}
 
 	matches := s.matchers.matches(series)
@@ -355,14 +434,22 @@ func (s *seriesStripe) findAndUpdateOrCreateEntryForSeries(ref storage.SeriesRef
 		}
 	}
 
+	if s.costAttribution != nil {
+		attribution = s.costAttribution.Attribution(series.Get(s.costAttribution.Label()), time.Unix(0, nowNanos))
+		if attribution != "" {
+			s.activeAttributed[attribution]++
+		}
+	}
+
 	e := seriesEntry{
 		nanos:                     atomic.NewInt64(nowNanos),
 		matches:                   matches,
 		numNativeHistogramBuckets: numNativeHistogramBuckets,
+		attribution:               attribution,
 	}
 
 	s.refs[ref] = e
-	return e.nanos, true
+	return e.nanos, attribution, true
 }
 
 // nolint // Linter reports that this method is unused, but it is.
@@ -380,10 +467,13 @@ func (s *seriesStripe) clear() {
 		s.activeMatchingNativeHistograms[i] = 0
 		s.activeMatchingNativeHistogramBuckets[i] = 0
 	}
+	for attribution := range s.activeAttributed {
+		delete(s.activeAttributed, attribution)
+	}
 }
 
-// Reinitialize assigns new matchers and corresponding size activeMatching slices.
-func (s *seriesStripe) reinitialize(asm *Matchers, deleted *deletedSeries) {
+// Reinitialize assigns new matchers and corresponding size activeMatching slices, and the new cost attribution tracker.
+func (s *seriesStripe) reinitialize(asm *Matchers, costAttribution *costattribution.Tracker, deleted *deletedSeries) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -397,6 +487,8 @@ func (s *seriesStripe) reinitialize(asm *Matchers, deleted *deletedSeries) {
 	s.activeMatching = resizeAndClear(len(asm.MatcherNames()), s.activeMatching)
 	s.activeMatchingNativeHistograms = resizeAndClear(len(asm.MatcherNames()), s.activeMatchingNativeHistograms)
 	s.activeMatchingNativeHistogramBuckets = resizeAndClear(len(asm.MatcherNames()), s.activeMatchingNativeHistogramBuckets)
+	s.costAttribution = costAttribution
+	s.activeAttributed = map[string]uint32{}
 }
 
 func (s *seriesStripe) purge(keepUntil time.Time) {
@@ -415,6 +507,9 @@ func (s *seriesStripe) purge(keepUntil time.Time) {
 	s.activeMatching = resizeAndClear(len(s.activeMatching), s.activeMatching)
 	s.activeMatchingNativeHistograms = resizeAndClear(len(s.activeMatchingNativeHistograms), s.activeMatchingNativeHistograms)
 	s.activeMatchingNativeHistogramBuckets = resizeAndClear(len(s.activeMatchingNativeHistogramBuckets), s.activeMatchingNativeHistogramBuckets)
+	for attribution := range s.activeAttributed {
+		delete(s.activeAttributed, attribution)
+	}
 
 	oldest := int64(math.MaxInt64)
 	for ref, entry := range s.refs {
@@ -441,6 +536,9 @@ func (s *seriesStripe) purge(keepUntil time.Time) {
 				s.activeMatchingNativeHistogramBuckets[match] += uint32(entry.numNativeHistogramBuckets)
 			}
 		}
+		if entry.attribution != "" {
+			s.activeAttributed[entry.attribution]++
+		}
 		if ts < oldest {
 			oldest = ts
 		}
@@ -483,6 +581,11 @@ func (s *seriesStripe) remove(ref storage.SeriesRef) {
 			s.activeMatchingNativeHistogramBuckets[match] -= uint32(entry.numNativeHistogramBuckets)
 		}
 	}
+	if entry.attribution != "" {
+		if s.activeAttributed[entry.attribution]--; s.activeAttributed[entry.attribution] == 0 {
+			delete(s.activeAttributed, entry.attribution)
+		}
+	}
 
 	s.deleted.purge(ref)
 	delete(s.refs, ref)
@@ -18,6 +18,8 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/costattribution"
 )
 
 const DefaultTimeout = 5 * time.Minute
@@ -654,6 +656,55 @@ func TestActiveSeries_ReloadSeriesMatchers(t *testing.T) {
 	assert.Equal(t, []int{0, 1}, activeMatching)
 }
 
+func TestActiveSeries_CostAttribution(t *testing.T) {
+	ref1, ls1 := storage.SeriesRef(1), labels.FromStrings("a", "1", "team", "a")
+	ref2, ls2 := storage.SeriesRef(2), labels.FromStrings("a", "2", "team", "a")
+	ref3, ls3 := storage.SeriesRef(3), labels.FromStrings("a", "3", "team", "b")
+	ref4, ls4 := storage.SeriesRef(4), labels.FromStrings("a", "4", "team", "c")
+	ref5, ls5 := storage.SeriesRef(5), labels.FromStrings("a", "5")
+
+	currentTime := time.Now()
+	c := NewActiveSeries(&Matchers{}, DefaultTimeout)
+
+	c.ReloadCostAttribution(costattribution.NewTracker("team", 2), currentTime)
+	label, maxCardinality := c.CurrentCostAttribution()
+	assert.Equal(t, "team", label)
+	assert.Equal(t, 2, maxCardinality)
+
+	// The results are valid only after the timeout since the reload.
+	assert.False(t, c.Purge(currentTime))
+	currentTime = currentTime.Add(DefaultTimeout)
+
+	c.UpdateSeries(ls1, ref1, currentTime, -1)
+	c.UpdateSeries(ls2, ref2, currentTime, -1)
+	c.UpdateSeries(ls3, ref3, currentTime, -1)
+	c.UpdateSeries(ls4, ref4, currentTime, -1)
+	c.UpdateSeries(ls5, ref5, currentTime, -1)
+	assert.True(t, c.Purge(currentTime))
+
+	// The series exceeding the max cardinality are attributed to the overflow value,
+	// while the series without the label aren't attributed.
+	assert.Equal(t, map[string]int{"a": 2, "b": 1, costattribution.OverflowValue: 1}, c.ActiveByAttribution())
+
+	// Series of attribution "b" become inactive, making room for a new value.
+	currentTime = currentTime.Add(DefaultTimeout)
+	c.UpdateSeries(ls1, ref1, currentTime, -1)
+	c.UpdateSeries(ls4, ref4, currentTime, -1)
+	assert.True(t, c.Purge(currentTime.Add(time.Second)))
+	assert.Equal(t, map[string]int{"a": 1, costattribution.OverflowValue: 1}, c.ActiveByAttribution())
+
+	ref6, ls6 := storage.SeriesRef(6), labels.FromStrings("a", "6", "team", "d")
+	c.UpdateSeries(ls6, ref6, currentTime, -1)
+	assert.Equal(t, map[string]int{"a": 1, "d": 1, costattribution.OverflowValue: 1}, c.ActiveByAttribution())
+
+	// Disabling the cost attribution.
+	c.ReloadCostAttribution(nil, currentTime)
+	c.UpdateSeries(ls1, ref1, currentTime, -1)
+	label, _ = c.CurrentCostAttribution()
+	assert.Equal(t, "", label)
+	assert.Empty(t, c.ActiveByAttribution())
+}
+
 func TestActiveSeries_ReloadSeriesMatchers_LessMatchers(t *testing.T) {
 	ref1, ls1 := storage.SeriesRef(1), labels.FromStrings("a", "1")
 
@@ -1479,6 +1479,144 @@ func (m *UsersStatsResponse) GetStats() []*UserIDStatsResponse {
 	return nil
 }
 
+type CostAttributionRequest struct {
+}
+
+func (m *CostAttributionRequest) Reset()      { *m = CostAttributionRequest{} }
+func (*CostAttributionRequest) ProtoMessage() {}
+func (*CostAttributionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60f6df4f3586b478, []int{26}
+}
+func (m *CostAttributionRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *CostAttributionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_CostAttributionRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *CostAttributionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CostAttributionRequest.Merge(m, src)
+}
+func (m *CostAttributionRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *CostAttributionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CostAttributionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CostAttributionRequest proto.InternalMessageInfo
+
+type CostAttributionResponse struct {
+	Items []*CostAttributionItem `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+}
+
+func (m *CostAttributionResponse) Reset()      { *m = CostAttributionResponse{} }
+func (*CostAttributionResponse) ProtoMessage() {}
+func (*CostAttributionResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60f6df4f3586b478, []int{27}
+}
+func (m *CostAttributionResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *CostAttributionResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_CostAttributionResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *CostAttributionResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CostAttributionResponse.Merge(m, src)
+}
+func (m *CostAttributionResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *CostAttributionResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_CostAttributionResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CostAttributionResponse proto.InternalMessageInfo
+
+func (m *CostAttributionResponse) GetItems() []*CostAttributionItem {
+	if m != nil {
+		return m.Items
+	}
+	return nil
+}
+
+type CostAttributionItem struct {
+	Attribution  string `protobuf:"bytes,1,opt,name=attribution,proto3" json:"attribution,omitempty"`
+	ActiveSeries uint64 `protobuf:"varint,2,opt,name=active_series,json=activeSeries,proto3" json:"active_series,omitempty"`
+	// ingested_samples is the number of samples ingested since the attribution is tracked.
+	IngestedSamples uint64 `protobuf:"varint,3,opt,name=ingested_samples,json=ingestedSamples,proto3" json:"ingested_samples,omitempty"`
+}
+
+func (m *CostAttributionItem) Reset()      { *m = CostAttributionItem{} }
+func (*CostAttributionItem) ProtoMessage() {}
+func (*CostAttributionItem) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60f6df4f3586b478, []int{28}
+}
+func (m *CostAttributionItem) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *CostAttributionItem) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_CostAttributionItem.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *CostAttributionItem) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CostAttributionItem.Merge(m, src)
+}
+func (m *CostAttributionItem) XXX_Size() int {
+	return m.Size()
+}
+func (m *CostAttributionItem) XXX_DiscardUnknown() {
+	xxx_messageInfo_CostAttributionItem.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CostAttributionItem proto.InternalMessageInfo
+
+func (m *CostAttributionItem) GetAttribution() string {
+	if m != nil {
+		return m.Attribution
+	}
+	return ""
+}
+
+func (m *CostAttributionItem) GetActiveSeries() uint64 {
+	if m != nil {
+		return m.ActiveSeries
+	}
+	return 0
+}
+
+func (m *CostAttributionItem) GetIngestedSamples() uint64 {
+	if m != nil {
+		return m.IngestedSamples
+	}
+	return 0
+}
+
 type MetricsForLabelMatchersRequest struct {
 	StartTimestampMs int64            `protobuf:"varint,1,opt,name=start_timestamp_ms,json=startTimestampMs,proto3" json:"start_timestamp_ms,omitempty"`
 	EndTimestampMs   int64            `protobuf:"varint,2,opt,name=end_timestamp_ms,json=endTimestampMs,proto3" json:"end_timestamp_ms,omitempty"`
@@ -1488,7 +1626,7 @@ type MetricsForLabelMatchersRequest struct {
 func (m *MetricsForLabelMatchersRequest) Reset()      { *m = MetricsForLabelMatchersRequest{} }
 func (*MetricsForLabelMatchersRequest) ProtoMessage() {}
 func (*MetricsForLabelMatchersRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{26}
+	return fileDescriptor_60f6df4f3586b478, []int{29}
 }
 func (m *MetricsForLabelMatchersRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1545,7 +1683,7 @@ type MetricsForLabelMatchersResponse struct {
 func (m *MetricsForLabelMatchersResponse) Reset()      { *m = MetricsForLabelMatchersResponse{} }
 func (*MetricsForLabelMatchersResponse) ProtoMessage() {}
 func (*MetricsForLabelMatchersResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{27}
+	return fileDescriptor_60f6df4f3586b478, []int{30}
 }
 func (m *MetricsForLabelMatchersResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1587,7 +1725,7 @@ type MetricsMetadataRequest struct {
 func (m *MetricsMetadataRequest) Reset()      { *m = MetricsMetadataRequest{} }
 func (*MetricsMetadataRequest) ProtoMessage() {}
 func (*MetricsMetadataRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{28}
+	return fileDescriptor_60f6df4f3586b478, []int{31}
 }
 func (m *MetricsMetadataRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1623,7 +1761,7 @@ type MetricsMetadataResponse struct {
 func (m *MetricsMetadataResponse) Reset()      { *m = MetricsMetadataResponse{} }
 func (*MetricsMetadataResponse) ProtoMessage() {}
 func (*MetricsMetadataResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{29}
+	return fileDescriptor_60f6df4f3586b478, []int{32}
 }
 func (m *MetricsMetadataResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1669,7 +1807,7 @@ type TimeSeriesChunk struct {
 func (m *TimeSeriesChunk) Reset()      { *m = TimeSeriesChunk{} }
 func (*TimeSeriesChunk) ProtoMessage() {}
 func (*TimeSeriesChunk) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{30}
+	return fileDescriptor_60f6df4f3586b478, []int{33}
 }
 func (m *TimeSeriesChunk) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1729,7 +1867,7 @@ type Chunk struct {
 func (m *Chunk) Reset()      { *m = Chunk{} }
 func (*Chunk) ProtoMessage() {}
 func (*Chunk) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{31}
+	return fileDescriptor_60f6df4f3586b478, []int{34}
 }
 func (m *Chunk) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1786,7 +1924,7 @@ type LabelMatchers struct {
 func (m *LabelMatchers) Reset()      { *m = LabelMatchers{} }
 func (*LabelMatchers) ProtoMessage() {}
 func (*LabelMatchers) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{32}
+	return fileDescriptor_60f6df4f3586b478, []int{35}
 }
 func (m *LabelMatchers) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1831,7 +1969,7 @@ type LabelMatcher struct {
 func (m *LabelMatcher) Reset()      { *m = LabelMatcher{} }
 func (*LabelMatcher) ProtoMessage() {}
 func (*LabelMatcher) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{33}
+	return fileDescriptor_60f6df4f3586b478, []int{36}
 }
 func (m *LabelMatcher) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1891,7 +2029,7 @@ type TimeSeriesFile struct {
 func (m *TimeSeriesFile) Reset()      { *m = TimeSeriesFile{} }
 func (*TimeSeriesFile) ProtoMessage() {}
 func (*TimeSeriesFile) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{34}
+	return fileDescriptor_60f6df4f3586b478, []int{37}
 }
 func (m *TimeSeriesFile) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1980,6 +2118,9 @@ func init() {
 	proto.RegisterType((*UserStatsResponse)(nil), "cortex.UserStatsResponse")
 	proto.RegisterType((*UserIDStatsResponse)(nil), "cortex.UserIDStatsResponse")
 	proto.RegisterType((*UsersStatsResponse)(nil), "cortex.UsersStatsResponse")
+	proto.RegisterType((*CostAttributionRequest)(nil), "cortex.CostAttributionRequest")
+	proto.RegisterType((*CostAttributionResponse)(nil), "cortex.CostAttributionResponse")
+	proto.RegisterType((*CostAttributionItem)(nil), "cortex.CostAttributionItem")
 	proto.RegisterType((*MetricsForLabelMatchersRequest)(nil), "cortex.MetricsForLabelMatchersRequest")
 	proto.RegisterType((*MetricsForLabelMatchersResponse)(nil), "cortex.MetricsForLabelMatchersResponse")
 	proto.RegisterType((*MetricsMetadataRequest)(nil), "cortex.MetricsMetadataRequest")
@@ -1994,127 +2135,134 @@ func init() {
 func init() { proto.RegisterFile("ingester.proto", fileDescriptor_60f6df4f3586b478) }
 
 var fileDescriptor_60f6df4f3586b478 = []byte{
-	// 1919 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x58, 0xcd, 0x6f, 0x1b, 0xc7,
-	0x15, 0xe7, 0xf0, 0x4b, 0xe2, 0x23, 0x45, 0xad, 0x86, 0x96, 0xc9, 0xd0, 0x35, 0xa5, 0x6c, 0xe1,
-	0x94, 0x4d, 0x13, 0xca, 0x5f, 0x2d, 0x9c, 0x20, 0x45, 0x40, 0x49, 0xb4, 0x45, 0xdb, 0x24, 0x9d,
-	0x25, 0x95, 0xb8, 0x05, 0x82, 0xc5, 0x92, 0x1c, 0x49, 0x0b, 0x73, 0x97, 0xcc, 0xce, 0xb2, 0x90,
-	0x72, 0x2a, 0xd0, 0x7b, 0xd1, 0x5b, 0x2f, 0x45, 0x81, 0xde, 0x8a, 0x9e, 0x8a, 0x5e, 0x7a, 0xeb,
-	0x39, 0x97, 0x00, 0x3e, 0x06, 0x3d, 0x18, 0xb5, 0xdc, 0x43, 0x7b, 0x0b, 0xd0, 0x7f, 0xa0, 0xd8,
-	0x99, 0xd9, 0x4f, 0xae, 0x2c, 0x25, 0xb0, 0x7d, 0x22, 0xe7, 0xbd, 0x37, 0xbf, 0x79, 0xef, 0xcd,
-	0xfb, 0xda, 0x81, 0xa2, 0x6e, 0x1e, 0x12, 0x6a, 0x13, 0xab, 0x31, 0xb3, 0xa6, 0xf6, 0x14, 0x67,
-	0x47, 0x53, 0xcb, 0x26, 0xc7, 0xd5, 0xf7, 0x0f, 0x75, 0xfb, 0x68, 0x3e, 0x6c, 0x8c, 0xa6, 0xc6,
-	0xd6, 0xe1, 0xf4, 0x70, 0xba, 0xc5, 0xd8, 0xc3, 0xf9, 0x01, 0x5b, 0xb1, 0x05, 0xfb, 0xc7, 0xb7,
-	0x55, 0xaf, 0x07, 0xc5, 0x2d, 0xed, 0x40, 0x33, 0xb5, 0x2d, 0x43, 0x37, 0x74, 0x6b, 0x6b, 0xf6,
-	0xe4, 0x90, 0xff, 0x9b, 0x0d, 0xf9, 0x2f, 0xdf, 0x21, 0x77, 0xa1, 0xfa, 0x50, 0x1b, 0x92, 0x49,
-	0x57, 0x33, 0x08, 0x6d, 0x9a, 0xe3, 0x4f, 0xb5, 0xc9, 0x9c, 0x50, 0x85, 0x7c, 0x31, 0x27, 0xd4,
-	0xc6, 0xd7, 0x61, 0xd9, 0xd0, 0xec, 0xd1, 0x11, 0xb1, 0x68, 0x05, 0x6d, 0xa6, 0xea, 0xf9, 0x9b,
-	0x97, 0x1a, 0x5c, 0xb3, 0x06, 0xdb, 0xd5, 0xe1, 0x4c, 0xc5, 0x93, 0x92, 0xf7, 0xe0, 0x4a, 0x2c,
-	0x1e, 0x9d, 0x4d, 0x4d, 0x4a, 0xf0, 0x8f, 0x21, 0xa3, 0xdb, 0xc4, 0x70, 0xd1, 0x4a, 0x21, 0x34,
-	0x21, 0xcb, 0x25, 0xe4, 0x5d, 0xc8, 0x07, 0xa8, 0xf8, 0x2a, 0xc0, 0xc4, 0x59, 0xaa, 0xa6, 0x66,
-	0x90, 0x0a, 0xda, 0x44, 0xf5, 0x9c, 0x92, 0x9b, 0xb8, 0x47, 0xe1, 0xcb, 0x90, 0xfd, 0x15, 0x13,
-	0xac, 0x24, 0x37, 0x53, 0xf5, 0x9c, 0x22, 0x56, 0xf2, 0x5f, 0x10, 0x5c, 0x0d, 0xc0, 0xec, 0x68,
-	0xd6, 0x58, 0x37, 0xb5, 0x89, 0x6e, 0x9f, 0xb8, 0x36, 0x6e, 0x40, 0xde, 0x07, 0xe6, 0x8a, 0xe5,
-	0x14, 0xf0, 0x90, 0x69, 0xc8, 0x09, 0xc9, 0x8b, 0x38, 0x01, 0xff, 0x0c, 0x0a, 0xa3, 0xe9, 0xdc,
-	0xb4, 0x55, 0x83, 0xd8, 0x47, 0xd3, 0x71, 0x25, 0xb5, 0x89, 0xea, 0x45, 0xdf, 0xd8, 0x1d, 0x87,
-	0xd7, 0x61, 0x2c, 0x25, 0x3f, 0xf2, 0x17, 0xf2, 0x3e, 0xd4, 0xce, 0xd2, 0x55, 0xf8, 0xef, 0x56,
-	0xd8, 0x7f, 0x57, 0x17, 0xfd, 0xd7, 0x27, 0x96, 0x4e, 0x28, 0x3b, 0xc2, 0xf5, 0xe4, 0x33, 0x04,
-	0xeb, 0xb1, 0x02, 0xe7, 0x39, 0x55, 0x03, 0xcc, 0xd9, 0xcc, 0x99, 0x2a, 0x65, 0x3b, 0x85, 0x0f,
-	0x6e, 0xbd, 0xf4, 0xe8, 0x05, 0x6a, 0xcb, 0xb4, 0xad, 0x13, 0x45, 0x9a, 0x44, 0xc8, 0xd5, 0x9d,
-	0x45, 0xd5, 0x98, 0x28, 0x96, 0x20, 0xf5, 0x84, 0x9c, 0x08, 0x9d, 0x9c, 0xbf, 0xf8, 0x12, 0x64,
-	0x98, 0x1e, 0x95, 0xe4, 0x26, 0xaa, 0xa7, 0x15, 0xbe, 0xf8, 0x30, 0x79, 0x07, 0xc9, 0x5f, 0x23,
-	0xc8, 0x2b, 0x44, 0x1b, 0xbb, 0x57, 0xda, 0x80, 0xa5, 0x2f, 0xe6, 0x5c, 0xd9, 0x48, 0xd4, 0x7e,
-	0x32, 0x27, 0x96, 0x7b, 0xf3, 0x8a, 0x2b, 0x84, 0x1f, 0x43, 0x59, 0x1b, 0x8d, 0xc8, 0xcc, 0x26,
-	0x63, 0xd5, 0x12, 0xae, 0x56, 0xed, 0x93, 0x99, 0x30, 0xb6, 0x78, 0x73, 0xd3, 0xdd, 0x1f, 0x38,
-	0xa5, 0xe1, 0x5e, 0xca, 0xe0, 0x64, 0x46, 0x94, 0x75, 0x17, 0x20, 0x48, 0xa5, 0xf2, 0x6d, 0x28,
-	0x04, 0x09, 0x38, 0x0f, 0x4b, 0xfd, 0x66, 0xe7, 0xd1, 0xc3, 0x56, 0x5f, 0x4a, 0xe0, 0x32, 0x94,
-	0xfa, 0x03, 0xa5, 0xd5, 0xec, 0xb4, 0x76, 0xd5, 0xc7, 0x3d, 0x45, 0xdd, 0xd9, 0xdb, 0xef, 0x3e,
-	0xe8, 0x4b, 0x48, 0xfe, 0xd8, 0xd9, 0xa5, 0x79, 0x50, 0x78, 0x0b, 0x96, 0x2c, 0x42, 0xe7, 0x13,
-	0xdb, 0xb5, 0x67, 0x3d, 0x62, 0x0f, 0x97, 0x53, 0x5c, 0x29, 0xf9, 0x04, 0x70, 0xdf, 0xb6, 0x88,
-	0x66, 0x84, 0x60, 0xb6, 0xa1, 0x38, 0x3a, 0x9a, 0x9b, 0x4f, 0xc8, 0xd8, 0xbd, 0x4a, 0x8e, 0x76,
-	0xc5, 0x45, 0xe3, 0x7b, 0x76, 0xb8, 0x0c, 0xbf, 0x0c, 0x65, 0x65, 0x14, 0x5c, 0x3a, 0xd9, 0xe2,
-	0x78, 0xed, 0x44, 0xd5, 0xcd, 0x31, 0x39, 0x66, 0x57, 0x91, 0x52, 0x80, 0x91, 0xda, 0x0e, 0x45,
-	0xfe, 0x2b, 0x82, 0x52, 0x0c, 0x0e, 0x3e, 0x80, 0x2c, 0xbb, 0xfc, 0x68, 0xea, 0xcf, 0x86, 0x3c,
-	0x56, 0x1e, 0x69, 0xba, 0xb5, 0xfd, 0xc1, 0x57, 0xcf, 0x36, 0x12, 0xff, 0x7c, 0xb6, 0x71, 0xe3,
-	0x22, 0x75, 0x8c, 0xef, 0x6b, 0x8e, 0xb5, 0x99, 0x4d, 0x2c, 0x45, 0xa0, 0xe3, 0x1b, 0x90, 0x65,
-	0x1a, 0xbb, 0x71, 0x5a, 0x8a, 0x31, 0x6e, 0x3b, 0xed, 0x9c, 0xa3, 0x08, 0x41, 0xf9, 0xf7, 0x49,
-	0xc8, 0x07, 0xb8, 0xb8, 0x06, 0x79, 0x43, 0x37, 0x55, 0x5b, 0x37, 0x88, 0xca, 0x52, 0xcd, 0xb1,
-	0x31, 0x67, 0xe8, 0xe6, 0x40, 0x37, 0x48, 0x87, 0x32, 0xbe, 0x76, 0xec, 0xf1, 0x93, 0x82, 0xaf,
-	0x1d, 0x0b, 0xfe, 0x75, 0x48, 0x3b, 0xc1, 0x23, 0xd2, 0xfe, 0x07, 0x31, 0x0a, 0x34, 0x5a, 0xe6,
-	0x68, 0x3a, 0xd6, 0xcd, 0x43, 0x85, 0x49, 0xe2, 0x47, 0x90, 0x1e, 0x6b, 0xb6, 0x56, 0x49, 0x6f,
-	0xa2, 0x7a, 0x61, 0xfb, 0x23, 0xe1, 0x85, 0xdb, 0x17, 0xf2, 0xc2, 0xbe, 0x49, 0xb5, 0x03, 0xb2,
-	0x7d, 0x62, 0x93, 0xfe, 0x44, 0x1f, 0x11, 0x85, 0x21, 0xc9, 0xbb, 0xb0, 0xec, 0x9e, 0xe1, 0x04,
-	0xdd, 0x7e, 0xf7, 0x41, 0xb7, 0xf7, 0x59, 0x57, 0x4a, 0xe0, 0x25, 0x48, 0x3d, 0xee, 0x29, 0x12,
-	0xc2, 0x2b, 0x90, 0xdb, 0x6b, 0xf7, 0x07, 0xbd, 0x7b, 0x4a, 0xb3, 0x23, 0x25, 0x71, 0x09, 0x56,
-	0xef, 0x3e, 0xec, 0x35, 0x07, 0xaa, 0x4f, 0x4c, 0xc9, 0xff, 0x46, 0x50, 0x08, 0xa6, 0x0c, 0x7e,
-	0x0f, 0x30, 0xb5, 0x35, 0xcb, 0x66, 0xc6, 0x53, 0x5b, 0x33, 0x66, 0xbe, 0x87, 0x24, 0xc6, 0x19,
-	0xb8, 0x8c, 0x0e, 0xc5, 0x75, 0x90, 0x88, 0x39, 0x0e, 0xcb, 0x72, 0x6f, 0x15, 0x89, 0x39, 0x0e,
-	0x4a, 0x06, 0x6b, 0x6c, 0xea, 0x42, 0x35, 0xf6, 0xe7, 0x70, 0x85, 0x32, 0x87, 0xea, 0xe6, 0xa1,
-	0xca, 0x2f, 0x52, 0x1d, 0x3a, 0x4c, 0x95, 0xea, 0x5f, 0x92, 0xca, 0x98, 0xd5, 0x88, 0x8a, 0x27,
-	0xc2, 0xdc, 0x4e, 0xb7, 0x1d, 0x81, 0xbe, 0xfe, 0x25, 0xb9, 0x9f, 0x5e, 0x4e, 0x4b, 0x19, 0x25,
-	0x73, 0xa4, 0x9b, 0x36, 0x95, 0xff, 0x84, 0xe0, 0x52, 0xeb, 0x98, 0x18, 0xb3, 0x89, 0x66, 0xbd,
-	0x11, 0x73, 0x6f, 0x2c, 0x98, 0xbb, 0x1e, 0x67, 0x2e, 0x0d, 0x34, 0xd6, 0x07, 0xb0, 0x12, 0x4a,
-	0x76, 0xfc, 0x21, 0x00, 0x3b, 0x29, 0xae, 0xce, 0xcd, 0x86, 0x0d, 0xe7, 0x38, 0x9e, 0x7a, 0x22,
-	0xda, 0x03, 0xd2, 0xf2, 0xff, 0x92, 0x50, 0x62, 0x68, 0x6e, 0x95, 0x10, 0x98, 0x1f, 0x43, 0x9e,
-	0xbb, 0x32, 0x08, 0x5a, 0x76, 0x55, 0xf3, 0x21, 0x83, 0x59, 0x14, 0xdc, 0x11, 0x51, 0x2a, 0xf9,
-	0x5d, 0x94, 0xc2, 0xf7, 0x41, 0xf2, 0x6f, 0x54, 0x20, 0x70, 0xe7, 0xbc, 0x15, 0x2a, 0x77, 0x5c,
-	0xe7, 0x10, 0xcc, 0xaa, 0xb7, 0x51, 0x54, 0x9b, 0xdb, 0x50, 0xd6, 0xa9, 0xea, 0xdc, 0xc6, 0xf4,
-	0x40, 0x60, 0xa9, 0x5c, 0x86, 0xe5, 0xd8, 0xb2, 0x52, 0xd2, 0x69, 0xcb, 0x1c, 0xf7, 0x0e, 0xb8,
-	0x3c, 0x87, 0xc4, 0x9f, 0x43, 0x39, 0xaa, 0x81, 0x08, 0xad, 0x4a, 0x86, 0x29, 0xb2, 0x71, 0xa6,
-	0x22, 0x22, 0xbe, 0xb8, 0x3a, 0xeb, 0x11, 0x75, 0x38, 0x53, 0xfe, 0x03, 0x82, 0xb5, 0x85, 0x8d,
-	0x6f, 0xac, 0x30, 0x6e, 0x88, 0xbb, 0x55, 0xd9, 0xc4, 0xe1, 0x56, 0x6e, 0x46, 0x62, 0x2d, 0x5b,
-	0xd6, 0xa1, 0x7c, 0x86, 0x59, 0xf8, 0x6d, 0x28, 0x08, 0x77, 0xf0, 0xb2, 0x8f, 0x58, 0x76, 0xe5,
-	0x39, 0x8d, 0xd5, 0x7d, 0xfc, 0x93, 0x48, 0xdd, 0x5d, 0xf1, 0xa6, 0x9d, 0x98, 0x8a, 0xdb, 0x87,
-	0xf5, 0x48, 0xbe, 0xbd, 0x82, 0xa0, 0xfe, 0x07, 0x02, 0x1c, 0x9c, 0x23, 0x45, 0x0e, 0x9f, 0x33,
-	0xe3, 0xc4, 0xa7, 0x78, 0xf2, 0x3b, 0xa4, 0x78, 0xea, 0xdc, 0x14, 0x77, 0x42, 0xee, 0x02, 0x29,
-	0x7e, 0x07, 0x4a, 0x21, 0xfd, 0x85, 0x4f, 0xde, 0x86, 0x42, 0x60, 0x0a, 0x73, 0x27, 0xd4, 0xbc,
-	0x3f, 0x4a, 0x51, 0xf9, 0x8f, 0x08, 0xd6, 0xfc, 0xb1, 0xfb, 0xcd, 0x56, 0xaf, 0x0b, 0x99, 0xf6,
-	0x53, 0x71, 0x35, 0x42, 0x3f, 0x61, 0xd9, 0x79, 0xa3, 0xb7, 0x7c, 0x1f, 0xa4, 0x7d, 0x4a, 0xac,
-	0xbe, 0xad, 0xd9, 0x9e, 0x55, 0xd1, 0xe1, 0x1a, 0x5d, 0x70, 0xb8, 0xfe, 0x3b, 0x82, 0xb5, 0x00,
-	0x98, 0x50, 0xe1, 0x9a, 0xfb, 0xe9, 0xa5, 0x4f, 0x4d, 0xd5, 0xd2, 0x6c, 0x1e, 0x21, 0x48, 0x59,
-	0xf1, 0xa8, 0x8a, 0x66, 0x13, 0x27, 0x88, 0xcc, 0xb9, 0xe1, 0x4f, 0xc0, 0x4e, 0xf8, 0xe7, 0xcc,
-	0xb9, 0x9b, 0xc3, 0xef, 0x01, 0xd6, 0x66, 0xba, 0x1a, 0x41, 0x4a, 0x31, 0x24, 0x49, 0x9b, 0xe9,
-	0xed, 0x10, 0x58, 0x03, 0x4a, 0xd6, 0x7c, 0x42, 0xa2, 0xe2, 0x69, 0x26, 0xbe, 0xe6, 0xb0, 0x42,
-	0xf2, 0xf2, 0xe7, 0x50, 0x72, 0x14, 0x6f, 0xef, 0x86, 0x55, 0x2f, 0xc3, 0xd2, 0x9c, 0x12, 0x4b,
-	0xd5, 0xc7, 0x22, 0xaa, 0xb3, 0xce, 0xb2, 0x3d, 0xc6, 0xef, 0x8b, 0x69, 0x22, 0xc9, 0xee, 0xc6,
-	0x2b, 0x9e, 0x0b, 0xc6, 0x8b, 0x51, 0xe1, 0x1e, 0x60, 0x87, 0x45, 0xc3, 0xe8, 0x37, 0x20, 0x43,
-	0x1d, 0x42, 0x74, 0x46, 0x8c, 0xd1, 0x44, 0xe1, 0x92, 0xf2, 0xdf, 0x10, 0xd4, 0x3a, 0xc4, 0xb6,
-	0xf4, 0x11, 0xbd, 0x3b, 0xb5, 0xc2, 0xa1, 0xf0, 0x9a, 0x43, 0xf2, 0x0e, 0x14, 0xdc, 0x58, 0x53,
-	0x29, 0xb1, 0x5f, 0xde, 0x54, 0xf3, 0xae, 0x68, 0x9f, 0xd8, 0xf2, 0x03, 0xd8, 0x38, 0x53, 0x67,
-	0xe1, 0x8a, 0x3a, 0x64, 0x0d, 0x26, 0x22, 0x7c, 0x21, 0xf9, 0x05, 0x89, 0x6f, 0x55, 0x04, 0x5f,
-	0xae, 0xc0, 0x65, 0x01, 0xd6, 0x21, 0xb6, 0xe6, 0x78, 0x57, 0x18, 0x2e, 0xf7, 0xa0, 0xbc, 0xc0,
-	0x11, 0xf0, 0xb7, 0x61, 0xd9, 0x10, 0x34, 0x71, 0x40, 0x25, 0x7a, 0x80, 0xb7, 0xc7, 0x93, 0x94,
-	0xff, 0x8b, 0x60, 0x35, 0xd2, 0x90, 0x1d, 0x7f, 0x1d, 0x58, 0x53, 0x43, 0x75, 0x1f, 0x13, 0xfc,
-	0xd0, 0x28, 0x3a, 0xf4, 0xb6, 0x20, 0xb7, 0xc7, 0xc1, 0xd8, 0x49, 0x86, 0x62, 0xc7, 0xef, 0x46,
-	0xa9, 0xd7, 0xda, 0x8d, 0xfc, 0x76, 0x91, 0x3e, 0xbf, 0x5d, 0x7c, 0x8d, 0x20, 0xc3, 0x2d, 0x7c,
-	0x5d, 0xf1, 0x53, 0x85, 0x65, 0x22, 0xc6, 0x65, 0x96, 0xb6, 0x19, 0xc5, 0x5b, 0xbf, 0x86, 0xe1,
-	0xbc, 0x09, 0x2b, 0xa1, 0x48, 0xfb, 0x1e, 0xef, 0x2c, 0x2a, 0x14, 0x82, 0x1c, 0x7c, 0x4d, 0x7c,
-	0x73, 0xf0, 0x6a, 0xb8, 0xe6, 0xee, 0x66, 0x6c, 0xf6, 0x81, 0xca, 0x3f, 0x34, 0x30, 0xa4, 0x59,
-	0x1b, 0xe4, 0x97, 0xce, 0xfe, 0xfb, 0xdf, 0xd5, 0x29, 0x46, 0xe4, 0x0b, 0xf9, 0x37, 0x08, 0x8a,
-	0x7e, 0x7c, 0xdd, 0xd5, 0x27, 0xe4, 0x55, 0x84, 0x57, 0x15, 0x96, 0x0f, 0xf4, 0x09, 0x61, 0x3a,
-	0xf0, 0xe3, 0xbc, 0xb5, 0xa3, 0x9b, 0xef, 0x67, 0xee, 0xa9, 0x77, 0xeb, 0x90, 0x0f, 0x14, 0x74,
-	0xe7, 0x9b, 0xa5, 0xdd, 0x55, 0x3b, 0xad, 0x4e, 0x4f, 0xf9, 0x85, 0x94, 0xc0, 0x00, 0xd9, 0xe6,
-	0xce, 0xa0, 0xfd, 0x69, 0x4b, 0x42, 0xef, 0xde, 0x87, 0x9c, 0x67, 0x2c, 0xce, 0x41, 0xa6, 0xf5,
-	0xc9, 0x7e, 0xf3, 0xa1, 0x94, 0x70, 0xb6, 0x74, 0x7b, 0x03, 0x95, 0x2f, 0x11, 0x5e, 0x85, 0xbc,
-	0xd2, 0xba, 0xd7, 0x7a, 0xac, 0x76, 0x9a, 0x83, 0x9d, 0x3d, 0x29, 0x89, 0x31, 0x14, 0x39, 0xa1,
-	0xdb, 0x13, 0xb4, 0xd4, 0xcd, 0xdf, 0x2e, 0xc1, 0xb2, 0x6b, 0x0d, 0xfe, 0x00, 0xd2, 0x8f, 0xe6,
-	0xf4, 0x08, 0x5f, 0xf6, 0x33, 0xe1, 0x33, 0x4b, 0xb7, 0x89, 0xc8, 0xec, 0x6a, 0x79, 0x81, 0xce,
-	0xf3, 0x5a, 0x4e, 0xe0, 0x5d, 0xc8, 0x07, 0x26, 0x2a, 0x1c, 0xfb, 0x0a, 0x51, 0xbd, 0x12, 0x33,
-	0x53, 0xfa, 0x18, 0xd7, 0x11, 0xee, 0x41, 0x91, 0xb1, 0xdc, 0x89, 0x89, 0x62, 0xef, 0x93, 0x32,
-	0xee, 0xa3, 0xa5, 0x7a, 0xf5, 0x0c, 0xae, 0xa7, 0xd6, 0x5e, 0xf8, 0x65, 0xad, 0x1a, 0xf7, 0x08,
-	0x17, 0x55, 0x2e, 0x66, 0x30, 0x91, 0x13, 0xb8, 0x05, 0xe0, 0xb7, 0x75, 0xfc, 0x56, 0x48, 0x38,
-	0x38, 0x8a, 0x54, 0xab, 0x71, 0x2c, 0x0f, 0x66, 0x1b, 0x72, 0x5e, 0x73, 0xc2, 0x95, 0x98, 0x7e,
-	0xc5, 0x41, 0xce, 0xee, 0x64, 0x72, 0x02, 0xdf, 0x85, 0x42, 0x73, 0x32, 0xb9, 0x08, 0x4c, 0x35,
-	0xc8, 0xa1, 0x51, 0x9c, 0x89, 0x57, 0xa8, 0xa3, 0xfd, 0x00, 0xbf, 0xe3, 0x65, 0xd5, 0x4b, 0x9b,
-	0x5c, 0xf5, 0x47, 0xe7, 0xca, 0x79, 0xa7, 0x0d, 0x60, 0x35, 0xd2, 0x16, 0x70, 0x2d, 0xb2, 0x3b,
-	0xd2, 0x49, 0xaa, 0x1b, 0x67, 0xf2, 0x3d, 0xd4, 0xa1, 0x18, 0x24, 0xc3, 0x8f, 0xb0, 0x58, 0x5e,
-	0xbc, 0x84, 0xe8, 0x8b, 0x6f, 0xf5, 0x87, 0x2f, 0x95, 0x09, 0x44, 0xe5, 0x13, 0xb8, 0x1c, 0xff,
-	0x56, 0x89, 0xaf, 0xc5, 0xc4, 0xcc, 0xe2, 0xbb, 0x6b, 0xf5, 0x9d, 0xf3, 0xc4, 0xfc, 0xc3, 0xb6,
-	0x3f, 0x7a, 0xfa, 0xbc, 0x96, 0xf8, 0xe6, 0x79, 0x2d, 0xf1, 0xed, 0xf3, 0x1a, 0xfa, 0xf5, 0x69,
-	0x0d, 0xfd, 0xf9, 0xb4, 0x86, 0xbe, 0x3a, 0xad, 0xa1, 0xa7, 0xa7, 0x35, 0xf4, 0xaf, 0xd3, 0x1a,
-	0xfa, 0xcf, 0x69, 0x2d, 0xf1, 0xed, 0x69, 0x0d, 0xfd, 0xee, 0x45, 0x2d, 0xf1, 0xf4, 0x45, 0x2d,
-	0xf1, 0xcd, 0x8b, 0x5a, 0xe2, 0x97, 0xd9, 0xd1, 0x44, 0x27, 0xa6, 0x3d, 0xcc, 0xb2, 0xa7, 0xee,
-	0x5b, 0xff, 0x0f, 0x00, 0x00, 0xff, 0xff, 0xae, 0xb9, 0xf1, 0x3c, 0x65, 0x17, 0x00, 0x00,
+	// 2017 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x59, 0xcf, 0x6f, 0x1b, 0xc7,
+	0xf5, 0xe7, 0x90, 0xd4, 0x0f, 0x3e, 0x52, 0xd2, 0x6a, 0x68, 0x99, 0xcc, 0xea, 0x6b, 0x4a, 0xd9,
+	0xc0, 0xf9, 0x2a, 0x69, 0x42, 0xf9, 0x57, 0x0b, 0x27, 0x48, 0x11, 0x50, 0x12, 0x6d, 0xd1, 0x16,
+	0x49, 0x67, 0x49, 0x25, 0x6e, 0x81, 0x60, 0xb1, 0x24, 0x47, 0xd2, 0xc2, 0xdc, 0x25, 0xb3, 0x3b,
+	0x0c, 0xa4, 0x9c, 0x0a, 0xf4, 0xd0, 0x6b, 0x6f, 0xbd, 0x14, 0x05, 0x7a, 0x2b, 0x7a, 0x2a, 0x7a,
+	0xe9, 0xad, 0xe7, 0x5c, 0x02, 0xf8, 0x18, 0xf4, 0x60, 0xd4, 0x72, 0x0e, 0xed, 0x2d, 0x40, 0xff,
+	0x81, 0x62, 0x67, 0x66, 0x7f, 0x72, 0x69, 0x29, 0x45, 0xec, 0x93, 0x38, 0xef, 0xbd, 0xf9, 0xcc,
+	0xfb, 0x3d, 0x6f, 0x47, 0xb0, 0x6c, 0x58, 0xc7, 0xc4, 0xa1, 0xc4, 0xae, 0x8e, 0xed, 0x11, 0x1d,
+	0xe1, 0xf9, 0xfe, 0xc8, 0xa6, 0xe4, 0x54, 0x7e, 0xff, 0xd8, 0xa0, 0x27, 0x93, 0x5e, 0xb5, 0x3f,
+	0x32, 0xb7, 0x8f, 0x47, 0xc7, 0xa3, 0x6d, 0xc6, 0xee, 0x4d, 0x8e, 0xd8, 0x8a, 0x2d, 0xd8, 0x2f,
+	0xbe, 0x4d, 0xbe, 0x11, 0x16, 0xb7, 0xf5, 0x23, 0xdd, 0xd2, 0xb7, 0x4d, 0xc3, 0x34, 0xec, 0xed,
+	0xf1, 0x93, 0x63, 0xfe, 0x6b, 0xdc, 0xe3, 0x7f, 0xf9, 0x0e, 0xa5, 0x05, 0xf2, 0x81, 0xde, 0x23,
+	0xc3, 0x96, 0x6e, 0x12, 0xa7, 0x66, 0x0d, 0x3e, 0xd5, 0x87, 0x13, 0xe2, 0xa8, 0xe4, 0x8b, 0x09,
+	0x71, 0x28, 0xbe, 0x01, 0x8b, 0xa6, 0x4e, 0xfb, 0x27, 0xc4, 0x76, 0xca, 0x68, 0x33, 0xb3, 0x95,
+	0xbf, 0x75, 0xa5, 0xca, 0x35, 0xab, 0xb2, 0x5d, 0x4d, 0xce, 0x54, 0x7d, 0x29, 0x65, 0x1f, 0xd6,
+	0x13, 0xf1, 0x9c, 0xf1, 0xc8, 0x72, 0x08, 0x7e, 0x07, 0xe6, 0x0c, 0x4a, 0x4c, 0x0f, 0xad, 0x18,
+	0x41, 0x13, 0xb2, 0x5c, 0x42, 0xd9, 0x83, 0x7c, 0x88, 0x8a, 0xaf, 0x01, 0x0c, 0xdd, 0xa5, 0x66,
+	0xe9, 0x26, 0x29, 0xa3, 0x4d, 0xb4, 0x95, 0x53, 0x73, 0x43, 0xef, 0x28, 0x7c, 0x15, 0xe6, 0xbf,
+	0x64, 0x82, 0xe5, 0xf4, 0x66, 0x66, 0x2b, 0xa7, 0x8a, 0x95, 0xf2, 0x67, 0x04, 0xd7, 0x42, 0x30,
+	0xbb, 0xba, 0x3d, 0x30, 0x2c, 0x7d, 0x68, 0xd0, 0x33, 0xcf, 0xc6, 0x0d, 0xc8, 0x07, 0xc0, 0x5c,
+	0xb1, 0x9c, 0x0a, 0x3e, 0xb2, 0x13, 0x71, 0x42, 0xfa, 0x32, 0x4e, 0xc0, 0x3f, 0x83, 0x42, 0x7f,
+	0x34, 0xb1, 0xa8, 0x66, 0x12, 0x7a, 0x32, 0x1a, 0x94, 0x33, 0x9b, 0x68, 0x6b, 0x39, 0x30, 0x76,
+	0xd7, 0xe5, 0x35, 0x19, 0x4b, 0xcd, 0xf7, 0x83, 0x85, 0x72, 0x08, 0x95, 0x59, 0xba, 0x0a, 0xff,
+	0xdd, 0x8e, 0xfa, 0xef, 0xda, 0xb4, 0xff, 0x3a, 0xc4, 0x36, 0x88, 0xc3, 0x8e, 0xf0, 0x3c, 0xf9,
+	0x0c, 0xc1, 0x5a, 0xa2, 0xc0, 0x45, 0x4e, 0xd5, 0x01, 0x73, 0x36, 0x73, 0xa6, 0xe6, 0xb0, 0x9d,
+	0xc2, 0x07, 0xb7, 0x5f, 0x7a, 0xf4, 0x14, 0xb5, 0x6e, 0x51, 0xfb, 0x4c, 0x95, 0x86, 0x31, 0xb2,
+	0xbc, 0x0b, 0x6b, 0x89, 0xa2, 0x58, 0x82, 0xcc, 0x13, 0x72, 0x26, 0x74, 0x72, 0x7f, 0xe2, 0x2b,
+	0x30, 0xc7, 0xf4, 0x28, 0xa7, 0x37, 0xd1, 0x56, 0x56, 0xe5, 0x8b, 0x0f, 0xd3, 0x77, 0x91, 0xf2,
+	0x0d, 0x82, 0xbc, 0x4a, 0xf4, 0x81, 0x17, 0xd2, 0x2a, 0x2c, 0x7c, 0x31, 0xe1, 0xca, 0xc6, 0xb2,
+	0xf6, 0x93, 0x09, 0xb1, 0xbd, 0xc8, 0xab, 0x9e, 0x10, 0x7e, 0x0c, 0x25, 0xbd, 0xdf, 0x27, 0x63,
+	0x4a, 0x06, 0x9a, 0x2d, 0x5c, 0xad, 0xd1, 0xb3, 0xb1, 0x30, 0x76, 0xf9, 0xd6, 0xa6, 0xb7, 0x3f,
+	0x74, 0x4a, 0xd5, 0x0b, 0x4a, 0xf7, 0x6c, 0x4c, 0xd4, 0x35, 0x0f, 0x20, 0x4c, 0x75, 0x94, 0x3b,
+	0x50, 0x08, 0x13, 0x70, 0x1e, 0x16, 0x3a, 0xb5, 0xe6, 0xa3, 0x83, 0x7a, 0x47, 0x4a, 0xe1, 0x12,
+	0x14, 0x3b, 0x5d, 0xb5, 0x5e, 0x6b, 0xd6, 0xf7, 0xb4, 0xc7, 0x6d, 0x55, 0xdb, 0xdd, 0x3f, 0x6c,
+	0x3d, 0xec, 0x48, 0x48, 0xf9, 0x18, 0x0a, 0xfc, 0x20, 0x11, 0xf5, 0x6d, 0x58, 0xb0, 0x89, 0x33,
+	0x19, 0x52, 0xcf, 0x9e, 0xb5, 0x98, 0x3d, 0x5c, 0x4e, 0xf5, 0xa4, 0x94, 0x33, 0xc0, 0x1d, 0x6a,
+	0x13, 0xdd, 0x8c, 0xc0, 0xec, 0xc0, 0x72, 0xff, 0x64, 0x62, 0x3d, 0x21, 0x03, 0x2f, 0x94, 0x1c,
+	0x6d, 0xdd, 0x43, 0xe3, 0x7b, 0x76, 0xb9, 0x0c, 0x0f, 0x86, 0xba, 0xd4, 0x0f, 0x2f, 0xdd, 0x6a,
+	0x71, 0xbd, 0x76, 0xa6, 0x19, 0xd6, 0x80, 0x9c, 0xb2, 0x50, 0x64, 0x54, 0x60, 0xa4, 0x86, 0x4b,
+	0x51, 0xfe, 0x82, 0xa0, 0x98, 0x80, 0x83, 0x8f, 0x60, 0x9e, 0x05, 0x3f, 0x5e, 0xfa, 0xe3, 0x1e,
+	0xcf, 0x95, 0x47, 0xba, 0x61, 0xef, 0x7c, 0xf0, 0xf5, 0xb3, 0x8d, 0xd4, 0x3f, 0x9e, 0x6d, 0xdc,
+	0xbc, 0x4c, 0x1f, 0xe3, 0xfb, 0x6a, 0x03, 0x7d, 0x4c, 0x89, 0xad, 0x0a, 0x74, 0x7c, 0x13, 0xe6,
+	0x99, 0xc6, 0x5e, 0x9e, 0x16, 0x13, 0x8c, 0xdb, 0xc9, 0xba, 0xe7, 0xa8, 0x42, 0x50, 0xf9, 0x5d,
+	0x1a, 0xf2, 0x21, 0x2e, 0xae, 0x40, 0xde, 0x34, 0x2c, 0x8d, 0x1a, 0x26, 0xd1, 0x58, 0xa9, 0xb9,
+	0x36, 0xe6, 0x4c, 0xc3, 0xea, 0x1a, 0x26, 0x69, 0x3a, 0x8c, 0xaf, 0x9f, 0xfa, 0xfc, 0xb4, 0xe0,
+	0xeb, 0xa7, 0x82, 0x7f, 0x03, 0xb2, 0x6e, 0xf2, 0x88, 0xb2, 0xff, 0xbf, 0x04, 0x05, 0xaa, 0x75,
+	0xab, 0x3f, 0x1a, 0x18, 0xd6, 0xb1, 0xca, 0x24, 0xf1, 0x23, 0xc8, 0x0e, 0x74, 0xaa, 0x97, 0xb3,
+	0x9b, 0x68, 0xab, 0xb0, 0xf3, 0x91, 0xf0, 0xc2, 0x9d, 0x4b, 0x79, 0xe1, 0xd0, 0x72, 0xf4, 0x23,
+	0xb2, 0x73, 0x46, 0x49, 0x67, 0x68, 0xf4, 0x89, 0xca, 0x90, 0x94, 0x3d, 0x58, 0xf4, 0xce, 0x70,
+	0x93, 0xee, 0xb0, 0xf5, 0xb0, 0xd5, 0xfe, 0xac, 0x25, 0xa5, 0xf0, 0x02, 0x64, 0x1e, 0xb7, 0x55,
+	0x09, 0xe1, 0x25, 0xc8, 0xed, 0x37, 0x3a, 0xdd, 0xf6, 0x7d, 0xb5, 0xd6, 0x94, 0xd2, 0xb8, 0x08,
+	0x2b, 0xf7, 0x0e, 0xda, 0xb5, 0xae, 0x16, 0x10, 0x33, 0xca, 0x77, 0x08, 0x0a, 0xe1, 0x92, 0xc1,
+	0xef, 0x01, 0x76, 0xa8, 0x6e, 0x53, 0x66, 0xbc, 0x43, 0x75, 0x73, 0x1c, 0x78, 0x48, 0x62, 0x9c,
+	0xae, 0xc7, 0x68, 0x3a, 0x78, 0x0b, 0x24, 0x62, 0x0d, 0xa2, 0xb2, 0xdc, 0x5b, 0xcb, 0xc4, 0x1a,
+	0x84, 0x25, 0xc3, 0x3d, 0x36, 0x73, 0xa9, 0x1e, 0xfb, 0x73, 0x58, 0x77, 0x98, 0x43, 0x0d, 0xeb,
+	0x58, 0xe3, 0x81, 0xd4, 0x7a, 0x2e, 0x53, 0x73, 0x8c, 0xaf, 0x48, 0x79, 0xc0, 0x7a, 0x44, 0xd9,
+	0x17, 0x61, 0x6e, 0x77, 0x76, 0x5c, 0x81, 0x8e, 0xf1, 0x15, 0x79, 0x90, 0x5d, 0xcc, 0x4a, 0x73,
+	0xea, 0xdc, 0x89, 0x61, 0x51, 0x47, 0xf9, 0x23, 0x82, 0x2b, 0xf5, 0x53, 0x62, 0x8e, 0x87, 0xba,
+	0xfd, 0x5a, 0xcc, 0xbd, 0x39, 0x65, 0xee, 0x5a, 0x92, 0xb9, 0x4e, 0xe8, 0x62, 0x7d, 0x08, 0x4b,
+	0x91, 0x62, 0xc7, 0x1f, 0x02, 0xb0, 0x93, 0x92, 0xfa, 0xdc, 0xb8, 0x57, 0x75, 0x8f, 0xe3, 0xa5,
+	0x27, 0xb2, 0x3d, 0x24, 0xad, 0xfc, 0x27, 0x0d, 0x45, 0x86, 0xe6, 0x75, 0x09, 0x81, 0xf9, 0x31,
+	0xe4, 0xb9, 0x2b, 0xc3, 0xa0, 0x25, 0x4f, 0xb5, 0x00, 0x32, 0x5c, 0x45, 0xe1, 0x1d, 0x31, 0xa5,
+	0xd2, 0x3f, 0x44, 0x29, 0xfc, 0x00, 0xa4, 0x20, 0xa2, 0x02, 0x81, 0x3b, 0xe7, 0x8d, 0x48, 0xbb,
+	0xe3, 0x3a, 0x47, 0x60, 0x56, 0xfc, 0x8d, 0x9c, 0x8c, 0xef, 0x40, 0xc9, 0x70, 0x34, 0x37, 0x1a,
+	0xa3, 0x23, 0x81, 0xa5, 0x71, 0x19, 0x56, 0x63, 0x8b, 0x6a, 0xd1, 0x70, 0xea, 0xd6, 0xa0, 0x7d,
+	0xc4, 0xe5, 0x39, 0x24, 0xfe, 0x1c, 0x4a, 0x71, 0x0d, 0x44, 0x6a, 0x95, 0xe7, 0x98, 0x22, 0x1b,
+	0x33, 0x15, 0x11, 0xf9, 0xc5, 0xd5, 0x59, 0x8b, 0xa9, 0xc3, 0x99, 0xca, 0xef, 0x11, 0xac, 0x4e,
+	0x6d, 0x7c, 0x6d, 0x8d, 0x71, 0x43, 0xc4, 0x56, 0x63, 0x13, 0x87, 0xd7, 0xb9, 0x19, 0x89, 0x5d,
+	0xd9, 0x8a, 0x01, 0xa5, 0x19, 0x66, 0xe1, 0x37, 0xa1, 0x20, 0xdc, 0xc1, 0xdb, 0x3e, 0x62, 0xd5,
+	0x95, 0xe7, 0x34, 0xd6, 0xf7, 0xf1, 0x4f, 0x62, 0x7d, 0x77, 0xc9, 0x9f, 0x76, 0x12, 0x3a, 0x6e,
+	0x07, 0xd6, 0x62, 0xf5, 0xf6, 0x23, 0x24, 0xf5, 0xdf, 0x11, 0xe0, 0xf0, 0x1c, 0x29, 0x6a, 0xf8,
+	0x82, 0x19, 0x27, 0xb9, 0xc4, 0xd3, 0x3f, 0xa0, 0xc4, 0x33, 0x17, 0x96, 0xb8, 0x9b, 0x72, 0x97,
+	0x28, 0xf1, 0xbb, 0x50, 0x8c, 0xe8, 0x2f, 0x7c, 0xf2, 0x26, 0x14, 0x42, 0x53, 0x98, 0x37, 0xa1,
+	0xe6, 0x83, 0x51, 0xca, 0x51, 0xfe, 0x80, 0x60, 0x35, 0x18, 0xbb, 0x5f, 0x6f, 0xf7, 0xba, 0x94,
+	0x69, 0x3f, 0x05, 0x1c, 0xd6, 0x4f, 0x58, 0x76, 0xd1, 0xe8, 0xad, 0x3c, 0x00, 0xe9, 0xd0, 0x21,
+	0x76, 0x87, 0xea, 0xd4, 0xb7, 0x2a, 0x3e, 0x5c, 0xa3, 0x4b, 0x0e, 0xd7, 0x7f, 0x43, 0xb0, 0x1a,
+	0x02, 0x13, 0x2a, 0x5c, 0xf7, 0x3e, 0xbd, 0x8c, 0x91, 0xa5, 0xd9, 0x3a, 0xe5, 0x19, 0x82, 0xd4,
+	0x25, 0x9f, 0xaa, 0xea, 0x94, 0xb8, 0x49, 0x64, 0x4d, 0xcc, 0x60, 0x02, 0x76, 0xd3, 0x3f, 0x67,
+	0x4d, 0xbc, 0x1a, 0x7e, 0x0f, 0xb0, 0x3e, 0x36, 0xb4, 0x18, 0x52, 0x86, 0x21, 0x49, 0xfa, 0xd8,
+	0x68, 0x44, 0xc0, 0xaa, 0x50, 0xb4, 0x27, 0x43, 0x12, 0x17, 0xcf, 0x32, 0xf1, 0x55, 0x97, 0x15,
+	0x91, 0x57, 0x3e, 0x87, 0xa2, 0xab, 0x78, 0x63, 0x2f, 0xaa, 0x7a, 0x09, 0x16, 0x26, 0x0e, 0xb1,
+	0x35, 0x63, 0x20, 0xb2, 0x7a, 0xde, 0x5d, 0x36, 0x06, 0xf8, 0x7d, 0x31, 0x4d, 0xa4, 0x37, 0x51,
+	0xb8, 0x79, 0x4e, 0x19, 0x2f, 0x46, 0x85, 0xfb, 0x80, 0x5d, 0x96, 0x13, 0x45, 0xbf, 0x09, 0x73,
+	0x8e, 0x4b, 0x88, 0xcf, 0x88, 0x09, 0x9a, 0xa8, 0x5c, 0x52, 0x29, 0xc3, 0xd5, 0xdd, 0x91, 0x43,
+	0x6b, 0x94, 0xda, 0x46, 0x6f, 0xc2, 0xd4, 0xe7, 0x31, 0x53, 0x0e, 0xa0, 0x34, 0xc5, 0x09, 0xce,
+	0x09, 0x7f, 0xd1, 0xac, 0x07, 0x71, 0x8c, 0xc8, 0x37, 0x28, 0x31, 0xbd, 0xef, 0x99, 0xdf, 0x20,
+	0x28, 0x26, 0xb0, 0xf1, 0x26, 0xe4, 0xf5, 0x80, 0x24, 0x9c, 0x12, 0x26, 0xe1, 0xb7, 0x60, 0x49,
+	0xef, 0x53, 0xe3, 0x4b, 0x12, 0x8d, 0x64, 0x81, 0x13, 0x45, 0x30, 0xdf, 0x01, 0x89, 0x47, 0xc6,
+	0x9d, 0x93, 0x75, 0x73, 0x3c, 0x24, 0x3c, 0xcd, 0xb3, 0xea, 0x8a, 0x47, 0xef, 0x70, 0xb2, 0xf2,
+	0x57, 0x04, 0x95, 0x26, 0xa1, 0xb6, 0xd1, 0x77, 0xee, 0x8d, 0xec, 0x68, 0xf2, 0xbf, 0xe2, 0x22,
+	0xbc, 0x0b, 0x05, 0xaf, 0xba, 0x34, 0x87, 0xd0, 0x97, 0x8f, 0x11, 0x79, 0x4f, 0xb4, 0x43, 0xa8,
+	0xf2, 0x10, 0x36, 0x66, 0xea, 0x2c, 0x82, 0xb2, 0x05, 0xf3, 0x26, 0x13, 0x11, 0x51, 0x91, 0x82,
+	0x16, 0xcc, 0xb7, 0xaa, 0x82, 0xef, 0xc6, 0x5c, 0x80, 0x35, 0x09, 0xd5, 0xdd, 0x7c, 0xf2, 0x62,
+	0xde, 0x86, 0xd2, 0x14, 0x47, 0xc0, 0xdf, 0x81, 0x45, 0x53, 0xd0, 0xc4, 0x01, 0xe5, 0xf8, 0x01,
+	0xfe, 0x1e, 0x5f, 0x52, 0xf9, 0x37, 0x82, 0x95, 0xd8, 0x08, 0xe2, 0xfa, 0xeb, 0xc8, 0x1e, 0x99,
+	0x9a, 0xf7, 0x7c, 0x12, 0x14, 0xc3, 0xb2, 0x4b, 0x6f, 0x08, 0x72, 0x63, 0x10, 0xae, 0x96, 0x74,
+	0xa4, 0x5a, 0x82, 0xfb, 0x37, 0xf3, 0x4a, 0xef, 0xdf, 0xe0, 0x82, 0xcc, 0x5e, 0x7c, 0x41, 0x7e,
+	0x83, 0x60, 0x8e, 0x5b, 0xf8, 0xaa, 0xf2, 0x47, 0x86, 0x45, 0x22, 0x3e, 0x10, 0x58, 0x76, 0xcf,
+	0xa9, 0xfe, 0xfa, 0x15, 0x7c, 0x8e, 0xd4, 0x60, 0x29, 0x92, 0x69, 0xff, 0xc3, 0xcb, 0x92, 0x06,
+	0x85, 0x30, 0x07, 0x5f, 0x17, 0x5f, 0x59, 0xbc, 0xff, 0xaf, 0x7a, 0xbb, 0x19, 0x9b, 0x7d, 0x92,
+	0x33, 0x36, 0xc6, 0x90, 0x65, 0x17, 0x3f, 0x0f, 0x3a, 0xfb, 0x1d, 0xbc, 0x24, 0x64, 0x18, 0x91,
+	0x2f, 0x94, 0x5f, 0x23, 0x58, 0x0e, 0xf2, 0xeb, 0x9e, 0x31, 0x24, 0x3f, 0x46, 0x7a, 0xc9, 0xb0,
+	0x78, 0x64, 0x0c, 0x09, 0xd3, 0x81, 0x1f, 0xe7, 0xaf, 0x5d, 0xdd, 0x02, 0x3f, 0x73, 0x4f, 0xbd,
+	0xbb, 0x05, 0xf9, 0xd0, 0x15, 0xe6, 0x7e, 0xa5, 0x35, 0x5a, 0x5a, 0xb3, 0xde, 0x6c, 0xab, 0xbf,
+	0x90, 0x52, 0x18, 0x60, 0xbe, 0xb6, 0xdb, 0x6d, 0x7c, 0x5a, 0x97, 0xd0, 0xbb, 0x0f, 0x20, 0xe7,
+	0x1b, 0x8b, 0x73, 0x30, 0x57, 0xff, 0xe4, 0xb0, 0x76, 0x20, 0xa5, 0xdc, 0x2d, 0xad, 0x76, 0x57,
+	0xe3, 0x4b, 0x84, 0x57, 0x20, 0xaf, 0xd6, 0xef, 0xd7, 0x1f, 0x6b, 0xcd, 0x5a, 0x77, 0x77, 0x5f,
+	0x4a, 0x63, 0x0c, 0xcb, 0x9c, 0xd0, 0x6a, 0x0b, 0x5a, 0xe6, 0xd6, 0x77, 0x0b, 0xb0, 0xe8, 0x59,
+	0x83, 0x3f, 0x80, 0xec, 0xa3, 0x89, 0x73, 0x82, 0xaf, 0x06, 0x95, 0xf0, 0x99, 0x6d, 0x50, 0x22,
+	0x2a, 0x5b, 0x2e, 0x4d, 0xd1, 0x79, 0x5d, 0x2b, 0x29, 0xbc, 0x07, 0xf9, 0xd0, 0x0c, 0x89, 0x13,
+	0xdf, 0x5d, 0xe4, 0xf5, 0x84, 0x29, 0x3a, 0xc0, 0xb8, 0x81, 0x70, 0x1b, 0x96, 0x19, 0xcb, 0x9b,
+	0x11, 0x1d, 0xec, 0x7f, 0x44, 0x27, 0x7d, 0xa6, 0xc9, 0xd7, 0x66, 0x70, 0x7d, 0xb5, 0xf6, 0xa3,
+	0x6f, 0x89, 0x72, 0xd2, 0xb3, 0x63, 0x5c, 0xb9, 0x84, 0x51, 0x4c, 0x49, 0xe1, 0x3a, 0x40, 0x30,
+	0xc8, 0xe0, 0x37, 0x22, 0xc2, 0xe1, 0xe1, 0x4b, 0x96, 0x93, 0x58, 0x3e, 0xcc, 0x0e, 0xe4, 0xfc,
+	0xeb, 0x18, 0x97, 0x13, 0x6e, 0x68, 0x0e, 0x32, 0xfb, 0xee, 0x56, 0x52, 0xf8, 0x1e, 0x14, 0x6a,
+	0xc3, 0xe1, 0x65, 0x60, 0xe4, 0x30, 0xc7, 0x89, 0xe3, 0x0c, 0xa1, 0x34, 0xe3, 0x3e, 0xc0, 0x6f,
+	0xfb, 0x55, 0xf5, 0xd2, 0x4b, 0x4e, 0xfe, 0xff, 0x0b, 0xe5, 0xfc, 0xd3, 0xba, 0xb0, 0x12, 0xbb,
+	0x16, 0x70, 0x25, 0xb6, 0x3b, 0x76, 0x93, 0xc8, 0x1b, 0x33, 0xf9, 0x3e, 0x6a, 0x0f, 0x8a, 0x81,
+	0x9f, 0xfd, 0x67, 0x67, 0xac, 0x4c, 0x07, 0x21, 0xfe, 0xc6, 0x2d, 0xbf, 0xf5, 0x52, 0x99, 0x50,
+	0x56, 0x3e, 0x81, 0xab, 0xc9, 0xaf, 0xb3, 0xf8, 0x7a, 0x42, 0xce, 0x4c, 0xbf, 0x34, 0xcb, 0x6f,
+	0x5f, 0x24, 0x16, 0x3a, 0xac, 0x0b, 0x2b, 0xb1, 0x11, 0x27, 0x70, 0x53, 0xf2, 0x90, 0x25, 0x6f,
+	0xcc, 0xe4, 0x7b, 0xb8, 0x3b, 0x1f, 0x3d, 0x7d, 0x5e, 0x49, 0x7d, 0xfb, 0xbc, 0x92, 0xfa, 0xfe,
+	0x79, 0x05, 0xfd, 0xea, 0xbc, 0x82, 0xfe, 0x74, 0x5e, 0x41, 0x5f, 0x9f, 0x57, 0xd0, 0xd3, 0xf3,
+	0x0a, 0xfa, 0xe7, 0x79, 0x05, 0xfd, 0xeb, 0xbc, 0x92, 0xfa, 0xfe, 0xbc, 0x82, 0x7e, 0xfb, 0xa2,
+	0x92, 0x7a, 0xfa, 0xa2, 0x92, 0xfa, 0xf6, 0x45, 0x25, 0xf5, 0xcb, 0xf9, 0xfe, 0xd0, 0x20, 0x16,
+	0xed, 0xcd, 0xb3, 0x7f, 0x19, 0xdc, 0xfe, 0xef, 0x00, 0x9c, 0x64, 0x84, 0x3a, 0xad, 0x18, 0x00,
+	0x00,
 }
 
 func (x CountMethod) String() string {
@@ -2989,6 +3137,86 @@ func (this *UsersStatsResponse) Equal(that interface{}) bool {
 	}
 	return true
 }
+func (this *CostAttributionRequest) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*CostAttributionRequest)
+	if !ok {
+		that2, ok := that.(CostAttributionRequest)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	return true
+}
+func (this *CostAttributionResponse) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*CostAttributionResponse)
+	if !ok {
+		that2, ok := that.(CostAttributionResponse)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if len(this.Items) != len(that1.Items) {
+		return false
+	}
+	for i := range this.Items {
+		if !this.Items[i].Equal(that1.Items[i]) {
+			return false
+		}
+	}
+	return true
+}
+func (this *CostAttributionItem) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*CostAttributionItem)
+	if !ok {
+		that2, ok := that.(CostAttributionItem)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if this.Attribution != that1.Attribution {
+		return false
+	}
+	if this.ActiveSeries != that1.ActiveSeries {
+		return false
+	}
+	if this.IngestedSamples != that1.IngestedSamples {
+		return false
+	}
+	return true
+}
 func (this *MetricsForLabelMatchersRequest) Equal(that interface{}) bool {
 	if that == nil {
 		return this == nil
@@ -3647,6 +3875,39 @@ func (this *UsersStatsResponse) GoString() string {
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
+func (this *CostAttributionRequest) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 4)
+	s = append(s, "&client.CostAttributionRequest{")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
+func (this *CostAttributionResponse) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 5)
+	s = append(s, "&client.CostAttributionResponse{")
+	if this.Items != nil {
+		s = append(s, "Items: "+fmt.Sprintf("%#v", this.Items)+",\n")
+	}
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
+func (this *CostAttributionItem) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 7)
+	s = append(s, "&client.CostAttributionItem{")
+	s = append(s, "Attribution: "+fmt.Sprintf("%#v", this.Attribution)+",\n")
+	s = append(s, "ActiveSeries: "+fmt.Sprintf("%#v", this.ActiveSeries)+",\n")
+	s = append(s, "IngestedSamples: "+fmt.Sprintf("%#v", this.IngestedSamples)+",\n")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
 func (this *MetricsForLabelMatchersRequest) GoString() string {
 	if this == nil {
 		return "nil"
@@ -3800,6 +4061,9 @@ type IngesterClient interface {
 	// that match the matchers.
 	// The listing order of the labels is not guaranteed.
 	LabelValuesCardinality(ctx context.Context, in *LabelValuesCardinalityRequest, opts ...grpc.CallOption) (Ingester_LabelValuesCardinalityClient, error)
+	// CostAttribution returns the active series and the ingested samples of the tenant
+	// for each attribution tracked by the cost attribution of the ingester.
+	CostAttribution(ctx context.Context, in *CostAttributionRequest, opts ...grpc.CallOption) (*CostAttributionResponse, error)
 }
 
 type ingesterClient struct {
@@ -3978,6 +4242,15 @@ func (x *ingesterLabelValuesCardinalityClient) Recv() (*LabelValuesCardinalityRe
 	return m, nil
 }
 
+func (c *ingesterClient) CostAttribution(ctx context.Context, in *CostAttributionRequest, opts ...grpc.CallOption) (*CostAttributionResponse, error) {
+	out := new(CostAttributionResponse)
+	err := c.cc.Invoke(ctx, "/cortex.Ingester/CostAttribution", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // IngesterServer is the server API for Ingester service.
 type IngesterServer interface {
 	Push(context.Context, *mimirpb.WriteRequest) (*mimirpb.WriteResponse, error)
@@ -3996,6 +4269,9 @@ type IngesterServer interface {
 	// that match the matchers.
 	// The listing order of the labels is not guaranteed.
 	LabelValuesCardinality(*LabelValuesCardinalityRequest, Ingester_LabelValuesCardinalityServer) error
+	// CostAttribution returns the active series and the ingested samples of the tenant
+	// for each attribution tracked by the cost attribution of the ingester.
+	CostAttribution(context.Context, *CostAttributionRequest) (*CostAttributionResponse, error)
 }
 
 // UnimplementedIngesterServer can be embedded to have forward compatible implementations.
@@ -4035,6 +4311,9 @@ func (*UnimplementedIngesterServer) LabelNamesAndValues(req *LabelNamesAndValues
 func (*UnimplementedIngesterServer) LabelValuesCardinality(req *LabelValuesCardinalityRequest, srv Ingester_LabelValuesCardinalityServer) error {
 	return status.Errorf(codes.Unimplemented, "method LabelValuesCardinality not implemented")
 }
+func (*UnimplementedIngesterServer) CostAttribution(ctx context.Context, req *CostAttributionRequest) (*CostAttributionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CostAttribution not implemented")
+}
 
 func RegisterIngesterServer(s *grpc.Server, srv IngesterServer) {
 	s.RegisterService(&_Ingester_serviceDesc, srv)
@@ -4247,6 +4526,24 @@ func (x *ingesterLabelValuesCardinalityServer) Send(m *LabelValuesCardinalityRes
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Ingester_CostAttribution_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CostAttributionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngesterServer).CostAttribution(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cortex.Ingester/CostAttribution",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngesterServer).CostAttribution(ctx, req.(*CostAttributionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Ingester_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "cortex.Ingester",
 	HandlerType: (*IngesterServer)(nil),
@@ -4283,6 +4580,10 @@ var _Ingester_serviceDesc = grpc.ServiceDesc{
 			MethodName: "MetricsMetadata",
 			Handler:    _Ingester_MetricsMetadata_Handler,
 		},
+		{
+			MethodName: "CostAttribution",
+			Handler:    _Ingester_CostAttribution_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -5447,7 +5748,7 @@ func (m *UsersStatsResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
-func (m *MetricsForLabelMatchersRequest) Marshal() (dAtA []byte, err error) {
+func (m *CostAttributionRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -5457,44 +5758,20 @@ func (m *MetricsForLabelMatchersRequest) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *MetricsForLabelMatchersRequest) MarshalTo(dAtA []byte) (int, error) {
+func (m *CostAttributionRequest) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *MetricsForLabelMatchersRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *CostAttributionRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	if len(m.MatchersSet) > 0 {
-		for iNdEx := len(m.MatchersSet) - 1; iNdEx >= 0; iNdEx-- {
-			{
-				size, err := m.MatchersSet[iNdEx].MarshalToSizedBuffer(dAtA[:i])
-				if err != nil {
-					return 0, err
-				}
-				i -= size
-				i = encodeVarintIngester(dAtA, i, uint64(size))
-			}
-			i--
-			dAtA[i] = 0x1a
-		}
-	}
-	if m.EndTimestampMs != 0 {
-		i = encodeVarintIngester(dAtA, i, uint64(m.EndTimestampMs))
-		i--
-		dAtA[i] = 0x10
-	}
-	if m.StartTimestampMs != 0 {
-		i = encodeVarintIngester(dAtA, i, uint64(m.StartTimestampMs))
-		i--
-		dAtA[i] = 0x8
-	}
 	return len(dAtA) - i, nil
 }
 
-func (m *MetricsForLabelMatchersResponse) Marshal() (dAtA []byte, err error) {
+func (m *CostAttributionResponse) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -5504,20 +5781,20 @@ func (m *MetricsForLabelMatchersResponse) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *MetricsForLabelMatchersResponse) MarshalTo(dAtA []byte) (int, error) {
+func (m *CostAttributionResponse) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *MetricsForLabelMatchersResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *CostAttributionResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	if len(m.Metric) > 0 {
-		for iNdEx := len(m.Metric) - 1; iNdEx >= 0; iNdEx-- {
+	if len(m.Items) > 0 {
+		for iNdEx := len(m.Items) - 1; iNdEx >= 0; iNdEx-- {
 			{
-				size, err := m.Metric[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				size, err := m.Items[iNdEx].MarshalToSizedBuffer(dAtA[:i])
 				if err != nil {
 					return 0, err
 				}
@@ -5531,7 +5808,7 @@ func (m *MetricsForLabelMatchersResponse) MarshalToSizedBuffer(dAtA []byte) (int
 	return len(dAtA) - i, nil
 }
 
-func (m *MetricsMetadataRequest) Marshal() (dAtA []byte, err error) {
+func (m *CostAttributionItem) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -5541,17 +5818,141 @@ func (m *MetricsMetadataRequest) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *MetricsMetadataRequest) MarshalTo(dAtA []byte) (int, error) {
+func (m *CostAttributionItem) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *MetricsMetadataRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *CostAttributionItem) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	return len(dAtA) - i, nil
+	if m.IngestedSamples != 0 {
+		i = encodeVarintIngester(dAtA, i, uint64(m.IngestedSamples))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.ActiveSeries != 0 {
+		i = encodeVarintIngester(dAtA, i, uint64(m.ActiveSeries))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Attribution) > 0 {
+		i -= len(m.Attribution)
+		copy(dAtA[i:], m.Attribution)
+		i = encodeVarintIngester(dAtA, i, uint64(len(m.Attribution)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *MetricsForLabelMatchersRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MetricsForLabelMatchersRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *MetricsForLabelMatchersRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.MatchersSet) > 0 {
+		for iNdEx := len(m.MatchersSet) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.MatchersSet[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintIngester(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if m.EndTimestampMs != 0 {
+		i = encodeVarintIngester(dAtA, i, uint64(m.EndTimestampMs))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.StartTimestampMs != 0 {
+		i = encodeVarintIngester(dAtA, i, uint64(m.StartTimestampMs))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *MetricsForLabelMatchersResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MetricsForLabelMatchersResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *MetricsForLabelMatchersResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Metric) > 0 {
+		for iNdEx := len(m.Metric) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Metric[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintIngester(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *MetricsMetadataRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MetricsMetadataRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *MetricsMetadataRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	return len(dAtA) - i, nil
 }
 
 func (m *MetricsMetadataResponse) Marshal() (dAtA []byte, err error) {
@@ -6334,6 +6735,49 @@ func (m *UsersStatsResponse) Size() (n int) {
 	return n
 }
 
+func (m *CostAttributionRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	return n
+}
+
+func (m *CostAttributionResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Items) > 0 {
+		for _, e := range m.Items {
+			l = e.Size()
+			n += 1 + l + sovIngester(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *CostAttributionItem) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Attribution)
+	if l > 0 {
+		n += 1 + l + sovIngester(uint64(l))
+	}
+	if m.ActiveSeries != 0 {
+		n += 1 + sovIngester(uint64(m.ActiveSeries))
+	}
+	if m.IngestedSamples != 0 {
+		n += 1 + sovIngester(uint64(m.IngestedSamples))
+	}
+	return n
+}
+
 func (m *MetricsForLabelMatchersRequest) Size() (n int) {
 	if m == nil {
 		return 0
@@ -6899,6 +7343,42 @@ func (this *UsersStatsResponse) String() string {
 	}, "")
 	return s
 }
+func (this *CostAttributionRequest) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&CostAttributionRequest{`,
+		`}`,
+	}, "")
+	return s
+}
+func (this *CostAttributionResponse) String() string {
+	if this == nil {
+		return "nil"
+	}
+	repeatedStringForItems := "[]*CostAttributionItem{"
+	for _, f := range this.Items {
+		repeatedStringForItems += strings.Replace(f.String(), "CostAttributionItem", "CostAttributionItem", 1) + ","
+	}
+	repeatedStringForItems += "}"
+	s := strings.Join([]string{`&CostAttributionResponse{`,
+		`Items:` + repeatedStringForItems + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func (this *CostAttributionItem) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&CostAttributionItem{`,
+		`Attribution:` + fmt.Sprintf("%v", this.Attribution) + `,`,
+		`ActiveSeries:` + fmt.Sprintf("%v", this.ActiveSeries) + `,`,
+		`IngestedSamples:` + fmt.Sprintf("%v", this.IngestedSamples) + `,`,
+		`}`,
+	}, "")
+	return s
+}
 func (this *MetricsForLabelMatchersRequest) String() string {
 	if this == nil {
 		return "nil"
@@ -10066,6 +10546,260 @@ func (m *UsersStatsResponse) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *CostAttributionRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIngester
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: CostAttributionRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: CostAttributionRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIngester(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthIngester
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *CostAttributionResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIngester
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: CostAttributionResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: CostAttributionResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Items", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIngester
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthIngester
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthIngester
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Items = append(m.Items, &CostAttributionItem{})
+			if err := m.Items[len(m.Items)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIngester(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthIngester
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *CostAttributionItem) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIngester
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: CostAttributionItem: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: CostAttributionItem: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Attribution", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIngester
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIngester
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIngester
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Attribution = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ActiveSeries", wireType)
+			}
+			m.ActiveSeries = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIngester
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ActiveSeries |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field IngestedSamples", wireType)
+			}
+			m.IngestedSamples = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIngester
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.IngestedSamples |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIngester(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthIngester
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *MetricsForLabelMatchersRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
@@ -52,6 +52,11 @@ func (m *IngesterServerMock) UserStats(ctx context.Context, r *UserStatsRequest)
 	return args.Get(0).(*UserStatsResponse), args.Error(1)
 }
 
+func (m *IngesterServerMock) CostAttribution(ctx context.Context, r *CostAttributionRequest) (*CostAttributionResponse, error) {
+	args := m.Called(ctx, r)
+	return args.Get(0).(*CostAttributionResponse), args.Error(1)
+}
+
 func (m *IngesterServerMock) AllUserStats(ctx context.Context, r *UserStatsRequest) (*UsersStatsResponse, error) {
 	args := m.Called(ctx, r)
 	return args.Get(0).(*UsersStatsResponse), args.Error(1)
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+// Provenance-includes-location: https://github.com/cortexproject/cortex/blob/master/pkg/distributor/distributor.go
+// Provenance-includes-license: Apache-2.0
+// Provenance-includes-copyright: The Cortex Authors.
+
+package client
+
+import (
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+// ShardByMetricName returns the token for the given metric. The provided metricName
+// is guaranteed to not be retained.
+func ShardByMetricName(userID string, metricName string) uint32 {
+	h := ShardByUser(userID)
+	h = HashAdd32(h, metricName)
+	return h
+}
+
+// ShardByUser returns the token for the given tenant.
+func ShardByUser(userID string) uint32 {
+	h := HashNew32()
+	h = HashAdd32(h, userID)
+	return h
+}
+
+// ShardByAllLabelAdapters returns the token for the given series, which is used by distributors
+// to shard series to ingesters. This function generates different values for different order
+// of same labels.
+func ShardByAllLabelAdapters(userID string, labels []mimirpb.LabelAdapter) uint32 {
+	h := ShardByUser(userID)
+	for _, label := range labels {
+		h = HashAdd32(h, label.Name)
+		h = HashAdd32(h, label.Value)
+	}
+	return h
+}
+
+// ShardByAllLabels is like ShardByAllLabelAdapters but for labels.Labels. Given the same sorted
+// labels, it returns the same token as ShardByAllLabelAdapters.
+func ShardByAllLabels(userID string, ls labels.Labels) uint32 {
+	h := ShardByUser(userID)
+	ls.Range(func(l labels.Label) {
+		h = HashAdd32(h, l.Name)
+		h = HashAdd32(h, l.Value)
+	})
+	return h
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package client
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestShardByAllLabels_ShouldReturnSameTokenAsShardByAllLabelAdapters(t *testing.T) {
+	series := labels.FromStrings(labels.MetricName, "foo", "bar", "baz", "sample", "1")
+
+	assert.Equal(t, ShardByAllLabelAdapters("test", mimirpb.FromLabelsToLabelAdapters(series)), ShardByAllLabels("test", series))
+	assert.NotEqual(t, ShardByAllLabels("test", series), ShardByAllLabels("another", series))
+}
+
+// This is not great, but we deal with unsorted labels in prePushRelabelMiddleware.
+func TestShardByAllLabelAdapters_ReturnsWrongResultsForUnsortedLabels(t *testing.T) {
+	val1 := ShardByAllLabelAdapters("test", []mimirpb.LabelAdapter{
+		{Name: "__name__", Value: "foo"},
+		{Name: "bar", Value: "baz"},
+		{Name: "sample", Value: "1"},
+	})
+
+	val2 := ShardByAllLabelAdapters("test", []mimirpb.LabelAdapter{
+		{Name: "__name__", Value: "foo"},
+		{Name: "sample", Value: "1"},
+		{Name: "bar", Value: "baz"},
+	})
+
+	assert.NotEqual(t, val1, val2)
+}
@@ -118,6 +118,15 @@ func formatMaxSeriesPerMetricError(limits *validation.Overrides, labels labels.L
 	return makeMetricLimitError(labels, err)
 }
 
+func formatMaxValuesPerLabelNameError(limits *validation.Overrides, labels labels.Labels, labelName, userID string) error {
+	globalLimit := limits.MaxGlobalValuesPerLabelName(userID)[labelName]
+	err := errors.New(globalerror.MaxValuesPerLabelName.MessageWithPerTenantLimitConfig(
+		fmt.Sprintf("per-label-name values limit of %d exceeded for label name %s", globalLimit, labelName),
+		validation.MaxValuesPerLabelNameFlag,
+	))
+	return makeMetricLimitError(labels, err)
+}
+
 func formatMaxMetadataPerUserError(limits *validation.Overrides, userID string) error {
 	globalLimit := limits.MaxGlobalMetricsWithMetadataPerUser(userID)
 	err := errors.New(globalerror.MaxMetadataPerUser.MessageWithPerTenantLimitConfig(
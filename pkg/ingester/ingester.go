@@ -52,6 +52,7 @@ import (
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc/codes"
 
+	"github.com/grafana/mimir/pkg/costattribution"
 	"github.com/grafana/mimir/pkg/ingester/activeseries"
 	"github.com/grafana/mimir/pkg/ingester/client"
 	"github.com/grafana/mimir/pkg/mimirpb"
@@ -59,6 +60,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/sharding"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/metricmetadata"
 	"github.com/grafana/mimir/pkg/usagestats"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/globalerror"
@@ -103,6 +105,7 @@ const (
 	reasonSampleOutOfBounds    = "sample-out-of-bounds"
 	reasonPerUserSeriesLimit   = "per_user_series_limit"
 	reasonPerMetricSeriesLimit = "per_metric_series_limit"
+	reasonPerLabelValuesLimit  = "per_label_values_limit"
 
 	replicationFactorStatsName             = "ingester_replication_factor"
 	ringStoreStatsName                     = "ingester_ring_store"
@@ -124,6 +127,8 @@ var (
 	reasonIngesterMaxTenants              = globalerror.IngesterMaxTenants.LabelValue()
 	reasonIngesterMaxInMemorySeries       = globalerror.IngesterMaxInMemorySeries.LabelValue()
 	reasonIngesterMaxInflightPushRequests = globalerror.IngesterMaxInflightPushRequests.LabelValue()
+
+	errInvalidOwnedSeriesUpdateInterval = errors.New("invalid owned series update interval, must be greater than 0")
 )
 
 // BlocksUploader interface is used to have an easy way to mock it in tests.
@@ -171,6 +176,10 @@ type Config struct {
 	ReadPathCPUUtilizationLimit          float64 `yaml:"read_path_cpu_utilization_limit" category:"experimental"`
 	ReadPathMemoryUtilizationLimit       uint64  `yaml:"read_path_memory_utilization_limit" category:"experimental"`
 	LogUtilizationBasedLimiterCPUSamples bool    `yaml:"log_utilization_based_limiter_cpu_samples" category:"experimental"`
+
+	UseIngesterOwnedSeriesForLimits bool          `yaml:"use_ingester_owned_series_for_limits" category:"experimental"`
+	TrackIngesterOwnedSeries        bool          `yaml:"track_ingester_owned_series" category:"experimental"`
+	OwnedSeriesUpdateInterval       time.Duration `yaml:"owned_series_update_interval" category:"experimental"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet
@@ -187,12 +196,24 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	f.Float64Var(&cfg.ReadPathCPUUtilizationLimit, "ingester.read-path-cpu-utilization-limit", 0, "CPU utilization limit, as CPU cores, for CPU/memory utilization based read request limiting. Use 0 to disable it.")
 	f.Uint64Var(&cfg.ReadPathMemoryUtilizationLimit, "ingester.read-path-memory-utilization-limit", 0, "Memory limit, in bytes, for CPU/memory utilization based read request limiting. Use 0 to disable it.")
 	f.BoolVar(&cfg.LogUtilizationBasedLimiterCPUSamples, "ingester.log-utilization-based-limiter-cpu-samples", false, "Enable logging of utilization based limiter CPU samples.")
+	f.BoolVar(&cfg.UseIngesterOwnedSeriesForLimits, "ingester.use-ingester-owned-series-for-limits", true, "When enabled, only series currently owned by the ingester according to the ring are used when checking the per-tenant series limit. Enabling this option also enables -ingester.track-ingester-owned-series.")
+	f.BoolVar(&cfg.TrackIngesterOwnedSeries, "ingester.track-ingester-owned-series", false, "Track the number of in-memory series owned by the ingester according to the ring, even if -ingester.use-ingester-owned-series-for-limits is disabled.")
+	f.DurationVar(&cfg.OwnedSeriesUpdateInterval, "ingester.owned-series-update-interval", 15*time.Second, "How often to check for ring and tenant shard size changes, and to recompute the owned series of the affected tenants.")
 }
 
 func (cfg *Config) Validate() error {
+	if cfg.ownedSeriesTrackingEnabled() && cfg.OwnedSeriesUpdateInterval <= 0 {
+		return errInvalidOwnedSeriesUpdateInterval
+	}
+
 	return cfg.IngesterRing.Validate()
 }
 
+// ownedSeriesTrackingEnabled returns whether the ingester should track the number of owned series.
+func (cfg *Config) ownedSeriesTrackingEnabled() bool {
+	return cfg.TrackIngesterOwnedSeries || cfg.UseIngesterOwnedSeriesForLimits
+}
+
 func (cfg *Config) getIgnoreSeriesLimitForMetricNamesMap() map[string]struct{} {
 	if cfg.IgnoreSeriesLimitForMetricNames == "" {
 		return nil
@@ -225,6 +246,7 @@ type Ingester struct {
 	logger  log.Logger
 
 	lifecycler         *ring.Lifecycler
+	ingestersRing      ring.ReadRing
 	limits             *validation.Overrides
 	limiter            *Limiter
 	subservicesWatcher *services.FailureWatcher
@@ -276,6 +298,13 @@ type Ingester struct {
 	maxOutOfOrderTimeWindowSecondsStat *expvar.Int
 
 	utilizationBasedLimiter utilizationBasedLimiter
+
+	ownedSeriesService *ownedSeriesService
+
+	// Read-only mode, used to gracefully scale down the ingester.
+	readOnlyMtx     sync.Mutex   // Serializes the requests to switch to and from read-only mode.
+	readOnlySince   atomic.Int64 // Unix timestamp with milliseconds precision, or 0 if not read-only.
+	readOnlyFlushed atomic.Bool  // Whether the in-memory series have been flushed since switching to read-only mode.
 }
 
 func newIngester(cfg Config, limits *validation.Overrides, registerer prometheus.Registerer, logger log.Logger) (*Ingester, error) {
@@ -317,11 +346,12 @@ func newIngester(cfg Config, limits *validation.Overrides, registerer prometheus
 }
 
 // New returns an Ingester that uses Mimir block storage.
-func New(cfg Config, limits *validation.Overrides, activeGroupsCleanupService *util.ActiveGroupsCleanupService, registerer prometheus.Registerer, logger log.Logger) (*Ingester, error) {
+func New(cfg Config, limits *validation.Overrides, ingestersRing ring.ReadRing, activeGroupsCleanupService *util.ActiveGroupsCleanupService, registerer prometheus.Registerer, logger log.Logger) (*Ingester, error) {
 	i, err := newIngester(cfg, limits, registerer, logger)
 	if err != nil {
 		return nil, err
 	}
+	i.ingestersRing = ingestersRing
 	i.ingestionRate = util_math.NewEWMARate(0.2, instanceIngestionRateTickInterval)
 	i.metrics = newIngesterMetrics(registerer, cfg.ActiveSeriesMetrics.Enabled, i.getInstanceLimits, i.ingestionRate, &i.inflightPushRequests)
 	i.activeGroups = activeGroupsCleanupService
@@ -366,6 +396,12 @@ func New(cfg Config, limits *validation.Overrides, activeGroupsCleanupService *u
 
 	i.shipperIngesterID = i.lifecycler.ID
 
+	// The owned series can only be tracked if the ingester has a client of the ingesters ring.
+	if cfg.ownedSeriesTrackingEnabled() && ingestersRing != nil {
+		i.ownedSeriesService = newOwnedSeriesService(cfg.OwnedSeriesUpdateInterval, ingestersRing, limits,
+			i.getTSDBUsers, i.getTSDB, i.metrics.ownedSeriesPerUser, log.With(logger, "component", "owned series"), registerer)
+	}
+
 	// Apply positive jitter only to ensure that the minimum timeout is adhered to.
 	i.compactionIdleTimeout = util.DurationWithPositiveJitter(i.cfg.BlocksStorageConfig.TSDB.HeadCompactionIdleTimeout, compactionIdleTimeoutJitter)
 	level.Info(i.logger).Log("msg", "TSDB idle compaction timeout set", "timeout", i.compactionIdleTimeout)
@@ -412,6 +448,10 @@ func (i *Ingester) starting(ctx context.Context) error {
 		return errors.Wrap(err, "opening existing TSDBs")
 	}
 
+	if err := i.restoreReadOnly(ctx); err != nil {
+		return err
+	}
+
 	// Important: we want to keep lifecycler running until we ask it to stop, so we need to give it independent context
 	if err := i.lifecycler.StartAsync(context.Background()); err != nil {
 		return errors.Wrap(err, "failed to start lifecycler")
@@ -431,6 +471,11 @@ func (i *Ingester) starting(ctx context.Context) error {
 		servs = append(servs, shippingService)
 	}
 
+	if i.cfg.BlocksStorageConfig.MetadataStore.Enabled {
+		metadataUploadService := services.NewTimerService(i.cfg.BlocksStorageConfig.MetadataStore.UploadInterval, nil, i.uploadMetricsMetadata, nil)
+		servs = append(servs, metadataUploadService)
+	}
+
 	if i.cfg.BlocksStorageConfig.TSDB.CloseIdleTSDBTimeout > 0 {
 		interval := i.cfg.BlocksStorageConfig.TSDB.CloseIdleTSDBInterval
 		if interval == 0 {
@@ -444,6 +489,10 @@ func (i *Ingester) starting(ctx context.Context) error {
 		servs = append(servs, i.utilizationBasedLimiter)
 	}
 
+	if i.ownedSeriesService != nil {
+		servs = append(servs, i.ownedSeriesService)
+	}
+
 	shutdownMarkerPath := shutdownmarker.GetPath(i.cfg.BlocksStorageConfig.TSDB.Dir)
 	shutdownMarkerFound, err := shutdownmarker.Exists(shutdownMarkerPath)
 	if err != nil {
@@ -459,7 +508,15 @@ func (i *Ingester) starting(ctx context.Context) error {
 	if err == nil {
 		err = services.StartManagerAndAwaitHealthy(ctx, i.subservices)
 	}
-	return errors.Wrap(err, "failed to start ingester components")
+	if err != nil {
+		return errors.Wrap(err, "failed to start ingester components")
+	}
+
+	// Resume the flushing of a read-only ingester, which may have been interrupted by the restart.
+	if i.isReadOnly() {
+		i.flushReadOnlyBlocks()
+	}
+	return nil
 }
 
 func (i *Ingester) stoppingForFlusher(_ error) error {
@@ -478,6 +535,11 @@ func (i *Ingester) stopping(_ error) error {
 		level.Warn(i.logger).Log("msg", "failed to stop ingester subservices", "err", err)
 	}
 
+	// Upload the metric metadata received since the last upload, so that it's not lost on restart.
+	if i.cfg.BlocksStorageConfig.MetadataStore.Enabled {
+		_ = i.uploadMetricsMetadata(context.Background())
+	}
+
 	// Next initiate our graceful exit from the ring.
 	if err := services.StopAndAwaitTerminated(context.Background(), i.lifecycler); err != nil {
 		level.Warn(i.logger).Log("msg", "failed to stop ingester lifecycler", "err", err)
@@ -555,6 +617,17 @@ func (i *Ingester) replaceMatchers(asm *activeseries.Matchers, userDB *userTSDB,
 	userDB.activeSeries.ReloadMatchers(asm, now)
 }
 
+func (i *Ingester) replaceCostAttribution(label string, maxCardinality int, userDB *userTSDB, now time.Time) {
+	i.metrics.activeSeriesAttributedPerUser.DeletePartialMatch(prometheus.Labels{"user": userDB.userID})
+	userDB.activeSeriesAttributions = nil
+
+	var tracker *costattribution.Tracker
+	if label != "" {
+		tracker = costattribution.NewTracker(label, maxCardinality)
+	}
+	userDB.activeSeries.ReloadCostAttribution(tracker, now)
+}
+
 func (i *Ingester) updateActiveSeries(now time.Time) {
 	for _, userID := range i.getTSDBUsers() {
 		userDB := i.getTSDB(userID)
@@ -566,6 +639,10 @@ func (i *Ingester) updateActiveSeries(now time.Time) {
 		if newMatchersConfig.String() != userDB.activeSeries.CurrentConfig().String() {
 			i.replaceMatchers(activeseries.NewMatchers(newMatchersConfig), userDB, now)
 		}
+		newCostAttributionLabel, newMaxCostAttributionCardinality := i.limits.CostAttributionLabel(userID), i.limits.MaxCostAttributionCardinalityPerUser(userID)
+		if label, maxCardinality := userDB.activeSeries.CurrentCostAttribution(); label != newCostAttributionLabel || (label != "" && maxCardinality != newMaxCostAttributionCardinality) {
+			i.replaceCostAttribution(newCostAttributionLabel, newMaxCostAttributionCardinality, userDB, now)
+		}
 		valid := userDB.activeSeries.Purge(now)
 		if !valid {
 			// Active series config has been reloaded, exposing loading metric until MetricsIdleTimeout passes.
@@ -607,6 +684,17 @@ func (i *Ingester) updateActiveSeries(now time.Time) {
 					i.metrics.activeNativeHistogramBucketsCustomTrackersPerUser.DeleteLabelValues(userID, name)
 				}
 			}
+
+			activeAttributed := userDB.activeSeries.ActiveByAttribution()
+			for attribution := range userDB.activeSeriesAttributions {
+				if _, ok := activeAttributed[attribution]; !ok {
+					i.metrics.activeSeriesAttributedPerUser.DeleteLabelValues(userID, attribution)
+				}
+			}
+			for attribution, active := range activeAttributed {
+				i.metrics.activeSeriesAttributedPerUser.WithLabelValues(userID, attribution).Set(float64(active))
+			}
+			userDB.activeSeriesAttributions = activeAttributed
 		}
 	}
 }
@@ -659,6 +747,7 @@ func (i *Ingester) updateUsageStats() {
 // applyTSDBSettings goes through all tenants and applies
 // * The current max-exemplars setting. If it changed, tsdb will resize the buffer; if it didn't change tsdb will return quickly.
 // * The current out-of-order time window. If it changes from 0 to >0, then a new Write-Behind-Log gets created for that tenant.
+// * The current max values per label name setting. Label names no longer limited stop being tracked.
 func (i *Ingester) applyTSDBSettings() {
 	for _, userID := range i.getTSDBUsers() {
 		globalValue := i.limits.MaxGlobalExemplarsPerUser(userID)
@@ -696,6 +785,7 @@ func (i *Ingester) applyTSDBSettings() {
 		} else {
 			db.db.DisableNativeHistograms()
 		}
+		db.labelValues.untrack(i.limits.MaxGlobalValuesPerLabelName(userID))
 	}
 }
 
@@ -717,6 +807,7 @@ type pushStats struct {
 	newValueForTimestampCount int
 	perUserSeriesLimitCount   int
 	perMetricSeriesLimitCount int
+	perLabelValuesLimitCount  int
 }
 
 // PushWithCleanup is the Push() implementation for blocks storage and takes a WriteRequest and adds it to the TSDB head.
@@ -729,6 +820,10 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, pushReq *push.Request) (
 		return nil, util_log.DoNotLogError{Err: err}
 	}
 
+	if i.isReadOnly() {
+		return nil, util_log.DoNotLogError{Err: errIngesterReadOnly}
+	}
+
 	// We will report *this* request in the error too.
 	inflight := i.inflightPushRequests.Inc()
 	defer i.inflightPushRequests.Dec()
@@ -878,6 +973,7 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, pushReq *push.Request) (
 		return &mimirpb.WriteResponse{}, httpgrpc.Errorf(code, wrapWithUser(firstPartialErr, userID).Error())
 	}
 
+	pushReq.SetWritten(push.NewWrittenStats(req))
 	return &mimirpb.WriteResponse{}, nil
 }
 
@@ -903,6 +999,9 @@ func (i *Ingester) updateMetricsFromPushStats(userID string, group string, stats
 	if stats.perMetricSeriesLimitCount > 0 {
 		discarded.perMetricSeriesLimit.WithLabelValues(userID, group).Add(float64(stats.perMetricSeriesLimitCount))
 	}
+	if stats.perLabelValuesLimitCount > 0 {
+		discarded.perLabelValuesLimit.WithLabelValues(userID, group).Add(float64(stats.perLabelValuesLimitCount))
+	}
 	if stats.succeededSamplesCount > 0 {
 		i.ingestionRate.Add(int64(stats.succeededSamplesCount))
 
@@ -928,6 +1027,15 @@ func (i *Ingester) pushSamplesToAppender(userID string, timeseries []mimirpb.Pre
 		// of it, so that we can return it back to the distributor, which will return a
 		// 400 error to the client. The client (Prometheus) will not retry on 400, and
 		// we actually ingested all samples which haven't failed.
+		var labelValuesErr errMaxValuesPerLabelNameLimitExceeded
+		if errors.As(err, &labelValuesErr) {
+			stats.perLabelValuesLimitCount++
+			updateFirstPartial(func() error {
+				return formatMaxValuesPerLabelNameError(i.limiter.limits, mimirpb.FromLabelAdaptersToLabelsWithCopy(labels), labelValuesErr.labelName, userID)
+			})
+			return true
+		}
+
 		//nolint:errorlint // We don't expect the cause error to be wrapped.
 		switch cause := errors.Cause(err); cause {
 		case storage.ErrOutOfBounds:
@@ -988,6 +1096,12 @@ func (i *Ingester) pushSamplesToAppender(userID string, timeseries []mimirpb.Pre
 		maxTimestampMs                   = startAppend.Add(i.limits.CreationGracePeriod(userID)).UnixMilli()
 	)
 
+	// The samples are counted by cost attribution, if enabled for the tenant.
+	var costAttribution *costattribution.Tracker
+	if activeSeries != nil {
+		costAttribution = activeSeries.CostAttribution()
+	}
+
 	var builder labels.ScratchBuilder
 	var nonCopiedLabels labels.Labels
 	for _, ts := range timeseries {
@@ -1142,7 +1256,8 @@ func (i *Ingester) pushSamplesToAppender(userID string, timeseries []mimirpb.Pre
 		}
 
 		if activeSeries != nil && stats.succeededSamplesCount > oldSucceededSamplesCount {
-			activeSeries.UpdateSeries(nonCopiedLabels, ref, startAppend, numNativeHistogramBuckets)
+			attribution := activeSeries.UpdateSeries(nonCopiedLabels, ref, startAppend, numNativeHistogramBuckets)
+			costAttribution.AddSamples(attribution, stats.succeededSamplesCount-oldSucceededSamplesCount)
 		}
 
 		if len(ts.Exemplars) > 0 && i.limits.MaxGlobalExemplarsPerUser(userID) > 0 {
@@ -1415,6 +1530,40 @@ func (i *Ingester) UserStats(ctx context.Context, req *client.UserStatsRequest)
 	return createUserStats(db, req)
 }
 
+// CostAttribution returns the active series and the ingested samples of the tenant for each attribution
+// tracked by the cost attribution of the ingester.
+func (i *Ingester) CostAttribution(ctx context.Context, _ *client.CostAttributionRequest) (*client.CostAttributionResponse, error) {
+	if err := i.checkRunning(); err != nil {
+		return nil, err
+	}
+	if err := i.checkReadOverloaded(); err != nil {
+		return nil, err
+	}
+
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db := i.getTSDB(userID)
+	if db == nil {
+		return &client.CostAttributionResponse{}, nil
+	}
+
+	samples := db.activeSeries.CostAttribution().Samples()
+	activeSeries := db.activeSeries.ActiveByAttribution()
+
+	resp := &client.CostAttributionResponse{Items: make([]*client.CostAttributionItem, 0, len(samples))}
+	for attribution, ingestedSamples := range samples {
+		resp.Items = append(resp.Items, &client.CostAttributionItem{
+			Attribution:     attribution,
+			ActiveSeries:    uint64(activeSeries[attribution]),
+			IngestedSamples: ingestedSamples,
+		})
+	}
+	return resp, nil
+}
+
 func (i *Ingester) AllUserStats(_ context.Context, req *client.UserStatsRequest) (*client.UsersStatsResponse, error) {
 	if err := i.checkRunning(); err != nil {
 		return nil, err
@@ -2122,6 +2271,17 @@ func (i *Ingester) createTSDB(userID string, walReplayConcurrency int) (*userTSD
 		instanceErrors:      i.metrics.rejected,
 		blockMinRetention:   i.cfg.BlocksStorageConfig.TSDB.Retention,
 	}
+	userDB.labelValues = newLabelValuesCounter(i.limiter, userDB.seriesPerLabelValue)
+	if i.ownedSeriesService != nil {
+		userDB.ownedSeries = newOwnedSeriesState(userID, i.lifecycler.Addr)
+		userDB.useOwnedSeriesForLimits = i.cfg.UseIngesterOwnedSeriesForLimits
+	}
+
+	if label := i.limits.CostAttributionLabel(userID); label != "" {
+		// The active series are empty yet, so there's no need to wait for the idle timeout
+		// before considering them valid.
+		userDB.activeSeries.ReloadCostAttribution(costattribution.NewTracker(label, i.limits.MaxCostAttributionCardinalityPerUser(userID)), time.Time{})
+	}
 
 	maxExemplars := i.limiter.convertGlobalToLocalLimit(userID, i.limits.MaxGlobalExemplarsPerUser(userID))
 	oooTW := i.limits.OutOfOrderTimeWindow(userID)
@@ -2200,6 +2360,7 @@ func (i *Ingester) createTSDB(userID string, walReplayConcurrency int) (*userTSD
 			udir,
 			bucket.NewUserBucketClient(userID, i.bucket, i.limits),
 			block.ReceiveSource,
+			userDB,
 		)
 
 		// Initialise the shipper blocks cache.
@@ -2876,67 +3037,70 @@ func (i *Ingester) FlushHandler(w http.ResponseWriter, r *http.Request) {
 	tenants := r.Form[tenantParam]
 
 	allowedUsers := util.NewAllowedTenants(tenants, nil)
-	run := func() {
-		ingCtx := i.BasicService.ServiceContext()
-		if ingCtx == nil || ingCtx.Err() != nil {
-			level.Info(i.logger).Log("msg", "flushing TSDB blocks: ingester not running, ignoring flush request")
-			return
-		}
 
-		compactionCallbackCh := make(chan struct{})
+	if len(r.Form[waitParam]) > 0 && r.Form[waitParam][0] == "true" {
+		// Run synchronously. This simplifies and speeds up tests.
+		i.flushBlocks(allowedUsers)
+	} else {
+		go i.flushBlocks(allowedUsers)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// flushBlocks forces the compaction of the in-memory series of the allowed tenants and, if enabled,
+// ships the compacted blocks to the storage. It returns once done, or once the ingester is stopped.
+func (i *Ingester) flushBlocks(allowedUsers *util.AllowedTenants) {
+	ingCtx := i.BasicService.ServiceContext()
+	if ingCtx == nil || ingCtx.Err() != nil {
+		level.Info(i.logger).Log("msg", "flushing TSDB blocks: ingester not running, ignoring flush request")
+		return
+	}
+
+	compactionCallbackCh := make(chan struct{})
+
+	level.Info(i.logger).Log("msg", "flushing TSDB blocks: triggering compaction")
+	select {
+	case i.forceCompactTrigger <- requestWithUsersAndCallback{users: allowedUsers, callback: compactionCallbackCh}:
+		// Compacting now.
+	case <-ingCtx.Done():
+		level.Warn(i.logger).Log("msg", "failed to compact TSDB blocks, ingester not running anymore")
+		return
+	}
+
+	// Wait until notified about compaction being finished.
+	select {
+	case <-compactionCallbackCh:
+		level.Info(i.logger).Log("msg", "finished compacting TSDB blocks")
+	case <-ingCtx.Done():
+		level.Warn(i.logger).Log("msg", "failed to compact TSDB blocks, ingester not running anymore")
+		return
+	}
+
+	if i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled() {
+		shippingCallbackCh := make(chan struct{}) // must be new channel, as compactionCallbackCh is closed now.
+
+		level.Info(i.logger).Log("msg", "flushing TSDB blocks: triggering shipping")
 
-		level.Info(i.logger).Log("msg", "flushing TSDB blocks: triggering compaction")
 		select {
-		case i.forceCompactTrigger <- requestWithUsersAndCallback{users: allowedUsers, callback: compactionCallbackCh}:
-			// Compacting now.
+		case i.shipTrigger <- requestWithUsersAndCallback{users: allowedUsers, callback: shippingCallbackCh}:
+			// shipping now
 		case <-ingCtx.Done():
-			level.Warn(i.logger).Log("msg", "failed to compact TSDB blocks, ingester not running anymore")
+			level.Warn(i.logger).Log("msg", "failed to ship TSDB blocks, ingester not running anymore")
 			return
 		}
 
-		// Wait until notified about compaction being finished.
+		// Wait until shipping finished.
 		select {
-		case <-compactionCallbackCh:
-			level.Info(i.logger).Log("msg", "finished compacting TSDB blocks")
+		case <-shippingCallbackCh:
+			level.Info(i.logger).Log("msg", "shipping of TSDB blocks finished")
 		case <-ingCtx.Done():
-			level.Warn(i.logger).Log("msg", "failed to compact TSDB blocks, ingester not running anymore")
+			level.Warn(i.logger).Log("msg", "failed to ship TSDB blocks, ingester not running anymore")
 			return
 		}
-
-		if i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled() {
-			shippingCallbackCh := make(chan struct{}) // must be new channel, as compactionCallbackCh is closed now.
-
-			level.Info(i.logger).Log("msg", "flushing TSDB blocks: triggering shipping")
-
-			select {
-			case i.shipTrigger <- requestWithUsersAndCallback{users: allowedUsers, callback: shippingCallbackCh}:
-				// shipping now
-			case <-ingCtx.Done():
-				level.Warn(i.logger).Log("msg", "failed to ship TSDB blocks, ingester not running anymore")
-				return
-			}
-
-			// Wait until shipping finished.
-			select {
-			case <-shippingCallbackCh:
-				level.Info(i.logger).Log("msg", "shipping of TSDB blocks finished")
-			case <-ingCtx.Done():
-				level.Warn(i.logger).Log("msg", "failed to ship TSDB blocks, ingester not running anymore")
-				return
-			}
-		}
-
-		level.Info(i.logger).Log("msg", "flushing TSDB blocks: finished")
 	}
 
-	if len(r.Form[waitParam]) > 0 && r.Form[waitParam][0] == "true" {
-		// Run synchronously. This simplifies and speeds up tests.
-		run()
-	} else {
-		go run()
-	}
-
-	w.WriteHeader(http.StatusNoContent)
+	level.Info(i.logger).Log("msg", "flushing TSDB blocks: finished")
 }
 
 func wrappedTSDBIngestExemplarOtherErr(ingestErr error, timestamp model.Time, seriesLabels, exemplarLabels []mimirpb.LabelAdapter) error {
@@ -3179,6 +3343,31 @@ func (i *Ingester) purgeUserMetricsMetadata() {
 	}
 }
 
+// uploadMetricsMetadata uploads the metric metadata held in memory to the metric metadata store,
+// as a new segment for each tenant. Errors are logged, and the metadata is uploaded again at the
+// next interval.
+func (i *Ingester) uploadMetricsMetadata(ctx context.Context) error {
+	now := time.Now()
+
+	for _, userID := range i.getUsersWithMetadata() {
+		metadata := i.getUserMetadata(userID)
+		if metadata == nil {
+			continue
+		}
+
+		entries := metadata.toMetadataEntries()
+		if len(entries) == 0 {
+			continue
+		}
+
+		if err := metricmetadata.WriteSegment(ctx, i.bucket, userID, i.limits, i.shipperIngesterID, entries, now); err != nil {
+			level.Warn(i.logger).Log("msg", "failed to upload metric metadata", "user", userID, "err", err)
+		}
+	}
+
+	return nil
+}
+
 // MetricsMetadata returns all the metrics metadata of a user.
 func (i *Ingester) MetricsMetadata(ctx context.Context, _ *client.MetricsMetadataRequest) (*client.MetricsMetadataResponse, error) {
 	if err := i.checkRunning(); err != nil {
@@ -86,6 +86,15 @@ func (i *ActivityTrackerWrapper) UserStats(ctx context.Context, request *client.
 	return i.ing.UserStats(ctx, request)
 }
 
+func (i *ActivityTrackerWrapper) CostAttribution(ctx context.Context, request *client.CostAttributionRequest) (*client.CostAttributionResponse, error) {
+	ix := i.tracker.Insert(func() string {
+		return requestActivity(ctx, "Ingester/CostAttribution", request)
+	})
+	defer i.tracker.Delete(ix)
+
+	return i.ing.CostAttribution(ctx, request)
+}
+
 func (i *ActivityTrackerWrapper) AllUserStats(ctx context.Context, request *client.UserStatsRequest) (*client.UsersStatsResponse, error) {
 	ix := i.tracker.Insert(func() string {
 		return requestActivity(ctx, "Ingester/AllUserStats", request)
@@ -149,6 +158,15 @@ func (i *ActivityTrackerWrapper) PrepareShutdownHandler(w http.ResponseWriter, r
 	i.ing.PrepareShutdownHandler(w, r)
 }
 
+func (i *ActivityTrackerWrapper) PrepareInstanceRingDownscaleHandler(w http.ResponseWriter, r *http.Request) {
+	ix := i.tracker.Insert(func() string {
+		return requestActivity(r.Context(), "Ingester/PrepareInstanceRingDownscaleHandler", nil)
+	})
+	defer i.tracker.Delete(ix)
+
+	i.ing.PrepareInstanceRingDownscaleHandler(w, r)
+}
+
 func (i *ActivityTrackerWrapper) ShutdownHandler(w http.ResponseWriter, r *http.Request) {
 	ix := i.tracker.Insert(func() string {
 		return requestActivity(r.Context(), "Ingester/ShutdownHandler", nil)
@@ -185,6 +203,15 @@ func (i *ActivityTrackerWrapper) TenantTSDBHandler(w http.ResponseWriter, r *htt
 	i.ing.TenantTSDBHandler(w, r)
 }
 
+func (i *ActivityTrackerWrapper) TenantLabelValuesLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	ix := i.tracker.Insert(func() string {
+		return requestActivity(r.Context(), "Ingester/TenantLabelValuesLimitsHandler", nil)
+	})
+	defer i.tracker.Delete(ix)
+
+	i.ing.TenantLabelValuesLimitsHandler(w, r)
+}
+
 func requestActivity(ctx context.Context, name string, req interface{}) string {
 	userID, _ := tenant.TenantID(ctx)
 	traceID, _ := tracing.ExtractSampledTraceID(ctx)
@@ -11,6 +11,7 @@ package ingester
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math"
@@ -29,6 +30,7 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/gorilla/mux"
 	"github.com/grafana/dskit/httpgrpc"
 	dskit_metrics "github.com/grafana/dskit/metrics"
 	"github.com/grafana/dskit/middleware"
@@ -63,6 +65,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/sharding"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/metricmetadata"
 	"github.com/grafana/mimir/pkg/usagestats"
 	"github.com/grafana/mimir/pkg/util"
 	util_math "github.com/grafana/mimir/pkg/util/math"
@@ -3994,7 +3997,7 @@ func prepareIngesterWithBlockStorageAndOverrides(t testing.TB, ingesterCfg Confi
 	// Disable TSDB head compaction jitter to have predictable tests.
 	ingesterCfg.BlocksStorageConfig.TSDB.HeadCompactionIntervalJitterEnabled = false
 
-	ingester, err := New(ingesterCfg, overrides, nil, registerer, noDebugNoopLogger{})
+	ingester, err := New(ingesterCfg, overrides, nil, nil, registerer, noDebugNoopLogger{})
 	if err != nil {
 		return nil, err
 	}
@@ -4188,7 +4191,7 @@ func TestIngester_OpenExistingTSDBOnStartup(t *testing.T) {
 			// setup the tsdbs dir
 			testData.setup(t, tempDir)
 
-			ingester, err := New(ingesterCfg, overrides, nil, nil, log.NewNopLogger())
+			ingester, err := New(ingesterCfg, overrides, nil, nil, nil, log.NewNopLogger())
 			require.NoError(t, err)
 
 			startErr := services.StartAndAwaitRunning(context.Background(), ingester)
@@ -4642,6 +4645,114 @@ func TestIngester_flushing(t *testing.T) {
 			},
 		},
 
+		"prepareInstanceRingDownscaleHandler": {
+			setupIngester: func(cfg *Config) {
+				cfg.IngesterRing.UnregisterOnShutdown = false
+				cfg.BlocksStorageConfig.TSDB.FlushBlocksOnShutdown = false
+			},
+
+			action: func(t *testing.T, i *Ingester, reg *prometheus.Registry) {
+				pushSingleSampleWithMetadata(t, i)
+
+				getStatus := func(method string) prepareInstanceRingDownscaleResponse {
+					t.Helper()
+
+					response := httptest.NewRecorder()
+					i.PrepareInstanceRingDownscaleHandler(response, httptest.NewRequest(method, "/ingester/prepare-instance-ring-downscale", nil))
+					require.Equal(t, 200, response.Code)
+
+					var resp prepareInstanceRingDownscaleResponse
+					require.NoError(t, json.Unmarshal(response.Body.Bytes(), &resp))
+					return resp
+				}
+
+				// The ingester is not read-only yet.
+				require.Equal(t, prepareInstanceRingDownscaleResponse{}, getStatus("GET"))
+
+				status1 := getStatus("POST")
+				require.True(t, status1.ReadOnly)
+				require.NotZero(t, status1.ReadOnlyTimestamp)
+				require.False(t, status1.SafeToDelete)
+
+				// The ingester stays ACTIVE, but it's read-only in the ring.
+				require.Equal(t, ring.ACTIVE, i.lifecycler.GetState())
+				require.True(t, i.lifecycler.IsReadOnly())
+				test.Poll(t, time.Second, true, func() interface{} {
+					desc, err := i.lifecycler.KVStore.Get(context.Background(), IngesterRingKey)
+					return err == nil && ring.GetOrCreateRingDesc(desc).Ingesters[i.lifecycler.ID].ReadOnly
+				})
+
+				// The read-only mode is persisted.
+				since, found, err := readReadOnlyMarker(getReadOnlyMarkerPath(i.cfg.BlocksStorageConfig.TSDB.Dir))
+				require.NoError(t, err)
+				require.True(t, found)
+				require.Equal(t, status1.ReadOnlyTimestamp, since.Unix())
+
+				require.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
+					# HELP cortex_ingester_prepare_shutdown_requested If the ingester has been requested to prepare for shutdown via endpoint or marker file.
+					# TYPE cortex_ingester_prepare_shutdown_requested gauge
+					cortex_ingester_prepare_shutdown_requested 1
+
+					# HELP cortex_ingester_read_only If the ingester is in read-only mode, and doesn't accept writes anymore.
+					# TYPE cortex_ingester_read_only gauge
+					cortex_ingester_read_only 1
+				`), "cortex_ingester_prepare_shutdown_requested", "cortex_ingester_read_only"))
+
+				// A read-only ingester rejects writes.
+				ctx := user.InjectOrgID(context.Background(), userID)
+				req, _, _, _ := mockWriteRequest(t, labels.FromStrings(labels.MetricName, "test"), 1, util.TimeToMillis(time.Now()))
+				_, err = i.Push(ctx, req)
+				require.ErrorIs(t, err, errIngesterReadOnly)
+				require.Equal(t, codes.Unavailable, status.Code(errors.Cause(err)))
+
+				// The in-memory series are compacted and shipped in background.
+				test.Poll(t, 5*time.Second, true, func() interface{} {
+					return getStatus("GET").AllBlocksShipped
+				})
+
+				verifyCompactedHead(t, i, true)
+				require.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
+					# HELP cortex_ingester_shipper_uploads_total Total number of uploaded TSDB blocks
+					# TYPE cortex_ingester_shipper_uploads_total counter
+					cortex_ingester_shipper_uploads_total 1
+				`), "cortex_ingester_shipper_uploads_total"))
+
+				// The queriers keep querying the ingester until the query-ingesters-within period has elapsed.
+				status2 := getStatus("POST")
+				require.Equal(t, status1.ReadOnlyTimestamp, status2.ReadOnlyTimestamp)
+				require.Equal(t, status1.ReadOnlyTimestamp+int64((13*time.Hour).Seconds()), status2.SafeToDeleteTimestamp)
+				require.False(t, status2.SafeToDelete)
+				require.True(t, i.prepareInstanceRingDownscaleStatus(time.Unix(status2.SafeToDeleteTimestamp+1, 0)).SafeToDelete)
+
+				// A DELETE reverts the read-only mode.
+				require.Equal(t, prepareInstanceRingDownscaleResponse{}, getStatus("DELETE"))
+				require.False(t, i.lifecycler.IsReadOnly())
+				require.False(t, i.lifecycler.ShouldUnregisterOnShutdown())
+				_, found, err = readReadOnlyMarker(getReadOnlyMarkerPath(i.cfg.BlocksStorageConfig.TSDB.Dir))
+				require.NoError(t, err)
+				require.False(t, found)
+
+				require.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
+					# HELP cortex_ingester_prepare_shutdown_requested If the ingester has been requested to prepare for shutdown via endpoint or marker file.
+					# TYPE cortex_ingester_prepare_shutdown_requested gauge
+					cortex_ingester_prepare_shutdown_requested 0
+
+					# HELP cortex_ingester_read_only If the ingester is in read-only mode, and doesn't accept writes anymore.
+					# TYPE cortex_ingester_read_only gauge
+					cortex_ingester_read_only 0
+				`), "cortex_ingester_prepare_shutdown_requested", "cortex_ingester_read_only"))
+
+				// The ingester accepts writes again.
+				pushSingleSampleAtTime(t, i, util.TimeToMillis(time.Now()))
+
+				// If the ingester isn't "running", requests to the prepare-instance-ring-downscale endpoint should fail.
+				require.NoError(t, services.StopAndAwaitTerminated(context.Background(), i))
+				response := httptest.NewRecorder()
+				i.PrepareInstanceRingDownscaleHandler(response, httptest.NewRequest("GET", "/ingester/prepare-instance-ring-downscale", nil))
+				require.Equal(t, 503, response.Code)
+			},
+		},
+
 		"shutdownHandler": {
 			setupIngester: func(cfg *Config) {
 				cfg.IngesterRing.UnregisterOnShutdown = false
@@ -4851,6 +4962,46 @@ func TestIngester_flushing(t *testing.T) {
 	}
 }
 
+func TestIngester_PrepareInstanceRingDownscaleHandler_RestoresReadOnlyModeOnRestart(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	dataDir := t.TempDir()
+
+	// The ingester was switched to read-only mode before being restarted.
+	readOnlySince := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, createReadOnlyMarker(getReadOnlyMarkerPath(dataDir), readOnlySince))
+
+	reg := prometheus.NewPedanticRegistry()
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, defaultLimitsTestConfig(), dataDir, reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), i)
+	})
+
+	// The ingester joins the ring as read-only.
+	test.Poll(t, 1*time.Second, 1, func() interface{} {
+		return i.lifecycler.HealthyInstancesCount()
+	})
+	desc, err := i.lifecycler.KVStore.Get(context.Background(), IngesterRingKey)
+	require.NoError(t, err)
+	require.True(t, ring.GetOrCreateRingDesc(desc).Ingesters[i.lifecycler.ID].ReadOnly)
+
+	resp := i.prepareInstanceRingDownscaleStatus(time.Now())
+	require.True(t, resp.ReadOnly)
+	require.Equal(t, readOnlySince.Unix(), resp.ReadOnlyTimestamp)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
+		# HELP cortex_ingester_read_only If the ingester is in read-only mode, and doesn't accept writes anymore.
+		# TYPE cortex_ingester_read_only gauge
+		cortex_ingester_read_only 1
+	`), "cortex_ingester_read_only"))
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	req, _, _, _ := mockWriteRequest(t, labels.FromStrings(labels.MetricName, "test"), 1, util.TimeToMillis(time.Now()))
+	_, err = i.Push(ctx, req)
+	require.ErrorIs(t, err, errIngesterReadOnly)
+}
+
 func TestIngester_ForFlush(t *testing.T) {
 	cfg := defaultIngesterTestConfig(t)
 	cfg.BlocksStorageConfig.TSDB.ShipConcurrency = 1
@@ -5323,7 +5474,7 @@ func TestHeadCompactionOnStartup(t *testing.T) {
 	ingesterCfg.BlocksStorageConfig.Bucket.S3.Endpoint = "localhost"
 	ingesterCfg.BlocksStorageConfig.TSDB.Retention = 2 * 24 * time.Hour // Make sure that no newly created blocks are deleted.
 
-	ingester, err := New(ingesterCfg, overrides, nil, nil, log.NewNopLogger())
+	ingester, err := New(ingesterCfg, overrides, nil, nil, nil, log.NewNopLogger())
 	require.NoError(t, err)
 	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ingester))
 
@@ -6181,6 +6332,60 @@ func TestIngesterPurgeMetadata(t *testing.T) {
 	}
 }
 
+func TestIngesterUploadMetadata(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.BlocksStorageConfig.MetadataStore.Enabled = true
+	cfg.BlocksStorageConfig.MetadataStore.UploadInterval = time.Hour
+
+	overrides, err := validation.NewOverrides(defaultLimitsTestConfig(), nil)
+	require.NoError(t, err)
+
+	bucketDir := t.TempDir()
+	ing, err := prepareIngesterWithBlockStorageAndOverrides(t, cfg, overrides, "", bucketDir, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), ing)
+	})
+
+	// Wait until the ingester is healthy
+	test.Poll(t, 100*time.Millisecond, 1, func() interface{} {
+		return ing.lifecycler.HealthyInstancesCount()
+	})
+
+	bkt, err := filesystem.NewBucket(bucketDir)
+	require.NoError(t, err)
+
+	readStoredMetadata := func(userID string) []string {
+		entries, err := metricmetadata.Read(context.Background(), bkt, userID, nil, log.NewNopLogger())
+		require.NoError(t, err)
+
+		var out []string
+		for _, e := range entries {
+			assert.Equal(t, "counter", e.Type)
+			out = append(out, e.Metric+": "+e.Help)
+		}
+		return out
+	}
+
+	userIDs, _ := pushTestMetadata(t, ing, 2, 1)
+	require.NoError(t, ing.uploadMetricsMetadata(context.Background()))
+
+	for _, userID := range userIDs {
+		assert.Equal(t, []string{"testmetric_0: a help for 0", "testmetric_1: a help for 0"}, readStoredMetadata(userID))
+	}
+
+	// The metadata received since the last upload is uploaded when the ingester shuts down.
+	ctx := user.InjectOrgID(context.Background(), userIDs[0])
+	_, err = ing.Push(ctx, mimirpb.ToWriteRequest(nil, nil, nil, []*mimirpb.MetricMetadata{
+		{MetricFamilyName: "testmetric_2", Help: "a new help", Type: mimirpb.COUNTER},
+	}, mimirpb.API))
+	require.NoError(t, err)
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), ing))
+
+	assert.Equal(t, []string{"testmetric_0: a help for 0", "testmetric_1: a help for 0", "testmetric_2: a new help"}, readStoredMetadata(userIDs[0]))
+}
+
 func TestIngesterMetadataMetrics(t *testing.T) {
 	reg := prometheus.NewPedanticRegistry()
 	cfg := defaultIngesterTestConfig(t)
@@ -6536,6 +6741,96 @@ func TestIngesterMetricLimitExceeded(t *testing.T) {
 	testLimits()
 }
 
+func TestIngesterValuesPerLabelNameLimitExceeded(t *testing.T) {
+	limits := defaultLimitsTestConfig()
+	limits.MaxGlobalValuesPerLabelName = validation.LabelValuesLimitMap{"user_id": 2, "url": 0}
+
+	// create a data dir that survives an ingester restart
+	dataDir := t.TempDir()
+
+	newIngester := func(reg prometheus.Registerer) *Ingester {
+		cfg := defaultIngesterTestConfig(t)
+		// Global Ingester limits are computed based on replication factor
+		// Set RF=1 here to ensure the limit is actually set to 2 instead of 6.
+		cfg.IngesterRing.ReplicationFactor = 1
+		ing, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, dataDir, reg)
+		require.NoError(t, err)
+		require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+
+		// Wait until it's healthy
+		test.Poll(t, time.Second, 1, func() interface{} {
+			return ing.lifecycler.HealthyInstancesCount()
+		})
+
+		return ing
+	}
+
+	ing := newIngester(nil)
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	userID := "1"
+	ctx := user.InjectOrgID(context.Background(), userID)
+	seriesWithValues := func(userIDValue, urlValue string) []mimirpb.LabelAdapter {
+		return []mimirpb.LabelAdapter{{Name: labels.MetricName, Value: "requests_total"}, {Name: "url", Value: urlValue}, {Name: "user_id", Value: userIDValue}}
+	}
+	push := func(series []mimirpb.LabelAdapter) error {
+		_, err := ing.Push(ctx, mimirpb.ToWriteRequest([][]mimirpb.LabelAdapter{series}, []mimirpb.Sample{{TimestampMs: 1, Value: 1}}, nil, nil, mimirpb.API))
+		return err
+	}
+
+	// Reach the limit of distinct values for the user_id label. The url label has no limit.
+	require.NoError(t, push(seriesWithValues("a", "/1")))
+	require.NoError(t, push(seriesWithValues("b", "/2")))
+
+	testLimits := func() {
+		// Series with an existing value are accepted.
+		require.NoError(t, push(seriesWithValues("a", "/3")))
+
+		// Series with a new value are rejected.
+		rejected := seriesWithValues("c", "/4")
+		err := push(rejected)
+		httpResp, ok := httpgrpc.HTTPResponseFromError(err)
+		require.True(t, ok, "returned error is not an httpgrpc response")
+		assert.Equal(t, http.StatusBadRequest, int(httpResp.Code))
+		assert.Equal(t, wrapWithUser(formatMaxValuesPerLabelNameError(ing.limiter.limits, mimirpb.FromLabelAdaptersToLabels(rejected), "user_id", userID), userID).Error(), string(httpResp.Body))
+
+		// The label names are listed by the closest to their limit.
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/ingester/tsdb/1/label-values-limits", nil)
+		req.Header.Set("Accept", "application/json")
+		req = mux.SetURLVars(req, map[string]string{"tenant": userID})
+		ing.TenantLabelValuesLimitsHandler(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		var content tenantLabelValuesLimitsPageContent
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &content))
+		assert.Equal(t, []labelValuesLimitStatus{
+			{LabelName: "user_id", DistinctValues: 2, LocalLimit: 2, GlobalLimit: 2, Utilization: 100},
+		}, content.Labels)
+	}
+
+	testLimits()
+
+	// Limits should hold after restart, when the distinct values are counted from the replayed series.
+	services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+	reg := prometheus.NewPedanticRegistry()
+	ing = newIngester(reg)
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	testLimits()
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+		# TYPE cortex_discarded_samples_total counter
+		cortex_discarded_samples_total{group="",reason="per_label_values_limit",user="1"} 1
+	`), "cortex_discarded_samples_total"))
+
+	// Once the limit is removed, the label name stops being tracked.
+	db := ing.getTSDB(userID)
+	db.labelValues.untrack(map[string]int{"user_id": 0})
+	assert.Empty(t, db.labelValues.labels)
+}
+
 // Construct a set of realistic-looking samples, all with slightly different label sets
 func benchmarkData(nSeries int) (allLabels [][]mimirpb.LabelAdapter, allSamples []mimirpb.Sample) {
 	// Real example from Kubernetes' embedded cAdvisor metrics, lightly obfuscated.
@@ -6881,6 +7176,75 @@ func TestIngesterActiveSeries(t *testing.T) {
 	}
 }
 
+func TestIngesterAttributedActiveSeries(t *testing.T) {
+	labelsToPush := [][]mimirpb.LabelAdapter{
+		{{Name: labels.MetricName, Value: "test_metric"}, {Name: "bool", Value: "false"}, {Name: "team", Value: "a"}},
+		{{Name: labels.MetricName, Value: "test_metric"}, {Name: "bool", Value: "true"}, {Name: "team", Value: "a"}},
+		{{Name: labels.MetricName, Value: "test_metric"}, {Name: "bool", Value: "false"}, {Name: "team", Value: "b"}},
+		{{Name: labels.MetricName, Value: "test_metric"}, {Name: "bool", Value: "true"}, {Name: "team", Value: "c"}},
+		{{Name: labels.MetricName, Value: "test_metric"}, {Name: "bool", Value: "true"}},
+	}
+
+	req := func(lbls []mimirpb.LabelAdapter, t time.Time) *mimirpb.WriteRequest {
+		return mimirpb.ToWriteRequest(
+			[][]mimirpb.LabelAdapter{lbls},
+			[]mimirpb.Sample{{Value: 1, TimestampMs: t.UnixMilli()}},
+			nil,
+			nil,
+			mimirpb.API,
+		)
+	}
+
+	registry := prometheus.NewRegistry()
+	cfg := defaultIngesterTestConfig(t)
+	cfg.ActiveSeriesMetrics.Enabled = true
+
+	limits := defaultLimitsTestConfig()
+	limits.CostAttributionLabel = "team"
+	limits.MaxCostAttributionCardinalityPerUser = 2
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	ing, err := prepareIngesterWithBlockStorageAndOverrides(t, cfg, overrides, "", "", registry)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	// Wait until the ingester is healthy
+	test.Poll(t, 100*time.Millisecond, 1, func() interface{} {
+		return ing.lifecycler.HealthyInstancesCount()
+	})
+
+	pushWithUser(t, ing, labelsToPush, "test_user", req)
+
+	// Update active series for metrics check.
+	currentTime := time.Now()
+	ing.updateActiveSeries(currentTime)
+
+	// The series exceeding the max cardinality are attributed to the overflow value,
+	// while the series without the cost attribution label aren't attributed.
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP cortex_ingester_attributed_active_series Number of currently active series per user and value of the cost attribution label.
+		# TYPE cortex_ingester_attributed_active_series gauge
+		cortex_ingester_attributed_active_series{attribution="__overflow__",user="test_user"} 1
+		cortex_ingester_attributed_active_series{attribution="a",user="test_user"} 2
+		cortex_ingester_attributed_active_series{attribution="b",user="test_user"} 1
+	`), "cortex_ingester_attributed_active_series"))
+
+	resp, err := ing.CostAttribution(user.InjectOrgID(context.Background(), "test_user"), &client.CostAttributionRequest{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*client.CostAttributionItem{
+		{Attribution: "a", ActiveSeries: 2, IngestedSamples: 2},
+		{Attribution: "b", ActiveSeries: 1, IngestedSamples: 1},
+		{Attribution: "__overflow__", ActiveSeries: 1, IngestedSamples: 1},
+	}, resp.Items)
+
+	// Update active series again in a further future where no series are active anymore.
+	currentTime = currentTime.Add(ing.cfg.ActiveSeriesMetrics.IdleTimeout)
+	ing.updateActiveSeries(currentTime)
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(""), "cortex_ingester_attributed_active_series"))
+}
+
 func TestIngesterActiveSeriesConfigChanges(t *testing.T) {
 	labelsToPush := [][]mimirpb.LabelAdapter{
 		{{Name: labels.MetricName, Value: "test_metric"}, {Name: "bool", Value: "false"}, {Name: "team", Value: "a"}},
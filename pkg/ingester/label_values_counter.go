@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"sync"
+
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// labelValuesCounter counts the in-memory series per value of the label names having
+// a limit on the number of distinct values, to enforce such limits when creating series.
+//
+// A label name is tracked starting from the first time its limit is checked. The series
+// already in memory at that time are counted from the TSDB head, so the count may be
+// slightly off for series created concurrently while the label name starts being tracked.
+type labelValuesCounter struct {
+	limiter *Limiter
+
+	// seriesPerLabelValue returns the number of in-memory series per value of the input label name.
+	seriesPerLabelValue func(labelName string) map[string]int
+
+	mtx    sync.RWMutex
+	labels map[string]*labelValuesCounterEntry
+}
+
+type labelValuesCounterEntry struct {
+	mtx    sync.Mutex
+	series map[string]int // Number of in-memory series per label value.
+}
+
+func newLabelValuesCounter(limiter *Limiter, seriesPerLabelValue func(labelName string) map[string]int) *labelValuesCounter {
+	return &labelValuesCounter{
+		limiter:             limiter,
+		seriesPerLabelValue: seriesPerLabelValue,
+		labels:              map[string]*labelValuesCounterEntry{},
+	}
+}
+
+// canAddSeries returns false and the first label name exceeding its limit if adding the
+// input series would exceed the limit of distinct values for any of its label names.
+func (c *labelValuesCounter) canAddSeries(userID string, series labels.Labels, limits map[string]int) (string, bool) {
+	var exceeded string
+
+	series.Range(func(l labels.Label) {
+		if exceeded != "" {
+			return
+		}
+		if limit := limits[l.Name]; limit <= 0 {
+			return
+		}
+
+		entry := c.getOrTrack(l.Name)
+		entry.mtx.Lock()
+		defer entry.mtx.Unlock()
+
+		if entry.series[l.Value] > 0 {
+			// The value already exists, so it doesn't increase the number of distinct values.
+			return
+		}
+		if !c.limiter.IsWithinMaxValuesPerLabelName(userID, l.Name, len(entry.series)) {
+			exceeded = l.Name
+		}
+	})
+
+	return exceeded, exceeded == ""
+}
+
+func (c *labelValuesCounter) increaseSeries(series labels.Labels) {
+	c.updateSeries(series, 1)
+}
+
+func (c *labelValuesCounter) decreaseSeries(series labels.Labels) {
+	c.updateSeries(series, -1)
+}
+
+func (c *labelValuesCounter) updateSeries(series labels.Labels, delta int) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	if len(c.labels) == 0 {
+		return
+	}
+
+	series.Range(func(l labels.Label) {
+		entry, ok := c.labels[l.Name]
+		if !ok {
+			return
+		}
+
+		entry.mtx.Lock()
+		defer entry.mtx.Unlock()
+
+		entry.series[l.Value] += delta
+		if entry.series[l.Value] <= 0 {
+			delete(entry.series, l.Value)
+		}
+	})
+}
+
+// distinctValues returns the number of distinct values of the input label name in the in-memory series.
+func (c *labelValuesCounter) distinctValues(labelName string) int {
+	entry := c.getOrTrack(labelName)
+	entry.mtx.Lock()
+	defer entry.mtx.Unlock()
+
+	return len(entry.series)
+}
+
+// untrack stops tracking the label names which no longer have a limit.
+func (c *labelValuesCounter) untrack(limits map[string]int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for name := range c.labels {
+		if limits[name] <= 0 {
+			delete(c.labels, name)
+		}
+	}
+}
+
+func (c *labelValuesCounter) getOrTrack(labelName string) *labelValuesCounterEntry {
+	c.mtx.RLock()
+	entry, ok := c.labels[labelName]
+	c.mtx.RUnlock()
+
+	if ok {
+		return entry
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// Check again, because the label name may have been tracked in the meanwhile.
+	if entry, ok := c.labels[labelName]; ok {
+		return entry
+	}
+
+	entry = &labelValuesCounterEntry{series: c.seriesPerLabelValue(labelName)}
+	c.labels[labelName] = entry
+	return entry
+}
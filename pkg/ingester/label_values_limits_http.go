@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slices"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+type tenantLabelValuesLimitsPageContent struct {
+	Now    time.Time                `json:"now"`
+	Tenant string                   `json:"tenant"`
+	Labels []labelValuesLimitStatus `json:"labels"`
+}
+
+type labelValuesLimitStatus struct {
+	LabelName      string  `json:"label_name"`
+	DistinctValues int     `json:"distinct_values"`
+	LocalLimit     int     `json:"local_limit"`
+	GlobalLimit    int     `json:"global_limit"`
+	Utilization    float64 `json:"utilization"` // Percentage of the local limit in use.
+}
+
+//go:embed tenant_label_values_limits.gohtml
+var tenantLabelValuesLimitsPageHTML string
+var tenantLabelValuesLimitsTemplate = template.Must(template.New("webpage").Parse(tenantLabelValuesLimitsPageHTML))
+
+// TenantLabelValuesLimitsHandler lists the label names of a tenant having a limit on the number of distinct
+// values, together with the number of distinct values in this ingester, sorted by the closest to their limit.
+func (i *Ingester) TenantLabelValuesLimitsHandler(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	tenant := vars["tenant"]
+	if tenant == "" {
+		util.WriteTextResponse(w, "Tenant ID can't be empty")
+		return
+	}
+
+	db := i.getTSDB(tenant)
+	if db == nil {
+		w.WriteHeader(http.StatusNotFound)
+		util.WriteTextResponse(w, "TSDB not found for tenant "+tenant)
+		return
+	}
+
+	var statuses []labelValuesLimitStatus
+	for labelName, globalLimit := range i.limits.MaxGlobalValuesPerLabelName(tenant) {
+		if globalLimit <= 0 {
+			continue
+		}
+
+		s := labelValuesLimitStatus{
+			LabelName:      labelName,
+			DistinctValues: db.labelValues.distinctValues(labelName),
+			LocalLimit:     i.limiter.maxValuesPerLabelName(tenant, labelName),
+			GlobalLimit:    globalLimit,
+		}
+		s.Utilization = 100 * float64(s.DistinctValues) / float64(s.LocalLimit)
+
+		statuses = append(statuses, s)
+	}
+
+	slices.SortFunc(statuses, func(a, b labelValuesLimitStatus) bool {
+		if a.Utilization != b.Utilization {
+			return a.Utilization > b.Utilization
+		}
+		return a.LabelName < b.LabelName
+	})
+
+	util.RenderHTTPResponse(w, tenantLabelValuesLimitsPageContent{
+		Now:    time.Now(),
+		Tenant: tenant,
+		Labels: statuses,
+	}, tenantLabelValuesLimitsTemplate, req)
+}
@@ -6,6 +6,7 @@
 package ingester
 
 import (
+	"fmt"
 	"math"
 
 	"github.com/pkg/errors"
@@ -21,6 +22,16 @@ var (
 	errMaxSeriesPerUserLimitExceeded   = errors.New("per-user series limit exceeded")
 )
 
+// errMaxValuesPerLabelNameLimitExceeded is an internal error returned when a series can't be created
+// because it would exceed the limit of distinct values for one of its label names.
+type errMaxValuesPerLabelNameLimitExceeded struct {
+	labelName string
+}
+
+func (e errMaxValuesPerLabelNameLimitExceeded) Error() string {
+	return fmt.Sprintf("per-label-name values limit exceeded for label name %s", e.labelName)
+}
+
 // RingCount is the interface exposed by a ring implementation which allows
 // to count members
 type RingCount interface {
@@ -60,6 +71,13 @@ func (l *Limiter) IsWithinMaxSeriesPerMetric(userID string, series int) bool {
 	return series < actualLimit
 }
 
+// IsWithinMaxValuesPerLabelName returns true if limit has not been reached compared to the current
+// number of distinct values of the label name in input; otherwise returns false.
+func (l *Limiter) IsWithinMaxValuesPerLabelName(userID, labelName string, values int) bool {
+	actualLimit := l.maxValuesPerLabelName(userID, labelName)
+	return values < actualLimit
+}
+
 // IsWithinMaxMetadataPerMetric returns true if limit has not been reached compared to the current
 // number of metadata per metric in input; otherwise returns false.
 func (l *Limiter) IsWithinMaxMetadataPerMetric(userID string, metadata int) bool {
@@ -85,6 +103,12 @@ func (l *Limiter) maxSeriesPerMetric(userID string) int {
 	return l.convertGlobalToLocalLimitOrUnlimited(userID, l.limits.MaxGlobalSeriesPerMetric)
 }
 
+func (l *Limiter) maxValuesPerLabelName(userID, labelName string) int {
+	return l.convertGlobalToLocalLimitOrUnlimited(userID, func(userID string) int {
+		return l.limits.MaxGlobalValuesPerLabelName(userID)[labelName]
+	})
+}
+
 func (l *Limiter) maxMetadataPerMetric(userID string) int {
 	return l.convertGlobalToLocalLimitOrUnlimited(userID, l.limits.MaxGlobalMetadataPerMetric)
 }
@@ -28,6 +28,18 @@ func TestLimiter_maxSeriesPerMetric(t *testing.T) {
 	runLimiterMaxFunctionTest(t, applyLimits, runMaxFn)
 }
 
+func TestLimiter_maxValuesPerLabelName(t *testing.T) {
+	applyLimits := func(limits *validation.Limits, globalLimit int) {
+		limits.MaxGlobalValuesPerLabelName = validation.LabelValuesLimitMap{"user_id": globalLimit}
+	}
+
+	runMaxFn := func(limiter *Limiter) int {
+		return limiter.maxValuesPerLabelName("test", "user_id")
+	}
+
+	runLimiterMaxFunctionTest(t, applyLimits, runMaxFn)
+}
+
 func TestLimiter_maxMetadataPerMetric(t *testing.T) {
 	applyLimits := func(limits *validation.Limits, globalLimit int) {
 		limits.MaxGlobalMetadataPerMetric = globalLimit
@@ -359,6 +371,73 @@ func TestLimiter_AssertMaxSeriesPerMetric(t *testing.T) {
 		})
 	}
 }
+
+func TestLimiter_AssertMaxValuesPerLabelName(t *testing.T) {
+	tests := map[string]struct {
+		maxGlobalValuesPerLabelName validation.LabelValuesLimitMap
+		labelName                   string
+		ringReplicationFactor       int
+		ringIngesterCount           int
+		values                      int
+		expected                    bool
+	}{
+		"limit is disabled": {
+			maxGlobalValuesPerLabelName: validation.LabelValuesLimitMap{"user_id": 0},
+			labelName:                   "user_id",
+			ringReplicationFactor:       1,
+			ringIngesterCount:           1,
+			values:                      100,
+			expected:                    true,
+		},
+		"label name has no limit": {
+			maxGlobalValuesPerLabelName: validation.LabelValuesLimitMap{"user_id": 10},
+			labelName:                   "url",
+			ringReplicationFactor:       1,
+			ringIngesterCount:           1,
+			values:                      100,
+			expected:                    true,
+		},
+		"current number of values is below the limit": {
+			maxGlobalValuesPerLabelName: validation.LabelValuesLimitMap{"user_id": 1000},
+			labelName:                   "user_id",
+			ringReplicationFactor:       3,
+			ringIngesterCount:           10,
+			values:                      299,
+			expected:                    true,
+		},
+		"current number of values is above the limit": {
+			maxGlobalValuesPerLabelName: validation.LabelValuesLimitMap{"user_id": 1000},
+			labelName:                   "user_id",
+			ringReplicationFactor:       3,
+			ringIngesterCount:           10,
+			values:                      300,
+			expected:                    false,
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			// Mock the ring
+			ring := &ringCountMock{}
+			ring.On("InstancesCount").Return(testData.ringIngesterCount)
+			ring.On("ZonesCount").Return(1)
+
+			// Mock limits
+			limits, err := validation.NewOverrides(validation.Limits{
+				MaxGlobalValuesPerLabelName: testData.maxGlobalValuesPerLabelName,
+			}, nil)
+			require.NoError(t, err)
+
+			limiter := NewLimiter(limits, ring, testData.ringReplicationFactor, false)
+			actual := limiter.IsWithinMaxValuesPerLabelName("test", testData.labelName, testData.values)
+
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+}
+
 func TestLimiter_AssertMaxMetadataPerMetric(t *testing.T) {
 	tests := map[string]struct {
 		maxGlobalMetadataPerMetric int
@@ -41,6 +41,10 @@ type ingesterMetrics struct {
 	activeSeriesCustomTrackersPerUserNativeHistograms *prometheus.GaugeVec
 	activeNativeHistogramBucketsPerUser               *prometheus.GaugeVec
 	activeNativeHistogramBucketsCustomTrackersPerUser *prometheus.GaugeVec
+	activeSeriesAttributedPerUser                     *prometheus.GaugeVec
+
+	// Owned series, exported only if owned series tracking is enabled.
+	ownedSeriesPerUser *prometheus.GaugeVec
 
 	// Global limit metrics
 	maxUsersGauge           prometheus.GaugeFunc
@@ -69,6 +73,7 @@ type ingesterMetrics struct {
 
 	// Shutdown marker for ingester scale down
 	shutdownMarker prometheus.Gauge
+	readOnly       prometheus.Gauge
 
 	// Count number of requests rejected due to utilization based limiting.
 	utilizationLimitedRequests *prometheus.CounterVec
@@ -283,6 +288,12 @@ func newIngesterMetrics(
 			Help: "Number of currently active native histogram buckets matching a pre-configured label matchers per user.",
 		}, []string{"user", "name"}),
 
+		// Not registered automatically, but only if activeSeriesEnabled is true.
+		activeSeriesAttributedPerUser: promauto.With(activeSeriesReg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_ingester_attributed_active_series",
+			Help: "Number of currently active series per user and value of the cost attribution label.",
+		}, []string{"user", "attribution"}),
+
 		compactionsTriggered: promauto.With(r).NewCounter(prometheus.CounterOpts{
 			Name: "cortex_ingester_tsdb_compactions_triggered_total",
 			Help: "Total number of triggered compactions.",
@@ -310,6 +321,11 @@ func newIngesterMetrics(
 			Help: "The total time it takes to open all existing TSDBs at ingester startup. This time also includes the TSDBs WAL replay duration.",
 		}),
 
+		ownedSeriesPerUser: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_ingester_owned_series",
+			Help: "Number of currently owned series per user, that is the in-memory series which the ingester owns according to the ring.",
+		}, []string{"user"}),
+
 		discarded: newDiscardedMetrics(r),
 		rejected: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
 			Name: "cortex_ingester_instance_rejected_requests_total",
@@ -323,6 +339,11 @@ func newIngesterMetrics(
 			Name: "cortex_ingester_prepare_shutdown_requested",
 			Help: "If the ingester has been requested to prepare for shutdown via endpoint or marker file.",
 		}),
+
+		readOnly: promauto.With(r).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_ingester_read_only",
+			Help: "If the ingester is in read-only mode, and doesn't accept writes anymore.",
+		}),
 	}
 
 	// Initialize expected rejected request labels
@@ -339,6 +360,7 @@ func (m *ingesterMetrics) deletePerUserMetrics(userID string) {
 	m.ingestedSamplesFail.DeleteLabelValues(userID)
 	m.memMetadataCreatedTotal.DeleteLabelValues(userID)
 	m.memMetadataRemovedTotal.DeleteLabelValues(userID)
+	m.ownedSeriesPerUser.DeleteLabelValues(userID)
 
 	filter := prometheus.Labels{"user": userID}
 	m.discarded.DeletePartialMatch(filter)
@@ -361,6 +383,7 @@ func (m *ingesterMetrics) deletePerUserCustomTrackerMetrics(userID string, custo
 		m.activeSeriesCustomTrackersPerUserNativeHistograms.DeleteLabelValues(userID, name)
 		m.activeNativeHistogramBucketsCustomTrackersPerUser.DeleteLabelValues(userID, name)
 	}
+	m.activeSeriesAttributedPerUser.DeletePartialMatch(prometheus.Labels{"user": userID})
 }
 
 type discardedMetrics struct {
@@ -371,6 +394,7 @@ type discardedMetrics struct {
 	newValueForTimestamp *prometheus.CounterVec
 	perUserSeriesLimit   *prometheus.CounterVec
 	perMetricSeriesLimit *prometheus.CounterVec
+	perLabelValuesLimit  *prometheus.CounterVec
 }
 
 func newDiscardedMetrics(r prometheus.Registerer) *discardedMetrics {
@@ -382,6 +406,7 @@ func newDiscardedMetrics(r prometheus.Registerer) *discardedMetrics {
 		newValueForTimestamp: validation.DiscardedSamplesCounter(r, reasonNewValueForTimestamp),
 		perUserSeriesLimit:   validation.DiscardedSamplesCounter(r, reasonPerUserSeriesLimit),
 		perMetricSeriesLimit: validation.DiscardedSamplesCounter(r, reasonPerMetricSeriesLimit),
+		perLabelValuesLimit:  validation.DiscardedSamplesCounter(r, reasonPerLabelValuesLimit),
 	}
 }
 
@@ -393,6 +418,7 @@ func (m *discardedMetrics) DeletePartialMatch(filter prometheus.Labels) {
 	m.newValueForTimestamp.DeletePartialMatch(filter)
 	m.perUserSeriesLimit.DeletePartialMatch(filter)
 	m.perMetricSeriesLimit.DeletePartialMatch(filter)
+	m.perLabelValuesLimit.DeletePartialMatch(filter)
 }
 
 func (m *discardedMetrics) DeleteLabelValues(userID string, group string) {
@@ -403,6 +429,7 @@ func (m *discardedMetrics) DeleteLabelValues(userID string, group string) {
 	m.newValueForTimestamp.DeleteLabelValues(userID, group)
 	m.perUserSeriesLimit.DeleteLabelValues(userID, group)
 	m.perMetricSeriesLimit.DeleteLabelValues(userID, group)
+	m.perLabelValuesLimit.DeleteLabelValues(userID, group)
 }
 
 // TSDB metrics collector. Each tenant has its own registry, that TSDB code uses.
@@ -0,0 +1,325 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+
+	"github.com/grafana/mimir/pkg/ingester/client"
+	util_math "github.com/grafana/mimir/pkg/util/math"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	recomputeOwnedSeriesReasonNewTSDB          = "new TSDB"
+	recomputeOwnedSeriesReasonSeriesRemoved    = "series removed"
+	recomputeOwnedSeriesReasonRingChanged      = "ring changed"
+	recomputeOwnedSeriesReasonShardSizeChanged = "shard size changed"
+)
+
+// ownedSeriesState tracks the number of in-memory series of a tenant which are owned by the ingester
+// according to the ring, that is the series the distributors currently shard to the ingester.
+//
+// The number of owned series is increased when a series is created, because a new series has been sharded
+// to the ingester, and decreased when an owned series is removed from the TSDB head. It's recomputed from
+// the TSDB head when the ring or the tenant shard size changes.
+type ownedSeriesState struct {
+	userID       string
+	instanceAddr string
+
+	mtx sync.Mutex
+
+	count     int
+	shardSize int           // Tenant shard size used by the last recomputation.
+	subring   ring.ReadRing // Tenant subring used by the last recomputation, nil if not computed yet.
+
+	// Reason to recompute the owned series at the next check, or empty if not required.
+	recomputeReason string
+
+	// Series created while the owned series are recomputed are counted as owned, because they have been
+	// sharded to the ingester, but they may or may not be counted by the recomputation too.
+	recomputing             bool
+	createdWhileRecomputing int
+}
+
+func newOwnedSeriesState(userID, instanceAddr string) *ownedSeriesState {
+	return &ownedSeriesState{
+		userID:          userID,
+		instanceAddr:    instanceAddr,
+		recomputeReason: recomputeOwnedSeriesReasonNewTSDB,
+	}
+}
+
+func (s *ownedSeriesState) ownedSeries() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.count
+}
+
+func (s *ownedSeriesState) seriesCreated() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.count++
+	if s.recomputing {
+		s.createdWhileRecomputing++
+	}
+}
+
+// seriesRemoved decreases the number of owned series by the number of removed series which were owned
+// according to the subring used by the last recomputation. If the ownership of the removed series can't
+// be checked, the owned series are recomputed at the next check.
+func (s *ownedSeriesState) seriesRemoved(removed map[chunks.HeadSeriesRef]labels.Labels) {
+	s.mtx.Lock()
+	subring := s.subring
+	s.mtx.Unlock()
+
+	owned := len(removed)
+	var err error
+	if subring != nil {
+		owned, err = countOwnedSeries(s.userID, s.instanceAddr, subring, func(yield func(labels.Labels) error) error {
+			for _, lbls := range removed {
+				if err := yield(lbls); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err != nil {
+		if s.recomputeReason == "" {
+			s.recomputeReason = recomputeOwnedSeriesReasonSeriesRemoved
+		}
+		return
+	}
+	s.count = util_math.Max(s.count-owned, 0)
+}
+
+// getAndClearRecomputeReason returns the reason to recompute the owned series, given the current tenant
+// shard size and whether the ring has changed since the last check, or an empty string if not required.
+func (s *ownedSeriesState) getAndClearRecomputeReason(shardSize int, ringChanged bool) string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	reason := s.recomputeReason
+	s.recomputeReason = ""
+
+	switch {
+	case reason != "":
+		return reason
+	case ringChanged:
+		return recomputeOwnedSeriesReasonRingChanged
+	case shardSize != s.shardSize:
+		return recomputeOwnedSeriesReasonShardSizeChanged
+	default:
+		return ""
+	}
+}
+
+// recompute sets the number of owned series to the one returned by compute, which counts the series owned
+// according to the subring. If compute fails, the owned series are left unchanged and will be recomputed
+// at the next check.
+func (s *ownedSeriesState) recompute(shardSize int, subring ring.ReadRing, reason string, compute func() (int, error)) error {
+	s.mtx.Lock()
+	s.recomputing = true
+	s.createdWhileRecomputing = 0
+	s.mtx.Unlock()
+
+	count, err := compute()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.recomputing = false
+	if err != nil {
+		if s.recomputeReason == "" {
+			s.recomputeReason = reason
+		}
+		return err
+	}
+
+	s.count = count + s.createdWhileRecomputing
+	s.shardSize = shardSize
+	s.subring = subring
+	return nil
+}
+
+// countOwnedSeries returns the number of series iterated by forEach which are owned by the instance according
+// to the tenant subring, computing the token of each series the same way distributors do when sharding it.
+func countOwnedSeries(userID, instanceAddr string, subring ring.ReadRing, forEach func(yield func(labels.Labels) error) error) (int, error) {
+	var (
+		count                        int
+		bufDescs, bufHosts, bufZones = ring.MakeBuffersForGet()
+	)
+
+	err := forEach(func(lbls labels.Labels) error {
+		rs, err := subring.Get(client.ShardByAllLabels(userID, lbls), ring.WriteNoExtend, bufDescs, bufHosts, bufZones)
+		if err != nil {
+			return err
+		}
+		if rs.Includes(instanceAddr) {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// ownedSeriesService periodically checks for changes in the ingesters ring and in the tenants shard size,
+// and recomputes the owned series of the tenants affected by a change.
+type ownedSeriesService struct {
+	services.Service
+
+	ingestersRing ring.ReadRing
+	limits        *validation.Overrides
+	logger        log.Logger
+
+	getTSDBUsers func() []string
+	getTSDB      func(userID string) *userTSDB
+
+	ownedSeries       *prometheus.GaugeVec
+	recomputeDuration prometheus.Histogram
+
+	// Hash of the ring state at the last check, used to detect ring changes.
+	previousRingStateHash uint64
+}
+
+func newOwnedSeriesService(
+	interval time.Duration,
+	ingestersRing ring.ReadRing,
+	limits *validation.Overrides,
+	getTSDBUsers func() []string,
+	getTSDB func(userID string) *userTSDB,
+	ownedSeries *prometheus.GaugeVec,
+	logger log.Logger,
+	reg prometheus.Registerer,
+) *ownedSeriesService {
+	s := &ownedSeriesService{
+		ingestersRing: ingestersRing,
+		limits:        limits,
+		logger:        logger,
+		getTSDBUsers:  getTSDBUsers,
+		getTSDB:       getTSDB,
+		ownedSeries:   ownedSeries,
+		recomputeDuration: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:    "cortex_ingester_owned_series_recompute_duration_seconds",
+			Help:    "How long it took to recompute the owned series of a tenant.",
+			Buckets: prometheus.DefBuckets,
+		}),
+	}
+
+	s.Service = services.NewTimerService(interval, s.starting, s.updateOwnedSeries, nil)
+	return s
+}
+
+// starting computes the owned series of the tenants whose TSDB has been opened at startup,
+// without waiting for the first check.
+func (s *ownedSeriesService) starting(ctx context.Context) error {
+	return s.updateOwnedSeries(ctx)
+}
+
+// updateOwnedSeries recomputes the owned series of the tenants which require it. This function
+// never returns error, because a failure to recompute the owned series should not stop the service.
+func (s *ownedSeriesService) updateOwnedSeries(ctx context.Context) error {
+	ringChanged, err := s.checkRingForChanges()
+	if err != nil {
+		level.Warn(s.logger).Log("msg", "failed to check the ring for changes, skipping owned series recomputation", "err", err)
+		return nil
+	}
+
+	for _, userID := range s.getTSDBUsers() {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		db := s.getTSDB(userID)
+		if db == nil || db.ownedSeries == nil {
+			continue
+		}
+
+		s.updateTenant(userID, db, ringChanged)
+	}
+
+	return nil
+}
+
+func (s *ownedSeriesService) updateTenant(userID string, db *userTSDB, ringChanged bool) {
+	shardSize := s.limits.IngestionTenantShardSize(userID)
+
+	if reason := db.ownedSeries.getAndClearRecomputeReason(shardSize, ringChanged); reason != "" {
+		start := time.Now()
+		subring := s.ingestersRing.ShuffleShard(userID, shardSize)
+
+		err := db.ownedSeries.recompute(shardSize, subring, reason, func() (int, error) {
+			return db.computeOwnedSeries(subring)
+		})
+		if err != nil {
+			level.Warn(s.logger).Log("msg", "failed to recompute owned series", "user", userID, "reason", reason, "err", err)
+		} else {
+			s.recomputeDuration.Observe(time.Since(start).Seconds())
+			level.Debug(s.logger).Log("msg", "recomputed owned series", "user", userID, "reason", reason, "owned_series", db.ownedSeries.ownedSeries(), "duration", time.Since(start))
+		}
+	}
+
+	s.ownedSeries.WithLabelValues(userID).Set(float64(db.ownedSeries.ownedSeries()))
+}
+
+// checkRingForChanges returns whether the ring has changed since the last check. Changes of the
+// instances heartbeat timestamps are ignored.
+func (s *ownedSeriesService) checkRingForChanges() (bool, error) {
+	rs, err := s.ingestersRing.GetAllHealthy(ring.Reporting)
+	if err != nil {
+		return false, err
+	}
+
+	hash := ringStateHash(rs)
+	changed := hash != s.previousRingStateHash
+	s.previousRingStateHash = hash
+	return changed, nil
+}
+
+// ringStateHash returns a hash of the address, zone, state, read-only flag and tokens of the instances in the
+// replication set, so that any change of the token ranges owned by the instances changes the hash.
+func ringStateHash(rs ring.ReplicationSet) uint64 {
+	instances := append([]ring.InstanceDesc(nil), rs.Instances...)
+	sort.Sort(ring.ByAddr(instances))
+
+	h := xxhash.New()
+	buf := make([]byte, 0, 4)
+	for _, instance := range instances {
+		_, _ = h.WriteString(instance.Addr)
+		_, _ = h.Write([]byte{0})
+		_, _ = h.WriteString(instance.Zone)
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write(binary.LittleEndian.AppendUint32(buf[:0], uint32(instance.State)))
+		if instance.ReadOnly {
+			_, _ = h.Write([]byte{1})
+		} else {
+			_, _ = h.Write([]byte{0})
+		}
+		_, _ = h.Write(binary.LittleEndian.AppendUint32(buf[:0], uint32(len(instance.Tokens))))
+		for _, token := range instance.Tokens {
+			_, _ = h.Write(binary.LittleEndian.AppendUint32(buf[:0], token))
+		}
+	}
+	return h.Sum64()
+}
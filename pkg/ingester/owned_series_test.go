@@ -0,0 +1,274 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+
+	"github.com/grafana/mimir/pkg/ingester/client"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestOwnedSeriesState(t *testing.T) {
+	s := newOwnedSeriesState("test", "ingester-1")
+
+	// A new TSDB requires the owned series to be recomputed.
+	assert.Equal(t, recomputeOwnedSeriesReasonNewTSDB, s.getAndClearRecomputeReason(0, false))
+	assert.Equal(t, "", s.getAndClearRecomputeReason(0, false))
+
+	s.seriesCreated()
+	s.seriesCreated()
+	assert.Equal(t, 2, s.ownedSeries())
+
+	// Ring and shard size changes require the owned series to be recomputed.
+	assert.Equal(t, recomputeOwnedSeriesReasonRingChanged, s.getAndClearRecomputeReason(0, true))
+	assert.Equal(t, recomputeOwnedSeriesReasonShardSizeChanged, s.getAndClearRecomputeReason(3, false))
+
+	owned := labels.FromStrings(labels.MetricName, "owned")
+	notOwned := labels.FromStrings(labels.MetricName, "not_owned")
+	subring := &ownedSeriesRingMock{instanceAddr: "ingester-1", ownedTokens: map[uint32]bool{client.ShardByAllLabels("test", owned): true}}
+
+	// Series created while recomputing are counted as owned.
+	require.NoError(t, s.recompute(3, subring, recomputeOwnedSeriesReasonShardSizeChanged, func() (int, error) {
+		s.seriesCreated()
+		return 1, nil
+	}))
+	assert.Equal(t, 2, s.ownedSeries())
+	assert.Equal(t, "", s.getAndClearRecomputeReason(3, false))
+
+	// A failed recomputation leaves the owned series unchanged, and is retried at the next check.
+	require.Error(t, s.recompute(5, nil, recomputeOwnedSeriesReasonShardSizeChanged, func() (int, error) {
+		return 0, errors.New("failed")
+	}))
+	assert.Equal(t, 2, s.ownedSeries())
+	assert.Equal(t, recomputeOwnedSeriesReasonShardSizeChanged, s.getAndClearRecomputeReason(5, false))
+
+	// Only the removed series owned according to the subring of the last recomputation are subtracted,
+	// without requiring the owned series to be recomputed.
+	s.seriesRemoved(map[chunks.HeadSeriesRef]labels.Labels{1: owned, 2: notOwned})
+	assert.Equal(t, 1, s.ownedSeries())
+	assert.Equal(t, "", s.getAndClearRecomputeReason(3, false))
+
+	// If the ownership of the removed series can't be checked, the owned series are recomputed.
+	subring.err = errors.New("failed")
+	s.seriesRemoved(map[chunks.HeadSeriesRef]labels.Labels{1: owned})
+	assert.Equal(t, 1, s.ownedSeries())
+	assert.Equal(t, recomputeOwnedSeriesReasonSeriesRemoved, s.getAndClearRecomputeReason(3, false))
+}
+
+func TestOwnedSeriesState_SeriesRemovedBeforeFirstRecomputation(t *testing.T) {
+	s := newOwnedSeriesState("test", "ingester-1")
+	s.seriesCreated()
+	s.seriesCreated()
+
+	// Without a subring to check the ownership, all the removed series are subtracted.
+	s.seriesRemoved(map[chunks.HeadSeriesRef]labels.Labels{1: labels.FromStrings(labels.MetricName, "series")})
+	assert.Equal(t, 1, s.ownedSeries())
+}
+
+func TestRingStateHash(t *testing.T) {
+	rs := ring.ReplicationSet{Instances: []ring.InstanceDesc{
+		{Addr: "ingester-1", Zone: "zone-a", State: ring.ACTIVE, Tokens: []uint32{1, 3}, Timestamp: 10},
+		{Addr: "ingester-2", Zone: "zone-b", State: ring.ACTIVE, Tokens: []uint32{2, 4}, Timestamp: 10},
+	}}
+	hash := ringStateHash(rs)
+
+	update := func(f func(instances []ring.InstanceDesc)) uint64 {
+		instances := make([]ring.InstanceDesc, 0, len(rs.Instances))
+		for _, instance := range rs.Instances {
+			instance.Tokens = slices.Clone(instance.Tokens)
+			instances = append(instances, instance)
+		}
+		f(instances)
+		return ringStateHash(ring.ReplicationSet{Instances: instances})
+	}
+
+	// The order of the instances and their heartbeat timestamps don't change the hash.
+	assert.Equal(t, hash, update(func(instances []ring.InstanceDesc) {
+		instances[0], instances[1] = instances[1], instances[0]
+	}))
+	assert.Equal(t, hash, update(func(instances []ring.InstanceDesc) {
+		instances[0].Timestamp = 20
+	}))
+
+	// Any change of the instances, their state, their read-only flag or their tokens changes the hash.
+	assert.NotEqual(t, hash, update(func(instances []ring.InstanceDesc) {
+		instances[0].Tokens[1] = 5
+	}))
+	assert.NotEqual(t, hash, update(func(instances []ring.InstanceDesc) {
+		instances[0].Tokens, instances[1].Tokens = []uint32{1}, []uint32{3, 2, 4}
+	}))
+	assert.NotEqual(t, hash, update(func(instances []ring.InstanceDesc) {
+		instances[1].State = ring.LEAVING
+	}))
+	assert.NotEqual(t, hash, update(func(instances []ring.InstanceDesc) {
+		instances[1].ReadOnly = true
+	}))
+	assert.NotEqual(t, hash, update(func(instances []ring.InstanceDesc) {
+		instances[1].Addr = "ingester-3"
+	}))
+	assert.NotEqual(t, hash, ringStateHash(ring.ReplicationSet{Instances: rs.Instances[:1]}))
+}
+
+// ownedSeriesRingMock is a ring where the instance owns the input tokens, and another instance owns the other tokens.
+type ownedSeriesRingMock struct {
+	ring.ReadRing
+
+	instanceAddr string
+	ownedTokens  map[uint32]bool
+	err          error
+}
+
+func (r *ownedSeriesRingMock) Get(key uint32, _ ring.Operation, _ []ring.InstanceDesc, _, _ []string) (ring.ReplicationSet, error) {
+	if r.err != nil {
+		return ring.ReplicationSet{}, r.err
+	}
+	if r.ownedTokens[key] {
+		return ring.ReplicationSet{Instances: []ring.InstanceDesc{{Addr: r.instanceAddr}}}, nil
+	}
+	return ring.ReplicationSet{Instances: []ring.InstanceDesc{{Addr: "another-ingester"}}}, nil
+}
+
+func TestIngester_OwnedSeries(t *testing.T) {
+	const (
+		userID         = "test"
+		numSeries      = 10
+		numMovedSeries = 4
+	)
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+
+	series := make([]labels.Labels, 0, numSeries)
+	tokens := make([]uint32, 0, numSeries)
+	for i := 0; i < numSeries; i++ {
+		s := labels.FromStrings(labels.MetricName, fmt.Sprintf("series_%d", i))
+		series = append(series, s)
+		tokens = append(tokens, client.ShardByAllLabels(userID, s))
+	}
+
+	// The ingester owns the tokens of the series which are not moved to another ingester later,
+	// so that the ownership of each series is deterministic.
+	ingesterTokens := ring.Tokens(slices.Clone(tokens[:numSeries-numMovedSeries]))
+	movedTokens := slices.Clone(tokens[numSeries-numMovedSeries:])
+	slices.Sort(ingesterTokens)
+	slices.Sort(movedTokens)
+
+	tokensFile := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, ingesterTokens.StoreToFile(tokensFile))
+
+	cfg := defaultIngesterTestConfig(t)
+	cfg.IngesterRing.ReplicationFactor = 1
+	cfg.IngesterRing.NumTokens = len(ingesterTokens)
+	cfg.IngesterRing.TokensFilePath = tokensFile
+	cfg.IngesterRing.HeartbeatPeriod = 100 * time.Millisecond
+	cfg.UseIngesterOwnedSeriesForLimits = true
+	// The owned series are updated explicitly in this test.
+	cfg.OwnedSeriesUpdateInterval = time.Hour
+
+	limits := defaultLimitsTestConfig()
+	// With 2 ingesters, the local limit is 7 series.
+	limits.MaxGlobalSeriesPerUser = 14
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	ingestersRing, err := ring.New(cfg.IngesterRing.ToRingConfig(), "ingester", IngesterRingKey, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ingestersRing))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), ingestersRing))
+	})
+
+	cfg.BlocksStorageConfig.TSDB.Dir = t.TempDir()
+	cfg.BlocksStorageConfig.Bucket.Backend = "filesystem"
+	cfg.BlocksStorageConfig.Bucket.Filesystem.Directory = t.TempDir()
+
+	reg := prometheus.NewPedanticRegistry()
+	ing, err := New(cfg, overrides, ingestersRing, nil, reg, log.NewNopLogger())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), ing))
+	})
+
+	// Wait until the ingester is ACTIVE in the ring.
+	test.Poll(t, time.Second, 1, func() interface{} {
+		rs, err := ingestersRing.GetAllHealthy(ring.WriteNoExtend)
+		if err != nil {
+			return 0
+		}
+		return len(rs.Instances)
+	})
+
+	push := func(s labels.Labels) error {
+		req := mimirpb.ToWriteRequest([][]mimirpb.LabelAdapter{mimirpb.FromLabelsToLabelAdapters(s)}, []mimirpb.Sample{{TimestampMs: 1, Value: 1}}, nil, nil, mimirpb.API)
+		_, err := ing.Push(ctx, req)
+		return err
+	}
+
+	for _, s := range series {
+		require.NoError(t, push(s))
+	}
+
+	expectOwnedSeries := func(expected int) {
+		t.Helper()
+
+		require.NoError(t, ing.ownedSeriesService.updateOwnedSeries(context.Background()))
+		assert.Equal(t, expected, ing.getTSDB(userID).ownedSeries.ownedSeries())
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+			# HELP cortex_ingester_owned_series Number of currently owned series per user, that is the in-memory series which the ingester owns according to the ring.
+			# TYPE cortex_ingester_owned_series gauge
+			cortex_ingester_owned_series{user="test"} %d
+		`, expected)), "cortex_ingester_owned_series"))
+	}
+
+	// The ingester is the only one in the ring, so it owns all series.
+	expectOwnedSeries(numSeries)
+
+	// Another ingester joins the ring and takes over some of the series.
+	require.NoError(t, cfg.IngesterRing.KVStore.Mock.CAS(context.Background(), IngesterRingKey, func(in interface{}) (interface{}, bool, error) {
+		desc := in.(*ring.Desc)
+		desc.AddIngester("ingester-2", "ingester-2:9095", "", movedTokens, ring.ACTIVE, time.Now())
+		return desc, true, nil
+	}))
+
+	test.Poll(t, time.Second, 2, func() interface{} {
+		return ingestersRing.InstancesCount()
+	})
+	test.Poll(t, time.Second, 2, func() interface{} {
+		return ing.lifecycler.HealthyInstancesCount()
+	})
+
+	expectOwnedSeries(numSeries - numMovedSeries)
+
+	// The ingester holds more series than the local limit in memory, but only the owned
+	// series are checked against the limit, so it accepts a new series until the limit is reached.
+	require.NoError(t, push(labels.FromStrings(labels.MetricName, "new_series_1")))
+
+	err = push(labels.FromStrings(labels.MetricName, "new_series_2"))
+	httpResp, ok := httpgrpc.HTTPResponseFromError(err)
+	require.True(t, ok, "returned error is not an httpgrpc response")
+	assert.Equal(t, http.StatusBadRequest, int(httpResp.Code))
+	assert.Equal(t, wrapWithUser(formatMaxSeriesPerUserError(ing.limiter.limits, userID), userID).Error(), string(httpResp.Body))
+}
@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/atomicfs"
+	util_math "github.com/grafana/mimir/pkg/util/math"
+	"github.com/grafana/mimir/pkg/util/shutdownmarker"
+)
+
+// readOnlyMarkerFilename is the name of the file, in the TSDB directory, which keeps the ingester in
+// read-only mode across restarts. It contains the time when the ingester switched to read-only mode.
+const readOnlyMarkerFilename = "read-only.txt"
+
+var errIngesterReadOnly = status.Error(codes.Unavailable, "the ingester is in read-only mode and doesn't accept writes")
+
+// prepareInstanceRingDownscaleResponse is the status of the ingester scale down.
+type prepareInstanceRingDownscaleResponse struct {
+	ReadOnly bool `json:"read_only"`
+
+	// Unix timestamp (in seconds) when the ingester switched to read-only mode, or 0 if not read-only.
+	ReadOnlyTimestamp int64 `json:"read_only_timestamp"`
+
+	// Whether all in-memory series have been compacted and all blocks have been shipped to the storage.
+	AllBlocksShipped bool `json:"all_blocks_shipped"`
+
+	// Unix timestamp (in seconds) after which the queriers stop querying the ingester, or 0 if not read-only.
+	SafeToDeleteTimestamp int64 `json:"safe_to_delete_timestamp"`
+
+	// Whether the ingester can be deleted without any loss of data or query results.
+	SafeToDelete bool `json:"safe_to_delete"`
+}
+
+// PrepareInstanceRingDownscaleHandler drives the graceful scale down of the ingester.
+//
+// A POST switches the ingester to read-only mode: the ingester is marked read-only in the ring, so that the
+// distributors send its writes to other ingesters while the queriers keep querying it, and the ingester rejects
+// any write. It also prepares the ingester for shutdown, and triggers the compaction and shipping of all
+// in-memory series. The read-only mode is persisted in a marker file, so that it survives restarts.
+//
+// A DELETE reverts the read-only mode, and the preparation for shutdown.
+//
+// All methods return the status of the scale down, reporting whether the ingester is safe to delete,
+// that is when all blocks have been shipped and the queriers don't query it anymore.
+func (i *Ingester) PrepareInstanceRingDownscaleHandler(w http.ResponseWriter, r *http.Request) {
+	// Don't allow callers to change the ingester state while we're in the middle of starting or shutting down.
+	if i.State() != services.Running {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if code, err := i.switchToReadOnly(r.Context()); err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		i.flushReadOnlyBlocks()
+	case http.MethodDelete:
+		if err := i.revertReadOnly(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	util.WriteJSONResponse(w, i.prepareInstanceRingDownscaleStatus(time.Now()))
+}
+
+// switchToReadOnly switches the ingester to read-only mode, unless it's already read-only. In case
+// of error, it returns the HTTP status code to respond with.
+func (i *Ingester) switchToReadOnly(ctx context.Context) (int, error) {
+	i.readOnlyMtx.Lock()
+	defer i.readOnlyMtx.Unlock()
+
+	if i.isReadOnly() {
+		return 0, nil
+	}
+
+	if state := i.lifecycler.GetState(); state != ring.ACTIVE {
+		return http.StatusConflict, errors.Errorf("the ingester can't switch to read-only mode while in the %s state", state)
+	}
+
+	now := time.Now()
+	readOnlyMarkerPath := getReadOnlyMarkerPath(i.cfg.BlocksStorageConfig.TSDB.Dir)
+	if err := createReadOnlyMarker(readOnlyMarkerPath, now); err != nil {
+		level.Error(i.logger).Log("msg", "unable to create read-only marker file", "path", readOnlyMarkerPath, "err", err)
+		return http.StatusInternalServerError, err
+	}
+
+	// Ensure the ingester is unregistered from the ring and flushes any remaining data once stopped.
+	shutdownMarkerPath := shutdownmarker.GetPath(i.cfg.BlocksStorageConfig.TSDB.Dir)
+	if err := shutdownmarker.Create(shutdownMarkerPath); err != nil {
+		level.Error(i.logger).Log("msg", "unable to create prepare-shutdown marker file", "path", shutdownMarkerPath, "err", err)
+		return http.StatusInternalServerError, err
+	}
+	i.setPrepareShutdown()
+
+	// The distributors skip the read-only ingesters when selecting the ingesters to write to, while the queriers
+	// keep querying them, because the ingester stays ACTIVE.
+	if err := i.lifecycler.SetReadOnly(ctx, true); err != nil {
+		level.Error(i.logger).Log("msg", "unable to switch the ingester to read-only mode", "err", err)
+		return http.StatusInternalServerError, err
+	}
+
+	i.setReadOnly(now)
+	level.Info(i.logger).Log("msg", "switched the ingester to read-only mode")
+
+	return 0, nil
+}
+
+// revertReadOnly switches the ingester back to read-write mode, unless it's not read-only.
+func (i *Ingester) revertReadOnly(ctx context.Context) error {
+	i.readOnlyMtx.Lock()
+	defer i.readOnlyMtx.Unlock()
+
+	if !i.isReadOnly() {
+		return nil
+	}
+
+	if err := i.lifecycler.SetReadOnly(ctx, false); err != nil {
+		level.Error(i.logger).Log("msg", "unable to revert the ingester read-only mode", "err", err)
+		return err
+	}
+
+	readOnlyMarkerPath := getReadOnlyMarkerPath(i.cfg.BlocksStorageConfig.TSDB.Dir)
+	if err := shutdownmarker.Remove(readOnlyMarkerPath); err != nil {
+		level.Error(i.logger).Log("msg", "unable to remove read-only marker file", "path", readOnlyMarkerPath, "err", err)
+		return err
+	}
+
+	shutdownMarkerPath := shutdownmarker.GetPath(i.cfg.BlocksStorageConfig.TSDB.Dir)
+	if err := shutdownmarker.Remove(shutdownMarkerPath); err != nil {
+		level.Error(i.logger).Log("msg", "unable to remove prepare-shutdown marker file", "path", shutdownMarkerPath, "err", err)
+		return err
+	}
+	i.unsetPrepareShutdown()
+
+	i.readOnlySince.Store(0)
+	i.readOnlyFlushed.Store(false)
+	i.metrics.readOnly.Set(0)
+	level.Info(i.logger).Log("msg", "reverted the ingester read-only mode")
+
+	return nil
+}
+
+// restoreReadOnly switches the ingester to read-only mode if it was read-only before being restarted.
+// It must be called before starting the lifecycler, so that the ingester joins the ring as read-only.
+func (i *Ingester) restoreReadOnly(ctx context.Context) error {
+	readOnlyMarkerPath := getReadOnlyMarkerPath(i.cfg.BlocksStorageConfig.TSDB.Dir)
+	since, found, err := readReadOnlyMarker(readOnlyMarkerPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to read ingester read-only marker")
+	}
+	if !found {
+		return nil
+	}
+
+	level.Info(i.logger).Log("msg", "detected existing read-only marker, switching the ingester to read-only mode", "path", readOnlyMarkerPath)
+	if err := i.lifecycler.SetReadOnly(ctx, true); err != nil {
+		return errors.Wrap(err, "failed to switch the ingester to read-only mode")
+	}
+	i.setReadOnly(since)
+
+	return nil
+}
+
+func (i *Ingester) setReadOnly(since time.Time) {
+	i.readOnlySince.Store(since.UnixMilli())
+	i.metrics.readOnly.Set(1)
+}
+
+func (i *Ingester) isReadOnly() bool {
+	return i.readOnlySince.Load() > 0
+}
+
+// flushReadOnlyBlocks compacts and ships all in-memory series in background, so that no data is left in the
+// ingester once deleted. It runs once each time the ingester switches to read-only mode or is restarted.
+func (i *Ingester) flushReadOnlyBlocks() {
+	if i.readOnlyFlushed.CompareAndSwap(false, true) {
+		go i.flushBlocks(nil)
+	}
+}
+
+func (i *Ingester) prepareInstanceRingDownscaleStatus(now time.Time) prepareInstanceRingDownscaleResponse {
+	readOnlySince := i.readOnlySince.Load()
+	if readOnlySince == 0 {
+		return prepareInstanceRingDownscaleResponse{}
+	}
+
+	// The queriers keep querying the ingester until the longest query-ingesters-within period of its tenants has elapsed.
+	queryIngestersWithin := i.limits.QueryIngestersWithin("")
+	allBlocksShipped := i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled()
+
+	for _, userID := range i.getTSDBUsers() {
+		db := i.getTSDB(userID)
+		if db == nil {
+			continue
+		}
+
+		if db.Head().NumSeries() > 0 || db.getOldestUnshippedBlockTime() > 0 {
+			allBlocksShipped = false
+		}
+		queryIngestersWithin = util_math.Max(queryIngestersWithin, i.limits.QueryIngestersWithin(userID))
+	}
+
+	safeToDeleteTime := time.UnixMilli(readOnlySince).Add(queryIngestersWithin)
+
+	return prepareInstanceRingDownscaleResponse{
+		ReadOnly:              true,
+		ReadOnlyTimestamp:     time.UnixMilli(readOnlySince).Unix(),
+		AllBlocksShipped:      allBlocksShipped,
+		SafeToDeleteTimestamp: safeToDeleteTime.Unix(),
+		SafeToDelete:          allBlocksShipped && !now.Before(safeToDeleteTime),
+	}
+}
+
+// getReadOnlyMarkerPath returns the path of the read-only marker file in the TSDB directory.
+func getReadOnlyMarkerPath(dir string) string {
+	return path.Join(dir, readOnlyMarkerFilename)
+}
+
+// createReadOnlyMarker writes the read-only marker file, containing the time when the ingester switched to read-only mode.
+func createReadOnlyMarker(p string, since time.Time) error {
+	return atomicfs.CreateFile(p, strings.NewReader(since.UTC().Format(time.RFC3339Nano)))
+}
+
+// readReadOnlyMarker returns the time when the ingester switched to read-only mode, and false if the marker file doesn't exist.
+func readReadOnlyMarker(p string) (time.Time, bool, error) {
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	since, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, false, errors.Wrapf(err, "invalid read-only marker file %s", p)
+	}
+	return since, true, nil
+}
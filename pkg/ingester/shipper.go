@@ -22,6 +22,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/fileutil"
 	"github.com/thanos-io/objstore"
 
@@ -56,6 +57,7 @@ func newShipperMetrics(reg prometheus.Registerer) *shipperMetrics {
 
 type ShipperConfigProvider interface {
 	OutOfOrderBlocksExternalLabelEnabled(userID string) bool
+	BlockBloomFilterLabelNames(userID string) []string
 }
 
 // shipper watches a directory for matching files and directories and uploads
@@ -69,6 +71,10 @@ type shipper struct {
 	metrics     *shipperMetrics
 	bucket      objstore.Bucket
 	source      block.SourceType
+
+	// exemplars is the queryable of the exemplars written to the shipped blocks. The blocks are shipped
+	// without exemplars if nil.
+	exemplars storage.ExemplarQueryable
 }
 
 // newShipper creates a new uploader that detects new TSDB blocks in dir and uploads them to
@@ -82,6 +88,7 @@ func newShipper(
 	dir string,
 	bucket objstore.Bucket,
 	source block.SourceType,
+	exemplars storage.ExemplarQueryable,
 ) *shipper {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -95,6 +102,7 @@ func newShipper(
 		bucket:      bucket,
 		metrics:     metrics,
 		source:      source,
+		exemplars:   exemplars,
 	}
 }
 
@@ -197,6 +205,22 @@ func (s *shipper) upload(ctx context.Context, meta *block.Meta) error {
 		meta.Thanos.Labels[mimir_tsdb.OutOfOrderExternalLabel] = mimir_tsdb.OutOfOrderExternalLabelValue
 	}
 
+	if err := block.WriteBloomFilters(blockDir, s.cfgProvider.BlockBloomFilterLabelNames(s.userID)); err != nil {
+		return errors.Wrap(err, "write bloom filters")
+	}
+
+	if s.exemplars != nil {
+		// The block time range is half-open, while the exemplars one is closed. Only the exemplars still
+		// held in memory are written to the block.
+		exemplars, err := block.SelectAllExemplars(ctx, s.exemplars, meta.MinTime, meta.MaxTime-1)
+		if err != nil {
+			return errors.Wrap(err, "select exemplars")
+		}
+		if err := block.WriteExemplars(blockDir, exemplars); err != nil {
+			return errors.Wrap(err, "write exemplars")
+		}
+	}
+
 	// Upload block with custom metadata.
 	return block.Upload(ctx, s.logger, s.bucket, blockDir, meta)
 }
@@ -20,6 +20,8 @@ import (
 	"github.com/grafana/dskit/concurrency"
 	"github.com/oklog/ulid"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/stretchr/testify/require"
 	"github.com/thanos-io/objstore"
@@ -51,7 +53,7 @@ func TestShipper(t *testing.T) {
 	logger := log.NewLogfmtLogger(logs)
 	overrides, err := validation.NewOverrides(defaultLimitsTestConfig(), nil)
 	require.NoError(t, err)
-	s := newShipper(logger, overrides, "", newShipperMetrics(nil), blocksDir, bkt, block.TestSource)
+	s := newShipper(logger, overrides, "", newShipperMetrics(nil), blocksDir, bkt, block.TestSource, nil)
 
 	t.Run("no shipper file yet", func(t *testing.T) {
 		// No shipper file = nothing is reported as shipped.
@@ -193,7 +195,7 @@ func TestShipper_DeceivingUploadErrors(t *testing.T) {
 	logger := log.NewLogfmtLogger(os.Stderr)
 	overrides, err := validation.NewOverrides(defaultLimitsTestConfig(), nil)
 	require.NoError(t, err)
-	s := newShipper(logger, overrides, "", newShipperMetrics(nil), blocksDir, bkt, block.TestSource)
+	s := newShipper(logger, overrides, "", newShipperMetrics(nil), blocksDir, bkt, block.TestSource, nil)
 
 	// Create and upload a block
 	id1 := ulid.MustNew(1, nil)
@@ -259,7 +261,7 @@ func TestIterBlockMetas(t *testing.T) {
 	}.WriteToDir(log.NewNopLogger(), path.Join(dir, id3.String())))
 	overrides, err := validation.NewOverrides(defaultLimitsTestConfig(), nil)
 	require.NoError(t, err)
-	shipper := newShipper(nil, overrides, "", newShipperMetrics(nil), dir, nil, block.TestSource)
+	shipper := newShipper(nil, overrides, "", newShipperMetrics(nil), dir, nil, block.TestSource, nil)
 	metas, err := shipper.blockMetasFromOldest()
 	require.NoError(t, err)
 	require.Equal(t, sort.SliceIsSorted(metas, func(i, j int) bool {
@@ -273,7 +275,7 @@ func TestShipperAddsSegmentFiles(t *testing.T) {
 	inmemory := objstore.NewInMemBucket()
 	overrides, err := validation.NewOverrides(defaultLimitsTestConfig(), nil)
 	require.NoError(t, err)
-	s := newShipper(nil, overrides, "", newShipperMetrics(nil), dir, inmemory, block.TestSource)
+	s := newShipper(nil, overrides, "", newShipperMetrics(nil), dir, inmemory, block.TestSource, nil)
 
 	id := ulid.MustNew(1, nil)
 	blockDir := path.Join(dir, id.String())
@@ -306,6 +308,79 @@ func TestShipperAddsSegmentFiles(t *testing.T) {
 	require.Equal(t, []string{segmentFile}, meta.Thanos.SegmentFiles)
 }
 
+func TestShipper_WritesBloomFilters(t *testing.T) {
+	ctx := context.Background()
+	blocksDir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+
+	tenantLimits := map[string]*validation.Limits{
+		"user": {
+			BlockBloomFilterLabelNames: []string{"pod"},
+		},
+	}
+	overrides, err := validation.NewOverrides(defaultLimitsTestConfig(), validation.NewMockTenantLimits(tenantLimits))
+	require.NoError(t, err)
+	s := newShipper(nil, overrides, "user", newShipperMetrics(nil), blocksDir, bkt, block.TestSource, nil)
+
+	id, err := block.CreateBlock(ctx, blocksDir, []labels.Labels{
+		labels.FromStrings("pod", "pod-1"),
+		labels.FromStrings("pod", "pod-2"),
+		labels.FromStrings("pod", "pod-3"),
+	}, 10, 0, 1000, labels.EmptyLabels())
+	require.NoError(t, err)
+
+	uploaded, err := s.Sync(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, uploaded)
+
+	meta, err := block.DownloadMeta(ctx, log.NewNopLogger(), bkt, id)
+	require.NoError(t, err)
+	require.True(t, meta.HasBloomFilters())
+
+	filters, err := block.ReadBloomFilters(ctx, bkt, id)
+	require.NoError(t, err)
+	require.True(t, filters.MayMatch([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-1")}))
+	require.False(t, filters.MayMatch([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-4")}))
+}
+
+func TestShipper_WritesExemplars(t *testing.T) {
+	ctx := context.Background()
+	blocksDir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+
+	exemplars, err := tsdb.NewCircularExemplarStorage(10, tsdb.NewExemplarMetrics(nil))
+	require.NoError(t, err)
+
+	series := labels.FromStrings("pod", "pod-1")
+	inBlock := exemplar.Exemplar{Labels: labels.FromStrings("trace_id", "abc"), Value: 1, Ts: 500, HasTs: true}
+	require.NoError(t, exemplars.AddExemplar(series, inBlock))
+	require.NoError(t, exemplars.AddExemplar(series, exemplar.Exemplar{Labels: labels.FromStrings("trace_id", "def"), Value: 2, Ts: 5000, HasTs: true}))
+
+	overrides, err := validation.NewOverrides(defaultLimitsTestConfig(), nil)
+	require.NoError(t, err)
+	s := newShipper(nil, overrides, "user", newShipperMetrics(nil), blocksDir, bkt, block.TestSource, exemplars)
+
+	id, err := block.CreateBlock(ctx, blocksDir, []labels.Labels{
+		labels.FromStrings("pod", "pod-1"),
+		labels.FromStrings("pod", "pod-2"),
+		labels.FromStrings("pod", "pod-3"),
+	}, 10, 0, 1000, labels.EmptyLabels())
+	require.NoError(t, err)
+
+	uploaded, err := s.Sync(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, uploaded)
+
+	meta, err := block.DownloadMeta(ctx, log.NewNopLogger(), bkt, id)
+	require.NoError(t, err)
+	require.True(t, meta.HasExemplars())
+
+	// Only the exemplars within the block time range are written to the block.
+	actual, err := block.ReadExemplars(ctx, bkt, id)
+	require.NoError(t, err)
+	require.Equal(t, []exemplar.QueryResult{{SeriesLabels: series, Exemplars: []exemplar.Exemplar{inBlock}}}, actual)
+}
+
 func TestShipper_AddOOOLabel(t *testing.T) {
 	for _, tc := range []struct {
 		name                      string
@@ -417,7 +492,7 @@ func TestShipper_AddOOOLabel(t *testing.T) {
 			}
 			overrides, err := validation.NewOverrides(defaultLimitsTestConfig(), validation.NewMockTenantLimits(tenantLimits))
 			require.NoError(t, err)
-			s := newShipper(logger, overrides, "", newShipperMetrics(nil), blocksDir, bkt, block.TestSource)
+			s := newShipper(logger, overrides, "", newShipperMetrics(nil), blocksDir, bkt, block.TestSource, nil)
 
 			createBlock(t, blocksDir, tc.meta.ULID, tc.meta)
 
@@ -12,6 +12,7 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/metricmetadata"
 )
 
 // userMetricsMetadata allows metric metadata of a tenant to be held by the ingester.
@@ -99,6 +100,25 @@ func (mm *userMetricsMetadata) toClientMetadata() []*mimirpb.MetricMetadata {
 	return r
 }
 
+// toMetadataEntries returns the metadata held in memory, with the last time each metadata has been received.
+func (mm *userMetricsMetadata) toMetadataEntries() []metricmetadata.Entry {
+	mm.mtx.RLock()
+	defer mm.mtx.RUnlock()
+	r := make([]metricmetadata.Entry, 0, len(mm.metricToMetadata))
+	for _, set := range mm.metricToMetadata {
+		for m, lastSeen := range set {
+			r = append(r, metricmetadata.Entry{
+				Metric:   m.MetricFamilyName,
+				Type:     string(mimirpb.MetricMetadataMetricTypeToMetricType(m.Type)),
+				Help:     m.Help,
+				Unit:     m.Unit,
+				LastSeen: lastSeen.Unix(),
+			})
+		}
+	}
+	return r
+}
+
 type metricMetadataSet map[mimirpb.MetricMetadata]time.Time
 
 // If deadline is zero time, all metrics are purged.
@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/grafana/dskit/ring"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -19,6 +20,7 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
 	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/ingester/activeseries"
@@ -86,8 +88,17 @@ type userTSDB struct {
 	userID         string
 	activeSeries   *activeseries.ActiveSeries
 	seriesInMetric *metricCounter
+	labelValues    *labelValuesCounter
 	limiter        *Limiter
 
+	// Number of in-memory series owned by the ingester according to the ring. Nil if owned series tracking is disabled.
+	ownedSeries *ownedSeriesState
+	// Whether the per-tenant series limit is checked against the owned series instead of the in-memory series.
+	useOwnedSeriesForLimits bool
+
+	// Cost attributions exported in the attributed active series metric by the last active series update.
+	activeSeriesAttributions map[string]int
+
 	instanceSeriesCount *atomic.Int64 // Shared across all userTSDB instances created by ingester.
 	instanceLimitsFn    func() *InstanceLimits
 	instanceErrors      *prometheus.CounterVec
@@ -273,7 +284,11 @@ func (u *userTSDB) PreCreation(metric labels.Labels) error {
 	}
 
 	// Total series limit.
-	if !u.limiter.IsWithinMaxSeriesPerUser(u.userID, int(u.Head().NumSeries())) {
+	series := int(u.Head().NumSeries())
+	if u.useOwnedSeriesForLimits && u.ownedSeries != nil {
+		series = u.ownedSeries.ownedSeries()
+	}
+	if !u.limiter.IsWithinMaxSeriesPerUser(u.userID, series) {
 		return errMaxSeriesPerUserLimitExceeded
 	}
 
@@ -286,11 +301,21 @@ func (u *userTSDB) PreCreation(metric labels.Labels) error {
 		return errMaxSeriesPerMetricLimitExceeded
 	}
 
+	// Values per label name limit.
+	if limits := u.limiter.limits.MaxGlobalValuesPerLabelName(u.userID); len(limits) > 0 {
+		if labelName, ok := u.labelValues.canAddSeries(u.userID, metric, limits); !ok {
+			return errMaxValuesPerLabelNameLimitExceeded{labelName: labelName}
+		}
+	}
+
 	return nil
 }
 
 func (u *userTSDB) PostCreation(metric labels.Labels) {
 	u.instanceSeriesCount.Inc()
+	if u.ownedSeries != nil {
+		u.ownedSeries.seriesCreated()
+	}
 
 	metricName, err := extract.MetricNameFromLabels(metric)
 	if err != nil {
@@ -298,10 +323,14 @@ func (u *userTSDB) PostCreation(metric labels.Labels) {
 		return
 	}
 	u.seriesInMetric.increaseSeriesForMetric(metricName)
+	u.labelValues.increaseSeries(metric)
 }
 
 func (u *userTSDB) PostDeletion(metrics map[chunks.HeadSeriesRef]labels.Labels) {
 	u.instanceSeriesCount.Sub(int64(len(metrics)))
+	if u.ownedSeries != nil {
+		u.ownedSeries.seriesRemoved(metrics)
+	}
 
 	for _, lbls := range metrics {
 		metricName, err := extract.MetricNameFromLabels(lbls)
@@ -310,11 +339,77 @@ func (u *userTSDB) PostDeletion(metrics map[chunks.HeadSeriesRef]labels.Labels)
 			continue
 		}
 		u.seriesInMetric.decreaseSeriesForMetric(metricName)
+		u.labelValues.decreaseSeries(lbls)
 	}
 
 	u.activeSeries.PostDeletion(metrics)
 }
 
+// seriesPerLabelValue returns the number of series in the TSDB head per value of the input label name.
+func (u *userTSDB) seriesPerLabelValue(labelName string) map[string]int {
+	result := map[string]int{}
+
+	idx, err := u.Head().Index()
+	if err != nil {
+		return result
+	}
+	defer idx.Close()
+
+	values, err := idx.LabelValues(labelName)
+	if err != nil {
+		return result
+	}
+
+	for _, value := range values {
+		p, err := idx.Postings(labelName, value)
+		if err != nil {
+			continue
+		}
+
+		count := 0
+		for p.Next() {
+			count++
+		}
+		if count > 0 {
+			result[value] = count
+		}
+	}
+
+	return result
+}
+
+// computeOwnedSeries returns the number of series in the TSDB head owned by the ingester according to the
+// input ring, which is expected to be the tenant's shard of the ingesters ring.
+func (u *userTSDB) computeOwnedSeries(subring ring.ReadRing) (int, error) {
+	idx, err := u.Head().Index()
+	if err != nil {
+		return 0, err
+	}
+	defer idx.Close()
+
+	p, err := idx.Postings(index.AllPostingsKey())
+	if err != nil {
+		return 0, err
+	}
+
+	return countOwnedSeries(u.userID, u.ownedSeries.instanceAddr, subring, func(yield func(labels.Labels) error) error {
+		var builder labels.ScratchBuilder
+		for p.Next() {
+			if err := idx.Series(p.At(), &builder, nil); err != nil {
+				// The series may have been removed from the head in the meanwhile.
+				if errors.Is(err, storage.ErrNotFound) {
+					continue
+				}
+				return err
+			}
+			if err := yield(builder.Labels()); err != nil {
+				return err
+			}
+		}
+		return p.Err()
+	})
+}
+
 // blocksToDelete filters the input blocks and returns the blocks which are safe to be deleted from the ingester.
 func (u *userTSDB) blocksToDelete(blocks []*tsdb.Block) map[ulid.ULID]struct{} {
 	if u.db == nil {
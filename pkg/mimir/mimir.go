@@ -706,6 +706,9 @@ type Mimir struct {
 
 	// Queryables that the querier should use to query the long term storage.
 	StoreQueryables []querier.QueryableWithFilter
+
+	// Loader of the series deletion tombstones that the querier should honour at query time.
+	StoreTombstones querier.TombstonesLoader
 }
 
 // New makes a new Mimir.
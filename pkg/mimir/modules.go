@@ -41,6 +41,7 @@ import (
 	"github.com/grafana/mimir/pkg/flusher"
 	"github.com/grafana/mimir/pkg/frontend"
 	"github.com/grafana/mimir/pkg/frontend/querymiddleware"
+	"github.com/grafana/mimir/pkg/frontend/querystatslog"
 	"github.com/grafana/mimir/pkg/frontend/transport"
 	"github.com/grafana/mimir/pkg/ingester"
 	"github.com/grafana/mimir/pkg/querier"
@@ -391,11 +392,20 @@ func (t *Mimir) initQueryable() (serv services.Service, err error) {
 	querierRegisterer := prometheus.WrapRegistererWith(prometheus.Labels{"engine": "querier"}, t.Registerer)
 
 	// Create a querier queryable and PromQL engine
-	t.QuerierQueryable, t.ExemplarQueryable, t.QuerierEngine = querier.New(t.Cfg.Querier, t.Overrides, t.Distributor, t.StoreQueryables, querierRegisterer, util_log.Logger, t.ActivityTracker)
+	t.QuerierQueryable, t.ExemplarQueryable, t.QuerierEngine = querier.New(t.Cfg.Querier, t.Overrides, t.Distributor, t.StoreQueryables, t.StoreTombstones, querierRegisterer, util_log.Logger, t.ActivityTracker)
 
 	// Use the distributor to return metric metadata by default
 	t.MetadataSupplier = t.Distributor
 
+	// Also return the metric metadata stored in the bucket, if the metric metadata store is enabled.
+	if t.Cfg.BlocksStorage.MetadataStore.Enabled {
+		bucketClient, err := bucket.NewClient(context.Background(), t.Cfg.BlocksStorage.Bucket, "querier-metadata", util_log.Logger, t.Registerer)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create the metric metadata store bucket client")
+		}
+		t.MetadataSupplier = querier.NewStoredMetadataSupplier(t.MetadataSupplier, bucketClient, t.Overrides, t.Cfg.BlocksStorage.MetadataStore.CacheTTL, util_log.Logger)
+	}
+
 	// Register the default endpoints that are always enabled for the querier module
 	t.API.RegisterQueryable(t.Distributor)
 
@@ -530,6 +540,7 @@ func (t *Mimir) initStoreQueryables() (services.Service, error) {
 		return nil, fmt.Errorf("failed to initialize querier: %v", err)
 	} else {
 		t.StoreQueryables = append(t.StoreQueryables, querier.UseAlwaysQueryable(q))
+		t.StoreTombstones = q
 		servs = append(servs, q)
 	}
 
@@ -562,7 +573,7 @@ func (t *Mimir) initIngesterService() (serv services.Service, err error) {
 	t.Cfg.Ingester.InstanceLimitsFn = ingesterInstanceLimits(t.RuntimeConfig)
 	t.tsdbIngesterConfig()
 
-	t.Ingester, err = ingester.New(t.Cfg.Ingester, t.Overrides, t.ActiveGroupsCleanup, t.Registerer, util_log.Logger)
+	t.Ingester, err = ingester.New(t.Cfg.Ingester, t.Overrides, t.Ring, t.ActiveGroupsCleanup, t.Registerer, util_log.Logger)
 	if err != nil {
 		return
 	}
@@ -636,7 +647,17 @@ func (t *Mimir) initQueryFrontend() (serv services.Service, err error) {
 	// Wrap roundtripper into Tripperware.
 	roundTripper = t.QueryFrontendTripperware(roundTripper)
 
-	handler := transport.NewHandler(t.Cfg.Frontend.Handler, roundTripper, util_log.Logger, t.Registerer, t.ActivityTracker)
+	var statsLog transport.QueryStatsLog
+	var statsLogSvc services.Service
+	if t.Cfg.Frontend.QueryStatsLog.Enabled {
+		statsLogWriter, err := querystatslog.NewWriter(t.Cfg.Frontend.QueryStatsLog, util_log.Logger, t.Registerer)
+		if err != nil {
+			return nil, err
+		}
+		statsLog, statsLogSvc = statsLogWriter, statsLogWriter
+	}
+
+	handler := transport.NewHandler(t.Cfg.Frontend.Handler, roundTripper, util_log.Logger, t.Registerer, t.ActivityTracker, statsLog)
 	t.API.RegisterQueryFrontendHandler(handler, t.BuildInfoHandler)
 
 	var frontendSvc services.Service
@@ -651,6 +672,12 @@ func (t *Mimir) initQueryFrontend() (serv services.Service, err error) {
 
 	w := services.NewFailureWatcher()
 	return services.NewBasicService(func(_ context.Context) error {
+		if statsLogSvc != nil {
+			w.WatchService(statsLogSvc)
+			if err := services.StartAndAwaitRunning(context.Background(), statsLogSvc); err != nil {
+				return err
+			}
+		}
 		if frontendSvc != nil {
 			w.WatchService(frontendSvc)
 			// Note that we pass an independent context to the service, since we want to
@@ -668,10 +695,17 @@ func (t *Mimir) initQueryFrontend() (serv services.Service, err error) {
 	}, func(_ error) error {
 		handler.Stop()
 
+		var err error
 		if frontendSvc != nil {
-			return services.StopAndAwaitTerminated(context.Background(), frontendSvc)
+			err = services.StopAndAwaitTerminated(context.Background(), frontendSvc)
 		}
-		return nil
+		if statsLogSvc != nil {
+			// Stopped after the handler, so that the stats of the in-flight queries are written too.
+			if stopErr := services.StopAndAwaitTerminated(context.Background(), statsLogSvc); err == nil {
+				err = stopErr
+			}
+		}
+		return err
 	}), nil
 }
 
@@ -723,7 +757,7 @@ func (t *Mimir) initRuler() (serv services.Service, err error) {
 		// TODO: Consider wrapping logger to differentiate from querier module logger
 		rulerRegisterer := prometheus.WrapRegistererWith(prometheus.Labels{"engine": "ruler"}, t.Registerer)
 
-		queryable, _, eng := querier.New(t.Cfg.Querier, t.Overrides, t.Distributor, t.StoreQueryables, rulerRegisterer, util_log.Logger, t.ActivityTracker)
+		queryable, _, eng := querier.New(t.Cfg.Querier, t.Overrides, t.Distributor, t.StoreQueryables, t.StoreTombstones, rulerRegisterer, util_log.Logger, t.ActivityTracker)
 		queryable = querier.NewErrorTranslateQueryableWithFn(queryable, ruler.WrapQueryableErrors)
 
 		if t.Cfg.Ruler.TenantFederation.Enabled {
@@ -964,7 +998,7 @@ func (t *Mimir) setupModuleManager() error {
 		Distributor:              {DistributorService, API, ActiveGroupsCleanupService, Vault},
 		DistributorService:       {Ring, Overrides, Vault},
 		Ingester:                 {IngesterService, API, ActiveGroupsCleanupService, Vault},
-		IngesterService:          {Overrides, RuntimeConfig, MemberlistKV},
+		IngesterService:          {Overrides, RuntimeConfig, MemberlistKV, Ring},
 		Flusher:                  {Overrides, API},
 		Queryable:                {Overrides, DistributorService, Ring, API, StoreQueryable, MemberlistKV},
 		Querier:                  {TenantFederation, Vault},
@@ -47,6 +47,7 @@ overrides:
 		RulerMaxRulesPerRuleGroup:           20,
 		RulerMaxRuleGroupsPerTenant:         20,
 		NotificationRateLimitPerIntegration: validation.NotificationRateLimitMap{},
+		MaxGlobalValuesPerLabelName:         validation.LabelValuesLimitMap{},
 	}
 
 	loadedLimits := runtimeCfg.(*runtimeConfigValues).TenantLimits
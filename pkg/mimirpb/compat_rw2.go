@@ -0,0 +1,460 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mimirpb
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the Prometheus Remote Write 2.0 messages, as defined in
+// https://github.com/prometheus/prometheus/blob/main/prompb/io/prometheus/write/v2/types.proto.
+const (
+	rw2RequestSymbolsField    = 4
+	rw2RequestTimeseriesField = 5
+
+	rw2SeriesLabelsRefsField       = 1
+	rw2SeriesSamplesField          = 2
+	rw2SeriesHistogramsField       = 3
+	rw2SeriesExemplarsField        = 4
+	rw2SeriesMetadataField         = 5
+	rw2SeriesCreatedTimestampField = 6
+
+	rw2HistogramCustomValuesField = 16
+
+	rw2SampleValueField     = 1
+	rw2SampleTimestampField = 2
+
+	rw2ExemplarLabelsRefsField = 1
+	rw2ExemplarValueField      = 2
+	rw2ExemplarTimestampField  = 3
+
+	rw2MetadataTypeField    = 1
+	rw2MetadataHelpRefField = 3
+	rw2MetadataUnitRefField = 4
+)
+
+// rw2CustomBucketsSchema is the schema of the native histograms with custom buckets (NHCB), whose bucket
+// boundaries are encoded in the histogram custom values.
+const rw2CustomBucketsSchema = -53
+
+var (
+	errRW2InvalidWireType = errors.New("invalid wire type")
+
+	// The native histograms with custom buckets are rejected, because Histogram doesn't support custom values:
+	// they would be stored without their bucket boundaries.
+	errRW2CustomBucketsHistogram = errors.New("native histograms with custom buckets are not supported")
+)
+
+// PreallocWriteRequestV2 unmarshals a Prometheus Remote Write 2.0 request (io.prometheus.write.v2.Request)
+// into the wrapped PreallocWriteRequest. The label names and values of the decoded series reference the
+// unmarshalled buffer, like the ones decoded by PreallocWriteRequest.Unmarshal.
+type PreallocWriteRequestV2 struct {
+	*PreallocWriteRequest
+
+	// IgnoredCreatedTimestamps is the number of series whose created timestamp has been ignored.
+	IgnoredCreatedTimestamps int
+}
+
+// Unmarshal implements proto.Unmarshaler.
+//
+// The metadata of the series is converted to one MetricMetadata per metric name, while the series
+// created timestamp is ignored because it's not supported by Mimir. The series with a created
+// timestamp are counted in IgnoredCreatedTimestamps.
+func (p *PreallocWriteRequestV2) Unmarshal(dAtA []byte) error {
+	p.Timeseries = PreallocTimeseriesSliceFromPool()
+	p.IgnoredCreatedTimestamps = 0
+
+	// The series reference the symbols table, which is not guaranteed to be encoded before them.
+	symbols, err := unmarshalRW2Symbols(dAtA)
+	if err != nil {
+		return err
+	}
+	d := rw2Decoder{symbols: symbols}
+
+	var metadataSeen map[string]struct{}
+
+	for len(dAtA) > 0 {
+		num, typ, n := protowire.ConsumeTag(dAtA)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+
+		if num != rw2RequestTimeseriesField {
+			if n = protowire.ConsumeFieldValue(num, typ, dAtA); n < 0 {
+				return protowire.ParseError(n)
+			}
+			dAtA = dAtA[n:]
+			continue
+		}
+
+		if typ != protowire.BytesType {
+			return errors.Wrap(errRW2InvalidWireType, "timeseries")
+		}
+		v, n := protowire.ConsumeBytes(dAtA)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+
+		ts := TimeseriesFromPool()
+		p.Timeseries = append(p.Timeseries, PreallocTimeseries{TimeSeries: ts})
+
+		metadata, hasCreatedTimestamp, err := d.unmarshalTimeSeries(v, ts)
+		if err != nil {
+			return errors.Wrapf(err, "timeseries %d", len(p.Timeseries)-1)
+		}
+		if hasCreatedTimestamp {
+			p.IgnoredCreatedTimestamps++
+		}
+		if metadata == nil {
+			continue
+		}
+
+		if metadataSeen == nil {
+			metadataSeen = map[string]struct{}{}
+		}
+		if _, ok := metadataSeen[metadata.MetricFamilyName]; !ok {
+			metadataSeen[metadata.MetricFamilyName] = struct{}{}
+			p.Metadata = append(p.Metadata, metadata)
+		}
+	}
+
+	return nil
+}
+
+// unmarshalRW2Symbols returns the symbols table of the input Remote Write 2.0 request.
+func unmarshalRW2Symbols(dAtA []byte) ([]string, error) {
+	var symbols []string
+
+	for len(dAtA) > 0 {
+		num, typ, n := protowire.ConsumeTag(dAtA)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+
+		if num == rw2RequestSymbolsField {
+			if typ != protowire.BytesType {
+				return nil, errors.Wrap(errRW2InvalidWireType, "symbols")
+			}
+			v, n := protowire.ConsumeBytes(dAtA)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			symbols = append(symbols, yoloString(v))
+			dAtA = dAtA[n:]
+			continue
+		}
+
+		if n = protowire.ConsumeFieldValue(num, typ, dAtA); n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+	}
+
+	return symbols, nil
+}
+
+// rw2Decoder decodes the series of a Remote Write 2.0 request, reusing the buffers of the labels
+// references across series.
+type rw2Decoder struct {
+	symbols      []string
+	seriesRefs   []uint32
+	exemplarRefs []uint32
+}
+
+// unmarshalTimeSeries decodes a Remote Write 2.0 TimeSeries into ts. The series metadata is returned
+// only if it's set, together with whether the series has a created timestamp.
+func (d *rw2Decoder) unmarshalTimeSeries(dAtA []byte, ts *TimeSeries) (_ *MetricMetadata, hasCreatedTimestamp bool, _ error) {
+	var (
+		metadata    MetricMetadata
+		hasMetadata bool
+		err         error
+	)
+
+	d.seriesRefs = d.seriesRefs[:0]
+
+	for len(dAtA) > 0 {
+		num, typ, n := protowire.ConsumeTag(dAtA)
+		if n < 0 {
+			return nil, false, protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+
+		switch num {
+		case rw2SeriesLabelsRefsField:
+			d.seriesRefs, n, err = appendRW2Refs(dAtA, typ, d.seriesRefs)
+
+		case rw2SeriesSamplesField:
+			var v []byte
+			if v, n, err = consumeRW2Bytes(dAtA, typ); err == nil {
+				var s Sample
+				s, err = unmarshalRW2Sample(v)
+				ts.Samples = append(ts.Samples, s)
+			}
+
+		case rw2SeriesHistogramsField:
+			// The Remote Write 2.0 Histogram shares the field numbers of the Remote Write 1.0 one,
+			// only adding the custom values of the native histograms with custom buckets.
+			var v []byte
+			if v, n, err = consumeRW2Bytes(dAtA, typ); err == nil {
+				ts.Histograms = append(ts.Histograms, Histogram{})
+				h := &ts.Histograms[len(ts.Histograms)-1]
+				if err = h.Unmarshal(v); err == nil && (h.Schema == rw2CustomBucketsSchema || hasRW2Field(v, rw2HistogramCustomValuesField)) {
+					err = errRW2CustomBucketsHistogram
+				}
+			}
+
+		case rw2SeriesExemplarsField:
+			var v []byte
+			if v, n, err = consumeRW2Bytes(dAtA, typ); err == nil {
+				var e Exemplar
+				e, err = d.unmarshalExemplar(v)
+				ts.Exemplars = append(ts.Exemplars, e)
+			}
+
+		case rw2SeriesMetadataField:
+			var v []byte
+			if v, n, err = consumeRW2Bytes(dAtA, typ); err == nil {
+				metadata, err = d.unmarshalMetadata(v)
+				hasMetadata = true
+			}
+
+		case rw2SeriesCreatedTimestampField:
+			// Not supported, so it's only checked whether it's set.
+			if typ != protowire.VarintType {
+				err = errors.Wrap(errRW2InvalidWireType, "created timestamp")
+				break
+			}
+			var v uint64
+			v, n = protowire.ConsumeVarint(dAtA)
+			hasCreatedTimestamp = hasCreatedTimestamp || v != 0
+
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, dAtA)
+		}
+
+		if err != nil {
+			return nil, false, err
+		}
+		if n < 0 {
+			return nil, false, protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+	}
+
+	if ts.Labels, err = appendRW2Labels(ts.Labels, d.seriesRefs, d.symbols); err != nil {
+		return nil, false, err
+	}
+
+	if !hasMetadata || (metadata.Type == UNKNOWN && metadata.Help == "" && metadata.Unit == "") {
+		return nil, hasCreatedTimestamp, nil
+	}
+
+	for _, l := range ts.Labels {
+		if l.Name == model.MetricNameLabel {
+			// The metadata is kept beyond the lifetime of the unmarshalled buffer, so its strings are copied.
+			metadata.MetricFamilyName = strings.Clone(l.Value)
+			metadata.Help = strings.Clone(metadata.Help)
+			metadata.Unit = strings.Clone(metadata.Unit)
+			return &metadata, hasCreatedTimestamp, nil
+		}
+	}
+
+	// Metadata can't be attributed to a series without a metric name.
+	return nil, hasCreatedTimestamp, nil
+}
+
+// appendRW2Refs appends to refs the symbols references of the input field, which can be either packed or not.
+func appendRW2Refs(dAtA []byte, typ protowire.Type, refs []uint32) ([]uint32, int, error) {
+	switch typ {
+	case protowire.VarintType:
+		v, n := protowire.ConsumeVarint(dAtA)
+		return append(refs, uint32(v)), n, nil
+
+	case protowire.BytesType:
+		packed, n := protowire.ConsumeBytes(dAtA)
+		for n >= 0 && len(packed) > 0 {
+			v, m := protowire.ConsumeVarint(packed)
+			if m < 0 {
+				return refs, m, nil
+			}
+			refs = append(refs, uint32(v))
+			packed = packed[m:]
+		}
+		return refs, n, nil
+
+	default:
+		return refs, 0, errors.Wrap(errRW2InvalidWireType, "labels refs")
+	}
+}
+
+// appendRW2Labels appends to dst the labels referenced by the input pairs of name and value references.
+func appendRW2Labels(dst []LabelAdapter, refs []uint32, symbols []string) ([]LabelAdapter, error) {
+	if len(refs)%2 != 0 {
+		return dst, fmt.Errorf("labels refs: odd number of references %d", len(refs))
+	}
+
+	for i := 0; i < len(refs); i += 2 {
+		nameRef, valueRef := refs[i], refs[i+1]
+		if int(nameRef) >= len(symbols) || int(valueRef) >= len(symbols) {
+			return dst, fmt.Errorf("labels refs: reference out of the symbols table of length %d", len(symbols))
+		}
+		dst = append(dst, LabelAdapter{Name: symbols[nameRef], Value: symbols[valueRef]})
+	}
+
+	return dst, nil
+}
+
+// hasRW2Field returns whether the input message has the field num. The message is expected to be valid.
+func hasRW2Field(dAtA []byte, num protowire.Number) bool {
+	for len(dAtA) > 0 {
+		fieldNum, typ, n := protowire.ConsumeTag(dAtA)
+		if n < 0 {
+			return false
+		}
+		if fieldNum == num {
+			return true
+		}
+		dAtA = dAtA[n:]
+
+		if n = protowire.ConsumeFieldValue(fieldNum, typ, dAtA); n < 0 {
+			return false
+		}
+		dAtA = dAtA[n:]
+	}
+	return false
+}
+
+// consumeRW2Bytes returns the value of a length-delimited field and the number of consumed bytes.
+func consumeRW2Bytes(dAtA []byte, typ protowire.Type) ([]byte, int, error) {
+	if typ != protowire.BytesType {
+		return nil, 0, errRW2InvalidWireType
+	}
+	v, n := protowire.ConsumeBytes(dAtA)
+	return v, n, nil
+}
+
+func unmarshalRW2Sample(dAtA []byte) (Sample, error) {
+	var s Sample
+
+	for len(dAtA) > 0 {
+		num, typ, n := protowire.ConsumeTag(dAtA)
+		if n < 0 {
+			return s, protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+
+		switch {
+		case num == rw2SampleValueField && typ == protowire.Fixed64Type:
+			var v uint64
+			v, n = protowire.ConsumeFixed64(dAtA)
+			s.Value = math.Float64frombits(v)
+		case num == rw2SampleTimestampField && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(dAtA)
+			s.TimestampMs = int64(v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, dAtA)
+		}
+
+		if n < 0 {
+			return s, protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+	}
+
+	return s, nil
+}
+
+func (d *rw2Decoder) unmarshalExemplar(dAtA []byte) (Exemplar, error) {
+	var (
+		e   Exemplar
+		err error
+	)
+
+	d.exemplarRefs = d.exemplarRefs[:0]
+
+	for len(dAtA) > 0 {
+		num, typ, n := protowire.ConsumeTag(dAtA)
+		if n < 0 {
+			return e, protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+
+		switch {
+		case num == rw2ExemplarLabelsRefsField:
+			if d.exemplarRefs, n, err = appendRW2Refs(dAtA, typ, d.exemplarRefs); err != nil {
+				return e, errors.Wrap(err, "exemplar")
+			}
+		case num == rw2ExemplarValueField && typ == protowire.Fixed64Type:
+			var v uint64
+			v, n = protowire.ConsumeFixed64(dAtA)
+			e.Value = math.Float64frombits(v)
+		case num == rw2ExemplarTimestampField && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(dAtA)
+			e.TimestampMs = int64(v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, dAtA)
+		}
+
+		if n < 0 {
+			return e, protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+	}
+
+	e.Labels, err = appendRW2Labels(nil, d.exemplarRefs, d.symbols)
+	return e, errors.Wrap(err, "exemplar")
+}
+
+func (d *rw2Decoder) unmarshalMetadata(dAtA []byte) (MetricMetadata, error) {
+	var m MetricMetadata
+
+	for len(dAtA) > 0 {
+		num, typ, n := protowire.ConsumeTag(dAtA)
+		if n < 0 {
+			return m, protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+
+		if typ != protowire.VarintType || (num != rw2MetadataTypeField && num != rw2MetadataHelpRefField && num != rw2MetadataUnitRefField) {
+			if n = protowire.ConsumeFieldValue(num, typ, dAtA); n < 0 {
+				return m, protowire.ParseError(n)
+			}
+			dAtA = dAtA[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeVarint(dAtA)
+		if n < 0 {
+			return m, protowire.ParseError(n)
+		}
+		dAtA = dAtA[n:]
+
+		if num == rw2MetadataTypeField {
+			// The Remote Write 2.0 metric types have the same values of the Remote Write 1.0 ones.
+			m.Type = MetricMetadata_MetricType(v)
+			continue
+		}
+
+		if v >= uint64(len(d.symbols)) {
+			return m, fmt.Errorf("metadata: reference %d out of the symbols table of length %d", v, len(d.symbols))
+		}
+		if num == rw2MetadataHelpRefField {
+			m.Help = d.symbols[v]
+		} else {
+			m.Unit = d.symbols[v]
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mimirpb
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestPreallocWriteRequestV2_Unmarshal(t *testing.T) {
+	histogram := Histogram{
+		Count:          &Histogram_CountInt{CountInt: 2},
+		Sum:            3,
+		Schema:         1,
+		ZeroThreshold:  0.001,
+		ZeroCount:      &Histogram_ZeroCountInt{ZeroCountInt: 1},
+		PositiveSpans:  []BucketSpan{{Offset: 0, Length: 1}},
+		PositiveDeltas: []int64{1},
+		Timestamp:      30,
+	}
+	histogramBytes, err := histogram.Marshal()
+	require.NoError(t, err)
+
+	symbols := []string{"", "__name__", "http_requests_total", "job", "api", "trace_id", "abc", "Total requests.", "requests", "temperature"}
+
+	// The series reference the symbols by index.
+	series1 := appendRW2Message(nil, rw2SeriesLabelsRefsField, appendRW2PackedRefs(nil, 1, 2, 3, 4))
+	series1 = appendRW2Message(series1, rw2SeriesSamplesField, appendRW2Sample(nil, 1.5, 10))
+	series1 = appendRW2Message(series1, rw2SeriesSamplesField, appendRW2Sample(nil, 2.5, 20))
+	series1 = appendRW2Message(series1, rw2SeriesHistogramsField, histogramBytes)
+	series1 = appendRW2Message(series1, rw2SeriesExemplarsField, appendRW2Exemplar(nil, []uint32{5, 6}, 1, 10))
+	series1 = appendRW2Message(series1, rw2SeriesMetadataField, appendRW2Metadata(nil, uint64(COUNTER), 7, 8))
+	series1 = protowire.AppendTag(series1, rw2SeriesCreatedTimestampField, protowire.VarintType)
+	series1 = protowire.AppendVarint(series1, 5)
+
+	// Unpacked labels references, and metadata of a metric family already seen.
+	series2 := appendRW2Message(nil, rw2SeriesSamplesField, appendRW2Sample(nil, math.Inf(1), 10))
+	for _, ref := range []uint64{1, 2, 3, 9} {
+		series2 = protowire.AppendTag(series2, rw2SeriesLabelsRefsField, protowire.VarintType)
+		series2 = protowire.AppendVarint(series2, ref)
+	}
+	series2 = appendRW2Message(series2, rw2SeriesMetadataField, appendRW2Metadata(nil, uint64(GAUGE), 0, 0))
+	series2 = protowire.AppendTag(series2, rw2SeriesCreatedTimestampField, protowire.VarintType)
+	series2 = protowire.AppendVarint(series2, 0)
+
+	// Series are encoded before the symbols, to ensure the decoding doesn't depend on the fields order.
+	var data []byte
+	data = appendRW2Message(data, rw2RequestTimeseriesField, series1)
+	data = appendRW2Message(data, rw2RequestTimeseriesField, series2)
+	for _, s := range symbols {
+		data = appendRW2Message(data, rw2RequestSymbolsField, []byte(s))
+	}
+
+	req := PreallocWriteRequestV2{PreallocWriteRequest: &PreallocWriteRequest{}}
+	require.NoError(t, req.Unmarshal(data))
+	t.Cleanup(func() { ReuseSlice(req.Timeseries) })
+
+	require.Len(t, req.Timeseries, 2)
+
+	assert.Equal(t, []LabelAdapter{{Name: "__name__", Value: "http_requests_total"}, {Name: "job", Value: "api"}}, req.Timeseries[0].Labels)
+	assert.Equal(t, []Sample{{TimestampMs: 10, Value: 1.5}, {TimestampMs: 20, Value: 2.5}}, req.Timeseries[0].Samples)
+	assert.Equal(t, []Histogram{histogram}, req.Timeseries[0].Histograms)
+	assert.Equal(t, []Exemplar{{Labels: []LabelAdapter{{Name: "trace_id", Value: "abc"}}, Value: 1, TimestampMs: 10}}, req.Timeseries[0].Exemplars)
+
+	assert.Equal(t, []LabelAdapter{{Name: "__name__", Value: "http_requests_total"}, {Name: "job", Value: "temperature"}}, req.Timeseries[1].Labels)
+	assert.Equal(t, []Sample{{TimestampMs: 10, Value: math.Inf(1)}}, req.Timeseries[1].Samples)
+	assert.Empty(t, req.Timeseries[1].Histograms)
+	assert.Empty(t, req.Timeseries[1].Exemplars)
+
+	assert.Equal(t, []*MetricMetadata{{Type: COUNTER, MetricFamilyName: "http_requests_total", Help: "Total requests.", Unit: "requests"}}, req.Metadata)
+
+	// Only the created timestamp of the first series is set.
+	assert.Equal(t, 1, req.IgnoredCreatedTimestamps)
+}
+
+func TestPreallocWriteRequestV2_UnmarshalInvalid(t *testing.T) {
+	symbols := func(data []byte, symbols ...string) []byte {
+		for _, s := range symbols {
+			data = appendRW2Message(data, rw2RequestSymbolsField, []byte(s))
+		}
+		return data
+	}
+
+	customBucketsHistogram, err := (&Histogram{
+		Count:          &Histogram_CountInt{CountInt: 2},
+		Schema:         rw2CustomBucketsSchema,
+		PositiveSpans:  []BucketSpan{{Offset: 0, Length: 2}},
+		PositiveDeltas: []int64{1, 0},
+	}).Marshal()
+	require.NoError(t, err)
+	customValues := protowire.AppendTag(nil, rw2HistogramCustomValuesField, protowire.BytesType)
+	customValues = protowire.AppendBytes(customValues, protowire.AppendFixed64(protowire.AppendFixed64(nil, math.Float64bits(1)), math.Float64bits(5)))
+
+	tests := map[string]struct {
+		data        []byte
+		expectedErr string
+	}{
+		"native histogram with custom buckets": {
+			data:        appendRW2Message(nil, rw2RequestTimeseriesField, appendRW2Message(nil, rw2SeriesHistogramsField, append(customBucketsHistogram, customValues...))),
+			expectedErr: "timeseries 0: native histograms with custom buckets are not supported",
+		},
+		"native histogram with custom values": {
+			data:        appendRW2Message(nil, rw2RequestTimeseriesField, appendRW2Message(nil, rw2SeriesHistogramsField, customValues)),
+			expectedErr: "timeseries 0: native histograms with custom buckets are not supported",
+		},
+		"label reference out of the symbols table": {
+			data:        appendRW2Message(symbols(nil, "", "a"), rw2RequestTimeseriesField, appendRW2Message(nil, rw2SeriesLabelsRefsField, appendRW2PackedRefs(nil, 1, 2))),
+			expectedErr: "timeseries 0: labels refs: reference out of the symbols table of length 2",
+		},
+		"odd number of label references": {
+			data:        appendRW2Message(symbols(nil, "", "a"), rw2RequestTimeseriesField, appendRW2Message(nil, rw2SeriesLabelsRefsField, appendRW2PackedRefs(nil, 1))),
+			expectedErr: "timeseries 0: labels refs: odd number of references 1",
+		},
+		"metadata reference out of the symbols table": {
+			data:        appendRW2Message(symbols(nil, ""), rw2RequestTimeseriesField, appendRW2Message(nil, rw2SeriesMetadataField, appendRW2Metadata(nil, 1, 3, 0))),
+			expectedErr: "timeseries 0: metadata: reference 3 out of the symbols table of length 1",
+		},
+		"invalid wire type of timeseries": {
+			data:        protowire.AppendVarint(protowire.AppendTag(nil, rw2RequestTimeseriesField, protowire.VarintType), 1),
+			expectedErr: "timeseries: invalid wire type",
+		},
+		"invalid wire type of created timestamp": {
+			data:        appendRW2Message(nil, rw2RequestTimeseriesField, appendRW2Message(nil, rw2SeriesCreatedTimestampField, []byte{1})),
+			expectedErr: "timeseries 0: created timestamp: invalid wire type",
+		},
+		"truncated message": {
+			data:        appendRW2Message(nil, rw2RequestTimeseriesField, []byte{1, 2, 3})[:3],
+			expectedErr: "unexpected EOF",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			req := PreallocWriteRequestV2{PreallocWriteRequest: &PreallocWriteRequest{}}
+			err := req.Unmarshal(testData.data)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), testData.expectedErr)
+		})
+	}
+}
+
+func appendRW2Message(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendRW2PackedRefs(b []byte, refs ...uint64) []byte {
+	for _, ref := range refs {
+		b = protowire.AppendVarint(b, ref)
+	}
+	return b
+}
+
+func appendRW2Sample(b []byte, value float64, timestamp int64) []byte {
+	b = protowire.AppendTag(b, rw2SampleValueField, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(value))
+	b = protowire.AppendTag(b, rw2SampleTimestampField, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(timestamp))
+}
+
+func appendRW2Exemplar(b []byte, refs []uint32, value float64, timestamp int64) []byte {
+	var packed []byte
+	for _, ref := range refs {
+		packed = protowire.AppendVarint(packed, uint64(ref))
+	}
+	b = appendRW2Message(b, rw2ExemplarLabelsRefsField, packed)
+	b = protowire.AppendTag(b, rw2ExemplarValueField, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(value))
+	b = protowire.AppendTag(b, rw2ExemplarTimestampField, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(timestamp))
+}
+
+func appendRW2Metadata(b []byte, typ, helpRef, unitRef uint64) []byte {
+	b = protowire.AppendTag(b, rw2MetadataTypeField, protowire.VarintType)
+	b = protowire.AppendVarint(b, typ)
+	b = protowire.AppendTag(b, rw2MetadataHelpRefField, protowire.VarintType)
+	b = protowire.AppendVarint(b, helpRef)
+	b = protowire.AppendTag(b, rw2MetadataUnitRefField, protowire.VarintType)
+	return protowire.AppendVarint(b, unitRef)
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package analyze
+
+import (
+	"sort"
+
+	"github.com/grafana/mimir/pkg/frontend/querystatslog"
+)
+
+// QueryStats is the aggregated statistics of the executions of a query by a tenant.
+type QueryStats struct {
+	Tenant string `json:"tenant"`
+	Query  string `json:"query"`
+
+	Executions            int     `json:"executions"`
+	Errors                int     `json:"errors"`
+	TotalWallTime         float64 `json:"total_wall_time_seconds"`
+	MaxWallTime           float64 `json:"max_wall_time_seconds"`
+	TotalFetchedSeries    uint64  `json:"total_fetched_series"`
+	TotalFetchedChunks    uint64  `json:"total_fetched_chunks"`
+	TotalSamplesProcessed uint64  `json:"total_samples_processed"`
+	TotalStoreGatewayTime float64 `json:"total_store_gateway_time_seconds"`
+	TotalIngesterTime     float64 `json:"total_ingester_time_seconds"`
+}
+
+// QueryStatsReport is the report of the most expensive and failing queries.
+type QueryStatsReport struct {
+	Records            int          `json:"records"`
+	TopByWallTime      []QueryStats `json:"top_by_wall_time"`
+	TopByFetchedChunks []QueryStats `json:"top_by_fetched_chunks"`
+	TopByErrors        []QueryStats `json:"top_by_errors"`
+}
+
+// AggregateQueryStats aggregates the records by tenant and query.
+func AggregateQueryStats(records []querystatslog.Record) []QueryStats {
+	type key struct {
+		tenant, query string
+	}
+
+	byQuery := map[key]*QueryStats{}
+	for _, r := range records {
+		k := key{tenant: r.Tenant, query: r.Query}
+		s := byQuery[k]
+		if s == nil {
+			s = &QueryStats{Tenant: r.Tenant, Query: r.Query}
+			byQuery[k] = s
+		}
+
+		s.Executions++
+		if r.Status != "success" {
+			s.Errors++
+		}
+		s.TotalWallTime += r.WallTime
+		if r.WallTime > s.MaxWallTime {
+			s.MaxWallTime = r.WallTime
+		}
+		s.TotalFetchedSeries += r.FetchedSeriesCount
+		s.TotalFetchedChunks += r.FetchedChunksCount
+		s.TotalSamplesProcessed += r.SamplesProcessed
+		s.TotalStoreGatewayTime += r.StoreGatewayTime
+		s.TotalIngesterTime += r.IngesterTime
+	}
+
+	result := make([]QueryStats, 0, len(byQuery))
+	for _, s := range byQuery {
+		result = append(result, *s)
+	}
+
+	// Sort for a deterministic output.
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Tenant != result[j].Tenant {
+			return result[i].Tenant < result[j].Tenant
+		}
+		return result[i].Query < result[j].Query
+	})
+	return result
+}
+
+// NewQueryStatsReport returns the top n queries by total wall time, total fetched chunks and errors.
+func NewQueryStatsReport(records []querystatslog.Record, n int) QueryStatsReport {
+	stats := AggregateQueryStats(records)
+
+	return QueryStatsReport{
+		Records: len(records),
+		TopByWallTime: topQueryStats(stats, n, func(s QueryStats) float64 {
+			return s.TotalWallTime
+		}),
+		TopByFetchedChunks: topQueryStats(stats, n, func(s QueryStats) float64 {
+			return float64(s.TotalFetchedChunks)
+		}),
+		TopByErrors: topQueryStats(stats, n, func(s QueryStats) float64 {
+			return float64(s.Errors)
+		}),
+	}
+}
+
+// topQueryStats returns the n stats with the highest value, skipping the ones with a zero value.
+func topQueryStats(stats []QueryStats, n int, value func(QueryStats) float64) []QueryStats {
+	result := make([]QueryStats, 0, len(stats))
+	for _, s := range stats {
+		if value(s) > 0 {
+			result = append(result, s)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return value(result[i]) > value(result[j])
+	})
+
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package analyze
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/mimir/pkg/frontend/querystatslog"
+)
+
+func TestNewQueryStatsReport(t *testing.T) {
+	records := []querystatslog.Record{
+		{Tenant: "user-1", Query: "up", Status: "success", WallTime: 1, FetchedChunksCount: 100},
+		{Tenant: "user-1", Query: "up", Status: "success", WallTime: 3, FetchedChunksCount: 100},
+		{Tenant: "user-1", Query: "sum(rate(foo[5m]))", Status: "success", WallTime: 2, FetchedChunksCount: 1000},
+		{Tenant: "user-2", Query: "up", Status: "failed", WallTime: 0.5},
+		{Tenant: "user-2", Query: "up", Status: "timeout", WallTime: 0.5},
+	}
+
+	report := NewQueryStatsReport(records, 2)
+
+	assert.Equal(t, 5, report.Records)
+	assert.Equal(t, []QueryStats{
+		{Tenant: "user-1", Query: "up", Executions: 2, TotalWallTime: 4, MaxWallTime: 3, TotalFetchedChunks: 200},
+		{Tenant: "user-1", Query: "sum(rate(foo[5m]))", Executions: 1, TotalWallTime: 2, MaxWallTime: 2, TotalFetchedChunks: 1000},
+	}, report.TopByWallTime)
+	assert.Equal(t, []QueryStats{
+		{Tenant: "user-1", Query: "sum(rate(foo[5m]))", Executions: 1, TotalWallTime: 2, MaxWallTime: 2, TotalFetchedChunks: 1000},
+		{Tenant: "user-1", Query: "up", Executions: 2, TotalWallTime: 4, MaxWallTime: 3, TotalFetchedChunks: 200},
+	}, report.TopByFetchedChunks)
+
+	// The queries without errors are not reported.
+	assert.Equal(t, []QueryStats{
+		{Tenant: "user-2", Query: "up", Executions: 2, Errors: 2, TotalWallTime: 1, MaxWallTime: 0.5},
+	}, report.TopByErrors)
+}
@@ -106,4 +106,28 @@ func (cmd *AnalyzeCommand) Register(app *kingpin.Application, envVars EnvVarName
 	ruleFileAnalyzeCmd.Flag("output", "The path for the output file").
 		Default("metrics-in-ruler.json").
 		StringVar(&rfCmd.outputFile)
+
+	qsCmd := &QueryStatsAnalyzeCommand{}
+	queryStatsAnalyzeCmd := analyzeCmd.Command("query-stats", "Analyze the query statistics written by the query-frontend to the object storage, and output the most expensive and failing queries.").Action(qsCmd.run)
+	queryStatsAnalyzeCmd.Flag("bucket-config", "The CLI args to configure the storage bucket the query statistics are written to").
+		StringVar(&qsCmd.bucketConfig)
+	queryStatsAnalyzeCmd.Flag("bucket-config-help", "Help text explaining how to use the -bucket-config parameter").
+		BoolVar(&qsCmd.bucketConfigHelp)
+	queryStatsAnalyzeCmd.Flag("tenant", "Tenant to analyze the query statistics of. When repeated, the query statistics of all the specified tenants are analyzed. Defaults to all tenants.").
+		StringsVar(&qsCmd.tenants)
+	queryStatsAnalyzeCmd.Flag("start", "Start of the time range of the query statistics to analyze, in RFC3339 format. Defaults to 24 hours before the end.").
+		Default("").
+		StringVar(&qsCmd.start)
+	queryStatsAnalyzeCmd.Flag("end", "End of the time range of the query statistics to analyze, in RFC3339 format. Defaults to now.").
+		Default("").
+		StringVar(&qsCmd.end)
+	queryStatsAnalyzeCmd.Flag("top", "Number of queries to output in each top list").
+		Default("10").
+		IntVar(&qsCmd.top)
+	queryStatsAnalyzeCmd.Flag("download-dir", "If set, the downloaded query statistics files are saved to this directory").
+		Default("").
+		StringVar(&qsCmd.downloadDir)
+	queryStatsAnalyzeCmd.Flag("output", "The path for the output file").
+		Default("query-stats.json").
+		StringVar(&qsCmd.outputFile)
 }
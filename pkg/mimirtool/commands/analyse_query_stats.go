@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/frontend/querystatslog"
+	"github.com/grafana/mimir/pkg/mimirtool/analyze"
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+// QueryStatsAnalyzeCommand analyzes the query stats written by the query-frontend to the object storage.
+type QueryStatsAnalyzeCommand struct {
+	cfg              bucket.Config
+	bucketConfig     string
+	bucketConfigHelp bool
+	tenants          []string
+	start            string
+	end              string
+	top              int
+	downloadDir      string
+	outputFile       string
+}
+
+func (cmd *QueryStatsAnalyzeCommand) run(_ *kingpin.ParseContext) error {
+	if cmd.bucketConfigHelp {
+		printBucketConfigHelp(&cmd.cfg, "analyze query-stats")
+		return nil
+	}
+
+	if err := parseBucketConfig(&cmd.cfg, cmd.bucketConfig); err != nil {
+		return errors.Wrap(err, "error when parsing bucket config")
+	}
+
+	end := time.Now()
+	if cmd.end != "" {
+		var err error
+		if end, err = time.Parse(time.RFC3339, cmd.end); err != nil {
+			return errors.Wrap(err, "invalid end time")
+		}
+	}
+	start := end.Add(-24 * time.Hour)
+	if cmd.start != "" {
+		var err error
+		if start, err = time.Parse(time.RFC3339, cmd.start); err != nil {
+			return errors.Wrap(err, "invalid start time")
+		}
+	}
+	if start.After(end) {
+		return errors.New("the start time must be before the end time")
+	}
+
+	ctx := context.Background()
+	bkt, err := bucket.NewClient(ctx, cmd.cfg, "query-stats", log.NewNopLogger(), nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the bucket client")
+	}
+
+	records, err := readQueryStats(ctx, bkt, cmd.tenants, start, end, cmd.downloadDir)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(analyze.NewQueryStatsReport(records, cmd.top), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(cmd.outputFile, out, os.FileMode(int(0o666))); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// readQueryStats returns the query stats records of the tenants between start and end. If no tenant is
+// specified, the records of all the tenants are returned. If downloadDir is not empty, the files the records
+// are read from are saved to it.
+func readQueryStats(ctx context.Context, bkt objstore.BucketReader, tenants []string, start, end time.Time, downloadDir string) ([]querystatslog.Record, error) {
+	if len(tenants) == 0 {
+		err := bkt.Iter(ctx, "", func(name string) error {
+			if strings.HasSuffix(name, objstore.DirDelim) {
+				tenants = append(tenants, strings.TrimSuffix(name, objstore.DirDelim))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list tenants")
+		}
+	}
+
+	var records []querystatslog.Record
+	for _, tenant := range tenants {
+		var partitions []string
+		err := bkt.Iter(ctx, tenant+objstore.DirDelim, func(name string) error {
+			hour, err := querystatslog.ParsePartitionHour(name)
+			if err != nil {
+				// Not a partition.
+				return nil
+			}
+			if hour.Add(time.Hour).After(start) && !hour.After(end) {
+				partitions = append(partitions, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list the query stats of tenant %s", tenant)
+		}
+
+		for _, partition := range partitions {
+			err := bkt.Iter(ctx, partition, func(name string) error {
+				if !strings.HasSuffix(name, querystatslog.FileExtension) {
+					return nil
+				}
+
+				fileRecords, err := readQueryStatsFile(ctx, bkt, name, downloadDir)
+				if err != nil {
+					return err
+				}
+
+				for _, r := range fileRecords {
+					if !r.Timestamp.Before(start) && !r.Timestamp.After(end) {
+						records = append(records, r)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return records, nil
+}
+
+func readQueryStatsFile(ctx context.Context, bkt objstore.BucketReader, name, downloadDir string) ([]querystatslog.Record, error) {
+	reader, err := bkt.Get(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download %s", name)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download %s", name)
+	}
+
+	if downloadDir != "" {
+		localPath := filepath.Join(downloadDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(localPath), os.ModePerm); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(localPath, content, os.FileMode(int(0o666))); err != nil {
+			return nil, err
+		}
+	}
+
+	records, err := querystatslog.DecodeRecords(bytes.NewReader(content))
+	return records, errors.Wrapf(err, "failed to read %s", name)
+}
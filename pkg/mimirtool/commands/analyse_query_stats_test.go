@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package commands
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/frontend/querystatslog"
+)
+
+func TestReadQueryStats(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	hour := time.Date(2023, 5, 10, 14, 0, 0, 0, time.UTC)
+
+	upload := func(tenant string, hour time.Time, queries ...string) {
+		var records []querystatslog.Record
+		for ix, q := range queries {
+			records = append(records, querystatslog.Record{Timestamp: hour.Add(time.Duration(ix) * time.Minute), Tenant: tenant, Query: q})
+		}
+
+		buf := bytes.Buffer{}
+		require.NoError(t, querystatslog.EncodeRecords(&buf, records))
+		require.NoError(t, bkt.Upload(ctx, querystatslog.PartitionPrefix(tenant, hour)+"file"+querystatslog.FileExtension, &buf))
+	}
+
+	upload("user-1", hour.Add(-time.Hour), "too-old")
+	upload("user-1", hour, "a", "b")
+	upload("user-1", hour.Add(time.Hour), "c", "too-new")
+	upload("user-2", hour, "d")
+
+	queries := func(records []querystatslog.Record) []string {
+		var result []string
+		for _, r := range records {
+			result = append(result, r.Tenant+"/"+r.Query)
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	start, end := hour, hour.Add(time.Hour)
+
+	records, err := readQueryStats(ctx, bkt, nil, start, end, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-1/a", "user-1/b", "user-1/c", "user-2/d"}, queries(records))
+
+	downloadDir := t.TempDir()
+	records, err = readQueryStats(ctx, bkt, []string{"user-2"}, start, end, downloadDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-2/d"}, queries(records))
+
+	// The downloaded file is saved with the same name as in the object storage.
+	content, err := os.ReadFile(filepath.Join(downloadDir, "user-2", "2023-05-10T14", "file"+querystatslog.FileExtension))
+	require.NoError(t, err)
+	downloaded, err := querystatslog.DecodeRecords(bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, records, downloaded)
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+// BucketIndexCommand verifies and repairs the bucket index of the tenants against the content of the blocks storage bucket.
+type BucketIndexCommand struct {
+	cfg                       bucket.Config
+	coldCfg                   bucket.Config
+	bucketConfig              string
+	coldBucketConfig          string
+	bucketConfigHelp          bool
+	tenants                   []string
+	dryRun                    bool
+	partialBlockDeletionDelay time.Duration
+}
+
+type bucketIndexTenantResult struct {
+	Tenant  string                     `json:"tenant"`
+	Report  *bucketindex.CheckReport   `json:"report"`
+	Actions []bucketindex.RepairAction `json:"actions,omitempty"`
+}
+
+// Register is used to register the command to a parent command.
+func (c *BucketIndexCommand) Register(app *kingpin.Application, _ EnvVarNames) {
+	bucketIndexCmd := app.Command("bucket-index", "Verify and repair the bucket index of the blocks storage.")
+
+	verifyCmd := bucketIndexCmd.Command("verify", "Check the bucket index against the content of the blocks storage bucket, and output the inconsistencies found.").Action(c.verify)
+	repairCmd := bucketIndexCmd.Command("repair", "Repair the inconsistencies between the bucket index and the content of the blocks storage bucket, and output the repair actions.").Action(c.repair)
+
+	for _, cmd := range []*kingpin.CmdClause{verifyCmd, repairCmd} {
+		cmd.Flag("bucket-config", "The CLI args to configure the blocks storage bucket").
+			StringVar(&c.bucketConfig)
+		cmd.Flag("cold-bucket-config", "The CLI args to configure the cold storage bucket. Required if blocks have been moved to the cold storage.").
+			StringVar(&c.coldBucketConfig)
+		cmd.Flag("bucket-config-help", "Help text explaining how to use the -bucket-config parameter").
+			BoolVar(&c.bucketConfigHelp)
+		cmd.Flag("tenant", "Tenant to check the bucket index of. When repeated, the bucket index of all the specified tenants is checked. Defaults to all tenants.").
+			StringsVar(&c.tenants)
+	}
+
+	repairCmd.Flag("dry-run", "If enabled, the repair actions are output without being run").
+		Default("false").
+		BoolVar(&c.dryRun)
+	repairCmd.Flag("partial-block-deletion-delay", "How long the objects of a partial block have to be unmodified for the partial block to be marked for deletion. 0 to not mark partial blocks for deletion.").
+		Default("24h").
+		DurationVar(&c.partialBlockDeletionDelay)
+}
+
+func (c *BucketIndexCommand) verify(_ *kingpin.ParseContext) error {
+	return c.run("bucket-index verify", false)
+}
+
+func (c *BucketIndexCommand) repair(_ *kingpin.ParseContext) error {
+	return c.run("bucket-index repair", true)
+}
+
+func (c *BucketIndexCommand) run(command string, repair bool) error {
+	if c.bucketConfigHelp {
+		printBucketConfigHelp(&c.cfg, command)
+		return nil
+	}
+
+	if err := parseBucketConfig(&c.cfg, c.bucketConfig); err != nil {
+		return errors.Wrap(err, "error when parsing bucket config")
+	}
+
+	logger := level.NewFilter(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)), level.AllowWarn())
+	ctx := context.Background()
+
+	bkt, err := bucket.NewClient(ctx, c.cfg, "bucket-index", logger, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the bucket client")
+	}
+
+	var coldBkt objstore.Bucket
+	if c.coldBucketConfig != "" {
+		if err := parseBucketConfig(&c.coldCfg, c.coldBucketConfig); err != nil {
+			return errors.Wrap(err, "error when parsing cold bucket config")
+		}
+		if coldBkt, err = bucket.NewClient(ctx, c.coldCfg, "bucket-index-cold", logger, nil); err != nil {
+			return errors.Wrap(err, "failed to create the cold bucket client")
+		}
+	}
+
+	tenants := c.tenants
+	if len(tenants) == 0 {
+		if tenants, err = tsdb.ListUsers(ctx, bkt); err != nil {
+			return errors.Wrap(err, "failed to list tenants")
+		}
+	}
+	sort.Strings(tenants)
+
+	results := make([]bucketIndexTenantResult, 0, len(tenants))
+	for _, tenant := range tenants {
+		checker := bucketindex.NewChecker(bkt, coldBkt, tenant, nil, log.With(logger, "tenant", tenant))
+
+		report, err := checker.Check(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check the bucket index of tenant %s", tenant)
+		}
+
+		result := bucketIndexTenantResult{Tenant: tenant, Report: report}
+		if repair {
+			result.Actions, err = checker.Repair(ctx, report, bucketindex.RepairOptions{
+				DryRun:                    c.dryRun,
+				PartialBlockDeletionDelay: c.partialBlockDeletionDelay,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to repair the bucket index of tenant %s", tenant)
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	out, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+	return nil
+}
@@ -164,8 +164,17 @@ func (b *BucketValidationCommand) validate(_ *kingpin.ParseContext) error {
 }
 
 func (b *BucketValidationCommand) printBucketConfigHelp() {
+	printBucketConfigHelp(&b.cfg, "bucket-validation")
+}
+
+func (b *BucketValidationCommand) parseBucketConfig() error {
+	return parseBucketConfig(&b.cfg, b.bucketConfig)
+}
+
+// printBucketConfigHelp prints the help text of the arguments which may be passed to the --bucket-config flag of the command.
+func printBucketConfigHelp(cfg *bucket.Config, command string) {
 	fs := flag.NewFlagSet("bucket-config", flag.ContinueOnError)
-	b.cfg.RegisterFlags(fs)
+	cfg.RegisterFlags(fs)
 
 	fmt.Fprintf(fs.Output(), `
 The following help text describes the arguments
@@ -173,21 +182,22 @@ which may be specified in the string that gets
 passed to "-bucket-config".
 
 Example:
-mimirtool bucket-validation --bucket-config='-backend=s3 -s3.endpoint=localhost:9000 -s3.bucket-name=example-bucket'
+mimirtool %s --bucket-config='-backend=s3 -s3.endpoint=localhost:9000 -s3.bucket-name=example-bucket'
 
-`)
+`, command)
 	fs.Usage()
 }
 
-func (b *BucketValidationCommand) parseBucketConfig() error {
+// parseBucketConfig parses the arguments passed to the --bucket-config flag into cfg.
+func parseBucketConfig(cfg *bucket.Config, args string) error {
 	fs := flag.NewFlagSet("bucket-config", flag.ContinueOnError)
-	b.cfg.RegisterFlags(fs)
-	err := fs.Parse(strings.Split(b.bucketConfig, " "))
+	cfg.RegisterFlags(fs)
+	err := fs.Parse(strings.Split(args, " "))
 	if err != nil {
 		return err
 	}
 
-	return b.cfg.Validate()
+	return cfg.Validate()
 }
 
 func (b *BucketValidationCommand) report(phase string, completed int) {
@@ -114,6 +114,23 @@ func (f *BucketIndexBlocksFinder) GetBlocks(ctx context.Context, userID string,
 	return blocks, matchingDeletionMarks, nil
 }
 
+// GetTombstones implements BlocksFinder.
+func (f *BucketIndexBlocksFinder) GetTombstones(ctx context.Context, userID string) (bucketindex.Tombstones, error) {
+	if f.State() != services.Running {
+		return nil, errBucketIndexBlocksFinderNotRunning
+	}
+
+	idx, err := f.loader.GetIndex(ctx, userID)
+	if errors.Is(err, bucketindex.ErrIndexNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.Tombstones, nil
+}
+
 func newBucketIndexTooOldError(updatedAt time.Time, maxStalePeriod time.Duration) error {
 	return errors.New(globalerror.BucketIndexTooOld.Message(fmt.Sprintf("the bucket index is too old. It was last updated at %s, which exceeds the maximum allowed staleness period of %v", updatedAt.UTC().Format(time.RFC3339Nano), maxStalePeriod)))
 }
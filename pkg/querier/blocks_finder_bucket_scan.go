@@ -154,6 +154,12 @@ func (d *BucketScanBlocksFinder) GetBlocks(_ context.Context, userID string, min
 	return matchingMetas, matchingDeletionMarks, nil
 }
 
+// GetTombstones implements BlocksFinder. Series deletion tombstones are only tracked
+// in the bucket index, so this finder never returns any tombstone.
+func (d *BucketScanBlocksFinder) GetTombstones(context.Context, string) (bucketindex.Tombstones, error) {
+	return nil, nil
+}
+
 func (d *BucketScanBlocksFinder) starting(ctx context.Context) error {
 	// Before the service is in the running state it must have successfully
 	// complete the initial scan.
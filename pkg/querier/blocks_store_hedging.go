@@ -0,0 +1,255 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/grafana/mimir/pkg/storegateway/storegatewaypb"
+	"github.com/grafana/mimir/pkg/storegateway/storepb"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	// The number of latest Series requests latencies the hedging delay is computed from.
+	hedgingLatencySamples = 1000
+
+	// The minimum number of observed latencies before Series requests are hedged.
+	hedgingMinLatencySamples = 100
+
+	// The hedging delay is recomputed every time this number of latencies has been observed.
+	hedgingDelayUpdateInterval = 50
+)
+
+// storeSeriesResult holds the series received from a store-gateway by a single Series request.
+type storeSeriesResult struct {
+	client   BlocksStoreClient
+	blockIDs []ulid.ULID
+	stream   storegatewaypb.StoreGateway_SeriesClient
+
+	series            []*storepb.Series
+	streamingSeries   []*storepb.StreamingSeries
+	warnings          storage.Warnings
+	queriedBlocks     []ulid.ULID
+	indexBytesFetched uint64
+}
+
+// storeGatewayHedging tracks the latency of the Series requests to the store-gateways, and computes the delay
+// after which a request is hedged to another store-gateway.
+type storeGatewayHedging struct {
+	percentile float64
+	minDelay   time.Duration
+
+	mtx       sync.Mutex
+	latencies []time.Duration // Ring buffer of the latest observed latencies.
+	next      int
+	observed  int
+	delay     time.Duration
+}
+
+func newStoreGatewayHedging(percentile float64, minDelay time.Duration) *storeGatewayHedging {
+	return &storeGatewayHedging{
+		percentile: percentile,
+		minDelay:   minDelay,
+		latencies:  make([]time.Duration, 0, hedgingLatencySamples),
+	}
+}
+
+// observe records the latency of a Series request which completed successfully.
+func (h *storeGatewayHedging) observe(latency time.Duration) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if len(h.latencies) < hedgingLatencySamples {
+		h.latencies = append(h.latencies, latency)
+	} else {
+		h.latencies[h.next] = latency
+	}
+	h.next = (h.next + 1) % hedgingLatencySamples
+	h.observed++
+
+	if h.observed >= hedgingMinLatencySamples && (h.observed == hedgingMinLatencySamples || h.observed%hedgingDelayUpdateInterval == 0) {
+		sorted := make([]time.Duration, len(h.latencies))
+		copy(sorted, h.latencies)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		h.delay = sorted[int(h.percentile*float64(len(sorted)-1))]
+	}
+}
+
+// hedgingDelay returns the delay after which a Series request should be hedged, and false if not enough
+// latencies have been observed yet to compute it.
+func (h *storeGatewayHedging) hedgingDelay() (time.Duration, bool) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.observed < hedgingMinLatencySamples {
+		return 0, false
+	}
+	if h.delay < h.minDelay {
+		return h.minDelay, true
+	}
+	return h.delay, true
+}
+
+type hedgedSeriesAttempt struct {
+	results []*storeSeriesResult
+	err     error
+	hedged  bool
+}
+
+// fetchSeriesWithHedging fetches the series of the blocks from the store-gateway c and, if it doesn't respond
+// within the hedging delay, sends the same request to other store-gateways owning the blocks, preferring another zone.
+// The series of the request which completes first are returned, and the other request is canceled.
+// If a request fails while the other one is still in flight, the other one is waited for. No results are returned
+// if all the requests failed with an error which doesn't stop the query, so that the blocks are retried after the
+// consistency check, otherwise the last error is returned.
+func (q *blocksStoreQuerier) fetchSeriesWithHedging(ctx context.Context, log *spanlogger.SpanLogger, c BlocksStoreClient, blockIDs []ulid.ULID,
+	fetch func(ctx context.Context, c BlocksStoreClient, blockIDs []ulid.ULID) (*storeSeriesResult, error)) ([]*storeSeriesResult, error) {
+	// The context of the request which completes first isn't canceled when returning, because its
+	// stream is used to read the chunks later on. It's canceled once the query context is canceled.
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	hedgeCtx, cancelHedge := context.WithCancel(ctx)
+
+	var primaryWon, hedgeWon bool
+	defer func() {
+		if !primaryWon {
+			cancelPrimary()
+		}
+		if !hedgeWon {
+			cancelHedge()
+		}
+	}()
+
+	attempts := make(chan hedgedSeriesAttempt, 2)
+	go func() {
+		start := time.Now()
+		res, err := fetch(primaryCtx, c, blockIDs)
+		if err == nil && res != nil {
+			q.hedging.observe(time.Since(start))
+			attempts <- hedgedSeriesAttempt{results: []*storeSeriesResult{res}}
+			return
+		}
+		attempts <- hedgedSeriesAttempt{err: err}
+	}()
+
+	pending := 1
+	if delay, ok := q.hedging.hedgingDelay(); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case attempt := <-attempts:
+			// The request completed before the hedging delay.
+			primaryWon = attempt.err == nil
+			return attempt.results, attempt.err
+
+		case <-timer.C:
+			if q.hedgeSeries(hedgeCtx, log, c, blockIDs, fetch, attempts) {
+				pending++
+			}
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	var lastErr error
+	for {
+		attempt := <-attempts
+		pending--
+
+		if attempt.err != nil || len(attempt.results) == 0 {
+			if attempt.err != nil {
+				lastErr = attempt.err
+			}
+			if pending > 0 {
+				// The request failed, but the other one may still succeed.
+				continue
+			}
+			// All the requests failed: the last error, if any, is returned.
+			return nil, lastErr
+		}
+
+		if attempt.hedged {
+			hedgeWon = true
+			q.metrics.hedgedRequestsWon.Inc()
+		} else {
+			primaryWon = true
+		}
+		return attempt.results, nil
+	}
+}
+
+// hedgeSeries sends the Series request of the blocks to the store-gateways owning them other than c, and sends
+// the outcome to attempts once all the requests completed. It returns false if the request can't be hedged.
+func (q *blocksStoreQuerier) hedgeSeries(ctx context.Context, log *spanlogger.SpanLogger, c BlocksStoreClient, blockIDs []ulid.ULID,
+	fetch func(ctx context.Context, c BlocksStoreClient, blockIDs []ulid.ULID) (*storeSeriesResult, error), attempts chan<- hedgedSeriesAttempt) bool {
+	exclude := make(map[ulid.ULID][]string, len(blockIDs))
+	for _, id := range blockIDs {
+		exclude[id] = []string{c.RemoteAddress()}
+	}
+
+	clients, err := q.stores.GetClientsFor(q.userID, blockIDs, exclude)
+	if err != nil {
+		// There's no other store-gateway owning the blocks, for example because the replication factor is 1.
+		level.Debug(log).Log("msg", "unable to hedge series request to another store-gateway", "remote", c.RemoteAddress(), "err", err)
+		return false
+	}
+
+	level.Debug(log).Log("msg", "hedging series request to other store-gateways", "remote", c.RemoteAddress(), "hedged instances", len(clients))
+	q.metrics.hedgedRequests.Inc()
+
+	go func() {
+		var (
+			wg      sync.WaitGroup
+			mtx     sync.Mutex
+			attempt = hedgedSeriesAttempt{hedged: true}
+			failed  bool
+		)
+
+		for hedgeClient, hedgeBlockIDs := range clients {
+			hedgeClient := hedgeClient
+			hedgeBlockIDs := hedgeBlockIDs
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				start := time.Now()
+				res, err := fetch(ctx, hedgeClient, hedgeBlockIDs)
+
+				mtx.Lock()
+				defer mtx.Unlock()
+
+				switch {
+				case err != nil:
+					if attempt.err == nil {
+						attempt.err = err
+					}
+				case res == nil:
+					failed = true
+				default:
+					q.hedging.observe(time.Since(start))
+					attempt.results = append(attempt.results, res)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// The hedged request only succeeds if all the blocks have been fetched.
+		if failed && attempt.err == nil {
+			attempt.results = nil
+		}
+		attempts <- attempt
+	}()
+
+	return true
+}
@@ -0,0 +1,234 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/storegateway/storegatewaypb"
+	"github.com/grafana/mimir/pkg/storegateway/storepb"
+)
+
+func TestStoreGatewayHedging_HedgingDelay(t *testing.T) {
+	h := newStoreGatewayHedging(0.9, 50*time.Millisecond)
+
+	// Not enough latencies have been observed yet.
+	for i := 1; i < hedgingMinLatencySamples; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	_, ok := h.hedgingDelay()
+	assert.False(t, ok)
+
+	h.observe(hedgingMinLatencySamples * time.Millisecond)
+	delay, ok := h.hedgingDelay()
+	assert.True(t, ok)
+	assert.Equal(t, 90*time.Millisecond, delay)
+
+	// The delay is not lower than the minimum delay.
+	h = newStoreGatewayHedging(0.9, 500*time.Millisecond)
+	for i := 1; i <= hedgingMinLatencySamples; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	delay, ok = h.hedgingDelay()
+	assert.True(t, ok)
+	assert.Equal(t, 500*time.Millisecond, delay)
+
+	// Only the latest latencies are considered.
+	for i := 0; i < hedgingLatencySamples; i++ {
+		h.observe(time.Second)
+	}
+	delay, ok = h.hedgingDelay()
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, delay)
+}
+
+func TestBlocksStoreQuerier_SelectWithHedging(t *testing.T) {
+	const (
+		metricName = "test_metric"
+		minT       = int64(10)
+		maxT       = int64(20)
+	)
+
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+	series1 := labels.FromStrings(labels.MetricName, metricName, "series", "1")
+	series2 := labels.FromStrings(labels.MetricName, metricName, "series", "2")
+
+	newClient := func(addr string, delay time.Duration, series labels.Labels, blockIDs ...ulid.ULID) *delayedStoreGatewayClientMock {
+		return &delayedStoreGatewayClientMock{
+			storeGatewayClientMock: storeGatewayClientMock{remoteAddr: addr, mockedSeriesResponses: generateStreamingResponses([]*storepb.SeriesResponse{
+				mockSeriesResponse(series, minT, 1),
+				mockHintsResponse(blockIDs...),
+			})},
+			delay: delay,
+		}
+	}
+
+	tests := map[string]struct {
+		primary         *delayedStoreGatewayClientMock
+		hedgeResponse   interface{}
+		expectedSeries  []labels.Labels
+		expectedHedged  int
+		expectedWon     int
+		primaryCanceled bool
+	}{
+		"the store-gateway responds before the hedging delay": {
+			primary:        newClient("1.1.1.1", 0, series1, block1, block2),
+			expectedSeries: []labels.Labels{series1},
+		},
+		"the store-gateway is slow and the hedged request completes first": {
+			primary: newClient("1.1.1.1", 10*time.Second, series1, block1, block2),
+			hedgeResponse: map[BlocksStoreClient][]ulid.ULID{
+				newClient("2.2.2.2", 0, series2, block1, block2): {block1, block2},
+			},
+			expectedSeries:  []labels.Labels{series2},
+			expectedHedged:  1,
+			expectedWon:     1,
+			primaryCanceled: true,
+		},
+		"the store-gateway is slow and the blocks are hedged to multiple store-gateways": {
+			primary: newClient("1.1.1.1", 10*time.Second, series1, block1, block2),
+			hedgeResponse: map[BlocksStoreClient][]ulid.ULID{
+				newClient("2.2.2.2", 0, series1, block1): {block1},
+				newClient("3.3.3.3", 0, series2, block2): {block2},
+			},
+			expectedSeries:  []labels.Labels{series1, series2},
+			expectedHedged:  1,
+			expectedWon:     1,
+			primaryCanceled: true,
+		},
+		"the store-gateway is slow but there's no other store-gateway owning the blocks": {
+			primary:        newClient("1.1.1.1", 500*time.Millisecond, series1, block1, block2),
+			hedgeResponse:  errors.New("no store-gateway instance left after checking exclude"),
+			expectedSeries: []labels.Labels{series1},
+		},
+		"the store-gateway is slow and the hedged request is slower": {
+			primary: newClient("1.1.1.1", 500*time.Millisecond, series1, block1, block2),
+			hedgeResponse: map[BlocksStoreClient][]ulid.ULID{
+				newClient("2.2.2.2", 10*time.Second, series2, block1, block2): {block1, block2},
+			},
+			expectedSeries: []labels.Labels{series1},
+			expectedHedged: 1,
+		},
+		"the store-gateway is slow and the hedged request fails": {
+			primary: newClient("1.1.1.1", 500*time.Millisecond, series1, block1, block2),
+			hedgeResponse: map[BlocksStoreClient][]ulid.ULID{
+				&delayedStoreGatewayClientMock{storeGatewayClientMock: storeGatewayClientMock{
+					remoteAddr:      "2.2.2.2",
+					mockedSeriesErr: status.Error(http.StatusUnprocessableEntity, "limit exceeded"),
+				}}: {block1, block2},
+			},
+			expectedSeries: []labels.Labels{series1},
+			expectedHedged: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			storeSetResponses := []interface{}{map[BlocksStoreClient][]ulid.ULID{testData.primary: {block1, block2}}}
+			if testData.hedgeResponse != nil {
+				storeSetResponses = append(storeSetResponses, testData.hedgeResponse)
+			}
+
+			finder := &blocksFinderMock{}
+			finder.On("GetBlocks", mock.Anything, "user-1", minT, maxT).Return(bucketindex.Blocks{
+				&bucketindex.Block{ID: block1},
+				&bucketindex.Block{ID: block2},
+			}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), nil)
+
+			// The hedging delay is the minimum delay.
+			hedging := newStoreGatewayHedging(0.9, 100*time.Millisecond)
+			for i := 0; i < hedgingMinLatencySamples; i++ {
+				hedging.observe(time.Millisecond)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			reg := prometheus.NewPedanticRegistry()
+			q := &blocksStoreQuerier{
+				ctx:                      ctx,
+				minT:                     minT,
+				maxT:                     maxT,
+				userID:                   "user-1",
+				finder:                   finder,
+				stores:                   &blocksStoreSetMock{mockedResponses: storeSetResponses},
+				consistency:              NewBlocksConsistencyChecker(0, 0, log.NewNopLogger(), nil),
+				logger:                   log.NewNopLogger(),
+				metrics:                  newBlocksStoreQueryableMetrics(reg),
+				limits:                   &blocksStoreLimitsMock{},
+				streamingChunksBatchSize: 1,
+				hedging:                  hedging,
+			}
+
+			set := q.Select(true, &storage.SelectHints{Start: minT, End: maxT}, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, metricName))
+
+			var actualSeries []labels.Labels
+			var it chunkenc.Iterator
+			for set.Next() {
+				actualSeries = append(actualSeries, set.At().Labels())
+
+				it = set.At().Iterator(it)
+				for it.Next() != chunkenc.ValNone { // nolint
+				}
+				require.NoError(t, it.Err())
+			}
+			require.NoError(t, set.Err())
+			assert.Equal(t, testData.expectedSeries, actualSeries)
+			if testData.primaryCanceled {
+				// The request which completed last is canceled asynchronously.
+				assert.Eventually(t, testData.primary.canceled.Load, time.Second, 10*time.Millisecond)
+			} else {
+				assert.False(t, testData.primary.canceled.Load())
+			}
+
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_querier_storegateway_hedged_requests_total Number of series requests to store-gateways which have been hedged to other store-gateways owning the same blocks.
+				# TYPE cortex_querier_storegateway_hedged_requests_total counter
+				cortex_querier_storegateway_hedged_requests_total `+strconv.Itoa(testData.expectedHedged)+`
+				# HELP cortex_querier_storegateway_hedged_requests_won_total Number of hedged series requests to store-gateways which completed before the original request.
+				# TYPE cortex_querier_storegateway_hedged_requests_won_total counter
+				cortex_querier_storegateway_hedged_requests_won_total `+strconv.Itoa(testData.expectedWon)+`
+			`), "cortex_querier_storegateway_hedged_requests_total", "cortex_querier_storegateway_hedged_requests_won_total"))
+		})
+	}
+}
+
+// delayedStoreGatewayClientMock is a storeGatewayClientMock which waits for the delay before opening the Series stream.
+type delayedStoreGatewayClientMock struct {
+	storeGatewayClientMock
+
+	delay    time.Duration
+	canceled atomic.Bool
+}
+
+func (m *delayedStoreGatewayClientMock) Series(ctx context.Context, req *storepb.SeriesRequest, opts ...grpc.CallOption) (storegatewaypb.StoreGateway_SeriesClient, error) {
+	select {
+	case <-time.After(m.delay):
+		return m.storeGatewayClientMock.Series(ctx, req, opts...)
+	case <-ctx.Done():
+		m.canceled.Store(true)
+		return nil, ctx.Err()
+	}
+}
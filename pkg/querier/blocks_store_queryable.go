@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +27,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/thanos-io/objstore"
@@ -34,6 +36,7 @@ import (
 	grpc_metadata "google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/grafana/mimir/pkg/mimirpb"
 	"github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/storage/bucket"
 	"github.com/grafana/mimir/pkg/storage/series"
@@ -41,6 +44,7 @@ import (
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/storage/tsdb/downsample"
 	"github.com/grafana/mimir/pkg/storegateway"
 	"github.com/grafana/mimir/pkg/storegateway/hintspb"
 	"github.com/grafana/mimir/pkg/storegateway/storegatewaypb"
@@ -78,6 +82,9 @@ type BlocksFinder interface {
 	// GetBlocks returns known blocks for userID containing samples within the range minT
 	// and maxT (milliseconds, both included). Returned blocks are sorted by MaxTime descending.
 	GetBlocks(ctx context.Context, userID string, minT, maxT int64) (bucketindex.Blocks, map[ulid.ULID]*bucketindex.BlockDeletionMark, error)
+
+	// TombstonesLoader returns the pending series deletion tombstones for userID.
+	TombstonesLoader
 }
 
 // BlocksStoreClient is the interface that should be implemented by any client used
@@ -97,6 +104,7 @@ type BlocksStoreLimits interface {
 	MaxLabelsQueryLength(userID string) time.Duration
 	MaxChunksPerQuery(userID string) int
 	StoreGatewayTenantShardSize(userID string) int
+	CompactorBlocksRetentionRules(userID string) validation.RetentionRules
 }
 
 type blocksStoreQueryableMetrics struct {
@@ -106,6 +114,9 @@ type blocksStoreQueryableMetrics struct {
 	blocksFound                                       prometheus.Counter
 	blocksQueried                                     prometheus.Counter
 	blocksWithCompactorShardButIncompatibleQueryShard prometheus.Counter
+
+	hedgedRequests    prometheus.Counter
+	hedgedRequestsWon prometheus.Counter
 }
 
 func newBlocksStoreQueryableMetrics(reg prometheus.Registerer) *blocksStoreQueryableMetrics {
@@ -135,6 +146,14 @@ func newBlocksStoreQueryableMetrics(reg prometheus.Registerer) *blocksStoreQuery
 			Name: "cortex_querier_blocks_with_compactor_shard_but_incompatible_query_shard_total",
 			Help: "Blocks that couldn't be checked for query and compactor sharding optimization due to incompatible shard counts.",
 		}),
+		hedgedRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_querier_storegateway_hedged_requests_total",
+			Help: "Number of series requests to store-gateways which have been hedged to other store-gateways owning the same blocks.",
+		}),
+		hedgedRequestsWon: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_querier_storegateway_hedged_requests_won_total",
+			Help: "Number of hedged series requests to store-gateways which completed before the original request.",
+		}),
 	}
 }
 
@@ -145,12 +164,15 @@ type BlocksStoreQueryable struct {
 
 	stores                   BlocksStoreSet
 	finder                   BlocksFinder
+	tombstones               TombstonesLoader
 	consistency              *BlocksConsistencyChecker
 	logger                   log.Logger
 	queryStoreAfter          time.Duration
 	metrics                  *blocksStoreQueryableMetrics
 	limits                   BlocksStoreLimits
 	streamingChunksBatchSize uint64
+	lookbackDelta            time.Duration
+	hedging                  *storeGatewayHedging
 
 	// Subservices manager.
 	subservices        *services.Manager
@@ -164,6 +186,9 @@ func NewBlocksStoreQueryable(
 	limits BlocksStoreLimits,
 	queryStoreAfter time.Duration,
 	streamingChunksBatchSize uint64,
+	lookbackDelta time.Duration,
+	hedgingPercentile float64,
+	hedgingMinDelay time.Duration,
 	logger log.Logger,
 	reg prometheus.Registerer,
 ) (*BlocksStoreQueryable, error) {
@@ -175,6 +200,7 @@ func NewBlocksStoreQueryable(
 	q := &BlocksStoreQueryable{
 		stores:                   stores,
 		finder:                   finder,
+		tombstones:               &retentionTombstonesLoader{next: finder, limits: limits},
 		consistency:              consistency,
 		queryStoreAfter:          queryStoreAfter,
 		logger:                   logger,
@@ -183,6 +209,11 @@ func NewBlocksStoreQueryable(
 		metrics:                  newBlocksStoreQueryableMetrics(reg),
 		limits:                   limits,
 		streamingChunksBatchSize: streamingChunksBatchSize,
+		lookbackDelta:            lookbackDelta,
+	}
+
+	if hedgingPercentile > 0 {
+		q.hedging = newStoreGatewayHedging(hedgingPercentile, hedgingMinDelay)
 	}
 
 	q.Service = services.NewBasicService(q.starting, q.running, q.stopping)
@@ -269,7 +300,7 @@ func NewBlocksStoreQueryableFromConfig(querierCfg Config, gatewayCfg storegatewa
 		streamingBufferSize = 0
 	}
 
-	return NewBlocksStoreQueryable(stores, finder, consistency, limits, querierCfg.QueryStoreAfter, streamingBufferSize, logger, reg)
+	return NewBlocksStoreQueryable(stores, finder, consistency, limits, querierCfg.QueryStoreAfter, streamingBufferSize, querierCfg.EngineConfig.LookbackDelta, querierCfg.StoreGatewayHedgingPercentile, querierCfg.StoreGatewayHedgingMinDelay, logger, reg)
 }
 
 func (q *BlocksStoreQueryable) starting(ctx context.Context) error {
@@ -308,27 +339,58 @@ func (q *BlocksStoreQueryable) Querier(ctx context.Context, mint, maxt int64) (s
 		return nil, err
 	}
 
+	return q.newQuerier(ctx, userID, mint, maxt), nil
+}
+
+func (q *BlocksStoreQueryable) newQuerier(ctx context.Context, userID string, mint, maxt int64) *blocksStoreQuerier {
 	return &blocksStoreQuerier{
 		ctx:                      ctx,
 		minT:                     mint,
 		maxT:                     maxt,
 		userID:                   userID,
 		finder:                   q.finder,
+		tombstones:               q.tombstones,
 		stores:                   q.stores,
 		metrics:                  q.metrics,
 		limits:                   q.limits,
 		streamingChunksBatchSize: q.streamingChunksBatchSize,
+		lookbackDelta:            q.lookbackDelta,
+		hedging:                  q.hedging,
 		consistency:              q.consistency,
 		logger:                   q.logger,
 		queryStoreAfter:          q.queryStoreAfter,
+	}
+}
+
+// ExemplarQuerier returns a new storage.ExemplarQuerier querying the exemplars stored in the blocks.
+func (q *BlocksStoreQueryable) ExemplarQuerier(ctx context.Context) (storage.ExemplarQuerier, error) {
+	if s := q.State(); s != services.Running {
+		return nil, errors.Errorf("BlocksStoreQueryable is not running: %v", s)
+	}
+
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blocksStoreExemplarQuerier{
+		ctx:       ctx,
+		userID:    userID,
+		queryable: q,
 	}, nil
 }
 
+// GetTombstones implements TombstonesLoader.
+func (q *BlocksStoreQueryable) GetTombstones(ctx context.Context, userID string) (bucketindex.Tombstones, error) {
+	return q.tombstones.GetTombstones(ctx, userID)
+}
+
 type blocksStoreQuerier struct {
 	ctx                      context.Context
 	minT, maxT               int64
 	userID                   string
 	finder                   BlocksFinder
+	tombstones               TombstonesLoader
 	stores                   BlocksStoreSet
 	metrics                  *blocksStoreQueryableMetrics
 	consistency              *BlocksConsistencyChecker
@@ -336,9 +398,15 @@ type blocksStoreQuerier struct {
 	streamingChunksBatchSize uint64
 	logger                   log.Logger
 
+	// The lookback delta of the PromQL engine, used to select the resolution of the blocks to query.
+	lookbackDelta time.Duration
+
 	// If set, the querier manipulates the max time to not be greater than
 	// "now - queryStoreAfter" so that most recent blocks are not queried.
 	queryStoreAfter time.Duration
+
+	// If set, the series requests to store-gateways are hedged.
+	hedging *storeGatewayHedging
 }
 
 // Select implements storage.Querier interface.
@@ -381,7 +449,8 @@ func (q *blocksStoreQuerier) LabelNames(matchers ...*labels.Matcher) ([]string,
 		return queriedBlocks, nil
 	}
 
-	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, nil, queryFunc)
+	// Labels are the same in blocks of any resolution, so raw blocks are preferred.
+	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, nil, downsample.ResLevel0, downsample.AggrAvg, queryFunc)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -422,7 +491,8 @@ func (q *blocksStoreQuerier) LabelValues(name string, matchers ...*labels.Matche
 		return queriedBlocks, nil
 	}
 
-	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, nil, queryFunc)
+	// Labels are the same in blocks of any resolution, so raw blocks are preferred.
+	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, nil, downsample.ResLevel0, downsample.AggrAvg, queryFunc)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -434,6 +504,53 @@ func (q *blocksStoreQuerier) Close() error {
 	return nil
 }
 
+// selectExemplars returns the exemplars stored in the blocks, of the series matching at least one of the sets of matchers.
+func (q *blocksStoreQuerier) selectExemplars(matchers ...[]*labels.Matcher) ([]exemplar.QueryResult, error) {
+	spanLog, spanCtx := spanlogger.NewWithLogger(q.ctx, q.logger, "blocksStoreQuerier.selectExemplars")
+	defer spanLog.Span.Finish()
+
+	level.Debug(spanLog).Log("start", util.TimeFromMillis(q.minT).UTC().String(), "end",
+		util.TimeFromMillis(q.maxT).UTC().String(), "matchers", util.MultiMatchersStringer(matchers))
+
+	var (
+		resSets           [][]exemplar.QueryResult
+		convertedMatchers = make([]storepb.LabelMatchers, 0, len(matchers))
+	)
+	for _, ms := range matchers {
+		convertedMatchers = append(convertedMatchers, storepb.LabelMatchers{Matchers: convertMatchersToLabelMatcher(ms)})
+	}
+
+	queryFunc := func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error) {
+		sets, queriedBlocks, err := q.fetchExemplarsFromStore(spanCtx, clients, minT, maxT, convertedMatchers)
+		if err != nil {
+			return nil, err
+		}
+
+		resSets = append(resSets, sets...)
+		return queriedBlocks, nil
+	}
+
+	// Exemplars are only stored in raw blocks.
+	err := q.queryWithConsistencyCheck(spanCtx, spanLog, q.minT, q.maxT, nil, downsample.ResLevel0, downsample.AggrAvg, queryFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	return block.MergeExemplars(resSets...), nil
+}
+
+// blocksStoreExemplarQuerier is a storage.ExemplarQuerier querying the exemplars stored in the blocks.
+type blocksStoreExemplarQuerier struct {
+	ctx       context.Context
+	userID    string
+	queryable *BlocksStoreQueryable
+}
+
+// Select implements storage.ExemplarQuerier. Both start and end are inclusive.
+func (q *blocksStoreExemplarQuerier) Select(start, end int64, matchers ...[]*labels.Matcher) ([]exemplar.QueryResult, error) {
+	return q.queryable.newQuerier(q.ctx, q.userID, start, end).selectExemplars(matchers...)
+}
+
 func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
 	spanLog, spanCtx := spanlogger.NewWithLogger(q.ctx, q.logger, "blocksStoreQuerier.selectSorted")
 	defer spanLog.Span.Finish()
@@ -468,7 +585,18 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 		return queriedBlocks, nil
 	}
 
-	err = q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, shard, queryFunc)
+	// Read the coarsest resolution which satisfies the query, if the blocks have been downsampled.
+	maxResolution := downsample.MaxResolution(sp, q.lookbackDelta)
+	// The functions which can't be evaluated on downsampled data read the average value of each resolution
+	// window only for the time ranges not covered by raw blocks.
+	aggregate := downsample.AggrAvg
+	if sp != nil {
+		if aggr, ok := downsample.AggregateForFunc(sp.Func); ok {
+			aggregate = aggr
+		}
+	}
+
+	err = q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, shard, maxResolution, aggregate, queryFunc)
 	if err != nil {
 		return storage.ErrSeriesSet(err)
 	}
@@ -500,11 +628,11 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 	}
 
 	return series.NewSeriesSetWithWarnings(
-		storage.NewMergeSeriesSet(resSeriesSets, storage.ChainedSeriesMerge),
+		maskDeletedSeries(spanCtx, q.tombstones, q.userID, minT, maxT, storage.NewMergeSeriesSet(resSeriesSets, storage.ChainedSeriesMerge)),
 		resWarnings)
 }
 
-func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logger log.Logger, minT, maxT int64, shard *sharding.ShardSelector,
+func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logger log.Logger, minT, maxT int64, shard *sharding.ShardSelector, maxResolution int64, aggregate string,
 	queryFunc func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error)) error {
 	// If queryStoreAfter is enabled, we do manipulate the query maxt to query samples up until
 	// now - queryStoreAfter, because the most recent time range is covered by ingesters. This
@@ -540,6 +668,11 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logg
 
 	q.metrics.blocksFound.Add(float64(len(knownBlocks)))
 
+	if result := selectBlocksForResolution(knownBlocks, maxResolution, aggregate); len(result) != len(knownBlocks) {
+		level.Debug(logger).Log("msg", "filtered blocks by resolution", "before", len(knownBlocks), "after", len(result), "max_resolution", downsample.ResolutionString(maxResolution), "aggregate", aggregate)
+		knownBlocks = result
+	}
+
 	if shard != nil && shard.ShardCount > 0 {
 		level.Debug(logger).Log("msg", "filtering blocks due to sharding", "blocksBeforeFiltering", knownBlocks.String(), "shardID", shard.LabelValue())
 
@@ -582,7 +715,9 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logg
 
 		// Fetch series from stores. If an error occur we do not retry because retries
 		// are only meant to cover missing blocks.
+		queryStart := time.Now()
 		queriedBlocks, err := queryFunc(clients, minT, maxT)
+		stats.FromContext(ctx).AddStoreGatewayTime(time.Since(queryStart))
 		if err != nil {
 			return err
 		}
@@ -623,6 +758,116 @@ func newStoreConsistencyCheckFailedError(remainingBlocks []ulid.ULID) error {
 	return fmt.Errorf("%v. The failed blocks are: %s", globalerror.StoreConsistencyCheckFailed.Message("failed to fetch some blocks"), strings.Join(convertULIDsToString(remainingBlocks), " "))
 }
 
+// selectBlocksForResolution returns the blocks to query to read the data at the coarsest resolution up to maxResolution.
+// A raw block is replaced by the coarsest of the blocks downsampled from it up to maxResolution, for the input aggregate.
+// Since downsampled blocks are matched by their raw block ID, a raw block replacing a downsampled one (e.g. after merging
+// out-of-order samples into it) is queried until the compactor downsamples it again. The downsampled blocks whose raw
+// block is not in the input blocks, for example because of a shorter retention of the raw blocks, are only selected for
+// the time ranges not covered by any other block, preferring the coarsest resolution up to maxResolution and then the
+// finest coarser one.
+//
+// The order of the input blocks is preserved.
+func selectBlocksForResolution(blocks bucketindex.Blocks, maxResolution int64, aggregate string) bucketindex.Blocks {
+	hasDownsampled := false
+	for _, b := range blocks {
+		if b.Resolution != downsample.ResLevel0 {
+			hasDownsampled = true
+			break
+		}
+	}
+	if !hasDownsampled {
+		return blocks
+	}
+
+	raw := map[ulid.ULID]struct{}{}
+	for _, b := range blocks {
+		if b.Resolution == downsample.ResLevel0 {
+			raw[b.ID] = struct{}{}
+		}
+	}
+
+	// The downsampled block replacing each raw block, and the downsampled blocks whose raw block is not queried.
+	replacements := map[ulid.ULID]*bucketindex.Block{}
+	var orphans bucketindex.Blocks
+	for _, b := range blocks {
+		if b.Resolution == downsample.ResLevel0 || b.Aggregate != aggregate {
+			continue
+		}
+		from := downsampledFrom(b)
+		if _, ok := raw[from]; !ok {
+			orphans = append(orphans, b)
+			continue
+		}
+		if b.Resolution > maxResolution {
+			continue
+		}
+		if r, ok := replacements[from]; !ok || r.Resolution < b.Resolution {
+			replacements[from] = b
+		}
+	}
+
+	isSelected := make(map[ulid.ULID]struct{}, len(raw)+len(orphans))
+	selected := make(bucketindex.Blocks, 0, len(raw)+len(orphans))
+	for _, b := range blocks {
+		if b.Resolution != downsample.ResLevel0 {
+			continue
+		}
+		if r, ok := replacements[b.ID]; ok {
+			b = r
+		}
+		isSelected[b.ID] = struct{}{}
+		selected = append(selected, b)
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		return resolutionPreference(orphans[i].Resolution, maxResolution) < resolutionPreference(orphans[j].Resolution, maxResolution)
+	})
+	for _, b := range orphans {
+		if !isBlockCoveredBy(b, selected) {
+			isSelected[b.ID] = struct{}{}
+			selected = append(selected, b)
+		}
+	}
+
+	result := make(bucketindex.Blocks, 0, len(selected))
+	for _, b := range blocks {
+		if _, ok := isSelected[b.ID]; ok {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
+// downsampledFrom returns the ID of the raw block the input block has been downsampled from, or the zero ULID if unknown.
+func downsampledFrom(b *bucketindex.Block) ulid.ULID {
+	if b.DownsampledFrom == nil {
+		return ulid.ULID{}
+	}
+	return *b.DownsampledFrom
+}
+
+// resolutionPreference returns a value which sorts the resolutions from the coarsest to the finest up to maxResolution,
+// followed by the coarser ones from the finest to the coarsest.
+func resolutionPreference(resolution, maxResolution int64) int64 {
+	if resolution <= maxResolution {
+		return -resolution
+	}
+	return resolution
+}
+
+// isBlockCoveredBy returns whether any of the input blocks contains all the series and time range of b.
+func isBlockCoveredBy(b *bucketindex.Block, others bucketindex.Blocks) bool {
+	for _, o := range others {
+		if o.MinTime > b.MinTime || o.MaxTime < b.MaxTime {
+			continue
+		}
+		if o.CompactorShardID == "" || o.CompactorShardID == b.CompactorShardID {
+			return true
+		}
+	}
+	return false
+}
+
 // filterBlocksByShard removes blocks that can be safely ignored when using query sharding.
 // We know that block can be safely ignored, if it was compacted using split-and-merge
 // compactor, and it has a valid compactor shard ID. We exploit the fact that split-and-merge
@@ -732,170 +977,196 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(ctx context.Context, sp *stor
 		streams       []storegatewaypb.StoreGateway_SeriesClient
 	)
 
-	// Concurrently fetch series from all clients.
-	for c, blockIDs := range clients {
-		// Change variables scope since it will be used in a goroutine.
-		c := c
-		blockIDs := blockIDs
+	// See: https://github.com/prometheus/prometheus/pull/8050
+	// TODO(goutham): we should ideally be passing the hints down to the storage layer
+	// and let the TSDB return us data with no chunks as in prometheus#8050.
+	// But this is an acceptable workaround for now.
+	skipChunks := sp != nil && sp.Func == "series"
 
-		g.Go(func() error {
-			log, reqCtx := spanlogger.NewWithLogger(reqCtx, spanLog, "blocksStoreQuerier.fetchSeriesFromStores")
-			defer log.Span.Finish()
-			log.Span.SetTag("store_gateway_address", c.RemoteAddress())
+	// fetchSeries fetches the series of the blocks from a single store-gateway. It returns a nil result
+	// if the store-gateway failed with an error which doesn't stop the query, so that the blocks are retried.
+	fetchSeries := func(ctx context.Context, log *spanlogger.SpanLogger, c BlocksStoreClient, blockIDs []ulid.ULID) (*storeSeriesResult, error) {
+		req, err := createSeriesRequest(minT, maxT, convertedMatchers, skipChunks, blockIDs, q.streamingChunksBatchSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create series request")
+		}
 
-			// See: https://github.com/prometheus/prometheus/pull/8050
-			// TODO(goutham): we should ideally be passing the hints down to the storage layer
-			// and let the TSDB return us data with no chunks as in prometheus#8050.
-			// But this is an acceptable workaround for now.
-			skipChunks := sp != nil && sp.Func == "series"
+		stream, err := c.Series(ctx, req)
+		if err == nil {
+			mtx.Lock()
+			streams = append(streams, stream)
+			mtx.Unlock()
+			err = gCtx.Err()
+		}
+		if err != nil {
+			if shouldStopQueryFunc(err) {
+				return nil, err
+			}
 
-			req, err := createSeriesRequest(minT, maxT, convertedMatchers, skipChunks, blockIDs, q.streamingChunksBatchSize)
-			if err != nil {
-				return errors.Wrapf(err, "failed to create series request")
+			level.Warn(log).Log("msg", "failed to fetch series", "remote", c.RemoteAddress(), "err", err)
+			return nil, nil
+		}
+
+		// A storegateway client will only fill either of series or streamingSeries, and not both.
+		res := &storeSeriesResult{client: c, blockIDs: blockIDs, stream: stream}
+
+		for {
+			// Ensure the context hasn't been canceled in the meanwhile (eg. an error occurred
+			// in another goroutine).
+			if gCtx.Err() != nil {
+				return nil, gCtx.Err()
 			}
 
-			stream, err := c.Series(reqCtx, req)
-			if err == nil {
-				mtx.Lock()
-				streams = append(streams, stream)
-				mtx.Unlock()
-				err = gCtx.Err()
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
 			}
 			if err != nil {
 				if shouldStopQueryFunc(err) {
-					return err
+					return nil, err
 				}
 
-				level.Warn(log).Log("msg", "failed to fetch series", "remote", c.RemoteAddress(), "err", err)
-				return nil
+				level.Warn(log).Log("msg", "failed to receive series", "remote", c.RemoteAddress(), "err", err)
+				return nil, nil
 			}
 
-			// A storegateway client will only fill either of mySeries or myStreamingSeries, and not both.
-			mySeries := []*storepb.Series(nil)
-			myStreamingSeries := []*storepb.StreamingSeries(nil)
-			myWarnings := storage.Warnings(nil)
-			myQueriedBlocks := []ulid.ULID(nil)
-			indexBytesFetched := uint64(0)
+			// Response may either contain series, streaming series, warning or hints.
+			if s := resp.GetSeries(); s != nil {
+				res.series = append(res.series, s)
 
-			for {
-				// Ensure the context hasn't been canceled in the meanwhile (eg. an error occurred
-				// in another goroutine).
-				if gCtx.Err() != nil {
-					return gCtx.Err()
+				// Add series fingerprint to query limiter; will return error if we are over the limit
+				if err := queryLimiter.AddSeries(s.Labels); err != nil {
+					return nil, err
 				}
 
-				resp, err := stream.Recv()
-				if errors.Is(err, io.EOF) {
-					break
+				chunksCount, chunksSize := countChunksAndBytes(s)
+				if err := queryLimiter.AddChunkBytes(chunksSize); err != nil {
+					return nil, err
 				}
-				if err != nil {
-					if shouldStopQueryFunc(err) {
-						return err
-					}
+				if err := queryLimiter.AddChunks(chunksCount); err != nil {
+					return nil, err
+				}
+				if err := queryLimiter.AddEstimatedChunks(chunksCount); err != nil {
+					return nil, err
+				}
+			}
 
-					level.Warn(log).Log("msg", "failed to receive series", "remote", c.RemoteAddress(), "err", err)
-					return nil
+			if w := resp.GetWarning(); w != "" {
+				res.warnings = append(res.warnings, errors.New(w))
+			}
+
+			if h := resp.GetHints(); h != nil {
+				hints := hintspb.SeriesResponseHints{}
+				if err := types.UnmarshalAny(h, &hints); err != nil {
+					return nil, errors.Wrapf(err, "failed to unmarshal series hints from %s", c.RemoteAddress())
 				}
 
-				// Response may either contain series, streaming series, warning or hints.
-				if s := resp.GetSeries(); s != nil {
-					mySeries = append(mySeries, s)
+				ids, err := convertBlockHintsToULIDs(hints.QueriedBlocks)
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to parse queried block IDs from received hints")
+				}
 
-					// Add series fingerprint to query limiter; will return error if we are over the limit
-					if err := queryLimiter.AddSeries(s.Labels); err != nil {
-						return err
-					}
+				res.queriedBlocks = append(res.queriedBlocks, ids...)
+			}
 
-					chunksCount, chunksSize := countChunksAndBytes(s)
-					if err := queryLimiter.AddChunkBytes(chunksSize); err != nil {
-						return err
-					}
-					if err := queryLimiter.AddChunks(chunksCount); err != nil {
-						return err
-					}
-					if err := queryLimiter.AddEstimatedChunks(chunksCount); err != nil {
-						return err
+			if s := resp.GetStats(); s != nil {
+				res.indexBytesFetched += s.FetchedIndexBytes
+			}
+
+			if ss := resp.GetStreamingSeries(); ss != nil {
+				for _, s := range ss.Series {
+					// Add series fingerprint to query limiter; will return error if we are over the limit
+					limitErr := queryLimiter.AddSeries(s.Labels)
+					if limitErr != nil {
+						return nil, validation.LimitError(limitErr.Error())
 					}
 				}
-
-				if w := resp.GetWarning(); w != "" {
-					myWarnings = append(myWarnings, errors.New(w))
+				res.streamingSeries = append(res.streamingSeries, ss.Series...)
+				if ss.IsEndOfSeriesStream {
+					// We expect "end of stream" to be sent after the hints and the stats have been sent.
+					break
 				}
+			}
+		}
 
-				if h := resp.GetHints(); h != nil {
-					hints := hintspb.SeriesResponseHints{}
-					if err := types.UnmarshalAny(h, &hints); err != nil {
-						return errors.Wrapf(err, "failed to unmarshal series hints from %s", c.RemoteAddress())
-					}
+		return res, nil
+	}
 
-					ids, err := convertBlockHintsToULIDs(hints.QueriedBlocks)
-					if err != nil {
-						return errors.Wrapf(err, "failed to parse queried block IDs from received hints")
-					}
+	// Concurrently fetch series from all clients.
+	for c, blockIDs := range clients {
+		// Change variables scope since it will be used in a goroutine.
+		c := c
+		blockIDs := blockIDs
 
-					myQueriedBlocks = append(myQueriedBlocks, ids...)
-				}
+		g.Go(func() error {
+			log, reqCtx := spanlogger.NewWithLogger(reqCtx, spanLog, "blocksStoreQuerier.fetchSeriesFromStores")
+			defer log.Span.Finish()
+			log.Span.SetTag("store_gateway_address", c.RemoteAddress())
 
-				if s := resp.GetStats(); s != nil {
-					indexBytesFetched += s.FetchedIndexBytes
-				}
+			var results []*storeSeriesResult
 
-				if ss := resp.GetStreamingSeries(); ss != nil {
-					for _, s := range ss.Series {
-						// Add series fingerprint to query limiter; will return error if we are over the limit
-						limitErr := queryLimiter.AddSeries(s.Labels)
-						if limitErr != nil {
-							return validation.LimitError(limitErr.Error())
-						}
-					}
-					myStreamingSeries = append(myStreamingSeries, ss.Series...)
-					if ss.IsEndOfSeriesStream {
-						// We expect "end of stream" to be sent after the hints and the stats have been sent.
-						break
-					}
+			// Hedging is only supported when streaming chunks, because the chunks are accounted in the
+			// query limiter only once the series of the store-gateway which responded first are read.
+			if q.hedging != nil && q.streamingChunksBatchSize > 0 {
+				var err error
+				results, err = q.fetchSeriesWithHedging(reqCtx, log, c, blockIDs, func(ctx context.Context, c BlocksStoreClient, blockIDs []ulid.ULID) (*storeSeriesResult, error) {
+					return fetchSeries(ctx, log, c, blockIDs)
+				})
+				if err != nil {
+					return err
+				}
+			} else {
+				res, err := fetchSeries(reqCtx, log, c, blockIDs)
+				if err != nil {
+					return err
+				}
+				if res != nil {
+					results = append(results, res)
 				}
 			}
 
-			reqStats.AddFetchedIndexBytes(indexBytesFetched)
-			var streamReader *storeGatewayStreamReader
-			if len(mySeries) > 0 {
-				chunksFetched, chunkBytes := countChunksAndBytes(mySeries...)
-
-				reqStats.AddFetchedSeries(uint64(len(mySeries)))
-				reqStats.AddFetchedChunkBytes(uint64(chunkBytes))
-				reqStats.AddFetchedChunks(uint64(chunksFetched))
-
-				level.Debug(log).Log("msg", "received series from store-gateway",
-					"instance", c.RemoteAddress(),
-					"fetched series", len(mySeries),
-					"fetched chunk bytes", chunkBytes,
-					"fetched chunks", chunksFetched,
-					"fetched index bytes", indexBytesFetched,
-					"requested blocks", strings.Join(convertULIDsToString(blockIDs), " "),
-					"queried blocks", strings.Join(convertULIDsToString(myQueriedBlocks), " "))
-			} else if len(myStreamingSeries) > 0 {
-				// FetchedChunks and FetchedChunkBytes are added by the SeriesChunksStreamReader.
-				reqStats.AddFetchedSeries(uint64(len(myStreamingSeries)))
-				streamReader = newStoreGatewayStreamReader(stream, len(myStreamingSeries), queryLimiter, reqStats, q.logger)
-				level.Debug(log).Log("msg", "received streaming series from store-gateway",
-					"instance", c.RemoteAddress(),
-					"fetched series", len(myStreamingSeries),
-					"fetched index bytes", indexBytesFetched,
-					"requested blocks", strings.Join(convertULIDsToString(blockIDs), " "),
-					"queried blocks", strings.Join(convertULIDsToString(myQueriedBlocks), " "))
-			}
+			for _, res := range results {
+				reqStats.AddFetchedIndexBytes(res.indexBytesFetched)
+				var streamReader *storeGatewayStreamReader
+				if len(res.series) > 0 {
+					chunksFetched, chunkBytes := countChunksAndBytes(res.series...)
+
+					reqStats.AddFetchedSeries(uint64(len(res.series)))
+					reqStats.AddFetchedChunkBytes(uint64(chunkBytes))
+					reqStats.AddFetchedChunks(uint64(chunksFetched))
+
+					level.Debug(log).Log("msg", "received series from store-gateway",
+						"instance", res.client.RemoteAddress(),
+						"fetched series", len(res.series),
+						"fetched chunk bytes", chunkBytes,
+						"fetched chunks", chunksFetched,
+						"fetched index bytes", res.indexBytesFetched,
+						"requested blocks", strings.Join(convertULIDsToString(res.blockIDs), " "),
+						"queried blocks", strings.Join(convertULIDsToString(res.queriedBlocks), " "))
+				} else if len(res.streamingSeries) > 0 {
+					// FetchedChunks and FetchedChunkBytes are added by the SeriesChunksStreamReader.
+					reqStats.AddFetchedSeries(uint64(len(res.streamingSeries)))
+					streamReader = newStoreGatewayStreamReader(res.stream, len(res.streamingSeries), queryLimiter, reqStats, q.logger)
+					level.Debug(log).Log("msg", "received streaming series from store-gateway",
+						"instance", res.client.RemoteAddress(),
+						"fetched series", len(res.streamingSeries),
+						"fetched index bytes", res.indexBytesFetched,
+						"requested blocks", strings.Join(convertULIDsToString(res.blockIDs), " "),
+						"queried blocks", strings.Join(convertULIDsToString(res.queriedBlocks), " "))
+				}
 
-			// Store the result.
-			mtx.Lock()
-			if len(mySeries) > 0 {
-				seriesSets = append(seriesSets, &blockQuerierSeriesSet{series: mySeries})
-			} else if len(myStreamingSeries) > 0 {
-				seriesSets = append(seriesSets, &blockStreamingQuerierSeriesSet{series: myStreamingSeries, streamReader: streamReader})
-				streamReaders = append(streamReaders, streamReader)
+				// Store the result.
+				mtx.Lock()
+				if len(res.series) > 0 {
+					seriesSets = append(seriesSets, &blockQuerierSeriesSet{series: res.series})
+				} else if len(res.streamingSeries) > 0 {
+					seriesSets = append(seriesSets, &blockStreamingQuerierSeriesSet{series: res.streamingSeries, streamReader: streamReader})
+					streamReaders = append(streamReaders, streamReader)
+				}
+				warnings = append(warnings, res.warnings...)
+				queriedBlocks = append(queriedBlocks, res.queriedBlocks...)
+				mtx.Unlock()
 			}
-			warnings = append(warnings, myWarnings...)
-			queriedBlocks = append(queriedBlocks, myQueriedBlocks...)
-			mtx.Unlock()
 
 			return nil
 		})
@@ -1025,6 +1296,87 @@ func (q *blocksStoreQuerier) fetchLabelNamesFromStore(
 	return nameSets, warnings, queriedBlocks, nil
 }
 
+func (q *blocksStoreQuerier) fetchExemplarsFromStore(
+	ctx context.Context,
+	clients map[BlocksStoreClient][]ulid.ULID,
+	minT int64,
+	maxT int64,
+	matchers []storepb.LabelMatchers,
+) ([][]exemplar.QueryResult, []ulid.ULID, error) {
+	var (
+		reqCtx        = grpc_metadata.AppendToOutgoingContext(ctx, storegateway.GrpcContextMetadataTenantID, q.userID)
+		g, gCtx       = errgroup.WithContext(reqCtx)
+		mtx           = sync.Mutex{}
+		sets          = [][]exemplar.QueryResult{}
+		queriedBlocks = []ulid.ULID(nil)
+		spanLog       = spanlogger.FromContext(ctx, q.logger)
+	)
+
+	// Concurrently fetch exemplars from all clients.
+	for c, blockIDs := range clients {
+		// Change variables scope since it will be used in a goroutine.
+		c := c
+		blockIDs := blockIDs
+
+		g.Go(func() error {
+			req := &storepb.ExemplarsRequest{
+				Start:    minT,
+				End:      maxT,
+				Matchers: matchers,
+				BlockIds: convertULIDsToString(blockIDs),
+			}
+
+			resp, err := c.Exemplars(gCtx, req)
+			if err != nil {
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					return err
+				}
+
+				level.Warn(spanLog).Log("msg", "failed to fetch exemplars", "remote", c.RemoteAddress(), "err", err)
+				return nil
+			}
+
+			myQueriedBlocks := make([]ulid.ULID, 0, len(resp.QueriedBlocks))
+			for _, id := range resp.QueriedBlocks {
+				blockID, err := ulid.Parse(id)
+				if err != nil {
+					return errors.Wrapf(err, "failed to parse queried block IDs from %s", c.RemoteAddress())
+				}
+				myQueriedBlocks = append(myQueriedBlocks, blockID)
+			}
+
+			set := make([]exemplar.QueryResult, 0, len(resp.Timeseries))
+			for _, ts := range resp.Timeseries {
+				set = append(set, exemplar.QueryResult{
+					SeriesLabels: mimirpb.FromLabelAdaptersToLabels(ts.Labels),
+					Exemplars:    mimirpb.FromExemplarProtosToExemplars(ts.Exemplars),
+				})
+			}
+
+			level.Debug(spanLog).Log("msg", "received exemplars from store-gateway",
+				"instance", c,
+				"num series", len(set),
+				"requested blocks", strings.Join(convertULIDsToString(blockIDs), " "),
+				"queried blocks", strings.Join(convertULIDsToString(myQueriedBlocks), " "))
+
+			// Store the result.
+			mtx.Lock()
+			sets = append(sets, set)
+			queriedBlocks = append(queriedBlocks, myQueriedBlocks...)
+			mtx.Unlock()
+
+			return nil
+		})
+	}
+
+	// Wait until all client requests complete.
+	if err := g.Wait(); err != nil {
+		return nil, nil, err
+	}
+
+	return sets, queriedBlocks, nil
+}
+
 func (q *blocksStoreQuerier) fetchLabelValuesFromStore(
 	ctx context.Context,
 	name string,
@@ -23,6 +23,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/storage"
@@ -38,6 +39,7 @@ import (
 	"github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/storage/sharding"
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/storage/tsdb/downsample"
 	"github.com/grafana/mimir/pkg/storegateway/hintspb"
 	"github.com/grafana/mimir/pkg/storegateway/storegatewaypb"
 	"github.com/grafana/mimir/pkg/storegateway/storepb"
@@ -1611,6 +1613,123 @@ func TestBlocksStoreQuerier_Labels(t *testing.T) {
 	})
 }
 
+func TestBlocksStoreQuerier_SelectExemplars(t *testing.T) {
+	const (
+		minT = int64(10)
+		maxT = int64(20)
+	)
+
+	var (
+		block1  = ulid.MustNew(1, nil)
+		block2  = ulid.MustNew(2, nil)
+		series1 = labels.FromStrings(labels.MetricName, "test_metric", "series", "1")
+		series2 = labels.FromStrings(labels.MetricName, "test_metric", "series", "2")
+		e       = func(ts int64) exemplar.Exemplar {
+			return exemplar.Exemplar{Labels: labels.FromStrings("trace_id", "abc"), Value: float64(ts), Ts: ts}
+		}
+		exemplarsResponse = func(queriedBlocks []ulid.ULID, series ...exemplar.QueryResult) *storepb.ExemplarsResponse {
+			resp := &storepb.ExemplarsResponse{QueriedBlocks: convertULIDsToString(queriedBlocks)}
+			for _, s := range series {
+				resp.Timeseries = append(resp.Timeseries, mimirpb.TimeSeries{
+					Labels:    mimirpb.FromLabelsToLabelAdapters(s.SeriesLabels),
+					Exemplars: mimirpb.FromExemplarsToExemplarProtos(s.Exemplars),
+				})
+			}
+			return resp
+		}
+	)
+
+	tests := map[string]struct {
+		finderResult      bucketindex.Blocks
+		storeSetResponses []interface{}
+		expected          []exemplar.QueryResult
+		expectedErr       string
+	}{
+		"no block in the storage matching the query time range": {
+			expected: nil,
+		},
+		"multiple store-gateway instances hold the required blocks with overlapping series": {
+			finderResult: bucketindex.Blocks{{ID: block1}, {ID: block2}},
+			storeSetResponses: []interface{}{
+				map[BlocksStoreClient][]ulid.ULID{
+					&storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedExemplarsResponse: exemplarsResponse([]ulid.ULID{block1},
+						exemplar.QueryResult{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(12)}},
+						exemplar.QueryResult{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(15)}},
+					)}: {block1},
+					&storeGatewayClientMock{remoteAddr: "2.2.2.2", mockedExemplarsResponse: exemplarsResponse([]ulid.ULID{block2},
+						exemplar.QueryResult{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(11), e(15)}},
+					)}: {block2},
+				},
+			},
+			expected: []exemplar.QueryResult{
+				{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(11), e(15)}},
+				{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(12)}},
+			},
+		},
+		"a store-gateway instance fails and the missing block is queried from another instance": {
+			finderResult: bucketindex.Blocks{{ID: block1}},
+			storeSetResponses: []interface{}{
+				map[BlocksStoreClient][]ulid.ULID{
+					&storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedExemplarsErr: errors.New("failed to receive exemplars")}: {block1},
+				},
+				map[BlocksStoreClient][]ulid.ULID{
+					&storeGatewayClientMock{remoteAddr: "2.2.2.2", mockedExemplarsResponse: exemplarsResponse([]ulid.ULID{block1},
+						exemplar.QueryResult{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(15)}},
+					)}: {block1},
+				},
+			},
+			expected: []exemplar.QueryResult{
+				{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(15)}},
+			},
+		},
+		"the consistency check fails if a block is not queried by any store-gateway instance": {
+			finderResult: bucketindex.Blocks{{ID: block1}},
+			storeSetResponses: []interface{}{
+				map[BlocksStoreClient][]ulid.ULID{
+					&storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedExemplarsResponse: exemplarsResponse(nil)}: {block1},
+				},
+				errors.New("no store-gateway remaining after exclude"),
+			},
+			expectedErr: newStoreConsistencyCheckFailedError([]ulid.ULID{block1}).Error(),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := user.InjectOrgID(context.Background(), "user-1")
+			stores := &blocksStoreSetMock{mockedResponses: testData.storeSetResponses}
+			finder := &blocksFinderMock{}
+			finder.On("GetBlocks", mock.Anything, "user-1", minT, maxT).Return(testData.finderResult, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), error(nil))
+
+			q := &blocksStoreQuerier{
+				ctx:         ctx,
+				minT:        minT,
+				maxT:        maxT,
+				userID:      "user-1",
+				finder:      finder,
+				stores:      stores,
+				consistency: NewBlocksConsistencyChecker(0, 0, log.NewNopLogger(), nil),
+				logger:      log.NewNopLogger(),
+				metrics:     newBlocksStoreQueryableMetrics(nil),
+				limits:      &blocksStoreLimitsMock{},
+			}
+
+			actual, err := q.selectExemplars([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "test_metric")})
+			if testData.expectedErr != "" {
+				require.EqualError(t, err, testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			if testData.expected == nil {
+				assert.Empty(t, actual)
+				return
+			}
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+}
+
 func TestBlocksStoreQuerier_SelectSortedShouldHonorQueryStoreAfter(t *testing.T) {
 	now := time.Now()
 
@@ -1866,7 +1985,7 @@ func TestBlocksStoreQuerier_PromQLExecution(t *testing.T) {
 
 					// Instantiate the querier that will be executed to run the query.
 					logger := log.NewNopLogger()
-					queryable, err := NewBlocksStoreQueryable(stores, finder, NewBlocksConsistencyChecker(0, 0, logger, nil), &blocksStoreLimitsMock{}, 0, 0, logger, nil)
+					queryable, err := NewBlocksStoreQueryable(stores, finder, NewBlocksConsistencyChecker(0, 0, logger, nil), &blocksStoreLimitsMock{}, 0, 0, 0, 0, 0, logger, nil)
 					require.NoError(t, err)
 					require.NoError(t, services.StartAndAwaitRunning(context.Background(), queryable))
 					defer services.StopAndAwaitTerminated(context.Background(), queryable) // nolint:errcheck
@@ -1994,6 +2113,101 @@ func TestFilterBlocksByShard(t *testing.T) {
 	}
 }
 
+func TestSelectBlocksForResolution(t *testing.T) {
+	const day = int64(24 * time.Hour / time.Millisecond)
+
+	newRawBlock := func(minT, maxT int64, shardID string) *bucketindex.Block {
+		return &bucketindex.Block{ID: ulid.MustNew(ulid.Now(), crand.Reader), MinTime: minT, MaxTime: maxT, CompactorShardID: shardID}
+	}
+	newDownsampledBlock := func(raw *bucketindex.Block, resolution int64, aggregate string) *bucketindex.Block {
+		return &bucketindex.Block{ID: ulid.MustNew(ulid.Now(), crand.Reader), MinTime: raw.MinTime, MaxTime: raw.MaxTime, CompactorShardID: raw.CompactorShardID, Resolution: resolution, Aggregate: aggregate, DownsampledFrom: &raw.ID}
+	}
+
+	// Day 1 has been downsampled to both 5m and 1h resolutions, day 2 only to 5m resolution, and day 3 hasn't been downsampled yet.
+	raw1 := newRawBlock(0, day, "")
+	raw2 := newRawBlock(day, 2*day, "")
+	raw3 := newRawBlock(2*day, 3*day, "")
+	avg5m1 := newDownsampledBlock(raw1, downsample.ResLevel1, downsample.AggrAvg)
+	max5m1 := newDownsampledBlock(raw1, downsample.ResLevel1, downsample.AggrMax)
+	avg1h1 := newDownsampledBlock(raw1, downsample.ResLevel2, downsample.AggrAvg)
+	avg5m2 := newDownsampledBlock(raw2, downsample.ResLevel1, downsample.AggrAvg)
+
+	// Sharded blocks.
+	raw4Shard1 := newRawBlock(3*day, 4*day, "1_of_2")
+	raw4Shard2 := newRawBlock(3*day, 4*day, "2_of_2")
+	avg5m4Shard1 := newDownsampledBlock(raw4Shard1, downsample.ResLevel1, downsample.AggrAvg)
+
+	// A raw block replacing raw1 after its downsampling, for example after merging out-of-order samples into it.
+	raw1Replaced := newRawBlock(0, day, "")
+
+	// A downsampled block of a raw block covering a larger time range, which has been deleted.
+	avg5mLarger := newDownsampledBlock(newRawBlock(0, 2*day, ""), downsample.ResLevel1, downsample.AggrAvg)
+
+	allBlocks := bucketindex.Blocks{raw1, raw2, raw3, avg5m1, max5m1, avg1h1, avg5m2, raw4Shard1, raw4Shard2, avg5m4Shard1}
+
+	tests := map[string]struct {
+		blocks         bucketindex.Blocks
+		maxResolution  int64
+		aggregate      string
+		expectedBlocks bucketindex.Blocks
+	}{
+		"no downsampled blocks": {
+			blocks:         bucketindex.Blocks{raw1, raw2},
+			maxResolution:  downsample.ResLevel2,
+			aggregate:      downsample.AggrAvg,
+			expectedBlocks: bucketindex.Blocks{raw1, raw2},
+		},
+		"raw resolution": {
+			blocks:         allBlocks,
+			maxResolution:  downsample.ResLevel0,
+			aggregate:      downsample.AggrAvg,
+			expectedBlocks: bucketindex.Blocks{raw1, raw2, raw3, raw4Shard1, raw4Shard2},
+		},
+		"5m resolution": {
+			blocks:         allBlocks,
+			maxResolution:  downsample.ResLevel1,
+			aggregate:      downsample.AggrAvg,
+			expectedBlocks: bucketindex.Blocks{raw3, avg5m1, avg5m2, raw4Shard2, avg5m4Shard1},
+		},
+		"1h resolution": {
+			blocks:         allBlocks,
+			maxResolution:  downsample.ResLevel2,
+			aggregate:      downsample.AggrAvg,
+			expectedBlocks: bucketindex.Blocks{raw3, avg1h1, avg5m2, raw4Shard2, avg5m4Shard1},
+		},
+		"5m resolution with another aggregate": {
+			blocks:         allBlocks,
+			maxResolution:  downsample.ResLevel1,
+			aggregate:      downsample.AggrMax,
+			expectedBlocks: bucketindex.Blocks{raw2, raw3, max5m1, raw4Shard1, raw4Shard2},
+		},
+		"raw blocks deleted by the retention are replaced by downsampled blocks": {
+			blocks:         bucketindex.Blocks{avg5m1, avg1h1, raw2},
+			maxResolution:  downsample.ResLevel0,
+			aggregate:      downsample.AggrAvg,
+			expectedBlocks: bucketindex.Blocks{avg5m1, raw2},
+		},
+		"raw block replacing a downsampled block": {
+			blocks:         bucketindex.Blocks{raw1Replaced, avg5m1, avg1h1, raw2, avg5m2},
+			maxResolution:  downsample.ResLevel2,
+			aggregate:      downsample.AggrAvg,
+			expectedBlocks: bucketindex.Blocks{raw1Replaced, avg5m2},
+		},
+		"downsampled block doesn't hide the raw blocks in its time range": {
+			blocks:         bucketindex.Blocks{raw1, avg5mLarger},
+			maxResolution:  downsample.ResLevel1,
+			aggregate:      downsample.AggrAvg,
+			expectedBlocks: bucketindex.Blocks{raw1, avg5mLarger},
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testData.expectedBlocks, selectBlocksForResolution(testData.blocks, testData.maxResolution, testData.aggregate))
+		})
+	}
+}
+
 type blocksStoreSetMock struct {
 	services.Service
 
@@ -2022,6 +2236,12 @@ func (m *blocksStoreSetMock) GetClientsFor(_ string, _ []ulid.ULID, _ map[ulid.U
 type blocksFinderMock struct {
 	services.Service
 	mock.Mock
+
+	tombstones bucketindex.Tombstones
+}
+
+func (m *blocksFinderMock) GetTombstones(context.Context, string) (bucketindex.Tombstones, error) {
+	return m.tombstones, nil
 }
 
 func (m *blocksFinderMock) GetBlocks(ctx context.Context, userID string, minT, maxT int64) (bucketindex.Blocks, map[ulid.ULID]*bucketindex.BlockDeletionMark, error) {
@@ -2037,6 +2257,8 @@ type storeGatewayClientMock struct {
 	mockedLabelNamesErr       error
 	mockedLabelValuesResponse *storepb.LabelValuesResponse
 	mockedLabelValuesErr      error
+	mockedExemplarsResponse   *storepb.ExemplarsResponse
+	mockedExemplarsErr        error
 }
 
 func (m *storeGatewayClientMock) Series(ctx context.Context, _ *storepb.SeriesRequest, _ ...grpc.CallOption) (storegatewaypb.StoreGateway_SeriesClient, error) {
@@ -2056,6 +2278,10 @@ func (m *storeGatewayClientMock) LabelValues(context.Context, *storepb.LabelValu
 	return m.mockedLabelValuesResponse, m.mockedLabelValuesErr
 }
 
+func (m *storeGatewayClientMock) Exemplars(context.Context, *storepb.ExemplarsRequest, ...grpc.CallOption) (*storepb.ExemplarsResponse, error) {
+	return m.mockedExemplarsResponse, m.mockedExemplarsErr
+}
+
 func (m *storeGatewayClientMock) RemoteAddress() string {
 	return m.remoteAddr
 }
@@ -2132,14 +2358,20 @@ func (m *cancelerStoreGatewayClientMock) LabelValues(ctx context.Context, _ *sto
 	return nil, ctx.Err()
 }
 
+func (m *cancelerStoreGatewayClientMock) Exemplars(ctx context.Context, _ *storepb.ExemplarsRequest, _ ...grpc.CallOption) (*storepb.ExemplarsResponse, error) {
+	m.cancel()
+	return nil, ctx.Err()
+}
+
 func (m *cancelerStoreGatewayClientMock) RemoteAddress() string {
 	return m.remoteAddr
 }
 
 type blocksStoreLimitsMock struct {
-	maxLabelsQueryLength        time.Duration
-	maxChunksPerQuery           int
-	storeGatewayTenantShardSize int
+	maxLabelsQueryLength          time.Duration
+	maxChunksPerQuery             int
+	storeGatewayTenantShardSize   int
+	compactorBlocksRetentionRules validation.RetentionRules
 }
 
 func (m *blocksStoreLimitsMock) MaxLabelsQueryLength(_ string) time.Duration {
@@ -2154,6 +2386,10 @@ func (m *blocksStoreLimitsMock) StoreGatewayTenantShardSize(_ string) int {
 	return m.storeGatewayTenantShardSize
 }
 
+func (m *blocksStoreLimitsMock) CompactorBlocksRetentionRules(_ string) validation.RetentionRules {
+	return m.compactorBlocksRetentionRules
+}
+
 func (m *blocksStoreLimitsMock) S3SSEType(_ string) string {
 	return ""
 }
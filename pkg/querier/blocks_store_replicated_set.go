@@ -145,11 +145,27 @@ func getNonExcludedInstanceAddr(set ring.ReplicationSet, exclude []string, balan
 		})
 	}
 
+	// Prefer an instance in a zone other than the excluded instances' ones, because
+	// the instances in the same zone are more likely to suffer from the same issue.
+	excludedZones := map[string]struct{}{}
 	for _, instance := range set.Instances {
-		if !util.StringsContain(exclude, instance.Addr) {
+		if instance.Zone != "" && util.StringsContain(exclude, instance.Addr) {
+			excludedZones[instance.Zone] = struct{}{}
+		}
+	}
+
+	addr := ""
+	for _, instance := range set.Instances {
+		if util.StringsContain(exclude, instance.Addr) {
+			continue
+		}
+		if _, ok := excludedZones[instance.Zone]; !ok {
 			return instance.Addr
 		}
+		if addr == "" {
+			addr = instance.Addr
+		}
 	}
 
-	return ""
+	return addr
 }
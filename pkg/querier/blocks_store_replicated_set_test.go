@@ -447,6 +447,54 @@ func TestBlocksStoreReplicationSet_GetClientsFor_ShouldSupportRandomLoadBalancin
 	}
 }
 
+func TestGetNonExcludedInstanceAddr_ShouldPreferAnotherZone(t *testing.T) {
+	// The set is created for each call, because the instances are shuffled by the random load balancing.
+	newSet := func() ring.ReplicationSet {
+		return ring.ReplicationSet{Instances: []ring.InstanceDesc{
+			{Addr: "127.0.0.1", Zone: "zone-a"},
+			{Addr: "127.0.0.2", Zone: "zone-a"},
+			{Addr: "127.0.0.3", Zone: "zone-b"},
+		}}
+	}
+
+	tests := map[string]struct {
+		exclude  []string
+		expected string
+	}{
+		"no excluded instances": {
+			expected: "127.0.0.1",
+		},
+		"an instance is excluded": {
+			exclude:  []string{"127.0.0.1"},
+			expected: "127.0.0.3",
+		},
+		"the instances in the other zones are excluded": {
+			exclude:  []string{"127.0.0.1", "127.0.0.3"},
+			expected: "127.0.0.2",
+		},
+		"all the instances are excluded": {
+			exclude:  []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"},
+			expected: "",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, getNonExcludedInstanceAddr(newSet(), testData.exclude, noLoadBalancing))
+
+			// With random load balancing, an instance in another zone is preferred too.
+			for n := 0; n < 10; n++ {
+				addr := getNonExcludedInstanceAddr(newSet(), testData.exclude, randomLoadBalancing)
+				if testData.expected == "127.0.0.1" {
+					assert.NotEmpty(t, addr)
+				} else {
+					assert.Equal(t, testData.expected, addr)
+				}
+			}
+		})
+	}
+}
+
 func getStoreGatewayClientAddrs(clients map[BlocksStoreClient][]ulid.ULID) map[string][]ulid.ULID {
 	addrs := map[string][]ulid.ULID{}
 	for c, blockIDs := range clients {
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/grafana/dskit/tenant"
+
+	"github.com/grafana/mimir/pkg/costattribution"
+	ingester_client "github.com/grafana/mimir/pkg/ingester/client"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// CostAttributionHandler creates handler for the cost attribution endpoint, which returns the number of
+// active series and ingested samples of the tenant for each attribution tracked by the ingesters.
+func CostAttributionHandler(d Distributor, limits *validation.Overrides) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		// Guarantee request's context is for a single tenant id
+		tenantID, err := tenant.TenantID(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		label := limits.CostAttributionLabel(tenantID)
+		if label == "" {
+			http.Error(w, fmt.Sprintf("cost attribution is disabled for the tenant: %v", tenantID), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := d.CostAttribution(ctx)
+		if err != nil {
+			respondFromError(err, w)
+			return
+		}
+
+		util.WriteJSONResponse(w, toCostAttributionResponse(label, resp))
+	})
+}
+
+// toCostAttributionResponse converts the cost attribution tracked by the ingesters to costAttributionResponse.
+// The attributions are sorted by series count in descending order and by label value in ascending order,
+// with costattribution.OverflowValue last.
+func toCostAttributionResponse(label string, resp *ingester_client.CostAttributionResponse) *costAttributionResponse {
+	res := &costAttributionResponse{
+		Label:        label,
+		Attributions: make([]costAttribution, 0, len(resp.Items)),
+	}
+
+	for _, item := range resp.Items {
+		res.AttributedSeriesCount += item.ActiveSeries
+		res.IngestedSamplesCount += item.IngestedSamples
+		res.Attributions = append(res.Attributions, costAttribution{
+			LabelValue:      item.Attribution,
+			SeriesCount:     item.ActiveSeries,
+			IngestedSamples: item.IngestedSamples,
+		})
+	}
+
+	sort.Slice(res.Attributions, func(i, j int) bool {
+		a, b := res.Attributions[i], res.Attributions[j]
+		if (a.LabelValue == costattribution.OverflowValue) != (b.LabelValue == costattribution.OverflowValue) {
+			return b.LabelValue == costattribution.OverflowValue
+		}
+		if a.SeriesCount != b.SeriesCount {
+			return a.SeriesCount > b.SeriesCount
+		}
+		return a.LabelValue < b.LabelValue
+	})
+	return res
+}
+
+type costAttributionResponse struct {
+	Label                 string            `json:"label"`
+	AttributedSeriesCount uint64            `json:"attributed_series_count"`
+	IngestedSamplesCount  uint64            `json:"ingested_samples_count"`
+	Attributions          []costAttribution `json:"attributions"`
+}
+
+type costAttribution struct {
+	LabelValue      string `json:"label_value"`
+	SeriesCount     uint64 `json:"series_count"`
+	IngestedSamples uint64 `json:"ingested_samples"`
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/dskit/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/ingester/client"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestCostAttributionHandler(t *testing.T) {
+	ingestersResponse := &client.CostAttributionResponse{
+		Items: []*client.CostAttributionItem{
+			{Attribution: "__overflow__", ActiveSeries: 50, IngestedSamples: 500},
+			{Attribution: "b", ActiveSeries: 20, IngestedSamples: 100},
+			{Attribution: "a", ActiveSeries: 100, IngestedSamples: 1000},
+			{Attribution: "c", ActiveSeries: 20, IngestedSamples: 300},
+		},
+	}
+
+	tests := map[string]struct {
+		costAttributionLabel string
+		expectedCode         int
+		expectedResponse     costAttributionResponse
+	}{
+		"cost attribution disabled": {
+			expectedCode: http.StatusBadRequest,
+		},
+		"attributions tracked by the ingesters": {
+			costAttributionLabel: "team",
+			expectedCode:         http.StatusOK,
+			expectedResponse: costAttributionResponse{
+				Label:                 "team",
+				AttributedSeriesCount: 190,
+				IngestedSamplesCount:  1900,
+				Attributions: []costAttribution{
+					{LabelValue: "a", SeriesCount: 100, IngestedSamples: 1000},
+					{LabelValue: "b", SeriesCount: 20, IngestedSamples: 100},
+					{LabelValue: "c", SeriesCount: 20, IngestedSamples: 300},
+					{LabelValue: "__overflow__", SeriesCount: 50, IngestedSamples: 500},
+				},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			distributor := &mockDistributor{}
+			distributor.On("CostAttribution", mock.Anything).Return(ingestersResponse, nil)
+			overrides, err := validation.NewOverrides(validation.Limits{
+				CostAttributionLabel:                 testData.costAttributionLabel,
+				MaxCostAttributionCardinalityPerUser: 2,
+			}, nil)
+			require.NoError(t, err)
+
+			ctx := user.InjectOrgID(context.Background(), "test")
+			request, err := http.NewRequestWithContext(ctx, "GET", "/api/v1/cardinality/cost_attribution", http.NoBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			CostAttributionHandler(distributor, overrides).ServeHTTP(recorder, request)
+
+			require.Equal(t, testData.expectedCode, recorder.Code)
+			if testData.expectedCode != http.StatusOK {
+				assert.Contains(t, recorder.Body.String(), "cost attribution is disabled for the tenant: test")
+				return
+			}
+
+			var response costAttributionResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, testData.expectedResponse, response)
+		})
+	}
+}
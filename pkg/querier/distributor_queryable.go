@@ -38,14 +38,16 @@ type Distributor interface {
 	MetricsMetadata(ctx context.Context) ([]scrape.MetricMetadata, error)
 	LabelNamesAndValues(ctx context.Context, matchers []*labels.Matcher) (*client.LabelNamesAndValuesResponse, error)
 	LabelValuesCardinality(ctx context.Context, labelNames []model.LabelName, matchers []*labels.Matcher, countMethod cardinality.CountMethod) (uint64, *client.LabelValuesCardinalityResponse, error)
+	CostAttribution(ctx context.Context) (*client.CostAttributionResponse, error)
 }
 
-func newDistributorQueryable(distributor Distributor, iteratorFn chunkIteratorFunc, cfgProvider distributorQueryableConfigProvider, queryMetrics *stats.QueryMetrics, logger log.Logger) QueryableWithFilter {
+func newDistributorQueryable(distributor Distributor, iteratorFn chunkIteratorFunc, cfgProvider distributorQueryableConfigProvider, tombstones TombstonesLoader, queryMetrics *stats.QueryMetrics, logger log.Logger) QueryableWithFilter {
 	return distributorQueryable{
 		logger:       logger,
 		distributor:  distributor,
 		iteratorFn:   iteratorFn,
 		cfgProvider:  cfgProvider,
+		tombstones:   tombstones,
 		queryMetrics: queryMetrics,
 	}
 }
@@ -59,6 +61,7 @@ type distributorQueryable struct {
 	distributor  Distributor
 	iteratorFn   chunkIteratorFunc
 	cfgProvider  distributorQueryableConfigProvider
+	tombstones   TombstonesLoader
 	queryMetrics *stats.QueryMetrics
 }
 
@@ -80,10 +83,12 @@ func (d distributorQueryable) Querier(ctx context.Context, mint, maxt int64) (st
 		logger:               d.logger,
 		distributor:          d.distributor,
 		ctx:                  ctx,
+		userID:               userID,
 		mint:                 mint,
 		maxt:                 maxt,
 		chunkIterFn:          d.iteratorFn,
 		queryIngestersWithin: queryIngestersWithin,
+		tombstones:           d.tombstones,
 		queryMetrics:         d.queryMetrics,
 	}, nil
 }
@@ -100,9 +105,11 @@ type distributorQuerier struct {
 	logger               log.Logger
 	distributor          Distributor
 	ctx                  context.Context
+	userID               string
 	mint, maxt           int64
 	chunkIterFn          chunkIteratorFunc
 	queryIngestersWithin time.Duration
+	tombstones           TombstonesLoader
 	queryMetrics         *stats.QueryMetrics
 }
 
@@ -133,10 +140,10 @@ func (q *distributorQuerier) Select(_ bool, sp *storage.SelectHints, matchers ..
 		if err != nil {
 			return storage.ErrSeriesSet(err)
 		}
-		return series.LabelsToSeriesSet(ms)
+		return maskDeletedSeries(ctx, q.tombstones, q.userID, minT, maxT, series.LabelsToSeriesSet(ms))
 	}
 
-	return q.streamingSelect(ctx, minT, maxT, matchers)
+	return maskDeletedSeries(ctx, q.tombstones, q.userID, minT, maxT, q.streamingSelect(ctx, minT, maxT, matchers))
 }
 
 func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int64, matchers []*labels.Matcher) storage.SeriesSet {
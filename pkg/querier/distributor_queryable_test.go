@@ -31,6 +31,7 @@ import (
 	"github.com/grafana/mimir/pkg/querier/batch"
 	"github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/storage/chunk"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/test"
 )
@@ -94,7 +95,7 @@ func TestDistributorQuerier_Select_ShouldHonorQueryIngestersWithin(t *testing.T)
 			userID := "test"
 			ctx := user.InjectOrgID(context.Background(), userID)
 			configProvider := newMockConfigProvider(testData.queryIngestersWithin)
-			queryable := newDistributorQueryable(distributor, nil, configProvider, nil, log.NewNopLogger())
+			queryable := newDistributorQueryable(distributor, nil, configProvider, nil, nil, log.NewNopLogger())
 			querier, err := queryable.Querier(ctx, testData.queryMinT, testData.queryMaxT)
 			require.NoError(t, err)
 
@@ -126,7 +127,7 @@ func TestDistributorQuerier_Select_ShouldHonorQueryIngestersWithin(t *testing.T)
 
 func TestDistributorQueryable_UseQueryable_AlwaysReturnsTrue(t *testing.T) {
 	d := &mockDistributor{}
-	dq := newDistributorQueryable(d, nil, newMockConfigProvider(1*time.Hour), nil, log.NewNopLogger())
+	dq := newDistributorQueryable(d, nil, newMockConfigProvider(1*time.Hour), nil, nil, log.NewNopLogger())
 
 	now := time.Now()
 
@@ -199,7 +200,7 @@ func TestDistributorQuerier_Select(t *testing.T) {
 			d.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(testCase.response, nil)
 
 			ctx := user.InjectOrgID(context.Background(), "0")
-			queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), nil, log.NewNopLogger())
+			queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), nil, nil, log.NewNopLogger())
 			querier, err := queryable.Querier(ctx, mint, maxt)
 			require.NoError(t, err)
 
@@ -308,7 +309,7 @@ func TestDistributorQuerier_Select_MixedChunkseriesTimeseriesAndStreamingResults
 		nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), stats.NewQueryMetrics(prometheus.NewPedanticRegistry()), log.NewNopLogger())
+	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), nil, stats.NewQueryMetrics(prometheus.NewPedanticRegistry()), log.NewNopLogger())
 	querier, err := queryable.Querier(ctx, mint, maxt)
 	require.NoError(t, err)
 
@@ -397,7 +398,7 @@ func TestDistributorQuerier_Select_MixedFloatAndIntegerHistograms(t *testing.T)
 		nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), nil, log.NewNopLogger())
+	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), nil, nil, log.NewNopLogger())
 	querier, err := queryable.Querier(ctx, mint, maxt)
 	require.NoError(t, err)
 
@@ -491,7 +492,7 @@ func TestDistributorQuerier_Select_MixedHistogramsAndFloatSamples(t *testing.T)
 		nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), nil, log.NewNopLogger())
+	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), nil, nil, log.NewNopLogger())
 	querier, err := queryable.Querier(ctx, mint, maxt)
 	require.NoError(t, err)
 
@@ -523,7 +524,7 @@ func TestDistributorQuerier_LabelNames(t *testing.T) {
 			d.On("LabelNames", mock.Anything, model.Time(mint), model.Time(maxt), someMatchers).
 				Return(labelNames, nil)
 			ctx := user.InjectOrgID(context.Background(), "0")
-			queryable := newDistributorQueryable(d, nil, newMockConfigProvider(0), nil, log.NewNopLogger())
+			queryable := newDistributorQueryable(d, nil, newMockConfigProvider(0), nil, nil, log.NewNopLogger())
 			querier, err := queryable.Querier(ctx, mint, maxt)
 			require.NoError(t, err)
 
@@ -535,6 +536,36 @@ func TestDistributorQuerier_LabelNames(t *testing.T) {
 	})
 }
 
+func TestDistributorQuerier_LabelNamesAndValues_ShouldNotMaskDeletedSeries(t *testing.T) {
+	const mint, maxt = 0, 10
+
+	// The tombstone deletes all the samples of the series within the queried time range.
+	tombstone, err := bucketindex.NewTombstone([]string{`{job="deleted"}`}, mint, maxt, time.Now())
+	require.NoError(t, err)
+	loader := &tombstonesLoaderMock{tombstones: bucketindex.Tombstones{tombstone}}
+
+	d := &mockDistributor{}
+	d.On("LabelNames", mock.Anything, model.Time(mint), model.Time(maxt), []*labels.Matcher(nil)).
+		Return([]string{labels.MetricName, "job"}, nil)
+	d.On("LabelValuesForLabelName", mock.Anything, model.Time(mint), model.Time(maxt), model.LabelName("job"), []*labels.Matcher(nil)).
+		Return([]string{"deleted", "kept"}, nil)
+
+	ctx := user.InjectOrgID(context.Background(), "0")
+	queryable := newDistributorQueryable(d, nil, newMockConfigProvider(0), loader, nil, log.NewNopLogger())
+	querier, err := queryable.Querier(ctx, mint, maxt)
+	require.NoError(t, err)
+
+	// Tombstones are only applied to Select, so the labels of the deleted series are still returned
+	// until the series are purged from the blocks.
+	names, _, err := querier.LabelNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{labels.MetricName, "job"}, names)
+
+	values, _, err := querier.LabelValues("job")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deleted", "kept"}, values)
+}
+
 func BenchmarkDistributorQuerier_Select(b *testing.B) {
 	const (
 		numSeries          = 10000
@@ -578,7 +609,7 @@ func BenchmarkDistributorQuerier_Select(b *testing.B) {
 	d.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, batch.NewChunkMergeIterator, newMockConfigProvider(0), nil, log.NewNopLogger())
+	queryable := newDistributorQueryable(d, batch.NewChunkMergeIterator, newMockConfigProvider(0), nil, nil, log.NewNopLogger())
 	querier, err := queryable.Querier(ctx, math.MinInt64, math.MaxInt64)
 	require.NoError(b, err)
 
@@ -726,6 +757,11 @@ func (m *mockDistributor) LabelValuesCardinality(ctx context.Context, labelNames
 	return args.Get(0).(uint64), args.Get(1).(*client.LabelValuesCardinalityResponse), args.Error(2)
 }
 
+func (m *mockDistributor) CostAttribution(ctx context.Context) (*client.CostAttributionResponse, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*client.CostAttributionResponse), args.Error(1)
+}
+
 type mockConfigProvider struct {
 	queryIngestersWithin time.Duration
 	seenUserIDs          []string
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+)
+
+// exemplarStore is a store supporting exemplar queries, used only if the store queryable
+// should be used to satisfy the query for the given time range.
+type exemplarStore struct {
+	storage.ExemplarQueryable
+	filter QueryableWithFilter
+}
+
+// newMergeExemplarQueryable returns a storage.ExemplarQueryable merging the exemplars of the
+// distributor with the exemplars of the stores supporting exemplar queries.
+func newMergeExemplarQueryable(distributor storage.ExemplarQueryable, stores []QueryableWithFilter) storage.ExemplarQueryable {
+	var exemplarStores []exemplarStore
+	for _, s := range stores {
+		if q, ok := exemplarQueryableOf(s); ok {
+			exemplarStores = append(exemplarStores, exemplarStore{ExemplarQueryable: q, filter: s})
+		}
+	}
+
+	if len(exemplarStores) == 0 {
+		return distributor
+	}
+
+	return &mergeExemplarQueryable{
+		distributor: distributor,
+		stores:      exemplarStores,
+	}
+}
+
+// exemplarQueryableOf returns the storage.ExemplarQueryable of the store queryable, if it supports exemplar queries.
+func exemplarQueryableOf(q storage.Queryable) (storage.ExemplarQueryable, bool) {
+	switch t := q.(type) {
+	case storeQueryable:
+		return exemplarQueryableOf(t.QueryableWithFilter)
+	case alwaysTrueFilterQueryable:
+		return exemplarQueryableOf(t.Queryable)
+	case useBeforeTimestampQueryable:
+		return exemplarQueryableOf(t.Queryable)
+	}
+
+	eq, ok := q.(storage.ExemplarQueryable)
+	return eq, ok
+}
+
+type mergeExemplarQueryable struct {
+	distributor storage.ExemplarQueryable
+	stores      []exemplarStore
+}
+
+func (m *mergeExemplarQueryable) ExemplarQuerier(ctx context.Context) (storage.ExemplarQuerier, error) {
+	return &mergeExemplarQuerier{
+		ctx:         ctx,
+		distributor: m.distributor,
+		stores:      m.stores,
+	}, nil
+}
+
+type mergeExemplarQuerier struct {
+	ctx         context.Context
+	distributor storage.ExemplarQueryable
+	stores      []exemplarStore
+}
+
+// Select implements storage.ExemplarQuerier. The exemplars of the distributor and the stores are queried
+// concurrently, and the exemplars of the same series are merged and deduplicated.
+func (m *mergeExemplarQuerier) Select(start, end int64, matchers ...[]*labels.Matcher) ([]exemplar.QueryResult, error) {
+	now := time.Now()
+
+	queryables := []storage.ExemplarQueryable{m.distributor}
+	for _, s := range m.stores {
+		if s.filter.UseQueryable(now, start, end) {
+			queryables = append(queryables, s.ExemplarQueryable)
+		}
+	}
+
+	var (
+		g, ctx  = errgroup.WithContext(m.ctx)
+		mtx     sync.Mutex
+		results = make([][]exemplar.QueryResult, 0, len(queryables))
+	)
+
+	for _, q := range queryables {
+		q := q
+
+		g.Go(func() error {
+			querier, err := q.ExemplarQuerier(ctx)
+			if err != nil {
+				return err
+			}
+
+			res, err := querier.Select(start, end, matchers...)
+			if err != nil {
+				return err
+			}
+
+			mtx.Lock()
+			results = append(results, res)
+			mtx.Unlock()
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return block.MergeExemplars(results...), nil
+}
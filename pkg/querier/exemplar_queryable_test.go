@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeExemplarQueryable(t *testing.T) {
+	var (
+		series1 = labels.FromStrings(labels.MetricName, "test_metric", "series", "1")
+		series2 = labels.FromStrings(labels.MetricName, "test_metric", "series", "2")
+		e       = func(ts int64) exemplar.Exemplar {
+			return exemplar.Exemplar{Labels: labels.FromStrings("trace_id", "abc"), Value: float64(ts), Ts: ts}
+		}
+
+		distributor = &exemplarQueryableMock{results: []exemplar.QueryResult{
+			{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(30), e(40)}},
+		}}
+		store = &exemplarStoreQueryableMock{exemplarQueryableMock: exemplarQueryableMock{results: []exemplar.QueryResult{
+			{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(20), e(30)}},
+			{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(10)}},
+		}}}
+		matchers = []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "test_metric")}
+	)
+
+	selectExemplars := func(t *testing.T, q storage.ExemplarQueryable, start, end int64) ([]exemplar.QueryResult, error) {
+		querier, err := q.ExemplarQuerier(context.Background())
+		require.NoError(t, err)
+		return querier.Select(start, end, matchers)
+	}
+
+	t.Run("should return the distributor queryable if no store supports exemplars", func(t *testing.T) {
+		q := newMergeExemplarQueryable(distributor, []QueryableWithFilter{UseAlwaysQueryable(storage.QueryableFunc(nil))})
+		assert.Same(t, distributor, q)
+	})
+
+	t.Run("should merge the exemplars of the distributor and the stores", func(t *testing.T) {
+		q := newMergeExemplarQueryable(distributor, []QueryableWithFilter{
+			storeQueryable{QueryableWithFilter: UseAlwaysQueryable(store)},
+		})
+
+		actual, err := selectExemplars(t, q, 0, 100)
+		require.NoError(t, err)
+		assert.Equal(t, []exemplar.QueryResult{
+			{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(10)}},
+			{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(20), e(30), e(40)}},
+		}, actual)
+		assert.Equal(t, [][]*labels.Matcher{matchers}, store.matchers)
+	})
+
+	t.Run("should not query the stores which should not be used for the time range", func(t *testing.T) {
+		q := newMergeExemplarQueryable(distributor, []QueryableWithFilter{
+			storeQueryable{QueryableWithFilter: UseAlwaysQueryable(store), QueryStoreAfter: time.Hour},
+		})
+
+		now := time.Now().UnixMilli()
+		actual, err := selectExemplars(t, q, now-time.Minute.Milliseconds(), now)
+		require.NoError(t, err)
+		assert.Equal(t, []exemplar.QueryResult{
+			{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(30), e(40)}},
+		}, actual)
+	})
+
+	t.Run("should fail if a store fails", func(t *testing.T) {
+		failing := &exemplarStoreQueryableMock{exemplarQueryableMock: exemplarQueryableMock{err: errors.New("store failure")}}
+		q := newMergeExemplarQueryable(distributor, []QueryableWithFilter{UseAlwaysQueryable(failing)})
+
+		_, err := selectExemplars(t, q, 0, 100)
+		require.EqualError(t, err, "store failure")
+	})
+}
+
+type exemplarQueryableMock struct {
+	results  []exemplar.QueryResult
+	err      error
+	matchers [][]*labels.Matcher
+}
+
+func (m *exemplarQueryableMock) ExemplarQuerier(context.Context) (storage.ExemplarQuerier, error) {
+	return m, nil
+}
+
+func (m *exemplarQueryableMock) Select(_, _ int64, matchers ...[]*labels.Matcher) ([]exemplar.QueryResult, error) {
+	m.matchers = matchers
+	return m.results, m.err
+}
+
+// exemplarStoreQueryableMock is a store queryable supporting exemplar queries.
+type exemplarStoreQueryableMock struct {
+	storage.Queryable
+	exemplarQueryableMock
+}
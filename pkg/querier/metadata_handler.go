@@ -8,6 +8,8 @@ package querier
 import (
 	"context"
 	"net/http"
+	"sort"
+	"strconv"
 
 	"github.com/prometheus/prometheus/scrape"
 
@@ -44,8 +46,23 @@ type metadataErrorResult struct {
 
 // NewMetadataHandler creates a http.Handler for serving metric metadata held by
 // Mimir for a given tenant. It is kept and returned as a set.
+//
+// Like Prometheus, the handler supports the "limit" parameter, limiting the number
+// of metrics returned, and the "metric" parameter, returning only the metadata of
+// the given metric.
 func NewMetadataHandler(m MetadataSupplier) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := -1
+		if s := r.FormValue("limit"); s != "" {
+			var err error
+			if limit, err = strconv.Atoi(s); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				util.WriteJSONResponse(w, metadataErrorResult{Status: statusError, Error: "limit must be a number"})
+				return
+			}
+		}
+		metric := r.FormValue("metric")
+
 		resp, err := m.MetricsMetadata(r.Context())
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -56,6 +73,10 @@ func NewMetadataHandler(m MetadataSupplier) http.Handler {
 		// Put all the elements of the pseudo-set into a map of slices for marshalling.
 		metrics := map[string][]metricMetadata{}
 		for _, m := range resp {
+			if metric != "" && m.Metric != metric {
+				continue
+			}
+
 			ms, ok := metrics[m.Metric]
 			if !ok {
 				// Most metrics will only hold 1 copy of the same metadata.
@@ -65,6 +86,19 @@ func NewMetadataHandler(m MetadataSupplier) http.Handler {
 			metrics[m.Metric] = append(ms, metricMetadata{Type: string(m.Type), Help: m.Help, Unit: m.Unit})
 		}
 
+		// Keep the first metrics in alphabetical order, so that the response is deterministic.
+		if limit >= 0 && len(metrics) > limit {
+			names := make([]string, 0, len(metrics))
+			for name := range metrics {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names[limit:] {
+				delete(metrics, name)
+			}
+		}
+
 		util.WriteJSONResponse(w, metadataSuccessResult{Status: statusSuccess, Data: metrics})
 	})
 }
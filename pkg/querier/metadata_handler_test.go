@@ -108,3 +108,78 @@ func TestMetadataHandler_Error(t *testing.T) {
 
 	require.JSONEq(t, expectedJSON, string(responseBody))
 }
+
+func TestMetadataHandler_LimitAndMetric(t *testing.T) {
+	d := &mockDistributor{}
+	d.On("MetricsMetadata", mock.Anything).Return(
+		[]scrape.MetricMetadata{
+			{Metric: "up", Help: "Target is up", Type: "gauge", Unit: ""},
+			{Metric: "requests_total", Help: "Total requests", Type: "counter", Unit: ""},
+			{Metric: "requests_total", Help: "Total number of requests", Type: "counter", Unit: ""},
+			{Metric: "latency", Help: "Request latency", Type: "histogram", Unit: "seconds"},
+		},
+		nil)
+
+	handler := NewMetadataHandler(d)
+
+	tests := map[string]struct {
+		query              string
+		expectedStatusCode int
+		expectedJSON       string
+	}{
+		"limit": {
+			query:              "limit=2",
+			expectedStatusCode: http.StatusOK,
+			expectedJSON: `{
+				"status": "success",
+				"data": {
+					"latency": [{"help": "Request latency", "type": "histogram", "unit": "seconds"}],
+					"requests_total": [
+						{"help": "Total requests", "type": "counter", "unit": ""},
+						{"help": "Total number of requests", "type": "counter", "unit": ""}
+					]
+				}
+			}`,
+		},
+		"zero limit": {
+			query:              "limit=0",
+			expectedStatusCode: http.StatusOK,
+			expectedJSON:       `{"status": "success", "data": {}}`,
+		},
+		"metric": {
+			query:              "metric=up",
+			expectedStatusCode: http.StatusOK,
+			expectedJSON: `{
+				"status": "success",
+				"data": {
+					"up": [{"help": "Target is up", "type": "gauge", "unit": ""}]
+				}
+			}`,
+		},
+		"unknown metric": {
+			query:              "metric=unknown",
+			expectedStatusCode: http.StatusOK,
+			expectedJSON:       `{"status": "success", "data": {}}`,
+		},
+		"invalid limit": {
+			query:              "limit=invalid",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedJSON:       `{"status": "error", "error": "limit must be a number"}`,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			request, err := http.NewRequest("GET", "/metadata?"+testData.query, nil)
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			require.Equal(t, testData.expectedStatusCode, recorder.Result().StatusCode)
+			responseBody, err := io.ReadAll(recorder.Result().Body)
+			require.NoError(t, err)
+			require.JSONEq(t, testData.expectedJSON, string(responseBody))
+		})
+	}
+}
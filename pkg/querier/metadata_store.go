@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/scrape"
+	"github.com/thanos-io/objstore"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb/metricmetadata"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// NewStoredMetadataSupplier returns a MetadataSupplier returning the union of the metric metadata
+// returned by next, which is the metric metadata held by the ingesters, and the metric metadata
+// stored in the bucket. The metric metadata read from the bucket is cached for cacheTTL.
+func NewStoredMetadataSupplier(next MetadataSupplier, bkt objstore.Bucket, cfgProvider bucket.TenantConfigProvider, cacheTTL time.Duration, logger log.Logger) MetadataSupplier {
+	return &storedMetadataSupplier{
+		next:        next,
+		bkt:         bkt,
+		cfgProvider: cfgProvider,
+		cacheTTL:    cacheTTL,
+		logger:      logger,
+		cache:       map[string]storedMetadataCacheEntry{},
+	}
+}
+
+type storedMetadataSupplier struct {
+	next        MetadataSupplier
+	bkt         objstore.Bucket
+	cfgProvider bucket.TenantConfigProvider
+	cacheTTL    time.Duration
+	logger      log.Logger
+
+	cacheMx sync.Mutex
+	cache   map[string]storedMetadataCacheEntry
+}
+
+type storedMetadataCacheEntry struct {
+	metadata  []scrape.MetricMetadata
+	fetchedAt time.Time
+}
+
+func (s *storedMetadataSupplier) MetricsMetadata(ctx context.Context) ([]scrape.MetricMetadata, error) {
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	spanLog, ctx := spanlogger.NewWithLogger(ctx, s.logger, "storedMetadataSupplier.MetricsMetadata")
+	defer spanLog.Finish()
+
+	var (
+		g, gctx  = errgroup.WithContext(ctx)
+		ingested []scrape.MetricMetadata
+		stored   []scrape.MetricMetadata
+	)
+
+	g.Go(func() (err error) {
+		ingested, err = s.next.MetricsMetadata(gctx)
+		return err
+	})
+	g.Go(func() (err error) {
+		stored, err = s.storedMetadata(gctx, userID, spanLog)
+		return err
+	})
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// The same metadata is likely to be both held by the ingesters and stored in the bucket.
+	result := make([]scrape.MetricMetadata, 0, len(ingested)+len(stored))
+	seen := make(map[scrape.MetricMetadata]struct{}, len(ingested)+len(stored))
+	for _, list := range [][]scrape.MetricMetadata{ingested, stored} {
+		for _, m := range list {
+			if _, ok := seen[m]; ok {
+				continue
+			}
+			seen[m] = struct{}{}
+			result = append(result, m)
+		}
+	}
+
+	return result, nil
+}
+
+// storedMetadata returns the metric metadata of the tenant stored in the bucket, from the cache if not expired.
+func (s *storedMetadataSupplier) storedMetadata(ctx context.Context, userID string, logger log.Logger) ([]scrape.MetricMetadata, error) {
+	now := time.Now()
+
+	s.cacheMx.Lock()
+	cached, ok := s.cache[userID]
+	s.cacheMx.Unlock()
+
+	if ok && now.Sub(cached.fetchedAt) < s.cacheTTL {
+		return cached.metadata, nil
+	}
+
+	entries, err := metricmetadata.Read(ctx, s.bkt, userID, s.cfgProvider, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "read stored metric metadata")
+	}
+
+	metadata := make([]scrape.MetricMetadata, 0, len(entries))
+	for _, e := range entries {
+		metadata = append(metadata, scrape.MetricMetadata{
+			Metric: e.Metric,
+			Type:   textparse.MetricType(e.Type),
+			Help:   e.Help,
+			Unit:   e.Unit,
+		})
+	}
+
+	s.cacheMx.Lock()
+	defer s.cacheMx.Unlock()
+
+	// Remove the expired entries of the other tenants, so that the cache doesn't grow with the tenants no longer queried.
+	for id, entry := range s.cache {
+		if now.Sub(entry.fetchedAt) >= s.cacheTTL {
+			delete(s.cache, id)
+		}
+	}
+	s.cache[userID] = storedMetadataCacheEntry{metadata: metadata, fetchedAt: now}
+
+	return metadata, nil
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/prometheus/scrape"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/metricmetadata"
+	mimir_testutil "github.com/grafana/mimir/pkg/storage/tsdb/testutil"
+)
+
+func TestStoredMetadataSupplier(t *testing.T) {
+	const userID = "user-1"
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	bkt, _ := mimir_testutil.PrepareFilesystemBucket(t)
+
+	up := scrape.MetricMetadata{Metric: "up", Type: "gauge", Help: "Target is up."}
+	requests := scrape.MetricMetadata{Metric: "requests_total", Type: "counter", Help: "Total requests."}
+	latency := scrape.MetricMetadata{Metric: "latency", Type: "histogram", Unit: "seconds"}
+
+	d := &mockDistributor{}
+	d.On("MetricsMetadata", mock.Anything).Return([]scrape.MetricMetadata{up}, nil)
+
+	// The stored metadata includes metadata no longer held by the ingesters.
+	require.NoError(t, metricmetadata.WriteSegment(context.Background(), bkt, userID, nil, "ingester-1", []metricmetadata.Entry{
+		{Metric: "up", Type: "gauge", Help: "Target is up.", LastSeen: 100},
+		{Metric: "requests_total", Type: "counter", Help: "Total requests.", LastSeen: 100},
+	}, time.Unix(100, 0)))
+
+	t.Run("should return the union of the ingested and stored metadata", func(t *testing.T) {
+		s := NewStoredMetadataSupplier(d, bkt, nil, 0, log.NewNopLogger())
+
+		actual, err := s.MetricsMetadata(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []scrape.MetricMetadata{up, requests}, actual)
+	})
+
+	t.Run("should cache the stored metadata", func(t *testing.T) {
+		s := NewStoredMetadataSupplier(d, bkt, nil, time.Hour, log.NewNopLogger())
+
+		actual, err := s.MetricsMetadata(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []scrape.MetricMetadata{up, requests}, actual)
+
+		require.NoError(t, metricmetadata.WriteSegment(context.Background(), bkt, userID, nil, "ingester-2", []metricmetadata.Entry{
+			{Metric: "latency", Type: "histogram", Unit: "seconds", LastSeen: 200},
+		}, time.Unix(200, 0)))
+
+		actual, err = s.MetricsMetadata(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []scrape.MetricMetadata{up, requests}, actual)
+
+		// Once the cached metadata has expired, the stored metadata is read again.
+		s.(*storedMetadataSupplier).cacheTTL = 0
+
+		actual, err = s.MetricsMetadata(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []scrape.MetricMetadata{up, requests, latency}, actual)
+	})
+
+	t.Run("should fail if the ingested metadata can't be fetched", func(t *testing.T) {
+		failing := &mockDistributor{}
+		failing.On("MetricsMetadata", mock.Anything).Return([]scrape.MetricMetadata(nil), errors.New("ingesters failure"))
+		s := NewStoredMetadataSupplier(failing, bkt, nil, 0, log.NewNopLogger())
+
+		_, err := s.MetricsMetadata(ctx)
+		require.EqualError(t, err, "ingesters failure")
+	})
+
+	t.Run("should fail without a tenant ID", func(t *testing.T) {
+		s := NewStoredMetadataSupplier(d, bkt, nil, 0, log.NewNopLogger())
+
+		_, err := s.MetricsMetadata(context.Background())
+		require.Error(t, err)
+	})
+}
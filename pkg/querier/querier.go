@@ -56,13 +56,16 @@ type Config struct {
 	StreamingChunksPerStoreGatewaySeriesBufferSize uint64        `yaml:"streaming_chunks_per_store_gateway_series_buffer_size" category:"experimental"`
 	MinimizeIngesterRequests                       bool          `yaml:"minimize_ingester_requests" category:"experimental"`
 	MinimiseIngesterRequestsHedgingDelay           time.Duration `yaml:"minimize_ingester_requests_hedging_delay" category:"experimental"`
+	StoreGatewayHedgingPercentile                  float64       `yaml:"store_gateway_hedging_percentile" category:"experimental"`
+	StoreGatewayHedgingMinDelay                    time.Duration `yaml:"store_gateway_hedging_min_delay" category:"experimental"`
 
 	// PromQL engine config.
 	EngineConfig engine.Config `yaml:",inline"`
 }
 
 const (
-	queryStoreAfterFlag = "querier.query-store-after"
+	queryStoreAfterFlag               = "querier.query-store-after"
+	storeGatewayHedgingPercentileFlag = "querier.store-gateway-hedging-percentile"
 
 	// DefaultQuerierCfgQueryIngestersWithin is the default value for the deprecated querier config QueryIngestersWithin (it has been moved to a per-tenant limit instead)
 	DefaultQuerierCfgQueryIngestersWithin = 13 * time.Hour
@@ -71,6 +74,8 @@ const (
 var (
 	errBadLookbackConfigs = fmt.Errorf("the -%s setting must be greater than -%s otherwise queries might return partial results", validation.QueryIngestersWithinFlag, queryStoreAfterFlag)
 	errEmptyTimeRange     = errors.New("empty time range")
+
+	errInvalidStoreGatewayHedgingPercentile = fmt.Errorf("the -%s setting must be between 0 and 1", storeGatewayHedgingPercentileFlag)
 )
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
@@ -91,6 +96,9 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.MinimizeIngesterRequests, minimiseIngesterRequestsFlagName, false, "If true, when querying ingesters, only the minimum required ingesters required to reach quorum will be queried initially, with other ingesters queried only if needed due to failures from the initial set of ingesters. Enabling this option reduces resource consumption for the happy path at the cost of increased latency for the unhappy path.")
 	f.DurationVar(&cfg.MinimiseIngesterRequestsHedgingDelay, minimiseIngesterRequestsFlagName+"-hedging-delay", 3*time.Second, "Delay before initiating requests to further ingesters when request minimization is enabled and the initially selected set of ingesters have not all responded. Ignored if -"+minimiseIngesterRequestsFlagName+" is not enabled.")
 
+	f.Float64Var(&cfg.StoreGatewayHedgingPercentile, storeGatewayHedgingPercentileFlag, 0, "Percentile of the latency of the recent series requests to store-gateways after which a series request is hedged: the querier sends the same request to another store-gateway owning the same blocks, preferring another zone, uses the response received first and cancels the other request. The value must be between 0 and 1, for example 0.95. 0 to disable. Hedging is only applied when -querier.prefer-streaming-chunks-from-store-gateways is enabled.")
+	f.DurationVar(&cfg.StoreGatewayHedgingMinDelay, "querier.store-gateway-hedging-min-delay", 100*time.Millisecond, "Minimum delay before hedging a series request to store-gateways, regardless of the latency percentile. Ignored if -"+storeGatewayHedgingPercentileFlag+" is 0.")
+
 	// Why 256 series / ingester/store-gateway?
 	// Based on our testing, 256 series / ingester was a good balance between memory consumption and the CPU overhead of managing a batch of series.
 	f.Uint64Var(&cfg.StreamingChunksPerIngesterSeriesBufferSize, "querier.streaming-chunks-per-ingester-buffer-size", 256, "Number of series to buffer per ingester when streaming chunks from ingesters.")
@@ -105,6 +113,9 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 }
 
 func (cfg *Config) Validate() error {
+	if cfg.StoreGatewayHedgingPercentile < 0 || cfg.StoreGatewayHedgingPercentile >= 1 {
+		return errInvalidStoreGatewayHedgingPercentile
+	}
 	return nil
 }
 
@@ -128,12 +139,13 @@ func getChunksIteratorFunction(cfg Config) chunkIteratorFunc {
 	return mergeChunks
 }
 
-// New builds a queryable and promql engine.
-func New(cfg Config, limits *validation.Overrides, distributor Distributor, stores []QueryableWithFilter, reg prometheus.Registerer, logger log.Logger, tracker *activitytracker.ActivityTracker) (storage.SampleAndChunkQueryable, storage.ExemplarQueryable, *promql.Engine) {
+// New builds a queryable and promql engine. The optional tombstones loader is used to mask
+// the samples deleted by pending series deletion requests from the ingesters' results.
+func New(cfg Config, limits *validation.Overrides, distributor Distributor, stores []QueryableWithFilter, tombstones TombstonesLoader, reg prometheus.Registerer, logger log.Logger, tracker *activitytracker.ActivityTracker) (storage.SampleAndChunkQueryable, storage.ExemplarQueryable, *promql.Engine) {
 	iteratorFunc := getChunksIteratorFunction(cfg)
 	queryMetrics := stats.NewQueryMetrics(reg)
 
-	distributorQueryable := newDistributorQueryable(distributor, iteratorFunc, limits, queryMetrics, logger)
+	distributorQueryable := newDistributorQueryable(distributor, iteratorFunc, limits, tombstones, queryMetrics, logger)
 
 	ns := make([]QueryableWithFilter, len(stores))
 	for ix, s := range stores {
@@ -143,7 +155,7 @@ func New(cfg Config, limits *validation.Overrides, distributor Distributor, stor
 		}
 	}
 	queryable := NewQueryable(distributorQueryable, ns, iteratorFunc, cfg, limits, queryMetrics, logger)
-	exemplarQueryable := newDistributorExemplarQueryable(distributor, logger)
+	exemplarQueryable := newMergeExemplarQueryable(newDistributorExemplarQueryable(distributor, logger), ns)
 
 	lazyQueryable := storage.QueryableFunc(func(ctx context.Context, mint int64, maxt int64) (storage.Querier, error) {
 		querier, err := queryable.Querier(ctx, mint, maxt)
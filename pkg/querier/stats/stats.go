@@ -171,6 +171,80 @@ func (s *Stats) LoadEstimatedSeriesCount() uint64 {
 	return atomic.LoadUint64(&s.EstimatedSeriesCount)
 }
 
+func (s *Stats) AddSamplesProcessed(samples uint64) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddUint64(&s.SamplesProcessed, samples)
+}
+
+func (s *Stats) LoadSamplesProcessed() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&s.SamplesProcessed)
+}
+
+// UpdatePeakSamples sets the peak samples to the input value, if greater than the current one.
+func (s *Stats) UpdatePeakSamples(samples uint64) {
+	if s == nil {
+		return
+	}
+
+	for {
+		current := atomic.LoadUint64(&s.PeakSamples)
+		if samples <= current || atomic.CompareAndSwapUint64(&s.PeakSamples, current, samples) {
+			return
+		}
+	}
+}
+
+func (s *Stats) LoadPeakSamples() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&s.PeakSamples)
+}
+
+// AddStoreGatewayTime adds some time to the time spent waiting for store-gateways.
+func (s *Stats) AddStoreGatewayTime(t time.Duration) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddInt64((*int64)(&s.StoreGatewayTime), int64(t))
+}
+
+// LoadStoreGatewayTime returns the current time spent waiting for store-gateways.
+func (s *Stats) LoadStoreGatewayTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return time.Duration(atomic.LoadInt64((*int64)(&s.StoreGatewayTime)))
+}
+
+// AddIngesterTime adds some time to the time spent waiting for ingesters.
+func (s *Stats) AddIngesterTime(t time.Duration) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddInt64((*int64)(&s.IngesterTime), int64(t))
+}
+
+// LoadIngesterTime returns the current time spent waiting for ingesters.
+func (s *Stats) LoadIngesterTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return time.Duration(atomic.LoadInt64((*int64)(&s.IngesterTime)))
+}
+
 // Merge the provided Stats into this one.
 func (s *Stats) Merge(other *Stats) {
 	if s == nil || other == nil {
@@ -185,6 +259,10 @@ func (s *Stats) Merge(other *Stats) {
 	s.AddSplitQueries(other.LoadSplitQueries())
 	s.AddFetchedIndexBytes(other.LoadFetchedIndexBytes())
 	s.AddEstimatedSeriesCount(other.LoadEstimatedSeriesCount())
+	s.AddSamplesProcessed(other.LoadSamplesProcessed())
+	s.UpdatePeakSamples(other.LoadPeakSamples())
+	s.AddStoreGatewayTime(other.LoadStoreGatewayTime())
+	s.AddIngesterTime(other.LoadIngesterTime())
 }
 
 func ShouldTrackHTTPGRPCResponse(r *httpgrpc.HTTPResponse) bool {
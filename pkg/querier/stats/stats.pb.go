@@ -46,6 +46,14 @@ type Stats struct {
 	FetchedIndexBytes uint64 `protobuf:"varint,7,opt,name=fetched_index_bytes,json=fetchedIndexBytes,proto3" json:"fetched_index_bytes,omitempty"`
 	// The estimated number of series to be fetched for the query
 	EstimatedSeriesCount uint64 `protobuf:"varint,8,opt,name=estimated_series_count,json=estimatedSeriesCount,proto3" json:"estimated_series_count,omitempty"`
+	// The total number of samples processed by the PromQL engine to execute the query
+	SamplesProcessed uint64 `protobuf:"varint,9,opt,name=samples_processed,json=samplesProcessed,proto3" json:"samples_processed,omitempty"`
+	// The highest number of samples loaded in memory at the same time by the PromQL engine to execute the query
+	PeakSamples uint64 `protobuf:"varint,10,opt,name=peak_samples,json=peakSamples,proto3" json:"peak_samples,omitempty"`
+	// The sum of the time spent waiting for store-gateways to respond to the query
+	StoreGatewayTime time.Duration `protobuf:"bytes,11,opt,name=store_gateway_time,json=storeGatewayTime,proto3,stdduration" json:"store_gateway_time"`
+	// The sum of the time spent waiting for ingesters to respond to the query
+	IngesterTime time.Duration `protobuf:"bytes,12,opt,name=ingester_time,json=ingesterTime,proto3,stdduration" json:"ingester_time"`
 }
 
 func (m *Stats) Reset()      { *m = Stats{} }
@@ -136,6 +144,34 @@ func (m *Stats) GetEstimatedSeriesCount() uint64 {
 	return 0
 }
 
+func (m *Stats) GetSamplesProcessed() uint64 {
+	if m != nil {
+		return m.SamplesProcessed
+	}
+	return 0
+}
+
+func (m *Stats) GetPeakSamples() uint64 {
+	if m != nil {
+		return m.PeakSamples
+	}
+	return 0
+}
+
+func (m *Stats) GetStoreGatewayTime() time.Duration {
+	if m != nil {
+		return m.StoreGatewayTime
+	}
+	return 0
+}
+
+func (m *Stats) GetIngesterTime() time.Duration {
+	if m != nil {
+		return m.IngesterTime
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Stats)(nil), "stats.Stats")
 }
@@ -143,30 +179,36 @@ func init() {
 func init() { proto.RegisterFile("stats.proto", fileDescriptor_b4756a0aec8b9d44) }
 
 var fileDescriptor_b4756a0aec8b9d44 = []byte{
-	// 362 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x92, 0x3f, 0x4f, 0xc2, 0x40,
-	0x18, 0xc6, 0x7b, 0xf2, 0x47, 0x3c, 0x44, 0x63, 0x25, 0xa6, 0x32, 0xbc, 0x10, 0x1d, 0x64, 0x2a,
-	0x46, 0xdd, 0x5c, 0x0c, 0xb8, 0x38, 0x0a, 0x4e, 0x2e, 0x4d, 0xa1, 0x47, 0x69, 0x2c, 0x3d, 0xec,
-	0x5d, 0xa3, 0x6e, 0x7e, 0x04, 0xdd, 0xfc, 0x08, 0x7e, 0x14, 0x46, 0x46, 0x26, 0x95, 0x63, 0x71,
-	0xe4, 0x23, 0x98, 0xbb, 0xb6, 0x04, 0xdc, 0x7a, 0xef, 0xef, 0xfd, 0xe5, 0x79, 0x72, 0x3d, 0x5c,
-	0x64, 0xdc, 0xe6, 0xcc, 0x1c, 0x85, 0x94, 0x53, 0x3d, 0xa7, 0x0e, 0x95, 0xb2, 0x4b, 0x5d, 0xaa,
-	0x26, 0x0d, 0xf9, 0x15, 0xc3, 0x0a, 0xb8, 0x94, 0xba, 0x3e, 0x69, 0xa8, 0x53, 0x37, 0xea, 0x37,
-	0x9c, 0x28, 0xb4, 0xb9, 0x47, 0x83, 0x98, 0x1f, 0xbd, 0x67, 0x70, 0xae, 0x23, 0x7d, 0xfd, 0x0a,
-	0x6f, 0x3d, 0xd9, 0xbe, 0x6f, 0x71, 0x6f, 0x48, 0x0c, 0x54, 0x43, 0xf5, 0xe2, 0xd9, 0xa1, 0x19,
-	0xdb, 0x66, 0x6a, 0x9b, 0xd7, 0x89, 0xdd, 0x2c, 0x8c, 0xbf, 0xaa, 0xda, 0xc7, 0x77, 0x15, 0xb5,
-	0x0b, 0xd2, 0xba, 0xf3, 0x86, 0x44, 0x3f, 0xc5, 0xe5, 0x3e, 0xe1, 0xbd, 0x01, 0x71, 0x2c, 0x46,
-	0x42, 0x8f, 0x30, 0xab, 0x47, 0xa3, 0x80, 0x1b, 0x1b, 0x35, 0x54, 0xcf, 0xb6, 0xf5, 0x84, 0x75,
-	0x14, 0x6a, 0x49, 0xa2, 0x9b, 0x78, 0x3f, 0x35, 0x7a, 0x83, 0x28, 0x78, 0xb0, 0xba, 0x2f, 0x9c,
-	0x30, 0x23, 0xa3, 0x84, 0xbd, 0x04, 0xb5, 0x24, 0x69, 0x4a, 0xb0, 0x9a, 0xa0, 0xf6, 0xd3, 0x84,
-	0xec, 0x5a, 0x82, 0x12, 0x92, 0x84, 0x13, 0xbc, 0xcb, 0x06, 0x76, 0xe8, 0x10, 0xc7, 0x7a, 0x8c,
-	0x54, 0xb2, 0x91, 0xab, 0xa1, 0x7a, 0xa9, 0xbd, 0x93, 0x8c, 0x6f, 0xe3, 0xa9, 0x7e, 0x8c, 0x4b,
-	0x6c, 0xe4, 0x7b, 0x7c, 0xb9, 0x96, 0x57, 0x6b, 0xdb, 0x6a, 0x98, 0x2e, 0xad, 0xf4, 0xf5, 0x02,
-	0x87, 0x3c, 0x27, 0x7d, 0x37, 0xd7, 0xfa, 0xde, 0x48, 0x12, 0xf7, 0xbd, 0xc0, 0x07, 0x84, 0x71,
-	0x6f, 0x68, 0xf3, 0xff, 0x77, 0x52, 0x50, 0x4a, 0x79, 0x49, 0x57, 0x6e, 0xa5, 0x79, 0x39, 0x99,
-	0x81, 0x36, 0x9d, 0x81, 0xb6, 0x98, 0x01, 0x7a, 0x15, 0x80, 0x3e, 0x05, 0xa0, 0xb1, 0x00, 0x34,
-	0x11, 0x80, 0x7e, 0x04, 0xa0, 0x5f, 0x01, 0xda, 0x42, 0x00, 0x7a, 0x9b, 0x83, 0x36, 0x99, 0x83,
-	0x36, 0x9d, 0x83, 0x76, 0x1f, 0x3f, 0x83, 0x6e, 0x5e, 0xfd, 0xab, 0xf3, 0xbf, 0x00, 0x00, 0x00,
-	0xff, 0xff, 0xba, 0xe5, 0x86, 0x2e, 0x23, 0x02, 0x00, 0x00,
+	// 449 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x92, 0x31, 0x6f, 0xd3, 0x40,
+	0x14, 0xc7, 0x7d, 0x90, 0x94, 0xf4, 0x92, 0x40, 0x7b, 0x44, 0xc8, 0x74, 0xb8, 0x06, 0x18, 0x88,
+	0x84, 0xe4, 0x20, 0x60, 0x63, 0x41, 0x29, 0x12, 0xb0, 0xd1, 0x84, 0x89, 0xc5, 0xba, 0xc4, 0xaf,
+	0x8e, 0x55, 0xc7, 0x67, 0x7c, 0x67, 0x95, 0x6e, 0x7c, 0x04, 0x46, 0x3e, 0x02, 0x1f, 0xa5, 0x63,
+	0xc6, 0x4e, 0x40, 0x9c, 0x85, 0xb1, 0x9f, 0x00, 0xa1, 0x7b, 0x77, 0xae, 0xd2, 0x4e, 0xdd, 0x7c,
+	0xff, 0xdf, 0xfb, 0xdd, 0x7b, 0xba, 0x67, 0xda, 0x56, 0x5a, 0x68, 0x15, 0xe4, 0x85, 0xd4, 0x92,
+	0x35, 0xf1, 0xb0, 0xd7, 0x8b, 0x65, 0x2c, 0x31, 0x19, 0x9a, 0x2f, 0x0b, 0xf7, 0x78, 0x2c, 0x65,
+	0x9c, 0xc2, 0x10, 0x4f, 0xd3, 0xf2, 0x68, 0x18, 0x95, 0x85, 0xd0, 0x89, 0xcc, 0x2c, 0x7f, 0xfc,
+	0xaf, 0x41, 0x9b, 0x13, 0xe3, 0xb3, 0x37, 0x74, 0xfb, 0x44, 0xa4, 0x69, 0xa8, 0x93, 0x05, 0xf8,
+	0xa4, 0x4f, 0x06, 0xed, 0x17, 0x0f, 0x03, 0x6b, 0x07, 0xb5, 0x1d, 0xbc, 0x75, 0xf6, 0xa8, 0x75,
+	0xf6, 0x6b, 0xdf, 0xfb, 0xf1, 0x7b, 0x9f, 0x8c, 0x5b, 0xc6, 0xfa, 0x94, 0x2c, 0x80, 0x3d, 0xa7,
+	0xbd, 0x23, 0xd0, 0xb3, 0x39, 0x44, 0xa1, 0x82, 0x22, 0x01, 0x15, 0xce, 0x64, 0x99, 0x69, 0xff,
+	0x56, 0x9f, 0x0c, 0x1a, 0x63, 0xe6, 0xd8, 0x04, 0xd1, 0x81, 0x21, 0x2c, 0xa0, 0xf7, 0x6b, 0x63,
+	0x36, 0x2f, 0xb3, 0xe3, 0x70, 0x7a, 0xaa, 0x41, 0xf9, 0xb7, 0x51, 0xd8, 0x75, 0xe8, 0xc0, 0x90,
+	0x91, 0x01, 0x9b, 0x1d, 0xb0, 0xbe, 0xee, 0xd0, 0xb8, 0xd2, 0x01, 0x05, 0xd7, 0xe1, 0x29, 0xbd,
+	0xa7, 0xe6, 0xa2, 0x88, 0x20, 0x0a, 0xbf, 0x94, 0xd8, 0xd9, 0x6f, 0xf6, 0xc9, 0xa0, 0x3b, 0xbe,
+	0xeb, 0xe2, 0x43, 0x9b, 0xb2, 0x27, 0xb4, 0xab, 0xf2, 0x34, 0xd1, 0x97, 0x65, 0x5b, 0x58, 0xd6,
+	0xc1, 0xb0, 0x2e, 0xda, 0x98, 0x37, 0xc9, 0x22, 0xf8, 0xea, 0xe6, 0xbd, 0x73, 0x65, 0xde, 0x0f,
+	0x86, 0xd8, 0x79, 0x5f, 0xd1, 0x07, 0xa0, 0x74, 0xb2, 0x10, 0xfa, 0xfa, 0x9b, 0xb4, 0x50, 0xe9,
+	0x5d, 0xd2, 0xcd, 0x57, 0x79, 0x46, 0x77, 0x95, 0x58, 0xe4, 0x29, 0xa8, 0x30, 0x2f, 0xe4, 0x0c,
+	0x94, 0x82, 0xc8, 0xdf, 0x46, 0x61, 0xc7, 0x81, 0x8f, 0x75, 0xce, 0x1e, 0xd1, 0x4e, 0x0e, 0xe2,
+	0x38, 0x74, 0xc0, 0xa7, 0x58, 0xd7, 0x36, 0xd9, 0xc4, 0x46, 0xec, 0x90, 0x32, 0xa5, 0x65, 0x01,
+	0x61, 0x2c, 0x34, 0x9c, 0x88, 0x53, 0xbb, 0xe2, 0xf6, 0xcd, 0x57, 0xbc, 0x83, 0xfa, 0x3b, 0x6b,
+	0xe3, 0xaa, 0xdf, 0xd3, 0x6e, 0x92, 0xc5, 0xa0, 0x34, 0x14, 0xf6, 0xb6, 0xce, 0xcd, 0x6f, 0xeb,
+	0xd4, 0xa6, 0xb9, 0x69, 0xf4, 0x7a, 0xb9, 0xe2, 0xde, 0xf9, 0x8a, 0x7b, 0x17, 0x2b, 0x4e, 0xbe,
+	0x55, 0x9c, 0xfc, 0xac, 0x38, 0x39, 0xab, 0x38, 0x59, 0x56, 0x9c, 0xfc, 0xa9, 0x38, 0xf9, 0x5b,
+	0x71, 0xef, 0xa2, 0xe2, 0xe4, 0xfb, 0x9a, 0x7b, 0xcb, 0x35, 0xf7, 0xce, 0xd7, 0xdc, 0xfb, 0x6c,
+	0xff, 0xf9, 0xe9, 0x16, 0xf6, 0x79, 0xf9, 0x7f, 0x00, 0xe3, 0x55, 0x43, 0x77, 0x10, 0x03, 0x00,
+	0x00,
 }
 
 func (this *Stats) Equal(that interface{}) bool {
@@ -212,13 +254,25 @@ func (this *Stats) Equal(that interface{}) bool {
 	if this.EstimatedSeriesCount != that1.EstimatedSeriesCount {
 		return false
 	}
+	if this.SamplesProcessed != that1.SamplesProcessed {
+		return false
+	}
+	if this.PeakSamples != that1.PeakSamples {
+		return false
+	}
+	if this.StoreGatewayTime != that1.StoreGatewayTime {
+		return false
+	}
+	if this.IngesterTime != that1.IngesterTime {
+		return false
+	}
 	return true
 }
 func (this *Stats) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 12)
+	s := make([]string, 0, 16)
 	s = append(s, "&stats.Stats{")
 	s = append(s, "WallTime: "+fmt.Sprintf("%#v", this.WallTime)+",\n")
 	s = append(s, "FetchedSeriesCount: "+fmt.Sprintf("%#v", this.FetchedSeriesCount)+",\n")
@@ -228,6 +282,10 @@ func (this *Stats) GoString() string {
 	s = append(s, "SplitQueries: "+fmt.Sprintf("%#v", this.SplitQueries)+",\n")
 	s = append(s, "FetchedIndexBytes: "+fmt.Sprintf("%#v", this.FetchedIndexBytes)+",\n")
 	s = append(s, "EstimatedSeriesCount: "+fmt.Sprintf("%#v", this.EstimatedSeriesCount)+",\n")
+	s = append(s, "SamplesProcessed: "+fmt.Sprintf("%#v", this.SamplesProcessed)+",\n")
+	s = append(s, "PeakSamples: "+fmt.Sprintf("%#v", this.PeakSamples)+",\n")
+	s = append(s, "StoreGatewayTime: "+fmt.Sprintf("%#v", this.StoreGatewayTime)+",\n")
+	s = append(s, "IngesterTime: "+fmt.Sprintf("%#v", this.IngesterTime)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -259,6 +317,32 @@ func (m *Stats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	n1, err1 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.IngesterTime, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.IngesterTime):])
+	if err1 != nil {
+		return 0, err1
+	}
+	i -= n1
+	i = encodeVarintStats(dAtA, i, uint64(n1))
+	i--
+	dAtA[i] = 0x62
+	n2, err2 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.StoreGatewayTime, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.StoreGatewayTime):])
+	if err2 != nil {
+		return 0, err2
+	}
+	i -= n2
+	i = encodeVarintStats(dAtA, i, uint64(n2))
+	i--
+	dAtA[i] = 0x5a
+	if m.PeakSamples != 0 {
+		i = encodeVarintStats(dAtA, i, uint64(m.PeakSamples))
+		i--
+		dAtA[i] = 0x50
+	}
+	if m.SamplesProcessed != 0 {
+		i = encodeVarintStats(dAtA, i, uint64(m.SamplesProcessed))
+		i--
+		dAtA[i] = 0x48
+	}
 	if m.EstimatedSeriesCount != 0 {
 		i = encodeVarintStats(dAtA, i, uint64(m.EstimatedSeriesCount))
 		i--
@@ -294,12 +378,12 @@ func (m *Stats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i--
 		dAtA[i] = 0x10
 	}
-	n1, err1 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.WallTime, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.WallTime):])
-	if err1 != nil {
-		return 0, err1
+	n3, err3 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.WallTime, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.WallTime):])
+	if err3 != nil {
+		return 0, err3
 	}
-	i -= n1
-	i = encodeVarintStats(dAtA, i, uint64(n1))
+	i -= n3
+	i = encodeVarintStats(dAtA, i, uint64(n3))
 	i--
 	dAtA[i] = 0xa
 	return len(dAtA) - i, nil
@@ -345,6 +429,16 @@ func (m *Stats) Size() (n int) {
 	if m.EstimatedSeriesCount != 0 {
 		n += 1 + sovStats(uint64(m.EstimatedSeriesCount))
 	}
+	if m.SamplesProcessed != 0 {
+		n += 1 + sovStats(uint64(m.SamplesProcessed))
+	}
+	if m.PeakSamples != 0 {
+		n += 1 + sovStats(uint64(m.PeakSamples))
+	}
+	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.StoreGatewayTime)
+	n += 1 + l + sovStats(uint64(l))
+	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.IngesterTime)
+	n += 1 + l + sovStats(uint64(l))
 	return n
 }
 
@@ -367,6 +461,10 @@ func (this *Stats) String() string {
 		`SplitQueries:` + fmt.Sprintf("%v", this.SplitQueries) + `,`,
 		`FetchedIndexBytes:` + fmt.Sprintf("%v", this.FetchedIndexBytes) + `,`,
 		`EstimatedSeriesCount:` + fmt.Sprintf("%v", this.EstimatedSeriesCount) + `,`,
+		`SamplesProcessed:` + fmt.Sprintf("%v", this.SamplesProcessed) + `,`,
+		`PeakSamples:` + fmt.Sprintf("%v", this.PeakSamples) + `,`,
+		`StoreGatewayTime:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.StoreGatewayTime), "Duration", "duration.Duration", 1), `&`, ``, 1) + `,`,
+		`IngesterTime:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.IngesterTime), "Duration", "duration.Duration", 1), `&`, ``, 1) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -574,6 +672,110 @@ func (m *Stats) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 9:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SamplesProcessed", wireType)
+			}
+			m.SamplesProcessed = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SamplesProcessed |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PeakSamples", wireType)
+			}
+			m.PeakSamples = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PeakSamples |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 11:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StoreGatewayTime", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthStats
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthStats
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdDurationUnmarshal(&m.StoreGatewayTime, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 12:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field IngesterTime", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthStats
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthStats
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdDurationUnmarshal(&m.IngesterTime, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipStats(dAtA[iNdEx:])
@@ -115,6 +115,77 @@ func TestStats_AddSplitQueries(t *testing.T) {
 	})
 }
 
+func TestStats_AddSamplesProcessed(t *testing.T) {
+	t.Run("add and load samples processed", func(t *testing.T) {
+		stats, _ := ContextWithEmptyStats(context.Background())
+		stats.AddSamplesProcessed(100)
+		stats.AddSamplesProcessed(50)
+
+		assert.Equal(t, uint64(150), stats.LoadSamplesProcessed())
+	})
+
+	t.Run("add and load samples processed nil receiver", func(t *testing.T) {
+		var stats *Stats
+		stats.AddSamplesProcessed(50)
+
+		assert.Equal(t, uint64(0), stats.LoadSamplesProcessed())
+	})
+}
+
+func TestStats_UpdatePeakSamples(t *testing.T) {
+	t.Run("update and load peak samples", func(t *testing.T) {
+		stats, _ := ContextWithEmptyStats(context.Background())
+		stats.UpdatePeakSamples(100)
+		stats.UpdatePeakSamples(50)
+
+		assert.Equal(t, uint64(100), stats.LoadPeakSamples())
+
+		stats.UpdatePeakSamples(150)
+		assert.Equal(t, uint64(150), stats.LoadPeakSamples())
+	})
+
+	t.Run("update and load peak samples nil receiver", func(t *testing.T) {
+		var stats *Stats
+		stats.UpdatePeakSamples(50)
+
+		assert.Equal(t, uint64(0), stats.LoadPeakSamples())
+	})
+}
+
+func TestStats_StoreGatewayTime(t *testing.T) {
+	t.Run("add and load store-gateway time", func(t *testing.T) {
+		stats, _ := ContextWithEmptyStats(context.Background())
+		stats.AddStoreGatewayTime(time.Second)
+		stats.AddStoreGatewayTime(time.Second)
+
+		assert.Equal(t, 2*time.Second, stats.LoadStoreGatewayTime())
+	})
+
+	t.Run("add and load store-gateway time nil receiver", func(t *testing.T) {
+		var stats *Stats
+		stats.AddStoreGatewayTime(time.Second)
+
+		assert.Equal(t, time.Duration(0), stats.LoadStoreGatewayTime())
+	})
+}
+
+func TestStats_IngesterTime(t *testing.T) {
+	t.Run("add and load ingester time", func(t *testing.T) {
+		stats, _ := ContextWithEmptyStats(context.Background())
+		stats.AddIngesterTime(time.Second)
+		stats.AddIngesterTime(time.Second)
+
+		assert.Equal(t, 2*time.Second, stats.LoadIngesterTime())
+	})
+
+	t.Run("add and load ingester time nil receiver", func(t *testing.T) {
+		var stats *Stats
+		stats.AddIngesterTime(time.Second)
+
+		assert.Equal(t, time.Duration(0), stats.LoadIngesterTime())
+	})
+}
+
 func TestStats_Merge(t *testing.T) {
 	t.Run("merge two stats objects", func(t *testing.T) {
 		stats1 := &Stats{}
@@ -124,6 +195,10 @@ func TestStats_Merge(t *testing.T) {
 		stats1.AddFetchedChunks(10)
 		stats1.AddShardedQueries(20)
 		stats1.AddSplitQueries(10)
+		stats1.AddSamplesProcessed(100)
+		stats1.UpdatePeakSamples(30)
+		stats1.AddStoreGatewayTime(time.Millisecond)
+		stats1.AddIngesterTime(time.Second)
 
 		stats2 := &Stats{}
 		stats2.AddWallTime(time.Second)
@@ -132,6 +207,10 @@ func TestStats_Merge(t *testing.T) {
 		stats2.AddFetchedChunks(11)
 		stats2.AddShardedQueries(21)
 		stats2.AddSplitQueries(11)
+		stats2.AddSamplesProcessed(200)
+		stats2.UpdatePeakSamples(20)
+		stats2.AddStoreGatewayTime(time.Second)
+		stats2.AddIngesterTime(time.Millisecond)
 
 		stats1.Merge(stats2)
 
@@ -141,6 +220,10 @@ func TestStats_Merge(t *testing.T) {
 		assert.Equal(t, uint64(21), stats1.LoadFetchedChunks())
 		assert.Equal(t, uint32(41), stats1.LoadShardedQueries())
 		assert.Equal(t, uint32(21), stats1.LoadSplitQueries())
+		assert.Equal(t, uint64(300), stats1.LoadSamplesProcessed())
+		assert.Equal(t, uint64(30), stats1.LoadPeakSamples())
+		assert.Equal(t, 1001*time.Millisecond, stats1.LoadStoreGatewayTime())
+		assert.Equal(t, 1001*time.Millisecond, stats1.LoadIngesterTime())
 	})
 
 	t.Run("merge two nil stats objects", func(t *testing.T) {
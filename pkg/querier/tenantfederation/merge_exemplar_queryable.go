@@ -14,6 +14,7 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
 )
 
@@ -195,12 +196,9 @@ func (m *mergeExemplarQuerier) Select(start, end int64, matchers ...[]*labels.Ma
 		return nil, err
 	}
 
-	var out []exemplar.QueryResult
-	for _, exemplars := range results {
-		out = append(out, exemplars...)
-	}
-
-	return out, nil
+	// The exemplars of the same series returned for different tenants, for example because the series
+	// already has the tenant ID label, are merged.
+	return block.MergeExemplars(results...), nil
 }
 
 func filterTenantsAndRewriteMatchers(idLabelName string, ids []string, allMatchers [][]*labels.Matcher) (map[string]struct{}, [][]*labels.Matcher) {
@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// TombstonesLoader returns the pending series deletion tombstones of a tenant,
+// whose samples should be masked at query time.
+type TombstonesLoader interface {
+	GetTombstones(ctx context.Context, userID string) (bucketindex.Tombstones, error)
+}
+
+type retentionRulesProvider interface {
+	CompactorBlocksRetentionRules(userID string) validation.RetentionRules
+}
+
+// retentionTombstonesLoader is a TombstonesLoader which returns, in addition to the tombstones
+// of the wrapped loader, a tombstone for each retention rule of the tenant. This way samples
+// expired by a retention rule are masked until the compactor deletes them from the blocks.
+type retentionTombstonesLoader struct {
+	next   TombstonesLoader
+	limits retentionRulesProvider
+}
+
+func (l *retentionTombstonesLoader) GetTombstones(ctx context.Context, userID string) (bucketindex.Tombstones, error) {
+	pending, err := l.next.GetTombstones(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := l.limits.CompactorBlocksRetentionRules(userID)
+	if len(rules) == 0 {
+		return pending, nil
+	}
+
+	retention, err := bucketindex.NewRetentionTombstones(rules, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Do not append to the pending tombstones, because they may be shared with other queries.
+	out := make(bucketindex.Tombstones, 0, len(pending)+len(retention))
+	out = append(out, pending...)
+	return append(out, retention...), nil
+}
+
+// maskDeletedSeries wraps the input series set in order to remove the samples deleted by the
+// tombstones overlapping the [minT, maxT] time range. If no tombstone overlaps, the input set
+// is returned as is.
+//
+// Tombstones are only applied to the series returned by Select: the label names and values
+// of deleted series keep being returned by LabelNames and LabelValues until the series are
+// purged from the blocks, because filtering them would require to look up every series.
+func maskDeletedSeries(ctx context.Context, loader TombstonesLoader, userID string, minT, maxT int64, set storage.SeriesSet) storage.SeriesSet {
+	if loader == nil {
+		return set
+	}
+
+	all, err := loader.GetTombstones(ctx, userID)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	matchers, err := compileTombstones(all.Overlapping(minT, maxT))
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+	if len(matchers) == 0 {
+		return set
+	}
+
+	return &deletedSeriesSet{
+		SeriesSet:  set,
+		tombstones: matchers,
+		minT:       minT,
+		maxT:       maxT,
+	}
+}
+
+type compiledTombstone struct {
+	interval  tombstones.Interval
+	selectors [][]*labels.Matcher
+}
+
+func compileTombstones(tombstones bucketindex.Tombstones) ([]compiledTombstone, error) {
+	out := make([]compiledTombstone, 0, len(tombstones))
+	for _, t := range tombstones {
+		selectors, err := t.Matchers()
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, compiledTombstone{
+			interval:  tombstoneInterval(t),
+			selectors: selectors,
+		})
+	}
+	return out, nil
+}
+
+func tombstoneInterval(t *bucketindex.Tombstone) tombstones.Interval {
+	return tombstones.Interval{Mint: t.StartTime, Maxt: t.EndTime}
+}
+
+// deletedIntervals returns the deleted intervals for the series with the given labels.
+func deletedIntervals(compiled []compiledTombstone, lbls labels.Labels) tombstones.Intervals {
+	var out tombstones.Intervals
+
+	for _, t := range compiled {
+		for _, selector := range t.selectors {
+			if matchesAll(selector, lbls) {
+				out = out.Add(t.interval)
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+func matchesAll(matchers []*labels.Matcher, lbls labels.Labels) bool {
+	for _, m := range matchers {
+		if !m.Matches(lbls.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// deletedSeriesSet is a storage.SeriesSet removing the samples deleted by tombstones.
+// Series whose samples have all been deleted within the queried time range are skipped.
+type deletedSeriesSet struct {
+	storage.SeriesSet
+
+	tombstones []compiledTombstone
+	minT, maxT int64
+
+	curr storage.Series
+}
+
+func (s *deletedSeriesSet) Next() bool {
+	for s.SeriesSet.Next() {
+		series := s.SeriesSet.At()
+
+		intervals := deletedIntervals(s.tombstones, series.Labels())
+		if len(intervals) == 0 {
+			s.curr = series
+			return true
+		}
+
+		// Skip the series if all its samples in the queried time range have been deleted.
+		if (tombstones.Interval{Mint: s.minT, Maxt: s.maxT}).IsSubrange(intervals) {
+			continue
+		}
+
+		s.curr = &deletedSeries{Series: series, intervals: intervals}
+		return true
+	}
+
+	return false
+}
+
+func (s *deletedSeriesSet) At() storage.Series {
+	return s.curr
+}
+
+// deletedSeries is a storage.Series whose iterator skips the samples within the deleted intervals.
+type deletedSeries struct {
+	storage.Series
+
+	intervals tombstones.Intervals
+}
+
+func (s *deletedSeries) Iterator(it chunkenc.Iterator) chunkenc.Iterator {
+	if deleted, ok := it.(*tsdb.DeletedIterator); ok {
+		deleted.Iter = s.Series.Iterator(deleted.Iter)
+		deleted.Intervals = s.intervals
+		return deleted
+	}
+
+	return &tsdb.DeletedIterator{Iter: s.Series.Iterator(nil), Intervals: s.intervals}
+}
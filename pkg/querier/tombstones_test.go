@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/series"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+type tombstonesLoaderMock struct {
+	tombstones bucketindex.Tombstones
+	err        error
+}
+
+func (m *tombstonesLoaderMock) GetTombstones(context.Context, string) (bucketindex.Tombstones, error) {
+	return m.tombstones, m.err
+}
+
+func TestMaskDeletedSeries(t *testing.T) {
+	const (
+		minT = 0
+		maxT = 100
+	)
+
+	mustNewTombstone := func(selector string, startTime, endTime int64) *bucketindex.Tombstone {
+		tombstone, err := bucketindex.NewTombstone([]string{selector}, startTime, endTime, time.Now())
+		require.NoError(t, err)
+		return tombstone
+	}
+
+	samples := func(timestamps ...int64) []model.SamplePair {
+		out := make([]model.SamplePair, 0, len(timestamps))
+		for _, ts := range timestamps {
+			out = append(out, model.SamplePair{Timestamp: model.Time(ts), Value: model.SampleValue(ts)})
+		}
+		return out
+	}
+
+	inputSeries := func() storage.SeriesSet {
+		return series.NewConcreteSeriesSetFromSortedSeries([]storage.Series{
+			series.NewConcreteSeries(labels.FromStrings(labels.MetricName, "metric", "job", "first"), samples(10, 20, 30, 40), nil),
+			series.NewConcreteSeries(labels.FromStrings(labels.MetricName, "metric", "job", "second"), samples(10, 20, 30, 40), nil),
+			series.NewConcreteSeries(labels.FromStrings(labels.MetricName, "other", "job", "first"), samples(10, 20, 30, 40), nil),
+		})
+	}
+
+	tests := map[string]struct {
+		loader      TombstonesLoader
+		expected    map[string][]int64
+		expectedErr string
+	}{
+		"no loader": {
+			loader: nil,
+			expected: map[string][]int64{
+				`{__name__="metric", job="first"}`:  {10, 20, 30, 40},
+				`{__name__="metric", job="second"}`: {10, 20, 30, 40},
+				`{__name__="other", job="first"}`:   {10, 20, 30, 40},
+			},
+		},
+		"no tombstones": {
+			loader: &tombstonesLoaderMock{},
+			expected: map[string][]int64{
+				`{__name__="metric", job="first"}`:  {10, 20, 30, 40},
+				`{__name__="metric", job="second"}`: {10, 20, 30, 40},
+				`{__name__="other", job="first"}`:   {10, 20, 30, 40},
+			},
+		},
+		"tombstone not overlapping the queried time range": {
+			loader: &tombstonesLoaderMock{tombstones: bucketindex.Tombstones{
+				mustNewTombstone(`{job="first"}`, maxT+1, maxT+10),
+			}},
+			expected: map[string][]int64{
+				`{__name__="metric", job="first"}`:  {10, 20, 30, 40},
+				`{__name__="metric", job="second"}`: {10, 20, 30, 40},
+				`{__name__="other", job="first"}`:   {10, 20, 30, 40},
+			},
+		},
+		"tombstone partially deleting samples of matching series": {
+			loader: &tombstonesLoaderMock{tombstones: bucketindex.Tombstones{
+				mustNewTombstone(`{job="first"}`, 15, 30),
+			}},
+			expected: map[string][]int64{
+				`{__name__="metric", job="first"}`:  {10, 40},
+				`{__name__="metric", job="second"}`: {10, 20, 30, 40},
+				`{__name__="other", job="first"}`:   {10, 40},
+			},
+		},
+		"multiple tombstones": {
+			loader: &tombstonesLoaderMock{tombstones: bucketindex.Tombstones{
+				mustNewTombstone(`metric{job="first"}`, 15, 30),
+				mustNewTombstone(`{job=~"first|second"}`, 40, 50),
+			}},
+			expected: map[string][]int64{
+				`{__name__="metric", job="first"}`:  {10},
+				`{__name__="metric", job="second"}`: {10, 20, 30},
+				`{__name__="other", job="first"}`:   {10, 20, 30},
+			},
+		},
+		"tombstone deleting the whole queried time range of matching series": {
+			loader: &tombstonesLoaderMock{tombstones: bucketindex.Tombstones{
+				mustNewTombstone(`metric`, minT, maxT),
+			}},
+			expected: map[string][]int64{
+				`{__name__="other", job="first"}`: {10, 20, 30, 40},
+			},
+		},
+		"failed to load tombstones": {
+			loader:      &tombstonesLoaderMock{err: errors.New("failed to load")},
+			expectedErr: "failed to load",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			set := maskDeletedSeries(context.Background(), testData.loader, "user-1", minT, maxT, inputSeries())
+
+			actual := map[string][]int64{}
+			var it chunkenc.Iterator
+			for set.Next() {
+				s := set.At()
+				it = s.Iterator(it)
+
+				timestamps := []int64{}
+				for it.Next() != chunkenc.ValNone {
+					ts, _ := it.At()
+					timestamps = append(timestamps, ts)
+				}
+				require.NoError(t, it.Err())
+
+				actual[s.Labels().String()] = timestamps
+			}
+
+			if testData.expectedErr != "" {
+				require.Error(t, set.Err())
+				assert.Contains(t, set.Err().Error(), testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, set.Err())
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+}
+
+type retentionRulesProviderMock validation.RetentionRules
+
+func (m retentionRulesProviderMock) CompactorBlocksRetentionRules(string) validation.RetentionRules {
+	return validation.RetentionRules(m)
+}
+
+func TestRetentionTombstonesLoader(t *testing.T) {
+	pending, err := bucketindex.NewTombstone([]string{`{job="first"}`}, 10, 20, time.Now())
+	require.NoError(t, err)
+
+	t.Run("should return the wrapped loader tombstones if there are no retention rules", func(t *testing.T) {
+		loader := &retentionTombstonesLoader{
+			next:   &tombstonesLoaderMock{tombstones: bucketindex.Tombstones{pending}},
+			limits: retentionRulesProviderMock(nil),
+		}
+
+		actual, err := loader.GetTombstones(context.Background(), "user-1")
+		require.NoError(t, err)
+		assert.Equal(t, bucketindex.Tombstones{pending}, actual)
+	})
+
+	t.Run("should add a tombstone for each retention rule", func(t *testing.T) {
+		loader := &retentionTombstonesLoader{
+			next: &tombstonesLoaderMock{tombstones: bucketindex.Tombstones{pending}},
+			limits: retentionRulesProviderMock{
+				{Selector: `{__name__=~"debug_.*"}`, Period: model.Duration(time.Hour)},
+			},
+		}
+
+		before := time.Now()
+		actual, err := loader.GetTombstones(context.Background(), "user-1")
+		require.NoError(t, err)
+		require.Len(t, actual, 2)
+		assert.Equal(t, pending, actual[0])
+		assert.Equal(t, []string{`{__name__=~"debug_.*"}`}, actual[1].Selectors)
+		assert.Equal(t, int64(math.MinInt64), actual[1].StartTime)
+		assert.GreaterOrEqual(t, actual[1].EndTime, before.Add(-time.Hour).UnixMilli())
+		assert.LessOrEqual(t, actual[1].EndTime, time.Now().Add(-time.Hour).UnixMilli())
+	})
+
+	t.Run("should fail if the wrapped loader fails", func(t *testing.T) {
+		loader := &retentionTombstonesLoader{
+			next:   &tombstonesLoaderMock{err: errors.New("failed to load")},
+			limits: retentionRulesProviderMock{{Selector: `up`, Period: model.Duration(time.Hour)}},
+		}
+
+		_, err := loader.GetTombstones(context.Background(), "user-1")
+		require.EqualError(t, err, "failed to load")
+	})
+}
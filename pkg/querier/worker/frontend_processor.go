@@ -114,7 +114,7 @@ func (fp *frontendProcessor) process(c frontendv1pb.Frontend_ProcessClient, infl
 			// and cancel the query.  We don't actually handle queries in parallel
 			// here, as we're running in lock step with the server - each Recv is
 			// paired with a Send.
-			go fp.runRequest(ctx, request.HttpRequest, request.StatsEnabled, func(response *httpgrpc.HTTPResponse, stats *querier_stats.Stats) error {
+			go fp.runRequest(ctx, request.HttpRequest, func(response *httpgrpc.HTTPResponse, stats *querier_stats.Stats) error {
 				defer inflightQuery.Store(false)
 
 				return c.Send(&frontendv1pb.ClientToFrontend{
@@ -137,7 +137,7 @@ func (fp *frontendProcessor) process(c frontendv1pb.Frontend_ProcessClient, infl
 	return ctx.Err()
 }
 
-func (fp *frontendProcessor) runRequest(ctx context.Context, request *httpgrpc.HTTPRequest, statsEnabled bool, sendHTTPResponse func(response *httpgrpc.HTTPResponse, stats *querier_stats.Stats) error) {
+func (fp *frontendProcessor) runRequest(ctx context.Context, request *httpgrpc.HTTPRequest, sendHTTPResponse func(response *httpgrpc.HTTPResponse, stats *querier_stats.Stats) error) {
 	// Create a per-request context and cancel it once we're done processing the request.
 	// This is important for queries that stream chunks from ingesters to the querier, as SeriesChunksStreamReader relies
 	// on the context being cancelled to abort streaming and terminate a goroutine if the query is aborted. Requests that
@@ -146,10 +146,9 @@ func (fp *frontendProcessor) runRequest(ctx context.Context, request *httpgrpc.H
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	var stats *querier_stats.Stats
-	if statsEnabled {
-		stats, ctx = querier_stats.ContextWithEmptyStats(ctx)
-	}
+	// The stats are always collected and sent to the query-frontend, because it uses the wall time
+	// to schedule the requests. The query-frontend merges them into the query stats only if enabled.
+	stats, ctx := querier_stats.ContextWithEmptyStats(ctx)
 
 	response, err := fp.handler.Handle(ctx, request)
 	if err != nil {
@@ -177,20 +177,24 @@ func (sp *schedulerProcessor) querierLoop(c schedulerpb.SchedulerForQuerier_Quer
 			}
 			logger := util_log.WithContext(ctx, sp.log)
 
-			sp.runRequest(ctx, logger, request.QueryID, request.FrontendAddress, request.StatsEnabled, request.HttpRequest)
+			wallTime := sp.runRequest(ctx, logger, request.QueryID, request.FrontendAddress, request.StatsEnabled, request.HttpRequest)
 
 			// Report back to scheduler that processing of the query has finished.
-			if err := c.Send(&schedulerpb.QuerierToScheduler{}); err != nil {
+			if err := c.Send(&schedulerpb.QuerierToScheduler{WallTime: wallTime}); err != nil {
 				level.Error(logger).Log("msg", "error notifying scheduler about finished query", "err", err, "addr", address)
 			}
 		}()
 	}
 }
 
-func (sp *schedulerProcessor) runRequest(ctx context.Context, logger log.Logger, queryID uint64, frontendAddress string, statsEnabled bool, request *httpgrpc.HTTPRequest) {
-	var stats *querier_stats.Stats
+// runRequest executes the request, sends the response to the query-frontend, and returns the wall time spent executing it.
+func (sp *schedulerProcessor) runRequest(ctx context.Context, logger log.Logger, queryID uint64, frontendAddress string, statsEnabled bool, request *httpgrpc.HTTPRequest) time.Duration {
+	// The stats are always collected, because the wall time is reported to the query-scheduler,
+	// but they're sent to the query-frontend only if enabled.
+	stats, ctx := querier_stats.ContextWithEmptyStats(ctx)
+	var frontendStats *querier_stats.Stats
 	if statsEnabled {
-		stats, ctx = querier_stats.ContextWithEmptyStats(ctx)
+		frontendStats = stats
 	}
 
 	response, err := sp.handler.Handle(ctx, request)
@@ -227,7 +231,7 @@ func (sp *schedulerProcessor) runRequest(ctx context.Context, logger log.Logger,
 		_, err = c.(frontendv2pb.FrontendForQuerierClient).QueryResult(ctx, &frontendv2pb.QueryResultRequest{
 			QueryID:      queryID,
 			HttpResponse: response,
-			Stats:        stats,
+			Stats:        frontendStats,
 		})
 		if err == nil || retries >= maxNotifyFrontendRetries {
 			break
@@ -242,6 +246,8 @@ func (sp *schedulerProcessor) runRequest(ctx context.Context, logger log.Logger,
 	if err != nil {
 		level.Error(logger).Log("msg", "error notifying frontend about finished query", "err", err, "frontend", frontendAddress)
 	}
+
+	return stats.LoadWallTime()
 }
 
 func (sp *schedulerProcessor) createFrontendClient(addr string) (client.PoolClient, error) {
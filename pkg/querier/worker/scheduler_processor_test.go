@@ -19,6 +19,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 
+	querier_stats "github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/scheduler/schedulerpb"
 )
 
@@ -81,6 +82,9 @@ func TestSchedulerProcessor_processQueriesOnSingleStream(t *testing.T) {
 
 			// Intentionally slow down the query execution, to double check the worker waits until done.
 			time.Sleep(time.Second)
+
+			// Simulate the wall time tracked by the querier handler.
+			querier_stats.FromContext(args.Get(0).(context.Context)).AddWallTime(time.Second)
 		}).Return(&httpgrpc.HTTPResponse{}, nil)
 
 		startTime := time.Now()
@@ -91,9 +95,10 @@ func TestSchedulerProcessor_processQueriesOnSingleStream(t *testing.T) {
 		require.Error(t, loopClient.Context().Err())
 
 		// We expect Send() to be called twice: first to send the querier ID to scheduler
-		// and then to send the query result.
+		// and then to send the query result along with the wall time spent executing it.
 		loopClient.AssertNumberOfCalls(t, "Send", 2)
 		loopClient.AssertCalled(t, "Send", &schedulerpb.QuerierToScheduler{QuerierID: "test-querier-id"})
+		loopClient.AssertCalled(t, "Send", &schedulerpb.QuerierToScheduler{WallTime: time.Second})
 	})
 
 	t.Run("should not log an error when the query-scheduler is terminates while waiting for the next query to run", func(t *testing.T) {
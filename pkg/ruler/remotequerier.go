@@ -30,6 +30,7 @@ import (
 	"golang.org/x/exp/slices"
 	"google.golang.org/grpc"
 
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
 	"github.com/grafana/mimir/pkg/util/version"
 )
@@ -177,7 +178,7 @@ func (q *RemoteQuerier) Read(ctx context.Context, query *prompb.Query) (*prompb.
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	ctx, cancel := context.WithTimeout(queue.ContextWithOutgoingPriority(ctx, queue.PriorityRuleEvaluation), q.timeout)
 	defer cancel()
 
 	resp, err := q.client.Handle(ctx, &req)
@@ -221,7 +222,7 @@ func (q *RemoteQuerier) query(ctx context.Context, query string, ts time.Time, l
 		return promql.Vector{}, nil
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	ctx, cancel := context.WithTimeout(queue.ContextWithOutgoingPriority(ctx, queue.PriorityRuleEvaluation), q.timeout)
 	defer cancel()
 
 	resp, err := q.sendRequest(ctx, &req)
@@ -23,8 +23,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 )
 
 type mockHTTPGRPCClient func(ctx context.Context, req *httpgrpc.HTTPRequest, _ ...grpc.CallOption) (*httpgrpc.HTTPResponse, error)
@@ -35,10 +37,12 @@ func (c mockHTTPGRPCClient) Handle(ctx context.Context, req *httpgrpc.HTTPReques
 
 func TestRemoteQuerier_ReadReq(t *testing.T) {
 	var inReq *httpgrpc.HTTPRequest
+	var inMetadata metadata.MD
 	var body []byte
 
 	mockClientFn := func(ctx context.Context, req *httpgrpc.HTTPRequest, _ ...grpc.CallOption) (*httpgrpc.HTTPResponse, error) {
 		inReq = req
+		inMetadata, _ = metadata.FromOutgoingContext(ctx)
 
 		b, err := proto.Marshal(&prompb.ReadResponse{
 			Results: []*prompb.QueryResult{
@@ -62,6 +66,7 @@ func TestRemoteQuerier_ReadReq(t *testing.T) {
 	require.Equal(t, http.MethodPost, inReq.Method)
 	require.Equal(t, body, inReq.Body)
 	require.Equal(t, "/prometheus/api/v1/read", inReq.Url)
+	require.Equal(t, []string{queue.PriorityRuleEvaluation}, inMetadata.Get("x-mimir-query-priority"))
 }
 
 func TestRemoteQuerier_ReadReqTimeout(t *testing.T) {
@@ -79,8 +84,10 @@ func TestRemoteQuerier_QueryReq(t *testing.T) {
 	for _, format := range allFormats {
 		t.Run(format, func(t *testing.T) {
 			var inReq *httpgrpc.HTTPRequest
+			var inMetadata metadata.MD
 			mockClientFn := func(ctx context.Context, req *httpgrpc.HTTPRequest, _ ...grpc.CallOption) (*httpgrpc.HTTPResponse, error) {
 				inReq = req
+				inMetadata, _ = metadata.FromOutgoingContext(ctx)
 				return &httpgrpc.HTTPResponse{
 					Code: http.StatusOK,
 					Headers: []*httpgrpc.Header{
@@ -101,6 +108,7 @@ func TestRemoteQuerier_QueryReq(t *testing.T) {
 			require.Equal(t, http.MethodPost, inReq.Method)
 			require.Equal(t, "query=qs&time="+url.QueryEscape(tm.Format(time.RFC3339Nano)), string(inReq.Body))
 			require.Equal(t, "/prometheus/api/v1/query", inReq.Url)
+			require.Equal(t, []string{queue.PriorityRuleEvaluation}, inMetadata.Get("x-mimir-query-priority"))
 
 			acceptHeader := getHeader(inReq.Headers, "Accept")
 
@@ -0,0 +1,331 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/grafana/dskit/tenant"
+)
+
+const (
+	// RoundRobinDequeuePolicy gives each tenant with pending requests the same share of the requests dispatched to queriers.
+	RoundRobinDequeuePolicy = "round-robin"
+
+	// WeightedFairDequeuePolicy gives each tenant with pending requests a share of the requests dispatched to queriers
+	// proportional to the tenant's weight.
+	WeightedFairDequeuePolicy = "weighted-fair"
+
+	// QuerierTimeFairDequeuePolicy gives each tenant with pending requests a share of the querier time proportional
+	// to the tenant's weight, prioritising the tenants which have consumed less than their fair share.
+	QuerierTimeFairDequeuePolicy = "querier-time-fair"
+
+	// querierTimeHalfLife is the half-life of the querier time consumed by a tenant, as tracked by
+	// the QuerierTimeFairDequeuePolicy.
+	querierTimeHalfLife = time.Minute
+
+	// querierTimeAvgWeight is the weight of the latest request in the moving average of the querier time per request.
+	querierTimeAvgWeight = 0.1
+)
+
+// DequeuePolicies is the list of supported dequeue policies.
+var DequeuePolicies = []string{RoundRobinDequeuePolicy, WeightedFairDequeuePolicy, QuerierTimeFairDequeuePolicy}
+
+// TenantWeights provides the per-tenant weights used by the weighted dequeue policies.
+type TenantWeights interface {
+	// QuerySchedulingWeight returns the weight of the tenant when choosing which tenant's requests are dispatched
+	// to queriers next. A tenant with a weight of 2 gets twice the share of a tenant with a weight of 1.
+	QuerySchedulingWeight(userID string) float64
+}
+
+// DequeuePolicy chooses the tenant queue the next request is dequeued from.
+// All methods are called with the RequestQueue lock held.
+type DequeuePolicy interface {
+	// SelectUser returns the index in users of the tenant whose queue the next request should be dequeued from.
+	// Only the tenants for which eligible returns true can be selected, and empty entries in users are free spots.
+	// last is the index returned by the previous call for the same querier, or -1. If no tenant can be selected,
+	// the returned bool is false and the returned index is used as last index by the next call.
+	SelectUser(users []string, last int, eligible func(uid int) bool, now time.Time) (int, bool)
+
+	// UserAdded is called when the queue of the tenant has been created.
+	UserAdded(userID string)
+
+	// UserRemoved is called when the queue of the tenant has been removed because it's empty.
+	UserRemoved(userID string)
+
+	// RequestDequeued is called when a request of the tenant has been dequeued.
+	RequestDequeued(userID string, now time.Time)
+
+	// RequestCompleted is called when a request of the tenant has been completed, with the querier time the request
+	// took. It's called for every dequeued request, with zero querier time if the request hasn't been handled by a querier.
+	RequestCompleted(userID string, querierTime time.Duration, now time.Time)
+}
+
+// NewDequeuePolicy returns the dequeue policy with the input name. If the name is empty, the
+// round-robin policy is returned.
+func NewDequeuePolicy(name string, weights TenantWeights) (DequeuePolicy, error) {
+	switch name {
+	case RoundRobinDequeuePolicy, "":
+		return NewRoundRobinDequeuePolicy(), nil
+	case WeightedFairDequeuePolicy:
+		return NewWeightedFairDequeuePolicy(weights), nil
+	case QuerierTimeFairDequeuePolicy:
+		return NewQuerierTimeFairDequeuePolicy(weights), nil
+	default:
+		return nil, fmt.Errorf("unsupported dequeue policy: %s", name)
+	}
+}
+
+type roundRobinPolicy struct{}
+
+// NewRoundRobinDequeuePolicy returns a DequeuePolicy iterating over the tenants with pending requests in turn.
+func NewRoundRobinDequeuePolicy() DequeuePolicy {
+	return roundRobinPolicy{}
+}
+
+func (roundRobinPolicy) SelectUser(users []string, last int, eligible func(uid int) bool, _ time.Time) (int, bool) {
+	uid := last
+
+	for iters := 0; iters < len(users); iters++ {
+		uid = uid + 1
+
+		// Don't use "mod len(users)", as that could skip users at the beginning of the list
+		// for example when users has shrunk since last call.
+		if uid >= len(users) {
+			uid = 0
+		}
+
+		if users[uid] == "" || !eligible(uid) {
+			continue
+		}
+
+		return uid, true
+	}
+	return uid, false
+}
+
+func (roundRobinPolicy) UserAdded(string)                                  {}
+func (roundRobinPolicy) UserRemoved(string)                                {}
+func (roundRobinPolicy) RequestDequeued(string, time.Time)                 {}
+func (roundRobinPolicy) RequestCompleted(string, time.Duration, time.Time) {}
+
+// weightedFairPolicy implements self-clocked fair queuing over the tenant queues, where each request
+// has the same cost. Each tenant's head request is tagged with a virtual finish time, which grows by
+// the inverse of the tenant's weight for each dequeued request, and the request with the lowest
+// virtual finish time is dequeued first.
+type weightedFairPolicy struct {
+	weights TenantWeights
+
+	// Virtual finish time of the last dequeued request.
+	virtualTime float64
+
+	// Virtual finish time of the last dequeued request of each tenant with a queue.
+	finishTimes map[string]float64
+}
+
+// NewWeightedFairDequeuePolicy returns a DequeuePolicy giving each tenant with pending requests
+// a share of the dequeued requests proportional to its weight.
+func NewWeightedFairDequeuePolicy(weights TenantWeights) DequeuePolicy {
+	return &weightedFairPolicy{
+		weights:     weights,
+		finishTimes: map[string]float64{},
+	}
+}
+
+func (p *weightedFairPolicy) SelectUser(users []string, last int, eligible func(uid int) bool, _ time.Time) (int, bool) {
+	return selectLowestScore(users, last, eligible, p.nextFinishTime)
+}
+
+func (p *weightedFairPolicy) nextFinishTime(userID string) float64 {
+	return p.finishTimes[userID] + 1/tenantWeight(p.weights, userID)
+}
+
+func (p *weightedFairPolicy) UserAdded(userID string) {
+	// A tenant which had no pending requests starts from the current virtual time,
+	// so that it can't accumulate credit while it's idle.
+	p.finishTimes[userID] = p.virtualTime
+}
+
+func (p *weightedFairPolicy) UserRemoved(userID string) {
+	delete(p.finishTimes, userID)
+}
+
+func (p *weightedFairPolicy) RequestDequeued(userID string, _ time.Time) {
+	finishTime := p.nextFinishTime(userID)
+	p.finishTimes[userID] = finishTime
+	p.virtualTime = finishTime
+}
+
+func (p *weightedFairPolicy) RequestCompleted(string, time.Duration, time.Time) {}
+
+// querierTimeFairPolicy tracks the querier time consumed by each tenant, decayed exponentially over time,
+// and dequeues the requests of the tenant with the lowest consumed querier time relative to its weight.
+// The requests dispatched to queriers which haven't completed yet are accounted for with the tenant's
+// average querier time per request.
+type querierTimeFairPolicy struct {
+	weights TenantWeights
+
+	tenants map[string]*querierTimeUsage
+
+	// Moving average of the querier time per request across all tenants, in seconds. Used for the
+	// tenants without any completed request.
+	avgRequestTime float64
+
+	lastPrune time.Time
+}
+
+type querierTimeUsage struct {
+	// Querier time consumed by the tenant in seconds, decayed exponentially as of updatedAt.
+	consumed  float64
+	updatedAt time.Time
+
+	// Moving average of the querier time per request of the tenant, in seconds.
+	avgRequestTime float64
+
+	// Number of dequeued requests which haven't completed yet.
+	inflight int
+
+	// True if the tenant has a queue.
+	queued bool
+}
+
+// NewQuerierTimeFairDequeuePolicy returns a DequeuePolicy giving each tenant with pending requests
+// a share of the querier time proportional to its weight.
+func NewQuerierTimeFairDequeuePolicy(weights TenantWeights) DequeuePolicy {
+	return &querierTimeFairPolicy{
+		weights: weights,
+		tenants: map[string]*querierTimeUsage{},
+	}
+}
+
+func (p *querierTimeFairPolicy) SelectUser(users []string, last int, eligible func(uid int) bool, now time.Time) (int, bool) {
+	return selectLowestScore(users, last, eligible, func(userID string) float64 {
+		u := p.tenants[userID]
+		if u == nil {
+			return 0
+		}
+
+		avgRequestTime := u.avgRequestTime
+		if avgRequestTime == 0 {
+			avgRequestTime = p.avgRequestTime
+		}
+		return (u.decayedConsumed(now) + float64(u.inflight)*avgRequestTime) / tenantWeight(p.weights, userID)
+	})
+}
+
+func (p *querierTimeFairPolicy) usage(userID string) *querierTimeUsage {
+	u := p.tenants[userID]
+	if u == nil {
+		u = &querierTimeUsage{}
+		p.tenants[userID] = u
+	}
+	return u
+}
+
+func (p *querierTimeFairPolicy) UserAdded(userID string) {
+	p.usage(userID).queued = true
+}
+
+func (p *querierTimeFairPolicy) UserRemoved(userID string) {
+	if u := p.tenants[userID]; u != nil {
+		u.queued = false
+	}
+}
+
+func (p *querierTimeFairPolicy) RequestDequeued(userID string, _ time.Time) {
+	p.usage(userID).inflight++
+}
+
+func (p *querierTimeFairPolicy) RequestCompleted(userID string, querierTime time.Duration, now time.Time) {
+	u := p.usage(userID)
+	if u.inflight > 0 {
+		u.inflight--
+	}
+
+	if querierTime > 0 {
+		seconds := querierTime.Seconds()
+		u.consumed = u.decayedConsumed(now) + seconds
+		u.updatedAt = now
+		u.avgRequestTime = movingAverage(u.avgRequestTime, seconds)
+		p.avgRequestTime = movingAverage(p.avgRequestTime, seconds)
+	}
+
+	p.prune(now)
+}
+
+// prune stops tracking the tenants without a queue nor in-flight requests, whose consumed querier time has decayed.
+func (p *querierTimeFairPolicy) prune(now time.Time) {
+	if now.Sub(p.lastPrune) < querierTimeHalfLife {
+		return
+	}
+	p.lastPrune = now
+
+	for userID, u := range p.tenants {
+		if !u.queued && u.inflight == 0 && u.decayedConsumed(now) < time.Millisecond.Seconds() {
+			delete(p.tenants, userID)
+		}
+	}
+}
+
+func (u *querierTimeUsage) decayedConsumed(now time.Time) float64 {
+	if u.consumed == 0 || !now.After(u.updatedAt) {
+		return u.consumed
+	}
+	return u.consumed * math.Exp2(-float64(now.Sub(u.updatedAt))/float64(querierTimeHalfLife))
+}
+
+func movingAverage(avg, value float64) float64 {
+	if avg == 0 {
+		return value
+	}
+	return avg + querierTimeAvgWeight*(value-avg)
+}
+
+// selectLowestScore returns the index of the eligible tenant with the lowest score. Ties are broken
+// in round-robin order, starting after last.
+func selectLowestScore(users []string, last int, eligible func(uid int) bool, score func(userID string) float64) (int, bool) {
+	selected, selectedScore := -1, 0.0
+	uid := last
+
+	for iters := 0; iters < len(users); iters++ {
+		uid = uid + 1
+		if uid >= len(users) {
+			uid = 0
+		}
+
+		if users[uid] == "" || !eligible(uid) {
+			continue
+		}
+
+		if s := score(users[uid]); selected < 0 || s < selectedScore {
+			selected, selectedScore = uid, s
+		}
+	}
+
+	if selected < 0 {
+		return uid, false
+	}
+	return selected, true
+}
+
+// tenantWeight returns the weight of the tenant queue. The weight of a queue of multiple tenants
+// is the smallest weight among the tenants.
+func tenantWeight(weights TenantWeights, userID string) float64 {
+	tenantIDs, err := tenant.TenantIDsFromOrgID(userID)
+	if err != nil {
+		tenantIDs = []string{userID}
+	}
+
+	result := 0.0
+	for _, tenantID := range tenantIDs {
+		if w := weights.QuerySchedulingWeight(tenantID); w > 0 && (result == 0 || w < result) {
+			result = w
+		}
+	}
+	if result == 0 {
+		return 1
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockTenantWeights map[string]float64
+
+func (w mockTenantWeights) QuerySchedulingWeight(userID string) float64 {
+	return w[userID]
+}
+
+func allEligible(int) bool {
+	return true
+}
+
+func TestNewDequeuePolicy(t *testing.T) {
+	for _, name := range DequeuePolicies {
+		policy, err := NewDequeuePolicy(name, mockTenantWeights{})
+		require.NoError(t, err)
+		assert.NotNil(t, policy)
+	}
+
+	_, err := NewDequeuePolicy("unknown", mockTenantWeights{})
+	require.EqualError(t, err, "unsupported dequeue policy: unknown")
+}
+
+func TestRoundRobinDequeuePolicy(t *testing.T) {
+	policy := NewRoundRobinDequeuePolicy()
+	users := []string{"user-a", "", "user-b", "user-c"}
+
+	var selected []string
+	last := -1
+	for i := 0; i < 6; i++ {
+		uid, ok := policy.SelectUser(users, last, func(uid int) bool { return users[uid] != "user-c" }, time.Now())
+		require.True(t, ok)
+		selected = append(selected, users[uid])
+		last = uid
+	}
+	assert.Equal(t, []string{"user-a", "user-b", "user-a", "user-b", "user-a", "user-b"}, selected)
+
+	_, ok := policy.SelectUser(users, last, func(int) bool { return false }, time.Now())
+	assert.False(t, ok)
+}
+
+func TestWeightedFairDequeuePolicy(t *testing.T) {
+	policy := NewWeightedFairDequeuePolicy(mockTenantWeights{"user-a": 2, "user-c": 1})
+	users := []string{"user-a", "user-b"}
+	policy.UserAdded("user-a")
+	policy.UserAdded("user-b")
+
+	dequeue := func(users []string, n int) map[string]int {
+		counts := map[string]int{}
+		last := -1
+		for i := 0; i < n; i++ {
+			uid, ok := policy.SelectUser(users, last, allEligible, time.Now())
+			require.True(t, ok)
+			policy.RequestDequeued(users[uid], time.Now())
+			counts[users[uid]]++
+			last = uid
+		}
+		return counts
+	}
+
+	// The tenant without a weight has a weight of 1.
+	assert.Equal(t, map[string]int{"user-a": 20, "user-b": 10}, dequeue(users, 30))
+
+	// A tenant which had no pending requests doesn't get more than its share once it's added.
+	policy.UserRemoved("user-b")
+	assert.Equal(t, map[string]int{"user-a": 30}, dequeue([]string{"user-a", ""}, 30))
+
+	policy.UserAdded("user-c")
+	assert.Equal(t, map[string]int{"user-a": 20, "user-c": 10}, dequeue([]string{"user-a", "user-c"}, 30))
+}
+
+func TestQuerierTimeFairDequeuePolicy(t *testing.T) {
+	querierTimes := map[string]time.Duration{"user-a": 10 * time.Second, "user-b": time.Second}
+
+	tests := map[string]struct {
+		weights        mockTenantWeights
+		expectedCounts map[string]int
+	}{
+		"tenants with the same weight get the same querier time": {
+			weights:        mockTenantWeights{},
+			expectedCounts: map[string]int{"user-a": 10, "user-b": 100},
+		},
+		"tenants get querier time proportional to their weight": {
+			weights:        mockTenantWeights{"user-a": 2},
+			expectedCounts: map[string]int{"user-a": 19, "user-b": 91},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			policy := NewQuerierTimeFairDequeuePolicy(testData.weights)
+			users := []string{"user-a", "user-b"}
+			policy.UserAdded("user-a")
+			policy.UserAdded("user-b")
+
+			counts := map[string]int{}
+			now := time.Now()
+			last := -1
+			for i := 0; i < 110; i++ {
+				uid, ok := policy.SelectUser(users, last, allEligible, now)
+				require.True(t, ok)
+				userID := users[uid]
+				policy.RequestDequeued(userID, now)
+				policy.RequestCompleted(userID, querierTimes[userID], now)
+				counts[userID]++
+				last = uid
+			}
+
+			assert.Equal(t, testData.expectedCounts, counts)
+		})
+	}
+}
+
+func TestQuerierTimeFairDequeuePolicy_InflightRequests(t *testing.T) {
+	policy := NewQuerierTimeFairDequeuePolicy(mockTenantWeights{})
+	users := []string{"user-a", "user-b"}
+	policy.UserAdded("user-a")
+	policy.UserAdded("user-b")
+
+	now := time.Now()
+	policy.RequestDequeued("user-a", now)
+	policy.RequestCompleted("user-a", time.Second, now)
+	policy.RequestDequeued("user-b", now)
+	policy.RequestCompleted("user-b", time.Second, now)
+
+	// The requests which haven't completed yet are accounted for with the average querier time.
+	policy.RequestDequeued("user-a", now)
+	uid, ok := policy.SelectUser(users, -1, allEligible, now)
+	require.True(t, ok)
+	assert.Equal(t, "user-b", users[uid])
+}
+
+func TestQuerierTimeFairDequeuePolicy_Prune(t *testing.T) {
+	policy := NewQuerierTimeFairDequeuePolicy(mockTenantWeights{}).(*querierTimeFairPolicy)
+
+	now := time.Now()
+	policy.UserAdded("user-a")
+	policy.RequestDequeued("user-a", now)
+	policy.RequestCompleted("user-a", time.Second, now)
+	policy.UserAdded("user-b")
+	policy.RequestDequeued("user-b", now)
+	policy.RequestCompleted("user-b", time.Second, now)
+	policy.UserRemoved("user-b")
+
+	// The consumed querier time decays over time, and the tenants without a queue are eventually pruned.
+	now = now.Add(time.Hour)
+	assert.InDelta(t, 0, policy.tenants["user-a"].decayedConsumed(now), 0.001)
+	policy.RequestDequeued("user-a", now)
+	policy.RequestCompleted("user-a", 0, now)
+
+	assert.Contains(t, policy.tenants, "user-a")
+	assert.NotContains(t, policy.tenants, "user-b")
+}
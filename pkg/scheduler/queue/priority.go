@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// PriorityRuleEvaluation is the priority of the queries run by the ruler to evaluate rules.
+	PriorityRuleEvaluation = "rule-evaluation"
+
+	// PriorityDashboard is the priority of the queries run by Grafana dashboards.
+	PriorityDashboard = "dashboard"
+
+	// PriorityAdhoc is the priority of any other query, for example the ones run from Grafana Explore.
+	PriorityAdhoc = "adhoc"
+
+	// priorityMetadataKey is the gRPC metadata key used by the ruler to set the priority of the queries sent to the
+	// query-frontend over gRPC. It's not an HTTP header, so that external clients can't set the priority of a query.
+	priorityMetadataKey = "x-mimir-query-priority"
+
+	// grafanaDashboardHeader is the HTTP header set by Grafana on the queries run by dashboards.
+	grafanaDashboardHeader = "X-Dashboard-Uid"
+
+	// maxPrioritySkips is the maximum number of consecutive requests dequeued from a tenant queue while skipping
+	// the pending requests of a lower priority. It bounds the starvation of the lower priorities.
+	maxPrioritySkips = 10
+)
+
+// Priorities is the list of supported priorities, from the highest to the lowest.
+var Priorities = []string{PriorityRuleEvaluation, PriorityDashboard, PriorityAdhoc}
+
+type priorityContextKey int
+
+const priorityKey priorityContextKey = 0
+
+// priorityIndex returns the index of the priority in Priorities. Unknown priorities have the lowest priority.
+func priorityIndex(priority string) int {
+	for ix, p := range Priorities {
+		if p == priority {
+			return ix
+		}
+	}
+	return len(Priorities) - 1
+}
+
+// NormalizePriority returns the input priority if supported, or PriorityAdhoc otherwise.
+func NormalizePriority(priority string) string {
+	return Priorities[priorityIndex(priority)]
+}
+
+// ContextWithOutgoingPriority returns a new context setting the priority of the queries sent over gRPC with it.
+func ContextWithOutgoingPriority(ctx context.Context, priority string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, priorityMetadataKey, priority)
+}
+
+// PriorityFromHTTPRequest returns the priority of the query. The priority set with ContextWithOutgoingPriority is
+// honored for the queries received over gRPC, otherwise it's based on the headers set by Grafana.
+func PriorityFromHTTPRequest(r *http.Request) string {
+	if md, ok := metadata.FromIncomingContext(r.Context()); ok {
+		if values := md.Get(priorityMetadataKey); len(values) > 0 && values[0] != "" {
+			return NormalizePriority(values[0])
+		}
+	}
+	if r.Header.Get(grafanaDashboardHeader) != "" {
+		return PriorityDashboard
+	}
+	return PriorityAdhoc
+}
+
+// ContextWithPriority returns a new context carrying the priority of the query.
+func ContextWithPriority(ctx context.Context, priority string) context.Context {
+	return context.WithValue(ctx, priorityKey, priority)
+}
+
+// PriorityFromContext returns the priority of the query carried by the context, or PriorityAdhoc if none.
+func PriorityFromContext(ctx context.Context) string {
+	if priority, ok := ctx.Value(priorityKey).(string); ok {
+		return priority
+	}
+	return PriorityAdhoc
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestPriorityFromHTTPRequest(t *testing.T) {
+	tests := map[string]struct {
+		headers  map[string]string
+		metadata map[string]string
+		expected string
+	}{
+		"no headers": {
+			expected: PriorityAdhoc,
+		},
+		"priority HTTP header is ignored": {
+			headers:  map[string]string{"X-Mimir-Query-Priority": PriorityRuleEvaluation},
+			expected: PriorityAdhoc,
+		},
+		"priority gRPC metadata": {
+			metadata: map[string]string{priorityMetadataKey: PriorityRuleEvaluation},
+			expected: PriorityRuleEvaluation,
+		},
+		"unsupported priority gRPC metadata": {
+			metadata: map[string]string{priorityMetadataKey: "urgent"},
+			expected: PriorityAdhoc,
+		},
+		"Grafana dashboard": {
+			headers:  map[string]string{"X-Dashboard-Uid": "abc"},
+			expected: PriorityDashboard,
+		},
+		"priority gRPC metadata takes precedence over Grafana dashboard": {
+			headers:  map[string]string{"X-Dashboard-Uid": "abc"},
+			metadata: map[string]string{priorityMetadataKey: PriorityRuleEvaluation},
+			expected: PriorityRuleEvaluation,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := context.Background()
+			if testData.metadata != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.New(testData.metadata))
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/api/v1/query", nil)
+			assert.NoError(t, err)
+			for name, value := range testData.headers {
+				req.Header.Set(name, value)
+			}
+
+			assert.Equal(t, testData.expected, PriorityFromHTTPRequest(req))
+		})
+	}
+}
+
+func TestContextWithOutgoingPriority(t *testing.T) {
+	ctx := ContextWithOutgoingPriority(context.Background(), PriorityRuleEvaluation)
+
+	// Simulate the gRPC transport, which sends the outgoing metadata as incoming metadata.
+	md, ok := metadata.FromOutgoingContext(ctx)
+	assert.True(t, ok)
+	req, err := http.NewRequestWithContext(metadata.NewIncomingContext(context.Background(), md), http.MethodGet, "/api/v1/query", nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, PriorityRuleEvaluation, PriorityFromHTTPRequest(req))
+}
+
+func TestPriorityFromContext(t *testing.T) {
+	assert.Equal(t, PriorityAdhoc, PriorityFromContext(context.Background()))
+	assert.Equal(t, PriorityDashboard, PriorityFromContext(ContextWithPriority(context.Background(), PriorityDashboard)))
+}
@@ -50,7 +50,7 @@ type Request interface{}
 
 // RequestQueue holds incoming requests in per-user queues. It also assigns each user specified number of queriers,
 // and when querier asks for next request to handle (using GetNextRequestForQuerier), it returns requests
-// in a fair fashion.
+// in a fair fashion, as defined by the DequeuePolicy.
 type RequestQueue struct {
 	services.Service
 
@@ -61,15 +61,15 @@ type RequestQueue struct {
 	queues  *queues
 	stopped bool
 
-	queueLength       *prometheus.GaugeVec   // Per user and reason.
+	queueLength       *prometheus.GaugeVec   // Per user and priority.
 	discardedRequests *prometheus.CounterVec // Per user.
 
 	enqueueDuration prometheus.Histogram
 }
 
-func NewRequestQueue(maxOutstandingPerTenant int, forgetDelay time.Duration, queueLength *prometheus.GaugeVec, discardedRequests *prometheus.CounterVec, enqueueDuration prometheus.Histogram) *RequestQueue {
+func NewRequestQueue(maxOutstandingPerTenant int, forgetDelay time.Duration, policy DequeuePolicy, queueLength *prometheus.GaugeVec, discardedRequests *prometheus.CounterVec, enqueueDuration prometheus.Histogram) *RequestQueue {
 	q := &RequestQueue{
-		queues:                  newUserQueues(maxOutstandingPerTenant, forgetDelay),
+		queues:                  newUserQueues(maxOutstandingPerTenant, forgetDelay, policy),
 		connectedQuerierWorkers: atomic.NewInt32(0),
 		queueLength:             queueLength,
 		discardedRequests:       discardedRequests,
@@ -82,12 +82,13 @@ func NewRequestQueue(maxOutstandingPerTenant int, forgetDelay time.Duration, que
 	return q
 }
 
-// EnqueueRequest puts the request into the queue. MaxQueries is user-specific value that specifies how many queriers can
-// this user use (zero or negative = all queriers). It is passed to each EnqueueRequest, because it can change
-// between calls.
+// EnqueueRequest puts the request into the queue. Within the user queue, requests with a higher priority are dequeued
+// first, and unsupported priorities are handled as PriorityAdhoc. MaxQueries is user-specific value that specifies
+// how many queriers can this user use (zero or negative = all queriers). It is passed to each EnqueueRequest, because
+// it can change between calls.
 //
 // If request is successfully enqueued, successFn is called with the lock held, before any querier can receive the request.
-func (q *RequestQueue) EnqueueRequest(userID string, req Request, maxQueriers int, successFn func()) error {
+func (q *RequestQueue) EnqueueRequest(userID string, req Request, priority string, maxQueriers int, successFn func()) error {
 	start := time.Now()
 	defer func() {
 		q.enqueueDuration.Observe(time.Since(start).Seconds())
@@ -106,24 +107,25 @@ func (q *RequestQueue) EnqueueRequest(userID string, req Request, maxQueriers in
 		return errors.New("no queue found")
 	}
 
-	select {
-	case queue <- req:
-		q.queueLength.WithLabelValues(userID).Inc()
-		q.cond.Broadcast()
-		// Call this function while holding a lock. This guarantees that no querier can fetch the request before function returns.
-		if successFn != nil {
-			successFn()
-		}
-		return nil
-	default:
+	priorityIx := priorityIndex(priority)
+	if !queue.enqueue(req, priorityIx, q.queues.maxUserQueueSize) {
 		q.discardedRequests.WithLabelValues(userID).Inc()
 		return ErrTooManyRequests
 	}
+
+	q.queueLength.WithLabelValues(userID, Priorities[priorityIx]).Inc()
+	q.cond.Broadcast()
+	// Call this function while holding a lock. This guarantees that no querier can fetch the request before function returns.
+	if successFn != nil {
+		successFn()
+	}
+	return nil
 }
 
 // GetNextRequestForQuerier find next user queue and takes the next request off of it. Will block if there are no requests.
 // By passing user index from previous call of this method, querier guarantees that it iterates over all users fairly.
 // If querier finds that request from the user is already expired, it can get a request for the same user by using UserIndex.ReuseLastUser.
+// The caller must call RequestCompleted once it's done with the returned request.
 func (q *RequestQueue) GetNextRequestForQuerier(ctx context.Context, last UserIndex, querierID string) (Request, UserIndex, error) {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
@@ -145,27 +147,23 @@ FindQueue:
 		return nil, last, err
 	}
 
-	for {
-		queue, userID, idx := q.queues.getNextQueueForQuerier(last.last, querierID)
-		last.last = idx
-		if queue == nil {
-			break
-		}
-
+	now := time.Now()
+	queue, userID, idx := q.queues.getNextQueueForQuerier(last.last, querierID, now)
+	last.last = idx
+	if queue != nil {
 		// Pick next request from the queue.
-		for {
-			request := <-queue
-			if len(queue) == 0 {
-				q.queues.deleteQueue(userID)
-			}
+		request, priorityIx := queue.dequeue()
+		q.queues.policy.RequestDequeued(userID, now)
+		if queue.len() == 0 {
+			q.queues.deleteQueue(userID)
+		}
 
-			q.queueLength.WithLabelValues(userID).Dec()
+		q.queueLength.WithLabelValues(userID, Priorities[priorityIx]).Dec()
 
-			// Tell close() we've processed a request.
-			q.cond.Broadcast()
+		// Tell close() we've processed a request.
+		q.cond.Broadcast()
 
-			return request, last, nil
-		}
+		return request, last, nil
 	}
 
 	// There are no unexpired requests, so we can get back
@@ -174,6 +172,15 @@ FindQueue:
 	goto FindQueue
 }
 
+// RequestCompleted notifies the DequeuePolicy that a request of the user returned by GetNextRequestForQuerier
+// has been completed, and how much querier time it took. The querier time is zero if the request hasn't been
+// handled by a querier, for example because it has expired.
+func (q *RequestQueue) RequestCompleted(userID string, querierTime time.Duration) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.queues.policy.RequestCompleted(userID, querierTime, time.Now())
+}
+
 func (q *RequestQueue) forgetDisconnectedQueriers(_ context.Context) error {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
@@ -28,8 +28,8 @@ func BenchmarkGetNextRequest(b *testing.B) {
 	queues := make([]*RequestQueue, 0, b.N)
 
 	for n := 0; n < b.N; n++ {
-		queue := NewRequestQueue(maxOutstandingPerTenant, 0,
-			promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		queue := NewRequestQueue(maxOutstandingPerTenant, 0, NewRoundRobinDequeuePolicy(),
+			promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"}),
 			promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
 			promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
 		)
@@ -43,7 +43,7 @@ func BenchmarkGetNextRequest(b *testing.B) {
 			for j := 0; j < numTenants; j++ {
 				userID := strconv.Itoa(j)
 
-				err := queue.EnqueueRequest(userID, "request", 0, nil)
+				err := queue.EnqueueRequest(userID, "request", PriorityAdhoc, 0, nil)
 				if err != nil {
 					b.Fatal(err)
 				}
@@ -86,8 +86,8 @@ func BenchmarkQueueRequest(b *testing.B) {
 	requests := make([]string, 0, numTenants)
 
 	for n := 0; n < b.N; n++ {
-		q := NewRequestQueue(maxOutstandingPerTenant, 0,
-			promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		q := NewRequestQueue(maxOutstandingPerTenant, 0, NewRoundRobinDequeuePolicy(),
+			promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"}),
 			promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
 			promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
 		)
@@ -108,7 +108,7 @@ func BenchmarkQueueRequest(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for i := 0; i < maxOutstandingPerTenant; i++ {
 			for j := 0; j < numTenants; j++ {
-				err := queues[n].EnqueueRequest(users[j], requests[j], 0, nil)
+				err := queues[n].EnqueueRequest(users[j], requests[j], PriorityAdhoc, 0, nil)
 				if err != nil {
 					b.Fatal(err)
 				}
@@ -120,8 +120,8 @@ func BenchmarkQueueRequest(b *testing.B) {
 func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBecauseQuerierHasBeenForgotten(t *testing.T) {
 	const forgetDelay = 3 * time.Second
 
-	queue := NewRequestQueue(1, forgetDelay,
-		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+	queue := NewRequestQueue(1, forgetDelay, NewRoundRobinDequeuePolicy(),
+		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"}),
 		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
 		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}))
 
@@ -150,7 +150,7 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBe
 
 	// Enqueue a request from an user which would be assigned to querier-1.
 	// NOTE: "user-1" hash falls in the querier-1 shard.
-	require.NoError(t, queue.EnqueueRequest("user-1", "request", 1, nil))
+	require.NoError(t, queue.EnqueueRequest("user-1", "request", PriorityAdhoc, 1, nil))
 
 	startTime := time.Now()
 	querier2wg.Wait()
@@ -160,6 +160,43 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBe
 	assert.GreaterOrEqual(t, waitTime.Milliseconds(), forgetDelay.Milliseconds())
 }
 
+func TestRequestQueue_Priorities(t *testing.T) {
+	queue := NewRequestQueue(100, 0, NewRoundRobinDequeuePolicy(),
+		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"}),
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}))
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+	})
+	queue.RegisterQuerierConnection("querier-1")
+
+	require.NoError(t, queue.EnqueueRequest("user-1", "adhoc-1", PriorityAdhoc, 0, nil))
+	require.NoError(t, queue.EnqueueRequest("user-1", "unknown-1", "unknown", 0, nil))
+	for i := 0; i < maxPrioritySkips+1; i++ {
+		require.NoError(t, queue.EnqueueRequest("user-1", fmt.Sprintf("dashboard-%d", i), PriorityDashboard, 0, nil))
+	}
+	require.NoError(t, queue.EnqueueRequest("user-1", "rule-evaluation-1", PriorityRuleEvaluation, 0, nil))
+
+	var dequeued []Request
+	for i := 0; i < maxPrioritySkips+4; i++ {
+		req, _, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-1")
+		require.NoError(t, err)
+		dequeued = append(dequeued, req)
+	}
+
+	// Requests with a higher priority are dequeued first, while the requests with a lower priority
+	// are dequeued once they have been skipped maxPrioritySkips times.
+	expected := []Request{"rule-evaluation-1"}
+	for i := 0; i < maxPrioritySkips-1; i++ {
+		expected = append(expected, fmt.Sprintf("dashboard-%d", i))
+	}
+	expected = append(expected, "adhoc-1", fmt.Sprintf("dashboard-%d", maxPrioritySkips-1), fmt.Sprintf("dashboard-%d", maxPrioritySkips), "unknown-1")
+	assert.Equal(t, expected, dequeued)
+}
+
 func TestContextCond(t *testing.T) {
 	t.Run("wait until broadcast", func(t *testing.T) {
 		t.Parallel()
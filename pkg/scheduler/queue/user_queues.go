@@ -48,10 +48,18 @@ type queues struct {
 
 	// Sorted list of querier names, used when creating per-user shard.
 	sortedQueriers []string
+
+	// Chooses the user queue the next request is dequeued from.
+	policy DequeuePolicy
 }
 
 type userQueue struct {
-	ch chan Request
+	// Pending requests, in a FIFO queue for each priority, from the highest to the lowest priority.
+	requests [][]Request
+	length   int
+
+	// Number of consecutive dequeued requests which have skipped the pending requests of each priority.
+	skipped []int
 
 	// If not nil, only these queriers can handle user requests. If nil, all queriers can.
 	// We set this to nil if number of available queriers <= maxQueriers.
@@ -66,7 +74,7 @@ type userQueue struct {
 	index int
 }
 
-func newUserQueues(maxUserQueueSize int, forgetDelay time.Duration) *queues {
+func newUserQueues(maxUserQueueSize int, forgetDelay time.Duration, policy DequeuePolicy) *queues {
 	return &queues{
 		userQueues:       map[string]*userQueue{},
 		users:            nil,
@@ -74,6 +82,7 @@ func newUserQueues(maxUserQueueSize int, forgetDelay time.Duration) *queues {
 		forgetDelay:      forgetDelay,
 		queriers:         map[string]*querier{},
 		sortedQueriers:   nil,
+		policy:           policy,
 	}
 }
 
@@ -89,6 +98,7 @@ func (q *queues) deleteQueue(userID string) {
 
 	delete(q.userQueues, userID)
 	q.users[uq.index] = ""
+	q.policy.UserRemoved(userID)
 
 	// Shrink users list size if possible. This is safe, and no users will be skipped during iteration.
 	for ix := len(q.users) - 1; ix >= 0 && q.users[ix] == ""; ix-- {
@@ -96,11 +106,61 @@ func (q *queues) deleteQueue(userID string) {
 	}
 }
 
+// enqueue adds the request to the queue of its priority, unless the queue already holds maxSize requests.
+func (uq *userQueue) enqueue(req Request, priority int, maxSize int) bool {
+	if uq.length >= maxSize {
+		return false
+	}
+
+	uq.requests[priority] = append(uq.requests[priority], req)
+	uq.length++
+	return true
+}
+
+// dequeue removes the next request from the queue and returns it, along with its priority. Requests with a higher
+// priority are dequeued first, unless the requests of a lower priority have been skipped maxPrioritySkips times.
+// The queue must not be empty.
+func (uq *userQueue) dequeue() (Request, int) {
+	selected := -1
+	for p, requests := range uq.requests {
+		if len(requests) == 0 {
+			continue
+		}
+		if selected < 0 {
+			selected = p
+			continue
+		}
+		if uq.skipped[p] >= maxPrioritySkips {
+			selected = p
+			break
+		}
+	}
+
+	for p, requests := range uq.requests {
+		if p == selected {
+			uq.skipped[p] = 0
+		} else if p > selected && len(requests) > 0 {
+			uq.skipped[p]++
+		}
+	}
+
+	req := uq.requests[selected][0]
+	uq.requests[selected][0] = nil
+	uq.requests[selected] = uq.requests[selected][1:]
+	uq.length--
+
+	return req, selected
+}
+
+func (uq *userQueue) len() int {
+	return uq.length
+}
+
 // Returns existing or new queue for user.
 // MaxQueriers is used to compute which queriers should handle requests for this user.
 // If maxQueriers is <= 0, all queriers can handle this user's requests.
 // If maxQueriers has changed since the last call, queriers for this are recomputed.
-func (q *queues) getOrAddQueue(userID string, maxQueriers int) chan Request {
+func (q *queues) getOrAddQueue(userID string, maxQueriers int) *userQueue {
 	// Empty user is not allowed, as that would break our users list ("" is used for free spot).
 	if userID == "" {
 		return nil
@@ -114,9 +174,10 @@ func (q *queues) getOrAddQueue(userID string, maxQueriers int) chan Request {
 
 	if uq == nil {
 		uq = &userQueue{
-			ch:    make(chan Request, q.maxUserQueueSize),
-			seed:  util.ShuffleShardSeed(userID, ""),
-			index: -1,
+			requests: make([][]Request, len(Priorities)),
+			skipped:  make([]int, len(Priorities)),
+			seed:     util.ShuffleShardSeed(userID, ""),
+			index:    -1,
 		}
 		q.userQueues[userID] = uq
 
@@ -134,6 +195,8 @@ func (q *queues) getOrAddQueue(userID string, maxQueriers int) chan Request {
 			uq.index = len(q.users)
 			q.users = append(q.users, userID)
 		}
+
+		q.policy.UserAdded(userID)
 	}
 
 	if uq.maxQueriers != maxQueriers {
@@ -141,13 +204,13 @@ func (q *queues) getOrAddQueue(userID string, maxQueriers int) chan Request {
 		uq.queriers = shuffleQueriersForUser(uq.seed, maxQueriers, q.sortedQueriers, nil)
 	}
 
-	return uq.ch
+	return uq
 }
 
-// Finds next queue for the querier. To support fair scheduling between users, client is expected
-// to pass last user index returned by this function as argument. Is there was no previous
+// Finds next queue for the querier, as chosen by the dequeue policy. To support fair scheduling between users,
+// client is expected to pass last user index returned by this function as argument. Is there was no previous
 // last user index, use -1.
-func (q *queues) getNextQueueForQuerier(lastUserIndex int, querierID string) (chan Request, string, int) {
+func (q *queues) getNextQueueForQuerier(lastUserIndex int, querierID string, now time.Time) (*userQueue, string, int) {
 	uid := lastUserIndex
 
 	// Ensure the querier is not shutting down. If the querier is shutting down, we shouldn't forward
@@ -156,32 +219,21 @@ func (q *queues) getNextQueueForQuerier(lastUserIndex int, querierID string) (ch
 		return nil, "", uid
 	}
 
-	for iters := 0; iters < len(q.users); iters++ {
-		uid = uid + 1
-
-		// Don't use "mod len(q.users)", as that could skip users at the beginning of the list
-		// for example when q.users has shrunk since last call.
-		if uid >= len(q.users) {
-			uid = 0
-		}
-
-		u := q.users[uid]
-		if u == "" {
-			continue
-		}
-
-		q := q.userQueues[u]
-
-		if q.queriers != nil {
-			if _, ok := q.queriers[querierID]; !ok {
+	uid, ok := q.policy.SelectUser(q.users, uid, func(uid int) bool {
+		if uq := q.userQueues[q.users[uid]]; uq.queriers != nil {
+			if _, ok := uq.queriers[querierID]; !ok {
 				// This querier is not handling the user.
-				continue
+				return false
 			}
 		}
-
-		return q.ch, u, uid
+		return true
+	}, now)
+	if !ok {
+		return nil, "", uid
 	}
-	return nil, "", uid
+
+	u := q.users[uid]
+	return q.userQueues[u], u, uid
 }
 
 func (q *queues) addQuerierConnection(querierID string) {
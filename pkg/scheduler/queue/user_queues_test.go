@@ -19,14 +19,14 @@ import (
 )
 
 func TestQueues(t *testing.T) {
-	uq := newUserQueues(0, 0)
+	uq := newUserQueues(0, 0, NewRoundRobinDequeuePolicy())
 	assert.NotNil(t, uq)
 	assert.NoError(t, isConsistent(uq))
 
 	uq.addQuerierConnection("querier-1")
 	uq.addQuerierConnection("querier-2")
 
-	q, u, lastUserIndex := uq.getNextQueueForQuerier(-1, "querier-1")
+	q, u, lastUserIndex := uq.getNextQueueForQuerier(-1, "querier-1", time.Now())
 	assert.Nil(t, q)
 	assert.Equal(t, "", u)
 
@@ -72,12 +72,12 @@ func TestQueues(t *testing.T) {
 	uq.deleteQueue("four")
 	assert.NoError(t, isConsistent(uq))
 
-	q, _, _ = uq.getNextQueueForQuerier(lastUserIndex, "querier-1")
+	q, _, _ = uq.getNextQueueForQuerier(lastUserIndex, "querier-1", time.Now())
 	assert.Nil(t, q)
 }
 
 func TestQueuesOnTerminatingQuerier(t *testing.T) {
-	uq := newUserQueues(0, 0)
+	uq := newUserQueues(0, 0, NewRoundRobinDequeuePolicy())
 	assert.NotNil(t, uq)
 	assert.NoError(t, isConsistent(uq))
 
@@ -92,7 +92,7 @@ func TestQueuesOnTerminatingQuerier(t *testing.T) {
 
 	// After notify shutdown for querier-2, it's expected to own no queue.
 	uq.notifyQuerierShutdown("querier-2")
-	q, u, _ := uq.getNextQueueForQuerier(-1, "querier-2")
+	q, u, _ := uq.getNextQueueForQuerier(-1, "querier-2", time.Now())
 	assert.Nil(t, q)
 	assert.Equal(t, "", u)
 
@@ -101,13 +101,13 @@ func TestQueuesOnTerminatingQuerier(t *testing.T) {
 
 	// After disconnecting querier-2, it's expected to own no queue.
 	uq.removeQuerier("querier-2")
-	q, u, _ = uq.getNextQueueForQuerier(-1, "querier-2")
+	q, u, _ = uq.getNextQueueForQuerier(-1, "querier-2", time.Now())
 	assert.Nil(t, q)
 	assert.Equal(t, "", u)
 }
 
 func TestQueuesWithQueriers(t *testing.T) {
-	uq := newUserQueues(0, 0)
+	uq := newUserQueues(0, 0, NewRoundRobinDequeuePolicy())
 	assert.NotNil(t, uq)
 	assert.NoError(t, isConsistent(uq))
 
@@ -121,7 +121,7 @@ func TestQueuesWithQueriers(t *testing.T) {
 		uq.addQuerierConnection(qid)
 
 		// No querier has any queues yet.
-		q, u, _ := uq.getNextQueueForQuerier(-1, qid)
+		q, u, _ := uq.getNextQueueForQuerier(-1, qid, time.Now())
 		assert.Nil(t, q)
 		assert.Equal(t, "", u)
 	}
@@ -147,7 +147,7 @@ func TestQueuesWithQueriers(t *testing.T) {
 
 		lastUserIndex := -1
 		for {
-			_, _, newIx := uq.getNextQueueForQuerier(lastUserIndex, qid)
+			_, _, newIx := uq.getNextQueueForQuerier(lastUserIndex, qid, time.Now())
 			if newIx < lastUserIndex {
 				break
 			}
@@ -184,7 +184,7 @@ func TestQueuesConsistency(t *testing.T) {
 
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
-			uq := newUserQueues(0, testData.forgetDelay)
+			uq := newUserQueues(0, testData.forgetDelay, NewRoundRobinDequeuePolicy())
 			assert.NotNil(t, uq)
 			assert.NoError(t, isConsistent(uq))
 
@@ -200,7 +200,7 @@ func TestQueuesConsistency(t *testing.T) {
 					assert.NotNil(t, uq.getOrAddQueue(generateTenant(r), 3))
 				case 1:
 					qid := generateQuerier(r)
-					_, _, luid := uq.getNextQueueForQuerier(lastUserIndexes[qid], qid)
+					_, _, luid := uq.getNextQueueForQuerier(lastUserIndexes[qid], qid, time.Now())
 					lastUserIndexes[qid] = luid
 				case 2:
 					uq.deleteQueue(generateTenant(r))
@@ -233,7 +233,7 @@ func TestQueues_ForgetDelay(t *testing.T) {
 	)
 
 	now := time.Now()
-	uq := newUserQueues(0, forgetDelay)
+	uq := newUserQueues(0, forgetDelay, NewRoundRobinDequeuePolicy())
 	assert.NotNil(t, uq)
 	assert.NoError(t, isConsistent(uq))
 
@@ -325,7 +325,7 @@ func TestQueues_ForgetDelay_ShouldCorrectlyHandleQuerierReconnectingBeforeForget
 	)
 
 	now := time.Now()
-	uq := newUserQueues(0, forgetDelay)
+	uq := newUserQueues(0, forgetDelay, NewRoundRobinDequeuePolicy())
 	assert.NotNil(t, uq)
 	assert.NoError(t, isConsistent(uq))
 
@@ -398,7 +398,7 @@ func generateQuerier(r *rand.Rand) string {
 	return fmt.Sprint("querier-", r.Int()%5)
 }
 
-func getOrAdd(t *testing.T, uq *queues, tenant string, maxQueriers int) chan Request {
+func getOrAdd(t *testing.T, uq *queues, tenant string, maxQueriers int) *userQueue {
 	q := uq.getOrAddQueue(tenant, maxQueriers)
 	assert.NotNil(t, q)
 	assert.NoError(t, isConsistent(uq))
@@ -406,10 +406,10 @@ func getOrAdd(t *testing.T, uq *queues, tenant string, maxQueriers int) chan Req
 	return q
 }
 
-func confirmOrderForQuerier(t *testing.T, uq *queues, querier string, lastUserIndex int, qs ...chan Request) int {
-	var n chan Request
+func confirmOrderForQuerier(t *testing.T, uq *queues, querier string, lastUserIndex int, qs ...*userQueue) int {
+	var n *userQueue
 	for _, q := range qs {
-		n, _, lastUserIndex = uq.getNextQueueForQuerier(lastUserIndex, querier)
+		n, _, lastUserIndex = uq.getNextQueueForQuerier(lastUserIndex, querier, time.Now())
 		assert.Equal(t, q, n)
 		assert.NoError(t, isConsistent(uq))
 	}
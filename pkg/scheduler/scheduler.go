@@ -8,8 +8,10 @@ package scheduler
 import (
 	"context"
 	"flag"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -91,6 +93,7 @@ type connectedFrontend struct {
 type Config struct {
 	MaxOutstandingPerTenant int                       `yaml:"max_outstanding_requests_per_tenant"`
 	QuerierForgetDelay      time.Duration             `yaml:"querier_forget_delay" category:"experimental"`
+	DequeuePolicy           string                    `yaml:"dequeue_policy" category:"experimental"`
 	GRPCClientConfig        grpcclient.Config         `yaml:"grpc_client_config" doc:"description=This configures the gRPC client used to report errors back to the query-frontend."`
 	ServiceDiscovery        schedulerdiscovery.Config `yaml:",inline"`
 }
@@ -98,11 +101,15 @@ type Config struct {
 func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	f.IntVar(&cfg.MaxOutstandingPerTenant, "query-scheduler.max-outstanding-requests-per-tenant", 100, "Maximum number of outstanding requests per tenant per query-scheduler. In-flight requests above this limit will fail with HTTP response status code 429.")
 	f.DurationVar(&cfg.QuerierForgetDelay, "query-scheduler.querier-forget-delay", 0, "If a querier disconnects without sending notification about graceful shutdown, the query-scheduler will keep the querier in the tenant's shard until the forget delay has passed. This feature is useful to reduce the blast radius when shuffle-sharding is enabled.")
+	f.StringVar(&cfg.DequeuePolicy, "query-scheduler.dequeue-policy", queue.RoundRobinDequeuePolicy, fmt.Sprintf("Policy used to choose the tenant whose queued request is dispatched next to a querier. Supported values are: %s. The %s and %s policies use the per-tenant query scheduling weight.", strings.Join(queue.DequeuePolicies, ", "), queue.WeightedFairDequeuePolicy, queue.QuerierTimeFairDequeuePolicy))
 	cfg.GRPCClientConfig.RegisterFlagsWithPrefix("query-scheduler.grpc-client-config", f)
 	cfg.ServiceDiscovery.RegisterFlags(f, logger)
 }
 
 func (cfg *Config) Validate() error {
+	if !util.StringsContain(queue.DequeuePolicies, cfg.DequeuePolicy) {
+		return fmt.Errorf("unsupported query-scheduler dequeue policy (supported values are: %s)", strings.Join(queue.DequeuePolicies, ", "))
+	}
 	return cfg.ServiceDiscovery.Validate()
 }
 
@@ -123,7 +130,7 @@ func NewScheduler(cfg Config, limits Limits, log log.Logger, registerer promethe
 	s.queueLength = promauto.With(registerer).NewGaugeVec(prometheus.GaugeOpts{
 		Name: "cortex_query_scheduler_queue_length",
 		Help: "Number of queries in the queue.",
-	}, []string{"user"})
+	}, []string{"user", "priority"})
 
 	s.cancelledRequests = promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
 		Name: "cortex_query_scheduler_cancelled_requests_total",
@@ -137,7 +144,11 @@ func NewScheduler(cfg Config, limits Limits, log log.Logger, registerer promethe
 		Name: "cortex_query_scheduler_enqueue_duration_seconds",
 		Help: "Time spent by requests waiting to join the queue or be rejected.",
 	})
-	s.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, s.queueLength, s.discardedRequests, enqueueDuration)
+	dequeuePolicy, err := queue.NewDequeuePolicy(cfg.DequeuePolicy, limits)
+	if err != nil {
+		return nil, err
+	}
+	s.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, dequeuePolicy, s.queueLength, s.discardedRequests, enqueueDuration)
 
 	s.queueDuration = promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
 		Name:    "cortex_query_scheduler_queue_duration_seconds",
@@ -187,6 +198,9 @@ func NewScheduler(cfg Config, limits Limits, log log.Logger, registerer promethe
 type Limits interface {
 	// MaxQueriersPerUser returns max queriers to use per tenant, or 0 if shuffle sharding is disabled.
 	MaxQueriersPerUser(user string) int
+
+	// QuerySchedulingWeight returns the weight of the tenant used by the weighted dequeue policies.
+	QuerySchedulingWeight(user string) float64
 }
 
 type schedulerRequest struct {
@@ -356,7 +370,7 @@ func (s *Scheduler) enqueueRequest(requestContext context.Context, frontendAddr
 	maxQueriers := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, s.limits.MaxQueriersPerUser)
 
 	s.activeUsers.UpdateUserTimestamp(userID, now)
-	return s.requestQueue.EnqueueRequest(userID, req, maxQueriers, func() {
+	return s.requestQueue.EnqueueRequest(userID, req, msg.GetPriority(), maxQueriers, func() {
 		shouldCancel = false
 
 		s.pendingRequestsMu.Lock()
@@ -426,6 +440,7 @@ func (s *Scheduler) QuerierLoop(querier schedulerpb.SchedulerForQuerier_QuerierL
 		if r.ctx.Err() != nil {
 			// Remove from pending requests.
 			s.cancelRequestAndRemoveFromPending(r.frontendAddress, r.queryID)
+			s.requestQueue.RequestCompleted(r.userID, 0)
 
 			lastUserIndex = lastUserIndex.ReuseLastUser()
 			continue
@@ -450,9 +465,25 @@ func (s *Scheduler) forwardRequestToQuerier(querier schedulerpb.SchedulerForQuer
 	// Make sure to cancel request at the end to cleanup resources.
 	defer s.cancelRequestAndRemoveFromPending(req.frontendAddress, req.queryID)
 
+	// The querier reports the wall time spent executing the request once it has handled it. If the querier
+	// doesn't report it, the querier time is measured as the time until the querier notifies it has handled
+	// the request, or until the request fails.
+	start := time.Now()
+	querierTime := time.Duration(0)
+	defer func() {
+		if querierTime <= 0 {
+			querierTime = time.Since(start)
+		}
+		s.requestQueue.RequestCompleted(req.userID, querierTime)
+	}()
+
 	// Handle the stream sending & receiving on a goroutine so we can
 	// monitoring the contexts in a select and cancel things appropriately.
-	errCh := make(chan error, 1)
+	type querierResult struct {
+		wallTime time.Duration
+		err      error
+	}
+	resCh := make(chan querierResult, 1)
 	go func() {
 		err := querier.Send(&schedulerpb.SchedulerToQuerier{
 			UserID:          req.userID,
@@ -462,12 +493,12 @@ func (s *Scheduler) forwardRequestToQuerier(querier schedulerpb.SchedulerForQuer
 			StatsEnabled:    req.statsEnabled,
 		})
 		if err != nil {
-			errCh <- err
+			resCh <- querierResult{err: err}
 			return
 		}
 
-		_, err = querier.Recv()
-		errCh <- err
+		resp, err := querier.Recv()
+		resCh <- querierResult{wallTime: resp.GetWallTime(), err: err}
 	}()
 
 	select {
@@ -478,14 +509,16 @@ func (s *Scheduler) forwardRequestToQuerier(querier schedulerpb.SchedulerForQuer
 		s.cancelledRequests.WithLabelValues(req.userID).Inc()
 		return req.ctx.Err()
 
-	case err := <-errCh:
+	case res := <-resCh:
 		// Is there was an error handling this request due to network IO,
 		// then error out this upstream request _and_ stream.
 
-		if err != nil {
-			s.forwardErrorToFrontend(req.ctx, req, err)
+		if res.err != nil {
+			s.forwardErrorToFrontend(req.ctx, req, res.err)
+			return res.err
 		}
-		return err
+		querierTime = res.wallTime
+		return nil
 	}
 }
 
@@ -577,7 +610,7 @@ func (s *Scheduler) stopping(_ error) error {
 }
 
 func (s *Scheduler) cleanupMetricsForInactiveUser(user string) {
-	s.queueLength.DeleteLabelValues(user)
+	s.queueLength.DeletePartialMatch(prometheus.Labels{"user": user})
 	s.discardedRequests.DeleteLabelValues(user)
 	s.cancelledRequests.DeleteLabelValues(user)
 }
@@ -30,6 +30,7 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/grafana/mimir/pkg/frontend/v2/frontendv2pb"
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/scheduler/schedulerpb"
 	"github.com/grafana/mimir/pkg/util/httpgrpcutil"
 )
@@ -435,6 +436,7 @@ func TestSchedulerMetrics(t *testing.T) {
 		QueryID:     1,
 		UserID:      "test",
 		HttpRequest: &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello"},
+		Priority:    queue.PriorityRuleEvaluation,
 	})
 	frontendToScheduler(t, frontendLoop, &schedulerpb.FrontendToScheduler{
 		Type:        schedulerpb.ENQUEUE,
@@ -446,8 +448,8 @@ func TestSchedulerMetrics(t *testing.T) {
 	require.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
 		# HELP cortex_query_scheduler_queue_length Number of queries in the queue.
 		# TYPE cortex_query_scheduler_queue_length gauge
-		cortex_query_scheduler_queue_length{user="another"} 1
-		cortex_query_scheduler_queue_length{user="test"} 1
+		cortex_query_scheduler_queue_length{priority="adhoc",user="another"} 1
+		cortex_query_scheduler_queue_length{priority="rule-evaluation",user="test"} 1
 	`), "cortex_query_scheduler_queue_length"))
 
 	scheduler.cleanupMetricsForInactiveUser("test")
@@ -455,7 +457,7 @@ func TestSchedulerMetrics(t *testing.T) {
 	require.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
 		# HELP cortex_query_scheduler_queue_length Number of queries in the queue.
 		# TYPE cortex_query_scheduler_queue_length gauge
-		cortex_query_scheduler_queue_length{user="another"} 1
+		cortex_query_scheduler_queue_length{priority="adhoc",user="another"} 1
 	`), "cortex_query_scheduler_queue_length"))
 }
 
@@ -520,6 +522,10 @@ func (l limits) MaxQueriersPerUser(_ string) int {
 	return l.queriers
 }
 
+func (l limits) QuerySchedulingWeight(_ string) float64 {
+	return 1
+}
+
 type frontendMock struct {
 	mu   sync.Mutex
 	resp map[uint64]*httpgrpc.HTTPResponse
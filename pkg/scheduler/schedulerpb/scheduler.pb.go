@@ -8,6 +8,8 @@ import (
 	fmt "fmt"
 	_ "github.com/gogo/protobuf/gogoproto"
 	proto "github.com/gogo/protobuf/proto"
+	_ "github.com/gogo/protobuf/types"
+	github_com_gogo_protobuf_types "github.com/gogo/protobuf/types"
 	httpgrpc "github.com/grafana/dskit/httpgrpc"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
@@ -18,12 +20,14 @@ import (
 	reflect "reflect"
 	strconv "strconv"
 	strings "strings"
+	time "time"
 )
 
 // Reference imports to suppress errors if they are not otherwise used.
 var _ = proto.Marshal
 var _ = fmt.Errorf
 var _ = math.Inf
+var _ = time.Kitchen
 
 // This is a compile-time assertion to ensure that this generated file
 // is compatible with the proto package it is being compiled against.
@@ -83,9 +87,12 @@ func (SchedulerToFrontendStatus) EnumDescriptor() ([]byte, []int) {
 }
 
 // Querier reports its own clientID when it connects, so that scheduler knows how many *different* queriers are connected.
-// To signal that querier is ready to accept another request, querier sends empty message.
+// To signal that querier is ready to accept another request, querier sends a message with the wall time spent
+// executing the previous request.
 type QuerierToScheduler struct {
 	QuerierID string `protobuf:"bytes,1,opt,name=querierID,proto3" json:"querierID,omitempty"`
+	// The wall time spent in the querier to execute the request it has just completed.
+	WallTime time.Duration `protobuf:"bytes,2,opt,name=wallTime,proto3,stdduration" json:"wallTime"`
 }
 
 func (m *QuerierToScheduler) Reset()      { *m = QuerierToScheduler{} }
@@ -127,6 +134,13 @@ func (m *QuerierToScheduler) GetQuerierID() string {
 	return ""
 }
 
+func (m *QuerierToScheduler) GetWallTime() time.Duration {
+	if m != nil {
+		return m.WallTime
+	}
+	return 0
+}
+
 type SchedulerToQuerier struct {
 	// Query ID as reported by frontend. When querier sends the response back to frontend (using frontendAddress),
 	// it identifies the query by using this ID.
@@ -219,6 +233,8 @@ type FrontendToScheduler struct {
 	UserID       string                `protobuf:"bytes,4,opt,name=userID,proto3" json:"userID,omitempty"`
 	HttpRequest  *httpgrpc.HTTPRequest `protobuf:"bytes,5,opt,name=httpRequest,proto3" json:"httpRequest,omitempty"`
 	StatsEnabled bool                  `protobuf:"varint,6,opt,name=statsEnabled,proto3" json:"statsEnabled,omitempty"`
+	// Priority class of the query. Within a tenant queue, queries with a higher priority are dequeued first.
+	Priority string `protobuf:"bytes,7,opt,name=priority,proto3" json:"priority,omitempty"`
 }
 
 func (m *FrontendToScheduler) Reset()      { *m = FrontendToScheduler{} }
@@ -295,6 +311,13 @@ func (m *FrontendToScheduler) GetStatsEnabled() bool {
 	return false
 }
 
+func (m *FrontendToScheduler) GetPriority() string {
+	if m != nil {
+		return m.Priority
+	}
+	return ""
+}
+
 type SchedulerToFrontend struct {
 	Status SchedulerToFrontendStatus `protobuf:"varint,1,opt,name=status,proto3,enum=schedulerpb.SchedulerToFrontendStatus" json:"status,omitempty"`
 	Error  string                    `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
@@ -438,47 +461,52 @@ func init() {
 func init() { proto.RegisterFile("scheduler.proto", fileDescriptor_2b3fc28395a6d9c5) }
 
 var fileDescriptor_2b3fc28395a6d9c5 = []byte{
-	// 640 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x94, 0xcf, 0x4f, 0x1a, 0x41,
-	0x14, 0xc7, 0x77, 0x10, 0x50, 0x1f, 0xb6, 0x6e, 0x47, 0x6d, 0x29, 0xb1, 0x23, 0x21, 0x4d, 0x43,
-	0x3d, 0x80, 0xa1, 0x87, 0xf6, 0x60, 0x9a, 0x50, 0x5d, 0x2b, 0xa9, 0x5d, 0x74, 0x19, 0xd2, 0x1f,
-	0x17, 0x02, 0xec, 0x08, 0x44, 0xbb, 0xb3, 0xce, 0xce, 0xa6, 0xe1, 0xd6, 0x63, 0x8f, 0xfd, 0x33,
-	0xfa, 0xa7, 0xf4, 0xd2, 0xc4, 0xa3, 0x87, 0x1e, 0xea, 0x7a, 0xe9, 0xd1, 0x3f, 0xa1, 0x61, 0x59,
-	0xe8, 0x62, 0x17, 0xf5, 0xf6, 0xe6, 0xf1, 0xfd, 0x2e, 0xef, 0x7d, 0xde, 0x9b, 0x81, 0x45, 0xa7,
-	0xdd, 0x65, 0xa6, 0x7b, 0xcc, 0x44, 0xc1, 0x16, 0x5c, 0x72, 0x9c, 0x1a, 0x27, 0xec, 0x56, 0x66,
-	0xb9, 0xc3, 0x3b, 0xdc, 0xcf, 0x17, 0x07, 0xd1, 0x50, 0x92, 0xd9, 0xe8, 0xf4, 0x64, 0xd7, 0x6d,
-	0x15, 0xda, 0xfc, 0x53, 0xb1, 0x23, 0x9a, 0x87, 0x4d, 0xab, 0x59, 0x34, 0x9d, 0xa3, 0x9e, 0x2c,
-	0x76, 0xa5, 0xb4, 0x3b, 0xc2, 0x6e, 0x8f, 0x83, 0xa1, 0x23, 0x57, 0x02, 0x7c, 0xe0, 0x32, 0xd1,
-	0x63, 0x82, 0xf2, 0xda, 0xe8, 0xfb, 0x78, 0x15, 0xe6, 0x4f, 0x86, 0xd9, 0xca, 0x76, 0x1a, 0x65,
-	0x51, 0x7e, 0xde, 0xf8, 0x97, 0xc8, 0xfd, 0x44, 0x80, 0xc7, 0x5a, 0xca, 0x03, 0x3f, 0x4e, 0xc3,
-	0xec, 0x40, 0xd3, 0x0f, 0x2c, 0x71, 0x63, 0x74, 0xc4, 0xcf, 0x21, 0x35, 0xf8, 0x5b, 0x83, 0x9d,
-	0xb8, 0xcc, 0x91, 0xe9, 0x58, 0x16, 0xe5, 0x53, 0xa5, 0x95, 0xc2, 0xb8, 0x94, 0x5d, 0x4a, 0xf7,
-	0x83, 0x1f, 0x8d, 0xb0, 0x12, 0xe7, 0x61, 0xf1, 0x50, 0x70, 0x4b, 0x32, 0xcb, 0x2c, 0x9b, 0xa6,
-	0x60, 0x8e, 0x93, 0x9e, 0xf1, 0xab, 0xb9, 0x9a, 0xc6, 0xf7, 0x21, 0xe9, 0x3a, 0x7e, 0xb9, 0x71,
-	0x5f, 0x10, 0x9c, 0x70, 0x0e, 0x16, 0x1c, 0xd9, 0x94, 0x8e, 0x66, 0x35, 0x5b, 0xc7, 0xcc, 0x4c,
-	0x27, 0xb2, 0x28, 0x3f, 0x67, 0x4c, 0xe4, 0x72, 0x5f, 0x63, 0xb0, 0xb4, 0x13, 0x7c, 0x2f, 0x4c,
-	0xe1, 0x05, 0xc4, 0x65, 0xdf, 0x66, 0x7e, 0x37, 0x77, 0x4b, 0x8f, 0x0b, 0x21, 0xfe, 0x85, 0x08,
-	0x3d, 0xed, 0xdb, 0xcc, 0xf0, 0x1d, 0x51, 0x75, 0xc7, 0xa2, 0xeb, 0x0e, 0x41, 0x9b, 0x99, 0x84,
-	0x36, 0xad, 0xa3, 0x2b, 0x30, 0x13, 0xb7, 0x86, 0x79, 0x15, 0x45, 0x32, 0x02, 0xc5, 0x11, 0x2c,
-	0x85, 0x26, 0x3b, 0x6a, 0x12, 0xbf, 0x84, 0xe4, 0x40, 0xe6, 0x3a, 0x01, 0x8b, 0x27, 0x13, 0x2c,
-	0x22, 0x1c, 0x35, 0x5f, 0x6d, 0x04, 0x2e, 0xbc, 0x0c, 0x09, 0x26, 0x04, 0x17, 0x01, 0x85, 0xe1,
-	0x21, 0xb7, 0x09, 0xab, 0x3a, 0x97, 0xbd, 0xc3, 0x7e, 0xb0, 0x41, 0xb5, 0xae, 0x2b, 0x4d, 0xfe,
-	0xd9, 0x1a, 0x15, 0x7c, 0xfd, 0x16, 0xae, 0xc1, 0xa3, 0x29, 0x6e, 0xc7, 0xe6, 0x96, 0xc3, 0xd6,
-	0x37, 0xe1, 0xc1, 0x94, 0x29, 0xe1, 0x39, 0x88, 0x57, 0xf4, 0x0a, 0x55, 0x15, 0x9c, 0x82, 0x59,
-	0x4d, 0x3f, 0xa8, 0x6b, 0x75, 0x4d, 0x45, 0x18, 0x20, 0xb9, 0x55, 0xd6, 0xb7, 0xb4, 0x3d, 0x35,
-	0xb6, 0xde, 0x86, 0x87, 0x53, 0xfb, 0xc2, 0x49, 0x88, 0x55, 0xdf, 0xa8, 0x0a, 0xce, 0xc2, 0x2a,
-	0xad, 0x56, 0x1b, 0x6f, 0xcb, 0xfa, 0x87, 0x86, 0xa1, 0x1d, 0xd4, 0xb5, 0x1a, 0xad, 0x35, 0xf6,
-	0x35, 0xa3, 0x41, 0x35, 0xbd, 0xac, 0x53, 0x15, 0xe1, 0x79, 0x48, 0x68, 0x86, 0x51, 0x35, 0xd4,
-	0x18, 0xbe, 0x07, 0x77, 0x6a, 0xbb, 0x75, 0x4a, 0x2b, 0xfa, 0xeb, 0xc6, 0x76, 0xf5, 0x9d, 0xae,
-	0xce, 0x94, 0x7e, 0xa1, 0x10, 0xef, 0x1d, 0x2e, 0x46, 0x57, 0xa9, 0x0e, 0xa9, 0x20, 0xdc, 0xe3,
-	0xdc, 0xc6, 0x6b, 0x13, 0xb8, 0xff, 0xbf, 0xaf, 0x99, 0xb5, 0x69, 0xf3, 0x08, 0xb4, 0x39, 0x25,
-	0x8f, 0x36, 0x10, 0xb6, 0x60, 0x25, 0x12, 0x19, 0x7e, 0x3a, 0xe1, 0xbf, 0x6e, 0x28, 0x99, 0xf5,
-	0xdb, 0x48, 0x87, 0x13, 0x28, 0xd9, 0xb0, 0x1c, 0xee, 0x6e, 0xbc, 0x4e, 0xef, 0x61, 0x61, 0x14,
-	0xfb, 0xfd, 0x65, 0x6f, 0xba, 0x5a, 0x99, 0xec, 0x4d, 0x0b, 0x37, 0xec, 0xf0, 0x55, 0xf9, 0xf4,
-	0x9c, 0x28, 0x67, 0xe7, 0x44, 0xb9, 0x3c, 0x27, 0xe8, 0x8b, 0x47, 0xd0, 0x77, 0x8f, 0xa0, 0x1f,
-	0x1e, 0x41, 0xa7, 0x1e, 0x41, 0xbf, 0x3d, 0x82, 0xfe, 0x78, 0x44, 0xb9, 0xf4, 0x08, 0xfa, 0x76,
-	0x41, 0x94, 0xd3, 0x0b, 0xa2, 0x9c, 0x5d, 0x10, 0xe5, 0x63, 0xf8, 0x65, 0x6d, 0x25, 0xfd, 0x87,
-	0xf1, 0xd9, 0xdf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x67, 0xdc, 0x4e, 0xdc, 0x80, 0x05, 0x00, 0x00,
+	// 711 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0x4d, 0x53, 0xda, 0x5c,
+	0x14, 0xce, 0x45, 0x40, 0x3c, 0xf8, 0xbe, 0xf2, 0x5e, 0xf5, 0x2d, 0x32, 0x36, 0x30, 0x99, 0x4e,
+	0x87, 0xba, 0x08, 0x0e, 0x5d, 0xb4, 0x0b, 0xa7, 0x1d, 0xd4, 0x58, 0x99, 0xda, 0xa0, 0x21, 0x4c,
+	0x3f, 0x36, 0x0c, 0x90, 0x0b, 0x64, 0xc4, 0xdc, 0x78, 0x93, 0x8c, 0xc3, 0xae, 0x3f, 0xa1, 0xcb,
+	0xfe, 0x80, 0x2e, 0xfa, 0x53, 0xdc, 0x74, 0xc6, 0xa5, 0x8b, 0x4e, 0x5b, 0x71, 0xd3, 0xa5, 0x3f,
+	0xa1, 0x43, 0xb8, 0xd0, 0xa0, 0xa0, 0xee, 0xce, 0x39, 0x39, 0x4f, 0x9e, 0xfb, 0x3c, 0xe7, 0xdc,
+	0x0b, 0x0b, 0x4e, 0xa3, 0x4d, 0x0c, 0xaf, 0x43, 0x98, 0x6c, 0x33, 0xea, 0x52, 0x1c, 0x1f, 0x15,
+	0xec, 0x7a, 0x6a, 0xa9, 0x45, 0x5b, 0xd4, 0xaf, 0xe7, 0xfa, 0xd1, 0xa0, 0x25, 0xb5, 0xde, 0x32,
+	0xdd, 0xb6, 0x57, 0x97, 0x1b, 0xf4, 0x28, 0xd7, 0x62, 0xb5, 0x66, 0xcd, 0xaa, 0xe5, 0x0c, 0xe7,
+	0xd0, 0x74, 0x73, 0x6d, 0xd7, 0xb5, 0x5b, 0xcc, 0x6e, 0x8c, 0x02, 0x8e, 0x10, 0x5b, 0x94, 0xb6,
+	0x3a, 0x24, 0xe7, 0x67, 0x75, 0xaf, 0x99, 0x33, 0x3c, 0x56, 0x73, 0x4d, 0x6a, 0x0d, 0xbe, 0x4b,
+	0x0e, 0xe0, 0x03, 0x8f, 0x30, 0x93, 0x30, 0x9d, 0x96, 0x87, 0xfc, 0x78, 0x15, 0xe6, 0x8e, 0x07,
+	0xd5, 0xe2, 0x76, 0x12, 0x65, 0x50, 0x76, 0x4e, 0xfb, 0x5b, 0xc0, 0x2f, 0x21, 0x76, 0x52, 0xeb,
+	0x74, 0x74, 0xf3, 0x88, 0x24, 0x43, 0x19, 0x94, 0x8d, 0xe7, 0x57, 0xe4, 0x01, 0x8d, 0x3c, 0xa4,
+	0x91, 0xb7, 0x39, 0xcd, 0x66, 0xec, 0xf4, 0x47, 0x5a, 0xf8, 0xfc, 0x33, 0x8d, 0xb4, 0x11, 0x48,
+	0xfa, 0x86, 0x00, 0x8f, 0xc8, 0x74, 0xca, 0x0f, 0x80, 0x93, 0x30, 0xdb, 0x27, 0xe9, 0x72, 0xce,
+	0xb0, 0x36, 0x4c, 0xf1, 0x33, 0x88, 0xf7, 0x75, 0x69, 0xe4, 0xd8, 0x23, 0x8e, 0xcb, 0x49, 0x97,
+	0xe5, 0x91, 0xd6, 0x5d, 0x5d, 0xdf, 0xe7, 0x1f, 0xb5, 0x60, 0x27, 0xce, 0xc2, 0x42, 0x93, 0x51,
+	0xcb, 0x25, 0x96, 0x51, 0x30, 0x0c, 0x46, 0x1c, 0x27, 0x39, 0xe3, 0xcb, 0xb9, 0x5e, 0xc6, 0xff,
+	0x43, 0xd4, 0x73, 0x7c, 0xbd, 0x61, 0xbf, 0x81, 0x67, 0x58, 0x82, 0x79, 0xc7, 0xad, 0xb9, 0x8e,
+	0x62, 0xd5, 0xea, 0x1d, 0x62, 0x24, 0x23, 0x19, 0x94, 0x8d, 0x69, 0x63, 0x35, 0xe9, 0x4b, 0x08,
+	0x16, 0x77, 0xf8, 0xff, 0x82, 0x36, 0x3e, 0x87, 0xb0, 0xdb, 0xb5, 0x89, 0xaf, 0xe6, 0xdf, 0xfc,
+	0x23, 0x39, 0x30, 0x60, 0x79, 0x42, 0xbf, 0xde, 0xb5, 0x89, 0xe6, 0x23, 0x26, 0x9d, 0x3b, 0x34,
+	0xf9, 0xdc, 0x01, 0xd3, 0x66, 0xc6, 0x4d, 0x9b, 0xa6, 0xe8, 0x9a, 0x99, 0x91, 0x7b, 0x9b, 0x79,
+	0xdd, 0x8a, 0xe8, 0x4d, 0x2b, 0x70, 0x0a, 0x62, 0x36, 0x33, 0x29, 0x33, 0xdd, 0x6e, 0x72, 0xd6,
+	0xa7, 0x1d, 0xe5, 0xd2, 0x21, 0x2c, 0x06, 0xa6, 0x3e, 0x34, 0x00, 0xbf, 0x80, 0x68, 0xff, 0x17,
+	0x9e, 0xc3, 0x7d, 0x7a, 0x3c, 0xe6, 0xd3, 0x04, 0x44, 0xd9, 0xef, 0xd6, 0x38, 0x0a, 0x2f, 0x41,
+	0x84, 0x30, 0x46, 0x19, 0x77, 0x68, 0x90, 0x48, 0x1b, 0xb0, 0xaa, 0x52, 0xd7, 0x6c, 0x76, 0xf9,
+	0x76, 0x95, 0xdb, 0x9e, 0x6b, 0xd0, 0x13, 0x6b, 0x28, 0xe6, 0xd6, 0x15, 0x97, 0xd2, 0xf0, 0x70,
+	0x0a, 0xda, 0xb1, 0xa9, 0xe5, 0x90, 0xb5, 0x0d, 0x78, 0x30, 0x65, 0x82, 0x38, 0x06, 0xe1, 0xa2,
+	0x5a, 0xd4, 0x13, 0x02, 0x8e, 0xc3, 0xac, 0xa2, 0x1e, 0x54, 0x94, 0x8a, 0x92, 0x40, 0x18, 0x20,
+	0xba, 0x55, 0x50, 0xb7, 0x94, 0xbd, 0x44, 0x68, 0xad, 0x01, 0x2b, 0x53, 0x75, 0xe1, 0x28, 0x84,
+	0x4a, 0xaf, 0x13, 0x02, 0xce, 0xc0, 0xaa, 0x5e, 0x2a, 0x55, 0xdf, 0x14, 0xd4, 0xf7, 0x55, 0x4d,
+	0x39, 0xa8, 0x28, 0x65, 0xbd, 0x5c, 0xdd, 0x57, 0xb4, 0xaa, 0xae, 0xa8, 0x05, 0x55, 0x4f, 0x20,
+	0x3c, 0x07, 0x11, 0x45, 0xd3, 0x4a, 0x5a, 0x22, 0x84, 0xff, 0x83, 0x7f, 0xca, 0xbb, 0x15, 0x5d,
+	0x2f, 0xaa, 0xaf, 0xaa, 0xdb, 0xa5, 0xb7, 0x6a, 0x62, 0x26, 0xff, 0x1d, 0x05, 0xfc, 0xde, 0xa1,
+	0x6c, 0x78, 0xcd, 0x2a, 0x10, 0xe7, 0xe1, 0x1e, 0xa5, 0x36, 0x4e, 0x8f, 0xd9, 0x7d, 0xf3, 0x31,
+	0x48, 0xa5, 0xa7, 0xcd, 0x83, 0xf7, 0x4a, 0x42, 0x16, 0xad, 0x23, 0x6c, 0xc1, 0xf2, 0x44, 0xcb,
+	0xf0, 0x93, 0x31, 0xfc, 0x6d, 0x43, 0x49, 0xad, 0xdd, 0xa7, 0x75, 0x30, 0x81, 0xbc, 0x0d, 0x4b,
+	0x41, 0x75, 0xa3, 0x75, 0x7a, 0x07, 0xf3, 0xc3, 0xd8, 0xd7, 0x97, 0xb9, 0xeb, 0xda, 0xa5, 0x32,
+	0x77, 0x2d, 0xdc, 0x40, 0xe1, 0x66, 0xe1, 0xec, 0x42, 0x14, 0xce, 0x2f, 0x44, 0xe1, 0xea, 0x42,
+	0x44, 0x1f, 0x7b, 0x22, 0xfa, 0xda, 0x13, 0xd1, 0x69, 0x4f, 0x44, 0x67, 0x3d, 0x11, 0xfd, 0xea,
+	0x89, 0xe8, 0x77, 0x4f, 0x14, 0xae, 0x7a, 0x22, 0xfa, 0x74, 0x29, 0x0a, 0x67, 0x97, 0xa2, 0x70,
+	0x7e, 0x29, 0x0a, 0x1f, 0x82, 0xcf, 0x7a, 0x3d, 0xea, 0x3f, 0x90, 0x4f, 0xff, 0x0c, 0x00, 0xa4,
+	0x65, 0x7f, 0xfe, 0xfd, 0x05, 0x00, 0x00,
 }
 
 func (x FrontendToSchedulerType) String() string {
@@ -517,6 +545,9 @@ func (this *QuerierToScheduler) Equal(that interface{}) bool {
 	if this.QuerierID != that1.QuerierID {
 		return false
 	}
+	if this.WallTime != that1.WallTime {
+		return false
+	}
 	return true
 }
 func (this *SchedulerToQuerier) Equal(that interface{}) bool {
@@ -592,6 +623,9 @@ func (this *FrontendToScheduler) Equal(that interface{}) bool {
 	if this.StatsEnabled != that1.StatsEnabled {
 		return false
 	}
+	if this.Priority != that1.Priority {
+		return false
+	}
 	return true
 }
 func (this *SchedulerToFrontend) Equal(that interface{}) bool {
@@ -670,9 +704,10 @@ func (this *QuerierToScheduler) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 5)
+	s := make([]string, 0, 6)
 	s = append(s, "&schedulerpb.QuerierToScheduler{")
 	s = append(s, "QuerierID: "+fmt.Sprintf("%#v", this.QuerierID)+",\n")
+	s = append(s, "WallTime: "+fmt.Sprintf("%#v", this.WallTime)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -696,7 +731,7 @@ func (this *FrontendToScheduler) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 10)
+	s := make([]string, 0, 11)
 	s = append(s, "&schedulerpb.FrontendToScheduler{")
 	s = append(s, "Type: "+fmt.Sprintf("%#v", this.Type)+",\n")
 	s = append(s, "FrontendAddress: "+fmt.Sprintf("%#v", this.FrontendAddress)+",\n")
@@ -706,6 +741,7 @@ func (this *FrontendToScheduler) GoString() string {
 		s = append(s, "HttpRequest: "+fmt.Sprintf("%#v", this.HttpRequest)+",\n")
 	}
 	s = append(s, "StatsEnabled: "+fmt.Sprintf("%#v", this.StatsEnabled)+",\n")
+	s = append(s, "Priority: "+fmt.Sprintf("%#v", this.Priority)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -1047,6 +1083,14 @@ func (m *QuerierToScheduler) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	n1, err1 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.WallTime, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.WallTime):])
+	if err1 != nil {
+		return 0, err1
+	}
+	i -= n1
+	i = encodeVarintScheduler(dAtA, i, uint64(n1))
+	i--
+	dAtA[i] = 0x12
 	if len(m.QuerierID) > 0 {
 		i -= len(m.QuerierID)
 		copy(dAtA[i:], m.QuerierID)
@@ -1141,6 +1185,13 @@ func (m *FrontendToScheduler) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Priority) > 0 {
+		i -= len(m.Priority)
+		copy(dAtA[i:], m.Priority)
+		i = encodeVarintScheduler(dAtA, i, uint64(len(m.Priority)))
+		i--
+		dAtA[i] = 0x3a
+	}
 	if m.StatsEnabled {
 		i--
 		if m.StatsEnabled {
@@ -1299,6 +1350,8 @@ func (m *QuerierToScheduler) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovScheduler(uint64(l))
 	}
+	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.WallTime)
+	n += 1 + l + sovScheduler(uint64(l))
 	return n
 }
 
@@ -1356,6 +1409,10 @@ func (m *FrontendToScheduler) Size() (n int) {
 	if m.StatsEnabled {
 		n += 2
 	}
+	l = len(m.Priority)
+	if l > 0 {
+		n += 1 + l + sovScheduler(uint64(l))
+	}
 	return n
 }
 
@@ -1409,6 +1466,7 @@ func (this *QuerierToScheduler) String() string {
 	}
 	s := strings.Join([]string{`&QuerierToScheduler{`,
 		`QuerierID:` + fmt.Sprintf("%v", this.QuerierID) + `,`,
+		`WallTime:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.WallTime), "Duration", "types.Duration", 1), `&`, ``, 1) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1438,6 +1496,7 @@ func (this *FrontendToScheduler) String() string {
 		`UserID:` + fmt.Sprintf("%v", this.UserID) + `,`,
 		`HttpRequest:` + strings.Replace(fmt.Sprintf("%v", this.HttpRequest), "HTTPRequest", "httpgrpc.HTTPRequest", 1) + `,`,
 		`StatsEnabled:` + fmt.Sprintf("%v", this.StatsEnabled) + `,`,
+		`Priority:` + fmt.Sprintf("%v", this.Priority) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1541,6 +1600,39 @@ func (m *QuerierToScheduler) Unmarshal(dAtA []byte) error {
 			}
 			m.QuerierID = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field WallTime", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowScheduler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthScheduler
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthScheduler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdDurationUnmarshal(&m.WallTime, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipScheduler(dAtA[iNdEx:])
@@ -1944,6 +2036,38 @@ func (m *FrontendToScheduler) Unmarshal(dAtA []byte) error {
 				}
 			}
 			m.StatsEnabled = bool(v != 0)
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Priority", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowScheduler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthScheduler
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthScheduler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Priority = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipScheduler(dAtA[iNdEx:])
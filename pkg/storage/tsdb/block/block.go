@@ -121,6 +121,18 @@ func Upload(ctx context.Context, logger log.Logger, bkt objstore.Bucket, blockDi
 		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload index"))
 	}
 
+	if meta.HasBloomFilters() {
+		if err := objstore.UploadFile(ctx, logger, bkt, filepath.Join(blockDir, BloomFiltersFilename), path.Join(id.String(), BloomFiltersFilename)); err != nil {
+			return cleanUp(logger, bkt, id, errors.Wrap(err, "upload bloom filters"))
+		}
+	}
+
+	if meta.HasExemplars() {
+		if err := objstore.UploadFile(ctx, logger, bkt, filepath.Join(blockDir, ExemplarsFilename), path.Join(id.String(), ExemplarsFilename)); err != nil {
+			return cleanUp(logger, bkt, id, errors.Wrap(err, "upload exemplars"))
+		}
+	}
+
 	// Meta.json always need to be uploaded as a last item. This will allow to assume block directories without meta file to be pending uploads.
 	if err := bkt.Upload(ctx, path.Join(id.String(), MetaFilename), strings.NewReader(metaEncoded.String())); err != nil {
 		// Don't call cleanUp here. Despite getting error, meta.json may have been uploaded in certain cases,
@@ -284,7 +296,7 @@ func GetSegmentFiles(blockDir string) []string {
 	return result
 }
 
-// GatherFileStats returns File entry for files inside TSDB block (index, chunks, meta.json).
+// GatherFileStats returns File entry for files inside TSDB block (index, chunks, bloom filters, exemplars, meta.json).
 func GatherFileStats(blockDir string) (res []File, _ error) {
 	files, err := os.ReadDir(filepath.Join(blockDir, ChunksDirname))
 	if err != nil {
@@ -313,6 +325,20 @@ func GatherFileStats(blockDir string) (res []File, _ error) {
 	}
 	res = append(res, mf)
 
+	// The bloom filters and exemplars files are optional.
+	for _, name := range []string{BloomFiltersFilename, ExemplarsFilename} {
+		optionalFile, err := os.Stat(filepath.Join(blockDir, name))
+		switch {
+		case err == nil:
+			res = append(res, File{
+				RelPath:   optionalFile.Name(),
+				SizeBytes: optionalFile.Size(),
+			})
+		case !os.IsNotExist(err):
+			return nil, errors.Wrapf(err, "stat %v", filepath.Join(blockDir, name))
+		}
+	}
+
 	metaFile, err := os.Stat(filepath.Join(blockDir, MetaFilename))
 	if err != nil {
 		return nil, errors.Wrapf(err, "stat %v", filepath.Join(blockDir, MetaFilename))
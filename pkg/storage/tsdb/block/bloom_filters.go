@@ -0,0 +1,313 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package block
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/grafana/dskit/runutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/objstore"
+)
+
+const (
+	// BloomFiltersFilename is the name of the optional file containing the bloom filters of the values
+	// of some label names in the block index.
+	BloomFiltersFilename = "bloom-filters"
+
+	// BloomFilterFalsePositiveRate is the target probability of a bloom filter reporting a value
+	// which is not in the block as possibly present.
+	BloomFilterFalsePositiveRate = 0.01
+
+	bloomFiltersMagic = "BLF1"
+
+	// bloomFilterMaxHashes limits the number of hash functions of a bloom filter.
+	bloomFilterMaxHashes = 16
+)
+
+var errBloomFiltersCorrupted = errors.New("corrupted bloom filters file")
+
+// BloomFilter is a space-efficient probabilistic set of label values: it reports whether a value
+// is possibly in the set, or definitely not in the set.
+type BloomFilter struct {
+	bits   []uint64
+	hashes uint64
+}
+
+// NewBloomFilter returns an empty bloom filter sized for the expected number of values and false positive rate.
+func NewBloomFilter(numValues int, falsePositiveRate float64) *BloomFilter {
+	numBits := uint64(64)
+	hashes := uint64(1)
+
+	if numValues > 0 {
+		n := float64(numValues)
+		numBits = uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+		hashes = uint64(math.Round(float64(numBits) / n * math.Ln2))
+	}
+	if hashes < 1 {
+		hashes = 1
+	} else if hashes > bloomFilterMaxHashes {
+		hashes = bloomFilterMaxHashes
+	}
+
+	return &BloomFilter{
+		bits:   make([]uint64, (numBits+63)/64),
+		hashes: hashes,
+	}
+}
+
+// Add adds the value to the filter.
+func (f *BloomFilter) Add(value string) {
+	h1, h2 := bloomFilterHashes(value)
+	numBits := uint64(len(f.bits)) * 64
+
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % numBits
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain returns false if the value is definitely not in the filter.
+func (f *BloomFilter) MayContain(value string) bool {
+	h1, h2 := bloomFilterHashes(value)
+	numBits := uint64(len(f.bits)) * 64
+
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % numBits
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomFilterHashes derives the two hashes used to compute the bits of the value (double hashing).
+func bloomFilterHashes(value string) (uint64, uint64) {
+	h := xxhash.Sum64String(value)
+	return h & math.MaxUint32, h >> 32
+}
+
+// BloomFilters are the bloom filters of the values of some label names in a block, by label name.
+type BloomFilters map[string]*BloomFilter
+
+// MayMatch returns false if the block definitely has no series matching all the matchers. Only the
+// equal matchers, and the regexp matchers made of alternative literal values, are checked against the filters.
+func (f BloomFilters) MayMatch(matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		filter, ok := f[m.Name]
+		if !ok {
+			continue
+		}
+
+		var values []string
+		switch m.Type {
+		case labels.MatchEqual:
+			values = []string{m.Value}
+		case labels.MatchRegexp:
+			values = m.SetMatches()
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		mayMatch := false
+		for _, v := range values {
+			// An empty value matches the series without the label.
+			if v == "" || filter.MayContain(v) {
+				mayMatch = true
+				break
+			}
+		}
+		if !mayMatch {
+			return false
+		}
+	}
+	return true
+}
+
+// Encode returns the binary encoding of the bloom filters: the magic, the number of filters and for each
+// filter (sorted by label name) the label name, the number of hash functions and the bits, followed by
+// the CRC32 of everything but the magic.
+func (f BloomFilters) Encode() []byte {
+	names := make([]string, 0, len(f))
+	size := len(bloomFiltersMagic) + binary.MaxVarintLen64 + 4
+	for name, filter := range f {
+		names = append(names, name)
+		size += 3*binary.MaxVarintLen64 + len(name) + 8*len(filter.bits)
+	}
+	sort.Strings(names)
+
+	data := make([]byte, 0, size)
+	data = append(data, bloomFiltersMagic...)
+	data = binary.AppendUvarint(data, uint64(len(names)))
+	for _, name := range names {
+		filter := f[name]
+		data = binary.AppendUvarint(data, uint64(len(name)))
+		data = append(data, name...)
+		data = binary.AppendUvarint(data, filter.hashes)
+		data = binary.AppendUvarint(data, uint64(len(filter.bits)))
+		for _, w := range filter.bits {
+			data = binary.BigEndian.AppendUint64(data, w)
+		}
+	}
+	return binary.BigEndian.AppendUint32(data, crc32.Checksum(data[len(bloomFiltersMagic):], castagnoli))
+}
+
+// DecodeBloomFilters decodes the bloom filters encoded with BloomFilters.Encode.
+func DecodeBloomFilters(data []byte) (BloomFilters, error) {
+	if len(data) < len(bloomFiltersMagic)+4 || string(data[:len(bloomFiltersMagic)]) != bloomFiltersMagic {
+		return nil, errBloomFiltersCorrupted
+	}
+
+	checksum := binary.BigEndian.Uint32(data[len(data)-4:])
+	data = data[len(bloomFiltersMagic) : len(data)-4]
+	if crc32.Checksum(data, castagnoli) != checksum {
+		return nil, errBloomFiltersCorrupted
+	}
+
+	d := fileDecoder{data: data, errCorrupted: errBloomFiltersCorrupted}
+	num := d.uvarint()
+	filters := make(BloomFilters, num)
+	for i := uint64(0); i < num && d.err == nil; i++ {
+		name := string(d.bytes(d.uvarint()))
+		filter := &BloomFilter{hashes: d.uvarint()}
+
+		numWords := d.uvarint()
+		wordsData := d.bytes(8 * numWords)
+		if d.err != nil {
+			break
+		}
+		if numWords == 0 {
+			return nil, errBloomFiltersCorrupted
+		}
+		filter.bits = make([]uint64, numWords)
+		for j := range filter.bits {
+			filter.bits[j] = binary.BigEndian.Uint64(wordsData[8*j:])
+		}
+
+		filters[name] = filter
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return filters, nil
+}
+
+// fileDecoder decodes the optional block files. Once decoding fails, the decoder keeps returning zero values,
+// and err is set to errCorrupted.
+type fileDecoder struct {
+	data         []byte
+	err          error
+	errCorrupted error
+}
+
+func (d *fileDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = d.errCorrupted
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *fileDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = d.errCorrupted
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *fileDecoder) bytes(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.data)) {
+		d.err = d.errCorrupted
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+// WriteBloomFilters builds the bloom filters of the values of the label names in the index of the block
+// in blockDir, and writes them to the block directory. A label name not in the block gets an empty filter,
+// so that the block can be skipped for any value of the label. No file is written if labelNames is empty.
+func WriteBloomFilters(blockDir string, labelNames []string) (err error) {
+	if len(labelNames) == 0 {
+		return nil
+	}
+
+	r, err := index.NewFileReader(filepath.Join(blockDir, IndexFilename))
+	if err != nil {
+		return errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithErrCapture(&err, r, "close index reader")
+
+	filters := make(BloomFilters, len(labelNames))
+	for _, name := range labelNames {
+		values, err := r.LabelValues(name)
+		if err != nil {
+			return errors.Wrapf(err, "read values of label %s", name)
+		}
+
+		filter := NewBloomFilter(len(values), BloomFilterFalsePositiveRate)
+		for _, v := range values {
+			filter.Add(v)
+		}
+		filters[name] = filter
+	}
+
+	tmp := filepath.Join(blockDir, BloomFiltersFilename+".tmp")
+	if err := os.WriteFile(tmp, filters.Encode(), 0o666); err != nil {
+		return errors.Wrap(err, "write bloom filters")
+	}
+	return os.Rename(tmp, filepath.Join(blockDir, BloomFiltersFilename))
+}
+
+// ReadBloomFilters reads the bloom filters of the block from the bucket.
+func ReadBloomFilters(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID) (_ BloomFilters, err error) {
+	rc, err := bkt.Get(ctx, path.Join(id.String(), BloomFiltersFilename))
+	if err != nil {
+		return nil, errors.Wrap(err, "get bloom filters")
+	}
+	defer runutil.CloseWithErrCapture(&err, rc, "close bloom filters reader")
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, errors.Wrap(err, "read bloom filters")
+	}
+	return DecodeBloomFilters(data)
+}
+
+// HasBloomFilters returns whether the block has the bloom filters file, according to the files listed in the meta.
+func (m *Meta) HasBloomFilters() bool {
+	for _, f := range m.Thanos.Files {
+		if f.RelPath == BloomFiltersFilename {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package block
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestBloomFilter(t *testing.T) {
+	const numValues = 10000
+
+	f := NewBloomFilter(numValues, BloomFilterFalsePositiveRate)
+	for i := 0; i < numValues; i++ {
+		f.Add(fmt.Sprintf("value-%d", i))
+	}
+
+	// There are no false negatives.
+	for i := 0; i < numValues; i++ {
+		require.True(t, f.MayContain(fmt.Sprintf("value-%d", i)))
+	}
+
+	// The false positive rate is close to the target one.
+	falsePositives := 0
+	for i := 0; i < numValues; i++ {
+		if f.MayContain(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, float64(falsePositives)/numValues, 2*BloomFilterFalsePositiveRate)
+
+	// An empty filter contains nothing.
+	assert.False(t, NewBloomFilter(0, BloomFilterFalsePositiveRate).MayContain("value-0"))
+}
+
+func TestBloomFilters_MayMatch(t *testing.T) {
+	pod := NewBloomFilter(2, BloomFilterFalsePositiveRate)
+	pod.Add("pod-1")
+	pod.Add("pod-2")
+	filters := BloomFilters{
+		"pod":     pod,
+		"trace":   NewBloomFilter(0, BloomFilterFalsePositiveRate),
+		"another": NewBloomFilter(0, BloomFilterFalsePositiveRate),
+	}
+
+	tests := map[string]struct {
+		matchers []*labels.Matcher
+		expected bool
+	}{
+		"no matchers": {
+			expected: true,
+		},
+		"equal matcher on a value in the filter": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-1")},
+			expected: true,
+		},
+		"equal matcher on a value not in the filter": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-3")},
+			expected: false,
+		},
+		"equal matcher on the empty value": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "trace", "")},
+			expected: true,
+		},
+		"equal matcher on a label without filter": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "job-1")},
+			expected: true,
+		},
+		"set regexp matcher with a value in the filter": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "pod", "pod-3|pod-2")},
+			expected: true,
+		},
+		"set regexp matcher without values in the filter": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "pod", "pod-3|pod-4")},
+			expected: false,
+		},
+		"non-set regexp matcher": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "pod", "pod-.*")},
+			expected: true,
+		},
+		"not equal matcher": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchNotEqual, "pod", "pod-3")},
+			expected: true,
+		},
+		"one of many matchers not matching": {
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-1"),
+				labels.MustNewMatcher(labels.MatchEqual, "trace", "abc"),
+			},
+			expected: false,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, filters.MayMatch(testData.matchers))
+		})
+	}
+}
+
+func TestBloomFilters_EncodeDecode(t *testing.T) {
+	pod := NewBloomFilter(2, BloomFilterFalsePositiveRate)
+	pod.Add("pod-1")
+	pod.Add("pod-2")
+	filters := BloomFilters{
+		"pod":   pod,
+		"trace": NewBloomFilter(0, BloomFilterFalsePositiveRate),
+	}
+
+	data := filters.Encode()
+	decoded, err := DecodeBloomFilters(data)
+	require.NoError(t, err)
+	assert.Equal(t, filters, decoded)
+
+	// Corrupted data is detected.
+	for i := range data {
+		corrupted := append([]byte(nil), data...)
+		corrupted[i] ^= 0xff
+		_, err := DecodeBloomFilters(corrupted)
+		assert.ErrorIs(t, err, errBloomFiltersCorrupted)
+	}
+	_, err = DecodeBloomFilters(data[:len(data)-1])
+	assert.ErrorIs(t, err, errBloomFiltersCorrupted)
+	_, err = DecodeBloomFilters(nil)
+	assert.ErrorIs(t, err, errBloomFiltersCorrupted)
+}
+
+func TestWriteBloomFilters(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	id, err := CreateBlock(ctx, tmpDir, []labels.Labels{
+		labels.FromStrings("pod", "pod-1", "job", "job-1"),
+		labels.FromStrings("pod", "pod-2", "job", "job-1"),
+		labels.FromStrings("pod", "pod-3", "job", "job-1"),
+	}, 10, 0, 1000, labels.EmptyLabels())
+	require.NoError(t, err)
+	blockDir := filepath.Join(tmpDir, id.String())
+
+	// No file is written without label names.
+	require.NoError(t, WriteBloomFilters(blockDir, nil))
+	assert.NoFileExists(t, filepath.Join(blockDir, BloomFiltersFilename))
+
+	require.NoError(t, WriteBloomFilters(blockDir, []string{"pod", "trace"}))
+	assert.FileExists(t, filepath.Join(blockDir, BloomFiltersFilename))
+
+	// The bloom filters file is uploaded with the block, and listed in the meta.
+	bkt := objstore.NewInMemBucket()
+	require.NoError(t, Upload(ctx, log.NewNopLogger(), bkt, blockDir, nil))
+
+	meta, err := DownloadMeta(ctx, log.NewNopLogger(), bkt, id)
+	require.NoError(t, err)
+	assert.True(t, meta.HasBloomFilters())
+	assert.Contains(t, bkt.Objects(), path.Join(id.String(), BloomFiltersFilename))
+
+	filters, err := ReadBloomFilters(ctx, bkt, id)
+	require.NoError(t, err)
+	require.Len(t, filters, 2)
+
+	assert.True(t, filters.MayMatch([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-1")}))
+	assert.False(t, filters.MayMatch([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-4")}))
+	assert.False(t, filters.MayMatch([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "trace", "abc")}))
+	assert.True(t, filters.MayMatch([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "job-2")}))
+}
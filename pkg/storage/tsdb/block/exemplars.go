@@ -0,0 +1,331 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package block
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/grafana/dskit/runutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/objstore"
+)
+
+const (
+	// ExemplarsFilename is the name of the optional file containing the exemplars of the series of the block.
+	ExemplarsFilename = "exemplars"
+
+	exemplarsMagic = "EXM1"
+)
+
+var errExemplarsCorrupted = errors.New("corrupted exemplars file")
+
+// EncodeExemplars returns the binary encoding of the exemplars: the magic, the number of series and for each
+// series the series labels, the number of exemplars and for each exemplar its labels, value and timestamp,
+// followed by the CRC32 of everything but the magic.
+func EncodeExemplars(series []exemplar.QueryResult) []byte {
+	data := make([]byte, 0, 1024)
+	data = append(data, exemplarsMagic...)
+	data = binary.AppendUvarint(data, uint64(len(series)))
+	for _, s := range series {
+		data = appendLabels(data, s.SeriesLabels)
+		data = binary.AppendUvarint(data, uint64(len(s.Exemplars)))
+		for _, e := range s.Exemplars {
+			data = appendLabels(data, e.Labels)
+			data = binary.BigEndian.AppendUint64(data, math.Float64bits(e.Value))
+			data = binary.AppendVarint(data, e.Ts)
+		}
+	}
+	return binary.BigEndian.AppendUint32(data, crc32.Checksum(data[len(exemplarsMagic):], castagnoli))
+}
+
+func appendLabels(data []byte, lbls labels.Labels) []byte {
+	data = binary.AppendUvarint(data, uint64(lbls.Len()))
+	lbls.Range(func(l labels.Label) {
+		data = binary.AppendUvarint(data, uint64(len(l.Name)))
+		data = append(data, l.Name...)
+		data = binary.AppendUvarint(data, uint64(len(l.Value)))
+		data = append(data, l.Value...)
+	})
+	return data
+}
+
+// DecodeExemplars decodes the exemplars encoded with EncodeExemplars.
+func DecodeExemplars(data []byte) ([]exemplar.QueryResult, error) {
+	if len(data) < len(exemplarsMagic)+4 || string(data[:len(exemplarsMagic)]) != exemplarsMagic {
+		return nil, errExemplarsCorrupted
+	}
+
+	checksum := binary.BigEndian.Uint32(data[len(data)-4:])
+	data = data[len(exemplarsMagic) : len(data)-4]
+	if crc32.Checksum(data, castagnoli) != checksum {
+		return nil, errExemplarsCorrupted
+	}
+
+	var (
+		d       = fileDecoder{data: data, errCorrupted: errExemplarsCorrupted}
+		builder = labels.NewScratchBuilder(0)
+		num     = d.uvarint()
+		series  = make([]exemplar.QueryResult, 0, num)
+	)
+	for i := uint64(0); i < num && d.err == nil; i++ {
+		s := exemplar.QueryResult{SeriesLabels: d.labels(&builder)}
+
+		numExemplars := d.uvarint()
+		for j := uint64(0); j < numExemplars && d.err == nil; j++ {
+			e := exemplar.Exemplar{Labels: d.labels(&builder), HasTs: true}
+			if v := d.bytes(8); d.err == nil {
+				e.Value = math.Float64frombits(binary.BigEndian.Uint64(v))
+			}
+			e.Ts = d.varint()
+			s.Exemplars = append(s.Exemplars, e)
+		}
+
+		series = append(series, s)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return series, nil
+}
+
+func (d *fileDecoder) labels(builder *labels.ScratchBuilder) labels.Labels {
+	builder.Reset()
+	num := d.uvarint()
+	for i := uint64(0); i < num && d.err == nil; i++ {
+		name := string(d.bytes(d.uvarint()))
+		value := string(d.bytes(d.uvarint()))
+		builder.Add(name, value)
+	}
+	builder.Sort()
+	return builder.Labels()
+}
+
+// MergeExemplars merges the exemplars of the same series, removing the duplicated exemplars. The returned
+// series are sorted by labels, and the exemplars of each series are sorted by timestamp.
+func MergeExemplars(series ...[]exemplar.QueryResult) []exemplar.QueryResult {
+	bySeries := map[string]*exemplar.QueryResult{}
+	for _, ss := range series {
+		for _, s := range ss {
+			key := string(s.SeriesLabels.Bytes(nil))
+			merged, ok := bySeries[key]
+			if !ok {
+				merged = &exemplar.QueryResult{SeriesLabels: s.SeriesLabels}
+				bySeries[key] = merged
+			}
+			merged.Exemplars = append(merged.Exemplars, s.Exemplars...)
+		}
+	}
+
+	out := make([]exemplar.QueryResult, 0, len(bySeries))
+	for _, s := range bySeries {
+		sort.SliceStable(s.Exemplars, func(i, j int) bool {
+			return s.Exemplars[i].Ts < s.Exemplars[j].Ts
+		})
+
+		// Remove the duplicated exemplars, which have the same timestamp.
+		deduped := s.Exemplars[:0]
+		for _, e := range s.Exemplars {
+			if !containsExemplarWithTimestamp(deduped, e) {
+				deduped = append(deduped, e)
+			}
+		}
+		s.Exemplars = deduped
+
+		out = append(out, *s)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return labels.Compare(out[i].SeriesLabels, out[j].SeriesLabels) < 0
+	})
+	return out
+}
+
+// containsExemplarWithTimestamp returns whether the exemplars, sorted by timestamp, end with an exemplar equal to e.
+func containsExemplarWithTimestamp(exemplars []exemplar.Exemplar, e exemplar.Exemplar) bool {
+	for i := len(exemplars) - 1; i >= 0 && exemplars[i].Ts == e.Ts; i-- {
+		if math.Float64bits(exemplars[i].Value) == math.Float64bits(e.Value) && labels.Equal(exemplars[i].Labels, e.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterExemplars returns the exemplars within start and end (both included) of the series matching
+// at least one of the sets of matchers. All the series match if no set of matchers is given.
+func FilterExemplars(series []exemplar.QueryResult, start, end int64, matchers ...[]*labels.Matcher) []exemplar.QueryResult {
+	var out []exemplar.QueryResult
+	for _, s := range series {
+		if len(matchers) > 0 && !matchesSomeMatcherSet(s.SeriesLabels, matchers) {
+			continue
+		}
+
+		var exemplars []exemplar.Exemplar
+		for _, e := range s.Exemplars {
+			if e.Ts >= start && e.Ts <= end {
+				exemplars = append(exemplars, e)
+			}
+		}
+		if len(exemplars) > 0 {
+			out = append(out, exemplar.QueryResult{SeriesLabels: s.SeriesLabels, Exemplars: exemplars})
+		}
+	}
+	return out
+}
+
+func matchesSomeMatcherSet(lbls labels.Labels, matchers [][]*labels.Matcher) bool {
+outer:
+	for _, ms := range matchers {
+		for _, m := range ms {
+			if !m.Matches(lbls.Get(m.Name)) {
+				continue outer
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// WriteExemplars writes the exemplars to the block directory. No file is written if there are no exemplars.
+func WriteExemplars(blockDir string, series []exemplar.QueryResult) error {
+	if len(series) == 0 {
+		return nil
+	}
+
+	tmp := filepath.Join(blockDir, ExemplarsFilename+".tmp")
+	if err := os.WriteFile(tmp, EncodeExemplars(series), 0o666); err != nil {
+		return errors.Wrap(err, "write exemplars")
+	}
+	return os.Rename(tmp, filepath.Join(blockDir, ExemplarsFilename))
+}
+
+// ReadExemplarsFromDir reads the exemplars of the block in blockDir. It returns no exemplars if the block
+// has no exemplars file.
+func ReadExemplarsFromDir(blockDir string) ([]exemplar.QueryResult, error) {
+	data, err := os.ReadFile(filepath.Join(blockDir, ExemplarsFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read exemplars")
+	}
+	return DecodeExemplars(data)
+}
+
+// ReadExemplars reads the exemplars of the block from the bucket.
+func ReadExemplars(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID) (_ []exemplar.QueryResult, err error) {
+	rc, err := bkt.Get(ctx, path.Join(id.String(), ExemplarsFilename))
+	if err != nil {
+		return nil, errors.Wrap(err, "get exemplars")
+	}
+	defer runutil.CloseWithErrCapture(&err, rc, "close exemplars reader")
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, errors.Wrap(err, "read exemplars")
+	}
+	return DecodeExemplars(data)
+}
+
+// WriteExemplarsFromSources writes to the block in blockDir the exemplars of the source blocks in sourceDirs
+// which are within the block's time range and belong to a series of the block. It's used to carry the exemplars
+// over to the blocks compacted or rewritten from the source blocks.
+func WriteExemplarsFromSources(blockDir string, sourceDirs []string) (err error) {
+	var sources [][]exemplar.QueryResult
+	for _, dir := range sourceDirs {
+		series, err := ReadExemplarsFromDir(dir)
+		if err != nil {
+			return errors.Wrapf(err, "read exemplars of the block %s", dir)
+		}
+		if len(series) > 0 {
+			sources = append(sources, series)
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+
+	meta, err := ReadMetaFromDir(blockDir)
+	if err != nil {
+		return errors.Wrap(err, "read meta")
+	}
+
+	r, err := index.NewFileReader(filepath.Join(blockDir, IndexFilename))
+	if err != nil {
+		return errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithErrCapture(&err, r, "close index reader")
+
+	// The block time range is half-open, while the filter's one is closed.
+	merged := FilterExemplars(MergeExemplars(sources...), meta.MinTime, meta.MaxTime-1)
+	if len(merged) == 0 {
+		return nil
+	}
+
+	blockSeries, err := seriesHashes(r)
+	if err != nil {
+		return err
+	}
+
+	kept := merged[:0]
+	for _, s := range merged {
+		if _, ok := blockSeries[s.SeriesLabels.Hash()]; ok {
+			kept = append(kept, s)
+		}
+	}
+	return WriteExemplars(blockDir, kept)
+}
+
+// seriesHashes returns the set of the hashes of the labels of the series in the index.
+func seriesHashes(r *index.Reader) (map[uint64]struct{}, error) {
+	p, err := r.Postings(index.AllPostingsKey())
+	if err != nil {
+		return nil, errors.Wrap(err, "read all postings")
+	}
+
+	hashes := map[uint64]struct{}{}
+	builder := labels.NewScratchBuilder(0)
+	for p.Next() {
+		if err := r.Series(p.At(), &builder, nil); err != nil {
+			return nil, errors.Wrap(err, "read series")
+		}
+		hashes[builder.Labels().Hash()] = struct{}{}
+	}
+	if err := p.Err(); err != nil {
+		return nil, errors.Wrap(err, "iterate postings")
+	}
+	return hashes, nil
+}
+
+// SelectAllExemplars returns all the exemplars within start and end (both included) from the queryable.
+func SelectAllExemplars(ctx context.Context, q storage.ExemplarQueryable, start, end int64) ([]exemplar.QueryResult, error) {
+	querier, err := q.ExemplarQuerier(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "create exemplar querier")
+	}
+
+	// An empty set of matchers matches all the series.
+	return querier.Select(start, end, []*labels.Matcher{})
+}
+
+// HasExemplars returns whether the block has the exemplars file, according to the files listed in the meta.
+func (m *Meta) HasExemplars() bool {
+	for _, f := range m.Thanos.Files {
+		if f.RelPath == ExemplarsFilename {
+			return true
+		}
+	}
+	return false
+}
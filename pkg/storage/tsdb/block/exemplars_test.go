@@ -0,0 +1,229 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package block
+
+import (
+	"context"
+	"math"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestExemplars_EncodeDecode(t *testing.T) {
+	series := []exemplar.QueryResult{
+		{
+			SeriesLabels: labels.FromStrings("__name__", "metric", "pod", "pod-1"),
+			Exemplars: []exemplar.Exemplar{
+				{Labels: labels.FromStrings("trace_id", "abc"), Value: 1.5, Ts: 10, HasTs: true},
+				{Labels: labels.FromStrings("trace_id", "def", "span_id", "123"), Value: -2, Ts: -20, HasTs: true},
+			},
+		},
+		{
+			SeriesLabels: labels.FromStrings("__name__", "metric", "pod", "pod-2"),
+			Exemplars: []exemplar.Exemplar{
+				{Labels: labels.EmptyLabels(), Value: math.Inf(1), Ts: 30, HasTs: true},
+			},
+		},
+	}
+
+	data := EncodeExemplars(series)
+	decoded, err := DecodeExemplars(data)
+	require.NoError(t, err)
+	assert.Equal(t, series, decoded)
+
+	// Corrupted data is detected.
+	for i := range data {
+		corrupted := append([]byte(nil), data...)
+		corrupted[i] ^= 0xff
+		_, err := DecodeExemplars(corrupted)
+		assert.ErrorIs(t, err, errExemplarsCorrupted)
+	}
+	_, err = DecodeExemplars(data[:len(data)-1])
+	assert.ErrorIs(t, err, errExemplarsCorrupted)
+	_, err = DecodeExemplars(nil)
+	assert.ErrorIs(t, err, errExemplarsCorrupted)
+}
+
+func TestMergeExemplars(t *testing.T) {
+	series1 := labels.FromStrings("__name__", "metric", "pod", "pod-1")
+	series2 := labels.FromStrings("__name__", "metric", "pod", "pod-2")
+	e := func(trace string, ts int64) exemplar.Exemplar {
+		return exemplar.Exemplar{Labels: labels.FromStrings("trace_id", trace), Value: float64(ts), Ts: ts, HasTs: true}
+	}
+
+	merged := MergeExemplars(
+		[]exemplar.QueryResult{
+			{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e("a", 10), e("b", 30)}},
+			{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e("c", 20)}},
+		},
+		[]exemplar.QueryResult{
+			{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e("b", 30), e("d", 20), e("e", 30)}},
+		},
+		nil,
+	)
+
+	assert.Equal(t, []exemplar.QueryResult{
+		{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e("c", 20)}},
+		{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e("a", 10), e("d", 20), e("b", 30), e("e", 30)}},
+	}, merged)
+
+	assert.Empty(t, MergeExemplars())
+}
+
+func TestFilterExemplars(t *testing.T) {
+	series1 := labels.FromStrings("__name__", "metric", "pod", "pod-1")
+	series2 := labels.FromStrings("__name__", "metric", "pod", "pod-2")
+	e := func(ts int64) exemplar.Exemplar {
+		return exemplar.Exemplar{Labels: labels.FromStrings("trace_id", "abc"), Value: float64(ts), Ts: ts, HasTs: true}
+	}
+	series := []exemplar.QueryResult{
+		{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(10), e(20), e(30)}},
+		{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(40)}},
+	}
+
+	tests := map[string]struct {
+		start, end int64
+		matchers   [][]*labels.Matcher
+		expected   []exemplar.QueryResult
+	}{
+		"no matchers": {
+			start: 20,
+			end:   40,
+			expected: []exemplar.QueryResult{
+				{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(20), e(30)}},
+				{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(40)}},
+			},
+		},
+		"empty set of matchers": {
+			start:    0,
+			end:      10,
+			matchers: [][]*labels.Matcher{{}},
+			expected: []exemplar.QueryResult{
+				{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(10)}},
+			},
+		},
+		"matchers selecting one series": {
+			start:    0,
+			end:      100,
+			matchers: [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-2")}},
+			expected: []exemplar.QueryResult{
+				{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(40)}},
+			},
+		},
+		"sets of matchers selecting different series": {
+			start: 0,
+			end:   100,
+			matchers: [][]*labels.Matcher{
+				{labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-2")},
+				{labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-1"), labels.MustNewMatcher(labels.MatchEqual, "__name__", "metric")},
+			},
+			expected: series,
+		},
+		"no exemplars in the time range": {
+			start: 50,
+			end:   100,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, FilterExemplars(series, testData.start, testData.end, testData.matchers...))
+		})
+	}
+}
+
+func TestWriteExemplars(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	id, err := CreateBlock(ctx, tmpDir, []labels.Labels{
+		labels.FromStrings("pod", "pod-1", "job", "job-1"),
+		labels.FromStrings("pod", "pod-2", "job", "job-1"),
+		labels.FromStrings("pod", "pod-3", "job", "job-1"),
+	}, 10, 0, 1000, labels.EmptyLabels())
+	require.NoError(t, err)
+	blockDir := filepath.Join(tmpDir, id.String())
+
+	// No file is written without exemplars.
+	require.NoError(t, WriteExemplars(blockDir, nil))
+	assert.NoFileExists(t, filepath.Join(blockDir, ExemplarsFilename))
+
+	series := []exemplar.QueryResult{{
+		SeriesLabels: labels.FromStrings("pod", "pod-1", "job", "job-1"),
+		Exemplars:    []exemplar.Exemplar{{Labels: labels.FromStrings("trace_id", "abc"), Value: 1, Ts: 10, HasTs: true}},
+	}}
+	require.NoError(t, WriteExemplars(blockDir, series))
+	assert.FileExists(t, filepath.Join(blockDir, ExemplarsFilename))
+
+	// The exemplars file is uploaded with the block, and listed in the meta.
+	bkt := objstore.NewInMemBucket()
+	require.NoError(t, Upload(ctx, log.NewNopLogger(), bkt, blockDir, nil))
+
+	meta, err := DownloadMeta(ctx, log.NewNopLogger(), bkt, id)
+	require.NoError(t, err)
+	assert.True(t, meta.HasExemplars())
+	assert.Contains(t, bkt.Objects(), path.Join(id.String(), ExemplarsFilename))
+
+	actual, err := ReadExemplars(ctx, bkt, id)
+	require.NoError(t, err)
+	assert.Equal(t, series, actual)
+}
+
+func TestWriteExemplarsFromSources(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	series1 := labels.FromStrings("pod", "pod-1")
+	series2 := labels.FromStrings("pod", "pod-2")
+	series3 := labels.FromStrings("pod", "pod-3")
+	e := func(ts int64) exemplar.Exemplar {
+		return exemplar.Exemplar{Labels: labels.FromStrings("trace_id", "abc"), Value: float64(ts), Ts: ts, HasTs: true}
+	}
+
+	createBlock := func(series []labels.Labels, minT, maxT int64) string {
+		// Blocks need at least 3 series.
+		series = append(series, labels.FromStrings("pod", "other-1"), labels.FromStrings("pod", "other-2"))
+		id, err := CreateBlock(ctx, tmpDir, series, 10, minT, maxT, labels.EmptyLabels())
+		require.NoError(t, err)
+		return filepath.Join(tmpDir, id.String())
+	}
+
+	source1 := createBlock([]labels.Labels{series1, series2}, 0, 100)
+	require.NoError(t, WriteExemplars(source1, []exemplar.QueryResult{
+		{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(10), e(50)}},
+		{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(20)}},
+	}))
+	source2 := createBlock([]labels.Labels{series1, series3}, 100, 200)
+	require.NoError(t, WriteExemplars(source2, []exemplar.QueryResult{
+		{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(150)}},
+		{SeriesLabels: series3, Exemplars: []exemplar.Exemplar{e(160)}},
+	}))
+	source3 := createBlock([]labels.Labels{series1}, 200, 300)
+
+	t.Run("should keep the exemplars of the series and time range of the block", func(t *testing.T) {
+		// The block doesn't have series2, and its time range covers only part of the sources.
+		blockDir := createBlock([]labels.Labels{series1, series3}, 30, 200)
+		require.NoError(t, WriteExemplarsFromSources(blockDir, []string{source1, source2, source3}))
+
+		actual, err := ReadExemplarsFromDir(blockDir)
+		require.NoError(t, err)
+		assert.Equal(t, []exemplar.QueryResult{
+			{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(50), e(150)}},
+			{SeriesLabels: series3, Exemplars: []exemplar.Exemplar{e(160)}},
+		}, actual)
+	})
+
+	t.Run("should not write the exemplars file if the sources have no exemplars", func(t *testing.T) {
+		blockDir := createBlock([]labels.Labels{series1}, 200, 300)
+		require.NoError(t, WriteExemplarsFromSources(blockDir, []string{source3}))
+		assert.NoFileExists(t, filepath.Join(blockDir, ExemplarsFilename))
+	})
+}
@@ -25,11 +25,13 @@ import (
 type SourceType string
 
 const (
-	ReceiveSource         SourceType = "receive"
-	CompactorSource       SourceType = "compactor"
-	CompactorRepairSource SourceType = "compactor.repair"
-	BucketRepairSource    SourceType = "bucket.repair"
-	TestSource            SourceType = "test"
+	ReceiveSource             SourceType = "receive"
+	CompactorSource           SourceType = "compactor"
+	CompactorRepairSource     SourceType = "compactor.repair"
+	CompactorRewriteSource    SourceType = "compactor.rewrite"
+	CompactorDownsampleSource SourceType = "compactor.downsample"
+	BucketRepairSource        SourceType = "bucket.repair"
+	TestSource                SourceType = "test"
 )
 
 const (
@@ -39,12 +41,33 @@ const (
 	ThanosVersion1 = 1
 )
 
+// StorageTier is the object storage tier a block is stored in.
+type StorageTier string
+
+const (
+	// HotStorageTier is the blocks storage bucket, where all blocks are uploaded to.
+	HotStorageTier StorageTier = ""
+	// ColdStorageTier is the cold storage bucket, where the compactor moves the old blocks to.
+	ColdStorageTier StorageTier = "cold"
+)
+
+func (t StorageTier) String() string {
+	if t == HotStorageTier {
+		return "hot"
+	}
+	return string(t)
+}
+
 // Meta describes the a block's meta. It wraps the known TSDB meta structure and
 // extends it by Thanos-specific fields.
 type Meta struct {
 	tsdb.BlockMeta
 
 	Thanos ThanosMeta `json:"thanos"`
+
+	// StorageTier is the storage tier the block is stored in. It's not stored in the meta.json,
+	// but it's set when the meta is built out of the bucket index.
+	StorageTier StorageTier `json:"-"`
 }
 
 func (m *Meta) String() string {
@@ -95,6 +118,10 @@ type File struct {
 
 type ThanosDownsample struct {
 	Resolution int64 `json:"resolution"`
+
+	// Aggregate is the aggregation function applied to the samples of each resolution window.
+	// Mimir stores each aggregate of a downsampled block in a separate block. Empty for raw blocks.
+	Aggregate string `json:"aggregate,omitempty"`
 }
 
 // InjectThanosMeta sets Thanos meta to the block meta JSON and saves it to the disk.
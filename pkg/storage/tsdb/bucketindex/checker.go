@@ -0,0 +1,544 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucketindex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	util_math "github.com/grafana/mimir/pkg/util/math"
+)
+
+const (
+	// RepairDeleteOrphanedMark is the repair action deleting a global marker whose block doesn't exist.
+	RepairDeleteOrphanedMark = "delete-orphaned-mark"
+	// RepairCopyGlobalMark is the repair action copying a block marker to the global markers location.
+	RepairCopyGlobalMark = "copy-global-mark"
+	// RepairMarkPartialBlockForDeletion is the repair action marking a stale partial block for deletion.
+	RepairMarkPartialBlockForDeletion = "mark-partial-block-for-deletion"
+	// RepairWriteIndex is the repair action writing the bucket index rebuilt from the bucket content.
+	RepairWriteIndex = "write-index"
+)
+
+// CheckReport is the result of the consistency check of a tenant's bucket index against the bucket content.
+type CheckReport struct {
+	// IndexNotFound and IndexCorrupted are true if the bucket index doesn't exist or can't be decoded.
+	IndexNotFound  bool `json:"index_not_found,omitempty"`
+	IndexCorrupted bool `json:"index_corrupted,omitempty"`
+
+	// IndexUpdatedAt is a unix timestamp (seconds precision) of when the bucket index has been updated the last time.
+	IndexUpdatedAt int64 `json:"index_updated_at,omitempty"`
+
+	// Blocks and block deletion marks found in the bucket but not in the bucket index.
+	BlocksMissingFromIndex        []ulid.ULID `json:"blocks_missing_from_index,omitempty"`
+	DeletionMarksMissingFromIndex []ulid.ULID `json:"deletion_marks_missing_from_index,omitempty"`
+
+	// Blocks and block deletion marks in the bucket index which are not found in the bucket anymore.
+	StaleIndexBlocks        []ulid.ULID `json:"stale_index_blocks,omitempty"`
+	StaleIndexDeletionMarks []ulid.ULID `json:"stale_index_deletion_marks,omitempty"`
+
+	// Blocks whose meta.json is missing or corrupted.
+	PartialBlocks []PartialBlock `json:"partial_blocks,omitempty"`
+
+	// Paths of the global markers whose block doesn't exist.
+	OrphanedMarks []string `json:"orphaned_marks,omitempty"`
+
+	// Paths of the global markers missing for blocks having a marker in the block location.
+	MissingGlobalMarks []string `json:"missing_global_marks,omitempty"`
+
+	// Overlapping blocks and gaps in the time coverage of the blocks not marked for deletion.
+	// They're reported for investigation, but they're not repaired.
+	OverlappingBlocks []BlocksOverlap `json:"overlapping_blocks,omitempty"`
+	Gaps              []TimeRange     `json:"gaps,omitempty"`
+
+	// The bucket index rebuilt from the bucket content.
+	index *Index
+}
+
+// IndexOutdated returns whether the bucket index has to be rewritten to match the bucket content.
+func (r *CheckReport) IndexOutdated() bool {
+	return r.IndexCorrupted ||
+		(r.IndexNotFound && len(r.index.Blocks) > 0) ||
+		len(r.BlocksMissingFromIndex) > 0 ||
+		len(r.DeletionMarksMissingFromIndex) > 0 ||
+		len(r.StaleIndexBlocks) > 0 ||
+		len(r.StaleIndexDeletionMarks) > 0
+}
+
+// PartialBlock holds the information about a block whose meta.json is missing or corrupted.
+type PartialBlock struct {
+	ID    ulid.ULID `json:"block_id"`
+	Error string    `json:"error"`
+
+	// MarkedForDeletion is true if the block has a deletion mark.
+	MarkedForDeletion bool `json:"marked_for_deletion"`
+
+	// LastModified is a unix timestamp (seconds precision) of the most recent object of the block.
+	// It's zero for the partial blocks in the cold storage.
+	LastModified int64 `json:"last_modified,omitempty"`
+
+	metaNotFound bool
+}
+
+// BlocksOverlap holds two blocks with the same resolution and compactor shard ID whose time ranges overlap.
+type BlocksOverlap struct {
+	Blocks  []ulid.ULID `json:"blocks"`
+	MinTime int64       `json:"min_time"`
+	MaxTime int64       `json:"max_time"`
+}
+
+// TimeRange is a time range (millis precision) not covered by any block.
+type TimeRange struct {
+	MinTime int64 `json:"min_time"`
+	MaxTime int64 `json:"max_time"`
+}
+
+// RepairOptions configures the repair of the bucket index and the bucket content.
+type RepairOptions struct {
+	// DryRun reports the repair actions without running them.
+	DryRun bool
+
+	// PartialBlockDeletionDelay is how long the objects of a partial block have to be unmodified
+	// for the partial block to be marked for deletion. Partial blocks are not marked if it's 0.
+	PartialBlockDeletionDelay time.Duration
+}
+
+// RepairAction is an action run, or to be run in dry-run mode, to repair the bucket. The path is relative
+// to the tenant's location in the bucket.
+type RepairAction struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+}
+
+// Checker checks the consistency of a tenant's bucket index against the bucket content, and repairs it.
+type Checker struct {
+	bkt         objstore.Bucket
+	coldBkt     objstore.Bucket
+	userID      string
+	cfgProvider bucket.TenantConfigProvider
+	logger      log.Logger
+}
+
+// NewChecker makes a new Checker. The coldBkt can be nil if the cold storage is disabled.
+func NewChecker(bkt, coldBkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, logger log.Logger) *Checker {
+	return &Checker{
+		bkt:         bkt,
+		coldBkt:     coldBkt,
+		userID:      userID,
+		cfgProvider: cfgProvider,
+		logger:      logger,
+	}
+}
+
+// Check compares the bucket index with the index rebuilt from the bucket content, and looks for
+// partial blocks, inconsistent markers, overlapping blocks and gaps in the time coverage.
+func (c *Checker) Check(ctx context.Context) (*CheckReport, error) {
+	report := &CheckReport{}
+
+	old, err := ReadIndex(ctx, c.bkt, c.userID, c.cfgProvider, c.logger)
+	switch {
+	case errors.Is(err, ErrIndexNotFound):
+		report.IndexNotFound = true
+	case errors.Is(err, ErrIndexCorrupted):
+		report.IndexCorrupted = true
+	case err != nil:
+		return nil, err
+	default:
+		report.IndexUpdatedAt = old.UpdatedAt
+	}
+
+	if c.coldBkt == nil && old != nil {
+		for _, b := range old.Blocks {
+			if b.StorageTier == block.ColdStorageTier {
+				return nil, errors.New("the bucket index references blocks in the cold storage, but the cold storage bucket is not configured")
+			}
+		}
+	}
+
+	// Rebuild the index from scratch, so that the meta.json of all the blocks is looked up.
+	idx, partials, err := NewTieredUpdater(c.bkt, c.coldBkt, c.userID, c.cfgProvider, c.logger).UpdateIndex(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	report.index = idx
+
+	if old != nil {
+		report.BlocksMissingFromIndex, report.StaleIndexBlocks = diffULIDs(idx.Blocks.GetULIDs(), old.Blocks.GetULIDs())
+		report.DeletionMarksMissingFromIndex, report.StaleIndexDeletionMarks = diffULIDs(idx.BlockDeletionMarks.GetULIDs(), old.BlockDeletionMarks.GetULIDs())
+	}
+
+	content, err := c.listBucketContent(ctx, partials)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, partialErr := range partials {
+		p := PartialBlock{
+			ID:           id,
+			Error:        partialErr.Error(),
+			metaNotFound: errors.Is(partialErr, ErrBlockMetaNotFound),
+		}
+		if marks, ok := content.blocks[id]; ok {
+			_, p.MarkedForDeletion = marks[block.DeletionMarkFilename]
+			p.LastModified = content.lastModified[id].Unix()
+		}
+		report.PartialBlocks = append(report.PartialBlocks, p)
+	}
+	sort.Slice(report.PartialBlocks, func(i, j int) bool {
+		return report.PartialBlocks[i].ID.Compare(report.PartialBlocks[j].ID) < 0
+	})
+
+	for markPath, id := range content.globalMarks {
+		_, inHot := content.blocks[id]
+		_, inCold := content.coldBlocks[id]
+		if !inHot && !inCold {
+			report.OrphanedMarks = append(report.OrphanedMarks, markPath)
+		}
+	}
+	for id, marks := range content.blocks {
+		for markFilename := range marks {
+			if markPath := globalMarkPath(id, markFilename); markPath != "" {
+				if _, ok := content.globalMarks[markPath]; !ok {
+					report.MissingGlobalMarks = append(report.MissingGlobalMarks, markPath)
+				}
+			}
+		}
+	}
+	sort.Strings(report.OrphanedMarks)
+	sort.Strings(report.MissingGlobalMarks)
+
+	live := liveBlocks(idx)
+	report.OverlappingBlocks = findOverlappingBlocks(live)
+	report.Gaps = findGaps(live)
+
+	return report, nil
+}
+
+// Repair fixes the inconsistencies found by Check: it deletes the orphaned global markers, copies the
+// missing global markers, marks the stale partial blocks for deletion and rewrites the bucket index.
+// Overlapping blocks and gaps are not repaired.
+func (c *Checker) Repair(ctx context.Context, report *CheckReport, opts RepairOptions) ([]RepairAction, error) {
+	var actions []RepairAction
+	userBkt := bucket.NewUserBucketClient(c.userID, c.bkt, c.cfgProvider)
+
+	for _, markPath := range report.OrphanedMarks {
+		actions = append(actions, RepairAction{Action: RepairDeleteOrphanedMark, Path: markPath})
+		if opts.DryRun {
+			continue
+		}
+		if err := userBkt.Delete(ctx, markPath); err != nil && !userBkt.IsObjNotFoundErr(err) {
+			return actions, errors.Wrapf(err, "delete orphaned mark %s", markPath)
+		}
+		level.Info(c.logger).Log("msg", "deleted orphaned mark", "mark", markPath)
+	}
+
+	for _, markPath := range report.MissingGlobalMarks {
+		actions = append(actions, RepairAction{Action: RepairCopyGlobalMark, Path: markPath})
+		if opts.DryRun {
+			continue
+		}
+		if err := copyGlobalMark(ctx, userBkt, markPath); err != nil {
+			return actions, err
+		}
+		level.Info(c.logger).Log("msg", "copied mark to the global markers location", "mark", markPath)
+	}
+
+	if opts.PartialBlockDeletionDelay > 0 {
+		cutoff := time.Now().Add(-opts.PartialBlockDeletionDelay)
+
+		for _, p := range report.PartialBlocks {
+			// We can only delete the blocks which are partial because the meta.json is missing, like the compactor.
+			if !p.metaNotFound || p.MarkedForDeletion || p.LastModified == 0 || !time.Unix(p.LastModified, 0).Before(cutoff) {
+				continue
+			}
+
+			actions = append(actions, RepairAction{Action: RepairMarkPartialBlockForDeletion, Path: path.Join(p.ID.String(), block.DeletionMarkFilename)})
+			if opts.DryRun {
+				continue
+			}
+			if err := markForDeletion(ctx, userBkt, p.ID, "stale partial block"); err != nil {
+				return actions, err
+			}
+			level.Info(c.logger).Log("msg", "marked stale partial block for deletion", "block", p.ID)
+		}
+	}
+
+	// The deletion marks changed by the previous actions have to be reflected in the index too.
+	if !report.IndexOutdated() && len(actions) == 0 {
+		return actions, nil
+	}
+
+	actions = append(actions, RepairAction{Action: RepairWriteIndex, Path: IndexCompressedFilename})
+	if opts.DryRun {
+		return actions, nil
+	}
+
+	idx := report.index
+	if len(actions) > 1 {
+		var err error
+		if idx, _, err = NewTieredUpdater(c.bkt, c.coldBkt, c.userID, c.cfgProvider, c.logger).UpdateIndex(ctx, idx); err != nil {
+			return actions, err
+		}
+	}
+	if err := WriteIndex(ctx, c.bkt, c.userID, c.cfgProvider, idx); err != nil {
+		return actions, err
+	}
+	level.Info(c.logger).Log("msg", "wrote bucket index", "blocks", len(idx.Blocks), "deletion_marks", len(idx.BlockDeletionMarks))
+
+	return actions, nil
+}
+
+type bucketContent struct {
+	// Blocks found in the blocks storage bucket, with the markers in their location.
+	blocks map[ulid.ULID]map[string]struct{}
+
+	// Blocks found in the cold storage bucket.
+	coldBlocks map[ulid.ULID]struct{}
+
+	// Block IDs by path of the global markers.
+	globalMarks map[string]ulid.ULID
+
+	// Most recent modification time of the objects of the partial blocks.
+	lastModified map[ulid.ULID]time.Time
+}
+
+func (c *Checker) listBucketContent(ctx context.Context, partials map[ulid.ULID]error) (*bucketContent, error) {
+	content := &bucketContent{
+		blocks:       map[ulid.ULID]map[string]struct{}{},
+		coldBlocks:   map[ulid.ULID]struct{}{},
+		globalMarks:  map[string]ulid.ULID{},
+		lastModified: map[ulid.ULID]time.Time{},
+	}
+
+	userBkt := bucket.NewUserBucketClient(c.userID, c.bkt, c.cfgProvider)
+	err := userBkt.Iter(ctx, "", func(name string) error {
+		dir, file, _ := strings.Cut(name, objstore.DirDelim)
+
+		if dir == block.MarkersPathname {
+			if id, ok := block.IsDeletionMarkFilename(file); ok {
+				content.globalMarks[name] = id
+			} else if id, ok := block.IsNoCompactMarkFilename(file); ok {
+				content.globalMarks[name] = id
+			}
+			return nil
+		}
+
+		id, ok := block.IsBlockDir(dir)
+		if !ok {
+			return nil
+		}
+		if content.blocks[id] == nil {
+			content.blocks[id] = map[string]struct{}{}
+		}
+		if file == block.DeletionMarkFilename || file == block.NoCompactMarkFilename {
+			content.blocks[id][file] = struct{}{}
+		}
+
+		if _, ok := partials[id]; ok {
+			attrs, err := userBkt.Attributes(ctx, name)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get attributes for %s", name)
+			}
+			if attrs.LastModified.After(content.lastModified[id]) {
+				content.lastModified[id] = attrs.LastModified
+			}
+		}
+		return nil
+	}, objstore.WithRecursiveIter)
+	if err != nil {
+		return nil, errors.Wrap(err, "list bucket")
+	}
+
+	if c.coldBkt != nil {
+		if content.coldBlocks, err = listBlocks(ctx, bucket.NewUserBucketClient(c.userID, c.coldBkt, c.cfgProvider)); err != nil {
+			return nil, err
+		}
+	}
+
+	return content, nil
+}
+
+// globalMarkPath returns the path of the global marker of the block marker, or an empty string
+// if the marker is not mirrored in the global markers location.
+func globalMarkPath(id ulid.ULID, markFilename string) string {
+	switch markFilename {
+	case block.DeletionMarkFilename:
+		return block.DeletionMarkFilepath(id)
+	case block.NoCompactMarkFilename:
+		return block.NoCompactMarkFilepath(id)
+	}
+	return ""
+}
+
+func copyGlobalMark(ctx context.Context, userBkt objstore.Bucket, markPath string) error {
+	var blockMarkPath string
+	if id, ok := block.IsDeletionMarkFilename(path.Base(markPath)); ok {
+		blockMarkPath = path.Join(id.String(), block.DeletionMarkFilename)
+	} else if id, ok := block.IsNoCompactMarkFilename(path.Base(markPath)); ok {
+		blockMarkPath = path.Join(id.String(), block.NoCompactMarkFilename)
+	} else {
+		return errors.Errorf("unknown global mark %s", markPath)
+	}
+
+	r, err := userBkt.Get(ctx, blockMarkPath)
+	if err != nil {
+		return errors.Wrapf(err, "read mark %s", blockMarkPath)
+	}
+	body, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		return errors.Wrapf(err, "read mark %s", blockMarkPath)
+	}
+
+	return errors.Wrapf(userBkt.Upload(ctx, markPath, bytes.NewReader(body)), "upload mark %s", markPath)
+}
+
+func markForDeletion(ctx context.Context, userBkt objstore.Bucket, id ulid.ULID, details string) error {
+	data, err := json.Marshal(block.DeletionMark{
+		ID:           id,
+		Version:      block.DeletionMarkVersion1,
+		Details:      details,
+		DeletionTime: time.Now().Unix(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "json encode deletion mark")
+	}
+
+	markPath := path.Join(id.String(), block.DeletionMarkFilename)
+	return errors.Wrapf(block.BucketWithGlobalMarkers(userBkt).Upload(ctx, markPath, bytes.NewReader(data)), "upload mark %s", markPath)
+}
+
+// diffULIDs returns the IDs only found in a, and the ones only found in b.
+func diffULIDs(a, b []ulid.ULID) (onlyA, onlyB []ulid.ULID) {
+	inA := make(map[ulid.ULID]struct{}, len(a))
+	for _, id := range a {
+		inA[id] = struct{}{}
+	}
+	inB := make(map[ulid.ULID]struct{}, len(b))
+	for _, id := range b {
+		inB[id] = struct{}{}
+	}
+
+	for _, id := range a {
+		if _, ok := inB[id]; !ok {
+			onlyA = append(onlyA, id)
+		}
+	}
+	for _, id := range b {
+		if _, ok := inA[id]; !ok {
+			onlyB = append(onlyB, id)
+		}
+	}
+
+	sortULIDs(onlyA)
+	sortULIDs(onlyB)
+	return onlyA, onlyB
+}
+
+func sortULIDs(ids []ulid.ULID) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Compare(ids[j]) < 0 })
+}
+
+// liveBlocks returns the blocks of the index not marked for deletion, sorted by min time.
+func liveBlocks(idx *Index) Blocks {
+	marked := make(map[ulid.ULID]struct{}, len(idx.BlockDeletionMarks))
+	for _, m := range idx.BlockDeletionMarks {
+		marked[m.ID] = struct{}{}
+	}
+
+	live := make(Blocks, 0, len(idx.Blocks))
+	for _, b := range idx.Blocks {
+		if _, ok := marked[b.ID]; !ok {
+			live = append(live, b)
+		}
+	}
+
+	sort.Slice(live, func(i, j int) bool {
+		if live[i].MinTime != live[j].MinTime {
+			return live[i].MinTime < live[j].MinTime
+		}
+		return live[i].ID.Compare(live[j].ID) < 0
+	})
+	return live
+}
+
+// findOverlappingBlocks returns the pairs of compacted blocks with the same resolution and compactor shard ID
+// whose time ranges overlap. The blocks which have not been compacted yet are expected to overlap, so they're
+// not checked. The input blocks must be sorted by min time.
+func findOverlappingBlocks(blocks Blocks) []BlocksOverlap {
+	type groupKey struct {
+		resolution int64
+		shardID    string
+	}
+
+	groups := map[groupKey]Blocks{}
+	for _, b := range blocks {
+		if b.CompactionLevel <= 1 {
+			continue
+		}
+		key := groupKey{resolution: b.Resolution, shardID: b.CompactorShardID}
+		groups[key] = append(groups[key], b)
+	}
+
+	var overlaps []BlocksOverlap
+	for _, group := range groups {
+		for i, a := range group {
+			for _, b := range group[i+1:] {
+				// Block intervals are half-open: [MinTime, MaxTime).
+				if b.MinTime >= a.MaxTime {
+					break
+				}
+				overlaps = append(overlaps, BlocksOverlap{
+					Blocks:  []ulid.ULID{a.ID, b.ID},
+					MinTime: b.MinTime,
+					MaxTime: util_math.Min(a.MaxTime, b.MaxTime),
+				})
+			}
+		}
+	}
+
+	sort.Slice(overlaps, func(i, j int) bool {
+		if overlaps[i].MinTime != overlaps[j].MinTime {
+			return overlaps[i].MinTime < overlaps[j].MinTime
+		}
+		return overlaps[i].Blocks[0].Compare(overlaps[j].Blocks[0]) < 0
+	})
+	return overlaps
+}
+
+// findGaps returns the time ranges between the oldest and the newest raw block not covered by any raw block.
+// The input blocks must be sorted by min time.
+func findGaps(blocks Blocks) []TimeRange {
+	var gaps []TimeRange
+	var coveredUntil int64
+	first := true
+
+	for _, b := range blocks {
+		if b.Resolution != 0 {
+			continue
+		}
+		if !first && b.MinTime > coveredUntil {
+			gaps = append(gaps, TimeRange{MinTime: coveredUntil, MaxTime: b.MinTime})
+		}
+		if first || b.MaxTime > coveredUntil {
+			coveredUntil = b.MaxTime
+		}
+		first = false
+	}
+
+	return gaps
+}
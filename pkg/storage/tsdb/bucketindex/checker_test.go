@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucketindex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/testutil"
+)
+
+func TestChecker_CheckAndRepair(t *testing.T) {
+	const userID = "user-1"
+
+	rawBkt, _ := testutil.PrepareFilesystemBucket(t)
+	bkt := block.BucketWithGlobalMarkers(rawBkt)
+	userBkt := bucket.NewUserBucketClient(userID, rawBkt, nil)
+
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	block1 := block.MockStorageBlockWithExtLabels(t, bkt, userID, 10, 20, nil)
+	block2 := block.MockStorageBlockWithExtLabels(t, bkt, userID, 20, 30, nil)
+
+	idx, _, err := NewUpdater(bkt, userID, nil, logger).UpdateIndex(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, WriteIndex(ctx, bkt, userID, nil, idx))
+
+	// Add a block and a deletion mark the index doesn't know about.
+	block3 := block.MockStorageBlockWithExtLabels(t, bkt, userID, 40, 50, nil)
+	block4 := block.MockStorageBlockWithExtLabels(t, bkt, userID, 50, 60, nil)
+	block.MockStorageDeletionMark(t, bkt, userID, block4.BlockMeta)
+
+	// Delete the meta.json of an indexed block, leaving a partial block behind.
+	require.NoError(t, userBkt.Delete(ctx, path.Join(block1.ULID.String(), block.MetaFilename)))
+
+	// Upload a no-compact mark without the global marker.
+	block.MockNoCompactMark(t, rawBkt, userID, block2.BlockMeta)
+
+	// Upload a global marker whose block doesn't exist.
+	orphanedID := ulid.MustNew(100, rand.Reader)
+	require.NoError(t, userBkt.Upload(ctx, block.DeletionMarkFilepath(orphanedID), strings.NewReader("{}")))
+
+	checker := NewChecker(bkt, nil, userID, nil, logger)
+
+	report, err := checker.Check(ctx)
+	require.NoError(t, err)
+
+	assert.False(t, report.IndexNotFound)
+	assert.Equal(t, idx.UpdatedAt, report.IndexUpdatedAt)
+	assert.Equal(t, sortedULIDs(block3.ULID, block4.ULID), report.BlocksMissingFromIndex)
+	assert.Equal(t, []ulid.ULID{block4.ULID}, report.DeletionMarksMissingFromIndex)
+	assert.Equal(t, []ulid.ULID{block1.ULID}, report.StaleIndexBlocks)
+	assert.Empty(t, report.StaleIndexDeletionMarks)
+	require.Len(t, report.PartialBlocks, 1)
+	assert.Equal(t, block1.ULID, report.PartialBlocks[0].ID)
+	assert.False(t, report.PartialBlocks[0].MarkedForDeletion)
+	assert.NotZero(t, report.PartialBlocks[0].LastModified)
+	assert.Equal(t, []string{block.DeletionMarkFilepath(orphanedID)}, report.OrphanedMarks)
+	assert.Equal(t, []string{block.NoCompactMarkFilepath(block2.ULID)}, report.MissingGlobalMarks)
+	assert.Empty(t, report.OverlappingBlocks)
+	assert.Equal(t, []TimeRange{{MinTime: 30, MaxTime: 40}}, report.Gaps)
+	assert.True(t, report.IndexOutdated())
+
+	// Partial blocks modified more recently than the delay are not marked for deletion.
+	actions, err := checker.Repair(ctx, report, RepairOptions{DryRun: true, PartialBlockDeletionDelay: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, []RepairAction{
+		{Action: RepairDeleteOrphanedMark, Path: block.DeletionMarkFilepath(orphanedID)},
+		{Action: RepairCopyGlobalMark, Path: block.NoCompactMarkFilepath(block2.ULID)},
+		{Action: RepairWriteIndex, Path: IndexCompressedFilename},
+	}, actions)
+
+	expectedActions := []RepairAction{
+		{Action: RepairDeleteOrphanedMark, Path: block.DeletionMarkFilepath(orphanedID)},
+		{Action: RepairCopyGlobalMark, Path: block.NoCompactMarkFilepath(block2.ULID)},
+		{Action: RepairMarkPartialBlockForDeletion, Path: path.Join(block1.ULID.String(), block.DeletionMarkFilename)},
+		{Action: RepairWriteIndex, Path: IndexCompressedFilename},
+	}
+
+	// The dry-run mode should not change the bucket.
+	actions, err = checker.Repair(ctx, report, RepairOptions{DryRun: true, PartialBlockDeletionDelay: time.Nanosecond})
+	require.NoError(t, err)
+	assert.Equal(t, expectedActions, actions)
+
+	again, err := checker.Check(ctx)
+	require.NoError(t, err)
+	assertReportsEqual(t, report, again)
+
+	actions, err = checker.Repair(ctx, report, RepairOptions{PartialBlockDeletionDelay: time.Nanosecond})
+	require.NoError(t, err)
+	assert.Equal(t, expectedActions, actions)
+
+	repaired, err := checker.Check(ctx)
+	require.NoError(t, err)
+	assert.False(t, repaired.IndexOutdated())
+	assert.Empty(t, repaired.OrphanedMarks)
+	assert.Empty(t, repaired.MissingGlobalMarks)
+	require.Len(t, repaired.PartialBlocks, 1)
+	assert.True(t, repaired.PartialBlocks[0].MarkedForDeletion)
+	assert.Equal(t, []TimeRange{{MinTime: 30, MaxTime: 40}}, repaired.Gaps)
+
+	idx, err = ReadIndex(ctx, bkt, userID, nil, logger)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []ulid.ULID{block2.ULID, block3.ULID, block4.ULID}, idx.Blocks.GetULIDs())
+	assert.ElementsMatch(t, []ulid.ULID{block1.ULID, block4.ULID}, idx.BlockDeletionMarks.GetULIDs())
+
+	// Nothing is left to repair.
+	actions, err = checker.Repair(ctx, repaired, RepairOptions{PartialBlockDeletionDelay: time.Nanosecond})
+	require.NoError(t, err)
+	assert.Empty(t, actions)
+}
+
+func TestChecker_Check_ShouldFailIfColdStorageIsNotConfigured(t *testing.T) {
+	const userID = "user-1"
+
+	bkt, _ := testutil.PrepareFilesystemBucket(t)
+	ctx := context.Background()
+
+	id := ulid.MustNew(1, rand.Reader)
+	require.NoError(t, WriteIndex(ctx, bkt, userID, nil, &Index{
+		Version: IndexVersion2,
+		Blocks:  Blocks{{ID: id, MinTime: 10, MaxTime: 20, StorageTier: block.ColdStorageTier}},
+	}))
+
+	_, err := NewChecker(bkt, nil, userID, nil, log.NewNopLogger()).Check(ctx)
+	require.Error(t, err)
+}
+
+func TestFindOverlappingBlocksAndGaps(t *testing.T) {
+	id := func(i uint64) ulid.ULID { return ulid.MustNew(i, nil) }
+
+	blocks := Blocks{
+		// Uncompacted blocks are expected to overlap.
+		{ID: id(1), MinTime: 0, MaxTime: 20, CompactionLevel: 1},
+		{ID: id(2), MinTime: 0, MaxTime: 20, CompactionLevel: 1},
+		// Compacted blocks of different shards are expected to overlap.
+		{ID: id(3), MinTime: 20, MaxTime: 40, CompactionLevel: 2, CompactorShardID: "1_of_2"},
+		{ID: id(4), MinTime: 20, MaxTime: 40, CompactionLevel: 2, CompactorShardID: "2_of_2"},
+		{ID: id(5), MinTime: 30, MaxTime: 50, CompactionLevel: 3, CompactorShardID: "2_of_2"},
+		// Downsampled blocks don't overlap raw blocks, and they're not considered for gaps.
+		{ID: id(6), MinTime: 20, MaxTime: 100, CompactionLevel: 3, CompactorShardID: "2_of_2", Resolution: 300000},
+		{ID: id(7), MinTime: 70, MaxTime: 80, CompactionLevel: 1},
+	}
+
+	assert.Equal(t, []BlocksOverlap{
+		{Blocks: []ulid.ULID{id(4), id(5)}, MinTime: 30, MaxTime: 40},
+	}, findOverlappingBlocks(blocks))
+
+	assert.Equal(t, []TimeRange{{MinTime: 50, MaxTime: 70}}, findGaps(blocks))
+}
+
+func assertReportsEqual(t *testing.T, expected, actual *CheckReport) {
+	expectedJSON, err := json.Marshal(expected)
+	require.NoError(t, err)
+	actualJSON, err := json.Marshal(actual)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expectedJSON), string(actualJSON))
+}
+
+func sortedULIDs(ids ...ulid.ULID) []ulid.ULID {
+	sortULIDs(ids)
+	return ids
+}
@@ -42,6 +42,9 @@ type Index struct {
 	// List of block deletion marks.
 	BlockDeletionMarks BlockDeletionMarks `json:"block_deletion_marks"`
 
+	// List of pending series deletion tombstones, which should be honoured at query time.
+	Tombstones Tombstones `json:"tombstones,omitempty"`
+
 	// UpdatedAt is a unix timestamp (seconds precision) of when the index has been updated
 	// (written in the storage) the last time.
 	UpdatedAt int64 `json:"updated_at"`
@@ -90,6 +93,29 @@ type Block struct {
 
 	// Block's compactor shard ID, copied from tsdb.CompactorShardIDExternalLabel label.
 	CompactorShardID string `json:"compactor_shard_id,omitempty"`
+
+	// CompactionLevel of the block, copied from meta.json. It's 0 for the blocks added to
+	// the index before the field was introduced.
+	CompactionLevel int `json:"compaction_level,omitempty"`
+
+	// Resolution (millis precision) and aggregate of the samples of a downsampled block.
+	// Both are empty for raw blocks.
+	Resolution int64  `json:"resolution,omitempty"`
+	Aggregate  string `json:"aggregate,omitempty"`
+
+	// DownsampledFrom is the ID of the raw block a downsampled block has been downsampled from,
+	// copied from the parent block in meta.json. It's nil for raw blocks.
+	DownsampledFrom *ulid.ULID `json:"downsampled_from,omitempty"`
+
+	// BloomFilters is true if the block has the optional bloom filters file.
+	BloomFilters bool `json:"bloom_filters,omitempty"`
+
+	// Exemplars is true if the block has the optional exemplars file.
+	Exemplars bool `json:"exemplars,omitempty"`
+
+	// StorageTier is the storage tier the block is stored in. It's empty for the blocks stored
+	// in the blocks storage bucket, and it's "cold" for the blocks moved to the cold storage.
+	StorageTier block.StorageTier `json:"storage_tier,omitempty"`
 }
 
 // Within returns whether the block contains samples within the provided range.
@@ -107,6 +133,14 @@ func (m *Block) GetUploadedAt() time.Time {
 // The returned meta doesn't include all original meta.json data but only a subset
 // of it.
 func (m *Block) ThanosMeta() *block.Meta {
+	var files []block.File
+	if m.BloomFilters {
+		files = append(files, block.File{RelPath: block.BloomFiltersFilename})
+	}
+	if m.Exemplars {
+		files = append(files, block.File{RelPath: block.ExemplarsFilename})
+	}
+
 	return &block.Meta{
 		BlockMeta: tsdb.BlockMeta{
 			ULID:    m.ID,
@@ -117,7 +151,10 @@ func (m *Block) ThanosMeta() *block.Meta {
 		Thanos: block.ThanosMeta{
 			Version:      block.ThanosVersion1,
 			SegmentFiles: m.thanosMetaSegmentFiles(),
+			Files:        files,
+			Downsample:   block.ThanosDownsample{Resolution: m.Resolution, Aggregate: m.Aggregate},
 		},
+		StorageTier: m.StorageTier,
 	}
 }
 
@@ -140,12 +177,21 @@ func (m *Block) String() string {
 		shard = "none"
 	}
 
+	if m.Resolution > 0 {
+		return fmt.Sprintf("%s (min time: %s max time: %s, compactor shard: %s, resolution: %dms, aggregate: %s)", m.ID, minT.String(), maxT.String(), shard, m.Resolution, m.Aggregate)
+	}
 	return fmt.Sprintf("%s (min time: %s max time: %s, compactor shard: %s)", m.ID, minT.String(), maxT.String(), shard)
 }
 
 func BlockFromThanosMeta(meta block.Meta) *Block {
 	segmentsFormat, segmentsNum := detectBlockSegmentsFormat(meta)
 
+	// A downsampled block has a single parent, the raw block it has been downsampled from.
+	var downsampledFrom *ulid.ULID
+	if meta.Thanos.Downsample.Resolution > 0 && len(meta.Compaction.Parents) == 1 {
+		downsampledFrom = &meta.Compaction.Parents[0].ULID
+	}
+
 	return &Block{
 		ID:               meta.ULID,
 		MinTime:          meta.MinTime,
@@ -153,6 +199,12 @@ func BlockFromThanosMeta(meta block.Meta) *Block {
 		SegmentsFormat:   segmentsFormat,
 		SegmentsNum:      segmentsNum,
 		CompactorShardID: meta.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel],
+		CompactionLevel:  meta.Compaction.Level,
+		Resolution:       meta.Thanos.Downsample.Resolution,
+		Aggregate:        meta.Thanos.Downsample.Aggregate,
+		DownsampledFrom:  downsampledFrom,
+		BloomFilters:     meta.HasBloomFilters(),
+		Exemplars:        meta.HasExemplars(),
 	}
 }
 
@@ -138,6 +138,7 @@ func TestDetectBlockSegmentsFormat(t *testing.T) {
 
 func TestBlockFromThanosMeta(t *testing.T) {
 	blockID := ulid.MustNew(1, nil)
+	parentID := ulid.MustNew(2, nil)
 
 	tests := map[string]struct {
 		meta     block.Meta
@@ -272,6 +273,93 @@ func TestBlockFromThanosMeta(t *testing.T) {
 				CompactorShardID: "some weird value",
 			},
 		},
+		"meta.json of a compacted block": {
+			meta: block.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:       blockID,
+					MinTime:    10,
+					MaxTime:    20,
+					Compaction: tsdb.BlockMetaCompaction{Level: 2},
+				},
+			},
+			expected: Block{
+				ID:              blockID,
+				MinTime:         10,
+				MaxTime:         20,
+				CompactionLevel: 2,
+			},
+		},
+		"meta.json of a downsampled block": {
+			meta: block.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    blockID,
+					MinTime: 10,
+					MaxTime: 20,
+					Compaction: tsdb.BlockMetaCompaction{
+						Parents: []tsdb.BlockDesc{{ULID: parentID, MinTime: 10, MaxTime: 20}},
+					},
+				},
+				Thanos: block.ThanosMeta{
+					Downsample: block.ThanosDownsample{Resolution: 300000, Aggregate: "avg"},
+				},
+			},
+			expected: Block{
+				ID:              blockID,
+				MinTime:         10,
+				MaxTime:         20,
+				Resolution:      300000,
+				Aggregate:       "avg",
+				DownsampledFrom: &parentID,
+			},
+		},
+		"meta.json of a block with bloom filters": {
+			meta: block.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    blockID,
+					MinTime: 10,
+					MaxTime: 20,
+				},
+				Thanos: block.ThanosMeta{
+					Files: []block.File{
+						{RelPath: "index"},
+						{RelPath: block.BloomFiltersFilename},
+						{RelPath: "chunks/000001"},
+					},
+				},
+			},
+			expected: Block{
+				ID:             blockID,
+				MinTime:        10,
+				MaxTime:        20,
+				SegmentsFormat: SegmentsFormat1Based6Digits,
+				SegmentsNum:    1,
+				BloomFilters:   true,
+			},
+		},
+		"meta.json of a block with exemplars": {
+			meta: block.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    blockID,
+					MinTime: 10,
+					MaxTime: 20,
+				},
+				Thanos: block.ThanosMeta{
+					Files: []block.File{
+						{RelPath: "index"},
+						{RelPath: block.ExemplarsFilename},
+						{RelPath: "chunks/000001"},
+					},
+				},
+			},
+			expected: Block{
+				ID:             blockID,
+				MinTime:        10,
+				MaxTime:        20,
+				SegmentsFormat: SegmentsFormat1Based6Digits,
+				SegmentsNum:    1,
+				Exemplars:      true,
+			},
+		},
 	}
 
 	for testName, testData := range tests {
@@ -378,6 +466,46 @@ func TestBlock_ThanosMeta(t *testing.T) {
 				},
 			},
 		},
+		"block with bloom filters": {
+			block: Block{
+				ID:           blockID,
+				MinTime:      10,
+				MaxTime:      20,
+				BloomFilters: true,
+			},
+			expected: &block.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    blockID,
+					MinTime: 10,
+					MaxTime: 20,
+					Version: block.TSDBVersion1,
+				},
+				Thanos: block.ThanosMeta{
+					Version: block.ThanosVersion1,
+					Files:   []block.File{{RelPath: block.BloomFiltersFilename}},
+				},
+			},
+		},
+		"block with exemplars": {
+			block: Block{
+				ID:        blockID,
+				MinTime:   10,
+				MaxTime:   20,
+				Exemplars: true,
+			},
+			expected: &block.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    blockID,
+					MinTime: 10,
+					MaxTime: 20,
+					Version: block.TSDBVersion1,
+				},
+				Thanos: block.ThanosMeta{
+					Version: block.ThanosVersion1,
+					Files:   []block.File{{RelPath: block.ExemplarsFilename}},
+				},
+			},
+		},
 	}
 
 	for testName, testData := range tests {
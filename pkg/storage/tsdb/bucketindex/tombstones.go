@@ -0,0 +1,304 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucketindex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/runutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	// TombstonesPrefix is the location, relative to the tenant's location, where series deletion tombstones are stored.
+	TombstonesPrefix = "tombstones"
+)
+
+// TombstoneState is the processing state of a series deletion request.
+type TombstoneState string
+
+const (
+	// TombstonePending is the state of a series deletion request whose samples may still be
+	// stored in the blocks. Pending tombstones are honoured at query time.
+	TombstonePending TombstoneState = "pending"
+
+	// TombstoneProcessed is the state of a series deletion request whose samples have been
+	// purged from all blocks by the compactor.
+	TombstoneProcessed TombstoneState = "processed"
+)
+
+var (
+	ErrTombstoneNotFound  = errors.New("tombstone not found")
+	ErrTombstoneCorrupted = errors.New("tombstone corrupted")
+
+	errTombstoneNoSelectors       = errors.New("at least one series selector must be provided")
+	errTombstoneInvalidTimeRange  = errors.New("the end time must be greater than or equal to the start time")
+	errTombstoneEmptyMatchersList = errors.New("series selector must contain at least one matcher")
+)
+
+// Tombstone holds a series deletion request. Samples of the series matching any of the selectors
+// within the time range are masked by queriers while the tombstone is pending, and are physically
+// purged from the blocks by the compactor.
+type Tombstone struct {
+	// RequestID uniquely identifies the request within the tenant. It's computed from the
+	// selectors and time range, so that creating the same request twice is idempotent.
+	RequestID string `json:"request_id"`
+
+	// StartTime and EndTime specify the time range of the samples to delete (millis precision, both inclusive).
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+
+	// Selectors is the list of series selectors. A series is deleted if it matches any of them.
+	Selectors []string `json:"selectors"`
+
+	// CreatedAt is a unix timestamp (seconds precision) of when the request has been created.
+	CreatedAt int64 `json:"created_at"`
+
+	// State of the request, and unix timestamp (seconds precision) of its last update.
+	State          TombstoneState `json:"state"`
+	StateUpdatedAt int64          `json:"state_updated_at"`
+
+	// LastPurgedAt is a unix timestamp (seconds precision) of when the compactor last purged samples
+	// of the request from a block, or 0 if it never did.
+	LastPurgedAt int64 `json:"last_purged_at"`
+}
+
+// NewTombstone validates the input selectors and time range, and returns a pending tombstone.
+func NewTombstone(selectors []string, startTime, endTime int64, createdAt time.Time) (*Tombstone, error) {
+	if len(selectors) == 0 {
+		return nil, errTombstoneNoSelectors
+	}
+	if endTime < startTime {
+		return nil, errTombstoneInvalidTimeRange
+	}
+
+	// Normalise the selectors, so that the request ID doesn't depend on how they have been formatted.
+	normalised := make([]string, 0, len(selectors))
+	for _, s := range selectors {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid series selector %q", s)
+		}
+		if len(matchers) == 0 {
+			return nil, errTombstoneEmptyMatchersList
+		}
+
+		normalised = append(normalised, matchersToString(matchers))
+	}
+	sort.Strings(normalised)
+
+	return &Tombstone{
+		RequestID:      tombstoneRequestID(normalised, startTime, endTime),
+		StartTime:      startTime,
+		EndTime:        endTime,
+		Selectors:      normalised,
+		CreatedAt:      createdAt.Unix(),
+		State:          TombstonePending,
+		StateUpdatedAt: createdAt.Unix(),
+	}, nil
+}
+
+// NewRetentionTombstones returns a tombstone for each input retention rule, deleting the samples
+// of the series matching the rule's selector which are older than the rule's period at the given time.
+// The returned tombstones are never stored in the bucket.
+func NewRetentionTombstones(rules validation.RetentionRules, now time.Time) (Tombstones, error) {
+	out := make(Tombstones, 0, len(rules))
+	for _, rule := range rules {
+		t, err := NewTombstone([]string{rule.Selector}, math.MinInt64, now.Add(-time.Duration(rule.Period)).UnixMilli(), now)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid retention rule")
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func tombstoneRequestID(selectors []string, startTime, endTime int64) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strconv.FormatInt(startTime, 10)))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(strconv.FormatInt(endTime, 10)))
+	for _, s := range selectors {
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(s))
+	}
+
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func matchersToString(matchers []*labels.Matcher) string {
+	sorted := make([]*labels.Matcher, len(matchers))
+	copy(sorted, matchers)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		if sorted[i].Type != sorted[j].Type {
+			return sorted[i].Type < sorted[j].Type
+		}
+		return sorted[i].Value < sorted[j].Value
+	})
+
+	parts := make([]string, 0, len(sorted))
+	for _, m := range sorted {
+		parts = append(parts, m.String())
+	}
+
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// Matchers returns the parsed selectors.
+func (t *Tombstone) Matchers() ([][]*labels.Matcher, error) {
+	out := make([][]*labels.Matcher, 0, len(t.Selectors))
+	for _, s := range t.Selectors {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid series selector %q in tombstone %s", s, t.RequestID)
+		}
+		out = append(out, matchers)
+	}
+	return out, nil
+}
+
+// Overlaps returns whether the tombstone time range overlaps with the input one.
+// Input minT and maxT are both inclusive.
+func (t *Tombstone) Overlaps(minT, maxT int64) bool {
+	return t.StartTime <= maxT && minT <= t.EndTime
+}
+
+func (t *Tombstone) GetCreatedAt() time.Time {
+	return time.Unix(t.CreatedAt, 0)
+}
+
+func (t *Tombstone) GetLastPurgedAt() time.Time {
+	return time.Unix(t.LastPurgedAt, 0)
+}
+
+func (t *Tombstone) String() string {
+	return fmt.Sprintf("%s (selectors: %s, start: %d, end: %d, state: %s)", t.RequestID, strings.Join(t.Selectors, " or "), t.StartTime, t.EndTime, t.State)
+}
+
+// Tombstones holds a set of tombstones. No ordering guaranteed.
+type Tombstones []*Tombstone
+
+// Overlapping returns the tombstones whose time range overlaps with the input one.
+func (s Tombstones) Overlapping(minT, maxT int64) Tombstones {
+	var out Tombstones
+	for _, t := range s {
+		if t.Overlaps(minT, maxT) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func tombstonePath(requestID string) string {
+	return path.Join(TombstonesPrefix, requestID+".json")
+}
+
+// WriteTombstone uploads the tombstone to the tenant location in the bucket, overwriting any existing one with the same request ID.
+func WriteTombstone(ctx context.Context, bkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, t *Tombstone) error {
+	userBkt := bucket.NewUserBucketClient(userID, bkt, cfgProvider)
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return errors.Wrap(err, "serialize tombstone")
+	}
+
+	return errors.Wrap(userBkt.Upload(ctx, tombstonePath(t.RequestID), bytes.NewReader(data)), "upload tombstone")
+}
+
+// ReadTombstone reads the tombstone with the given request ID. Returns ErrTombstoneNotFound if it doesn't exist.
+func ReadTombstone(ctx context.Context, bkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, requestID string, logger log.Logger) (*Tombstone, error) {
+	userBkt := bucket.NewUserBucketClient(userID, bkt, cfgProvider)
+
+	return readTombstone(ctx, userBkt, tombstonePath(requestID), logger)
+}
+
+// DeleteTombstone deletes the tombstone with the given request ID. Deleting a non-existing tombstone is not an error.
+func DeleteTombstone(ctx context.Context, bkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, requestID string) error {
+	userBkt := bucket.NewUserBucketClient(userID, bkt, cfgProvider)
+
+	err := userBkt.Delete(ctx, tombstonePath(requestID))
+	if err != nil && !userBkt.IsObjNotFoundErr(err) {
+		return errors.Wrap(err, "delete tombstone")
+	}
+	return nil
+}
+
+// ListTombstones reads and returns all tombstones of the tenant, regardless of their state.
+// Corrupted tombstones are logged and skipped.
+func ListTombstones(ctx context.Context, bkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, logger log.Logger) (Tombstones, error) {
+	userBkt := bucket.NewUserBucketClient(userID, bkt, cfgProvider)
+
+	return listTombstones(ctx, userBkt, logger)
+}
+
+func listTombstones(ctx context.Context, userBkt objstore.InstrumentedBucketReader, logger log.Logger) (Tombstones, error) {
+	var names []string
+	err := userBkt.Iter(ctx, TombstonesPrefix+"/", func(name string) error {
+		if strings.HasSuffix(name, ".json") {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list tombstones")
+	}
+
+	out := make(Tombstones, 0, len(names))
+	for _, name := range names {
+		t, err := readTombstone(ctx, userBkt, name, logger)
+		if errors.Is(err, ErrTombstoneNotFound) {
+			// This could happen if the tombstone is deleted between the "list objects" and now.
+			continue
+		}
+		if errors.Is(err, ErrTombstoneCorrupted) {
+			level.Error(logger).Log("msg", "skipped corrupted tombstone", "tombstone", name, "err", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, t)
+	}
+
+	return out, nil
+}
+
+func readTombstone(ctx context.Context, userBkt objstore.InstrumentedBucketReader, name string, logger log.Logger) (*Tombstone, error) {
+	r, err := userBkt.ReaderWithExpectedErrs(userBkt.IsObjNotFoundErr).Get(ctx, name)
+	if err != nil {
+		if userBkt.IsObjNotFoundErr(err) {
+			return nil, ErrTombstoneNotFound
+		}
+		return nil, errors.Wrapf(err, "read tombstone %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(logger, r, "close tombstone reader")
+
+	t := &Tombstone{}
+	if err := json.NewDecoder(r).Decode(t); err != nil {
+		return nil, errors.Wrapf(ErrTombstoneCorrupted, "decode tombstone %s: %v", name, err)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucketindex
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/testutil"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestNewTombstone(t *testing.T) {
+	now := time.Now()
+
+	tests := map[string]struct {
+		selectors         []string
+		startTime         int64
+		endTime           int64
+		expectedSelectors []string
+		expectedErr       string
+	}{
+		"no selectors": {
+			startTime:   10,
+			endTime:     20,
+			expectedErr: errTombstoneNoSelectors.Error(),
+		},
+		"invalid time range": {
+			selectors:   []string{`{job="test"}`},
+			startTime:   20,
+			endTime:     10,
+			expectedErr: errTombstoneInvalidTimeRange.Error(),
+		},
+		"invalid selector": {
+			selectors:   []string{`{job=~"test"`},
+			startTime:   10,
+			endTime:     20,
+			expectedErr: `invalid series selector "{job=~\"test\""`,
+		},
+		"valid selectors are normalised and sorted": {
+			selectors:         []string{`up{job="test"}`, `{env="prod",__name__="metric"}`},
+			startTime:         10,
+			endTime:           10,
+			expectedSelectors: []string{`{__name__="metric", env="prod"}`, `{__name__="up", job="test"}`},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			actual, err := NewTombstone(testData.selectors, testData.startTime, testData.endTime, now)
+			if testData.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedSelectors, actual.Selectors)
+			assert.Equal(t, testData.startTime, actual.StartTime)
+			assert.Equal(t, testData.endTime, actual.EndTime)
+			assert.Equal(t, TombstonePending, actual.State)
+			assert.Equal(t, now.Unix(), actual.CreatedAt)
+			assert.NotEmpty(t, actual.RequestID)
+		})
+	}
+}
+
+func TestNewTombstone_RequestIDShouldNotDependOnSelectorsFormatting(t *testing.T) {
+	first, err := NewTombstone([]string{`up{job="test",env="prod"}`, `{__name__="other"}`}, 10, 20, time.Now())
+	require.NoError(t, err)
+
+	second, err := NewTombstone([]string{`other`, `{env="prod", job="test", __name__="up"}`}, 10, 20, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, first.RequestID, second.RequestID)
+
+	third, err := NewTombstone([]string{`other`, `{env="prod", job="test", __name__="up"}`}, 10, 21, time.Now())
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RequestID, third.RequestID)
+}
+
+func TestTombstone_Matchers(t *testing.T) {
+	tombstone, err := NewTombstone([]string{`up{job="test"}`, `{env=~"prod|dev"}`}, 10, 20, time.Now())
+	require.NoError(t, err)
+
+	actual, err := tombstone.Matchers()
+	require.NoError(t, err)
+	require.Len(t, actual, 2)
+	require.Len(t, actual[1], 1)
+
+	assert.Equal(t, []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "up"),
+		labels.MustNewMatcher(labels.MatchEqual, "job", "test"),
+	}, actual[0])
+	assert.Equal(t, `env=~"prod|dev"`, actual[1][0].String())
+}
+
+func TestTombstones_Overlapping(t *testing.T) {
+	first := &Tombstone{RequestID: "first", StartTime: 10, EndTime: 20}
+	second := &Tombstone{RequestID: "second", StartTime: 30, EndTime: 40}
+	tombstones := Tombstones{first, second}
+
+	assert.Empty(t, tombstones.Overlapping(0, 9))
+	assert.Equal(t, Tombstones{first}, tombstones.Overlapping(0, 10))
+	assert.Equal(t, Tombstones{first}, tombstones.Overlapping(20, 29))
+	assert.Equal(t, Tombstones{first, second}, tombstones.Overlapping(15, 35))
+	assert.Equal(t, Tombstones{second}, tombstones.Overlapping(40, 50))
+	assert.Empty(t, tombstones.Overlapping(41, 50))
+}
+
+func TestTombstones_WriteReadListDelete(t *testing.T) {
+	const userID = "user-1"
+
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	bkt, _ := testutil.PrepareFilesystemBucket(t)
+
+	// Reading or listing tombstones of a tenant without tombstones should not fail.
+	_, err := ReadTombstone(ctx, bkt, userID, nil, "unknown", logger)
+	require.ErrorIs(t, err, ErrTombstoneNotFound)
+
+	actual, err := ListTombstones(ctx, bkt, userID, nil, logger)
+	require.NoError(t, err)
+	assert.Empty(t, actual)
+
+	first, err := NewTombstone([]string{`up{job="first"}`}, 10, 20, time.Unix(100, 0))
+	require.NoError(t, err)
+	second, err := NewTombstone([]string{`up{job="second"}`}, 30, 40, time.Unix(200, 0))
+	require.NoError(t, err)
+
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, first))
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, second))
+
+	// Upload a corrupted tombstone, which is expected to be skipped when listing.
+	require.NoError(t, bkt.Upload(ctx, path.Join(userID, TombstonesPrefix, "corrupted.json"), bytes.NewReader([]byte("invalid!}"))))
+
+	read, err := ReadTombstone(ctx, bkt, userID, nil, first.RequestID, logger)
+	require.NoError(t, err)
+	assert.Equal(t, first, read)
+
+	_, err = ReadTombstone(ctx, bkt, userID, nil, "corrupted", logger)
+	require.ErrorIs(t, err, ErrTombstoneCorrupted)
+
+	actual, err = ListTombstones(ctx, bkt, userID, nil, logger)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, Tombstones{first, second}, actual)
+
+	// Delete a tombstone. Deleting it twice should not fail.
+	require.NoError(t, DeleteTombstone(ctx, bkt, userID, nil, first.RequestID))
+	require.NoError(t, DeleteTombstone(ctx, bkt, userID, nil, first.RequestID))
+
+	actual, err = ListTombstones(ctx, bkt, userID, nil, logger)
+	require.NoError(t, err)
+	assert.Equal(t, Tombstones{second}, actual)
+}
+
+func TestNewRetentionTombstones(t *testing.T) {
+	now := time.Now()
+
+	actual, err := NewRetentionTombstones(validation.RetentionRules{
+		{Selector: `{__name__=~"debug_.*"}`, Period: model.Duration(24 * time.Hour)},
+		{Selector: `up{job="test"}`, Period: model.Duration(time.Hour)},
+	}, now)
+	require.NoError(t, err)
+	require.Len(t, actual, 2)
+
+	assert.Equal(t, []string{`{__name__=~"debug_.*"}`}, actual[0].Selectors)
+	assert.Equal(t, int64(math.MinInt64), actual[0].StartTime)
+	assert.Equal(t, now.Add(-24*time.Hour).UnixMilli(), actual[0].EndTime)
+
+	assert.Equal(t, []string{`{__name__="up", job="test"}`}, actual[1].Selectors)
+	assert.Equal(t, int64(math.MinInt64), actual[1].StartTime)
+	assert.Equal(t, now.Add(-time.Hour).UnixMilli(), actual[1].EndTime)
+
+	_, err = NewRetentionTombstones(validation.RetentionRules{{Selector: `{job="test"`, Period: model.Duration(time.Hour)}}, now)
+	require.Error(t, err)
+}
@@ -32,15 +32,30 @@ var (
 
 // Updater is responsible to generate an update in-memory bucket index.
 type Updater struct {
-	bkt    objstore.InstrumentedBucket
-	logger log.Logger
+	bkt     objstore.InstrumentedBucket
+	coldBkt objstore.InstrumentedBucket
+	logger  log.Logger
+
+	// Blocks moved to the cold storage whose copy in the blocks storage bucket
+	// has not been deleted yet. Updated by UpdateIndex.
+	hotCopies []ulid.ULID
 }
 
 func NewUpdater(bkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, logger log.Logger) *Updater {
-	return &Updater{
+	return NewTieredUpdater(bkt, nil, userID, cfgProvider, logger)
+}
+
+// NewTieredUpdater makes a new Updater which also looks for the blocks moved to the cold storage bucket.
+// The coldBkt can be nil if the cold storage is disabled.
+func NewTieredUpdater(bkt, coldBkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, logger log.Logger) *Updater {
+	w := &Updater{
 		bkt:    bucket.NewUserBucketClient(userID, bkt, cfgProvider),
 		logger: logger,
 	}
+	if coldBkt != nil {
+		w.coldBkt = bucket.NewUserBucketClient(userID, coldBkt, cfgProvider)
+	}
+	return w
 }
 
 // UpdateIndex generates the bucket index and returns it, without storing it to the storage.
@@ -65,44 +80,106 @@ func (w *Updater) UpdateIndex(ctx context.Context, old *Index) (*Index, map[ulid
 		return nil, nil, err
 	}
 
+	tombstones, err := w.updateTombstones(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	return &Index{
 		Version:            IndexVersion2,
 		Blocks:             blocks,
 		BlockDeletionMarks: blockDeletionMarks,
+		Tombstones:         tombstones,
 		UpdatedAt:          time.Now().Unix(),
 	}, partials, nil
 }
 
+// HotCopies returns the blocks moved to the cold storage whose copy in the blocks storage
+// bucket has not been deleted yet, as found by the last UpdateIndex.
+func (w *Updater) HotCopies() []ulid.ULID {
+	return w.hotCopies
+}
+
 func (w *Updater) updateBlocks(ctx context.Context, old []*Block) (blocks []*Block, partials map[ulid.ULID]error, _ error) {
-	discovered := map[ulid.ULID]struct{}{}
 	partials = map[ulid.ULID]error{}
+	w.hotCopies = nil
 
 	// Find all blocks in the storage.
-	err := w.bkt.Iter(ctx, "", func(name string) error {
-		if id, ok := block.IsBlockDir(name); ok {
-			discovered[id] = struct{}{}
-		}
-		return nil
-	})
+	discovered, err := listBlocks(ctx, w.bkt)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "list blocks")
+		return nil, nil, err
+	}
+
+	// Find all blocks moved to the cold storage. A block is in the cold storage once
+	// its copy is complete, even if its copy in the blocks storage bucket still exists.
+	discoveredCold := map[ulid.ULID]struct{}{}
+	if w.coldBkt != nil {
+		if discoveredCold, err = listBlocks(ctx, w.coldBkt); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	// Since blocks are immutable, all blocks already existing in the index can just be copied.
+	// Since blocks are immutable, all blocks already existing in the index can just be copied,
+	// unless they have been moved to the cold storage in the meanwhile.
 	for _, b := range old {
-		if _, ok := discovered[b.ID]; ok {
-			blocks = append(blocks, b)
-			delete(discovered, b.ID)
+		_, inHot := discovered[b.ID]
+		_, inCold := discoveredCold[b.ID]
+
+		switch {
+		case b.StorageTier == block.ColdStorageTier && inCold:
+			if inHot {
+				w.hotCopies = append(w.hotCopies, b.ID)
+			}
+		case b.StorageTier == block.HotStorageTier && inHot && !inCold:
+		default:
+			continue
 		}
+
+		blocks = append(blocks, b)
+		delete(discovered, b.ID)
+		delete(discoveredCold, b.ID)
 	}
 
-	level.Info(w.logger).Log("msg", "listed all blocks in storage", "newly_discovered", len(discovered), "existing", len(old))
+	level.Info(w.logger).Log("msg", "listed all blocks in storage", "newly_discovered", len(discovered), "newly_discovered_cold", len(discoveredCold), "existing", len(old))
+
+	// Blocks found in the cold storage have to be looked up there first. If their meta.json is missing
+	// there, the copy to the cold storage has not been completed, and the block is still in the blocks
+	// storage bucket.
+	for id := range discoveredCold {
+		b, err := w.updateBlockIndexEntry(ctx, w.coldBkt, id)
+		if err == nil {
+			b.StorageTier = block.ColdStorageTier
+			blocks = append(blocks, b)
+			if _, inHot := discovered[id]; inHot {
+				w.hotCopies = append(w.hotCopies, id)
+				delete(discovered, id)
+			}
+			continue
+		}
+
+		if _, inHot := discovered[id]; inHot && (errors.Is(err, ErrBlockMetaNotFound) || errors.Is(err, ErrBlockMetaCorrupted)) {
+			level.Warn(w.logger).Log("msg", "skipped incomplete copy of block in the cold storage when updating bucket index", "block", id.String(), "err", err)
+			continue
+		}
+
+		if errors.Is(err, ErrBlockMetaNotFound) {
+			partials[id] = err
+			level.Warn(w.logger).Log("msg", "skipped partial block in the cold storage when updating bucket index", "block", id.String())
+			continue
+		}
+		if errors.Is(err, ErrBlockMetaCorrupted) {
+			partials[id] = err
+			level.Error(w.logger).Log("msg", "skipped block with corrupted meta.json in the cold storage when updating bucket index", "block", id.String(), "err", err)
+			continue
+		}
+		return nil, nil, err
+	}
 
 	// Remaining blocks are new ones and we have to fetch the meta.json for each of them, in order
 	// to find out if their upload has been completed (meta.json is uploaded last) and get the block
 	// information to store in the bucket index.
 	for id := range discovered {
-		b, err := w.updateBlockIndexEntry(ctx, id)
+		b, err := w.updateBlockIndexEntry(ctx, w.bkt, id)
 		if err == nil {
 			blocks = append(blocks, b)
 			continue
@@ -125,7 +202,24 @@ func (w *Updater) updateBlocks(ctx context.Context, old []*Block) (blocks []*Blo
 	return blocks, partials, nil
 }
 
-func (w *Updater) updateBlockIndexEntry(ctx context.Context, id ulid.ULID) (*Block, error) {
+// listBlocks returns the IDs of all blocks found in the bucket, including the partial ones.
+func listBlocks(ctx context.Context, bkt objstore.Bucket) (map[ulid.ULID]struct{}, error) {
+	discovered := map[ulid.ULID]struct{}{}
+
+	err := bkt.Iter(ctx, "", func(name string) error {
+		if id, ok := block.IsBlockDir(name); ok {
+			discovered[id] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list blocks")
+	}
+
+	return discovered, nil
+}
+
+func (w *Updater) updateBlockIndexEntry(ctx context.Context, bkt objstore.InstrumentedBucket, id ulid.ULID) (*Block, error) {
 	// Set a generous timeout for fetching the meta.json and getting the attributes of the same file.
 	// This protects against operations that can take unbounded time.
 	ctx, cancel := context.WithTimeout(ctx, time.Minute)
@@ -134,8 +228,8 @@ func (w *Updater) updateBlockIndexEntry(ctx context.Context, id ulid.ULID) (*Blo
 	metaFile := path.Join(id.String(), block.MetaFilename)
 
 	// Get the block's meta.json file.
-	r, err := w.bkt.Get(ctx, metaFile)
-	if w.bkt.IsObjNotFoundErr(err) {
+	r, err := bkt.Get(ctx, metaFile)
+	if bkt.IsObjNotFoundErr(err) {
 		return nil, ErrBlockMetaNotFound
 	}
 	if err != nil {
@@ -161,14 +255,15 @@ func (w *Updater) updateBlockIndexEntry(ctx context.Context, id ulid.ULID) (*Blo
 	block := BlockFromThanosMeta(m)
 
 	// Get the meta.json attributes.
-	attrs, err := w.bkt.Attributes(ctx, metaFile)
+	attrs, err := bkt.Attributes(ctx, metaFile)
 	if err != nil {
 		return nil, errors.Wrapf(err, "read meta file attributes: %v", metaFile)
 	}
 
 	// Since the meta.json file is the last file of a block being uploaded and it's immutable
 	// we can safely assume that the last modified timestamp of the meta.json is the time when
-	// the block has completed to be uploaded.
+	// the block has completed to be uploaded. For the blocks in the cold storage, it's the time
+	// when the block has been moved there.
 	block.UploadedAt = attrs.LastModified.Unix()
 
 	return block, nil
@@ -232,3 +327,23 @@ func (w *Updater) updateBlockDeletionMarkIndexEntry(ctx context.Context, id ulid
 
 	return BlockDeletionMarkFromThanosMarker(&m), nil
 }
+
+func (w *Updater) updateTombstones(ctx context.Context) (Tombstones, error) {
+	// Tombstones are mutable (their state changes once processed), so we can't reuse the
+	// ones from the old index and we always have to fetch them. Their number is expected to be small.
+	all, err := listTombstones(ctx, w.bkt, w.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending Tombstones
+	for _, t := range all {
+		if t.State == TombstonePending {
+			pending = append(pending, t)
+		}
+	}
+
+	level.Info(w.logger).Log("msg", "listed tombstones", "total", len(all), "pending", len(pending))
+
+	return pending, nil
+}
@@ -156,6 +156,44 @@ func TestUpdater_UpdateIndex_ShouldSkipCorruptedDeletionMarks(t *testing.T) {
 	assert.Empty(t, partials)
 }
 
+func TestUpdater_UpdateIndex_ShouldIncludeOnlyPendingTombstones(t *testing.T) {
+	const userID = "user-1"
+
+	bkt, _ := testutil.PrepareFilesystemBucket(t)
+
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	bkt = block.BucketWithGlobalMarkers(bkt)
+	block1 := block.MockStorageBlockWithExtLabels(t, bkt, userID, 10, 20, nil)
+
+	pending, err := NewTombstone([]string{`up{job="pending"}`}, 10, 20, time.Now())
+	require.NoError(t, err)
+	processed, err := NewTombstone([]string{`up{job="processed"}`}, 10, 20, time.Now())
+	require.NoError(t, err)
+	processed.State = TombstoneProcessed
+
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, pending))
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, processed))
+
+	w := NewUpdater(bkt, userID, nil, logger)
+	idx, partials, err := w.UpdateIndex(ctx, nil)
+	require.NoError(t, err)
+	assertBucketIndexEqual(t, idx, bkt, userID,
+		[]block.Meta{block1},
+		[]*block.DeletionMark{})
+	assert.Empty(t, partials)
+	assert.Equal(t, Tombstones{pending}, idx.Tombstones)
+
+	// Once the pending tombstone is processed, it should be removed from the index.
+	pending.State = TombstoneProcessed
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, pending))
+
+	idx, _, err = w.UpdateIndex(ctx, idx)
+	require.NoError(t, err)
+	assert.Empty(t, idx.Tombstones)
+}
+
 func TestUpdater_UpdateIndex_NoTenantInTheBucket(t *testing.T) {
 	const userID = "user-1"
 
@@ -228,6 +266,91 @@ func TestUpdater_UpdateIndexFromVersion1ToVersion2(t *testing.T) {
 		[]*block.DeletionMark{})
 }
 
+func TestUpdater_UpdateIndex_ShouldDiscoverBlocksInColdStorage(t *testing.T) {
+	const userID = "user-1"
+
+	bkt, _ := testutil.PrepareFilesystemBucket(t)
+	coldBkt, _ := testutil.PrepareFilesystemBucket(t)
+
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	bkt = block.BucketWithGlobalMarkers(bkt)
+	block1 := block.MockStorageBlockWithExtLabels(t, bkt, userID, 10, 20, nil)
+	block2 := block.MockStorageBlockWithExtLabels(t, bkt, userID, 20, 30, nil)
+	block3 := block.MockStorageBlockWithExtLabels(t, bkt, userID, 30, 40, nil)
+	block4 := block.MockStorageBlockWithExtLabels(t, bkt, userID, 40, 50, nil)
+
+	// Block 2 and 3 have been moved to the cold storage, but only the copy of block 3
+	// has been deleted from the blocks storage bucket. The copy of block 4 is incomplete.
+	copyTestBlock(t, bkt, coldBkt, userID, block2.ULID, true)
+	copyTestBlock(t, bkt, coldBkt, userID, block3.ULID, true)
+	require.NoError(t, block.Delete(ctx, logger, bucket.NewUserBucketClient(userID, bkt, nil), block3.ULID))
+	copyTestBlock(t, bkt, coldBkt, userID, block4.ULID, false)
+
+	w := NewTieredUpdater(bkt, coldBkt, userID, nil, logger)
+	idx, partials, err := w.UpdateIndex(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, partials)
+	assert.Equal(t, []ulid.ULID{block2.ULID}, w.HotCopies())
+
+	expectedTiers := map[ulid.ULID]block.StorageTier{
+		block1.ULID: block.HotStorageTier,
+		block2.ULID: block.ColdStorageTier,
+		block3.ULID: block.ColdStorageTier,
+		block4.ULID: block.HotStorageTier,
+	}
+	assertBlockStorageTiers := func(idx *Index) {
+		require.Len(t, idx.Blocks, len(expectedTiers))
+		for _, b := range idx.Blocks {
+			assert.Equal(t, expectedTiers[b.ID], b.StorageTier, b.ID.String())
+			assert.Equal(t, expectedTiers[b.ID], b.ThanosMeta().StorageTier, b.ID.String())
+
+			tierBkt := bkt
+			if b.StorageTier == block.ColdStorageTier {
+				tierBkt = coldBkt
+			}
+			assert.Equal(t, getBlockUploadedAt(t, tierBkt, userID, b.ID), b.UploadedAt, b.ID.String())
+		}
+	}
+	assertBlockStorageTiers(idx)
+
+	// Complete the move of block 4, and delete the copy of block 2.
+	copyTestBlock(t, bkt, coldBkt, userID, block4.ULID, true)
+	require.NoError(t, block.Delete(ctx, logger, bucket.NewUserBucketClient(userID, bkt, nil), block2.ULID))
+	expectedTiers[block4.ULID] = block.ColdStorageTier
+
+	idx, partials, err = w.UpdateIndex(ctx, idx)
+	require.NoError(t, err)
+	assert.Empty(t, partials)
+	assert.Equal(t, []ulid.ULID{block4.ULID}, w.HotCopies())
+	assertBlockStorageTiers(idx)
+
+	// The blocks in the cold storage are not found if the cold storage is disabled.
+	idx, _, err = NewUpdater(bkt, userID, nil, logger).UpdateIndex(ctx, idx)
+	require.NoError(t, err)
+	require.Len(t, idx.Blocks, 2)
+	for _, b := range idx.Blocks {
+		assert.Equal(t, block.HotStorageTier, b.StorageTier)
+	}
+}
+
+// copyTestBlock copies the block files from the src to the dst bucket. The meta.json is copied only if withMeta is true.
+func copyTestBlock(t *testing.T, src, dst objstore.Bucket, userID string, id ulid.ULID, withMeta bool) {
+	ctx := context.Background()
+	err := src.Iter(ctx, path.Join(userID, id.String()), func(name string) error {
+		if path.Base(name) == block.MetaFilename && !withMeta {
+			return nil
+		}
+
+		r, err := src.Get(ctx, name)
+		require.NoError(t, err)
+		defer r.Close()
+		return dst.Upload(ctx, name, r)
+	}, objstore.WithRecursiveIter)
+	require.NoError(t, err)
+}
+
 func getBlockUploadedAt(t testing.TB, bkt objstore.Bucket, userID string, blockID ulid.ULID) int64 {
 	metaFile := path.Join(userID, blockID.String(), block.MetaFilename)
 
@@ -250,6 +373,7 @@ func assertBucketIndexEqual(t testing.TB, idx *Index, bkt objstore.Bucket, userI
 			MaxTime:          b.MaxTime,
 			UploadedAt:       getBlockUploadedAt(t, bkt, userID, b.ULID),
 			CompactorShardID: b.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel],
+			CompactionLevel:  b.Compaction.Level,
 		})
 	}
 
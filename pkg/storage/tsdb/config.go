@@ -114,9 +114,12 @@ var (
 	errInvalidWALReplayConcurrency                  = errors.New("invalid TSDB WAL replay concurrency")
 	errInvalidStripeSize                            = errors.New("invalid TSDB stripe size")
 	errInvalidStreamingBatchSize                    = errors.New("invalid store-gateway streaming batch size")
+	errInvalidSeriesMemoryBudgetQueueTimeout        = errors.New("invalid store-gateway series memory budget queue timeout; must be greater than or equal to 0")
 	errInvalidEarlyHeadCompactionMinSeriesReduction = errors.New("early compaction minimum series reduction percentage must be a value between 0 and 100 (included)")
 	errEarlyCompactionRequiresActiveSeries          = fmt.Errorf("early compaction requires -%s to be enabled", activeseries.EnabledFlag)
 	errEmptyBlockranges                             = errors.New("empty block ranges for TSDB")
+	errColdStorageRequiresBucketIndex               = errors.New("the cold storage requires the bucket index to be enabled")
+	errInvalidMetadataStoreUploadInterval           = errors.New("invalid metric metadata store upload interval; must be greater than 0")
 )
 
 // BlocksStorageConfig holds the config information for the blocks storage.
@@ -124,6 +127,59 @@ type BlocksStorageConfig struct {
 	Bucket      bucket.Config     `yaml:",inline"`
 	BucketStore BucketStoreConfig `yaml:"bucket_store" doc:"description=This configures how the querier and store-gateway discover and synchronize blocks stored in the bucket."`
 	TSDB        TSDBConfig        `yaml:"tsdb"`
+	ColdStorage ColdStorageConfig `yaml:"cold_storage" doc:"description=This configures the cold storage bucket, where the compactor moves the old blocks to. The compactor moves the blocks once all their samples are older than the period configured with -compactor.blocks-cold-storage-period."`
+
+	MetadataStore MetadataStoreConfig `yaml:"metadata_store" doc:"description=This configures the metric metadata store, where ingesters persist the metric metadata of each tenant in the blocks storage bucket."`
+}
+
+// MetadataStoreConfig holds the config of the metric metadata store.
+type MetadataStoreConfig struct {
+	Enabled        bool          `yaml:"enabled" category:"experimental"`
+	UploadInterval time.Duration `yaml:"upload_interval" category:"experimental"`
+	CacheTTL       time.Duration `yaml:"cache_ttl" category:"experimental"`
+}
+
+// RegisterFlagsWithPrefix registers the metric metadata store flags.
+func (cfg *MetadataStoreConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, prefix+"enabled", false, "If enabled, ingesters periodically upload the metric metadata of each tenant to the bucket, the compactor compacts it and removes the metadata not received within the tenant's blocks retention period, and queriers return the metric metadata stored in the bucket together with the metric metadata held by ingesters.")
+	f.DurationVar(&cfg.UploadInterval, prefix+"upload-interval", 5*time.Minute, "How frequently ingesters upload the metric metadata of each tenant to the bucket. It should be lower than -ingester.metadata-retain-period, otherwise the metadata received only once between two uploads may never be uploaded.")
+	f.DurationVar(&cfg.CacheTTL, prefix+"cache-ttl", time.Minute, "How long queriers cache the metric metadata of a tenant read from the bucket.")
+}
+
+// Validate the config.
+func (cfg *MetadataStoreConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.UploadInterval <= 0 {
+		return errInvalidMetadataStoreUploadInterval
+	}
+	return nil
+}
+
+// ColdStorageConfig holds the config of the cold storage bucket, where the compactor moves the old blocks to.
+type ColdStorageConfig struct {
+	Enabled                        bool          `yaml:"enabled" category:"experimental"`
+	Bucket                         bucket.Config `yaml:",inline"`
+	IndexHeaderEagerLoadingEnabled bool          `yaml:"index_header_eager_loading_enabled" category:"experimental"`
+}
+
+// RegisterFlagsWithPrefix registers the cold storage flags.
+func (cfg *ColdStorageConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, prefix+"enabled", false, "If enabled, the compactor moves the old blocks to the cold storage bucket, and the store-gateways read the blocks from the storage tier they're stored in. Requires the bucket index to be enabled.")
+	cfg.Bucket.RegisterFlagsWithPrefixAndDefaultDirectory(prefix, "cold-blocks", f)
+	f.BoolVar(&cfg.IndexHeaderEagerLoadingEnabled, prefix+"index-header-eager-loading-enabled", true, "If disabled, the store-gateways don't eagerly load the index-headers of the blocks in the cold storage at startup, even if -blocks-storage.bucket-store.index-header.eager-loading-startup-enabled is enabled.")
+}
+
+// Validate the config.
+func (cfg *ColdStorageConfig) Validate(bucketIndexCfg BucketIndexConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if !bucketIndexCfg.DeprecatedEnabled {
+		return errColdStorageRequiresBucketIndex
+	}
+	return cfg.Bucket.Validate()
 }
 
 // DurationList is the block ranges for a tsdb
@@ -168,6 +224,8 @@ func (cfg *BlocksStorageConfig) RegisterFlags(f *flag.FlagSet) {
 	cfg.Bucket.RegisterFlagsWithPrefixAndDefaultDirectory("blocks-storage.", "blocks", f)
 	cfg.BucketStore.RegisterFlags(f)
 	cfg.TSDB.RegisterFlags(f)
+	cfg.ColdStorage.RegisterFlagsWithPrefix("blocks-storage.cold-storage.", f)
+	cfg.MetadataStore.RegisterFlagsWithPrefix("blocks-storage.metadata-store.", f)
 }
 
 // Validate the config.
@@ -180,6 +238,14 @@ func (cfg *BlocksStorageConfig) Validate(activeSeriesCfg activeseries.Config, lo
 		return err
 	}
 
+	if err := cfg.ColdStorage.Validate(cfg.BucketStore.BucketIndex); err != nil {
+		return err
+	}
+
+	if err := cfg.MetadataStore.Validate(); err != nil {
+		return err
+	}
+
 	return cfg.BucketStore.Validate(logger)
 }
 
@@ -396,6 +462,10 @@ type BucketStoreConfig struct {
 	SelectionStrategies         struct {
 		WorstCaseSeriesPreference float64 `yaml:"worst_case_series_preference" category:"experimental"`
 	} `yaml:"series_selection_strategies"`
+
+	// Controls the admission control of the Series() requests based on their estimated memory.
+	SeriesMemoryBudgetBytes        uint64        `yaml:"series_memory_budget_bytes" category:"experimental"`
+	SeriesMemoryBudgetQueueTimeout time.Duration `yaml:"series_memory_budget_queue_timeout" category:"experimental"`
 }
 
 const (
@@ -440,6 +510,8 @@ func (cfg *BucketStoreConfig) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.StreamingBatchSize, "blocks-storage.bucket-store.batch-series-size", 5000, "This option controls how many series to fetch per batch. The batch size must be greater than 0.")
 	f.StringVar(&cfg.SeriesSelectionStrategyName, seriesSelectionStrategyFlag, WorstCasePostingsStrategy, "This option controls the strategy to selection of series and deferring application of matchers. A more aggressive strategy will fetch less posting lists at the cost of more series. This is useful when querying large blocks in which many series share the same label name and value. Supported values (most aggressive to least aggressive): "+strings.Join(validSeriesSelectionStrategies, ", ")+".")
 	f.Float64Var(&cfg.SelectionStrategies.WorstCaseSeriesPreference, "blocks-storage.bucket-store.series-selection-strategies.worst-case-series-preference", 0.75, "This option is only used when "+seriesSelectionStrategyFlag+"="+WorstCasePostingsStrategy+". Increasing the series preference results in fetching more series than postings. Must be a positive floating point number.")
+	f.Uint64Var(&cfg.SeriesMemoryBudgetBytes, "blocks-storage.bucket-store.series-memory-budget-bytes", 0, "Max estimated memory - in bytes - that the in-flight Series() requests can use. Each request reserves its memory, estimated from the size of the posting lists and the chunks it selects, before fetching them. The budget is shared across all tenants. 0 to disable the limit.")
+	f.DurationVar(&cfg.SeriesMemoryBudgetQueueTimeout, "blocks-storage.bucket-store.series-memory-budget-queue-timeout", 5*time.Second, "How long a Series() request waits for the series memory budget to be available before being rejected with a retryable error. 0 to reject the request without waiting.")
 }
 
 // Validate the config.
@@ -447,6 +519,9 @@ func (cfg *BucketStoreConfig) Validate(logger log.Logger) error {
 	if cfg.StreamingBatchSize <= 0 {
 		return errInvalidStreamingBatchSize
 	}
+	if cfg.SeriesMemoryBudgetQueueTimeout < 0 {
+		return errInvalidSeriesMemoryBudgetQueueTimeout
+	}
 	if err := cfg.IndexCache.Validate(); err != nil {
 		return errors.Wrap(err, "index-cache configuration")
 	}
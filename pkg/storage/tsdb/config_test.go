@@ -43,6 +43,34 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expectedErr: bucket.ErrUnsupportedStorageBackend,
 		},
+		"should fail on cold storage enabled without the bucket index": {
+			setup: func(cfg *BlocksStorageConfig, activeSeriesCfg *activeseries.Config) {
+				cfg.ColdStorage.Enabled = true
+				cfg.BucketStore.BucketIndex.DeprecatedEnabled = false
+			},
+			expectedErr: errColdStorageRequiresBucketIndex,
+		},
+		"should fail on cold storage enabled with unknown storage backend": {
+			setup: func(cfg *BlocksStorageConfig, activeSeriesCfg *activeseries.Config) {
+				cfg.ColdStorage.Enabled = true
+				cfg.ColdStorage.Bucket.Backend = "unknown"
+			},
+			expectedErr: bucket.ErrUnsupportedStorageBackend,
+		},
+		"should fail on metric metadata store enabled with invalid upload interval": {
+			setup: func(cfg *BlocksStorageConfig, activeSeriesCfg *activeseries.Config) {
+				cfg.MetadataStore.Enabled = true
+				cfg.MetadataStore.UploadInterval = 0
+			},
+			expectedErr: errInvalidMetadataStoreUploadInterval,
+		},
+		"should pass on invalid metric metadata store upload interval but the store is disabled": {
+			setup: func(cfg *BlocksStorageConfig, activeSeriesCfg *activeseries.Config) {
+				cfg.MetadataStore.Enabled = false
+				cfg.MetadataStore.UploadInterval = 0
+			},
+			expectedErr: nil,
+		},
 		"should fail on invalid ship concurrency": {
 			setup: func(cfg *BlocksStorageConfig, activeSeriesCfg *activeseries.Config) {
 				cfg.TSDB.ShipConcurrency = 0
@@ -122,6 +150,12 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expectedErr: errInvalidStreamingBatchSize,
 		},
+		"should fail on negative store-gateway series memory budget queue timeout": {
+			setup: func(cfg *BlocksStorageConfig, activeSeriesCfg *activeseries.Config) {
+				cfg.BucketStore.SeriesMemoryBudgetQueueTimeout = -time.Second
+			},
+			expectedErr: errInvalidSeriesMemoryBudgetQueueTimeout,
+		},
 		"should fail if forced compaction is enabled but active series tracker is not": {
 			setup: func(cfg *BlocksStorageConfig, activeSeriesCfg *activeseries.Config) {
 				cfg.TSDB.EarlyHeadCompactionMinInMemorySeries = 1_000_000
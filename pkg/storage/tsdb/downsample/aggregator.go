@@ -0,0 +1,238 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package downsample
+
+import (
+	"math"
+
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+)
+
+// samplesPerChunk is the maximum number of samples in a downsampled chunk.
+const samplesPerChunk = 120
+
+// aggregator computes the aggregates of the samples of a series, appended in timestamp order,
+// over consecutive windows of the resolution. Each window is downsampled to one sample per aggregate,
+// with the timestamp of the last sample of the window.
+//
+// A window only aggregates the samples of the same type (float or histogram) as its first sample.
+// Histogram samples have no AggrMin and AggrMax aggregate.
+type aggregator struct {
+	resolution int64
+
+	// Downsampled chunks, by aggregate.
+	out map[string]*chunksBuilder
+
+	// Current window.
+	windowEnd   int64
+	windowType  chunkenc.ValueType
+	lastT       int64
+	count       int
+	min, max    float64
+	sum         float64
+	histSum     *histogram.FloatHistogram
+	counter     float64
+	histCounter *histogram.FloatHistogram
+
+	// The counter aggregate is adjusted by the counter resets found across the whole series,
+	// so that it's monotonic.
+	prevCounter       float64
+	prevCounterSet    bool
+	counterOffset     float64
+	prevHistCounter   *histogram.FloatHistogram
+	histCounterOffset *histogram.FloatHistogram
+}
+
+func newAggregator(resolution int64) *aggregator {
+	a := &aggregator{resolution: resolution, out: map[string]*chunksBuilder{}}
+	for _, aggr := range Aggregates {
+		a.out[aggr] = &chunksBuilder{}
+	}
+	return a
+}
+
+// reset prepares the aggregator to downsample a new series.
+func (a *aggregator) reset() {
+	for _, o := range a.out {
+		o.reset()
+	}
+	a.windowType = chunkenc.ValNone
+	a.prevCounterSet = false
+	a.counterOffset = 0
+	a.prevHistCounter = nil
+	a.histCounterOffset = nil
+}
+
+// startWindow flushes the current window if t is outside it, and starts a new window for t.
+// Returns false if the sample should be skipped because its type differs from the window's one.
+func (a *aggregator) startWindow(t int64, typ chunkenc.ValueType) bool {
+	if a.windowType != chunkenc.ValNone && t < a.windowEnd {
+		return a.windowType == typ
+	}
+
+	a.flush()
+	a.windowEnd = windowStart(t, a.resolution) + a.resolution
+	a.windowType = typ
+	a.count = 0
+	a.min = math.Inf(1)
+	a.max = math.Inf(-1)
+	a.sum = 0
+	a.histSum = nil
+	return true
+}
+
+func (a *aggregator) addFloat(t int64, v float64) {
+	if value.IsStaleNaN(v) || !a.startWindow(t, chunkenc.ValFloat) {
+		return
+	}
+
+	a.lastT = t
+	a.count++
+	a.sum += v
+	a.min = math.Min(a.min, v)
+	a.max = math.Max(a.max, v)
+
+	if a.prevCounterSet && v < a.prevCounter {
+		a.counterOffset += a.prevCounter
+	}
+	a.prevCounter = v
+	a.prevCounterSet = true
+	a.counter = v + a.counterOffset
+}
+
+func (a *aggregator) addHistogram(t int64, h *histogram.FloatHistogram) {
+	if value.IsStaleNaN(h.Sum) || !a.startWindow(t, chunkenc.ValFloatHistogram) {
+		return
+	}
+
+	a.lastT = t
+	a.count++
+	a.histSum = addHistograms(a.histSum, h)
+
+	if a.prevHistCounter != nil && h.DetectReset(a.prevHistCounter) {
+		a.histCounterOffset = addHistograms(a.histCounterOffset, a.prevHistCounter)
+	}
+	a.prevHistCounter = h
+	a.histCounter = addHistograms(a.histCounterOffset, h)
+	a.histCounter.CounterResetHint = histogram.UnknownCounterReset
+}
+
+// flush appends the aggregates of the current window to the downsampled chunks.
+func (a *aggregator) flush() {
+	if a.windowType == chunkenc.ValNone || a.count == 0 {
+		return
+	}
+
+	t := a.lastT
+	count := float64(a.count)
+
+	switch a.windowType {
+	case chunkenc.ValFloat:
+		a.out[AggrMin].appendFloat(t, a.min)
+		a.out[AggrMax].appendFloat(t, a.max)
+		a.out[AggrSum].appendFloat(t, a.sum)
+		a.out[AggrCount].appendFloat(t, count)
+		a.out[AggrCounter].appendFloat(t, a.counter)
+		a.out[AggrAvg].appendFloat(t, a.sum/count)
+
+	case chunkenc.ValFloatHistogram:
+		sum := a.histSum
+		sum.CounterResetHint = histogram.GaugeType
+		avg := sum.Copy().Div(count)
+
+		a.out[AggrSum].appendHistogram(t, sum)
+		a.out[AggrCount].appendFloat(t, count)
+		a.out[AggrCounter].appendHistogram(t, a.histCounter)
+		a.out[AggrAvg].appendHistogram(t, avg)
+	}
+
+	a.windowType = chunkenc.ValNone
+	a.count = 0
+}
+
+// windowStart returns the start of the resolution window containing t.
+func windowStart(t, resolution int64) int64 {
+	start := t - t%resolution
+	if t < 0 && t%resolution != 0 {
+		start -= resolution
+	}
+	return start
+}
+
+// addHistograms returns a new histogram with the sum of the input histograms. The input a can be nil.
+func addHistograms(a, b *histogram.FloatHistogram) *histogram.FloatHistogram {
+	if a == nil {
+		return b.Copy()
+	}
+	// FloatHistogram.Add requires the added histogram to have an equal or higher resolution.
+	if b.Schema < a.Schema {
+		return b.Copy().Add(a)
+	}
+	return a.Copy().Add(b)
+}
+
+// chunksBuilder encodes the samples of a series into chunks.
+type chunksBuilder struct {
+	chunks []chunks.Meta
+
+	cur chunks.Meta
+	app chunkenc.Appender
+}
+
+func (b *chunksBuilder) reset() {
+	b.chunks = b.chunks[:0]
+	b.cur = chunks.Meta{}
+	b.app = nil
+}
+
+func (b *chunksBuilder) cut(t int64, c chunkenc.Chunk) {
+	if b.cur.Chunk != nil {
+		b.chunks = append(b.chunks, b.cur)
+	}
+	b.cur = chunks.Meta{Chunk: c, MinTime: t, MaxTime: t}
+}
+
+func (b *chunksBuilder) appendFloat(t int64, v float64) {
+	if b.cur.Chunk == nil || b.cur.Chunk.Encoding() != chunkenc.EncXOR || b.cur.Chunk.NumSamples() >= samplesPerChunk {
+		c := chunkenc.NewXORChunk()
+		b.app, _ = c.Appender()
+		b.cut(t, c)
+	}
+
+	b.app.Append(t, v)
+	b.cur.MaxTime = t
+}
+
+func (b *chunksBuilder) appendHistogram(t int64, h *histogram.FloatHistogram) {
+	if b.cur.Chunk == nil || b.cur.Chunk.Encoding() != chunkenc.EncFloatHistogram || b.cur.Chunk.NumSamples() >= samplesPerChunk {
+		c := chunkenc.NewFloatHistogramChunk()
+		b.app, _ = c.Appender()
+		b.cut(t, c)
+	}
+
+	// The appender creates a new chunk if the histogram can't be appended to the current one,
+	// for example because of a counter reset, or recodes the current chunk to accommodate new buckets.
+	// No error is returned when appendOnly is false.
+	c, recoded, app, _ := b.app.AppendFloatHistogram(nil, t, h, false)
+	b.app = app
+	if c != nil {
+		if recoded {
+			b.cur.Chunk = c
+		} else {
+			b.cut(t, c)
+		}
+	}
+	b.cur.MaxTime = t
+}
+
+// finish returns the chunks of the series.
+func (b *chunksBuilder) finish() []chunks.Meta {
+	if b.cur.Chunk != nil {
+		b.chunks = append(b.chunks, b.cur)
+		b.cur = chunks.Meta{}
+	}
+	return b.chunks
+}
@@ -0,0 +1,348 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package downsample
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/runutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+)
+
+// Resolutions of the blocks, in milliseconds.
+const (
+	ResLevel0 = int64(0)                                  // Raw data.
+	ResLevel1 = int64(5 * time.Minute / time.Millisecond) // 5 minutes resolution.
+	ResLevel2 = int64(time.Hour / time.Millisecond)       // 1 hour resolution.
+)
+
+// Aggregates computed for each resolution window of a downsampled series.
+const (
+	AggrMin     = "min"
+	AggrMax     = "max"
+	AggrSum     = "sum"
+	AggrCount   = "count"
+	AggrCounter = "counter"
+	AggrAvg     = "avg"
+)
+
+// Aggregates is the list of aggregates a raw block is downsampled to, one block per aggregate.
+// The blocks are written and uploaded in this order: since AggrAvg is computed for every series,
+// a raw block has been completely downsampled once its AggrAvg block exists.
+var Aggregates = []string{AggrMin, AggrMax, AggrSum, AggrCount, AggrCounter, AggrAvg}
+
+// minSamplesPerWindow is the minimum number of downsampled samples in each query step and range vector
+// selector window required to query a resolution.
+const minSamplesPerWindow = 5
+
+// ResolutionString returns the human readable representation of the input resolution.
+func ResolutionString(resolution int64) string {
+	if resolution == ResLevel0 {
+		return "raw"
+	}
+	return model.Duration(time.Duration(resolution) * time.Millisecond).String()
+}
+
+// AggregateForFunc returns the aggregate to read to evaluate the input PromQL function or aggregation
+// on downsampled data, and whether the function can be evaluated on downsampled data at all. Only the
+// functions whose result can be computed from one of the aggregates are supported: any other function,
+// for example the ones depending on the raw samples (count_over_time, changes, resets, last_over_time,
+// present_over_time) or on their distribution (stddev_over_time, quantile_over_time), is evaluated on raw data.
+func AggregateForFunc(fn string) (aggregate string, ok bool) {
+	switch fn {
+	case "", "sum", "avg", "avg_over_time":
+		// Plain selectors and the aggregations across series read the average value of each resolution window.
+		return AggrAvg, true
+	case "min", "min_over_time":
+		return AggrMin, true
+	case "max", "max_over_time":
+		return AggrMax, true
+	case "sum_over_time":
+		return AggrSum, true
+	case "count":
+		// Only the number of series matters, not their values.
+		return AggrCount, true
+	case "rate", "increase", "irate":
+		return AggrCounter, true
+	default:
+		return "", false
+	}
+}
+
+// MaxResolution returns the coarsest resolution which can be read to evaluate the input select hints:
+// each query step and range vector selector window must contain at least minSamplesPerWindow downsampled
+// samples, while instant vector selectors must find a downsampled sample within the lookback delta.
+// Returns ResLevel0 if only raw data can be read.
+func MaxResolution(hints *storage.SelectHints, lookbackDelta time.Duration) int64 {
+	if hints == nil || hints.Step <= 0 {
+		return ResLevel0
+	}
+	if _, ok := AggregateForFunc(hints.Func); !ok {
+		return ResLevel0
+	}
+
+	for _, res := range []int64{ResLevel2, ResLevel1} {
+		if hints.Step < res*minSamplesPerWindow {
+			continue
+		}
+		if hints.Range > 0 && hints.Range < res*minSamplesPerWindow {
+			continue
+		}
+		if hints.Range == 0 && lookbackDelta.Milliseconds() < res {
+			continue
+		}
+		return res
+	}
+	return ResLevel0
+}
+
+// Downsample writes to outDir the blocks downsampling the raw block stored in blockDir to the input resolution,
+// one block per aggregate. The time range, compaction and external labels of the raw block are preserved, and
+// the raw block is the only parent of the downsampled blocks, so that they replace the raw block at query time. Returns the IDs of the written blocks,
+// in the order of Aggregates. No block is written for an aggregate without samples.
+func Downsample(ctx context.Context, logger log.Logger, meta *block.Meta, blockDir, outDir string, resolution int64) (_ []ulid.ULID, returnErr error) {
+	if meta.Thanos.Downsample.Resolution != ResLevel0 {
+		return nil, errors.Errorf("block %s is already downsampled", meta.ULID)
+	}
+	if resolution <= ResLevel0 {
+		return nil, errors.Errorf("invalid resolution %d", resolution)
+	}
+
+	b, err := tsdb.OpenBlock(logger, blockDir, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "open block")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, b, "close block")
+
+	indexr, err := b.Index()
+	if err != nil {
+		return nil, errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, indexr, "close index reader")
+
+	chunkr, err := b.Chunks()
+	if err != nil {
+		return nil, errors.Wrap(err, "open chunks")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, chunkr, "close chunk reader")
+
+	writers := make([]*blockWriter, 0, len(Aggregates))
+	defer func() {
+		for _, w := range writers {
+			w.closeOnError(logger)
+		}
+	}()
+
+	for _, aggr := range Aggregates {
+		w, err := newBlockWriter(ctx, outDir, aggr)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+
+	// The symbols of the raw block are a superset of the downsampled blocks ones.
+	symbols := indexr.Symbols()
+	for symbols.Next() {
+		for _, w := range writers {
+			if err := w.index.AddSymbol(symbols.At()); err != nil {
+				return nil, errors.Wrap(err, "add symbol")
+			}
+		}
+	}
+	if err := symbols.Err(); err != nil {
+		return nil, errors.Wrap(err, "iterate symbols")
+	}
+
+	postings, err := indexr.Postings(index.AllPostingsKey())
+	if err != nil {
+		return nil, errors.Wrap(err, "read postings")
+	}
+
+	var (
+		builder labels.ScratchBuilder
+		chks    []chunks.Meta
+		it      chunkenc.Iterator
+		aggr    = newAggregator(resolution)
+	)
+
+	for postings.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if err := indexr.Series(postings.At(), &builder, &chks); err != nil {
+			return nil, errors.Wrap(err, "read series")
+		}
+
+		aggr.reset()
+		for _, chk := range chks {
+			c, err := chunkr.Chunk(chk)
+			if err != nil {
+				return nil, errors.Wrapf(err, "read chunk %d", chk.Ref)
+			}
+
+			it = c.Iterator(it)
+			for vt := it.Next(); vt != chunkenc.ValNone; vt = it.Next() {
+				switch vt {
+				case chunkenc.ValFloat:
+					aggr.addFloat(it.At())
+				case chunkenc.ValHistogram, chunkenc.ValFloatHistogram:
+					t, h := it.AtFloatHistogram()
+					// The histogram returned by the iterator shares its buckets with the chunk.
+					aggr.addHistogram(t, h.Copy())
+				}
+			}
+			if err := it.Err(); err != nil {
+				return nil, errors.Wrapf(err, "iterate chunk %d", chk.Ref)
+			}
+		}
+		aggr.flush()
+
+		lset := builder.Labels()
+		for _, w := range writers {
+			if err := w.addSeries(lset, aggr.out[w.aggregate].finish()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := postings.Err(); err != nil {
+		return nil, errors.Wrap(err, "iterate postings")
+	}
+
+	var ids []ulid.ULID
+	for _, w := range writers {
+		id, err := w.finish(logger, meta, resolution)
+		if err != nil {
+			return nil, err
+		}
+		if id != (ulid.ULID{}) {
+			ids = append(ids, id)
+		}
+	}
+	writers = nil
+
+	return ids, nil
+}
+
+// blockWriter writes the downsampled series of an aggregate to a new block, in the order they're added.
+type blockWriter struct {
+	aggregate string
+	id        ulid.ULID
+	dir       string
+
+	chunks *chunks.Writer
+	index  *index.Writer
+	closed bool
+
+	nextRef storage.SeriesRef
+	stats   tsdb.BlockStats
+}
+
+func newBlockWriter(ctx context.Context, outDir, aggregate string) (*blockWriter, error) {
+	id := ulid.MustNew(ulid.Now(), rand.Reader)
+	dir := filepath.Join(outDir, id.String())
+
+	chunkw, err := chunks.NewWriter(filepath.Join(dir, block.ChunksDirname))
+	if err != nil {
+		return nil, errors.Wrap(err, "create chunks writer")
+	}
+
+	indexw, err := index.NewWriter(ctx, filepath.Join(dir, block.IndexFilename))
+	if err != nil {
+		_ = chunkw.Close()
+		return nil, errors.Wrap(err, "create index writer")
+	}
+
+	return &blockWriter{aggregate: aggregate, id: id, dir: dir, chunks: chunkw, index: indexw}, nil
+}
+
+func (w *blockWriter) addSeries(lset labels.Labels, chks []chunks.Meta) error {
+	if len(chks) == 0 {
+		return nil
+	}
+
+	if err := w.chunks.WriteChunks(chks...); err != nil {
+		return errors.Wrap(err, "write chunks")
+	}
+	if err := w.index.AddSeries(w.nextRef, lset, chks...); err != nil {
+		return errors.Wrap(err, "add series")
+	}
+	w.nextRef++
+
+	w.stats.NumSeries++
+	w.stats.NumChunks += uint64(len(chks))
+	for _, c := range chks {
+		w.stats.NumSamples += uint64(c.Chunk.NumSamples())
+	}
+	return nil
+}
+
+// finish closes the block and writes its meta.json. The block is removed if it has no series,
+// in which case a zero ULID is returned.
+func (w *blockWriter) finish(logger log.Logger, raw *block.Meta, resolution int64) (ulid.ULID, error) {
+	w.closed = true
+	if err := w.chunks.Close(); err != nil {
+		_ = w.index.Close()
+		return ulid.ULID{}, errors.Wrap(err, "close chunks writer")
+	}
+	if err := w.index.Close(); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "close index writer")
+	}
+
+	if w.stats.NumSeries == 0 {
+		return ulid.ULID{}, errors.Wrap(os.RemoveAll(w.dir), "remove empty block")
+	}
+
+	compaction := raw.Compaction
+	compaction.Parents = []tsdb.BlockDesc{{ULID: raw.ULID, MinTime: raw.MinTime, MaxTime: raw.MaxTime}}
+
+	meta := block.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:       w.id,
+			MinTime:    raw.MinTime,
+			MaxTime:    raw.MaxTime,
+			Stats:      w.stats,
+			Compaction: compaction,
+			Version:    block.TSDBVersion1,
+		},
+		Thanos: block.ThanosMeta{
+			Version:      block.ThanosVersion1,
+			Labels:       raw.Thanos.Labels,
+			Downsample:   block.ThanosDownsample{Resolution: resolution, Aggregate: w.aggregate},
+			Source:       block.CompactorDownsampleSource,
+			SegmentFiles: block.GetSegmentFiles(w.dir),
+		},
+	}
+	if err := meta.WriteToDir(logger, w.dir); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write meta")
+	}
+
+	if err := block.VerifyBlock(logger, w.dir, meta.MinTime, meta.MaxTime, false); err != nil {
+		return ulid.ULID{}, errors.Wrapf(err, "invalid downsampled block %s", w.dir)
+	}
+	return w.id, nil
+}
+
+func (w *blockWriter) closeOnError(logger log.Logger) {
+	if w.closed {
+		return
+	}
+	runutil.CloseWithLogOnErr(logger, w.chunks, "close chunks writer")
+	runutil.CloseWithLogOnErr(logger, w.index, "close index writer")
+}
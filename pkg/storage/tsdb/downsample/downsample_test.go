@@ -0,0 +1,253 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package downsample
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+)
+
+func TestDownsample(t *testing.T) {
+	const minute = int64(time.Minute / time.Millisecond)
+
+	var (
+		ctx        = context.Background()
+		logger     = log.NewNopLogger()
+		counter    = labels.FromStrings(labels.MetricName, "counter_total")
+		histogramS = labels.FromStrings(labels.MetricName, "histogram")
+	)
+
+	// Write a raw block with a float counter, which resets in the second window, and a native histogram.
+	rawDir := t.TempDir()
+	w, err := tsdb.NewBlockWriter(logger, rawDir, 2*time.Hour.Milliseconds())
+	require.NoError(t, err)
+
+	app := w.Appender(ctx)
+	for i := int64(0); i < 10; i++ {
+		_, err := app.Append(0, counter, i*minute, float64(i%5+1))
+		require.NoError(t, err)
+	}
+	// A stale marker is not aggregated.
+	_, err = app.Append(0, counter, 10*minute, math.Float64frombits(value.StaleNaN))
+	require.NoError(t, err)
+
+	for i := int64(0); i < 3; i++ {
+		_, err := app.AppendHistogram(0, histogramS, i*minute, nil, testHistogram(float64(i+1)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+
+	rawID, err := w.Flush(ctx)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	rawMeta, err := block.ReadMetaFromDir(filepath.Join(rawDir, rawID.String()))
+	require.NoError(t, err)
+	rawMeta.Thanos.Labels = map[string]string{"__compactor_shard_id__": "1_of_2"}
+
+	outDir := t.TempDir()
+	ids, err := Downsample(ctx, logger, rawMeta, filepath.Join(rawDir, rawID.String()), outDir, ResLevel1)
+	require.NoError(t, err)
+	require.Len(t, ids, len(Aggregates))
+
+	type expectedSample struct {
+		t int64
+		f float64
+		h *histogram.FloatHistogram
+	}
+
+	expected := map[string]map[string][]expectedSample{
+		AggrMin: {
+			counter.String(): {{t: 4 * minute, f: 1}, {t: 9 * minute, f: 1}},
+		},
+		AggrMax: {
+			counter.String(): {{t: 4 * minute, f: 5}, {t: 9 * minute, f: 5}},
+		},
+		AggrSum: {
+			counter.String():    {{t: 4 * minute, f: 15}, {t: 9 * minute, f: 15}},
+			histogramS.String(): {{t: 2 * minute, h: testHistogram(6)}},
+		},
+		AggrCount: {
+			counter.String():    {{t: 4 * minute, f: 5}, {t: 9 * minute, f: 5}},
+			histogramS.String(): {{t: 2 * minute, f: 3}},
+		},
+		AggrCounter: {
+			// The counter is adjusted by the reset.
+			counter.String():    {{t: 4 * minute, f: 5}, {t: 9 * minute, f: 10}},
+			histogramS.String(): {{t: 2 * minute, h: testHistogram(3)}},
+		},
+		AggrAvg: {
+			counter.String():    {{t: 4 * minute, f: 3}, {t: 9 * minute, f: 3}},
+			histogramS.String(): {{t: 2 * minute, h: testHistogram(2)}},
+		},
+	}
+
+	for i, aggr := range Aggregates {
+		t.Run(aggr, func(t *testing.T) {
+			dir := filepath.Join(outDir, ids[i].String())
+
+			meta, err := block.ReadMetaFromDir(dir)
+			require.NoError(t, err)
+			assert.Equal(t, rawMeta.MinTime, meta.MinTime)
+			assert.Equal(t, rawMeta.MaxTime, meta.MaxTime)
+			assert.Equal(t, rawMeta.Compaction.Sources, meta.Compaction.Sources)
+			assert.Equal(t, []tsdb.BlockDesc{{ULID: rawMeta.ULID, MinTime: rawMeta.MinTime, MaxTime: rawMeta.MaxTime}}, meta.Compaction.Parents)
+			assert.Equal(t, rawMeta.Thanos.Labels, meta.Thanos.Labels)
+			assert.Equal(t, block.ThanosDownsample{Resolution: ResLevel1, Aggregate: aggr}, meta.Thanos.Downsample)
+			assert.Equal(t, block.CompactorDownsampleSource, meta.Thanos.Source)
+
+			b, err := tsdb.OpenBlock(logger, dir, nil)
+			require.NoError(t, err)
+			t.Cleanup(func() { require.NoError(t, b.Close()) })
+
+			q, err := tsdb.NewBlockQuerier(b, meta.MinTime, meta.MaxTime)
+			require.NoError(t, err)
+			t.Cleanup(func() { require.NoError(t, q.Close()) })
+
+			actual := map[string][]expectedSample{}
+			set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+"))
+			var it chunkenc.Iterator
+			for set.Next() {
+				s := set.At()
+				it = s.Iterator(it)
+				for vt := it.Next(); vt != chunkenc.ValNone; vt = it.Next() {
+					switch vt {
+					case chunkenc.ValFloat:
+						ts, f := it.At()
+						actual[s.Labels().String()] = append(actual[s.Labels().String()], expectedSample{t: ts, f: f})
+					case chunkenc.ValFloatHistogram:
+						ts, h := it.AtFloatHistogram()
+						// Only compare the histogram values.
+						actual[s.Labels().String()] = append(actual[s.Labels().String()], expectedSample{t: ts, h: testHistogram(h.Count)})
+					}
+				}
+				require.NoError(t, it.Err())
+			}
+			require.NoError(t, set.Err())
+
+			assert.Equal(t, expected[aggr], actual)
+		})
+	}
+}
+
+func TestDownsample_ShouldFailOnDownsampledBlock(t *testing.T) {
+	meta := &block.Meta{Thanos: block.ThanosMeta{Downsample: block.ThanosDownsample{Resolution: ResLevel1, Aggregate: AggrAvg}}}
+
+	_, err := Downsample(context.Background(), log.NewNopLogger(), meta, t.TempDir(), t.TempDir(), ResLevel2)
+	require.Error(t, err)
+}
+
+func TestMaxResolution(t *testing.T) {
+	const (
+		minute        = int64(time.Minute / time.Millisecond)
+		lookbackDelta = 5 * time.Minute
+	)
+
+	tests := map[string]struct {
+		hints    *storage.SelectHints
+		expected int64
+	}{
+		"no hints": {
+			expected: ResLevel0,
+		},
+		"instant query": {
+			hints:    &storage.SelectHints{Func: "rate", Range: 24 * 60 * minute},
+			expected: ResLevel0,
+		},
+		"range vector selector with a step and range large enough for 1h resolution": {
+			hints:    &storage.SelectHints{Func: "rate", Step: 24 * 60 * minute, Range: 6 * 60 * minute},
+			expected: ResLevel2,
+		},
+		"range vector selector with a range only large enough for 5m resolution": {
+			hints:    &storage.SelectHints{Func: "max_over_time", Step: 24 * 60 * minute, Range: 60 * minute},
+			expected: ResLevel1,
+		},
+		"range vector selector with a range too short for 5m resolution": {
+			hints:    &storage.SelectHints{Func: "rate", Step: 24 * 60 * minute, Range: 5 * minute},
+			expected: ResLevel0,
+		},
+		"step too short for 5m resolution": {
+			hints:    &storage.SelectHints{Func: "rate", Step: 10 * minute, Range: 60 * minute},
+			expected: ResLevel0,
+		},
+		"instant vector selector is limited by the lookback delta": {
+			hints:    &storage.SelectHints{Step: 24 * 60 * minute},
+			expected: ResLevel1,
+		},
+		"function which can't be evaluated on downsampled data": {
+			hints:    &storage.SelectHints{Func: "count_over_time", Step: 24 * 60 * minute, Range: 6 * 60 * minute},
+			expected: ResLevel0,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testData.expected, MaxResolution(testData.hints, lookbackDelta))
+		})
+	}
+}
+
+func TestAggregateForFunc(t *testing.T) {
+	for fn, expected := range map[string]string{
+		"":              AggrAvg,
+		"sum":           AggrAvg,
+		"avg":           AggrAvg,
+		"avg_over_time": AggrAvg,
+		"min":           AggrMin,
+		"min_over_time": AggrMin,
+		"max":           AggrMax,
+		"max_over_time": AggrMax,
+		"sum_over_time": AggrSum,
+		"count":         AggrCount,
+		"rate":          AggrCounter,
+		"increase":      AggrCounter,
+	} {
+		actual, ok := AggregateForFunc(fn)
+		assert.True(t, ok, fn)
+		assert.Equal(t, expected, actual, fn)
+	}
+
+	for _, fn := range []string{"count_over_time", "changes", "resets", "last_over_time", "present_over_time", "stddev_over_time", "stdvar_over_time", "quantile_over_time", "deriv", "delta", "stddev", "quantile", "topk", "absent_over_time", "unknown"} {
+		_, ok := AggregateForFunc(fn)
+		assert.False(t, ok, fn)
+	}
+}
+
+func TestWindowStart(t *testing.T) {
+	assert.Equal(t, int64(0), windowStart(0, ResLevel1))
+	assert.Equal(t, int64(0), windowStart(ResLevel1-1, ResLevel1))
+	assert.Equal(t, ResLevel1, windowStart(ResLevel1, ResLevel1))
+	assert.Equal(t, -ResLevel1, windowStart(-1, ResLevel1))
+}
+
+// testHistogram returns a float histogram with a single bucket whose count is v.
+func testHistogram(v float64) *histogram.FloatHistogram {
+	return &histogram.FloatHistogram{
+		Count:           v,
+		Sum:             v,
+		Schema:          0,
+		PositiveSpans:   []histogram.Span{{Offset: 0, Length: 1}},
+		PositiveBuckets: []float64{v},
+	}
+}
+
+func TestResolutionString(t *testing.T) {
+	assert.Equal(t, "raw", ResolutionString(ResLevel0))
+	assert.Equal(t, "5m", ResolutionString(ResLevel1))
+	assert.Equal(t, "1h", ResolutionString(ResLevel2))
+}
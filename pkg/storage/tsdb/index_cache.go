@@ -8,6 +8,7 @@ package tsdb
 import (
 	"flag"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/alecthomas/units"
@@ -31,6 +32,13 @@ const (
 	// IndexCacheBackendRedis is the value for the Redis index cache backend.
 	IndexCacheBackendRedis = cache.BackendRedis
 
+	// IndexCacheBackendDisk is the value for the disk index cache backend.
+	IndexCacheBackendDisk = "disk"
+
+	// IndexCacheDiskDirName is the name of the directory, within the bucket store sync directory,
+	// where the disk index cache stores its items. The name can't clash with a tenant ID.
+	IndexCacheDiskDirName = "@index-cache"
+
 	// IndexCacheBackendDefault is the value for the default index cache backend.
 	IndexCacheBackendDefault = IndexCacheBackendInMemory
 
@@ -38,14 +46,16 @@ const (
 )
 
 var (
-	supportedIndexCacheBackends = []string{IndexCacheBackendInMemory, IndexCacheBackendMemcached, IndexCacheBackendRedis}
+	supportedIndexCacheBackends = []string{IndexCacheBackendInMemory, IndexCacheBackendMemcached, IndexCacheBackendRedis, IndexCacheBackendDisk}
 
 	errUnsupportedIndexCacheBackend = errors.New("unsupported index cache backend")
+	errInvalidDiskIndexCacheMaxSize = errors.New("the disk index cache max size must be greater than 0")
 )
 
 type IndexCacheConfig struct {
 	cache.BackendConfig `yaml:",inline"`
 	InMemory            InMemoryIndexCacheConfig `yaml:"inmemory"`
+	Disk                DiskIndexCacheConfig     `yaml:"disk"`
 }
 
 func (cfg *IndexCacheConfig) RegisterFlags(f *flag.FlagSet) {
@@ -56,6 +66,7 @@ func (cfg *IndexCacheConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix str
 	f.StringVar(&cfg.Backend, prefix+"backend", IndexCacheBackendDefault, fmt.Sprintf("The index cache backend type. Supported values: %s.", strings.Join(supportedIndexCacheBackends, ", ")))
 
 	cfg.InMemory.RegisterFlagsWithPrefix(prefix+"inmemory.", f)
+	cfg.Disk.RegisterFlagsWithPrefix(prefix+"disk.", f)
 	cfg.Memcached.RegisterFlagsWithPrefix(prefix+"memcached.", f)
 	cfg.Redis.RegisterFlagsWithPrefix(prefix+"redis.", f)
 }
@@ -73,6 +84,12 @@ func (cfg *IndexCacheConfig) Validate() error {
 		}
 	}
 
+	if cfg.Backend == IndexCacheBackendDisk {
+		if err := cfg.Disk.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -84,11 +101,32 @@ func (cfg *InMemoryIndexCacheConfig) RegisterFlagsWithPrefix(prefix string, f *f
 	f.Uint64Var(&cfg.MaxSizeBytes, prefix+"max-size-bytes", uint64(1*units.Gibibyte), "Maximum size in bytes of in-memory index cache used to speed up blocks index lookups (shared between all tenants).")
 }
 
-// NewIndexCache creates a new index cache based on the input configuration.
-func NewIndexCache(cfg IndexCacheConfig, logger log.Logger, registerer prometheus.Registerer) (indexcache.IndexCache, error) {
+type DiskIndexCacheConfig struct {
+	MaxSizeBytes        uint64 `yaml:"max_size_bytes" category:"experimental"`
+	InMemoryTierEnabled bool   `yaml:"inmemory_tier_enabled" category:"experimental"`
+}
+
+func (cfg *DiskIndexCacheConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.Uint64Var(&cfg.MaxSizeBytes, prefix+"max-size-bytes", uint64(10*units.Gibibyte), "Maximum size in bytes of the disk index cache used to speed up blocks index lookups (shared between all tenants). The cache is stored in the bucket store sync directory and preserved across restarts.")
+	f.BoolVar(&cfg.InMemoryTierEnabled, prefix+"inmemory-tier-enabled", false, "If enabled, an in-memory index cache, configured with the in-memory index cache options, is used in front of the disk index cache.")
+}
+
+// Validate the config.
+func (cfg *DiskIndexCacheConfig) Validate() error {
+	if cfg.MaxSizeBytes == 0 {
+		return errInvalidDiskIndexCacheMaxSize
+	}
+	return nil
+}
+
+// NewIndexCache creates a new index cache based on the input configuration. The syncDir is the
+// bucket store sync directory, where the disk index cache is stored.
+func NewIndexCache(cfg IndexCacheConfig, syncDir string, logger log.Logger, registerer prometheus.Registerer) (indexcache.IndexCache, error) {
 	switch cfg.Backend {
 	case IndexCacheBackendInMemory:
 		return newInMemoryIndexCache(cfg.InMemory, logger, registerer)
+	case IndexCacheBackendDisk:
+		return newDiskIndexCache(cfg, filepath.Join(syncDir, IndexCacheDiskDirName), logger, registerer)
 	case IndexCacheBackendMemcached:
 		return newMemcachedIndexCache(cfg.Memcached, logger, registerer)
 	case IndexCacheBackendRedis:
@@ -113,6 +151,34 @@ func newInMemoryIndexCache(cfg InMemoryIndexCacheConfig, logger log.Logger, regi
 	})
 }
 
+func newDiskIndexCache(cfg IndexCacheConfig, dir string, logger log.Logger, registerer prometheus.Registerer) (indexcache.IndexCache, error) {
+	// Calculate the max item size.
+	maxItemSize := uint64(defaultMaxItemSize)
+	if maxItemSize > cfg.Disk.MaxSizeBytes {
+		maxItemSize = cfg.Disk.MaxSizeBytes
+	}
+
+	diskCache, err := indexcache.NewDiskIndexCache(logger, registerer, indexcache.DiskIndexCacheConfig{
+		Dir:         dir,
+		MaxSize:     cfg.Disk.MaxSizeBytes,
+		MaxItemSize: maxItemSize,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "create disk index cache")
+	}
+
+	var c indexcache.IndexCache = diskCache
+	if cfg.Disk.InMemoryTierEnabled {
+		inMemory, err := newInMemoryIndexCache(cfg.InMemory, logger, registerer)
+		if err != nil {
+			return nil, errors.Wrap(err, "create in-memory tier of the disk index cache")
+		}
+		c = indexcache.NewTieredIndexCache(inMemory, c)
+	}
+
+	return indexcache.NewTracingIndexCache(c, logger), nil
+}
+
 func newMemcachedIndexCache(cfg cache.MemcachedClientConfig, logger log.Logger, registerer prometheus.Registerer) (indexcache.IndexCache, error) {
 	client, err := cache.NewMemcachedClientWithConfig(logger, "index-cache", cfg, prometheus.WrapRegistererWithPrefix("thanos_", registerer))
 	if err != nil {
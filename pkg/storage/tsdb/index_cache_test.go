@@ -78,6 +78,24 @@ func TestIndexCacheConfig_Validate(t *testing.T) {
 				},
 			},
 		},
+		"disk should pass": {
+			cfg: IndexCacheConfig{
+				BackendConfig: cache.BackendConfig{
+					Backend: IndexCacheBackendDisk,
+				},
+				Disk: DiskIndexCacheConfig{
+					MaxSizeBytes: 1024,
+				},
+			},
+		},
+		"disk with no max size should fail": {
+			cfg: IndexCacheConfig{
+				BackendConfig: cache.BackendConfig{
+					Backend: IndexCacheBackendDisk,
+				},
+			},
+			expected: errInvalidDiskIndexCacheMaxSize,
+		},
 	}
 
 	for testName, testData := range tests {
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metricmetadata
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// FileVersion1 is the current version of the metric metadata files format.
+	FileVersion1 = 1
+)
+
+// Entry holds the metadata of a metric, and the last time it has been received.
+type Entry struct {
+	Metric string `json:"metric"`
+	Type   string `json:"type"`
+	Help   string `json:"help,omitempty"`
+	Unit   string `json:"unit,omitempty"`
+
+	// LastSeen is a unix timestamp (seconds precision) of the last time the metadata
+	// has been received by an ingester.
+	LastSeen int64 `json:"last_seen"`
+}
+
+// GetLastSeen returns the last time the metadata has been received by an ingester.
+func (e Entry) GetLastSeen() time.Time {
+	return time.Unix(e.LastSeen, 0)
+}
+
+// entryKey identifies a distinct metric metadata, regardless of when it has been seen.
+type entryKey struct {
+	metric, typ, help, unit string
+}
+
+func (e Entry) key() entryKey {
+	return entryKey{metric: e.Metric, typ: e.Type, help: e.Help, unit: e.Unit}
+}
+
+// File is the content of a metric metadata file stored in the bucket.
+type File struct {
+	Version int `json:"version"`
+
+	// UpdatedAt is a unix timestamp (seconds precision) of when the file has been written.
+	UpdatedAt int64 `json:"updated_at"`
+
+	Metadata []Entry `json:"metadata"`
+}
+
+// Merge returns the union of the input entries. Each distinct metadata is returned once, with
+// the most recent last seen time. The output is sorted by metric name, type, help and unit.
+func Merge(entries ...[]Entry) []Entry {
+	merged := map[entryKey]Entry{}
+	for _, list := range entries {
+		for _, e := range list {
+			if existing, ok := merged[e.key()]; ok && existing.LastSeen >= e.LastSeen {
+				continue
+			}
+			merged[e.key()] = e
+		}
+	}
+
+	out := make([]Entry, 0, len(merged))
+	for _, e := range merged {
+		out = append(out, e)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Metric != b.Metric {
+			return a.Metric < b.Metric
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Help != b.Help {
+			return a.Help < b.Help
+		}
+		return a.Unit < b.Unit
+	})
+
+	return out
+}
+
+// RemoveNotSeenSince returns the entries which have been seen at or after the given time.
+// The input slice is not modified.
+func RemoveNotSeenSince(entries []Entry, t time.Time) []Entry {
+	out := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		if !e.GetLastSeen().Before(t) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metricmetadata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	merged := Merge(
+		[]Entry{
+			{Metric: "up", Type: "gauge", Help: "Target is up.", LastSeen: 10},
+			{Metric: "requests_total", Type: "counter", Help: "Total requests.", LastSeen: 20},
+		},
+		[]Entry{
+			{Metric: "up", Type: "gauge", Help: "Target is up.", LastSeen: 30},
+			{Metric: "requests_total", Type: "counter", Help: "Total requests.", LastSeen: 5},
+			{Metric: "requests_total", Type: "counter", Help: "Total number of requests.", LastSeen: 5},
+			{Metric: "latency", Type: "histogram", Unit: "seconds", LastSeen: 40},
+		},
+		nil,
+	)
+
+	assert.Equal(t, []Entry{
+		{Metric: "latency", Type: "histogram", Unit: "seconds", LastSeen: 40},
+		{Metric: "requests_total", Type: "counter", Help: "Total number of requests.", LastSeen: 5},
+		{Metric: "requests_total", Type: "counter", Help: "Total requests.", LastSeen: 20},
+		{Metric: "up", Type: "gauge", Help: "Target is up.", LastSeen: 30},
+	}, merged)
+
+	assert.Empty(t, Merge())
+}
+
+func TestRemoveNotSeenSince(t *testing.T) {
+	entries := []Entry{
+		{Metric: "first", Type: "gauge", LastSeen: 10},
+		{Metric: "second", Type: "gauge", LastSeen: 20},
+		{Metric: "third", Type: "gauge", LastSeen: 30},
+	}
+
+	assert.Equal(t, entries[1:], RemoveNotSeenSince(entries, time.Unix(20, 0)))
+	assert.Equal(t, entries, RemoveNotSeenSince(entries, time.Unix(0, 0)))
+	assert.Empty(t, RemoveNotSeenSince(entries, time.Unix(31, 0)))
+}
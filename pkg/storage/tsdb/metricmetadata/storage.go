@@ -0,0 +1,225 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metricmetadata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/runutil"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+const (
+	// MetadataPrefix is the location, relative to the tenant's location, where the metric metadata is stored.
+	MetadataPrefix = "metric-metadata"
+
+	// CompactedFilename is the name of the file, within MetadataPrefix, holding the compacted metric metadata.
+	CompactedFilename = "metadata.json.gz"
+
+	// SegmentsPrefix is the location, relative to MetadataPrefix, where the metric metadata uploaded
+	// by the ingesters is stored until the compactor merges it into the compacted file.
+	SegmentsPrefix = "segments"
+
+	fileExtension = ".json.gz"
+)
+
+var (
+	ErrMetadataCorrupted = errors.New("metric metadata file corrupted")
+
+	errMetadataNotFound = errors.New("metric metadata file not found")
+)
+
+// WriteSegment uploads the metric metadata received by an ingester as a new segment of the tenant's
+// metric metadata. The segment is named after the ingester ID and the upload time, so that segments
+// are never overwritten.
+func WriteSegment(ctx context.Context, bkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, ingesterID string, entries []Entry, now time.Time) error {
+	userBkt := bucket.NewUserBucketClient(userID, bkt, cfgProvider)
+	name := path.Join(MetadataPrefix, SegmentsPrefix, fmt.Sprintf("%s-%d%s", ingesterID, now.UnixMilli(), fileExtension))
+
+	return writeFile(ctx, userBkt, name, entries, now)
+}
+
+// Read returns the tenant's metric metadata stored in the bucket, merging the compacted file with the
+// segments not compacted yet. Corrupted files are logged and skipped.
+func Read(ctx context.Context, bkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, logger log.Logger) ([]Entry, error) {
+	userBkt := bucket.NewUserBucketClient(userID, bkt, cfgProvider)
+
+	// The segments are listed before reading the compacted file: since the compactor deletes the
+	// segments after writing the compacted file, each listed segment is either still readable or
+	// already merged into the compacted file.
+	names, err := listSegments(ctx, userBkt)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([][]Entry, 0, len(names)+1)
+	for _, name := range append([]string{path.Join(MetadataPrefix, CompactedFilename)}, names...) {
+		f, err := readFile(ctx, userBkt, name, logger)
+		if errors.Is(err, errMetadataNotFound) {
+			// The compacted file doesn't exist yet, or the segment has been compacted after the listing.
+			continue
+		}
+		if errors.Is(err, ErrMetadataCorrupted) {
+			level.Warn(logger).Log("msg", "skipped corrupted metric metadata file", "file", name, "err", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f.Metadata)
+	}
+
+	return Merge(files...), nil
+}
+
+// Compact merges the segments into the compacted file of the tenant's metric metadata, and then deletes
+// them. Entries which haven't been seen since notSeenSince are removed, unless notSeenSince is zero.
+// Corrupted files are logged and deleted. Returns the number of compacted segments.
+func Compact(ctx context.Context, bkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, notSeenSince time.Time, logger log.Logger) (int, error) {
+	userBkt := bucket.NewUserBucketClient(userID, bkt, cfgProvider)
+	compactedName := path.Join(MetadataPrefix, CompactedFilename)
+
+	names, err := listSegments(ctx, userBkt)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		compacted          []Entry
+		compactedCorrupted bool
+	)
+	f, err := readFile(ctx, userBkt, compactedName, logger)
+	switch {
+	case err == nil:
+		compacted = f.Metadata
+	case errors.Is(err, ErrMetadataCorrupted):
+		level.Warn(logger).Log("msg", "found a corrupted compacted metric metadata file, recreating it", "err", err)
+		compactedCorrupted = true
+	case !errors.Is(err, errMetadataNotFound):
+		return 0, err
+	}
+
+	segments := make([][]Entry, 0, len(names)+1)
+	segments = append(segments, compacted)
+	for _, name := range names {
+		f, err := readFile(ctx, userBkt, name, logger)
+		if errors.Is(err, errMetadataNotFound) {
+			continue
+		}
+		if errors.Is(err, ErrMetadataCorrupted) {
+			level.Warn(logger).Log("msg", "deleting corrupted metric metadata segment", "segment", name, "err", err)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		segments = append(segments, f.Metadata)
+	}
+
+	merged := Merge(segments...)
+	if !notSeenSince.IsZero() {
+		merged = RemoveNotSeenSince(merged, notSeenSince)
+	}
+
+	// Nothing to do if there are no segments and no entries to remove.
+	if len(names) == 0 && len(merged) == len(compacted) && !compactedCorrupted {
+		return 0, nil
+	}
+
+	if len(merged) == 0 {
+		if err := userBkt.Delete(ctx, compactedName); err != nil && !userBkt.IsObjNotFoundErr(err) {
+			return 0, errors.Wrap(err, "delete compacted metric metadata")
+		}
+	} else if err := writeFile(ctx, userBkt, compactedName, merged, time.Now()); err != nil {
+		return 0, err
+	}
+
+	// The segments are deleted only once the compacted file has been written, so that
+	// queriers always find each entry in either the compacted file or a segment.
+	for _, name := range names {
+		if err := userBkt.Delete(ctx, name); err != nil && !userBkt.IsObjNotFoundErr(err) {
+			return 0, errors.Wrapf(err, "delete metric metadata segment %s", name)
+		}
+	}
+
+	return len(names), nil
+}
+
+func listSegments(ctx context.Context, userBkt objstore.InstrumentedBucketReader) ([]string, error) {
+	var names []string
+	err := userBkt.Iter(ctx, path.Join(MetadataPrefix, SegmentsPrefix)+"/", func(name string) error {
+		if strings.HasSuffix(name, fileExtension) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list metric metadata segments")
+	}
+	return names, nil
+}
+
+func writeFile(ctx context.Context, userBkt objstore.Bucket, name string, entries []Entry, now time.Time) error {
+	content, err := json.Marshal(File{
+		Version:   FileVersion1,
+		UpdatedAt: now.Unix(),
+		Metadata:  entries,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshal metric metadata")
+	}
+
+	var gzipContent bytes.Buffer
+	gzip := gzip.NewWriter(&gzipContent)
+	gzip.Name = strings.TrimSuffix(path.Base(name), ".gz")
+
+	if _, err := gzip.Write(content); err != nil {
+		return errors.Wrap(err, "gzip metric metadata")
+	}
+	if err := gzip.Close(); err != nil {
+		return errors.Wrap(err, "close gzip metric metadata")
+	}
+
+	return errors.Wrapf(userBkt.Upload(ctx, name, &gzipContent), "upload metric metadata %s", name)
+}
+
+func readFile(ctx context.Context, userBkt objstore.InstrumentedBucket, name string, logger log.Logger) (*File, error) {
+	r, err := userBkt.WithExpectedErrs(userBkt.IsObjNotFoundErr).Get(ctx, name)
+	if err != nil {
+		if userBkt.IsObjNotFoundErr(err) {
+			return nil, errMetadataNotFound
+		}
+		return nil, errors.Wrapf(err, "read metric metadata %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(logger, r, "close metric metadata reader")
+
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrapf(ErrMetadataCorrupted, "decompress metric metadata %s: %v", name, err)
+	}
+	defer runutil.CloseWithLogOnErr(logger, gzipReader, "close metric metadata gzip reader")
+
+	f := &File{}
+	if err := json.NewDecoder(gzipReader).Decode(f); err != nil {
+		return nil, errors.Wrapf(ErrMetadataCorrupted, "decode metric metadata %s: %v", name, err)
+	}
+	if f.Version != FileVersion1 {
+		return nil, errors.Wrapf(ErrMetadataCorrupted, "unsupported version %d of metric metadata %s", f.Version, name)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metricmetadata
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/testutil"
+)
+
+func TestWriteSegmentReadCompact(t *testing.T) {
+	const userID = "user-1"
+
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	bkt, _ := testutil.PrepareFilesystemBucket(t)
+
+	listObjects := func() []string {
+		var names []string
+		require.NoError(t, bkt.Iter(ctx, userID+"/", func(name string) error {
+			names = append(names, name)
+			return nil
+		}, objstore.WithRecursiveIter))
+		return names
+	}
+
+	// Reading or compacting the metadata of a tenant without metadata should not fail.
+	actual, err := Read(ctx, bkt, userID, nil, logger)
+	require.NoError(t, err)
+	assert.Empty(t, actual)
+
+	compacted, err := Compact(ctx, bkt, userID, nil, time.Time{}, logger)
+	require.NoError(t, err)
+	assert.Equal(t, 0, compacted)
+	assert.Empty(t, listObjects())
+
+	up := Entry{Metric: "up", Type: "gauge", Help: "Target is up.", LastSeen: 100}
+	requests := Entry{Metric: "requests_total", Type: "counter", Help: "Total requests.", LastSeen: 100}
+	latency := Entry{Metric: "latency", Type: "histogram", Unit: "seconds", LastSeen: 300}
+
+	// Two ingesters upload their segments, with the same metadata seen at different times.
+	require.NoError(t, WriteSegment(ctx, bkt, userID, nil, "ingester-1", []Entry{up, requests}, time.Unix(100, 0)))
+	upSeenLater := up
+	upSeenLater.LastSeen = 200
+	require.NoError(t, WriteSegment(ctx, bkt, userID, nil, "ingester-2", []Entry{upSeenLater}, time.Unix(200, 0)))
+
+	// Upload a corrupted segment, which is expected to be skipped when reading.
+	corruptedSegment := path.Join(userID, MetadataPrefix, SegmentsPrefix, "corrupted"+fileExtension)
+	require.NoError(t, bkt.Upload(ctx, corruptedSegment, bytes.NewReader([]byte("invalid!}"))))
+
+	actual, err = Read(ctx, bkt, userID, nil, logger)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{requests, upSeenLater}, actual)
+
+	// Compacting merges the segments, and deletes them, including the corrupted one.
+	compacted, err = Compact(ctx, bkt, userID, nil, time.Time{}, logger)
+	require.NoError(t, err)
+	assert.Equal(t, 3, compacted)
+	assert.Equal(t, []string{path.Join(userID, MetadataPrefix, CompactedFilename)}, listObjects())
+
+	actual, err = Read(ctx, bkt, userID, nil, logger)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{requests, upSeenLater}, actual)
+
+	// A new segment is read together with the compacted file.
+	require.NoError(t, WriteSegment(ctx, bkt, userID, nil, "ingester-1", []Entry{latency}, time.Unix(300, 0)))
+
+	actual, err = Read(ctx, bkt, userID, nil, logger)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{latency, requests, upSeenLater}, actual)
+
+	// Compacting removes the metadata not seen since the given time.
+	compacted, err = Compact(ctx, bkt, userID, nil, time.Unix(150, 0), logger)
+	require.NoError(t, err)
+	assert.Equal(t, 1, compacted)
+
+	actual, err = Read(ctx, bkt, userID, nil, logger)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{latency, upSeenLater}, actual)
+
+	// The compacted file is deleted once all the metadata has been removed.
+	_, err = Compact(ctx, bkt, userID, nil, time.Unix(1000, 0), logger)
+	require.NoError(t, err)
+	assert.Empty(t, listObjects())
+}
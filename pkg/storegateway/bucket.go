@@ -84,15 +84,19 @@ type BucketStoreStats struct {
 // This makes them smaller, but takes extra CPU and memory.
 // When used with in-memory cache, memory usage should decrease overall, thanks to postings being smaller.
 type BucketStore struct {
-	userID          string
-	logger          log.Logger
-	metrics         *BucketStoreMetrics
-	bkt             objstore.InstrumentedBucketReader
-	fetcher         block.MetadataFetcher
-	dir             string
-	indexCache      indexcache.IndexCache
-	indexReaderPool *indexheader.ReaderPool
-	seriesHashCache *hashcache.SeriesHashCache
+	userID  string
+	logger  log.Logger
+	metrics *BucketStoreMetrics
+	bkt     objstore.InstrumentedBucketReader
+	fetcher block.MetadataFetcher
+	dir     string
+
+	// Bucket of the blocks moved to the cold storage. It's nil if the cold storage is disabled.
+	coldBkt                            objstore.InstrumentedBucketReader
+	coldIndexHeaderEagerLoadingEnabled bool
+	indexCache                         indexcache.IndexCache
+	indexReaderPool                    *indexheader.ReaderPool
+	seriesHashCache                    *hashcache.SeriesHashCache
 
 	// Sets of blocks that have the same labels. They are indexed by a hash over their label set.
 	blocksMx sync.RWMutex
@@ -113,6 +117,9 @@ type BucketStore struct {
 	// Gate used to limit concurrency on loading index-headers across all tenants.
 	lazyLoadingGate gate.Gate
 
+	// Memory budget shared by the Series() requests across all tenants. It's nil if the budget is disabled.
+	seriesMemoryBudget *seriesMemoryBudget
+
 	// chunksLimiterFactory creates a new limiter used to limit the number of chunks fetched by each Series() call.
 	chunksLimiterFactory ChunksLimiterFactory
 	// seriesLimiterFactory creates a new limiter used to limit the number of touched series by each Series() call,
@@ -198,6 +205,22 @@ func WithLazyLoadingGate(lazyLoadingGate gate.Gate) BucketStoreOption {
 	}
 }
 
+// WithSeriesMemoryBudget sets the memory budget the Series() requests reserve their estimated memory from.
+func WithSeriesMemoryBudget(budget *seriesMemoryBudget) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.seriesMemoryBudget = budget
+	}
+}
+
+// WithColdBucket sets the bucket of the blocks moved to the cold storage. If eagerLoadIndexHeaders is false,
+// the index-headers of these blocks are not eagerly loaded at startup.
+func WithColdBucket(coldBkt objstore.InstrumentedBucketReader, eagerLoadIndexHeaders bool) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.coldBkt = coldBkt
+		s.coldIndexHeaderEagerLoadingEnabled = eagerLoadIndexHeaders
+	}
+}
+
 // NewBucketStore creates a new bucket backed store that implements the store API against
 // an object store bucket. It is optimized to work against high latency backends.
 func NewBucketStore(
@@ -306,7 +329,16 @@ func (s *BucketStore) syncBlocks(ctx context.Context, initialSync bool) error {
 
 	for id, meta := range metas {
 		if b := s.getBlock(id); b != nil {
-			continue
+			if b.meta.StorageTier == meta.StorageTier {
+				continue
+			}
+
+			// The block has been moved to another storage tier, so it's loaded again from the new one.
+			if err := s.removeBlock(id); err != nil {
+				level.Warn(s.logger).Log("msg", "drop of block moved to another storage tier failed", "block", id, "err", err)
+				continue
+			}
+			level.Info(s.logger).Log("msg", "dropped block moved to another storage tier", "block", id, "storage_tier", meta.StorageTier)
 		}
 		select {
 		case <-ctx.Done():
@@ -392,10 +424,21 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *block.Meta, initialSyn
 	}()
 	s.metrics.blockLoads.Inc()
 
+	bkt := s.bkt
+	if meta.StorageTier == block.ColdStorageTier {
+		if s.coldBkt == nil {
+			return errors.New("the block is stored in the cold storage, but the cold storage is disabled")
+		}
+		bkt = s.coldBkt
+
+		// The index-headers of the blocks in the cold storage are not eagerly loaded if disabled.
+		initialSync = initialSync && s.coldIndexHeaderEagerLoadingEnabled
+	}
+
 	indexHeaderReader, err := s.indexReaderPool.NewBinaryReader(
 		ctx,
 		s.logger,
-		s.bkt,
+		bkt,
 		s.dir,
 		meta.ULID,
 		s.postingOffsetsInMemSampling,
@@ -418,7 +461,7 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *block.Meta, initialSyn
 		log.With(s.logger, "block", meta.ULID),
 		s.metrics,
 		meta,
-		s.bkt,
+		bkt,
 		dir,
 		s.indexCache,
 		indexHeaderReader,
@@ -574,7 +617,7 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 
 	logSeriesRequestToSpan(srv.Context(), s.logger, req.MinTime, req.MaxTime, matchers, reqBlockMatchers, shardSelector, req.StreamingChunksBatchSize)
 
-	blocks, indexReaders, chunkReaders := s.openBlocksForReading(ctx, req.SkipChunks, req.MinTime, req.MaxTime, reqBlockMatchers, stats)
+	blocks, skippedBlocks, indexReaders, chunkReaders := s.openBlocksForReading(ctx, req.SkipChunks, req.MinTime, req.MaxTime, reqBlockMatchers, matchers, stats)
 	// We must keep the readers open until all their data has been sent.
 	for _, r := range indexReaders {
 		defer runutil.CloseWithLogOnErr(s.logger, r, "close block index reader")
@@ -598,6 +641,14 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 	}
 	defer s.queryGate.Done()
 
+	if s.seriesMemoryBudget != nil {
+		release, err := s.reserveSeriesMemory(ctx, blocks, matchers, req)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
 	var (
 		// If we are streaming the series labels and chunks separately, we don't need to fetch the postings
 		// twice. So we use these slices to re-use them. Each reuse[i] corresponds to a single block.
@@ -607,6 +658,10 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 	for _, b := range blocks {
 		resHints.AddQueriedBlock(b.meta.ULID)
 	}
+	// The blocks skipped because of their bloom filters have been queried too: they have no series matching the request.
+	for _, id := range skippedBlocks {
+		resHints.AddQueriedBlock(id)
+	}
 	if err := s.sendHints(srv, resHints); err != nil {
 		return err
 	}
@@ -1246,7 +1301,10 @@ func (s *BucketStore) recordSeriesHashCacheStats(stats *queryStats) {
 	s.metrics.seriesHashCacheHits.Add(float64(stats.seriesHashCacheHits))
 }
 
-func (s *BucketStore) openBlocksForReading(ctx context.Context, skipChunks bool, minT, maxT int64, blockMatchers []*labels.Matcher, stats *safeQueryStats) ([]*bucketBlock, map[ulid.ULID]*bucketIndexReader, map[ulid.ULID]chunkReader) {
+// openBlocksForReading opens the readers of the blocks owned by this store-gateway instance and matching the request.
+// The blocks which can't have any series matching the seriesMatchers according to their bloom filters are not opened,
+// and are returned as skipped.
+func (s *BucketStore) openBlocksForReading(ctx context.Context, skipChunks bool, minT, maxT int64, blockMatchers, seriesMatchers []*labels.Matcher, stats *safeQueryStats) ([]*bucketBlock, []ulid.ULID, map[ulid.ULID]*bucketIndexReader, map[ulid.ULID]chunkReader) {
 	// ignore the span context so that we can use the context for cancellation
 	span, _ := opentracing.StartSpanFromContext(ctx, "bucket_store_open_blocks_for_reading")
 	defer span.Finish()
@@ -1255,14 +1313,28 @@ func (s *BucketStore) openBlocksForReading(ctx context.Context, skipChunks bool,
 	defer s.blocksMx.RUnlock()
 
 	// Find all blocks owned by this store-gateway instance and matching the request.
-	blocks := s.blockSet.getFor(minT, maxT, blockMatchers)
+	var (
+		blocks  []*bucketBlock
+		skipped []ulid.ULID
+	)
+	for _, b := range s.blockSet.getFor(minT, maxT, blockMatchers) {
+		if !b.mayMatchSeries(seriesMatchers) {
+			skipped = append(skipped, b.meta.ULID)
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+	if len(skipped) > 0 {
+		s.metrics.seriesBlocksSkipped.Add(float64(len(skipped)))
+		span.LogKV("blocks skipped by bloom filters", len(skipped))
+	}
 
 	indexReaders := make(map[ulid.ULID]*bucketIndexReader, len(blocks))
 	for _, b := range blocks {
 		indexReaders[b.meta.ULID] = b.loadedIndexReader(s.postingsStrategy, stats)
 	}
 	if skipChunks {
-		return blocks, indexReaders, nil
+		return blocks, skipped, indexReaders, nil
 	}
 
 	chunkReaders := make(map[ulid.ULID]chunkReader, len(blocks))
@@ -1270,7 +1342,7 @@ func (s *BucketStore) openBlocksForReading(ctx context.Context, skipChunks bool,
 		chunkReaders[b.meta.ULID] = b.chunkReader(ctx)
 	}
 
-	return blocks, indexReaders, chunkReaders
+	return blocks, skipped, indexReaders, chunkReaders
 }
 
 // LabelNames implements the storepb.StoreServer interface.
@@ -1815,6 +1887,9 @@ type bucketBlock struct {
 	// request hints' BlockMatchers.
 	blockLabels labels.Labels
 
+	// Optional bloom filters of the values of some labels, used to skip the block when it can't match a request.
+	bloomFilters block.BloomFilters
+
 	expandedPostingsPromises sync.Map
 }
 
@@ -1844,6 +1919,16 @@ func newBucketBlock(
 		blockLabels: labels.FromStrings(block.BlockIDLabel, meta.ULID.String()),
 	}
 
+	// The bloom filters are optional: if they can't be read, the block is always queried.
+	if meta.HasBloomFilters() {
+		filters, readErr := block.ReadBloomFilters(ctx, bkt, meta.ULID)
+		if readErr != nil {
+			level.Warn(logger).Log("msg", "failed to read block bloom filters", "err", readErr)
+		} else {
+			b.bloomFilters = filters
+		}
+	}
+
 	// Get object handles for all chunk files (segment files) from meta.json, if available.
 	if len(meta.Thanos.SegmentFiles) > 0 {
 		b.chunkObjs = make([]string, 0, len(meta.Thanos.SegmentFiles))
@@ -1934,6 +2019,11 @@ func (b *bucketBlock) matchLabels(matchers []*labels.Matcher) bool {
 	return true
 }
 
+// mayMatchSeries returns false if the block has definitely no series matching the matchers, according to its bloom filters.
+func (b *bucketBlock) mayMatchSeries(matchers []*labels.Matcher) bool {
+	return b.bloomFilters == nil || b.bloomFilters.MayMatch(matchers)
+}
+
 // overlapsClosedInterval returns true if the block overlaps [mint, maxt).
 func (b *bucketBlock) overlapsClosedInterval(mint, maxt int64) bool {
 	// The block itself is a half-open interval
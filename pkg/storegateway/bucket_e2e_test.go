@@ -19,6 +19,7 @@ import (
 	"github.com/gogo/status"
 	dskit_metrics "github.com/grafana/dskit/metrics"
 	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
@@ -676,6 +677,42 @@ func TestBucketStore_Series_ChunksLimiter_e2e(t *testing.T) {
 	}
 }
 
+func TestBucketStore_Series_SeriesMemoryBudget_e2e(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := prepareStoreWithTestBlocks(t, objstore.NewInMemBucket(), defaultPrepareStoreConfig(t))
+	s.store.seriesMemoryBudget = newSeriesMemoryBudget(100*1024*1024, 0, nil)
+
+	req := &storepb.SeriesRequest{
+		Matchers: []storepb.LabelMatcher{
+			{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+		},
+		MinTime: timestamp.FromTime(minTime),
+		MaxTime: timestamp.FromTime(maxTime),
+	}
+	srv := newBucketStoreTestServer(t, s.store)
+
+	// The request should succeed while the budget is available, and release its reservation once done.
+	_, _, _, _, err := srv.Series(ctx, req)
+	require.NoError(t, err)
+	assert.Greater(t, prom_testutil.ToFloat64(s.store.seriesMemoryBudget.reservedBytesTotal), float64(0))
+	assert.Equal(t, float64(0), prom_testutil.ToFloat64(s.store.seriesMemoryBudget.reservedBytes))
+
+	// The request should be rejected with a retryable error once the budget is exhausted.
+	release, err := s.store.seriesMemoryBudget.reserve(ctx, 100*1024*1024)
+	require.NoError(t, err)
+	defer release()
+
+	_, _, _, _, err = srv.Series(ctx, req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "series memory budget")
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Equal(t, float64(1), prom_testutil.ToFloat64(s.store.seriesMemoryBudget.rejectedRequests))
+}
+
 func assertQueryStatsLabelNamesMetricsRecorded(t *testing.T, numLabelNames int, registry *prometheus.Registry) {
 	t.Helper()
 
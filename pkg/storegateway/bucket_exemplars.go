@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storegateway/storepb"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// Exemplars returns the exemplars stored in the requested blocks, of the series matching at least one
+// of the sets of matchers. All the requested blocks loaded by the store are reported as queried, even
+// if they have no exemplars.
+func (s *BucketStore) Exemplars(ctx context.Context, req *storepb.ExemplarsRequest) (*storepb.ExemplarsResponse, error) {
+	matchers := make([][]*labels.Matcher, 0, len(req.Matchers))
+	for _, ms := range req.Matchers {
+		promMatchers, err := storepb.MatchersToPromMatchers(ms.Matchers...)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "translate request labels matchers").Error())
+		}
+		matchers = append(matchers, promMatchers)
+	}
+
+	spanLog, spanCtx := spanlogger.NewWithLogger(ctx, s.logger, "BucketStore.Exemplars")
+	defer spanLog.Finish()
+
+	var (
+		g, gctx = errgroup.WithContext(spanCtx)
+		resp    = &storepb.ExemplarsResponse{}
+		mtx     sync.Mutex
+		sets    [][]exemplar.QueryResult
+	)
+
+	s.blocksMx.RLock()
+
+	for _, id := range req.BlockIds {
+		blockID, err := ulid.Parse(id)
+		if err != nil {
+			s.blocksMx.RUnlock()
+			return nil, status.Error(codes.InvalidArgument, errors.Wrapf(err, "parse block ID %s", id).Error())
+		}
+
+		b, ok := s.blocks[blockID]
+		if !ok {
+			continue
+		}
+		resp.QueriedBlocks = append(resp.QueriedBlocks, id)
+
+		if !b.meta.HasExemplars() || !b.overlapsClosedInterval(req.Start, req.End) {
+			continue
+		}
+
+		g.Go(func() error {
+			series, err := block.ReadExemplars(gctx, b.bkt, b.meta.ULID)
+			if err != nil {
+				return errors.Wrapf(err, "block %s", b.meta.ULID)
+			}
+
+			series = block.FilterExemplars(series, req.Start, req.End, matchers...)
+			if len(series) > 0 {
+				mtx.Lock()
+				sets = append(sets, series)
+				mtx.Unlock()
+			}
+			return nil
+		})
+	}
+
+	s.blocksMx.RUnlock()
+
+	if err := g.Wait(); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, status.Error(codes.Canceled, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	merged := block.MergeExemplars(sets...)
+	resp.Timeseries = make([]mimirpb.TimeSeries, 0, len(merged))
+	for _, series := range merged {
+		resp.Timeseries = append(resp.Timeseries, mimirpb.TimeSeries{
+			Labels:    mimirpb.FromLabelsToLabelAdapters(series.SeriesLabels),
+			Exemplars: mimirpb.FromExemplarsToExemplarProtos(series.Exemplars),
+		})
+	}
+
+	level.Debug(spanLog).Log("msg", "fetched exemplars", "blocks", len(resp.QueriedBlocks), "series", len(resp.Timeseries))
+	return resp, nil
+}
@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/hashcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/providers/filesystem"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storegateway/indexcache"
+	"github.com/grafana/mimir/pkg/storegateway/indexheader"
+	"github.com/grafana/mimir/pkg/storegateway/storepb"
+)
+
+func TestBucketStore_Exemplars(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	bktDir := filepath.Join(tmpDir, "bkt")
+	logger := log.NewNopLogger()
+
+	series1 := labels.FromStrings("__name__", "metric", "pod", "pod-1")
+	series2 := labels.FromStrings("__name__", "metric", "pod", "pod-2")
+	series3 := labels.FromStrings("__name__", "metric", "pod", "pod-3")
+	e := func(ts int64) exemplar.Exemplar {
+		return exemplar.Exemplar{Labels: labels.FromStrings("trace_id", "abc"), Value: float64(ts), Ts: ts, HasTs: true}
+	}
+
+	createBlock := func(minT, maxT int64, exemplars []exemplar.QueryResult) ulid.ULID {
+		id, err := block.CreateBlock(ctx, bktDir, []labels.Labels{series1, series2, series3}, 10, minT, maxT, labels.EmptyLabels())
+		require.NoError(t, err)
+
+		blockDir := filepath.Join(bktDir, id.String())
+		require.NoError(t, block.WriteExemplars(blockDir, exemplars))
+
+		// List the block files in the meta, like the upload does.
+		meta, err := block.ReadMetaFromDir(blockDir)
+		require.NoError(t, err)
+		meta.Thanos.Files, err = block.GatherFileStats(blockDir)
+		require.NoError(t, err)
+		require.NoError(t, meta.WriteToDir(logger, blockDir))
+		return id
+	}
+
+	block1 := createBlock(0, 100, []exemplar.QueryResult{
+		{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(10), e(20)}},
+		{SeriesLabels: series2, Exemplars: []exemplar.Exemplar{e(30)}},
+	})
+	block2 := createBlock(100, 200, []exemplar.QueryResult{
+		{SeriesLabels: series1, Exemplars: []exemplar.Exemplar{e(150)}},
+	})
+	block3 := createBlock(200, 300, nil)
+
+	bkt, err := filesystem.NewBucket(bktDir)
+	require.NoError(t, err)
+	instrBkt := objstore.WithNoopInstr(bkt)
+
+	fetcher, err := block.NewMetaFetcher(logger, 10, instrBkt, tmpDir, nil, nil)
+	require.NoError(t, err)
+	indexCache, err := indexcache.NewInMemoryIndexCacheWithConfig(logger, nil, indexcache.InMemoryIndexCacheConfig{})
+	require.NoError(t, err)
+
+	store, err := NewBucketStore(
+		"tenant",
+		instrBkt,
+		fetcher,
+		tmpDir,
+		mimir_tsdb.BucketStoreConfig{
+			StreamingBatchSize:          1000,
+			BlockSyncConcurrency:        10,
+			PostingOffsetsInMemSampling: mimir_tsdb.DefaultPostingOffsetInMemorySampling,
+			IndexHeader:                 indexheader.Config{SparsePersistenceEnabled: true},
+		},
+		selectAllStrategy{},
+		newStaticChunksLimiterFactory(0),
+		newStaticSeriesLimiterFactory(0),
+		newGapBasedPartitioners(mimir_tsdb.DefaultPartitionerMaxGapSize, nil),
+		hashcache.NewSeriesHashCache(1024*1024),
+		NewBucketStoreMetrics(nil),
+		WithLogger(logger),
+		WithIndexCache(indexCache),
+	)
+	require.NoError(t, err)
+	require.NoError(t, store.SyncBlocks(ctx))
+	t.Cleanup(func() { assert.NoError(t, store.RemoveBlocksAndClose()) })
+
+	toProto := func(series labels.Labels, exemplars ...exemplar.Exemplar) mimirpb.TimeSeries {
+		return mimirpb.TimeSeries{
+			Labels:    mimirpb.FromLabelsToLabelAdapters(series),
+			Exemplars: mimirpb.FromExemplarsToExemplarProtos(exemplars),
+		}
+	}
+	unknownBlock := ulid.MustNew(1, nil)
+
+	tests := map[string]struct {
+		req                   *storepb.ExemplarsRequest
+		expectedSeries        []mimirpb.TimeSeries
+		expectedQueriedBlocks []string
+	}{
+		"should return the exemplars of all the requested blocks": {
+			req: &storepb.ExemplarsRequest{
+				Start:    0,
+				End:      300,
+				BlockIds: []string{block1.String(), block2.String(), block3.String()},
+			},
+			expectedSeries: []mimirpb.TimeSeries{
+				toProto(series1, e(10), e(20), e(150)),
+				toProto(series2, e(30)),
+			},
+			expectedQueriedBlocks: []string{block1.String(), block2.String(), block3.String()},
+		},
+		"should return the exemplars within the time range": {
+			req: &storepb.ExemplarsRequest{
+				Start:    20,
+				End:      100,
+				BlockIds: []string{block1.String(), block2.String()},
+			},
+			expectedSeries: []mimirpb.TimeSeries{
+				toProto(series1, e(20)),
+				toProto(series2, e(30)),
+			},
+			expectedQueriedBlocks: []string{block1.String(), block2.String()},
+		},
+		"should return the exemplars of the series matching the matchers": {
+			req: &storepb.ExemplarsRequest{
+				Start: 0,
+				End:   300,
+				Matchers: []storepb.LabelMatchers{
+					{Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "pod", Value: "pod-2"}}},
+					{Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "pod", Value: "pod-3"}}},
+				},
+				BlockIds: []string{block1.String(), block2.String()},
+			},
+			expectedSeries: []mimirpb.TimeSeries{
+				toProto(series2, e(30)),
+			},
+			expectedQueriedBlocks: []string{block1.String(), block2.String()},
+		},
+		"should only query the requested blocks, and not report the unknown blocks as queried": {
+			req: &storepb.ExemplarsRequest{
+				Start:    0,
+				End:      300,
+				BlockIds: []string{block2.String(), unknownBlock.String()},
+			},
+			expectedSeries: []mimirpb.TimeSeries{
+				toProto(series1, e(150)),
+			},
+			expectedQueriedBlocks: []string{block2.String()},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			resp, err := store.Exemplars(ctx, testData.req)
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedSeries, resp.Timeseries)
+
+			sort.Strings(resp.QueriedBlocks)
+			sort.Strings(testData.expectedQueriedBlocks)
+			assert.Equal(t, testData.expectedQueriedBlocks, resp.QueriedBlocks)
+		})
+	}
+
+	t.Run("should fail on invalid block ID", func(t *testing.T) {
+		_, err := store.Exemplars(ctx, &storepb.ExemplarsRequest{Start: 0, End: 300, BlockIds: []string{"invalid"}})
+		require.Error(t, err)
+	})
+}
@@ -29,6 +29,7 @@ type BucketStoreMetrics struct {
 	seriesDataSizeTouched *prometheus.SummaryVec
 	seriesDataSizeFetched *prometheus.SummaryVec
 	seriesBlocksQueried   prometheus.Summary
+	seriesBlocksSkipped   prometheus.Counter
 	resultSeriesCount     prometheus.Summary
 	chunkSizeBytes        prometheus.Histogram
 	queriesDropped        *prometheus.CounterVec
@@ -97,6 +98,10 @@ func NewBucketStoreMetrics(reg prometheus.Registerer) *BucketStoreMetrics {
 		Name: "cortex_bucket_store_series_blocks_queried",
 		Help: "Number of blocks in a bucket store that were touched to satisfy a query.",
 	})
+	m.seriesBlocksSkipped = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_bucket_store_series_blocks_skipped_by_bloom_filters_total",
+		Help: "Total number of blocks which have not been touched to satisfy a query because their bloom filters don't contain the values of the query label matchers.",
+	})
 	m.seriesRefetches = promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "cortex_bucket_store_series_refetches_total",
 		Help: "Total number of cases where the built-in max series size was not enough to fetch series from index, resulting in refetch.",
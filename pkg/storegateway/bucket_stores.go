@@ -46,6 +46,7 @@ type BucketStores struct {
 	cfg                tsdb.BlocksStorageConfig
 	limits             *validation.Overrides
 	bucket             objstore.Bucket
+	coldBucket         objstore.Bucket // nil if the cold storage is disabled.
 	bucketStoreMetrics *BucketStoreMetrics
 	metaFetcherMetrics *MetadataFetcherMetrics
 	shardingStrategy   ShardingStrategy
@@ -66,6 +67,9 @@ type BucketStores struct {
 	// Gate used to limit concurrency on loading index-headers across all tenants.
 	lazyLoadingGate gate.Gate
 
+	// Memory budget of the Series() requests across all tenants. It's nil if the budget is disabled.
+	seriesMemoryBudget *seriesMemoryBudget
+
 	// Keeps a bucket store for each tenant.
 	storesMu sync.RWMutex
 	stores   map[string]*BucketStore
@@ -78,8 +82,8 @@ type BucketStores struct {
 	blocksLoaded      prometheus.GaugeFunc
 }
 
-// NewBucketStores makes a new BucketStores.
-func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStrategy, bucketClient objstore.Bucket, limits *validation.Overrides, logger log.Logger, reg prometheus.Registerer) (*BucketStores, error) {
+// NewBucketStores makes a new BucketStores. The coldBucketClient is nil if the cold storage is disabled.
+func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStrategy, bucketClient, coldBucketClient objstore.Bucket, limits *validation.Overrides, logger log.Logger, reg prometheus.Registerer) (*BucketStores, error) {
 	chunksCacheClient, err := cache.CreateClient("chunks-cache", cfg.BucketStore.ChunksCache.BackendConfig, logger, prometheus.WrapRegistererWithPrefix("thanos_", reg))
 	if err != nil {
 		return nil, errors.Wrapf(err, "chunks-cache")
@@ -106,17 +110,25 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 		lazyLoadingGate = gate.NewInstrumented(lazyLoadingGateReg, cfg.BucketStore.IndexHeader.LazyLoadingConcurrency, blockingGate)
 	}
 
+	// The estimated memory of the concurrent Series() requests against the tenants BucketStores is limited.
+	var seriesMemoryBudget *seriesMemoryBudget
+	if cfg.BucketStore.SeriesMemoryBudgetBytes > 0 {
+		seriesMemoryBudget = newSeriesMemoryBudget(cfg.BucketStore.SeriesMemoryBudgetBytes, cfg.BucketStore.SeriesMemoryBudgetQueueTimeout, reg)
+	}
+
 	u := &BucketStores{
 		logger:             logger,
 		cfg:                cfg,
 		limits:             limits,
 		bucket:             cachingBucket,
+		coldBucket:         coldBucketClient,
 		shardingStrategy:   shardingStrategy,
 		stores:             map[string]*BucketStore{},
 		bucketStoreMetrics: NewBucketStoreMetrics(reg),
 		metaFetcherMetrics: NewMetadataFetcherMetrics(),
 		queryGate:          queryGate,
 		lazyLoadingGate:    lazyLoadingGate,
+		seriesMemoryBudget: seriesMemoryBudget,
 		partitioners:       newGapBasedPartitioners(cfg.BucketStore.PartitionerMaxGapBytes, reg),
 		seriesHashCache:    hashcache.NewSeriesHashCache(cfg.BucketStore.SeriesHashCacheMaxBytes),
 		syncBackoffConfig: backoff.Config{
@@ -150,7 +162,7 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 	}, u.getBlocksLoadedMetric)
 
 	// Init the index cache.
-	if u.indexCache, err = tsdb.NewIndexCache(cfg.BucketStore.IndexCache, logger, reg); err != nil {
+	if u.indexCache, err = tsdb.NewIndexCache(cfg.BucketStore.IndexCache, cfg.BucketStore.SyncDir, logger, reg); err != nil {
 		return nil, errors.Wrap(err, "create index cache")
 	}
 
@@ -334,6 +346,24 @@ func (u *BucketStores) LabelNames(ctx context.Context, req *storepb.LabelNamesRe
 	return store.LabelNames(ctx, req)
 }
 
+// Exemplars returns the exemplars stored in the requested blocks of the tenant.
+func (u *BucketStores) Exemplars(ctx context.Context, req *storepb.ExemplarsRequest) (*storepb.ExemplarsResponse, error) {
+	spanLog, spanCtx := spanlogger.NewWithLogger(ctx, u.logger, "BucketStores.Exemplars")
+	defer spanLog.Span.Finish()
+
+	userID := getUserIDFromGRPCContext(spanCtx)
+	if userID == "" {
+		return nil, fmt.Errorf("no userID")
+	}
+
+	store := u.getStore(userID)
+	if store == nil {
+		return &storepb.ExemplarsResponse{}, nil
+	}
+
+	return store.Exemplars(ctx, req)
+}
+
 // LabelValues implements the storepb.StoreServer interface.
 func (u *BucketStores) LabelValues(ctx context.Context, req *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
 	spanLog, spanCtx := spanlogger.NewWithLogger(ctx, u.logger, "BucketStores.LabelValues")
@@ -465,6 +495,13 @@ func (u *BucketStores) getOrCreateStore(userID string) (*BucketStore, error) {
 		WithQueryGate(u.queryGate),
 		WithLazyLoadingGate(u.lazyLoadingGate),
 	}
+	if u.seriesMemoryBudget != nil {
+		bucketStoreOpts = append(bucketStoreOpts, WithSeriesMemoryBudget(u.seriesMemoryBudget))
+	}
+	if u.coldBucket != nil {
+		coldUserBkt := bucket.NewUserBucketClient(userID, u.coldBucket, u.limits)
+		bucketStoreOpts = append(bucketStoreOpts, WithColdBucket(coldUserBkt, u.cfg.ColdStorage.IndexHeaderEagerLoadingEnabled))
+	}
 
 	bs, err := NewBucketStore(
 		userID,
@@ -526,6 +563,10 @@ func (u *BucketStores) closeBucketStoreAndDeleteLocalFilesForExcludedTenants(inc
 		}
 
 		userID := f.Name()
+		if userID == tsdb.IndexCacheDiskDirName {
+			// Preserve the disk index cache, which isn't a tenant directory.
+			continue
+		}
 		if _, included := includeUserIDs[userID]; included {
 			// Preserve directory for users owned by this shard.
 			continue
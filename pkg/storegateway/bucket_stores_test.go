@@ -44,6 +44,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/bucket/filesystem"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/storegateway/indexcache"
 	"github.com/grafana/mimir/pkg/storegateway/storepb"
 	"github.com/grafana/mimir/pkg/util"
@@ -72,7 +73,7 @@ func TestBucketStores_InitialSync(t *testing.T) {
 	require.NoError(t, err)
 
 	reg := prometheus.NewPedanticRegistry()
-	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
+	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, nil, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
 	require.NoError(t, err)
 
 	// Query series before the initial sync.
@@ -149,7 +150,7 @@ func TestBucketStores_InitialSyncShouldRetryOnFailure(t *testing.T) {
 	bucket = &failFirstGetBucket{Bucket: bucket}
 
 	reg := prometheus.NewPedanticRegistry()
-	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
+	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, nil, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
 	require.NoError(t, err)
 
 	// Initial sync should succeed even if a transient error occurs.
@@ -210,7 +211,7 @@ func TestBucketStores_SyncBlocks(t *testing.T) {
 	require.NoError(t, err)
 
 	reg := prometheus.NewPedanticRegistry()
-	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
+	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, nil, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
 	require.NoError(t, err)
 
 	// Run an initial sync to discover 1 block.
@@ -264,6 +265,97 @@ func TestBucketStores_SyncBlocks(t *testing.T) {
 	assert.Greater(t, testutil.ToFloat64(stores.syncLastSuccess), float64(0))
 }
 
+func TestBucketStores_SyncBlocks_ShouldLoadBlocksFromColdStorage(t *testing.T) {
+	test.VerifyNoLeak(t)
+
+	const (
+		userID     = "user-1"
+		metricName = "series_1"
+	)
+
+	ctx := context.Background()
+	cfg := prepareStorageConfig(t)
+	cfg.BucketStore.BucketIndex.DeprecatedEnabled = true
+	cfg.ColdStorage.Enabled = true
+	cfg.ColdStorage.IndexHeaderEagerLoadingEnabled = false
+
+	storageDir := t.TempDir()
+	bkt, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+	coldBkt, err := filesystem.NewBucketClient(filesystem.Config{Directory: t.TempDir()})
+	require.NoError(t, err)
+
+	writeBucketIndex := func() {
+		idx, _, err := bucketindex.NewTieredUpdater(bkt, coldBkt, userID, nil, log.NewNopLogger()).UpdateIndex(ctx, nil)
+		require.NoError(t, err)
+		require.NoError(t, bucketindex.WriteIndex(ctx, bkt, userID, nil, idx))
+	}
+
+	generateStorageBlock(t, storageDir, userID, metricName, 10, 100, 15)
+	writeBucketIndex()
+
+	reg := prometheus.NewPedanticRegistry()
+	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bkt, coldBkt, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	require.NoError(t, stores.InitialSync(ctx))
+
+	assertQueriedSeries := func() {
+		seriesSet, warnings, err := querySeries(t, stores, userID, metricName, 20, 40)
+		require.NoError(t, err)
+		assert.Empty(t, warnings)
+		require.Len(t, seriesSet, 1)
+		assert.Equal(t, []mimirpb.LabelAdapter{{Name: labels.MetricName, Value: metricName}}, seriesSet[0].Labels)
+	}
+	assertQueriedSeries()
+
+	// Move the block to the cold storage.
+	userBkt := bucket.NewUserBucketClient(userID, bkt, nil)
+	userColdBkt := bucket.NewUserBucketClient(userID, coldBkt, nil)
+	require.NoError(t, userBkt.Iter(ctx, "", func(name string) error {
+		if name == bucketindex.IndexCompressedFilename {
+			return nil
+		}
+		r, err := userBkt.Get(ctx, name)
+		require.NoError(t, err)
+		defer r.Close()
+		return userColdBkt.Upload(ctx, name, r)
+	}, objstore.WithRecursiveIter))
+	writeBucketIndex()
+
+	require.NoError(t, stores.SyncBlocks(ctx))
+	assertQueriedSeries()
+
+	// Delete the copy left in the blocks storage bucket.
+	require.NoError(t, userBkt.Iter(ctx, "", func(name string) error {
+		if name == bucketindex.IndexCompressedFilename {
+			return nil
+		}
+		return userBkt.Delete(ctx, name)
+	}, objstore.WithRecursiveIter))
+	writeBucketIndex()
+
+	require.NoError(t, stores.SyncBlocks(ctx))
+	assertQueriedSeries()
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_bucket_store_blocks_loaded Number of currently loaded blocks.
+			# TYPE cortex_bucket_store_blocks_loaded gauge
+			cortex_bucket_store_blocks_loaded 1
+
+			# HELP cortex_bucket_store_block_loads_total Total number of remote block loading attempts.
+			# TYPE cortex_bucket_store_block_loads_total counter
+			cortex_bucket_store_block_loads_total 2
+
+			# HELP cortex_bucket_store_block_load_failures_total Total number of failed remote block loading attempts.
+			# TYPE cortex_bucket_store_block_load_failures_total counter
+			cortex_bucket_store_block_load_failures_total 0
+	`),
+		"cortex_bucket_store_blocks_loaded",
+		"cortex_bucket_store_block_loads_total",
+		"cortex_bucket_store_block_load_failures_total",
+	))
+}
+
 func TestBucketStores_syncUsersBlocks(t *testing.T) {
 	test.VerifyNoLeak(t)
 
@@ -295,7 +387,7 @@ func TestBucketStores_syncUsersBlocks(t *testing.T) {
 			bucketClient := &bucket.ClientMock{}
 			bucketClient.MockIter("", allUsers, nil)
 
-			stores, err := NewBucketStores(cfg, testData.shardingStrategy, bucketClient, defaultLimitsOverrides(t), log.NewNopLogger(), nil)
+			stores, err := NewBucketStores(cfg, testData.shardingStrategy, bucketClient, nil, defaultLimitsOverrides(t), log.NewNopLogger(), nil)
 			require.NoError(t, err)
 
 			// Sync user stores and count the number of times the callback is called.
@@ -365,7 +457,7 @@ func TestBucketStores_ChunksAndSeriesLimiterFactoriesInitializedByEnforcedLimits
 			require.NoError(t, err)
 
 			reg := prometheus.NewPedanticRegistry()
-			stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, overrides, log.NewNopLogger(), reg)
+			stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, nil, overrides, log.NewNopLogger(), reg)
 			require.NoError(t, err)
 
 			store, err := stores.getOrCreateStore(userID)
@@ -415,7 +507,7 @@ func testBucketStoresSeriesShouldCorrectlyQuerySeriesSpanningMultipleChunks(t *t
 	require.NoError(t, err)
 
 	reg := prometheus.NewPedanticRegistry()
-	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
+	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, nil, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
 	require.NoError(t, err)
 
 	require.NoError(t, stores.InitialSync(ctx))
@@ -502,7 +594,7 @@ func TestBucketStore_Series_ShouldQueryBlockWithOutOfOrderChunks(t *testing.T) {
 	require.NoError(t, err)
 
 	reg := prometheus.NewPedanticRegistry()
-	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
+	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, nil, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
 	require.NoError(t, err)
 	require.NoError(t, stores.InitialSync(ctx))
 
@@ -661,7 +753,7 @@ func TestBucketStores_deleteLocalFilesForExcludedTenants(t *testing.T) {
 	sharding := userShardingStrategy{}
 
 	reg := prometheus.NewPedanticRegistry()
-	stores, err := NewBucketStores(cfg, &sharding, bucket, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
+	stores, err := NewBucketStores(cfg, &sharding, bucket, nil, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
 	require.NoError(t, err)
 
 	// Perform sync.
@@ -735,6 +827,35 @@ func TestBucketStores_deleteLocalFilesForExcludedTenants(t *testing.T) {
 	`), metricNames...))
 }
 
+func TestBucketStores_ShouldPreserveDiskIndexCacheWhenDeletingLocalFiles(t *testing.T) {
+	test.VerifyNoLeak(t)
+
+	const user1 = "user-1"
+
+	ctx := context.Background()
+	cfg := prepareStorageConfig(t)
+	cfg.BucketStore.IndexCache.Backend = mimir_tsdb.IndexCacheBackendDisk
+	cfg.BucketStore.IndexCache.Disk.MaxSizeBytes = 1024 * 1024
+
+	storageDir := t.TempDir()
+	generateStorageBlock(t, storageDir, user1, "series_1", 10, 100, 15)
+
+	bucket, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	sharding := userShardingStrategy{users: []string{user1}}
+	stores, err := NewBucketStores(cfg, &sharding, bucket, nil, defaultLimitsOverrides(t), log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+
+	require.NoError(t, stores.InitialSync(ctx))
+	require.Equal(t, []string{mimir_tsdb.IndexCacheDiskDirName, user1}, getUsersInDir(t, cfg.BucketStore.SyncDir))
+
+	// No users left in this shard, but the disk index cache is preserved.
+	sharding.users = nil
+	require.NoError(t, stores.SyncBlocks(ctx))
+	require.Equal(t, []string{mimir_tsdb.IndexCacheDiskDirName}, getUsersInDir(t, cfg.BucketStore.SyncDir))
+}
+
 func getUsersInDir(t *testing.T, dir string) []string {
 	fs, err := os.ReadDir(dir)
 	require.NoError(t, err)
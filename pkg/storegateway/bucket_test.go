@@ -1907,6 +1907,64 @@ func TestBucketStore_Series_RequestAndResponseHints(t *testing.T) {
 	}
 }
 
+func TestBucketStore_Series_ShouldSkipBlocksByBloomFilters(t *testing.T) {
+	tb, store, seriesSet1, seriesSet2, block1, block2, cleanup := setupStoreForHintsTest(t, 5000)
+	tb.Cleanup(cleanup)
+
+	// Build the bloom filters of the "i" label values of each block.
+	seriesLabelValue := func(series *storepb.Series) string {
+		for _, l := range series.Labels {
+			if l.Name == "i" {
+				return l.Value
+			}
+		}
+		return ""
+	}
+	for blockID, seriesSet := range map[ulid.ULID][]*storepb.Series{block1: seriesSet1, block2: seriesSet2} {
+		filter := block.NewBloomFilter(len(seriesSet), block.BloomFilterFalsePositiveRate)
+		for _, series := range seriesSet {
+			filter.Add(seriesLabelValue(series))
+		}
+		require.Contains(t, store.blocks, blockID)
+		store.blocks[blockID].bloomFilters = block.BloomFilters{"i": filter}
+	}
+
+	// The blocks skipped by the bloom filters are returned in the response hints.
+	expectedHints := hintspb.SeriesResponseHints{
+		QueriedBlocks: []hintspb.Block{
+			{Id: block1.String()},
+			{Id: block2.String()},
+		},
+	}
+
+	runTestServerSeries(tb, store, 0, []*seriesCase{
+		{
+			Name: "querying a value in the bloom filter of 1 block should skip the other block",
+			Req: &storepb.SeriesRequest{
+				MinTime: 0,
+				MaxTime: 3,
+				Matchers: []storepb.LabelMatcher{
+					{Type: storepb.LabelMatcher_EQ, Name: "i", Value: seriesLabelValue(seriesSet1[0])},
+				},
+			},
+			ExpectedSeries: seriesSet1[:1],
+			ExpectedHints:  expectedHints,
+		}, {
+			Name: "querying a value in the bloom filter of no block should skip all blocks",
+			Req: &storepb.SeriesRequest{
+				MinTime: 0,
+				MaxTime: 3,
+				Matchers: []storepb.LabelMatcher{
+					{Type: storepb.LabelMatcher_EQ, Name: "i", Value: "unknown"},
+				},
+			},
+			ExpectedHints: expectedHints,
+		},
+	}...)
+
+	assert.Equal(t, float64(3), promtest.ToFloat64(store.metrics.seriesBlocksSkipped))
+}
+
 func TestBucketStore_Series_ErrorUnmarshallingRequestHints(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -98,6 +98,14 @@ func NewStoreGateway(gatewayCfg Config, storageCfg mimir_tsdb.BlocksStorageConfi
 		return nil, err
 	}
 
+	var coldBucketClient objstore.Bucket
+	if storageCfg.ColdStorage.Enabled {
+		coldBucketClient, err = bucket.NewClient(context.Background(), storageCfg.ColdStorage.Bucket, "store-gateway-cold-storage", logger, reg)
+		if err != nil {
+			return nil, errors.Wrap(err, "create cold storage bucket client")
+		}
+	}
+
 	ringStore, err = kv.NewClient(
 		gatewayCfg.ShardingRing.KVStore,
 		ring.GetCodec(),
@@ -108,10 +116,10 @@ func NewStoreGateway(gatewayCfg Config, storageCfg mimir_tsdb.BlocksStorageConfi
 		return nil, errors.Wrap(err, "create KV store client")
 	}
 
-	return newStoreGateway(gatewayCfg, storageCfg, bucketClient, ringStore, limits, logger, reg, tracker)
+	return newStoreGateway(gatewayCfg, storageCfg, bucketClient, coldBucketClient, ringStore, limits, logger, reg, tracker)
 }
 
-func newStoreGateway(gatewayCfg Config, storageCfg mimir_tsdb.BlocksStorageConfig, bucketClient objstore.Bucket, ringStore kv.Client, limits *validation.Overrides, logger log.Logger, reg prometheus.Registerer, tracker *activitytracker.ActivityTracker) (*StoreGateway, error) {
+func newStoreGateway(gatewayCfg Config, storageCfg mimir_tsdb.BlocksStorageConfig, bucketClient, coldBucketClient objstore.Bucket, ringStore kv.Client, limits *validation.Overrides, logger log.Logger, reg prometheus.Registerer, tracker *activitytracker.ActivityTracker) (*StoreGateway, error) {
 	var err error
 
 	g := &StoreGateway{
@@ -164,7 +172,7 @@ func newStoreGateway(gatewayCfg Config, storageCfg mimir_tsdb.BlocksStorageConfi
 
 	shardingStrategy = NewShuffleShardingStrategy(g.ring, lifecyclerCfg.ID, lifecyclerCfg.Addr, limits, logger)
 
-	g.stores, err = NewBucketStores(storageCfg, shardingStrategy, bucketClient, limits, logger, prometheus.WrapRegistererWith(prometheus.Labels{"component": "store-gateway"}, reg))
+	g.stores, err = NewBucketStores(storageCfg, shardingStrategy, bucketClient, coldBucketClient, limits, logger, prometheus.WrapRegistererWith(prometheus.Labels{"component": "store-gateway"}, reg))
 	if err != nil {
 		return nil, errors.Wrap(err, "create bucket stores")
 	}
@@ -340,6 +348,16 @@ func (g *StoreGateway) LabelValues(ctx context.Context, req *storepb.LabelValues
 	return g.stores.LabelValues(ctx, req)
 }
 
+// Exemplars implements the storegatewaypb.StoreGatewayServer interface.
+func (g *StoreGateway) Exemplars(ctx context.Context, req *storepb.ExemplarsRequest) (*storepb.ExemplarsResponse, error) {
+	ix := g.tracker.Insert(func() string {
+		return requestActivity(ctx, "StoreGateway/Exemplars", req)
+	})
+	defer g.tracker.Delete(ix)
+
+	return g.stores.Exemplars(ctx, req)
+}
+
 func requestActivity(ctx context.Context, name string, req interface{}) string {
 	user := getUserIDFromGRPCContext(ctx)
 	traceID, _ := tracing.ExtractSampledTraceID(ctx)
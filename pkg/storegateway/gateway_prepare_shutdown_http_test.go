@@ -35,7 +35,7 @@ func createStoreGateway(t *testing.T, reg prometheus.Registerer) (*StoreGateway,
 	bucket, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
 	require.NoError(t, err)
 
-	g, err := newStoreGateway(gatewayCfg, storageCfg, bucket, ringStore, defaultLimitsOverrides(t), log.NewNopLogger(), reg, nil)
+	g, err := newStoreGateway(gatewayCfg, storageCfg, bucket, nil, ringStore, defaultLimitsOverrides(t), log.NewNopLogger(), reg, nil)
 	require.NoError(t, err)
 	return g, ringStore
 }
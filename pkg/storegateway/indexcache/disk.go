@@ -0,0 +1,516 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package indexcache
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	lru "github.com/hashicorp/golang-lru/v2/simplelru"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"golang.org/x/crypto/blake2b"
+
+	"github.com/grafana/mimir/pkg/storage/sharding"
+)
+
+const (
+	// diskItemMagic is the first bytes of each item file, and identifies the version of the file format.
+	diskItemMagic = "MIC1"
+
+	// diskItemOverhead is the size of an item file, in addition to its key and value: the magic,
+	// the key length and the checksum.
+	diskItemOverhead = len(diskItemMagic) + 4 + 4
+
+	diskItemTmpSuffix = ".tmp"
+)
+
+var (
+	castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errDiskItemCorrupted = errors.New("corrupted index cache item")
+)
+
+// DiskIndexCacheConfig holds the disk index cache config.
+type DiskIndexCacheConfig struct {
+	// Dir is the directory where the items are stored.
+	Dir string
+	// MaxSize represents overall maximum number of bytes cache can contain.
+	MaxSize uint64
+	// MaxItemSize represents maximum size of single item.
+	MaxItemSize uint64
+}
+
+// DiskIndexCache is an index cache which stores each item in a file on the local disk, so that the cache
+// is preserved across restarts. The items are stored with the same keys used by the RemoteIndexCache.
+//
+// Each file is written to a temporary file and then renamed, and contains a checksum verified when the item
+// is read, so that the items partially written before a crash are discarded. The files aren't synced to disk,
+// so some of the latest items may be lost in case of a crash.
+//
+// The least recently used items are evicted when the cache is full. The recency of the items isn't persisted,
+// so when the cache is loaded at startup the items are sorted by the time they've been written.
+type DiskIndexCache struct {
+	logger           log.Logger
+	dir              string
+	maxSizeBytes     uint64
+	maxItemSizeBytes uint64
+
+	mtx     sync.Mutex
+	lru     *lru.LRU[string, uint64] // The file name of the items, and their size.
+	curSize uint64
+
+	requests *prometheus.CounterVec
+	hits     *prometheus.CounterVec
+	added    *prometheus.CounterVec
+	overflow *prometheus.CounterVec
+	evicted  prometheus.Counter
+	failures prometheus.Counter
+}
+
+// NewDiskIndexCache creates a new thread-safe disk index cache, loading the items already stored in the directory,
+// and ensures the total size of the files approximately does not exceed the max size.
+func NewDiskIndexCache(logger log.Logger, reg prometheus.Registerer, config DiskIndexCacheConfig) (*DiskIndexCache, error) {
+	if config.MaxItemSize > config.MaxSize {
+		return nil, errors.Errorf("max item size (%v) cannot be bigger than overall cache size (%v)", config.MaxItemSize, config.MaxSize)
+	}
+
+	c := &DiskIndexCache{
+		logger:           logger,
+		dir:              config.Dir,
+		maxSizeBytes:     config.MaxSize,
+		maxItemSizeBytes: config.MaxItemSize,
+	}
+
+	c.requests = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_store_index_cache_disk_requests_total",
+		Help: "Total number of requests to the disk index cache.",
+	}, []string{"item_type"})
+	initLabelValuesForAllCacheTypes(c.requests.MetricVec)
+
+	c.hits = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_store_index_cache_disk_hits_total",
+		Help: "Total number of requests to the disk index cache that were a hit.",
+	}, []string{"item_type"})
+	initLabelValuesForAllCacheTypes(c.hits.MetricVec)
+
+	c.added = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_store_index_cache_disk_items_added_total",
+		Help: "Total number of items that were added to the disk index cache.",
+	}, []string{"item_type"})
+	initLabelValuesForAllCacheTypes(c.added.MetricVec)
+
+	c.overflow = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_store_index_cache_disk_items_overflowed_total",
+		Help: "Total number of items that could not be added to the disk index cache due to being too big.",
+	}, []string{"item_type"})
+	initLabelValuesForAllCacheTypes(c.overflow.MetricVec)
+
+	c.evicted = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_store_index_cache_disk_items_evicted_total",
+		Help: "Total number of items that were evicted from the disk index cache.",
+	})
+
+	c.failures = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_store_index_cache_disk_operation_failures_total",
+		Help: "Total number of disk index cache items which failed to be written or read, including the corrupted items.",
+	})
+
+	_ = promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_store_index_cache_disk_items",
+		Help: "Current number of items in the disk index cache.",
+	}, func() float64 {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		return float64(c.lru.Len())
+	})
+	_ = promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_store_index_cache_disk_size_bytes",
+		Help: "Current byte size of the items files in the disk index cache.",
+	}, func() float64 {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		return float64(c.curSize)
+	})
+	_ = promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_store_index_cache_disk_max_size_bytes",
+		Help: "Maximum number of bytes to be held in the disk index cache.",
+	}, func() float64 {
+		return float64(c.maxSizeBytes)
+	})
+
+	// Initialize LRU cache with a high size limit since we will manage evictions ourselves
+	// based on stored size using `RemoveOldest` method.
+	l, err := lru.NewLRU(maxInt, c.onRemove)
+	if err != nil {
+		return nil, err
+	}
+	c.lru = l
+
+	if err := c.load(); err != nil {
+		return nil, errors.Wrap(err, "load disk index cache")
+	}
+
+	level.Info(logger).Log(
+		"msg", "created disk index cache",
+		"dir", c.dir,
+		"maxItemSizeBytes", c.maxItemSizeBytes,
+		"maxSizeBytes", c.maxSizeBytes,
+		"items", c.lru.Len(),
+		"sizeBytes", c.curSize,
+	)
+	return c, nil
+}
+
+// load adds the items stored in the directory to the cache, from the oldest to the newest one, and removes
+// the temporary files left by a previous process.
+func (c *DiskIndexCache) load() error {
+	if err := os.MkdirAll(c.dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	type item struct {
+		name    string
+		size    uint64
+		modTime time.Time
+	}
+	var items []item
+
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		if strings.HasSuffix(d.Name(), diskItemTmpSuffix) || !isDiskItemName(d.Name()) {
+			level.Debug(c.logger).Log("msg", "removing unexpected file from disk index cache", "path", path)
+			return os.Remove(path)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		items = append(items, item{name: d.Name(), size: uint64(info.Size()), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].modTime.Before(items[j].modTime)
+	})
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, it := range items {
+		c.lru.Add(it.name, it.size)
+		c.curSize += it.size
+	}
+
+	// The max size may have been lowered since the items have been written.
+	for c.curSize > c.maxSizeBytes {
+		if !c.evictOldest() {
+			break
+		}
+	}
+	return nil
+}
+
+// evictOldest evicts the least recently used item to make room in the cache, and returns false if the cache is empty.
+// It must be called with the mutex held.
+func (c *DiskIndexCache) evictOldest() bool {
+	if _, _, ok := c.lru.RemoveOldest(); !ok {
+		return false
+	}
+	c.evicted.Inc()
+	return true
+}
+
+// onRemove is called by the LRU whenever an item is removed, either because it's evicted, or because it's
+// corrupted or failed to be written. Only the former are tracked as evictions, by evictOldest.
+func (c *DiskIndexCache) onRemove(name string, size uint64) {
+	c.curSize -= size
+
+	if err := os.Remove(c.itemPath(name)); err != nil && !os.IsNotExist(err) {
+		c.failures.Inc()
+		level.Warn(c.logger).Log("msg", "failed to remove evicted item from disk index cache", "item", name, "err", err)
+	}
+}
+
+func (c *DiskIndexCache) get(typ string, key string) ([]byte, bool) {
+	c.requests.WithLabelValues(typ).Inc()
+
+	name := diskItemName(key)
+
+	c.mtx.Lock()
+	_, ok := c.lru.Get(name)
+	c.mtx.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(c.itemPath(name))
+	if err != nil {
+		// The item may be still being written.
+		if !os.IsNotExist(err) {
+			c.failures.Inc()
+			level.Warn(c.logger).Log("msg", "failed to read item from disk index cache", "item", name, "err", err)
+		}
+		return nil, false
+	}
+
+	val, err := decodeDiskItem(data, key)
+	if err != nil {
+		c.failures.Inc()
+		level.Warn(c.logger).Log("msg", "removing corrupted item from disk index cache", "item", name, "err", err)
+
+		c.mtx.Lock()
+		c.lru.Remove(name)
+		c.mtx.Unlock()
+		return nil, false
+	}
+
+	c.hits.WithLabelValues(typ).Inc()
+	return val, true
+}
+
+func (c *DiskIndexCache) set(typ string, key string, val []byte) {
+	name := diskItemName(key)
+	size := uint64(diskItemOverhead + len(key) + len(val))
+
+	if size > c.maxItemSizeBytes {
+		level.Debug(c.logger).Log(
+			"msg", "item bigger than maxItemSizeBytes. Ignoring..",
+			"maxItemSizeBytes", c.maxItemSizeBytes,
+			"maxSizeBytes", c.maxSizeBytes,
+			"itemSize", size,
+			"cacheType", typ,
+		)
+		c.overflow.WithLabelValues(typ).Inc()
+		return
+	}
+
+	c.mtx.Lock()
+	if c.lru.Contains(name) {
+		c.mtx.Unlock()
+		return
+	}
+	for c.curSize+size > c.maxSizeBytes {
+		if !c.evictOldest() {
+			break
+		}
+	}
+	// The item is added before it's written, so that the size of the cache accounts for it.
+	c.lru.Add(name, size)
+	c.curSize += size
+	c.mtx.Unlock()
+
+	if err := c.writeItem(name, encodeDiskItem(key, val)); err != nil {
+		c.failures.Inc()
+		level.Warn(c.logger).Log("msg", "failed to write item to disk index cache", "item", name, "err", err)
+
+		c.mtx.Lock()
+		c.lru.Remove(name)
+		c.mtx.Unlock()
+		return
+	}
+
+	// The item may have been evicted while it was being written.
+	c.mtx.Lock()
+	if !c.lru.Contains(name) {
+		_ = os.Remove(c.itemPath(name))
+	}
+	c.mtx.Unlock()
+
+	c.added.WithLabelValues(typ).Inc()
+}
+
+// writeItem writes the data to a temporary file, and then renames it to the item file, so that
+// the item file is never partially written.
+func (c *DiskIndexCache) writeItem(name string, data []byte) error {
+	path := c.itemPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), name+".*"+diskItemTmpSuffix)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// itemPath returns the path of the item file. The items are spread across sub-directories,
+// to not have too many files in the same directory.
+func (c *DiskIndexCache) itemPath(name string) string {
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// diskItemName returns the file name of the item with the given key.
+func diskItemName(key string) string {
+	hash := blake2b.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func isDiskItemName(name string) bool {
+	if len(name) != hex.EncodedLen(blake2b.Size256) {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// encodeDiskItem encodes the item as: magic, key length, key, value, CRC32 of the key length, key and value.
+func encodeDiskItem(key string, val []byte) []byte {
+	data := make([]byte, 0, diskItemOverhead+len(key)+len(val))
+	data = append(data, diskItemMagic...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(key)))
+	data = append(data, key...)
+	data = append(data, val...)
+	return binary.BigEndian.AppendUint32(data, crc32.Checksum(data[len(diskItemMagic):], castagnoliTable))
+}
+
+// decodeDiskItem returns the value of the encoded item, and an error if the item is corrupted or
+// its key isn't the expected one.
+func decodeDiskItem(data []byte, key string) ([]byte, error) {
+	if len(data) < diskItemOverhead || string(data[:len(diskItemMagic)]) != diskItemMagic {
+		return nil, errDiskItemCorrupted
+	}
+
+	checksum := binary.BigEndian.Uint32(data[len(data)-4:])
+	data = data[len(diskItemMagic) : len(data)-4]
+	if crc32.Checksum(data, castagnoliTable) != checksum {
+		return nil, errDiskItemCorrupted
+	}
+
+	keyLen := int(binary.BigEndian.Uint32(data))
+	data = data[4:]
+	if keyLen > len(data) {
+		return nil, errDiskItemCorrupted
+	}
+	if string(data[:keyLen]) != key {
+		return nil, errors.New("index cache item key mismatch")
+	}
+	return data[keyLen:], nil
+}
+
+// StorePostings sets the postings identified by the ulid and label to the value v,
+// if the postings already exists in the cache it is not mutated.
+func (c *DiskIndexCache) StorePostings(userID string, blockID ulid.ULID, l labels.Label, v []byte) {
+	c.set(cacheTypePostings, postingsCacheKey(userID, blockID.String(), l), v)
+}
+
+// FetchMultiPostings fetches multiple postings - each identified by a label.
+func (c *DiskIndexCache) FetchMultiPostings(_ context.Context, userID string, blockID ulid.ULID, keys []labels.Label) BytesResult {
+	blockIDStr := blockID.String()
+	hits := map[labels.Label][]byte{}
+
+	for _, key := range keys {
+		if b, ok := c.get(cacheTypePostings, postingsCacheKey(userID, blockIDStr, key)); ok {
+			hits[key] = b
+		}
+	}
+
+	return &MapIterator[labels.Label]{
+		Keys: keys,
+		M:    hits,
+	}
+}
+
+// StoreSeriesForRef sets the series identified by the ulid and id to the value v,
+// if the series already exists in the cache it is not mutated.
+func (c *DiskIndexCache) StoreSeriesForRef(userID string, blockID ulid.ULID, id storage.SeriesRef, v []byte) {
+	c.set(cacheTypeSeriesForRef, seriesForRefCacheKey(userID, blockID, id), v)
+}
+
+// FetchMultiSeriesForRefs fetches multiple series - each identified by ID - from the cache
+// and returns a map containing cache hits, along with a list of missing IDs.
+func (c *DiskIndexCache) FetchMultiSeriesForRefs(_ context.Context, userID string, blockID ulid.ULID, ids []storage.SeriesRef) (hits map[storage.SeriesRef][]byte, misses []storage.SeriesRef) {
+	hits = map[storage.SeriesRef][]byte{}
+
+	for _, id := range ids {
+		if b, ok := c.get(cacheTypeSeriesForRef, seriesForRefCacheKey(userID, blockID, id)); ok {
+			hits[id] = b
+			continue
+		}
+
+		misses = append(misses, id)
+	}
+
+	return hits, misses
+}
+
+// StoreExpandedPostings stores the encoded result of ExpandedPostings for specified matchers identified by the provided LabelMatchersKey.
+func (c *DiskIndexCache) StoreExpandedPostings(userID string, blockID ulid.ULID, key LabelMatchersKey, postingsSelectionStrategy string, v []byte) {
+	c.set(cacheTypeExpandedPostings, expandedPostingsCacheKey(userID, blockID, key, postingsSelectionStrategy), v)
+}
+
+// FetchExpandedPostings fetches the encoded result of ExpandedPostings for specified matchers identified by the provided LabelMatchersKey.
+func (c *DiskIndexCache) FetchExpandedPostings(_ context.Context, userID string, blockID ulid.ULID, key LabelMatchersKey, postingsSelectionStrategy string) ([]byte, bool) {
+	return c.get(cacheTypeExpandedPostings, expandedPostingsCacheKey(userID, blockID, key, postingsSelectionStrategy))
+}
+
+// StoreSeriesForPostings stores a series set for the provided postings.
+func (c *DiskIndexCache) StoreSeriesForPostings(userID string, blockID ulid.ULID, shard *sharding.ShardSelector, postingsKey PostingsKey, v []byte) {
+	c.set(cacheTypeSeriesForPostings, seriesForPostingsCacheKey(userID, blockID, shard, postingsKey), v)
+}
+
+// FetchSeriesForPostings fetches a series set for the provided postings.
+func (c *DiskIndexCache) FetchSeriesForPostings(_ context.Context, userID string, blockID ulid.ULID, shard *sharding.ShardSelector, postingsKey PostingsKey) ([]byte, bool) {
+	return c.get(cacheTypeSeriesForPostings, seriesForPostingsCacheKey(userID, blockID, shard, postingsKey))
+}
+
+// StoreLabelNames stores the result of a LabelNames() call.
+func (c *DiskIndexCache) StoreLabelNames(userID string, blockID ulid.ULID, matchersKey LabelMatchersKey, v []byte) {
+	c.set(cacheTypeLabelNames, labelNamesCacheKey(userID, blockID, matchersKey), v)
+}
+
+// FetchLabelNames fetches the result of a LabelNames() call.
+func (c *DiskIndexCache) FetchLabelNames(_ context.Context, userID string, blockID ulid.ULID, matchersKey LabelMatchersKey) ([]byte, bool) {
+	return c.get(cacheTypeLabelNames, labelNamesCacheKey(userID, blockID, matchersKey))
+}
+
+// StoreLabelValues stores the result of a LabelValues() call.
+func (c *DiskIndexCache) StoreLabelValues(userID string, blockID ulid.ULID, labelName string, matchersKey LabelMatchersKey, v []byte) {
+	c.set(cacheTypeLabelValues, labelValuesCacheKey(userID, blockID, labelName, matchersKey), v)
+}
+
+// FetchLabelValues fetches the result of a LabelValues() call.
+func (c *DiskIndexCache) FetchLabelValues(_ context.Context, userID string, blockID ulid.ULID, labelName string, matchersKey LabelMatchersKey) ([]byte, bool) {
+	return c.get(cacheTypeLabelValues, labelValuesCacheKey(userID, blockID, labelName, matchersKey))
+}
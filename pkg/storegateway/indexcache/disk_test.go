@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package indexcache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/sharding"
+)
+
+func newTestDiskIndexCache(t *testing.T, dir string, maxSize uint64) *DiskIndexCache {
+	c, err := NewDiskIndexCache(log.NewNopLogger(), prometheus.NewPedanticRegistry(), DiskIndexCacheConfig{
+		Dir:         dir,
+		MaxSize:     maxSize,
+		MaxItemSize: maxSize,
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func TestDiskIndexCache_StoreAndFetch(t *testing.T) {
+	ctx := context.Background()
+	user := "tenant"
+	blockID := ulid.MustNew(1, nil)
+	c := newTestDiskIndexCache(t, t.TempDir(), 1024*1024)
+
+	// Postings.
+	lbl1 := labels.Label{Name: "foo", Value: "bar"}
+	lbl2 := labels.Label{Name: "foo", Value: "baz"}
+	c.StorePostings(user, blockID, lbl1, []byte("postings-1"))
+	testFetchMultiPostings(ctx, t, c, user, blockID, []labels.Label{lbl1, lbl2}, map[labels.Label][]byte{lbl1: []byte("postings-1")})
+
+	// The items of another tenant are not returned.
+	testFetchMultiPostings(ctx, t, c, "another", blockID, []labels.Label{lbl1}, map[labels.Label][]byte{})
+
+	// Series for refs.
+	c.StoreSeriesForRef(user, blockID, 1, []byte("series-1"))
+	hits, misses := c.FetchMultiSeriesForRefs(ctx, user, blockID, []storage.SeriesRef{1, 2})
+	assert.Equal(t, map[storage.SeriesRef][]byte{1: []byte("series-1")}, hits)
+	assert.Equal(t, []storage.SeriesRef{2}, misses)
+
+	// Expanded postings.
+	matchersKey := CanonicalLabelMatchersKey([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "foo", "bar")})
+	c.StoreExpandedPostings(user, blockID, matchersKey, "strategy", []byte("expanded"))
+	assertIndexCacheItem(t, []byte("expanded"))(c.FetchExpandedPostings(ctx, user, blockID, matchersKey, "strategy"))
+	assertIndexCacheItem(t, nil)(c.FetchExpandedPostings(ctx, user, blockID, matchersKey, "another-strategy"))
+
+	// Series for postings.
+	shard := &sharding.ShardSelector{ShardIndex: 1, ShardCount: 2}
+	postingsKey := CanonicalPostingsKey([]storage.SeriesRef{1, 2})
+	c.StoreSeriesForPostings(user, blockID, shard, postingsKey, []byte("series-for-postings"))
+	assertIndexCacheItem(t, []byte("series-for-postings"))(c.FetchSeriesForPostings(ctx, user, blockID, shard, postingsKey))
+	assertIndexCacheItem(t, nil)(c.FetchSeriesForPostings(ctx, user, blockID, nil, postingsKey))
+
+	// Label names and values.
+	c.StoreLabelNames(user, blockID, matchersKey, []byte("names"))
+	assertIndexCacheItem(t, []byte("names"))(c.FetchLabelNames(ctx, user, blockID, matchersKey))
+	c.StoreLabelValues(user, blockID, "foo", matchersKey, []byte("values"))
+	assertIndexCacheItem(t, []byte("values"))(c.FetchLabelValues(ctx, user, blockID, "foo", matchersKey))
+	assertIndexCacheItem(t, nil)(c.FetchLabelValues(ctx, user, blockID, "bar", matchersKey))
+
+	// Storing an existing item doesn't update it.
+	c.StorePostings(user, blockID, lbl1, []byte("postings-2"))
+	testFetchMultiPostings(ctx, t, c, user, blockID, []labels.Label{lbl1}, map[labels.Label][]byte{lbl1: []byte("postings-1")})
+
+	assert.Equal(t, float64(1), promtest.ToFloat64(c.added.WithLabelValues(cacheTypePostings)))
+	assert.Equal(t, float64(2), promtest.ToFloat64(c.hits.WithLabelValues(cacheTypePostings)))
+	assert.Equal(t, float64(4), promtest.ToFloat64(c.requests.WithLabelValues(cacheTypePostings)))
+	assert.Equal(t, float64(0), promtest.ToFloat64(c.failures))
+}
+
+func TestDiskIndexCache_Eviction(t *testing.T) {
+	ctx := context.Background()
+	user := "tenant"
+	blockID := ulid.MustNew(1, nil)
+	lbl1 := labels.Label{Name: "foo", Value: "1"}
+	lbl2 := labels.Label{Name: "foo", Value: "2"}
+	lbl3 := labels.Label{Name: "foo", Value: "3"}
+	value := make([]byte, 100)
+
+	itemSize := uint64(diskItemOverhead + len(postingsCacheKey(user, blockID.String(), lbl1)) + len(value))
+	dir := t.TempDir()
+	c := newTestDiskIndexCache(t, dir, 2*itemSize)
+
+	c.StorePostings(user, blockID, lbl1, value)
+	c.StorePostings(user, blockID, lbl2, value)
+	assert.Equal(t, 2*itemSize, c.curSize)
+
+	// The least recently used item is evicted.
+	testFetchMultiPostings(ctx, t, c, user, blockID, []labels.Label{lbl1}, map[labels.Label][]byte{lbl1: value})
+	c.StorePostings(user, blockID, lbl3, value)
+	testFetchMultiPostings(ctx, t, c, user, blockID, []labels.Label{lbl1, lbl2, lbl3}, map[labels.Label][]byte{lbl1: value, lbl3: value})
+
+	assert.Equal(t, 2*itemSize, c.curSize)
+	assert.Equal(t, float64(1), promtest.ToFloat64(c.evicted))
+	assert.Equal(t, 2, countDiskItemFiles(t, dir))
+
+	// Items bigger than the max item size are not stored.
+	c.StorePostings(user, blockID, labels.Label{Name: "foo", Value: "4"}, make([]byte, 2*itemSize))
+	assert.Equal(t, float64(1), promtest.ToFloat64(c.overflow.WithLabelValues(cacheTypePostings)))
+	assert.Equal(t, 2, countDiskItemFiles(t, dir))
+}
+
+func TestDiskIndexCache_ShouldLoadItemsOnStartup(t *testing.T) {
+	ctx := context.Background()
+	user := "tenant"
+	blockID := ulid.MustNew(1, nil)
+	lbl1 := labels.Label{Name: "foo", Value: "1"}
+	lbl2 := labels.Label{Name: "foo", Value: "2"}
+	lbl3 := labels.Label{Name: "foo", Value: "3"}
+	value := make([]byte, 100)
+
+	itemSize := uint64(diskItemOverhead + len(postingsCacheKey(user, blockID.String(), lbl1)) + len(value))
+	dir := t.TempDir()
+	c := newTestDiskIndexCache(t, dir, 3*itemSize)
+
+	c.StorePostings(user, blockID, lbl1, value)
+	c.StorePostings(user, blockID, lbl2, value)
+	c.StorePostings(user, blockID, lbl3, value)
+
+	// Make the item files have different modification times, the first item being the oldest one.
+	now := time.Now()
+	for i, lbl := range []labels.Label{lbl1, lbl2, lbl3} {
+		path := c.itemPath(diskItemName(postingsCacheKey(user, blockID.String(), lbl)))
+		modTime := now.Add(time.Duration(i-3) * time.Minute)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	// A temporary file left by a crash is removed.
+	tmpFile := filepath.Join(dir, "00", "leftover"+diskItemTmpSuffix)
+	require.NoError(t, os.MkdirAll(filepath.Dir(tmpFile), os.ModePerm))
+	require.NoError(t, os.WriteFile(tmpFile, value, os.ModePerm))
+
+	// The cache is reopened with a lower max size, so the oldest item is evicted.
+	c = newTestDiskIndexCache(t, dir, 2*itemSize)
+	assert.Equal(t, 2*itemSize, c.curSize)
+	assert.Equal(t, 2, c.lru.Len())
+	assert.Equal(t, 2, countDiskItemFiles(t, dir))
+	assert.NoFileExists(t, tmpFile)
+
+	testFetchMultiPostings(ctx, t, c, user, blockID, []labels.Label{lbl1, lbl2, lbl3}, map[labels.Label][]byte{lbl2: value, lbl3: value})
+}
+
+func TestDiskIndexCache_ShouldDiscardCorruptedItems(t *testing.T) {
+	ctx := context.Background()
+	user := "tenant"
+	blockID := ulid.MustNew(1, nil)
+	lbl := labels.Label{Name: "foo", Value: "bar"}
+
+	tests := map[string]func(data []byte) []byte{
+		"truncated file": func(data []byte) []byte {
+			return data[:len(data)-1]
+		},
+		"corrupted value": func(data []byte) []byte {
+			data[len(data)-5] ^= 0xff
+			return data
+		},
+		"empty file": func([]byte) []byte {
+			return nil
+		},
+	}
+
+	for testName, corrupt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			dir := t.TempDir()
+			c := newTestDiskIndexCache(t, dir, 1024*1024)
+			c.StorePostings(user, blockID, lbl, []byte("postings"))
+
+			path := c.itemPath(diskItemName(postingsCacheKey(user, blockID.String(), lbl)))
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(path, corrupt(data), os.ModePerm))
+
+			testFetchMultiPostings(ctx, t, c, user, blockID, []labels.Label{lbl}, map[labels.Label][]byte{})
+			assert.Equal(t, float64(1), promtest.ToFloat64(c.failures))
+			assert.Equal(t, float64(0), promtest.ToFloat64(c.evicted))
+			assert.Equal(t, 0, c.lru.Len())
+			assert.Equal(t, uint64(0), c.curSize)
+			assert.NoFileExists(t, path)
+
+			// The item can be stored again.
+			c.StorePostings(user, blockID, lbl, []byte("postings"))
+			testFetchMultiPostings(ctx, t, c, user, blockID, []labels.Label{lbl}, map[labels.Label][]byte{lbl: []byte("postings")})
+		})
+	}
+}
+
+func TestDiskIndexCache_ShouldNotCountWriteFailuresAsEvictions(t *testing.T) {
+	ctx := context.Background()
+	user := "tenant"
+	blockID := ulid.MustNew(1, nil)
+	lbl := labels.Label{Name: "foo", Value: "bar"}
+
+	dir := t.TempDir()
+	c := newTestDiskIndexCache(t, dir, 1024*1024)
+
+	// A file in place of the item sub-directory makes the item fail to be written.
+	name := diskItemName(postingsCacheKey(user, blockID.String(), lbl))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name[:2]), nil, os.ModePerm))
+
+	c.StorePostings(user, blockID, lbl, []byte("postings"))
+	testFetchMultiPostings(ctx, t, c, user, blockID, []labels.Label{lbl}, map[labels.Label][]byte{})
+
+	// Both writing the item and removing it once discarded fail.
+	assert.Equal(t, float64(2), promtest.ToFloat64(c.failures))
+	assert.Equal(t, float64(0), promtest.ToFloat64(c.evicted))
+	assert.Equal(t, float64(0), promtest.ToFloat64(c.added.WithLabelValues(cacheTypePostings)))
+	assert.Equal(t, 0, c.lru.Len())
+	assert.Equal(t, uint64(0), c.curSize)
+}
+
+func TestDiskItemEncoding(t *testing.T) {
+	data := encodeDiskItem("key", []byte("value"))
+
+	val, err := decodeDiskItem(data, "key")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), val)
+
+	// The item is returned only for the key it has been stored with.
+	_, err = decodeDiskItem(data, "another-key")
+	assert.Error(t, err)
+
+	// Empty values are supported.
+	val, err = decodeDiskItem(encodeDiskItem("key", nil), "key")
+	require.NoError(t, err)
+	assert.Empty(t, val)
+}
+
+// assertIndexCacheItem returns a function asserting the result of fetching a single item from the cache
+// is the expected value, or a miss if the expected value is nil.
+func assertIndexCacheItem(t *testing.T, expected []byte) func([]byte, bool) {
+	return func(actual []byte, found bool) {
+		t.Helper()
+		assert.Equal(t, expected != nil, found)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func countDiskItemFiles(t *testing.T, dir string) int {
+	count := 0
+	require.NoError(t, filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return err
+	}))
+	return count
+}
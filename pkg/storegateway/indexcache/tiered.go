@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package indexcache
+
+import (
+	"context"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/grafana/mimir/pkg/storage/sharding"
+)
+
+// TieredIndexCache is an index cache composed of two caches: items are fetched from the first tier, and the
+// items missing from the first tier are fetched from the second one. Items found in the second tier are
+// stored in the first one, and new items are stored in both tiers.
+type TieredIndexCache struct {
+	first  IndexCache
+	second IndexCache
+}
+
+// NewTieredIndexCache makes a new TieredIndexCache. The first tier is expected to be the faster
+// and smaller one, for example an in-memory cache in front of a disk cache.
+func NewTieredIndexCache(first, second IndexCache) *TieredIndexCache {
+	return &TieredIndexCache{
+		first:  first,
+		second: second,
+	}
+}
+
+// StorePostings stores postings for a single series.
+func (c *TieredIndexCache) StorePostings(userID string, blockID ulid.ULID, l labels.Label, v []byte) {
+	c.first.StorePostings(userID, blockID, l, v)
+	c.second.StorePostings(userID, blockID, l, v)
+}
+
+// FetchMultiPostings fetches multiple postings - each identified by a label.
+func (c *TieredIndexCache) FetchMultiPostings(ctx context.Context, userID string, blockID ulid.ULID, keys []labels.Label) BytesResult {
+	hits := make(map[labels.Label][]byte, len(keys))
+	var misses []labels.Label
+
+	firstResult := c.first.FetchMultiPostings(ctx, userID, blockID, keys)
+	for i := 0; ; i++ {
+		b, ok := firstResult.Next()
+		if !ok {
+			break
+		}
+		if b != nil {
+			hits[keys[i]] = b
+		} else {
+			misses = append(misses, keys[i])
+		}
+	}
+
+	if len(misses) > 0 {
+		secondResult := c.second.FetchMultiPostings(ctx, userID, blockID, misses)
+		for i := 0; ; i++ {
+			b, ok := secondResult.Next()
+			if !ok {
+				break
+			}
+			if b != nil {
+				hits[misses[i]] = b
+				c.first.StorePostings(userID, blockID, misses[i], b)
+			}
+		}
+	}
+
+	return &MapIterator[labels.Label]{
+		Keys: keys,
+		M:    hits,
+	}
+}
+
+// StoreSeriesForRef stores a single series.
+func (c *TieredIndexCache) StoreSeriesForRef(userID string, blockID ulid.ULID, id storage.SeriesRef, v []byte) {
+	c.first.StoreSeriesForRef(userID, blockID, id, v)
+	c.second.StoreSeriesForRef(userID, blockID, id, v)
+}
+
+// FetchMultiSeriesForRefs fetches multiple series - each identified by ID - from the cache
+// and returns a map containing cache hits, along with a list of missing IDs.
+func (c *TieredIndexCache) FetchMultiSeriesForRefs(ctx context.Context, userID string, blockID ulid.ULID, ids []storage.SeriesRef) (hits map[storage.SeriesRef][]byte, misses []storage.SeriesRef) {
+	hits, misses = c.first.FetchMultiSeriesForRefs(ctx, userID, blockID, ids)
+	if len(misses) == 0 {
+		return hits, misses
+	}
+
+	secondHits, misses := c.second.FetchMultiSeriesForRefs(ctx, userID, blockID, misses)
+	for id, b := range secondHits {
+		hits[id] = b
+		c.first.StoreSeriesForRef(userID, blockID, id, b)
+	}
+	return hits, misses
+}
+
+// StoreExpandedPostings stores the result of ExpandedPostings, encoded with an unspecified codec.
+func (c *TieredIndexCache) StoreExpandedPostings(userID string, blockID ulid.ULID, key LabelMatchersKey, postingsSelectionStrategy string, v []byte) {
+	c.first.StoreExpandedPostings(userID, blockID, key, postingsSelectionStrategy, v)
+	c.second.StoreExpandedPostings(userID, blockID, key, postingsSelectionStrategy, v)
+}
+
+// FetchExpandedPostings fetches the result of ExpandedPostings, encoded with an unspecified codec.
+func (c *TieredIndexCache) FetchExpandedPostings(ctx context.Context, userID string, blockID ulid.ULID, key LabelMatchersKey, postingsSelectionStrategy string) ([]byte, bool) {
+	if b, ok := c.first.FetchExpandedPostings(ctx, userID, blockID, key, postingsSelectionStrategy); ok {
+		return b, true
+	}
+	b, ok := c.second.FetchExpandedPostings(ctx, userID, blockID, key, postingsSelectionStrategy)
+	if ok {
+		c.first.StoreExpandedPostings(userID, blockID, key, postingsSelectionStrategy, b)
+	}
+	return b, ok
+}
+
+// StoreSeriesForPostings stores a series set for the provided postings.
+func (c *TieredIndexCache) StoreSeriesForPostings(userID string, blockID ulid.ULID, shard *sharding.ShardSelector, postingsKey PostingsKey, v []byte) {
+	c.first.StoreSeriesForPostings(userID, blockID, shard, postingsKey, v)
+	c.second.StoreSeriesForPostings(userID, blockID, shard, postingsKey, v)
+}
+
+// FetchSeriesForPostings fetches a series set for the provided postings.
+func (c *TieredIndexCache) FetchSeriesForPostings(ctx context.Context, userID string, blockID ulid.ULID, shard *sharding.ShardSelector, postingsKey PostingsKey) ([]byte, bool) {
+	if b, ok := c.first.FetchSeriesForPostings(ctx, userID, blockID, shard, postingsKey); ok {
+		return b, true
+	}
+	b, ok := c.second.FetchSeriesForPostings(ctx, userID, blockID, shard, postingsKey)
+	if ok {
+		c.first.StoreSeriesForPostings(userID, blockID, shard, postingsKey, b)
+	}
+	return b, ok
+}
+
+// StoreLabelNames stores the result of a LabelNames() call.
+func (c *TieredIndexCache) StoreLabelNames(userID string, blockID ulid.ULID, matchersKey LabelMatchersKey, v []byte) {
+	c.first.StoreLabelNames(userID, blockID, matchersKey, v)
+	c.second.StoreLabelNames(userID, blockID, matchersKey, v)
+}
+
+// FetchLabelNames fetches the result of a LabelNames() call.
+func (c *TieredIndexCache) FetchLabelNames(ctx context.Context, userID string, blockID ulid.ULID, matchersKey LabelMatchersKey) ([]byte, bool) {
+	if b, ok := c.first.FetchLabelNames(ctx, userID, blockID, matchersKey); ok {
+		return b, true
+	}
+	b, ok := c.second.FetchLabelNames(ctx, userID, blockID, matchersKey)
+	if ok {
+		c.first.StoreLabelNames(userID, blockID, matchersKey, b)
+	}
+	return b, ok
+}
+
+// StoreLabelValues stores the result of a LabelValues() call.
+func (c *TieredIndexCache) StoreLabelValues(userID string, blockID ulid.ULID, labelName string, matchersKey LabelMatchersKey, v []byte) {
+	c.first.StoreLabelValues(userID, blockID, labelName, matchersKey, v)
+	c.second.StoreLabelValues(userID, blockID, labelName, matchersKey, v)
+}
+
+// FetchLabelValues fetches the result of a LabelValues() call.
+func (c *TieredIndexCache) FetchLabelValues(ctx context.Context, userID string, blockID ulid.ULID, labelName string, matchersKey LabelMatchersKey) ([]byte, bool) {
+	if b, ok := c.first.FetchLabelValues(ctx, userID, blockID, labelName, matchersKey); ok {
+		return b, true
+	}
+	b, ok := c.second.FetchLabelValues(ctx, userID, blockID, labelName, matchersKey)
+	if ok {
+		c.first.StoreLabelValues(userID, blockID, labelName, matchersKey, b)
+	}
+	return b, ok
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package indexcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredIndexCache(t *testing.T) {
+	ctx := context.Background()
+	user := "tenant"
+	blockID := ulid.MustNew(1, nil)
+
+	newInMemoryCache := func() *InMemoryIndexCache {
+		c, err := NewInMemoryIndexCacheWithConfig(log.NewNopLogger(), prometheus.NewPedanticRegistry(), DefaultInMemoryIndexCacheConfig)
+		require.NoError(t, err)
+		return c
+	}
+	first := newInMemoryCache()
+	second := newTestDiskIndexCache(t, t.TempDir(), 1024*1024)
+	c := NewTieredIndexCache(first, second)
+
+	lbl1 := labels.Label{Name: "foo", Value: "1"}
+	lbl2 := labels.Label{Name: "foo", Value: "2"}
+	lbl3 := labels.Label{Name: "foo", Value: "3"}
+
+	// Items are stored in both tiers.
+	c.StorePostings(user, blockID, lbl1, []byte("postings-1"))
+	testFetchMultiPostings(ctx, t, first, user, blockID, []labels.Label{lbl1}, map[labels.Label][]byte{lbl1: []byte("postings-1")})
+	testFetchMultiPostings(ctx, t, second, user, blockID, []labels.Label{lbl1}, map[labels.Label][]byte{lbl1: []byte("postings-1")})
+
+	// Items missing from the first tier are fetched from the second one, and stored in the first one.
+	second.StorePostings(user, blockID, lbl2, []byte("postings-2"))
+	testFetchMultiPostings(ctx, t, c, user, blockID, []labels.Label{lbl1, lbl2, lbl3}, map[labels.Label][]byte{lbl1: []byte("postings-1"), lbl2: []byte("postings-2")})
+	testFetchMultiPostings(ctx, t, first, user, blockID, []labels.Label{lbl2}, map[labels.Label][]byte{lbl2: []byte("postings-2")})
+
+	c.StoreSeriesForRef(user, blockID, 1, []byte("series-1"))
+	second.StoreSeriesForRef(user, blockID, 2, []byte("series-2"))
+	hits, misses := c.FetchMultiSeriesForRefs(ctx, user, blockID, []storage.SeriesRef{1, 2, 3})
+	assert.Equal(t, map[storage.SeriesRef][]byte{1: []byte("series-1"), 2: []byte("series-2")}, hits)
+	assert.Equal(t, []storage.SeriesRef{3}, misses)
+	hits, misses = first.FetchMultiSeriesForRefs(ctx, user, blockID, []storage.SeriesRef{2})
+	assert.Equal(t, map[storage.SeriesRef][]byte{2: []byte("series-2")}, hits)
+	assert.Empty(t, misses)
+
+	matchersKey := CanonicalLabelMatchersKey([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "foo", "bar")})
+	second.StoreLabelNames(user, blockID, matchersKey, []byte("names"))
+	assertIndexCacheItem(t, []byte("names"))(c.FetchLabelNames(ctx, user, blockID, matchersKey))
+	assertIndexCacheItem(t, []byte("names"))(first.FetchLabelNames(ctx, user, blockID, matchersKey))
+	assertIndexCacheItem(t, nil)(c.FetchLabelValues(ctx, user, blockID, "foo", matchersKey))
+}
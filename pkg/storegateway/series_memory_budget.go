@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storegateway/storepb"
+	util_math "github.com/grafana/mimir/pkg/util/math"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// seriesMemoryBudget is a store-gateway-wide budget of the memory used by the in-flight Series() requests.
+// Each request reserves its estimated memory from the budget before fetching the series and chunks, and
+// releases it once done.
+type seriesMemoryBudget struct {
+	limit        int64
+	queueTimeout time.Duration
+	sem          *semaphore.Weighted
+
+	reservedBytes      prometheus.Gauge
+	reservedBytesTotal prometheus.Counter
+	rejectedBytes      prometheus.Counter
+	rejectedRequests   prometheus.Counter
+}
+
+// newSeriesMemoryBudget makes a new seriesMemoryBudget. The requests wait up to queueTimeout for the memory
+// to be released by the other requests, or are rejected straight away if queueTimeout is 0.
+func newSeriesMemoryBudget(limit uint64, queueTimeout time.Duration, reg prometheus.Registerer) *seriesMemoryBudget {
+	return &seriesMemoryBudget{
+		limit:        int64(limit),
+		queueTimeout: queueTimeout,
+		sem:          semaphore.NewWeighted(int64(limit)),
+
+		reservedBytes: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_bucket_stores_series_memory_reserved_bytes",
+			Help: "Estimated memory currently reserved from the series memory budget by the in-flight Series() requests.",
+		}),
+		reservedBytesTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_stores_series_memory_reserved_bytes_total",
+			Help: "Total estimated memory reserved from the series memory budget by the admitted Series() requests.",
+		}),
+		rejectedBytes: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_stores_series_memory_rejected_bytes_total",
+			Help: "Total estimated memory of the Series() requests rejected because the series memory budget was exhausted.",
+		}),
+		rejectedRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_stores_series_memory_rejected_requests_total",
+			Help: "Total number of Series() requests rejected because the series memory budget was exhausted.",
+		}),
+	}
+}
+
+// reserve reserves the estimated bytes from the budget, waiting up to the queue timeout for them to be available.
+// A request estimated to use more than the whole budget reserves the whole budget. The returned function releases
+// the reserved bytes. The returned error has the ResourceExhausted code if the budget is exhausted, so that the
+// querier retries the request on another store-gateway.
+func (b *seriesMemoryBudget) reserve(ctx context.Context, bytes int64) (func(), error) {
+	reserved := util_math.Min(util_math.Max(bytes, 1), b.limit)
+
+	if b.queueTimeout <= 0 {
+		if !b.sem.TryAcquire(reserved) {
+			return nil, b.reject(bytes)
+		}
+	} else {
+		queueCtx, cancel := context.WithTimeout(ctx, b.queueTimeout)
+		err := b.sem.Acquire(queueCtx, reserved)
+		cancel()
+
+		if err != nil {
+			// Don't count the requests canceled by the caller as rejected.
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, b.reject(bytes)
+		}
+	}
+
+	b.reservedBytes.Add(float64(reserved))
+	b.reservedBytesTotal.Add(float64(reserved))
+
+	return func() {
+		b.sem.Release(reserved)
+		b.reservedBytes.Sub(float64(reserved))
+	}, nil
+}
+
+func (b *seriesMemoryBudget) reject(bytes int64) error {
+	b.rejectedRequests.Inc()
+	b.rejectedBytes.Add(float64(bytes))
+	return status.Error(codes.ResourceExhausted, fmt.Sprintf("the store-gateway series memory budget of %d bytes is exhausted (estimated request memory: %d bytes)", b.limit, bytes))
+}
+
+// reserveSeriesMemory reserves the estimated memory of the Series() request from the store-gateway's series memory budget.
+func (s *BucketStore) reserveSeriesMemory(ctx context.Context, blocks []*bucketBlock, matchers []*labels.Matcher, req *storepb.SeriesRequest) (func(), error) {
+	estimated, err := estimateSeriesRequestMemory(blocks, matchers, req.MinTime, req.MaxTime, req.SkipChunks, s.maxSeriesPerBatch)
+	if err != nil {
+		return nil, errors.Wrap(err, "estimate series request memory")
+	}
+
+	span, spanCtx := opentracing.StartSpanFromContext(ctx, "store_series_memory_budget_reserve")
+	span.SetTag("estimated_bytes", estimated)
+	release, err := s.seriesMemoryBudget.reserve(spanCtx, estimated)
+	span.Finish()
+	if err != nil {
+		level.Warn(spanlogger.FromContext(ctx, s.logger)).Log("msg", "failed to reserve series memory", "estimated_bytes", estimated, "err", err)
+		return nil, err
+	}
+	return release, nil
+}
+
+// estimateSeriesRequestMemory estimates the memory used by a Series() request before fetching any data.
+// For each block, the estimate includes the size of the posting lists of the matchers, looked up in the
+// index-header, and the size of a batch of at most maxSeriesPerBatch series with their chunks in the
+// requested time range, because series and chunks are fetched in batches.
+func estimateSeriesRequestMemory(blocks []*bucketBlock, matchers []*labels.Matcher, minT, maxT int64, skipChunks bool, maxSeriesPerBatch int) (int64, error) {
+	var total int64
+
+	for _, b := range blocks {
+		groups, err := toPostingGroups(matchers, b.indexHeaderReader)
+		if err != nil {
+			return 0, err
+		}
+		if len(groups) == 0 {
+			// The block has no series matching the request.
+			continue
+		}
+
+		sort.Slice(groups, func(i, j int) bool {
+			return groups[i].totalSize < groups[j].totalSize
+		})
+
+		var postingsSize int64
+		for _, g := range groups {
+			if len(g.keys) == 1 && g.keys[0] == allPostingsKey {
+				// The size of the all-postings list isn't looked up.
+				postingsSize += int64(b.meta.Stats.NumSeries) * tsdb.BytesPerPostingInAPostingList
+				continue
+			}
+			postingsSize += g.totalSize
+		}
+
+		numSeries := numSeriesInSmallestIntersectingPostingGroup(groups)
+		if numSeries == 0 {
+			// The request selects all the series of the block.
+			numSeries = int64(b.meta.Stats.NumSeries)
+		}
+		numSeries = util_math.Min(numSeries, int64(maxSeriesPerBatch))
+
+		seriesSize := int64(tsdb.EstimatedSeriesP99Size)
+		if !skipChunks {
+			seriesSize += estimateChunksPerSeries(b.meta, minT, maxT) * estimateChunkSize(b.meta)
+		}
+
+		total += postingsSize + numSeries*seriesSize
+	}
+
+	return total, nil
+}
+
+// estimateChunksPerSeries estimates the number of chunks of each series of the block within the time range,
+// assuming the chunks are evenly distributed over the block's time range.
+func estimateChunksPerSeries(meta *block.Meta, minT, maxT int64) int64 {
+	chunks := int64(1)
+	if meta.Stats.NumSeries > 0 && meta.Stats.NumChunks > meta.Stats.NumSeries {
+		chunks = int64((meta.Stats.NumChunks + meta.Stats.NumSeries - 1) / meta.Stats.NumSeries)
+	}
+
+	blockRange := meta.MaxTime - meta.MinTime
+	requestRange := util_math.Min(maxT, meta.MaxTime) - util_math.Max(minT, meta.MinTime)
+	if blockRange <= 0 || requestRange >= blockRange {
+		return chunks
+	}
+
+	return util_math.Max(1, (chunks*requestRange+blockRange-1)/blockRange)
+}
+
+// estimateChunkSize estimates the average size of the chunks of the block from the size of its segment files,
+// when known.
+func estimateChunkSize(meta *block.Meta) int64 {
+	var segmentsSize int64
+	for _, f := range meta.Thanos.Files {
+		if strings.HasPrefix(f.RelPath, block.ChunksDirname+"/") {
+			segmentsSize += f.SizeBytes
+		}
+	}
+
+	if segmentsSize <= 0 || meta.Stats.NumChunks == 0 {
+		return tsdb.EstimatedMaxChunkSize
+	}
+	return util_math.Max(1, segmentsSize/int64(meta.Stats.NumChunks))
+}
@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/util/test"
+)
+
+func TestSeriesMemoryBudget_Reserve(t *testing.T) {
+	t.Run("should reject the request straight away if the queue timeout is 0", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		budget := newSeriesMemoryBudget(100, 0, reg)
+
+		release, err := budget.reserve(context.Background(), 60)
+		require.NoError(t, err)
+
+		_, err = budget.reserve(context.Background(), 50)
+		assertResourceExhausted(t, err)
+
+		release()
+
+		release, err = budget.reserve(context.Background(), 50)
+		require.NoError(t, err)
+		release()
+
+		assert.NoError(t, prom_testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_bucket_stores_series_memory_reserved_bytes Estimated memory currently reserved from the series memory budget by the in-flight Series() requests.
+			# TYPE cortex_bucket_stores_series_memory_reserved_bytes gauge
+			cortex_bucket_stores_series_memory_reserved_bytes 0
+			# HELP cortex_bucket_stores_series_memory_reserved_bytes_total Total estimated memory reserved from the series memory budget by the admitted Series() requests.
+			# TYPE cortex_bucket_stores_series_memory_reserved_bytes_total counter
+			cortex_bucket_stores_series_memory_reserved_bytes_total 110
+			# HELP cortex_bucket_stores_series_memory_rejected_bytes_total Total estimated memory of the Series() requests rejected because the series memory budget was exhausted.
+			# TYPE cortex_bucket_stores_series_memory_rejected_bytes_total counter
+			cortex_bucket_stores_series_memory_rejected_bytes_total 50
+			# HELP cortex_bucket_stores_series_memory_rejected_requests_total Total number of Series() requests rejected because the series memory budget was exhausted.
+			# TYPE cortex_bucket_stores_series_memory_rejected_requests_total counter
+			cortex_bucket_stores_series_memory_rejected_requests_total 1
+		`)))
+	})
+
+	t.Run("should queue the request until the memory is released", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		budget := newSeriesMemoryBudget(100, time.Minute, reg)
+
+		release, err := budget.reserve(context.Background(), 60)
+		require.NoError(t, err)
+
+		done := make(chan error)
+		go func() {
+			release, err := budget.reserve(context.Background(), 50)
+			if err == nil {
+				release()
+			}
+			done <- err
+		}()
+
+		select {
+		case <-done:
+			require.FailNow(t, "the request should be queued")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		release()
+		require.NoError(t, <-done)
+		assert.Equal(t, float64(0), prom_testutil.ToFloat64(budget.reservedBytes))
+		assert.Equal(t, float64(0), prom_testutil.ToFloat64(budget.rejectedRequests))
+	})
+
+	t.Run("should reject the request once the queue timeout expires", func(t *testing.T) {
+		budget := newSeriesMemoryBudget(100, 100*time.Millisecond, nil)
+
+		release, err := budget.reserve(context.Background(), 100)
+		require.NoError(t, err)
+		defer release()
+
+		_, err = budget.reserve(context.Background(), 1)
+		assertResourceExhausted(t, err)
+		assert.Equal(t, float64(1), prom_testutil.ToFloat64(budget.rejectedRequests))
+	})
+
+	t.Run("should not reject the request canceled while queued", func(t *testing.T) {
+		budget := newSeriesMemoryBudget(100, time.Minute, nil)
+
+		release, err := budget.reserve(context.Background(), 100)
+		require.NoError(t, err)
+		defer release()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = budget.reserve(ctx, 1)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, float64(0), prom_testutil.ToFloat64(budget.rejectedRequests))
+	})
+
+	t.Run("should reserve the whole budget for a request estimated to use more than the budget", func(t *testing.T) {
+		budget := newSeriesMemoryBudget(100, 0, nil)
+
+		release, err := budget.reserve(context.Background(), 1000)
+		require.NoError(t, err)
+		assert.Equal(t, float64(100), prom_testutil.ToFloat64(budget.reservedBytes))
+
+		_, err = budget.reserve(context.Background(), 1)
+		assertResourceExhausted(t, err)
+
+		release()
+		assert.Equal(t, float64(0), prom_testutil.ToFloat64(budget.reservedBytes))
+	})
+}
+
+func TestEstimateSeriesRequestMemory(t *testing.T) {
+	const numSeries = 10000
+
+	b := prepareTestBlock(test.NewTB(t), appendTestSeries(numSeries))()
+	b.meta.Stats.NumSeries = numSeries
+
+	// The posting list of p="foo" has 2000 series, and a 4 bytes header.
+	const pFooPostingsSize = 2000*mimir_tsdb.BytesPerPostingInAPostingList + 4
+
+	tests := map[string]struct {
+		matchers          []*labels.Matcher
+		skipChunks        bool
+		maxSeriesPerBatch int
+		expected          int64
+	}{
+		"no series matching the request": {
+			matchers:          []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "p", "non-existent")},
+			skipChunks:        true,
+			maxSeriesPerBatch: 5000,
+			expected:          0,
+		},
+		"series without chunks": {
+			matchers:          []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "p", "foo")},
+			skipChunks:        true,
+			maxSeriesPerBatch: 5000,
+			expected:          pFooPostingsSize + 2000*mimir_tsdb.EstimatedSeriesP99Size,
+		},
+		"series with chunks": {
+			matchers:          []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "p", "foo")},
+			maxSeriesPerBatch: 5000,
+			expected:          pFooPostingsSize + 2000*(mimir_tsdb.EstimatedSeriesP99Size+mimir_tsdb.EstimatedMaxChunkSize),
+		},
+		"series limited by the batch size": {
+			matchers:          []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "p", "foo")},
+			skipChunks:        true,
+			maxSeriesPerBatch: 100,
+			expected:          pFooPostingsSize + 100*mimir_tsdb.EstimatedSeriesP99Size,
+		},
+		"all series minus the series of the subtracting matcher": {
+			matchers:          []*labels.Matcher{labels.MustNewMatcher(labels.MatchNotEqual, "p", "foo")},
+			skipChunks:        true,
+			maxSeriesPerBatch: 100,
+			expected:          numSeries*mimir_tsdb.BytesPerPostingInAPostingList + pFooPostingsSize + 100*mimir_tsdb.EstimatedSeriesP99Size,
+		},
+	}
+
+	for name, testCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := estimateSeriesRequestMemory([]*bucketBlock{b}, testCase.matchers, b.meta.MinTime, b.meta.MaxTime, testCase.skipChunks, testCase.maxSeriesPerBatch)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+}
+
+func TestEstimateChunksPerSeries(t *testing.T) {
+	meta := &block.Meta{BlockMeta: tsdb.BlockMeta{
+		MinTime: 0,
+		MaxTime: 100,
+		Stats:   tsdb.BlockStats{NumSeries: 10, NumChunks: 100},
+	}}
+
+	assert.Equal(t, int64(10), estimateChunksPerSeries(meta, 0, 100))
+	assert.Equal(t, int64(10), estimateChunksPerSeries(meta, -100, 200))
+	assert.Equal(t, int64(5), estimateChunksPerSeries(meta, 50, 200))
+	assert.Equal(t, int64(1), estimateChunksPerSeries(meta, 99, 100))
+	assert.Equal(t, int64(1), estimateChunksPerSeries(&block.Meta{}, 0, 100))
+}
+
+func TestEstimateChunkSize(t *testing.T) {
+	meta := &block.Meta{
+		BlockMeta: tsdb.BlockMeta{Stats: tsdb.BlockStats{NumSeries: 10, NumChunks: 100}},
+		Thanos: block.ThanosMeta{Files: []block.File{
+			{RelPath: "chunks/000001", SizeBytes: 10000},
+			{RelPath: "chunks/000002", SizeBytes: 5000},
+			{RelPath: block.IndexFilename, SizeBytes: 100000},
+		}},
+	}
+	assert.Equal(t, int64(150), estimateChunkSize(meta))
+
+	// The chunk size is unknown if the block files aren't listed in the meta.
+	assert.Equal(t, int64(mimir_tsdb.EstimatedMaxChunkSize), estimateChunkSize(&block.Meta{}))
+}
+
+func assertResourceExhausted(t *testing.T, err error) {
+	require.Error(t, err)
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+}
@@ -25,6 +25,7 @@ const (
 	SeriesLabelsNotSorted         ID = "labels-not-sorted"
 	SampleTooFarInFuture          ID = "too-far-in-future"
 	MaxSeriesPerMetric            ID = "max-series-per-metric"
+	MaxValuesPerLabelName         ID = "max-values-per-label-name"
 	MaxMetadataPerMetric          ID = "max-metadata-per-metric"
 	MaxSeriesPerUser              ID = "max-series-per-user"
 	MaxMetadataPerUser            ID = "max-metadata-per-user"
@@ -54,6 +55,7 @@ const (
 	MaxQueryLength              ID = "max-query-length"
 	MaxTotalQueryLength         ID = "max-total-query-length"
 	MaxQueryExpressionSizeBytes ID = "max-query-expression-size-bytes"
+	QueryBlocked                ID = "query-blocked"
 	RequestRateLimited          ID = "tenant-max-request-rate"
 	IngestionRateLimited        ID = "tenant-max-ingestion-rate"
 	TooManyHAClusters           ID = "tenant-too-many-ha-clusters"
@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package push
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/log"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	influxParseError         = "influx_parse_error"
+	influxNoNumericFields    = "influx_no_numeric_fields"
+	influxDuplicateLabelName = "influx_duplicate_label_name"
+
+	// influxValueField is the name of the field which is converted to a series named after the measurement only.
+	influxValueField = "value"
+)
+
+// InfluxHandler is a http.Handler which accepts InfluxDB line protocol write requests.
+func InfluxHandler(
+	maxRecvMsgSize int,
+	sourceIPs *middleware.SourceIPExtractor,
+	allowSkipLabelNameValidation bool,
+	reg prometheus.Registerer,
+	push Func,
+) http.Handler {
+	discardedDueToInfluxParseError := validation.DiscardedSamplesCounter(reg, influxParseError)
+	discardedDueToInfluxNoNumericFields := validation.DiscardedSamplesCounter(reg, influxNoNumericFields)
+	discardedDueToInfluxDuplicateLabelName := validation.DiscardedSamplesCounter(reg, influxDuplicateLabelName)
+
+	return handler(maxRecvMsgSize, sourceIPs, allowSkipLabelNameValidation, push, func(ctx context.Context, r *http.Request, maxRecvMsgSize int, dst []byte, req *mimirpb.PreallocWriteRequest) ([]byte, error) {
+		logger := log.WithContext(ctx, log.Logger)
+
+		precision, err := parseInfluxPrecision(r.URL.Query().Get("precision"))
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := readRequestBody(r, maxRecvMsgSize)
+		if err != nil {
+			return body, err
+		}
+
+		spanLog, ctx := spanlogger.NewWithLogger(ctx, logger, "Distributor.InfluxHandler.decodeAndConvert")
+		defer spanLog.Span.Finish()
+
+		spanLog.SetTag("content_encoding", r.Header.Get("Content-Encoding"))
+		spanLog.SetTag("content_length", r.ContentLength)
+
+		points, parseErrs := parseInfluxLines(body, precision, time.Now())
+		if len(parseErrs) > 0 {
+			userID, err := tenant.TenantID(ctx)
+			if err != nil {
+				return body, err
+			}
+
+			// Each discarded line is counted once. Group is empty here as metrics couldn't be parsed.
+			for _, err := range parseErrs {
+				switch {
+				case errors.Is(err, errInfluxNoNumericFields):
+					discardedDueToInfluxNoNumericFields.WithLabelValues(userID, "").Inc()
+				case errors.Is(err, errInfluxDuplicateLabelName):
+					discardedDueToInfluxDuplicateLabelName.WithLabelValues(userID, "").Inc()
+				default:
+					discardedDueToInfluxParseError.WithLabelValues(userID, "").Inc()
+				}
+			}
+
+			msg := errors.Join(parseErrs...).Error()
+			if len(msg) > maxErrMsgLen {
+				msg = msg[:maxErrMsgLen]
+			}
+
+			if len(points) == 0 {
+				return body, errors.New(msg)
+			}
+
+			level.Warn(spanLog).Log("msg", "InfluxDB line protocol parse error", "err", msg)
+		}
+
+		req.Timeseries = influxPointsToTimeseries(points)
+
+		level.Debug(spanLog).Log(
+			"msg", "InfluxDB line protocol to Prometheus conversion complete",
+			"point_count", len(points),
+			"series_count", len(req.Timeseries),
+			"discarded_lines", len(parseErrs),
+		)
+
+		return body, nil
+	})
+}
+
+// influxPointsToTimeseries converts each numeric field of the input points to a series. The series
+// is named <measurement>_<field>, or <measurement> if the field is named "value", and has a label
+// for each tag of the point. Tag and field keys are sanitized to be valid Prometheus label names.
+func influxPointsToTimeseries(points []influxPoint) []mimirpb.PreallocTimeseries {
+	out := mimirpb.PreallocTimeseriesSliceFromPool()
+
+	for _, p := range points {
+		measurement := sanitizeInfluxName(p.measurement)
+
+		for _, f := range p.fields {
+			name := measurement
+			if f.key != influxValueField {
+				name = measurement + "_" + sanitizeInfluxName(f.key)
+			}
+
+			labels := make([]mimirpb.LabelAdapter, 0, len(p.tags)+1)
+			labels = append(labels, mimirpb.LabelAdapter{Name: model.MetricNameLabel, Value: name})
+			for _, t := range p.tags {
+				labels = append(labels, mimirpb.LabelAdapter{Name: sanitizeInfluxName(t.key), Value: t.value})
+			}
+			sort.Slice(labels, func(i, j int) bool {
+				return labels[i].Name < labels[j].Name
+			})
+
+			ts := mimirpb.TimeseriesFromPool()
+			ts.Labels = labels
+			ts.Samples = append(ts.Samples, mimirpb.Sample{TimestampMs: p.timestampMs, Value: f.value})
+			out = append(out, mimirpb.PreallocTimeseries{TimeSeries: ts})
+		}
+	}
+
+	return out
+}
+
+// sanitizeInfluxName replaces the characters not allowed in Prometheus metric and label names with underscores.
+func sanitizeInfluxName(name string) string {
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// parseInfluxPrecision returns the timestamps multiplier, in nanoseconds, of the input precision
+// query parameter. The precision defaults to nanoseconds, like in InfluxDB.
+func parseInfluxPrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "ns", "n":
+		return time.Nanosecond, nil
+	case "us", "u":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	default:
+		return 0, httpgrpc.Errorf(http.StatusBadRequest, "unsupported precision: %s, supported: [ns, us, ms, s]", precision)
+	}
+}
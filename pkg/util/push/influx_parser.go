@@ -0,0 +1,236 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+var (
+	// errInfluxNoNumericFields is returned for the lines whose fields are all strings, which can't be converted to samples.
+	errInfluxNoNumericFields = errors.New("no numeric fields, string fields are not supported")
+
+	// errInfluxDuplicateLabelName is returned for the lines with tags whose names are the same once sanitized.
+	errInfluxDuplicateLabelName = errors.New("duplicate label name")
+)
+
+type influxTag struct {
+	key, value string
+}
+
+type influxField struct {
+	key   string
+	value float64
+}
+
+// influxPoint is a point parsed from a line of InfluxDB line protocol.
+// String fields are not supported by Prometheus, so they're not included.
+type influxPoint struct {
+	measurement string
+	tags        []influxTag
+	fields      []influxField
+	timestampMs int64
+}
+
+// parseInfluxLines parses the input InfluxDB line protocol body. Lines which can't be parsed or converted
+// to series are skipped, and an error is returned for each of them. Points without a timestamp get the input now timestamp.
+func parseInfluxLines(body []byte, precision time.Duration, now time.Time) ([]influxPoint, []error) {
+	var (
+		points []influxPoint
+		errs   []error
+	)
+
+	for lineNum := 1; len(body) > 0; lineNum++ {
+		var line []byte
+		if idx := bytes.IndexByte(body, '\n'); idx >= 0 {
+			line, body = body[:idx], body[idx+1:]
+		} else {
+			line, body = body, nil
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		p, err := parseInfluxLine(line, precision, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNum, err))
+			continue
+		}
+		points = append(points, p)
+	}
+
+	return points, errs
+}
+
+// parseInfluxLine parses a single line in the format:
+//
+//	<measurement>[,<tag_key>=<tag_value>...] <field_key>=<field_value>[,<field_key>=<field_value>...] [<timestamp>]
+func parseInfluxLine(line []byte, precision time.Duration, now time.Time) (influxPoint, error) {
+	sections := splitInfluxLine(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return influxPoint{}, errors.New("expected measurement, fields and optional timestamp separated by spaces")
+	}
+
+	p := influxPoint{timestampMs: now.UnixMilli()}
+
+	// Measurement and tags.
+	series := splitInfluxLine(sections[0], ',', false)
+	p.measurement = unescapeInfluxKey(series[0])
+	if p.measurement == "" {
+		return influxPoint{}, errors.New("missing measurement")
+	}
+
+	labelNames := make(map[string]string, len(series))
+	for _, tag := range series[1:] {
+		key, value, err := splitInfluxKeyValue(tag)
+		if err != nil {
+			return influxPoint{}, errors.Wrap(err, "invalid tag")
+		}
+
+		// The tags are converted to labels, which must have unique names and can't override the metric name.
+		name := sanitizeInfluxName(key)
+		if name == model.MetricNameLabel {
+			return influxPoint{}, errors.Wrapf(errInfluxDuplicateLabelName, "tag %q is sanitized to the metric name label", key)
+		}
+		if other, ok := labelNames[name]; ok {
+			return influxPoint{}, errors.Wrapf(errInfluxDuplicateLabelName, "tags %q and %q are both sanitized to %q", other, key, name)
+		}
+		labelNames[name] = key
+
+		p.tags = append(p.tags, influxTag{key: key, value: unescapeInfluxKey(value)})
+	}
+
+	// Fields.
+	for _, field := range splitInfluxLine(sections[1], ',', true) {
+		key, value, err := splitInfluxKeyValue(field)
+		if err != nil {
+			return influxPoint{}, errors.Wrap(err, "invalid field")
+		}
+
+		v, isString, err := parseInfluxFieldValue(value)
+		if err != nil {
+			return influxPoint{}, errors.Wrapf(err, "invalid value of field %q", key)
+		}
+		if isString {
+			continue
+		}
+		p.fields = append(p.fields, influxField{key: key, value: v})
+	}
+	if len(p.fields) == 0 {
+		return influxPoint{}, errInfluxNoNumericFields
+	}
+
+	// Timestamp.
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(string(sections[2]), 10, 64)
+		if err != nil {
+			return influxPoint{}, errors.Errorf("invalid timestamp %q", sections[2])
+		}
+		if ts > math.MaxInt64/int64(precision) || ts < math.MinInt64/int64(precision) {
+			return influxPoint{}, errors.Errorf("timestamp %d out of range", ts)
+		}
+		p.timestampMs = time.Unix(0, ts*int64(precision)).UnixMilli()
+	}
+
+	return p, nil
+}
+
+// splitInfluxLine splits the input on the unescaped separator. If quotes is true,
+// the separator is ignored within double-quoted strings.
+func splitInfluxLine(s []byte, sep byte, quotes bool) [][]byte {
+	var (
+		out      [][]byte
+		start    int
+		inQuotes bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			// Skip the escaped character.
+			i++
+		case quotes && s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			out = append(out, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(out, s[start:])
+}
+
+// splitInfluxKeyValue splits the input on the first unescaped equal sign.
+func splitInfluxKeyValue(s []byte) (string, []byte, error) {
+	parts := splitInfluxLine(s, '=', false)
+	if len(parts) < 2 {
+		return "", nil, errors.Errorf("missing value in %q", s)
+	}
+
+	key := unescapeInfluxKey(parts[0])
+	if key == "" {
+		return "", nil, errors.Errorf("missing key in %q", s)
+	}
+
+	// The value is everything after the first equal sign.
+	return key, s[len(parts[0])+1:], nil
+}
+
+// unescapeInfluxKey removes the backslashes escaping commas, equal signs and spaces.
+func unescapeInfluxKey(s []byte) string {
+	if bytes.IndexByte(s, '\\') < 0 {
+		return string(s)
+	}
+
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == ',' || s[i+1] == '=' || s[i+1] == ' ') {
+			i++
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+// parseInfluxFieldValue parses a field value. Integers, unsigned integers and booleans are converted
+// to floats, while the value of string fields is not returned.
+func parseInfluxFieldValue(s []byte) (value float64, isString bool, err error) {
+	if len(s) == 0 {
+		return 0, false, errors.New("empty value")
+	}
+
+	switch last := s[len(s)-1]; {
+	case s[0] == '"':
+		if len(s) < 2 || last != '"' {
+			return 0, false, errors.New("unterminated string")
+		}
+		return 0, true, nil
+
+	case last == 'i':
+		v, err := strconv.ParseInt(string(s[:len(s)-1]), 10, 64)
+		return float64(v), false, err
+
+	case last == 'u':
+		v, err := strconv.ParseUint(string(s[:len(s)-1]), 10, 64)
+		return float64(v), false, err
+	}
+
+	switch string(s) {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, false, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, false, nil
+	}
+
+	v, err := strconv.ParseFloat(string(s), 64)
+	return v, false, err
+}
@@ -0,0 +1,259 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package push
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestParseInfluxLines(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	tests := map[string]struct {
+		input          string
+		precision      time.Duration
+		expectedPoints []influxPoint
+		expectedErrs   []string
+	}{
+		"measurement with tags, fields and timestamp": {
+			input:     `cpu,host=server01,region=us-west usage_idle=90.5,usage_user=4i,healthy=true,uptime=100u 1465839830100400200`,
+			precision: time.Nanosecond,
+			expectedPoints: []influxPoint{{
+				measurement: "cpu",
+				tags:        []influxTag{{key: "host", value: "server01"}, {key: "region", value: "us-west"}},
+				fields:      []influxField{{key: "usage_idle", value: 90.5}, {key: "usage_user", value: 4}, {key: "healthy", value: 1}, {key: "uptime", value: 100}},
+				timestampMs: 1465839830100,
+			}},
+		},
+		"missing timestamp": {
+			input:     `cpu value=1`,
+			precision: time.Nanosecond,
+			expectedPoints: []influxPoint{{
+				measurement: "cpu",
+				fields:      []influxField{{key: "value", value: 1}},
+				timestampMs: now.UnixMilli(),
+			}},
+		},
+		"timestamp in seconds": {
+			input:     `cpu value=1 1465839830`,
+			precision: time.Second,
+			expectedPoints: []influxPoint{{
+				measurement: "cpu",
+				fields:      []influxField{{key: "value", value: 1}},
+				timestampMs: 1465839830000,
+			}},
+		},
+		"escaped characters and string fields": {
+			input:     `disk\ usage,path=/var\,log,mount\=point=a\ b used=1,comment="a string, with \"spaces\" and commas",free=F 1`,
+			precision: time.Millisecond,
+			expectedPoints: []influxPoint{{
+				measurement: "disk usage",
+				tags:        []influxTag{{key: "path", value: "/var,log"}, {key: "mount=point", value: "a b"}},
+				fields:      []influxField{{key: "used", value: 1}, {key: "free", value: 0}},
+				timestampMs: 1,
+			}},
+		},
+		"empty lines and comments are skipped": {
+			input:     "# comment\n\ncpu value=1 1\r\n\n",
+			precision: time.Millisecond,
+			expectedPoints: []influxPoint{{
+				measurement: "cpu",
+				fields:      []influxField{{key: "value", value: 1}},
+				timestampMs: 1,
+			}},
+		},
+		"lines which can't be converted to series are skipped": {
+			input:     "cpu comment=\"a\" 1\ncpu,host-name=a,host_name=b value=1 1\ncpu,__name__=a value=1 1\ncpu value=1 9223372036855\ncpu value=1 -9223372036855\ncpu value=1 9223372036854",
+			precision: time.Millisecond,
+			expectedPoints: []influxPoint{{
+				measurement: "cpu",
+				fields:      []influxField{{key: "value", value: 1}},
+				timestampMs: 9223372036854,
+			}},
+			expectedErrs: []string{
+				"line 1: no numeric fields",
+				`line 2: tags "host-name" and "host_name" are both sanitized to "host_name": duplicate label name`,
+				`line 3: tag "__name__" is sanitized to the metric name label: duplicate label name`,
+				"line 4: timestamp 9223372036855 out of range",
+				"line 5: timestamp -9223372036855 out of range",
+			},
+		},
+		"invalid lines are skipped": {
+			input:     "cpu\ncpu value=1 1\ncpu value=abc\ncpu,host value=1\ncpu value=1 abc\ncpu value=\"unterminated\n,host=a value=1",
+			precision: time.Millisecond,
+			expectedPoints: []influxPoint{{
+				measurement: "cpu",
+				fields:      []influxField{{key: "value", value: 1}},
+				timestampMs: 1,
+			}},
+			expectedErrs: []string{
+				"line 1: expected measurement, fields and optional timestamp separated by spaces",
+				`line 3: invalid value of field "value"`,
+				`line 4: invalid tag: missing value in "host"`,
+				`line 5: invalid timestamp "abc"`,
+				`line 6: invalid value of field "value": unterminated string`,
+				"line 7: missing measurement",
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			points, errs := parseInfluxLines([]byte(testData.input), testData.precision, now)
+			assert.Equal(t, testData.expectedPoints, points)
+
+			require.Len(t, errs, len(testData.expectedErrs))
+			for i, err := range errs {
+				assert.ErrorContains(t, err, testData.expectedErrs[i])
+			}
+		})
+	}
+}
+
+func TestInfluxPointsToTimeseries(t *testing.T) {
+	actual := influxPointsToTimeseries([]influxPoint{{
+		measurement: "disk usage",
+		tags:        []influxTag{{key: "path", value: "/var"}, {key: "1st-mount", value: "a"}},
+		fields:      []influxField{{key: "value", value: 1}, {key: "used.bytes", value: 2}},
+		timestampMs: 10,
+	}})
+
+	expected := []mimirpb.PreallocTimeseries{
+		{TimeSeries: &mimirpb.TimeSeries{
+			Labels:  []mimirpb.LabelAdapter{{Name: "_1st_mount", Value: "a"}, {Name: "__name__", Value: "disk_usage"}, {Name: "path", Value: "/var"}},
+			Samples: []mimirpb.Sample{{TimestampMs: 10, Value: 1}},
+		}},
+		{TimeSeries: &mimirpb.TimeSeries{
+			Labels:  []mimirpb.LabelAdapter{{Name: "_1st_mount", Value: "a"}, {Name: "__name__", Value: "disk_usage_used_bytes"}, {Name: "path", Value: "/var"}},
+			Samples: []mimirpb.Sample{{TimestampMs: 10, Value: 2}},
+		}},
+	}
+
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		assert.Equal(t, expected[i].Labels, actual[i].Labels)
+		assert.Equal(t, expected[i].Samples, actual[i].Samples)
+	}
+}
+
+func TestInfluxHandler(t *testing.T) {
+	tests := map[string]struct {
+		body               string
+		query              string
+		compress           bool
+		expectedCode       int
+		expectedSeries     []string
+		expectedDiscarded  map[string]float64
+		expectedBodySubstr string
+	}{
+		"valid request": {
+			body:           "cpu,host=a value=1 1000\ncpu,host=b value=2,idle=3 1000",
+			query:          "precision=ms",
+			expectedCode:   http.StatusOK,
+			expectedSeries: []string{`{__name__="cpu", host="a"}`, `{__name__="cpu", host="b"}`, `{__name__="cpu_idle", host="b"}`},
+		},
+		"valid gzip compressed request": {
+			body:           "cpu,host=a value=1 1000",
+			compress:       true,
+			expectedCode:   http.StatusOK,
+			expectedSeries: []string{`{__name__="cpu", host="a"}`},
+		},
+		"request with some invalid lines": {
+			body:              "cpu,host=a value=1 1000\ncpu,host=b\ncpu value=abc",
+			expectedCode:      http.StatusOK,
+			expectedSeries:    []string{`{__name__="cpu", host="a"}`},
+			expectedDiscarded: map[string]float64{influxParseError: 2},
+		},
+		"request with only invalid lines": {
+			body:               "cpu,host=b\ncpu value=abc",
+			expectedCode:       http.StatusBadRequest,
+			expectedDiscarded:  map[string]float64{influxParseError: 2},
+			expectedBodySubstr: "line 1: expected measurement, fields and optional timestamp separated by spaces",
+		},
+		"request with lines which can't be converted to series": {
+			body:               "cpu,host=a value=1 1000\ncpu,host=b comment=\"string\"\ncpu,host-name=a,host_name=b value=1\ncpu,__name__=a value=1\ncpu value=1 9223372036854776",
+			query:              "precision=ms",
+			expectedCode:       http.StatusOK,
+			expectedSeries:     []string{`{__name__="cpu", host="a"}`},
+			expectedDiscarded:  map[string]float64{influxParseError: 1, influxNoNumericFields: 1, influxDuplicateLabelName: 2},
+			expectedBodySubstr: "",
+		},
+		"unsupported precision": {
+			body:               "cpu value=1 1",
+			query:              "precision=h",
+			expectedCode:       http.StatusBadRequest,
+			expectedBodySubstr: "unsupported precision: h",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			body := []byte(testData.body)
+			if testData.compress {
+				var b bytes.Buffer
+				gz := gzip.NewWriter(&b)
+				_, err := gz.Write(body)
+				require.NoError(t, err)
+				require.NoError(t, gz.Close())
+				body = b.Bytes()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/push/influx/write?"+testData.query, bytes.NewReader(body))
+			req.Header.Set("X-Scope-OrgID", "test")
+			if testData.compress {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			_, ctx, err := tenant.ExtractTenantIDFromHTTPRequest(req)
+			require.NoError(t, err)
+			req = req.WithContext(ctx)
+
+			var actualSeries []string
+			reg := prometheus.NewPedanticRegistry()
+			handler := InfluxHandler(100000, nil, false, reg, func(_ context.Context, pushReq *Request) (*mimirpb.WriteResponse, error) {
+				request, err := pushReq.WriteRequest()
+				if err != nil {
+					return nil, err
+				}
+				for _, ts := range request.Timeseries {
+					actualSeries = append(actualSeries, mimirpb.FromLabelAdaptersToLabels(ts.Labels).String())
+				}
+				pushReq.CleanUp()
+				return &mimirpb.WriteResponse{}, nil
+			})
+
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			assert.Equal(t, testData.expectedCode, resp.Code)
+			assert.Contains(t, resp.Body.String(), testData.expectedBodySubstr)
+			assert.ElementsMatch(t, testData.expectedSeries, actualSeries)
+
+			if len(testData.expectedDiscarded) > 0 {
+				expected := `
+					# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+					# TYPE cortex_discarded_samples_total counter
+				`
+				for reason, value := range testData.expectedDiscarded {
+					expected += `cortex_discarded_samples_total{group="",reason="` + reason + `",user="test"} ` + strconv.FormatFloat(value, 'f', -1, 64) + "\n"
+				}
+				assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "cortex_discarded_samples_total"))
+			}
+		})
+	}
+}
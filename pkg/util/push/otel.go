@@ -3,10 +3,8 @@
 package push
 
 import (
-	"compress/gzip"
 	"context"
 	"errors"
-	"io"
 	"net/http"
 	"time"
 
@@ -25,7 +23,6 @@ import (
 	"go.uber.org/multierr"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
-	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/log"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
 	"github.com/grafana/mimir/pkg/util/validation"
@@ -71,43 +68,9 @@ func OTLPHandler(
 			return nil, httpgrpc.Errorf(http.StatusUnsupportedMediaType, "unsupported content type: %s, supported: [%s, %s]", contentType, jsonContentType, pbContentType)
 		}
 
-		if r.ContentLength > int64(maxRecvMsgSize) {
-			return nil, httpgrpc.Errorf(http.StatusRequestEntityTooLarge, distributorMaxWriteMessageSizeErr{actual: int(r.ContentLength), limit: maxRecvMsgSize}.Error())
-		}
-
-		reader := r.Body
-		// Handle compression.
 		contentEncoding := r.Header.Get("Content-Encoding")
-		switch contentEncoding {
-		case "gzip":
-			gr, err := gzip.NewReader(reader)
-			if err != nil {
-				return nil, err
-			}
-			reader = gr
-
-		case "":
-			// No compression.
-
-		default:
-			return nil, httpgrpc.Errorf(http.StatusUnsupportedMediaType, "unsupported compression: %s. Only \"gzip\" or no compression supported", contentEncoding)
-		}
-
-		// Protect against a large input.
-		reader = http.MaxBytesReader(nil, reader, int64(maxRecvMsgSize))
-
-		body, err := io.ReadAll(reader)
+		body, err := readRequestBody(r, maxRecvMsgSize)
 		if err != nil {
-			r.Body.Close()
-
-			if util.IsRequestBodyTooLarge(err) {
-				return body, httpgrpc.Errorf(http.StatusRequestEntityTooLarge, distributorMaxWriteMessageSizeErr{actual: -1, limit: maxRecvMsgSize}.Error())
-			}
-
-			return body, err
-		}
-
-		if err = r.Body.Close(); err != nil {
 			return body, err
 		}
 
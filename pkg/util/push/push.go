@@ -6,15 +6,23 @@
 package push
 
 import (
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"sync"
 
 	"github.com/go-kit/log/level"
+	"github.com/gogo/protobuf/proto"
 	"github.com/grafana/dskit/httpgrpc"
 	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
 	"github.com/grafana/mimir/pkg/util"
@@ -40,22 +48,159 @@ var bufferPool = sync.Pool{
 const SkipLabelNameValidationHeader = "X-Mimir-SkipLabelNameValidation"
 const statusClientClosedRequest = 499
 
-// Handler is a http.Handler which accepts WriteRequests.
+const (
+	// Protobuf messages of the Prometheus remote write requests, negotiated through the "proto" parameter of the Content-Type header.
+	remoteWrite1ProtoMessage = "prometheus.WriteRequest"
+	remoteWrite2ProtoMessage = "io.prometheus.write.v2.Request"
+
+	// Headers reporting the data written by a Prometheus Remote Write 2.0 request.
+	remoteWrite2SamplesWrittenHeader    = "X-Prometheus-Remote-Write-Samples-Written"
+	remoteWrite2HistogramsWrittenHeader = "X-Prometheus-Remote-Write-Histograms-Written"
+	remoteWrite2ExemplarsWrittenHeader  = "X-Prometheus-Remote-Write-Exemplars-Written"
+)
+
+// Handler is a http.Handler which accepts WriteRequests, either as Prometheus Remote Write 1.0
+// (prometheus.WriteRequest) or 2.0 (io.prometheus.write.v2.Request) messages.
 func Handler(
 	maxRecvMsgSize int,
 	sourceIPs *middleware.SourceIPExtractor,
 	allowSkipLabelNameValidation bool,
+	reg prometheus.Registerer,
 	push Func,
 ) http.Handler {
+	ignoredCreatedTimestamps := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_distributor_ignored_created_timestamps_total",
+		Help: "The total number of series received with a created timestamp, which has been ignored because it's not supported.",
+	}, []string{"user"})
+
 	return handler(maxRecvMsgSize, sourceIPs, allowSkipLabelNameValidation, push, func(ctx context.Context, r *http.Request, maxRecvMsgSize int, dst []byte, req *mimirpb.PreallocWriteRequest) ([]byte, error) {
-		res, err := util.ParseProtoReader(ctx, r.Body, int(r.ContentLength), maxRecvMsgSize, dst, req, util.RawSnappy)
+		protoMessage, err := remoteWriteProtoMessage(r.Header.Get("Content-Type"))
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			msg   proto.Message = req
+			reqV2 *mimirpb.PreallocWriteRequestV2
+		)
+		if protoMessage == remoteWrite2ProtoMessage {
+			reqV2 = &mimirpb.PreallocWriteRequestV2{PreallocWriteRequest: req}
+			msg = reqV2
+		}
+
+		res, err := util.ParseProtoReader(ctx, r.Body, int(r.ContentLength), maxRecvMsgSize, dst, msg, util.RawSnappy)
 		if errors.Is(err, util.MsgSizeTooLargeErr{}) {
 			err = distributorMaxWriteMessageSizeErr{actual: int(r.ContentLength), limit: maxRecvMsgSize}
 		}
-		return res, err
+		if err != nil {
+			return res, err
+		}
+
+		if reqV2 != nil && reqV2.IgnoredCreatedTimestamps > 0 {
+			userID, err := tenant.TenantID(ctx)
+			if err != nil {
+				return res, err
+			}
+			ignoredCreatedTimestamps.WithLabelValues(userID).Add(float64(reqV2.IgnoredCreatedTimestamps))
+		}
+		return res, nil
 	})
 }
 
+// remoteWriteProtoMessage returns the protobuf message of a Prometheus remote write request, given its Content-Type header.
+// For backward compatibility, requests without the header or with a media type other than application/x-protobuf
+// are considered Remote Write 1.0 requests.
+func remoteWriteProtoMessage(contentType string) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/x-protobuf" {
+		return remoteWrite1ProtoMessage, nil
+	}
+
+	switch protoMessage := params["proto"]; protoMessage {
+	case "", remoteWrite1ProtoMessage:
+		return remoteWrite1ProtoMessage, nil
+	case remoteWrite2ProtoMessage:
+		return remoteWrite2ProtoMessage, nil
+	default:
+		return "", httpgrpc.Errorf(http.StatusUnsupportedMediaType, "unsupported proto message: %s, supported: [%s, %s]", protoMessage, remoteWrite1ProtoMessage, remoteWrite2ProtoMessage)
+	}
+}
+
+// isRemoteWrite2Request returns whether the input HTTP request is a Prometheus Remote Write 2.0 request.
+func isRemoteWrite2Request(r *http.Request) bool {
+	protoMessage, err := remoteWriteProtoMessage(r.Header.Get("Content-Type"))
+	return err == nil && protoMessage == remoteWrite2ProtoMessage
+}
+
+// WrittenStats holds the number of samples, histograms and exemplars written by a request.
+type WrittenStats struct {
+	Samples, Histograms, Exemplars int
+}
+
+// NewWrittenStats returns the number of samples, histograms and exemplars of the input request.
+func NewWrittenStats(req *mimirpb.WriteRequest) WrittenStats {
+	var stats WrittenStats
+	for _, ts := range req.Timeseries {
+		stats.Samples += len(ts.Samples)
+		stats.Histograms += len(ts.Histograms)
+		stats.Exemplars += len(ts.Exemplars)
+	}
+	return stats
+}
+
+// setHeaders sets the Prometheus Remote Write 2.0 response headers reporting the written data.
+func (s WrittenStats) setHeaders(h http.Header) {
+	h.Set(remoteWrite2SamplesWrittenHeader, strconv.Itoa(s.Samples))
+	h.Set(remoteWrite2HistogramsWrittenHeader, strconv.Itoa(s.Histograms))
+	h.Set(remoteWrite2ExemplarsWrittenHeader, strconv.Itoa(s.Exemplars))
+}
+
+// readRequestBody reads the body of the input HTTP request, decompressing it if gzip encoded.
+// The request is rejected if its body, after decompression, is larger than maxRecvMsgSize.
+func readRequestBody(r *http.Request, maxRecvMsgSize int) ([]byte, error) {
+	if r.ContentLength > int64(maxRecvMsgSize) {
+		return nil, httpgrpc.Errorf(http.StatusRequestEntityTooLarge, distributorMaxWriteMessageSizeErr{actual: int(r.ContentLength), limit: maxRecvMsgSize}.Error())
+	}
+
+	reader := r.Body
+	// Handle compression.
+	contentEncoding := r.Header.Get("Content-Encoding")
+	switch contentEncoding {
+	case "gzip":
+		gr, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		reader = gr
+
+	case "":
+		// No compression.
+
+	default:
+		return nil, httpgrpc.Errorf(http.StatusUnsupportedMediaType, "unsupported compression: %s. Only \"gzip\" or no compression supported", contentEncoding)
+	}
+
+	// Protect against a large input.
+	reader = http.MaxBytesReader(nil, reader, int64(maxRecvMsgSize))
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		r.Body.Close()
+
+		if util.IsRequestBodyTooLarge(err) {
+			return body, httpgrpc.Errorf(http.StatusRequestEntityTooLarge, distributorMaxWriteMessageSizeErr{actual: -1, limit: maxRecvMsgSize}.Error())
+		}
+
+		return body, err
+	}
+
+	if err = r.Body.Close(); err != nil {
+		return body, err
+	}
+
+	return body, nil
+}
+
 type distributorMaxWriteMessageSizeErr struct {
 	actual, limit int
 }
@@ -84,6 +229,10 @@ func handler(maxRecvMsgSize int,
 				logger = log.WithSourceIPs(source, logger)
 			}
 		}
+		// Prometheus Remote Write 2.0 requests are answered with the number of written samples, histograms and exemplars,
+		// as reported by the push function, also when the request fails.
+		isRemoteWrite2 := isRemoteWrite2Request(r)
+
 		supplier := func() (*mimirpb.WriteRequest, func(), error) {
 			bufHolder := bufferPool.Get().(*bufHolder)
 			var req mimirpb.PreallocWriteRequest
@@ -115,7 +264,11 @@ func handler(maxRecvMsgSize int,
 			return &req.WriteRequest, cleanup, nil
 		}
 		req := newRequest(supplier)
-		if _, err := push(ctx, req); err != nil {
+		_, err := push(ctx, req)
+		if isRemoteWrite2 {
+			req.Written().setHeaders(w.Header())
+		}
+		if err != nil {
 			if errors.Is(err, context.Canceled) {
 				http.Error(w, err.Error(), statusClientClosedRequest)
 				level.Warn(logger).Log("msg", "push request canceled", "err", err)
@@ -11,8 +11,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,6 +22,9 @@ import (
 	"github.com/grafana/dskit/httpgrpc"
 	"github.com/grafana/dskit/middleware"
 	"github.com/grafana/dskit/tenant"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/prometheus/prometheus/storage/remote"
@@ -28,6 +33,7 @@ import (
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/protobuf/encoding/protowire"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
 	"github.com/grafana/mimir/pkg/util/test"
@@ -36,11 +42,181 @@ import (
 func TestHandler_remoteWrite(t *testing.T) {
 	req := createRequest(t, createPrometheusRemoteWriteProtobuf(t))
 	resp := httptest.NewRecorder()
-	handler := Handler(100000, nil, false, verifyWritePushFunc(t, mimirpb.API))
+	handler := Handler(100000, nil, false, nil, verifyWritePushFunc(t, mimirpb.API))
 	handler.ServeHTTP(resp, req)
 	assert.Equal(t, 200, resp.Code)
 }
 
+func TestHandler_remoteWrite2(t *testing.T) {
+	tests := map[string]struct {
+		contentType     string
+		pushErr         error
+		dropExemplars   bool
+		expectedCode    int
+		expectedHeaders map[string]string
+	}{
+		"Remote Write 2.0 request": {
+			contentType:  "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+			expectedCode: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"X-Prometheus-Remote-Write-Samples-Written":    "2",
+				"X-Prometheus-Remote-Write-Histograms-Written": "0",
+				"X-Prometheus-Remote-Write-Exemplars-Written":  "1",
+			},
+		},
+		"Remote Write 2.0 request partially rejected": {
+			contentType:   "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+			pushErr:       httpgrpc.Errorf(http.StatusBadRequest, "invalid exemplar"),
+			dropExemplars: true,
+			expectedCode:  http.StatusBadRequest,
+			expectedHeaders: map[string]string{
+				"X-Prometheus-Remote-Write-Samples-Written":    "2",
+				"X-Prometheus-Remote-Write-Histograms-Written": "0",
+				"X-Prometheus-Remote-Write-Exemplars-Written":  "0",
+			},
+		},
+		"Remote Write 2.0 request not written": {
+			contentType:  "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+			pushErr:      httpgrpc.Errorf(http.StatusAccepted, "deduplicated"),
+			expectedCode: http.StatusAccepted,
+			expectedHeaders: map[string]string{
+				"X-Prometheus-Remote-Write-Samples-Written":    "0",
+				"X-Prometheus-Remote-Write-Histograms-Written": "0",
+				"X-Prometheus-Remote-Write-Exemplars-Written":  "0",
+			},
+		},
+		"unsupported proto message": {
+			contentType:  "application/x-protobuf;proto=io.prometheus.write.v3.Request",
+			expectedCode: http.StatusUnsupportedMediaType,
+			expectedHeaders: map[string]string{
+				"X-Prometheus-Remote-Write-Samples-Written": "",
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			req := createRequest(t, createPrometheusRemoteWrite2Protobuf())
+			req.Header.Set("Content-Type", testData.contentType)
+			req.Header.Set("X-Prometheus-Remote-Write-Version", "2.0.0")
+			req = req.WithContext(user.InjectOrgID(req.Context(), "test"))
+
+			// The push function writes the request, after dropping the exemplars if required,
+			// unless it's not written at all.
+			pushFunc := func(_ context.Context, pushReq *Request) (*mimirpb.WriteResponse, error) {
+				request, err := pushReq.WriteRequest()
+				if err != nil {
+					return nil, err
+				}
+				defer pushReq.CleanUp()
+
+				if testData.dropExemplars {
+					for _, ts := range request.Timeseries {
+						ts.Exemplars = ts.Exemplars[:0]
+					}
+				}
+				if testData.pushErr == nil || testData.dropExemplars {
+					pushReq.SetWritten(NewWrittenStats(request))
+				}
+				return &mimirpb.WriteResponse{}, testData.pushErr
+			}
+
+			reg := prometheus.NewPedanticRegistry()
+			resp := httptest.NewRecorder()
+			handler := Handler(100000, nil, false, reg, pushFunc)
+			handler.ServeHTTP(resp, req)
+			assert.Equal(t, testData.expectedCode, resp.Code)
+			for name, value := range testData.expectedHeaders {
+				assert.Equal(t, value, resp.Header().Get(name), name)
+			}
+
+			if testData.expectedCode == http.StatusUnsupportedMediaType {
+				return
+			}
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_distributor_ignored_created_timestamps_total The total number of series received with a created timestamp, which has been ignored because it's not supported.
+				# TYPE cortex_distributor_ignored_created_timestamps_total counter
+				cortex_distributor_ignored_created_timestamps_total{user="test"} 1
+			`), "cortex_distributor_ignored_created_timestamps_total"))
+		})
+	}
+}
+
+func TestHandler_remoteWrite2_NativeHistogramWithCustomBuckets(t *testing.T) {
+	message := func(b []byte, num protowire.Number, msg []byte) []byte {
+		return protowire.AppendBytes(protowire.AppendTag(b, num, protowire.BytesType), msg)
+	}
+
+	// A native histogram with custom buckets (schema -53), whose bucket boundaries are the custom values.
+	histogram, err := (&mimirpb.Histogram{
+		Count:          &mimirpb.Histogram_CountInt{CountInt: 2},
+		Schema:         -53,
+		PositiveSpans:  []mimirpb.BucketSpan{{Offset: 0, Length: 2}},
+		PositiveDeltas: []int64{1, 0},
+		Timestamp:      1000,
+	}).Marshal()
+	require.NoError(t, err)
+	histogram = message(histogram, 16, protowire.AppendFixed64(protowire.AppendFixed64(nil, math.Float64bits(1)), math.Float64bits(5)))
+
+	var series []byte
+	series = message(series, 1, []byte{1, 2})
+	series = message(series, 3, histogram)
+
+	var body []byte
+	for _, symbol := range []string{"", "__name__", "foo"} {
+		body = message(body, 4, []byte(symbol))
+	}
+	body = message(body, 5, series)
+
+	req := createRequest(t, body)
+	req.Header.Set("Content-Type", "application/x-protobuf;proto=io.prometheus.write.v2.Request")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "2.0.0")
+	req = req.WithContext(user.InjectOrgID(req.Context(), "test"))
+
+	// The request is rejected when it's parsed.
+	pushFunc := func(_ context.Context, pushReq *Request) (*mimirpb.WriteResponse, error) {
+		defer pushReq.CleanUp()
+		_, err := pushReq.WriteRequest()
+		require.Error(t, err)
+		return nil, err
+	}
+
+	resp := httptest.NewRecorder()
+	Handler(100000, nil, false, prometheus.NewPedanticRegistry(), pushFunc).ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "native histograms with custom buckets are not supported")
+}
+
+func TestRemoteWriteProtoMessage(t *testing.T) {
+	tests := map[string]struct {
+		contentType     string
+		expectedMessage string
+		expectedErr     bool
+	}{
+		"no content type":                    {contentType: "", expectedMessage: remoteWrite1ProtoMessage},
+		"other media type":                   {contentType: "application/json", expectedMessage: remoteWrite1ProtoMessage},
+		"protobuf without proto parameter":   {contentType: "application/x-protobuf", expectedMessage: remoteWrite1ProtoMessage},
+		"Remote Write 1.0 proto parameter":   {contentType: "application/x-protobuf;proto=prometheus.WriteRequest", expectedMessage: remoteWrite1ProtoMessage},
+		"Remote Write 2.0 proto parameter":   {contentType: "application/x-protobuf; proto=io.prometheus.write.v2.Request", expectedMessage: remoteWrite2ProtoMessage},
+		"unsupported proto parameter":        {contentType: "application/x-protobuf;proto=foo", expectedErr: true},
+		"malformed content type is accepted": {contentType: "application/x-protobuf;;", expectedMessage: remoteWrite1ProtoMessage},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			actual, err := remoteWriteProtoMessage(testData.contentType)
+			if testData.expectedErr {
+				resp, ok := httpgrpc.HTTPResponseFromError(err)
+				require.True(t, ok)
+				assert.Equal(t, int32(http.StatusUnsupportedMediaType), resp.Code)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedMessage, actual)
+		})
+	}
+}
+
 func TestHandlerOTLPPush(t *testing.T) {
 	sampleSeries :=
 		[]prompb.TimeSeries{
@@ -321,7 +497,7 @@ func TestHandler_mimirWriteRequest(t *testing.T) {
 	req := createRequest(t, createMimirWriteRequestProtobuf(t, false))
 	resp := httptest.NewRecorder()
 	sourceIPs, _ := middleware.NewSourceIPs("SomeField", "(.*)")
-	handler := Handler(100000, sourceIPs, false, verifyWritePushFunc(t, mimirpb.RULE))
+	handler := Handler(100000, sourceIPs, false, nil, verifyWritePushFunc(t, mimirpb.RULE))
 	handler.ServeHTTP(resp, req)
 	assert.Equal(t, 200, resp.Code)
 }
@@ -330,7 +506,7 @@ func TestHandler_contextCanceledRequest(t *testing.T) {
 	req := createRequest(t, createMimirWriteRequestProtobuf(t, false))
 	resp := httptest.NewRecorder()
 	sourceIPs, _ := middleware.NewSourceIPs("SomeField", "(.*)")
-	handler := Handler(100000, sourceIPs, false, func(_ context.Context, req *Request) (*mimirpb.WriteResponse, error) {
+	handler := Handler(100000, sourceIPs, false, nil, func(_ context.Context, req *Request) (*mimirpb.WriteResponse, error) {
 		defer req.CleanUp()
 		return nil, fmt.Errorf("the request failed: %w", context.Canceled)
 	})
@@ -439,7 +615,7 @@ func TestHandler_EnsureSkipLabelNameValidationBehaviour(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			resp := httptest.NewRecorder()
-			handler := Handler(100000, nil, tc.allowSkipLabelNameValidation, tc.verifyReqHandler)
+			handler := Handler(100000, nil, tc.allowSkipLabelNameValidation, nil, tc.verifyReqHandler)
 			if !tc.includeAllowSkiplabelNameValidationHeader {
 				tc.req.Header.Set(SkipLabelNameValidationHeader, "true")
 			}
@@ -539,6 +715,31 @@ func createPrometheusRemoteWriteProtobuf(t testing.TB) []byte {
 	return inputBytes
 }
 
+// createPrometheusRemoteWrite2Protobuf returns a Remote Write 2.0 request with a series having two samples, an exemplar
+// and a created timestamp.
+func createPrometheusRemoteWrite2Protobuf() []byte {
+	message := func(b []byte, num protowire.Number, msg []byte) []byte {
+		return protowire.AppendBytes(protowire.AppendTag(b, num, protowire.BytesType), msg)
+	}
+	sample := func(value float64, timestamp int64) []byte {
+		b := protowire.AppendFixed64(protowire.AppendTag(nil, 1, protowire.Fixed64Type), math.Float64bits(value))
+		return protowire.AppendVarint(protowire.AppendTag(b, 2, protowire.VarintType), uint64(timestamp))
+	}
+
+	var series []byte
+	series = message(series, 1, []byte{1, 2})
+	series = message(series, 2, sample(1, 1000))
+	series = message(series, 2, sample(2, 2000))
+	series = message(series, 4, message(nil, 1, []byte{3, 4}))
+	series = protowire.AppendVarint(protowire.AppendTag(series, 6, protowire.VarintType), 500)
+
+	var req []byte
+	for _, symbol := range []string{"", "__name__", "foo", "trace_id", "abc"} {
+		req = message(req, 4, []byte(symbol))
+	}
+	return message(req, 5, series)
+}
+
 func createMimirWriteRequestProtobuf(t *testing.T, skipLabelNameValidation bool) []byte {
 	t.Helper()
 	h := remote.HistogramToHistogramProto(1337, test.GenerateTestHistogram(1))
@@ -596,7 +797,7 @@ func BenchmarkPushHandler(b *testing.B) {
 		pushReq.CleanUp()
 		return &mimirpb.WriteResponse{}, nil
 	}
-	handler := Handler(100000, nil, false, pushFunc)
+	handler := Handler(100000, nil, false, nil, pushFunc)
 	b.ResetTimer()
 	for iter := 0; iter < b.N; iter++ {
 		req.Body = bufCloser{Buffer: buf} // reset Body so it can be read each time round the loop
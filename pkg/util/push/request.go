@@ -22,6 +22,8 @@ type Request struct {
 
 	request *mimirpb.WriteRequest
 	err     error
+
+	written WrittenStats
 }
 
 func newRequest(p supplierFunc) *Request {
@@ -68,3 +70,15 @@ func (r *Request) CleanUp() {
 	}
 	r.cleanups = r.cleanups[:0]
 }
+
+// SetWritten records the data of the request which has been written to the storage. It's set by
+// the push function once the data has been accepted, after any filtering of the request.
+func (r *Request) SetWritten(written WrittenStats) {
+	r.written = written
+}
+
+// Written returns the data of the request which has been written to the storage, or zero if the
+// push function didn't record it.
+func (r *Request) Written() WrittenStats {
+	return r.written
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"fmt"
+
+	"github.com/grafana/regexp"
+)
+
+const (
+	// BlockedQueryTypeRange scopes a blocked query to range queries.
+	BlockedQueryTypeRange = "range"
+	// BlockedQueryTypeInstant scopes a blocked query to instant queries.
+	BlockedQueryTypeInstant = "instant"
+)
+
+// BlockedQuery configures a query which is rejected by the query-frontend. The pattern is matched against
+// the normalised query expression, either exactly or, if Regex is true, as a regular expression anchored
+// at both ends.
+type BlockedQuery struct {
+	Pattern   string `yaml:"pattern" json:"pattern"`
+	Regex     bool   `yaml:"regex" json:"regex"`
+	QueryType string `yaml:"query_type,omitempty" json:"query_type,omitempty"`
+}
+
+// BlockedQueries is a list of blocked queries. A query is blocked if it matches any of them.
+type BlockedQueries []BlockedQuery
+
+// ExampleDoc provides an example doc for this config, especially valuable since it's a list of custom structs.
+func (b BlockedQueries) ExampleDoc() (comment string, yaml interface{}) {
+	return `The following configuration blocks the exact query "up" and the range queries selecting the series of the "expensive" job.` +
+			` The query type can be "range" or "instant", and it applies the block to all queries if empty.`,
+		[]map[string]interface{}{
+			{"pattern": "up"},
+			{"pattern": `.*\{job="expensive"\}.*`, "regex": true, "query_type": BlockedQueryTypeRange},
+		}
+}
+
+// Validate returns an error if any of the blocked queries has an invalid regular expression or query type.
+func (b BlockedQueries) Validate() error {
+	for _, q := range b {
+		if q.Regex {
+			if _, err := regexp.Compile(q.Pattern); err != nil {
+				return fmt.Errorf("invalid blocked_queries regex pattern %q: %w", q.Pattern, err)
+			}
+		}
+
+		switch q.QueryType {
+		case "", BlockedQueryTypeRange, BlockedQueryTypeInstant:
+		default:
+			return fmt.Errorf("invalid blocked_queries query type %q for pattern %q: supported values are %q and %q", q.QueryType, q.Pattern, BlockedQueryTypeRange, BlockedQueryTypeInstant)
+		}
+	}
+	return nil
+}
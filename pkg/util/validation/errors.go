@@ -293,6 +293,10 @@ func NewMaxQueryExpressionSizeBytesError(actualSizeBytes, maxQuerySizeBytes int)
 		maxQueryExpressionSizeBytesFlag))
 }
 
+func NewQueryBlockedError() LimitError {
+	return LimitError(globalerror.QueryBlocked.Message("the query has been blocked because it matches one of the blocked queries configured for the tenant"))
+}
+
 func NewRequestRateLimitedError(limit float64, burst int) LimitError {
 	return LimitError(globalerror.RequestRateLimited.MessageWithPerTenantLimitConfig(
 		fmt.Sprintf("the request has been rejected because the tenant exceeded the request rate limit, set to %v requests/s across all distributors with a maximum allowed burst of %d", limit, burst),
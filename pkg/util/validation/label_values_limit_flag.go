@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// LabelValuesLimitMap is a map of label name to the maximum number of distinct values of that label.
+type LabelValuesLimitMap map[string]int
+
+// String implements flag.Value
+func (m LabelValuesLimitMap) String() string {
+	out, err := json.Marshal(map[string]int(m))
+	if err != nil {
+		return fmt.Sprintf("failed to marshal: %v", err)
+	}
+	return string(out)
+}
+
+// Set implements flag.Value
+func (m LabelValuesLimitMap) Set(s string) error {
+	newMap := map[string]int{}
+	return m.updateMap(json.Unmarshal([]byte(s), &newMap), newMap)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (m LabelValuesLimitMap) UnmarshalYAML(value *yaml.Node) error {
+	newMap := map[string]int{}
+	return m.updateMap(value.DecodeWithOptions(newMap, yaml.DecodeOptions{KnownFields: true}), newMap)
+}
+
+func (m LabelValuesLimitMap) updateMap(unmarshalErr error, newMap map[string]int) error {
+	if unmarshalErr != nil {
+		return unmarshalErr
+	}
+
+	for k, v := range newMap {
+		if !model.LabelName(k).IsValid() {
+			return errors.Errorf("invalid label name: %s", k)
+		}
+		if v < 0 {
+			return errors.Errorf("invalid limit for label name %s: must not be negative", k)
+		}
+		m[k] = v
+	}
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (m LabelValuesLimitMap) MarshalYAML() (interface{}, error) {
+	return map[string]int(m), nil
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLabelValuesLimitMap(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args     []string
+		expected LabelValuesLimitMap
+		error    string
+	}{
+		"basic test": {
+			args: []string{"-map-flag", "{\"user_id\": 100, \"url\": 50}"},
+			expected: LabelValuesLimitMap{
+				"user_id": 100,
+				"url":     50,
+			},
+		},
+
+		"invalid label name": {
+			args:  []string{"-map-flag", "{\"user-id\": 100}"},
+			error: "invalid value \"{\\\"user-id\\\": 100}\" for flag -map-flag: invalid label name: user-id",
+		},
+
+		"negative limit": {
+			args:  []string{"-map-flag", "{\"user_id\": -1}"},
+			error: "invalid value \"{\\\"user_id\\\": -1}\" for flag -map-flag: invalid limit for label name user_id: must not be negative",
+		},
+
+		"parsing error": {
+			args:  []string{"-map-flag", "{\"user_id\": ..."},
+			error: "invalid value \"{\\\"user_id\\\": ...\" for flag -map-flag: invalid character '.' looking for beginning of value",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			v := LabelValuesLimitMap{}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(&bytes.Buffer{}) // otherwise errors would go to stderr.
+			fs.Var(v, "map-flag", "Map flag, you can pass JSON into this")
+			err := fs.Parse(tc.args)
+
+			if tc.error != "" {
+				require.NotNil(t, err)
+				assert.Equal(t, tc.error, err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, v)
+			}
+		})
+	}
+}
+
+func TestLabelValuesLimitMapYaml(t *testing.T) {
+	type testStruct struct {
+		Flag LabelValuesLimitMap `yaml:"flag"`
+	}
+
+	var expectedStruct testStruct
+	expectedStruct.Flag = LabelValuesLimitMap{}
+
+	require.NoError(t, expectedStruct.Flag.Set("{\"user_id\": 500}"))
+	expected := []byte(`flag:
+    user_id: 500
+`)
+
+	actual, err := yaml.Marshal(expectedStruct)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	var actualStruct testStruct
+	actualStruct.Flag = LabelValuesLimitMap{} // must be set, otherwise unmarshalling panics.
+
+	require.NoError(t, yaml.Unmarshal(expected, &actualStruct))
+	assert.Equal(t, expectedStruct, actualStruct)
+
+	// Invalid label names are rejected when loading YAML too.
+	err = yaml.Unmarshal([]byte("flag:\n  \"user-id\": 500\n"), &actualStruct)
+	require.EqualError(t, err, "invalid label name: user-id")
+}
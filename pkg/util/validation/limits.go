@@ -28,6 +28,7 @@ import (
 
 const (
 	MaxSeriesPerMetricFlag                   = "ingester.max-global-series-per-metric"
+	MaxValuesPerLabelNameFlag                = "ingester.max-global-values-per-label-name"
 	MaxMetadataPerMetricFlag                 = "ingester.max-global-metadata-per-metric"
 	MaxSeriesPerUserFlag                     = "ingester.max-global-series-per-user"
 	MaxMetadataPerUserFlag                   = "ingester.max-global-metadata-per-user"
@@ -89,8 +90,9 @@ type Limits struct {
 	ServiceOverloadStatusCodeOnRateLimitEnabled bool                `yaml:"service_overload_status_code_on_rate_limit_enabled" json:"service_overload_status_code_on_rate_limit_enabled" category:"experimental"`
 	// Ingester enforced limits.
 	// Series
-	MaxGlobalSeriesPerUser   int `yaml:"max_global_series_per_user" json:"max_global_series_per_user"`
-	MaxGlobalSeriesPerMetric int `yaml:"max_global_series_per_metric" json:"max_global_series_per_metric"`
+	MaxGlobalSeriesPerUser      int                 `yaml:"max_global_series_per_user" json:"max_global_series_per_user"`
+	MaxGlobalSeriesPerMetric    int                 `yaml:"max_global_series_per_metric" json:"max_global_series_per_metric"`
+	MaxGlobalValuesPerLabelName LabelValuesLimitMap `yaml:"max_global_values_per_label_name" json:"max_global_values_per_label_name" category:"experimental"`
 	// Metadata
 	MaxGlobalMetricsWithMetadataPerUser int `yaml:"max_global_metadata_per_user" json:"max_global_metadata_per_user"`
 	MaxGlobalMetadataPerMetric          int `yaml:"max_global_metadata_per_metric" json:"max_global_metadata_per_metric"`
@@ -107,6 +109,10 @@ type Limits struct {
 	// User defined label to give the option of subdividing specific metrics by another label
 	SeparateMetricsGroupLabel string `yaml:"separate_metrics_group_label" json:"separate_metrics_group_label" category:"experimental"`
 
+	// Cost attribution.
+	CostAttributionLabel                 string `yaml:"cost_attribution_label" json:"cost_attribution_label" category:"experimental"`
+	MaxCostAttributionCardinalityPerUser int    `yaml:"max_cost_attribution_cardinality_per_user" json:"max_cost_attribution_cardinality_per_user" category:"experimental"`
+
 	// Querier enforced limits.
 	MaxChunksPerQuery                    int            `yaml:"max_fetched_chunks_per_query" json:"max_fetched_chunks_per_query"`
 	MaxEstimatedChunksPerQueryMultiplier float64        `yaml:"max_estimated_fetched_chunks_per_query_multiplier" json:"max_estimated_fetched_chunks_per_query_multiplier" category:"experimental"`
@@ -118,6 +124,7 @@ type Limits struct {
 	MaxLabelsQueryLength                 model.Duration `yaml:"max_labels_query_length" json:"max_labels_query_length"`
 	MaxCacheFreshness                    model.Duration `yaml:"max_cache_freshness" json:"max_cache_freshness" category:"advanced"`
 	MaxQueriersPerTenant                 int            `yaml:"max_queriers_per_tenant" json:"max_queriers_per_tenant"`
+	QuerySchedulingWeight                float64        `yaml:"query_scheduling_weight" json:"query_scheduling_weight" category:"experimental"`
 	QueryShardingTotalShards             int            `yaml:"query_sharding_total_shards" json:"query_sharding_total_shards"`
 	QueryShardingMaxShardedQueries       int            `yaml:"query_sharding_max_sharded_queries" json:"query_sharding_max_sharded_queries"`
 	QueryShardingMaxRegexpSizeBytes      int            `yaml:"query_sharding_max_regexp_size_bytes" json:"query_sharding_max_regexp_size_bytes"`
@@ -132,6 +139,7 @@ type Limits struct {
 	ResultsCacheTTLForLabelsQuery          model.Duration `yaml:"results_cache_ttl_for_labels_query" json:"results_cache_ttl_for_labels_query"`
 	ResultsCacheForUnalignedQueryEnabled   bool           `yaml:"cache_unaligned_requests" json:"cache_unaligned_requests" category:"advanced"`
 	MaxQueryExpressionSizeBytes            int            `yaml:"max_query_expression_size_bytes" json:"max_query_expression_size_bytes"`
+	BlockedQueries                         BlockedQueries `yaml:"blocked_queries,omitempty" json:"blocked_queries,omitempty" doc:"nocli|description=List of queries to block in the query-frontend. Each entry has a pattern matched against the normalised query expression, either exactly or as a regular expression if regex is true, and an optional query_type (range or instant) restricting the block to one type of query." category:"experimental"`
 
 	// Cardinality
 	CardinalityAnalysisEnabled                    bool `yaml:"cardinality_analysis_enabled" json:"cardinality_analysis_enabled"`
@@ -152,6 +160,7 @@ type Limits struct {
 
 	// Compactor.
 	CompactorBlocksRetentionPeriod        model.Duration `yaml:"compactor_blocks_retention_period" json:"compactor_blocks_retention_period"`
+	CompactorBlocksRetentionRules         RetentionRules `yaml:"compactor_blocks_retention_rules" json:"compactor_blocks_retention_rules" doc:"nocli|description=List of retention rules, each one made of a series selector and a retention period. Samples of the series matching a rule's selector and older than the rule's retention period are not returned by queriers, and are deleted by the compactor, which rewrites the blocks as their samples expire. Rules are applied in addition to the blocks retention period." category:"experimental"`
 	CompactorSplitAndMergeShards          int            `yaml:"compactor_split_and_merge_shards" json:"compactor_split_and_merge_shards"`
 	CompactorSplitGroups                  int            `yaml:"compactor_split_groups" json:"compactor_split_groups"`
 	CompactorTenantShardSize              int            `yaml:"compactor_tenant_shard_size" json:"compactor_tenant_shard_size"`
@@ -160,6 +169,15 @@ type Limits struct {
 	CompactorBlockUploadValidationEnabled bool           `yaml:"compactor_block_upload_validation_enabled" json:"compactor_block_upload_validation_enabled"`
 	CompactorBlockUploadVerifyChunks      bool           `yaml:"compactor_block_upload_verify_chunks" json:"compactor_block_upload_verify_chunks"`
 	CompactorBlockUploadMaxBlockSizeBytes int64          `yaml:"compactor_block_upload_max_block_size_bytes" json:"compactor_block_upload_max_block_size_bytes" category:"advanced"`
+	CompactorDownsampling5mDelay          model.Duration `yaml:"compactor_downsampling_5m_delay" json:"compactor_downsampling_5m_delay" category:"experimental"`
+	CompactorDownsampling1hDelay          model.Duration `yaml:"compactor_downsampling_1h_delay" json:"compactor_downsampling_1h_delay" category:"experimental"`
+	CompactorBlocksRetentionPeriod5m      model.Duration `yaml:"compactor_blocks_retention_period_5m" json:"compactor_blocks_retention_period_5m" category:"experimental"`
+	CompactorBlocksRetentionPeriod1h      model.Duration `yaml:"compactor_blocks_retention_period_1h" json:"compactor_blocks_retention_period_1h" category:"experimental"`
+	CompactorTenantPriority               int            `yaml:"compactor_tenant_priority" json:"compactor_tenant_priority" category:"experimental"`
+	CompactorBlocksColdStoragePeriod      model.Duration `yaml:"compactor_blocks_cold_storage_period" json:"compactor_blocks_cold_storage_period" category:"experimental"`
+
+	// Blocks storage.
+	BlockBloomFilterLabelNames flagext.StringSliceCSV `yaml:"block_bloom_filter_label_names" json:"block_bloom_filter_label_names" category:"experimental"`
 
 	// This config doesn't have a CLI flag registered here because they're registered in
 	// their own original config struct.
@@ -208,6 +226,10 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 
 	f.IntVar(&l.MaxGlobalSeriesPerUser, MaxSeriesPerUserFlag, 150000, "The maximum number of in-memory series per tenant, across the cluster before replication. 0 to disable.")
 	f.IntVar(&l.MaxGlobalSeriesPerMetric, MaxSeriesPerMetricFlag, 0, "The maximum number of in-memory series per metric name, across the cluster before replication. 0 to disable.")
+	if l.MaxGlobalValuesPerLabelName == nil {
+		l.MaxGlobalValuesPerLabelName = LabelValuesLimitMap{}
+	}
+	f.Var(&l.MaxGlobalValuesPerLabelName, MaxValuesPerLabelNameFlag, "The maximum number of distinct values per label name in the in-memory series, across the cluster before replication. Value is a map, where each key is a label name and value is the limit. On command line, this map is given in JSON format. Series adding a new value to a label name which has reached its limit are rejected. 0 to disable the limit for a label name.")
 
 	f.IntVar(&l.MaxGlobalMetricsWithMetadataPerUser, MaxMetadataPerUserFlag, 0, "The maximum number of in-memory metrics with metadata per tenant, across the cluster. 0 to disable.")
 	f.IntVar(&l.MaxGlobalMetadataPerMetric, MaxMetadataPerMetricFlag, 0, "The maximum number of metadata per metric, across the cluster. 0 to disable.")
@@ -219,6 +241,9 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 
 	f.StringVar(&l.SeparateMetricsGroupLabel, "validation.separate-metrics-group-label", "", "Label used to define the group label for metrics separation. For each write request, the group is obtained from the first non-empty group label from the first timeseries in the incoming list of timeseries. Specific distributor and ingester metrics will be further separated adding a 'group' label with group label's value. Currently applies to the following metrics: cortex_discarded_samples_total")
 
+	f.StringVar(&l.CostAttributionLabel, "validation.cost-attribution-label", "", "Label used to attribute the usage of the tenant. When set, the distributor counts the received and discarded samples, and the ingester counts the active series, by the value of this label. Series without this label aren't attributed.")
+	f.IntVar(&l.MaxCostAttributionCardinalityPerUser, "validation.max-cost-attribution-cardinality-per-user", 100, "Maximum number of values of the cost attribution label tracked per tenant. Usage attributed to additional values is accounted for in the __overflow__ value.")
+
 	f.IntVar(&l.MaxChunksPerQuery, MaxChunksPerQueryFlag, 2e6, "Maximum number of chunks that can be fetched in a single query from ingesters and long-term storage. This limit is enforced in the querier, ruler and store-gateway. 0 to disable.")
 	f.Float64Var(&l.MaxEstimatedChunksPerQueryMultiplier, MaxEstimatedChunksPerQueryMultiplierFlag, 0, "Maximum number of chunks estimated to be fetched in a single query from ingesters and long-term storage, as a multiple of -"+MaxChunksPerQueryFlag+". This limit is enforced in the querier. Must be greater than or equal to 1, or 0 to disable.")
 	f.IntVar(&l.MaxFetchedSeriesPerQuery, MaxSeriesPerQueryFlag, 0, "The maximum number of unique series for which a query can fetch samples from each ingesters and storage. This limit is enforced in the querier, ruler and store-gateway. 0 to disable")
@@ -234,6 +259,7 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&l.MaxCacheFreshness, "query-frontend.max-cache-freshness", "Most recent allowed cacheable result per-tenant, to prevent caching very recent results that might still be in flux.")
 
 	f.IntVar(&l.MaxQueriersPerTenant, "query-frontend.max-queriers-per-tenant", 0, "Maximum number of queriers that can handle requests for a single tenant. If set to 0 or value higher than number of available queriers, *all* queriers will handle requests for the tenant. Each frontend (or query-scheduler, if used) will select the same set of queriers for the same tenant (given that all queriers are connected to all frontends / query-schedulers). This option only works with queriers connecting to the query-frontend / query-scheduler, not when using downstream URL.")
+	f.Float64Var(&l.QuerySchedulingWeight, "query-frontend.query-scheduling-weight", 1, "Weight of the tenant when the query-frontend or query-scheduler chooses which tenant's queued request is dispatched next to a querier, when using the weighted-fair or querier-time-fair dequeue policy. A tenant with a weight of 2 gets twice the share of a tenant with a weight of 1. 0 is equivalent to 1.")
 	f.IntVar(&l.QueryShardingTotalShards, "query-frontend.query-sharding-total-shards", 16, "The amount of shards to use when doing parallelisation via query sharding by tenant. 0 to disable query sharding for tenant. Query sharding implementation will adjust the number of query shards based on compactor shards. This allows querier to not search the blocks which cannot possibly have the series for given query shard.")
 	f.IntVar(&l.QueryShardingMaxShardedQueries, "query-frontend.query-sharding-max-sharded-queries", 128, "The max number of sharded queries that can be run for a given received query. 0 to disable limit.")
 	f.IntVar(&l.QueryShardingMaxRegexpSizeBytes, "query-frontend.query-sharding-max-regexp-size-bytes", 4096, "Disable query sharding for any query containing a regular expression matcher longer than the configured number of bytes. 0 to disable the limit.")
@@ -260,6 +286,15 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&l.CompactorBlockUploadValidationEnabled, "compactor.block-upload-validation-enabled", true, "Enable block upload validation for the tenant.")
 	f.BoolVar(&l.CompactorBlockUploadVerifyChunks, "compactor.block-upload-verify-chunks", true, "Verify chunks when uploading blocks via the upload API for the tenant.")
 	f.Int64Var(&l.CompactorBlockUploadMaxBlockSizeBytes, "compactor.block-upload-max-block-size-bytes", 0, "Maximum size in bytes of a block that is allowed to be uploaded or validated. 0 = no limit.")
+	f.Var(&l.CompactorDownsampling5mDelay, "compactor.downsampling-5m-delay", "Downsample the fully compacted blocks to 5m resolution once all their samples are older than the specified delay. Queriers read the downsampled blocks when the query step is large enough. 0 to disable.")
+	f.Var(&l.CompactorDownsampling1hDelay, "compactor.downsampling-1h-delay", "Downsample the fully compacted blocks to 1h resolution once all their samples are older than the specified delay. Queriers read the downsampled blocks when the query step is large enough. 0 to disable.")
+	f.Var(&l.CompactorBlocksRetentionPeriod5m, "compactor.blocks-retention-period-5m", "Delete blocks downsampled to 5m resolution containing samples older than the specified retention period. 0 to use the retention period of the raw blocks, configured with -compactor.blocks-retention-period.")
+	f.Var(&l.CompactorBlocksRetentionPeriod1h, "compactor.blocks-retention-period-1h", "Delete blocks downsampled to 1h resolution containing samples older than the specified retention period. 0 to use the retention period of the raw blocks, configured with -compactor.blocks-retention-period.")
+	f.IntVar(&l.CompactorTenantPriority, "compactor.tenant-priority", 0, "Priority of the tenant when backlog-aware scheduling is enabled in the compactor. Tenants with a higher priority are compacted first, regardless of their compaction lag.")
+	f.Var(&l.CompactorBlocksColdStoragePeriod, "compactor.blocks-cold-storage-period", "Move the blocks containing only samples older than the specified period to the cold storage bucket, configured with -blocks-storage.cold-storage.*. It should be greater than the largest compaction block range and than the downsampling delays, because the blocks in the cold storage are not compacted nor downsampled anymore. 0 to disable.")
+
+	// Blocks storage.
+	f.Var(&l.BlockBloomFilterLabelNames, "blocks-storage.bloom-filter-label-names", "Comma-separated list of label names for which the ingesters and compactors build a bloom filter of the label values when uploading a block. Store-gateways use the bloom filters to skip the blocks which can't match the equality matchers of a query on these labels. Suitable for high-cardinality labels, such as trace or pod IDs.")
 
 	// Query-frontend.
 	f.Var(&l.MaxTotalQueryLength, maxTotalQueryLengthFlag, "Limit the total query time range (end - start time). This limit is enforced in the query-frontend on the received query.")
@@ -317,6 +352,7 @@ func (l *Limits) unmarshal(decode func(any) error) error {
 		*l = *defaultLimits
 		// Make copy of default limits, otherwise unmarshalling would modify map in default limits.
 		l.copyNotificationIntegrationLimits(defaultLimits.NotificationRateLimitPerIntegration)
+		l.copyLabelValuesLimits(defaultLimits.MaxGlobalValuesPerLabelName)
 	}
 
 	// Decode into a reflection-crafted struct that has fields for the extensions.
@@ -354,6 +390,22 @@ func (l *Limits) validate() error {
 		}
 	}
 
+	if err := l.CompactorBlocksRetentionRules.Validate(); err != nil {
+		return err
+	}
+
+	if err := l.BlockedQueries.Validate(); err != nil {
+		return err
+	}
+
+	if l.CostAttributionLabel != "" && !model.LabelName(l.CostAttributionLabel).IsValid() {
+		return fmt.Errorf("invalid cost_attribution_label %q", l.CostAttributionLabel)
+	}
+
+	if l.QuerySchedulingWeight < 0 {
+		return errors.New("invalid value for -query-frontend.query-scheduling-weight: must not be negative")
+	}
+
 	if l.MaxEstimatedChunksPerQueryMultiplier < 1 && l.MaxEstimatedChunksPerQueryMultiplier != 0 {
 		return errors.New("invalid value for -" + MaxEstimatedChunksPerQueryMultiplierFlag + ": must be 0 or greater than or equal to 1")
 	}
@@ -368,6 +420,13 @@ func (l *Limits) copyNotificationIntegrationLimits(defaults NotificationRateLimi
 	}
 }
 
+func (l *Limits) copyLabelValuesLimits(defaults LabelValuesLimitMap) {
+	l.MaxGlobalValuesPerLabelName = make(map[string]int, len(defaults))
+	for k, v := range defaults {
+		l.MaxGlobalValuesPerLabelName[k] = v
+	}
+}
+
 // When we load YAML from disk, we want the various per-customer limits
 // to default to any values specified on the command line, not default
 // command line values.  This global contains those values.  I (Tom) cannot
@@ -508,6 +567,12 @@ func (o *Overrides) MaxGlobalSeriesPerMetric(userID string) int {
 	return o.getOverridesForUser(userID).MaxGlobalSeriesPerMetric
 }
 
+// MaxGlobalValuesPerLabelName returns the maximum number of distinct values allowed per label name across the cluster.
+// Label names not in the returned map are not limited.
+func (o *Overrides) MaxGlobalValuesPerLabelName(userID string) map[string]int {
+	return o.getOverridesForUser(userID).MaxGlobalValuesPerLabelName
+}
+
 func (o *Overrides) MaxChunksPerQuery(userID string) int {
 	return o.getOverridesForUser(userID).MaxChunksPerQuery
 }
@@ -549,6 +614,11 @@ func (o *Overrides) MaxQueryExpressionSizeBytes(userID string) int {
 	return o.getOverridesForUser(userID).MaxQueryExpressionSizeBytes
 }
 
+// BlockedQueries returns the queries blocked in the query-frontend for a given user.
+func (o *Overrides) BlockedQueries(userID string) BlockedQueries {
+	return o.getOverridesForUser(userID).BlockedQueries
+}
+
 // MaxLabelsQueryLength returns the limit of the length (in time) of a label names or values request.
 func (o *Overrides) MaxLabelsQueryLength(userID string) time.Duration {
 	return time.Duration(o.getOverridesForUser(userID).MaxLabelsQueryLength)
@@ -565,6 +635,12 @@ func (o *Overrides) MaxQueriersPerUser(userID string) int {
 	return o.getOverridesForUser(userID).MaxQueriersPerTenant
 }
 
+// QuerySchedulingWeight returns the weight of the tenant used by the weighted dequeue policies
+// of the query-frontend and query-scheduler.
+func (o *Overrides) QuerySchedulingWeight(userID string) float64 {
+	return o.getOverridesForUser(userID).QuerySchedulingWeight
+}
+
 // MaxQueryParallelism returns the limit to the number of split queries the
 // frontend will process in parallel.
 func (o *Overrides) MaxQueryParallelism(userID string) int {
@@ -641,6 +717,16 @@ func (o *Overrides) SeparateMetricsGroupLabel(userID string) string {
 	return o.getOverridesForUser(userID).SeparateMetricsGroupLabel
 }
 
+// CostAttributionLabel returns the label used to attribute the usage of a given user.
+func (o *Overrides) CostAttributionLabel(userID string) string {
+	return o.getOverridesForUser(userID).CostAttributionLabel
+}
+
+// MaxCostAttributionCardinalityPerUser returns the maximum number of cost attribution label values tracked for a given user.
+func (o *Overrides) MaxCostAttributionCardinalityPerUser(userID string) int {
+	return o.getOverridesForUser(userID).MaxCostAttributionCardinalityPerUser
+}
+
 // IngestionTenantShardSize returns the ingesters shard size for a given user.
 func (o *Overrides) IngestionTenantShardSize(userID string) int {
 	return o.getOverridesForUser(userID).IngestionTenantShardSize
@@ -661,6 +747,67 @@ func (o *Overrides) CompactorBlocksRetentionPeriod(userID string) time.Duration
 	return time.Duration(o.getOverridesForUser(userID).CompactorBlocksRetentionPeriod)
 }
 
+// CompactorBlocksRetentionPeriod5m returns the retention period of the blocks downsampled to 5m resolution for a given user.
+func (o *Overrides) CompactorBlocksRetentionPeriod5m(userID string) time.Duration {
+	if retention := o.getOverridesForUser(userID).CompactorBlocksRetentionPeriod5m; retention > 0 {
+		return time.Duration(retention)
+	}
+	return o.CompactorBlocksRetentionPeriod(userID)
+}
+
+// CompactorBlocksRetentionPeriod1h returns the retention period of the blocks downsampled to 1h resolution for a given user.
+func (o *Overrides) CompactorBlocksRetentionPeriod1h(userID string) time.Duration {
+	if retention := o.getOverridesForUser(userID).CompactorBlocksRetentionPeriod1h; retention > 0 {
+		return time.Duration(retention)
+	}
+	return o.CompactorBlocksRetentionPeriod(userID)
+}
+
+// CompactorBlocksMaxRetentionPeriod returns the longest retention period of the blocks of any resolution
+// for a given user. 0 means that the blocks of some resolution are never deleted.
+func (o *Overrides) CompactorBlocksMaxRetentionPeriod(userID string) time.Duration {
+	var longest time.Duration
+	for _, retention := range []time.Duration{o.CompactorBlocksRetentionPeriod(userID), o.CompactorBlocksRetentionPeriod5m(userID), o.CompactorBlocksRetentionPeriod1h(userID)} {
+		if retention <= 0 {
+			return 0
+		}
+		if retention > longest {
+			longest = retention
+		}
+	}
+	return longest
+}
+
+// CompactorTenantPriority returns the compaction priority of a given user when backlog-aware scheduling is enabled.
+func (o *Overrides) CompactorTenantPriority(userID string) int {
+	return o.getOverridesForUser(userID).CompactorTenantPriority
+}
+
+// CompactorBlocksColdStoragePeriod returns the period after which the blocks are moved to the cold storage for a given user.
+func (o *Overrides) CompactorBlocksColdStoragePeriod(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).CompactorBlocksColdStoragePeriod)
+}
+
+// BlockBloomFilterLabelNames returns the label names for which a bloom filter of the label values is built for the blocks of a given user.
+func (o *Overrides) BlockBloomFilterLabelNames(userID string) []string {
+	return o.getOverridesForUser(userID).BlockBloomFilterLabelNames
+}
+
+// CompactorDownsampling5mDelay returns the delay after which blocks are downsampled to 5m resolution for a given user.
+func (o *Overrides) CompactorDownsampling5mDelay(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).CompactorDownsampling5mDelay)
+}
+
+// CompactorDownsampling1hDelay returns the delay after which blocks are downsampled to 1h resolution for a given user.
+func (o *Overrides) CompactorDownsampling1hDelay(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).CompactorDownsampling1hDelay)
+}
+
+// CompactorBlocksRetentionRules returns the per-selector retention rules for a given user.
+func (o *Overrides) CompactorBlocksRetentionRules(userID string) RetentionRules {
+	return o.getOverridesForUser(userID).CompactorBlocksRetentionRules
+}
+
 // CompactorSplitAndMergeShards returns the number of shards to use when splitting blocks.
 func (o *Overrides) CompactorSplitAndMergeShards(userID string) int {
 	return o.getOverridesForUser(userID).CompactorSplitAndMergeShards
@@ -408,6 +408,39 @@ func TestMaxPartialQueryLengthWithoutDefault(t *testing.T) {
 	assert.Equal(t, time.Duration(0), ov.MaxPartialQueryLength("tenant-b"))
 }
 
+func TestCompactorBlocksRetentionPeriodPerResolution(t *testing.T) {
+	tenantLimits := map[string]*Limits{
+		"tenant-a": {
+			CompactorBlocksRetentionPeriod:   model.Duration(30 * 24 * time.Hour),
+			CompactorBlocksRetentionPeriod5m: model.Duration(90 * 24 * time.Hour),
+			CompactorBlocksRetentionPeriod1h: model.Duration(365 * 24 * time.Hour),
+		},
+		"tenant-b": {
+			CompactorBlocksRetentionPeriod1h: model.Duration(365 * 24 * time.Hour),
+		},
+	}
+	defaults := Limits{
+		CompactorBlocksRetentionPeriod: model.Duration(30 * 24 * time.Hour),
+	}
+
+	ov, err := NewOverrides(defaults, NewMockTenantLimits(tenantLimits))
+	require.NoError(t, err)
+
+	// Per-resolution retention periods.
+	assert.Equal(t, 90*24*time.Hour, ov.CompactorBlocksRetentionPeriod5m("tenant-a"))
+	assert.Equal(t, 365*24*time.Hour, ov.CompactorBlocksRetentionPeriod1h("tenant-a"))
+	assert.Equal(t, 365*24*time.Hour, ov.CompactorBlocksMaxRetentionPeriod("tenant-a"))
+
+	// The raw blocks retention period is used when the resolution one is not set.
+	assert.Equal(t, 30*24*time.Hour, ov.CompactorBlocksRetentionPeriod5m("tenant-c"))
+	assert.Equal(t, 30*24*time.Hour, ov.CompactorBlocksRetentionPeriod1h("tenant-c"))
+	assert.Equal(t, 30*24*time.Hour, ov.CompactorBlocksMaxRetentionPeriod("tenant-c"))
+
+	// Blocks are never deleted if the retention period of any resolution is disabled.
+	assert.Equal(t, time.Duration(0), ov.CompactorBlocksRetentionPeriod5m("tenant-b"))
+	assert.Equal(t, time.Duration(0), ov.CompactorBlocksMaxRetentionPeriod("tenant-b"))
+}
+
 func TestAlertmanagerNotificationLimits(t *testing.T) {
 	for name, tc := range map[string]struct {
 		inputYAML         string
@@ -615,6 +648,41 @@ testuser:
 	}
 }
 
+func TestMaxGlobalValuesPerLabelNameOverrides(t *testing.T) {
+	baseYaml := `
+max_global_values_per_label_name:
+  user_id: 100
+`
+
+	overridesYaml := `
+testuser:
+  max_global_values_per_label_name:
+    url: 10
+
+otheruser:
+  max_global_values_per_label_name:
+    user_id: 0
+`
+
+	SetDefaultLimitsForYAMLUnmarshalling(Limits{})
+
+	limitsYAML := Limits{}
+	require.NoError(t, yaml.Unmarshal([]byte(baseYaml), &limitsYAML))
+
+	SetDefaultLimitsForYAMLUnmarshalling(limitsYAML)
+
+	overrides := map[string]*Limits{}
+	require.NoError(t, yaml.Unmarshal([]byte(overridesYaml), &overrides))
+
+	ov, err := NewOverrides(limitsYAML, NewMockTenantLimits(overrides))
+	require.NoError(t, err)
+
+	// Tenant overrides are merged with the defaults, without modifying them.
+	assert.Equal(t, map[string]int{"user_id": 100, "url": 10}, ov.MaxGlobalValuesPerLabelName("testuser"))
+	assert.Equal(t, map[string]int{"user_id": 0}, ov.MaxGlobalValuesPerLabelName("otheruser"))
+	assert.Equal(t, map[string]int{"user_id": 100}, ov.MaxGlobalValuesPerLabelName("defaultuser"))
+}
+
 func TestCustomTrackerConfigDeserialize(t *testing.T) {
 	expectedConfig, err := activeseries.NewCustomTrackersConfig(map[string]string{"baz": `{foo="bar"}`})
 	require.NoError(t, err, "creating expected config")
@@ -650,6 +718,58 @@ metric_relabel_configs:
 	})
 }
 
+func TestUnmarshalCompactorBlocksRetentionRules(t *testing.T) {
+	tests := map[string]struct {
+		cfg         string
+		expected    RetentionRules
+		expectedErr string
+	}{
+		"valid rules": {
+			cfg: `
+compactor_blocks_retention_rules:
+  - selector: '{__name__=~"debug_.*"}'
+    period: 7d
+  - selector: 'up{job="test"}'
+    period: 1h
+`,
+			expected: RetentionRules{
+				{Selector: `{__name__=~"debug_.*"}`, Period: model.Duration(7 * 24 * time.Hour)},
+				{Selector: `up{job="test"}`, Period: model.Duration(time.Hour)},
+			},
+		},
+		"invalid selector": {
+			cfg: `
+compactor_blocks_retention_rules:
+  - selector: '{job="test"'
+    period: 7d
+`,
+			expectedErr: `invalid compactor_blocks_retention_rules selector "{job=\"test\""`,
+		},
+		"missing period": {
+			cfg: `
+compactor_blocks_retention_rules:
+  - selector: '{job="test"}'
+`,
+			expectedErr: `invalid compactor_blocks_retention_rules period for selector "{job=\"test\"}": must be greater than 0`,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			limits := Limits{}
+			err := yaml.Unmarshal([]byte(testData.cfg), &limits)
+
+			if testData.expectedErr != "" {
+				require.ErrorContains(t, err, testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, limits.CompactorBlocksRetentionRules)
+		})
+	}
+}
+
 func TestUnmarshalMaxEstimatedChunksPerQuery(t *testing.T) {
 	testCases := map[string]bool{
 		"-0.1": false,
@@ -880,3 +1000,56 @@ func TestExtensionMarshalling(t *testing.T) {
 		require.Contains(t, string(val), `{"user":{"test_extension_struct":{"foo":42},"test_extension_string":"default string extension value","request_rate":0,"request_burst_size":0,`)
 	})
 }
+
+func TestUnmarshalBlockedQueries(t *testing.T) {
+	tests := map[string]struct {
+		cfg         string
+		expected    BlockedQueries
+		expectedErr string
+	}{
+		"valid blocked queries": {
+			cfg: `
+blocked_queries:
+  - pattern: 'up'
+  - pattern: '.*rate\(.*\[\d+d\]\).*'
+    regex: true
+    query_type: range
+`,
+			expected: BlockedQueries{
+				{Pattern: "up"},
+				{Pattern: `.*rate\(.*\[\d+d\]\).*`, Regex: true, QueryType: BlockedQueryTypeRange},
+			},
+		},
+		"invalid regex": {
+			cfg: `
+blocked_queries:
+  - pattern: '(up'
+    regex: true
+`,
+			expectedErr: `invalid blocked_queries regex pattern "(up"`,
+		},
+		"invalid query type": {
+			cfg: `
+blocked_queries:
+  - pattern: 'up'
+    query_type: series
+`,
+			expectedErr: `invalid blocked_queries query type "series" for pattern "up"`,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			limits := Limits{}
+			err := yaml.Unmarshal([]byte(testData.cfg), &limits)
+
+			if testData.expectedErr != "" {
+				require.ErrorContains(t, err, testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, limits.BlockedQueries)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"fmt"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// RetentionRule configures the retention period of the series matching a selector.
+type RetentionRule struct {
+	Selector string         `yaml:"selector" json:"selector"`
+	Period   model.Duration `yaml:"period" json:"period"`
+}
+
+// RetentionRules is a list of retention rules, each one applied independently of the others.
+type RetentionRules []RetentionRule
+
+// ExampleDoc provides an example doc for this config, especially valuable since it's a list of custom structs.
+func (r RetentionRules) ExampleDoc() (comment string, yaml interface{}) {
+	return `The following configuration deletes the series whose metric name starts with "debug_" after 7 days,` +
+			` and the series of the "dev" namespace after 30 days.`,
+		[]map[string]string{
+			{"selector": `{__name__=~"debug_.*"}`, "period": "7d"},
+			{"selector": `{namespace="dev"}`, "period": "30d"},
+		}
+}
+
+// Validate returns an error if any of the rules has an invalid selector or a non-positive period.
+func (r RetentionRules) Validate() error {
+	for _, rule := range r {
+		if _, err := parser.ParseMetricSelector(rule.Selector); err != nil {
+			return fmt.Errorf("invalid compactor_blocks_retention_rules selector %q: %w", rule.Selector, err)
+		}
+		if rule.Period <= 0 {
+			return fmt.Errorf("invalid compactor_blocks_retention_rules period for selector %q: must be greater than 0", rule.Selector)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package math
+
+// Min returns the minimum of two ints.
+func Min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/grafana/mimir/pkg/ingester/activeseries"
 	"github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/util/fieldcategory"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 var (
@@ -347,6 +348,10 @@ func getFieldCustomType(t reflect.Type) (string, bool) {
 		return "relabel_config...", true
 	case reflect.TypeOf(activeseries.CustomTrackersConfig{}).String():
 		return "map of tracker name (string) to matcher (string)", true
+	case reflect.TypeOf(validation.RetentionRules{}).String():
+		return "list of retention rules", true
+	case reflect.TypeOf(validation.BlockedQueries{}).String():
+		return "list of blocked queries", true
 	default:
 		return "", false
 	}
@@ -427,6 +432,10 @@ func getCustomFieldType(t reflect.Type) (string, bool) {
 		return "relabel_config...", true
 	case reflect.TypeOf(activeseries.CustomTrackersConfig{}).String():
 		return "map of tracker name (string) to matcher (string)", true
+	case reflect.TypeOf(validation.RetentionRules{}).String():
+		return "list of retention rules", true
+	case reflect.TypeOf(validation.BlockedQueries{}).String():
+		return "list of blocked queries", true
 	default:
 		return "", false
 	}
@@ -456,8 +465,14 @@ func ReflectType(typ string) reflect.Type {
 		return reflect.TypeOf(map[string]string{})
 	case "relabel_config...":
 		return reflect.TypeOf([]*relabel.Config{})
+	case "list of retention rules":
+		return reflect.TypeOf(validation.RetentionRules{})
+	case "list of blocked queries":
+		return reflect.TypeOf(validation.BlockedQueries{})
 	case "map of string to float64":
 		return reflect.TypeOf(map[string]float64{})
+	case "map of string to int":
+		return reflect.TypeOf(map[string]int{})
 	case "list of durations":
 		return reflect.TypeOf(tsdb.DurationList{})
 	default:
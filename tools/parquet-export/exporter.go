@@ -0,0 +1,398 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/runutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+const (
+	// exportMarkersDir is the location, relative to the tenant's output location, where the export markers
+	// are stored. Analytics engines ignore the directories starting with an underscore.
+	exportMarkersDir = "_export-markers"
+
+	exportMarkerVersion1 = 1
+
+	dateLayout = "2006-01-02"
+)
+
+// exportMarker records that a block has been exported. The blocks with a marker are not exported again.
+type exportMarker struct {
+	Version int       `json:"version"`
+	ID      ulid.ULID `json:"block_id"`
+
+	// MinTime and MaxTime of the block (millis precision).
+	MinTime int64 `json:"min_time"`
+	MaxTime int64 `json:"max_time"`
+
+	// CompactorShardID of the block, if any.
+	CompactorShardID string `json:"compactor_shard_id,omitempty"`
+
+	// Files holds the Parquet files of the block, relative to the tenant's output location.
+	Files []string `json:"files"`
+
+	// NumSamples is the number of samples exported.
+	NumSamples int64 `json:"num_samples"`
+
+	// ExportedAt is a unix timestamp (seconds precision) of when the block has been exported.
+	ExportedAt int64 `json:"exported_at"`
+}
+
+func (m *exportMarker) overlaps(other *exportMarker) bool {
+	return m.MinTime < other.MaxTime && other.MinTime < m.MaxTime
+}
+
+// tenantOutputDir returns the tenant's output location. The Parquet files are partitioned by tenant
+// and by date, using the Hive partitioning layout.
+func tenantOutputDir(userID string) string {
+	return "tenant=" + userID
+}
+
+func exportMarkerPath(userID string, id ulid.ULID) string {
+	return path.Join(tenantOutputDir(userID), exportMarkersDir, id.String()+".json")
+}
+
+type exporter struct {
+	cfg     config
+	bkt     objstore.Bucket
+	coldBkt objstore.Bucket // nil if the cold storage is disabled.
+	out     objstore.Bucket
+	logger  log.Logger
+}
+
+// exportTenant exports the tenant's blocks listed in the bucket index which haven't been exported yet.
+func (e *exporter) exportTenant(ctx context.Context, userID string) error {
+	logger := log.With(e.logger, "tenant", userID)
+
+	idx, err := bucketindex.ReadIndex(ctx, e.bkt, userID, nil, logger)
+	if errors.Is(err, bucketindex.ErrIndexNotFound) {
+		level.Info(logger).Log("msg", "bucket index not found, skipping tenant")
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "read bucket index")
+	}
+
+	markers, err := e.readExportMarkers(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	deleted := map[ulid.ULID]bool{}
+	for _, m := range idx.BlockDeletionMarks {
+		deleted[m.ID] = true
+	}
+
+	// Export the oldest blocks first.
+	blocks := append(bucketindex.Blocks(nil), idx.Blocks...)
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].MinTime != blocks[j].MinTime {
+			return blocks[i].MinTime < blocks[j].MinTime
+		}
+		return blocks[i].ID.Compare(blocks[j].ID) < 0
+	})
+
+	live := map[ulid.ULID]bool{}
+	for _, b := range blocks {
+		if deleted[b.ID] {
+			continue
+		}
+		live[b.ID] = true
+
+		if markers[b.ID] != nil || !e.shouldExport(b) {
+			continue
+		}
+		if b.StorageTier == block.ColdStorageTier && e.coldBkt == nil {
+			level.Warn(logger).Log("msg", "skipping block moved to the cold storage, because the cold storage is disabled", "block", b.ID)
+			continue
+		}
+
+		m, err := e.exportBlock(ctx, logger, userID, b, idx.Tombstones)
+		if err != nil {
+			return errors.Wrapf(err, "export block %s", b.ID)
+		}
+		markers[b.ID] = m
+	}
+
+	return e.deleteReplacedExports(ctx, logger, userID, markers, live)
+}
+
+// shouldExport returns whether the block has been fully compacted, and should be exported.
+func (e *exporter) shouldExport(b *bucketindex.Block) bool {
+	return b.Resolution == 0 && b.MaxTime-b.MinTime >= e.cfg.minBlockDuration.Milliseconds()
+}
+
+func (e *exporter) readExportMarkers(ctx context.Context, userID string) (map[ulid.ULID]*exportMarker, error) {
+	markers := map[ulid.ULID]*exportMarker{}
+
+	err := e.out.Iter(ctx, path.Join(tenantOutputDir(userID), exportMarkersDir)+"/", func(name string) error {
+		if path.Ext(name) != ".json" {
+			return nil
+		}
+
+		r, err := e.out.Get(ctx, name)
+		if err != nil {
+			return errors.Wrapf(err, "read export marker %s", name)
+		}
+		defer runutil.CloseWithLogOnErr(e.logger, r, "close export marker reader")
+
+		m := &exportMarker{}
+		if err := json.NewDecoder(r).Decode(m); err != nil {
+			return errors.Wrapf(err, "decode export marker %s", name)
+		}
+		if m.Version != exportMarkerVersion1 {
+			return errors.Errorf("unexpected export marker %s version %d", name, m.Version)
+		}
+		markers[m.ID] = m
+		return nil
+	})
+	return markers, errors.Wrap(err, "list export markers")
+}
+
+// exportBlock exports the samples of the block to one Parquet file per date, without the samples deleted
+// by the pending tombstones, and uploads the block's export marker.
+func (e *exporter) exportBlock(ctx context.Context, logger log.Logger, userID string, b *bucketindex.Block, tombstones bucketindex.Tombstones) (*exportMarker, error) {
+	logger = log.With(logger, "block", b.ID)
+	level.Info(logger).Log("msg", "exporting block", "min_time", b.MinTime, "max_time", b.MaxTime)
+	start := time.Now()
+
+	workDir := filepath.Join(e.cfg.workDir, userID, b.ID.String())
+	defer func() {
+		if err := os.RemoveAll(workDir); err != nil {
+			level.Warn(logger).Log("msg", "failed to remove work directory", "dir", workDir, "err", err)
+		}
+	}()
+
+	blockDir := filepath.Join(workDir, "block")
+	blockBkt := e.bkt
+	if b.StorageTier == block.ColdStorageTier {
+		blockBkt = e.coldBkt
+	}
+	userBkt := bucket.NewUserBucketClient(userID, blockBkt, nil)
+	if err := block.Download(ctx, logger, userBkt, b.ID, blockDir); err != nil {
+		return nil, errors.Wrap(err, "download block")
+	}
+
+	var pending bucketindex.Tombstones
+	for _, t := range tombstones.Overlapping(b.MinTime, b.MaxTime-1) {
+		if t.State == bucketindex.TombstonePending {
+			pending = append(pending, t)
+		}
+	}
+
+	outDir := filepath.Join(workDir, "out")
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "create output directory")
+	}
+	files, numSamples, err := writeParquetFiles(logger, blockDir, outDir, pending, e.cfg.rowGroupSize)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &exportMarker{
+		Version:          exportMarkerVersion1,
+		ID:               b.ID,
+		MinTime:          b.MinTime,
+		MaxTime:          b.MaxTime,
+		CompactorShardID: b.CompactorShardID,
+		NumSamples:       numSamples,
+	}
+
+	dates := make([]string, 0, len(files))
+	for date := range files {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	for _, date := range dates {
+		file := path.Join("date="+date, b.ID.String()+".parquet")
+		if err := objstore.UploadFile(ctx, logger, e.out, files[date], path.Join(tenantOutputDir(userID), file)); err != nil {
+			return nil, errors.Wrapf(err, "upload %s", file)
+		}
+		m.Files = append(m.Files, file)
+	}
+
+	// The marker is uploaded last, so that a block is exported again if the export is interrupted.
+	m.ExportedAt = time.Now().Unix()
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode export marker")
+	}
+	if err := e.out.Upload(ctx, exportMarkerPath(userID, b.ID), bytes.NewReader(data)); err != nil {
+		return nil, errors.Wrap(err, "upload export marker")
+	}
+
+	level.Info(logger).Log("msg", "exported block", "files", len(m.Files), "samples", numSamples, "duration", time.Since(start))
+	return m, nil
+}
+
+// deleteReplacedExports deletes the exports of the blocks which are not live anymore, and whose samples have
+// been exported from another live block (for example, because the block has been rewritten to delete series).
+func (e *exporter) deleteReplacedExports(ctx context.Context, logger log.Logger, userID string, markers map[ulid.ULID]*exportMarker, live map[ulid.ULID]bool) error {
+	for id, m := range markers {
+		if live[id] {
+			continue
+		}
+
+		replaced := false
+		for otherID, other := range markers {
+			if live[otherID] && other.CompactorShardID == m.CompactorShardID && other.overlaps(m) {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			continue
+		}
+
+		level.Info(logger).Log("msg", "deleting export of replaced block", "block", id)
+		for _, file := range m.Files {
+			if err := e.out.Delete(ctx, path.Join(tenantOutputDir(userID), file)); err != nil && !e.out.IsObjNotFoundErr(err) {
+				return errors.Wrapf(err, "delete %s", file)
+			}
+		}
+		// The marker is deleted last, so that the deletion is retried if interrupted.
+		if err := e.out.Delete(ctx, exportMarkerPath(userID, id)); err != nil && !e.out.IsObjNotFoundErr(err) {
+			return errors.Wrapf(err, "delete export marker of block %s", id)
+		}
+	}
+	return nil
+}
+
+// writeParquetFiles writes the samples of the block stored in blockDir to one Parquet file per date in outDir,
+// without the samples deleted by the tombstones. Returns the files by date, and the number of samples written.
+// Staleness markers are not written.
+func writeParquetFiles(logger log.Logger, blockDir, outDir string, tombstones bucketindex.Tombstones, rowGroupSize int) (_ map[string]string, numSamples int64, returnErr error) {
+	b, err := tsdb.OpenBlock(logger, blockDir, nil)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "open block")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, b, "close block")
+
+	for _, t := range tombstones {
+		selectors, err := t.Matchers()
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, matchers := range selectors {
+			if err := b.Delete(t.StartTime, t.EndTime, matchers...); err != nil {
+				return nil, 0, errors.Wrapf(err, "delete series of request %s", t.RequestID)
+			}
+		}
+	}
+
+	ir, err := b.Index()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "open index")
+	}
+	labelNames, err := ir.LabelNames()
+	if closeErr := ir.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "read label names")
+	}
+
+	q, err := tsdb.NewBlockQuerier(b, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "create querier")
+	}
+	defer runutil.CloseWithErrCapture(&returnErr, q, "close querier")
+
+	files := map[string]string{}
+	writers := map[string]*samplesWriter{}
+	defer func() {
+		for date, w := range writers {
+			if err := w.Close(); err != nil && returnErr == nil {
+				returnErr = errors.Wrapf(err, "write Parquet file of %s", date)
+			}
+		}
+	}()
+
+	writerFor := func(t int64) (*samplesWriter, error) {
+		date := time.UnixMilli(t).UTC().Format(dateLayout)
+		if w := writers[date]; w != nil {
+			return w, nil
+		}
+
+		files[date] = filepath.Join(outDir, date+".parquet")
+		w, err := newSamplesWriter(files[date], labelNames, rowGroupSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "create Parquet file of %s", date)
+		}
+		writers[date] = w
+		return w, nil
+	}
+
+	ss := q.Select(false, nil, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".*"))
+	var it chunkenc.Iterator
+	for ss.Next() {
+		series := ss.At()
+		lbls := series.Labels()
+
+		it = series.Iterator(it)
+		for typ := it.Next(); typ != chunkenc.ValNone; typ = it.Next() {
+			switch typ {
+			case chunkenc.ValFloat:
+				t, v := it.At()
+				if value.IsStaleNaN(v) {
+					continue
+				}
+				w, err := writerFor(t)
+				if err != nil {
+					return nil, 0, err
+				}
+				if err := w.appendFloat(lbls, t, v); err != nil {
+					return nil, 0, err
+				}
+			case chunkenc.ValHistogram, chunkenc.ValFloatHistogram:
+				t, h := it.AtFloatHistogram()
+				if value.IsStaleNaN(h.Sum) {
+					continue
+				}
+				w, err := writerFor(t)
+				if err != nil {
+					return nil, 0, err
+				}
+				if err := w.appendHistogram(lbls, t, h); err != nil {
+					return nil, 0, err
+				}
+			default:
+				return nil, 0, fmt.Errorf("unexpected sample type %s in series %s", typ, lbls)
+			}
+			numSamples++
+		}
+		if err := it.Err(); err != nil {
+			return nil, 0, errors.Wrapf(err, "iterate samples of series %s", lbls)
+		}
+	}
+	if err := ss.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, "iterate series")
+	}
+
+	return files, numSamples, nil
+}
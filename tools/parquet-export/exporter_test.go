@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/parquet-go/parquet-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+func TestExporter_ExportTenant(t *testing.T) {
+	const userID = "user-1"
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	bkt := objstore.NewInMemBucket()
+	out := objstore.NewInMemBucket()
+	userBkt := bucket.NewUserBucketClient(userID, bkt, nil)
+
+	e := &exporter{
+		cfg: config{
+			minBlockDuration: 24 * time.Hour,
+			rowGroupSize:     4,
+			workDir:          t.TempDir(),
+		},
+		bkt:    bkt,
+		out:    out,
+		logger: logger,
+	}
+
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "series_1", "value", "1"),
+		labels.FromStrings(labels.MetricName, "series_2"),
+		labels.FromStrings(labels.MetricName, "series_3", "pod", "pod-1"),
+	}
+	twoDays := (48 * time.Hour).Milliseconds()
+
+	// A fully compacted block spanning 2 days, and a block not fully compacted yet.
+	block1 := createTestBlock(t, userBkt, series, 0, twoDays)
+	block2 := createTestBlock(t, userBkt, series, 0, (2 * time.Hour).Milliseconds())
+	writeTestBucketIndex(t, bkt, userID, nil)
+
+	require.NoError(t, e.exportTenant(ctx, userID))
+
+	marker1 := readTestExportMarker(t, out, userID, block1)
+	require.NotNil(t, marker1)
+	assert.Equal(t, []string{
+		path.Join("date=1970-01-01", block1.String()+".parquet"),
+		path.Join("date=1970-01-02", block1.String()+".parquet"),
+	}, marker1.Files)
+	assert.Equal(t, int64(30), marker1.NumSamples)
+	numRows := 0
+	for _, file := range marker1.Files {
+		numRows += len(readTestParquetFile(t, out, path.Join(tenantOutputDir(userID), file)))
+	}
+	assert.Equal(t, 30, numRows)
+	assert.Nil(t, readTestExportMarker(t, out, userID, block2))
+
+	// The exported blocks are not exported again.
+	require.NoError(t, out.Delete(ctx, path.Join(tenantOutputDir(userID), marker1.Files[0])))
+	require.NoError(t, e.exportTenant(ctx, userID))
+	exists, err := out.Exists(ctx, path.Join(tenantOutputDir(userID), marker1.Files[0]))
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// The block is rewritten to delete a series, while the deletion is still pending.
+	block3 := createTestBlock(t, userBkt, series, 0, twoDays)
+	tombstone, err := bucketindex.NewTombstone([]string{`{__name__="series_1"}`}, 0, twoDays, time.Now())
+	require.NoError(t, err)
+	writeTestBucketIndex(t, bkt, userID, bucketindex.Tombstones{tombstone}, block1)
+
+	require.NoError(t, e.exportTenant(ctx, userID))
+
+	marker3 := readTestExportMarker(t, out, userID, block3)
+	require.NotNil(t, marker3)
+	assert.Equal(t, int64(20), marker3.NumSamples)
+
+	// The export of the replaced block is deleted.
+	assert.Nil(t, readTestExportMarker(t, out, userID, block1))
+	exists, err = out.Exists(ctx, path.Join(tenantOutputDir(userID), marker1.Files[1]))
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestExporter_ExportTenant_WithoutBucketIndex(t *testing.T) {
+	out := objstore.NewInMemBucket()
+	e := &exporter{bkt: objstore.NewInMemBucket(), out: out, logger: log.NewNopLogger()}
+
+	require.NoError(t, e.exportTenant(context.Background(), "user-1"))
+	assert.Empty(t, out.Objects())
+}
+
+func createTestBlock(t *testing.T, userBkt objstore.Bucket, series []labels.Labels, minT, maxT int64) ulid.ULID {
+	dir := t.TempDir()
+	id, err := block.CreateBlock(context.Background(), dir, series, 10, minT, maxT, labels.EmptyLabels())
+	require.NoError(t, err)
+	require.NoError(t, block.Upload(context.Background(), log.NewNopLogger(), userBkt, filepath.Join(dir, id.String()), nil))
+	return id
+}
+
+func writeTestBucketIndex(t *testing.T, bkt objstore.Bucket, userID string, tombstones bucketindex.Tombstones, markedForDeletion ...ulid.ULID) {
+	idx, _, err := bucketindex.NewUpdater(bkt, userID, nil, log.NewNopLogger()).UpdateIndex(context.Background(), nil)
+	require.NoError(t, err)
+	idx.Tombstones = tombstones
+	for _, id := range markedForDeletion {
+		idx.BlockDeletionMarks = append(idx.BlockDeletionMarks, &bucketindex.BlockDeletionMark{ID: id, DeletionTime: time.Now().Unix()})
+	}
+	require.NoError(t, bucketindex.WriteIndex(context.Background(), bkt, userID, nil, idx))
+}
+
+func readTestExportMarker(t *testing.T, out objstore.Bucket, userID string, id ulid.ULID) *exportMarker {
+	r, err := out.Get(context.Background(), exportMarkerPath(userID, id))
+	if out.IsObjNotFoundErr(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	defer r.Close()
+
+	m := &exportMarker{}
+	require.NoError(t, json.NewDecoder(r).Decode(m))
+	return m
+}
+
+func openTestParquetFile(t *testing.T, bkt objstore.Bucket, name string) *parquet.File {
+	r, err := bkt.Get(context.Background(), name)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	return f
+}
+
+// readTestParquetFile reads the rows of the Parquet file, by column name. The null values are nil.
+func readTestParquetFile(t *testing.T, bkt objstore.Bucket, name string) []map[string]interface{} {
+	pr := parquet.NewReader(openTestParquetFile(t, bkt, name))
+	defer pr.Close()
+	columns := pr.Schema().Columns()
+
+	var rows []map[string]interface{}
+	buf := make([]parquet.Row, 16)
+	for {
+		n, err := pr.ReadRows(buf)
+		for _, row := range buf[:n] {
+			values := make(map[string]interface{}, len(row))
+			for _, v := range row {
+				name := columns[v.Column()][0]
+				switch {
+				case v.IsNull():
+					values[name] = nil
+				case v.Kind() == parquet.Int64:
+					values[name] = v.Int64()
+				case v.Kind() == parquet.Double:
+					values[name] = v.Double()
+				default:
+					values[name] = string(v.ByteArray())
+				}
+			}
+			rows = append(rows, values)
+		}
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		require.NoError(t, err)
+	}
+}
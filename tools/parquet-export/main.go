@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+type config struct {
+	bucket           bucket.Config
+	coldStorage      bool
+	coldBucket       bucket.Config
+	output           bucket.Config
+	enabledUsers     flagext.StringSliceCSV
+	disabledUsers    flagext.StringSliceCSV
+	minBlockDuration time.Duration
+	rowGroupSize     int
+	workDir          string
+	exportPeriod     time.Duration
+}
+
+func (c *config) RegisterFlags(f *flag.FlagSet) {
+	c.bucket.RegisterFlags(f)
+	f.BoolVar(&c.coldStorage, "cold-storage.enabled", false, "If enabled, the blocks moved to the cold storage are read from the cold storage bucket. Otherwise, they're not exported.")
+	c.coldBucket.RegisterFlagsWithPrefix("cold-storage.", f)
+	c.output.RegisterFlagsWithPrefix("output.", f)
+	f.Var(&c.enabledUsers, "enabled-users", "If not empty, only blocks for these users are exported.")
+	f.Var(&c.disabledUsers, "disabled-users", "If not empty, blocks for these users are not exported.")
+	f.DurationVar(&c.minBlockDuration, "min-block-duration", 24*time.Hour, "Only blocks covering a block range greater than or equal to this are exported. It should be set to the largest block range of the compactor, so that only fully compacted blocks are exported.")
+	f.IntVar(&c.rowGroupSize, "row-group-size", 1000000, "Maximum number of rows (samples) in a row group of the Parquet files.")
+	f.StringVar(&c.workDir, "work-dir", filepath.Join(os.TempDir(), "parquet-export"), "Directory where the blocks are downloaded and the Parquet files are written before being uploaded.")
+	f.DurationVar(&c.exportPeriod, "export-period", 0, "How often to repeat the export. If set to 0, the export is done once, and the program stops. Otherwise, the program keeps running and exporting the new blocks until it is terminated.")
+}
+
+func main() {
+	// Clean up all flags registered via init() methods of 3rd-party libraries.
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	cfg := config{}
+	cfg.RegisterFlags(flag.CommandLine)
+
+	// Parse CLI arguments.
+	if err := flagext.ParseFlagsWithoutArguments(flag.CommandLine); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+
+	if cfg.rowGroupSize <= 0 {
+		level.Error(logger).Log("msg", "-row-group-size must be greater than 0")
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	bkt, err := bucket.NewClient(ctx, cfg.bucket, "bucket", logger, nil)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to create bucket", "err", err)
+		os.Exit(1)
+	}
+	out, err := bucket.NewClient(ctx, cfg.output, "output", logger, nil)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to create output bucket", "err", err)
+		os.Exit(1)
+	}
+
+	e := &exporter{cfg: cfg, bkt: bkt, out: out, logger: logger}
+	if cfg.coldStorage {
+		e.coldBkt, err = bucket.NewClient(ctx, cfg.coldBucket, "cold-storage", logger, nil)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to create cold storage bucket", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	success := runExport(ctx, e)
+	if cfg.exportPeriod <= 0 {
+		if success {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+
+	t := time.NewTicker(cfg.exportPeriod)
+	defer t.Stop()
+
+	for ctx.Err() == nil {
+		select {
+		case <-t.C:
+			_ = runExport(ctx, e)
+		case <-ctx.Done():
+		}
+	}
+}
+
+// runExport exports the blocks of all the enabled tenants, and returns whether all of them have been exported successfully.
+func runExport(ctx context.Context, e *exporter) bool {
+	users, err := listUsers(ctx, e)
+	if err != nil {
+		level.Error(e.logger).Log("msg", "failed to list tenants", "err", err)
+		return false
+	}
+
+	success := true
+	for _, userID := range users {
+		if ctx.Err() != nil {
+			return false
+		}
+		if err := e.exportTenant(ctx, userID); err != nil {
+			level.Error(e.logger).Log("msg", "failed to export tenant blocks", "tenant", userID, "err", err)
+			success = false
+		}
+	}
+	return success
+}
+
+func listUsers(ctx context.Context, e *exporter) ([]string, error) {
+	users, err := mimir_tsdb.ListUsers(ctx, e.bkt)
+	if err != nil {
+		return nil, errors.Wrap(err, "list tenants")
+	}
+
+	filtered := users[:0]
+	for _, userID := range users {
+		if len(e.cfg.enabledUsers) > 0 && !util.StringsContain(e.cfg.enabledUsers, userID) {
+			continue
+		}
+		if util.StringsContain(e.cfg.disabledUsers, userID) {
+			continue
+		}
+		filtered = append(filtered, userID)
+	}
+	return filtered, nil
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"os"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/parquet-go/parquet-go"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/util/jsonutil"
+
+	"github.com/grafana/mimir/pkg/util/version"
+)
+
+// Names of the columns of the samples. The labels with the same name are exported in columns prefixed with labelColumnPrefix.
+const (
+	timestampColumn      = "timestamp"
+	valueColumn          = "value"
+	histogramCountColumn = "histogram_count"
+	histogramSumColumn   = "histogram_sum"
+	histogramColumn      = "histogram"
+
+	labelColumnPrefix = "label_"
+)
+
+var sampleColumns = map[string]bool{
+	timestampColumn:      true,
+	valueColumn:          true,
+	histogramCountColumn: true,
+	histogramSumColumn:   true,
+	histogramColumn:      true,
+}
+
+// labelColumnName returns the name of the column of a label.
+func labelColumnName(labelName string) string {
+	if sampleColumns[labelName] {
+		return labelColumnPrefix + labelName
+	}
+	return labelName
+}
+
+// samplesSchema returns the schema of the Parquet files of the samples of the series with the label names.
+// The label columns are dictionary-encoded, and all the columns except the timestamp are optional.
+func samplesSchema(labelNames []string) *parquet.Schema {
+	group := parquet.Group{
+		timestampColumn:      parquet.Timestamp(parquet.Millisecond),
+		valueColumn:          parquet.Optional(parquet.Leaf(parquet.DoubleType)),
+		histogramCountColumn: parquet.Optional(parquet.Leaf(parquet.DoubleType)),
+		histogramSumColumn:   parquet.Optional(parquet.Leaf(parquet.DoubleType)),
+		histogramColumn:      parquet.Optional(parquet.JSON()),
+	}
+	for _, name := range labelNames {
+		group[labelColumnName(name)] = parquet.Optional(parquet.Encoded(parquet.String(), &parquet.RLEDictionary))
+	}
+	return parquet.NewSchema("sample", group)
+}
+
+// samplesWriter writes samples to a Parquet file, with one row per sample. Each label is a column,
+// and is null for the series without the label. The value is null for the histogram samples, and
+// the histogram columns are null for the float samples.
+type samplesWriter struct {
+	f  *os.File
+	pw *parquet.Writer
+
+	// Index of the column of each label name, and of each sample column.
+	labelNames   []string
+	labelColumns []int
+	timestamp    int
+	value        int
+	histCount    int
+	histSum      int
+	hist         int
+
+	rows   []parquet.Row
+	stream *jsoniter.Stream
+}
+
+// newSamplesWriter creates the file and returns a writer of the samples of the series with the label names.
+func newSamplesWriter(path string, labelNames []string, rowGroupSize int) (*samplesWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := samplesSchema(labelNames)
+	columnIndex := func(name string) int {
+		leaf, _ := schema.Lookup(name)
+		return leaf.ColumnIndex
+	}
+
+	w := &samplesWriter{
+		f: f,
+		pw: parquet.NewWriter(f, schema,
+			parquet.Compression(&parquet.Snappy),
+			parquet.MaxRowsPerRowGroup(int64(rowGroupSize)),
+			parquet.CreatedBy("grafana mimir parquet-export", version.Version, version.Revision),
+		),
+		labelNames: labelNames,
+		timestamp:  columnIndex(timestampColumn),
+		value:      columnIndex(valueColumn),
+		histCount:  columnIndex(histogramCountColumn),
+		histSum:    columnIndex(histogramSumColumn),
+		hist:       columnIndex(histogramColumn),
+		rows:       []parquet.Row{make(parquet.Row, len(schema.Columns()))},
+		stream:     jsoniter.NewStream(jsoniter.ConfigCompatibleWithStandardLibrary, nil, 1024),
+	}
+	for _, name := range labelNames {
+		w.labelColumns = append(w.labelColumns, columnIndex(labelColumnName(name)))
+	}
+	return w, nil
+}
+
+func (w *samplesWriter) appendFloat(lbls labels.Labels, t int64, v float64) error {
+	row := w.newRow(lbls, t)
+	row[w.value] = parquet.DoubleValue(v).Level(0, 1, w.value)
+	row[w.histCount] = parquet.NullValue().Level(0, 0, w.histCount)
+	row[w.histSum] = parquet.NullValue().Level(0, 0, w.histSum)
+	row[w.hist] = parquet.NullValue().Level(0, 0, w.hist)
+	return w.writeRow()
+}
+
+func (w *samplesWriter) appendHistogram(lbls labels.Labels, t int64, h *histogram.FloatHistogram) error {
+	row := w.newRow(lbls, t)
+	row[w.value] = parquet.NullValue().Level(0, 0, w.value)
+	row[w.histCount] = parquet.DoubleValue(h.Count).Level(0, 1, w.histCount)
+	row[w.histSum] = parquet.DoubleValue(h.Sum).Level(0, 1, w.histSum)
+
+	// The histogram is encoded like in the responses of the Prometheus HTTP API.
+	w.stream.Reset(nil)
+	jsonutil.MarshalHistogram(h, w.stream)
+	row[w.hist] = parquet.ByteArrayValue(w.stream.Buffer()).Level(0, 1, w.hist)
+	return w.writeRow()
+}
+
+// newRow returns the row of the next sample, with the label columns and the timestamp set.
+func (w *samplesWriter) newRow(lbls labels.Labels, t int64) parquet.Row {
+	row := w.rows[0]
+	for i, name := range w.labelNames {
+		c := w.labelColumns[i]
+		if v := lbls.Get(name); v != "" {
+			row[c] = parquet.ValueOf(v).Level(0, 1, c)
+		} else {
+			row[c] = parquet.NullValue().Level(0, 0, c)
+		}
+	}
+	row[w.timestamp] = parquet.Int64Value(t).Level(0, 0, w.timestamp)
+	return row
+}
+
+func (w *samplesWriter) writeRow() error {
+	_, err := w.pw.WriteRows(w.rows)
+	return err
+}
+
+// Close writes the remaining rows and the file metadata, and closes the file.
+func (w *samplesWriter) Close() error {
+	err := w.pw.Close()
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
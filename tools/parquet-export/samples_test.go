@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore/providers/filesystem"
+)
+
+func TestSamplesWriter(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := newSamplesWriter(filepath.Join(dir, "samples.parquet"), []string{labels.MetricName, "pod", "timestamp"}, 2)
+	require.NoError(t, err)
+
+	floats := labels.FromStrings(labels.MetricName, "series_1", "pod", "pod-1")
+	histograms := labels.FromStrings(labels.MetricName, "series_2", "timestamp", "yesterday")
+	h := &histogram.FloatHistogram{
+		Count:           5,
+		Sum:             10,
+		Schema:          0,
+		PositiveSpans:   []histogram.Span{{Offset: 0, Length: 1}},
+		PositiveBuckets: []float64{5},
+	}
+
+	require.NoError(t, w.appendFloat(floats, 1000, 1))
+	require.NoError(t, w.appendFloat(floats, 2000, 2))
+	require.NoError(t, w.appendHistogram(histograms, 3000, h))
+	require.NoError(t, w.Close())
+
+	bkt, err := filesystem.NewBucket(dir)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, bkt.Close()) })
+
+	rows := readTestParquetFile(t, bkt, "samples.parquet")
+	assert.Equal(t, []map[string]interface{}{
+		{labels.MetricName: "series_1", "pod": "pod-1", "label_timestamp": nil, "timestamp": int64(1000), "value": 1.0, "histogram_count": nil, "histogram_sum": nil, "histogram": nil},
+		{labels.MetricName: "series_1", "pod": "pod-1", "label_timestamp": nil, "timestamp": int64(2000), "value": 2.0, "histogram_count": nil, "histogram_sum": nil, "histogram": nil},
+		{labels.MetricName: "series_2", "pod": nil, "label_timestamp": "yesterday", "timestamp": int64(3000), "value": nil, "histogram_count": 5.0, "histogram_sum": 10.0, "histogram": `{"count":"5","sum":"10","buckets":[[0,"0.5","1","5"]]}`},
+	}, rows)
+
+	// The file is split in row groups of at most 2 rows, and the columns have the expected logical types.
+	f := openTestParquetFile(t, bkt, "samples.parquet")
+	assert.Len(t, f.RowGroups(), 2)
+
+	logicalTypes := map[string]*format.LogicalType{}
+	for _, e := range f.Metadata().Schema[1:] {
+		logicalTypes[e.Name] = e.LogicalType
+	}
+	require.NotNil(t, logicalTypes["timestamp"].Timestamp)
+	assert.NotNil(t, logicalTypes["timestamp"].Timestamp.Unit.Millis)
+	assert.NotNil(t, logicalTypes["pod"].UTF8)
+	assert.NotNil(t, logicalTypes["histogram"].Json)
+}